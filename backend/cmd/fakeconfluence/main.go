@@ -0,0 +1,115 @@
+// Command fakeconfluence serves a fake Confluence Cloud or Data Center site
+// for demos and manual testing, so UpDoc can run without an Atlassian account.
+//
+//	go run ./cmd/fakeconfluence --addr :8090
+//	go run ./cmd/fakeconfluence --fixtures ./my-fixtures --rate-limit-every 5 --retry-after 2s
+//	go run ./cmd/fakeconfluence --data-center --token my-pat
+//	go run ./cmd/fakeconfluence --oauth-client-id demo --oauth-client-secret demo-secret
+//
+// Point an organization's Confluence base URL at http://localhost:8090/wiki,
+// or http://localhost:8090 with --data-center. With --oauth-client-id it also
+// stands in for auth.atlassian.com and api.atlassian.com: set UpDoc's
+// UPDOC_ATLASSIAN_AUTH_URL and UPDOC_ATLASSIAN_API_URL to http://localhost:8090.
+// Faults can also be changed while it runs with PUT /_fake/faults.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/shaunpua/updoc/internal/confluence/confluencetest"
+	"github.com/shaunpua/updoc/internal/logging"
+)
+
+func main() {
+	if err := run(os.Args[1:]); err != nil {
+		fmt.Fprintf(os.Stderr, "fakeconfluence: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string) error {
+	fs := flag.NewFlagSet("fakeconfluence", flag.ExitOnError)
+	addr := fs.String("addr", "127.0.0.1:8090", "address to listen on")
+	baseURL := fs.String("base-url", "", "site URL used in webhook payloads (default http://<addr>/wiki, or http://<addr> on Data Center)")
+	dataCenter := fs.Bool("data-center", false, "serve a Data Center site: no /wiki context path, bearer personal access tokens")
+	fixtures := fs.String("fixtures", "", "directory of fixture *.json files (default: built-in demo site)")
+	email := fs.String("email", "", "accepted basic auth email on Cloud (empty accepts any credentials)")
+	token := fs.String("token", "", "accepted API token, or personal access token on Data Center")
+	logFormat := fs.String("log-format", "text", "log format: json or text")
+	oauthClientID := fs.String("oauth-client-id", "", "enable the Atlassian OAuth stub for this client ID (Cloud only)")
+	oauthClientSecret := fs.String("oauth-client-secret", "", "client secret the OAuth stub accepts")
+	oauthTokenTTL := fs.Duration("oauth-token-ttl", time.Hour, "lifetime of OAuth access tokens")
+
+	var faults confluencetest.Faults
+	fs.DurationVar(&faults.Latency, "latency", 0, "delay every API request")
+	fs.BoolVar(&faults.RejectAuth, "reject-auth", false, "fail every API request with 401")
+	fs.IntVar(&faults.ServerErrors, "server-errors", 0, "fail the first N API requests with 503")
+	fs.IntVar(&faults.RateLimit, "rate-limit", 0, "fail the first N API requests with 429")
+	fs.IntVar(&faults.RateLimitEvery, "rate-limit-every", 0, "fail every Nth API request with 429")
+	fs.DurationVar(&faults.RetryAfter, "retry-after", time.Second, "Retry-After sent with 429s (0 omits it)")
+	fs.Parse(args)
+
+	logger, err := logging.New(os.Stderr, *logFormat, "info")
+	if err != nil {
+		return err
+	}
+
+	opts := confluencetest.Options{
+		DataCenter: *dataCenter,
+		Email:      *email,
+		Token:      *token,
+		Logger:     logger,
+		BaseURL:    *baseURL,
+
+		OAuthClientID:     *oauthClientID,
+		OAuthClientSecret: *oauthClientSecret,
+		OAuthTokenTTL:     *oauthTokenTTL,
+	}
+	if *fixtures != "" {
+		if opts.Fixtures, err = confluencetest.LoadFixtures(os.DirFS(*fixtures)); err != nil {
+			return fmt.Errorf("load fixtures: %w", err)
+		}
+	}
+
+	ln, err := net.Listen("tcp", *addr)
+	if err != nil {
+		return err
+	}
+	if opts.BaseURL == "" {
+		opts.BaseURL = "http://" + ln.Addr().String()
+		if !opts.DataCenter {
+			opts.BaseURL += confluencetest.ContextPath
+		}
+	}
+
+	fake, err := confluencetest.New(opts)
+	if err != nil {
+		return err
+	}
+	fake.SetFaults(faults)
+
+	srv := &http.Server{Handler: fake, ReadHeaderTimeout: 10 * time.Second}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+
+	logger.Info("fake confluence listening", "base_url", opts.BaseURL)
+	if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+// Command fakenotion serves a fake Notion API for demos and manual testing,
+// so notion workspaces can be tried without a Notion account.
+//
+//	go run ./cmd/fakenotion --addr :8091 --token secret_demo
+//
+// Set UpDoc's UPDOC_NOTION_BASE_URL to http://localhost:8091 and give the
+// workspace the same token. Pages can be added, edited and trashed while it
+// runs through /_fake/pages.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/shaunpua/updoc/internal/logging"
+	"github.com/shaunpua/updoc/internal/notion/notiontest"
+)
+
+func main() {
+	if err := run(os.Args[1:]); err != nil {
+		fmt.Fprintf(os.Stderr, "fakenotion: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string) error {
+	fs := flag.NewFlagSet("fakenotion", flag.ExitOnError)
+	addr := fs.String("addr", "127.0.0.1:8091", "address to listen on")
+	token := fs.String("token", "", "accepted integration token (empty accepts any)")
+	workspace := fs.String("workspace-name", "Acme", "workspace name reported on the bot user")
+	empty := fs.Bool("empty", false, "start without the demo pages")
+	logFormat := fs.String("log-format", "text", "log format: json or text")
+	fs.Parse(args)
+
+	logger, err := logging.New(os.Stderr, *logFormat, "info")
+	if err != nil {
+		return err
+	}
+
+	fake := notiontest.New(notiontest.Options{
+		Token:         *token,
+		WorkspaceName: *workspace,
+		Empty:         *empty,
+		Logger:        logger,
+	})
+
+	ln, err := net.Listen("tcp", *addr)
+	if err != nil {
+		return err
+	}
+	srv := &http.Server{Handler: fake, ReadHeaderTimeout: 10 * time.Second}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+
+	logger.Info("fake notion listening", "base_url", "http://"+ln.Addr().String())
+	if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
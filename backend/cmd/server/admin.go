@@ -0,0 +1,240 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/shaunpua/updoc/internal/doc"
+	"github.com/shaunpua/updoc/internal/secret"
+	"github.com/shaunpua/updoc/internal/services"
+	"github.com/shaunpua/updoc/internal/storage/gormstore"
+)
+
+func runMigrate(args []string) error {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	cfg, _ := parseFlags(fs, args)
+
+	a, err := newApp(cfg)
+	if err != nil {
+		return err
+	}
+	if err := gormstore.AutoMigrate(a.db); err != nil {
+		return fmt.Errorf("failed to migrate database: %w", err)
+	}
+	encrypted, err := gormstore.EncryptWorkspaceSecrets(a.db, a.cipher)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt workspace credentials: %w", err)
+	}
+	if encrypted > 0 {
+		fmt.Printf("Encrypted plaintext credentials in %d workspace(s)\n", encrypted)
+	}
+	fmt.Println("Migrations applied")
+	return nil
+}
+
+func runCreateOrg(args []string) error {
+	fs := flag.NewFlagSet("create-org", flag.ExitOnError)
+	var req services.CreateOrgRequest
+	fs.StringVar(&req.Name, "name", "", "organization name (required)")
+	fs.StringVar(&req.UserName, "admin-name", "", "admin user's name (required)")
+	fs.StringVar(&req.UserEmail, "admin-email", "", "admin user's email (required)")
+	fs.StringVar(&req.ConfluenceBaseURL, "confluence-url", "", "Confluence base URL, e.g. https://acme.atlassian.net/wiki")
+	fs.StringVar(&req.ConfluenceAuthMode, "confluence-auth", "", "Confluence auth mode: cloud_basic, dc_bearer or dc_basic (default: picked from the URL)")
+	fs.StringVar(&req.ConfluenceEmail, "confluence-email", "", "Confluence account email, or username on Data Center")
+	fs.StringVar(&req.ConfluenceToken, "confluence-token", "", "Confluence API token, or personal access token or password on Data Center")
+	fs.StringVar(&req.ConfluenceSpaceKey, "confluence-space", "", "Confluence space key")
+	cfg, _ := parseFlags(fs, args)
+
+	if req.Name == "" || req.UserName == "" || req.UserEmail == "" {
+		return errors.New("--name, --admin-name and --admin-email are required")
+	}
+
+	a, err := newApp(cfg)
+	if err != nil {
+		return err
+	}
+
+	resp, err := a.orgService.CreateWithUser(context.Background(), req)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Organization: %s (slug %s, id %s)\n", resp.Organization.Name, resp.Organization.Slug, resp.Organization.ID)
+	fmt.Printf("Admin:        %s <%s> (id %s)\n", resp.User.Name, resp.User.Email, resp.User.ID)
+	if resp.Workspace != nil {
+		fmt.Printf("Workspace:    %s (id %s)\n", resp.Workspace.Name, resp.Workspace.ID)
+	}
+	fmt.Printf("API token:    %s\n", resp.APIToken)
+	fmt.Println("The token is not stored in plaintext and cannot be shown again.")
+	return nil
+}
+
+func runCreateAdmin(args []string) error {
+	fs := flag.NewFlagSet("create-admin", flag.ExitOnError)
+	slug := fs.String("org", "", "organization slug (required)")
+	name := fs.String("name", "", "user's name (required)")
+	email := fs.String("email", "", "user's email (required)")
+	cfg, _ := parseFlags(fs, args)
+
+	if *slug == "" || *name == "" || *email == "" {
+		return errors.New("--org, --name and --email are required")
+	}
+
+	a, err := newApp(cfg)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	org, err := a.orgService.GetBySlug(ctx, *slug)
+	if err != nil {
+		return err
+	}
+	user, err := a.orgService.AddUser(ctx, org.ID, *email, *name, "admin")
+	if err != nil {
+		return err
+	}
+	token, err := a.authService.IssueToken(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Admin:     %s <%s> (id %s) in %s\n", user.Name, user.Email, user.ID, org.Slug)
+	fmt.Printf("API token: %s\n", token)
+	return nil
+}
+
+func runRotateEncryptionKey(args []string) error {
+	fs := flag.NewFlagSet("rotate-encryption-key", flag.ExitOnError)
+	newKey := fs.String("new-key", "", "base64-encoded 32-byte key to encrypt with")
+	generate := fs.Bool("generate", false, "generate a new random key")
+	cfg, _ := parseFlags(fs, args)
+
+	if *generate == (*newKey != "") {
+		return errors.New("pass exactly one of --new-key or --generate")
+	}
+	if *generate {
+		key, err := secret.GenerateKey()
+		if err != nil {
+			return err
+		}
+		*newKey = key
+	}
+
+	to, err := secret.NewCipher(*newKey)
+	if err != nil {
+		return fmt.Errorf("--new-key: %w", err)
+	}
+
+	// The current key decrypts; rows stored before encryption was enabled are plaintext and encrypted for the first time
+	a, err := newApp(cfg)
+	if err != nil {
+		return err
+	}
+
+	rotated, err := gormstore.RotateEncryptionKey(a.db, a.cipher, to)
+	if err != nil {
+		return fmt.Errorf("rotation aborted, nothing was changed: %w", err)
+	}
+
+	fmt.Printf("Re-encrypted %d credential(s).\n", rotated)
+	fmt.Println("Update the deployment before restarting:")
+	fmt.Printf("  UPDOC_ENCRYPTION_KEY=%s\n", *newKey)
+	fmt.Println("  and keep the old key in UPDOC_PREVIOUS_ENCRYPTION_KEYS until every instance has restarted.")
+	return nil
+}
+
+func runSyncWorkspace(args []string) error {
+	fs := flag.NewFlagSet("sync-workspace", flag.ExitOnError)
+	cfg, positional := parseFlags(fs, args)
+	if len(positional) != 1 {
+		return errors.New("usage: sync-workspace <workspace-id>")
+	}
+
+	a, err := newApp(cfg)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	ws, err := a.workspaceRepo.GetByID(ctx, positional[0])
+	if err != nil {
+		return fmt.Errorf("workspace %s: %w", positional[0], err)
+	}
+
+	result, err := a.workspaceService.SyncWorkspace(ctx, ws)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Synced %s: %d page(s), %d created, %d updated\n", ws.Name, result.Total, result.Created, result.Updated)
+	return nil
+}
+
+// orgExport is the JSON layout written by export-org. Credentials are never included.
+type orgExport struct {
+	ExportedAt   time.Time         `json:"exported_at"`
+	Organization *doc.Organization `json:"organization"`
+	Users        []*doc.User       `json:"users"`
+	Workspaces   []*doc.Workspace  `json:"workspaces"`
+	Documents    []*doc.Document   `json:"documents"`
+	Flags        []*doc.Flag       `json:"flags"`
+}
+
+func runExportOrg(args []string) error {
+	fs := flag.NewFlagSet("export-org", flag.ExitOnError)
+	out := fs.String("out", "", "write to this file instead of stdout")
+	cfg, positional := parseFlags(fs, args)
+	if len(positional) != 1 {
+		return errors.New("usage: export-org <slug> [--out FILE]")
+	}
+
+	a, err := newApp(cfg)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	org, err := a.orgRepo.GetBySlug(ctx, positional[0])
+	if err != nil {
+		return fmt.Errorf("organization %s: %w", positional[0], err)
+	}
+
+	export := orgExport{ExportedAt: time.Now().UTC(), Organization: org}
+	if export.Users, err = a.userRepo.GetByOrgID(ctx, org.ID); err != nil {
+		return err
+	}
+	if export.Workspaces, err = a.workspaceRepo.GetByOrgID(ctx, org.ID); err != nil {
+		return err
+	}
+	for i, ws := range export.Workspaces {
+		// Integration configs hold webhook secrets and Notion tokens
+		export.Workspaces[i] = services.RedactWorkspace(ws)
+		docs, err := a.documentRepo.GetByWorkspaceID(ctx, ws.ID)
+		if err != nil {
+			return err
+		}
+		export.Documents = append(export.Documents, docs...)
+	}
+	if export.Flags, err = a.flagRepo.GetByFilters(ctx, doc.FlagFilters{OrgID: org.ID}); err != nil {
+		return err
+	}
+
+	w := os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(export)
+}
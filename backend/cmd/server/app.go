@@ -0,0 +1,148 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/shaunpua/updoc/internal/config"
+	"github.com/shaunpua/updoc/internal/confluence"
+	"github.com/shaunpua/updoc/internal/gitrepo"
+	"github.com/shaunpua/updoc/internal/logging"
+	"github.com/shaunpua/updoc/internal/notion"
+	"github.com/shaunpua/updoc/internal/secret"
+	"github.com/shaunpua/updoc/internal/services"
+	"github.com/shaunpua/updoc/internal/storage/gormstore"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// app holds the database, repositories and services shared by every subcommand
+type app struct {
+	cfg    config.Config
+	logger *slog.Logger
+	db     *gorm.DB
+	cipher *secret.Cipher
+
+	orgRepo          *gormstore.OrganizationRepo
+	userRepo         *gormstore.UserRepo
+	workspaceRepo    *gormstore.WorkspaceRepo
+	documentRepo     *gormstore.DocumentRepo
+	flagRepo         *gormstore.FlagRepo
+	notificationRepo *gormstore.NotificationRepo
+
+	authService         *services.AuthService
+	orgService          *services.OrganizationService
+	confluenceService   *services.ConfluenceService
+	providers           *services.Providers
+	workspaceService    *services.WorkspaceService
+	documentService     *services.DocumentService
+	flagService         *services.FlagService
+	codeChangeService   *services.CodeChangeService
+	notificationService *services.NotificationService
+	webhookService      *services.ConfluenceWebhookService
+}
+
+// parseFlags parses a subcommand's flags, including the shared configuration
+// flags, and returns the validated configuration plus positional arguments.
+// Flags may appear before or after positional arguments. It also installs
+// the configured logger as the slog default.
+func parseFlags(fs *flag.FlagSet, args []string) (config.Config, []string) {
+	cfgFlags := config.BindFlags(fs)
+
+	var positional []string
+	for {
+		fs.Parse(args)
+		args = fs.Args()
+		if len(args) == 0 {
+			break
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+
+	cfg, err := config.Load(cfgFlags)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	logger, err := logging.New(os.Stderr, cfg.Log.Format, cfg.Log.Level)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	slog.SetDefault(logger)
+
+	return cfg, positional
+}
+
+func newApp(cfg config.Config) (*app, error) {
+	cipher, err := secret.NewCipher(cfg.Security.EncryptionKey, cfg.Security.PreviousEncryptionKeys...)
+	if err != nil {
+		return nil, fmt.Errorf("encryption key: %w", err)
+	}
+
+	logger := slog.Default()
+
+	dsn := cfg.Database.DSN()
+	logger.Info("connecting to database", "dsn", config.RedactDSN(dsn))
+	gormDB, err := gorm.Open(postgres.Open(dsn), &gorm.Config{
+		Logger: gormstore.NewLogger(logger, cfg.Database.SlowQueryThreshold),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	if err := gormDB.Use(gormstore.Metrics{}); err != nil {
+		return nil, fmt.Errorf("failed to register query metrics: %w", err)
+	}
+	if err := gormDB.Use(gormstore.Tracing{}); err != nil {
+		return nil, fmt.Errorf("failed to register query tracing: %w", err)
+	}
+
+	sqlDB, err := gormDB.DB()
+	if err != nil {
+		return nil, err
+	}
+	sqlDB.SetMaxOpenConns(cfg.Database.MaxOpenConns)
+	sqlDB.SetMaxIdleConns(cfg.Database.MaxIdleConns)
+	sqlDB.SetConnMaxLifetime(cfg.Database.ConnMaxLifetime)
+	sqlDB.SetConnMaxIdleTime(cfg.Database.ConnMaxIdleTime)
+
+	a := &app{cfg: cfg, logger: logger, db: gormDB, cipher: cipher}
+
+	// Initialize repositories
+	a.orgRepo = gormstore.NewOrganizationRepo(gormDB, cipher)
+	a.userRepo = gormstore.NewUserRepo(gormDB)
+	a.workspaceRepo = gormstore.NewWorkspaceRepo(gormDB, cipher)
+	a.documentRepo = gormstore.NewDocumentRepo(gormDB)
+	a.flagRepo = gormstore.NewFlagRepo(gormDB)
+	a.notificationRepo = gormstore.NewNotificationRepo(gormDB)
+
+	// Initialize services
+	a.authService = services.NewAuthService(a.userRepo)
+	a.orgService = services.NewOrganizationService(a.orgRepo, a.userRepo, a.workspaceRepo, logger)
+	a.confluenceService = services.NewConfluenceService(a.orgRepo, confluence.New(cfg.Confluence, logger), cipher, logger)
+	// Git workspaces and code change reports share clones of remote repositories
+	git := gitrepo.New(cfg.Git, logger)
+	a.providers = services.NewProviders(
+		services.NewConfluenceProvider(a.confluenceService),
+		services.NewNotionProvider(notion.New(cfg.Notion, logger)),
+		services.NewGitProvider(git),
+	)
+	a.workspaceService = services.NewWorkspaceService(a.workspaceRepo, a.documentRepo, a.flagRepo, a.userRepo, a.confluenceService, a.providers, logger)
+	a.documentService = services.NewDocumentService(a.documentRepo, a.flagRepo, a.workspaceService, logger)
+	a.flagService = services.NewFlagService(a.flagRepo, a.documentRepo, a.userRepo, a.notificationRepo, a.workspaceService, a.confluenceService, logger)
+	a.codeChangeService = services.NewCodeChangeService(git, a.documentRepo, a.flagRepo, a.userRepo, a.workspaceService, a.flagService, logger)
+	a.notificationService = services.NewNotificationService(a.notificationRepo, logger)
+	a.webhookService = services.NewConfluenceWebhookService(a.orgRepo, a.workspaceRepo, a.documentRepo, a.flagService, logger)
+
+	return a, nil
+}
+
+func runConfig(args []string) error {
+	fs := flag.NewFlagSet("config", flag.ExitOnError)
+	cfg, _ := parseFlags(fs, args)
+	return cfg.WriteYAML(os.Stdout)
+}
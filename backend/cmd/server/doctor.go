@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/shaunpua/updoc/internal/storage/gormstore"
+)
+
+// runDoctor checks the deployment and exits non-zero if anything is broken
+func runDoctor(args []string) error {
+	fs := flag.NewFlagSet("doctor", flag.ExitOnError)
+	timeout := fs.Duration("timeout", 15*time.Second, "timeout for each Confluence check")
+	cfg, _ := parseFlags(fs, args)
+
+	a, err := newApp(cfg)
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	report := func(ok bool, name, detail string) {
+		status := "ok  "
+		if !ok {
+			status = "FAIL"
+			failed++
+		}
+		fmt.Printf("[%s] %-40s %s\n", status, name, detail)
+	}
+
+	ctx := context.Background()
+
+	sqlDB, err := a.db.DB()
+	if err == nil {
+		err = sqlDB.PingContext(ctx)
+	}
+	if err != nil {
+		report(false, "database", err.Error())
+		return errors.New("database unreachable")
+	}
+	report(true, "database", "reachable")
+
+	pending, err := gormstore.PendingMigrations(ctx, a.db)
+	switch {
+	case err != nil:
+		report(false, "migrations", err.Error())
+	case len(pending) > 0:
+		report(false, "migrations", "pending: "+strings.Join(pending, ", ")+" (run 'migrate')")
+	default:
+		report(true, "migrations", "up to date")
+	}
+
+	orgs, err := a.orgRepo.List(ctx)
+	if err != nil {
+		report(false, "organizations", err.Error())
+	}
+	for _, org := range orgs {
+		name := "confluence: " + org.Slug
+		if org.ConfluenceBaseURL == "" {
+			report(true, name, "not configured")
+			continue
+		}
+
+		checkCtx, cancel := context.WithTimeout(ctx, *timeout)
+		result, err := a.confluenceService.TestConnection(checkCtx, org.ID)
+		cancel()
+		switch {
+		case err != nil:
+			report(false, name, err.Error())
+		case !result.Success:
+			report(false, name, result.Message+": "+result.Details)
+		default:
+			report(true, name, result.Message)
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d check(s) failed", failed)
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	"github.com/shaunpua/updoc/internal/health"
+	"github.com/shaunpua/updoc/internal/services"
+	"github.com/shaunpua/updoc/internal/storage/gormstore"
+)
+
+// readinessChecks builds the /readyz checks. monitor may be nil when
+// Confluence probing is disabled.
+func readinessChecks(a *app, sqlDB *sql.DB, monitor *services.ConfluenceMonitor) []health.Check {
+	// The schema only moves forward, so once it is current there is no need
+	// to inspect it again on every probe
+	var migrated atomic.Bool
+
+	checks := []health.Check{
+		{
+			Name:     "database",
+			Critical: true,
+			Run: func(ctx context.Context) (interface{}, error) {
+				return nil, sqlDB.PingContext(ctx)
+			},
+		},
+		{
+			Name:     "migrations",
+			Critical: true,
+			Run: func(ctx context.Context) (interface{}, error) {
+				if migrated.Load() {
+					return nil, nil
+				}
+				pending, err := gormstore.PendingMigrations(ctx, a.db)
+				if err != nil {
+					return nil, err
+				}
+				if len(pending) > 0 {
+					return pending, fmt.Errorf("pending: %s", strings.Join(pending, ", "))
+				}
+				migrated.Store(true)
+				return nil, nil
+			},
+		},
+	}
+
+	if monitor == nil {
+		return append(checks, health.WorkersCheck())
+	}
+
+	interval := a.cfg.Health.ConfluenceProbeInterval
+	return append(checks,
+		health.WorkersCheck(health.Worker{
+			Name:     "confluence_monitor",
+			LastBeat: monitor.LastBeat,
+			// A round may spend up to the Confluence timeout on each org, so
+			// allow a few intervals before calling the monitor stuck
+			MaxAge: 3*interval + a.cfg.Confluence.Timeout,
+		}),
+		health.Check{
+			// Informational: one org's bad credentials shouldn't pull the pod out of rotation
+			Name: "confluence",
+			Run: func(ctx context.Context) (interface{}, error) {
+				summary, ok := monitor.Summary()
+				if !ok {
+					return "awaiting first probe", nil
+				}
+				if len(summary.Unreachable) > 0 {
+					return summary, fmt.Errorf("%d of %d organization(s) unreachable", len(summary.Unreachable), summary.Configured)
+				}
+				return summary, nil
+			},
+		},
+	)
+}
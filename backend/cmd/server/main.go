@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/joho/godotenv"
+	"github.com/shaunpua/updoc/internal/logging"
+)
+
+type command struct {
+	name    string
+	usage   string
+	summary string
+	run     func(args []string) error
+}
+
+var commands = []command{
+	{"serve", "serve", "Migrate the database and start the HTTP server (default)", runServe},
+	{"migrate", "migrate", "Apply database migrations and exit", runMigrate},
+	{"create-org", "create-org --name N --admin-name N --admin-email E [--confluence-*]", "Create an organization and its admin user", runCreateOrg},
+	{"create-admin", "create-admin --org SLUG --name N --email E", "Add an admin user to an organization and print their API token", runCreateAdmin},
+	{"rotate-encryption-key", "rotate-encryption-key --new-key KEY | --generate", "Re-encrypt stored credentials with a new key", runRotateEncryptionKey},
+	{"sync-workspace", "sync-workspace <workspace-id>", "Import a workspace's pages from Confluence", runSyncWorkspace},
+	{"export-org", "export-org <slug> [--out FILE]", "Export an organization's users, workspaces, documents and flags as JSON", runExportOrg},
+	{"doctor", "doctor", "Check the database, migrations and each org's Confluence connectivity", runDoctor},
+	{"config", "config", "Print the effective configuration with secrets redacted", runConfig},
+}
+
+func main() {
+	// Until the configuration is loaded, log as text at info level
+	bootstrap, _ := logging.New(os.Stderr, "text", "info")
+	slog.SetDefault(bootstrap)
+
+	// Load environment variables
+	if err := godotenv.Load(); err != nil {
+		slog.Debug(".env file not loaded", "error", err)
+	}
+
+	// No subcommand (or only flags) keeps the old behaviour of serving
+	name, args := "serve", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+
+	if name == "help" {
+		usage()
+		return
+	}
+
+	for _, cmd := range commands {
+		if cmd.name != name {
+			continue
+		}
+		if err := cmd.run(args); err != nil {
+			slog.Error("command failed", "command", cmd.name, "error", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	fmt.Fprintf(os.Stderr, "unknown command %q\n\n", name)
+	usage()
+	os.Exit(2)
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: server <command> [flags]")
+	fmt.Fprintln(os.Stderr)
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-24s %s\n      %s\n", cmd.name, cmd.summary, cmd.usage)
+	}
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Every command also accepts --config FILE and the configuration flags listed by 'server <command> -h'.")
+}
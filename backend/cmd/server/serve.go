@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/shaunpua/updoc/internal/health"
+	"github.com/shaunpua/updoc/internal/metrics"
+	"github.com/shaunpua/updoc/internal/services"
+	"github.com/shaunpua/updoc/internal/storage/gormstore"
+	"github.com/shaunpua/updoc/internal/tracing"
+	transport "github.com/shaunpua/updoc/internal/transport/http"
+)
+
+func runServe(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	cfg, _ := parseFlags(fs, args)
+
+	a, err := newApp(cfg)
+	if err != nil {
+		return err
+	}
+	a.logger.Info("effective configuration", "config", cfg.Redacted())
+
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing)
+	if err != nil {
+		return err
+	}
+	if cfg.Tracing.Endpoint != "" {
+		a.logger.Info("exporting traces", "endpoint", cfg.Tracing.Endpoint, "sample_ratio", cfg.Tracing.SampleRatio)
+	}
+
+	// Auto-migrate database schema
+	if err := gormstore.AutoMigrate(a.db); err != nil {
+		return fmt.Errorf("failed to migrate database: %w", err)
+	}
+	if encrypted, err := gormstore.EncryptWorkspaceSecrets(a.db, a.cipher); err != nil {
+		return fmt.Errorf("failed to encrypt workspace credentials: %w", err)
+	} else if encrypted > 0 {
+		a.logger.Info("encrypted plaintext workspace credentials", "workspaces", encrypted)
+	}
+
+	// Export pool stats and open flag counts alongside the request metrics
+	sqlDB, err := a.db.DB()
+	if err != nil {
+		return err
+	}
+	if err := metrics.RegisterDB(sqlDB); err != nil {
+		return fmt.Errorf("failed to register database metrics: %w", err)
+	}
+	if err := metrics.RegisterFlags(a.flagRepo, a.logger); err != nil {
+		return fmt.Errorf("failed to register flag metrics: %w", err)
+	}
+
+	// Background workers stop when the server starts shutting down
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+
+	var monitor *services.ConfluenceMonitor
+	if cfg.Health.ConfluenceProbeInterval > 0 {
+		monitor = services.NewConfluenceMonitor(a.orgRepo, a.confluenceService,
+			cfg.Health.ConfluenceProbeInterval, cfg.Confluence.Timeout, a.logger)
+		go monitor.Run(workerCtx)
+	}
+	if cfg.Confluence.PageWatchInterval > 0 {
+		watcher := services.NewPageWatcher(a.flagRepo, a.workspaceRepo, a.providers, a.flagService,
+			cfg.Confluence.PageWatchInterval, max(cfg.Confluence.Timeout, cfg.Notion.Timeout, cfg.Git.CloneTimeout), a.logger)
+		go watcher.Run(workerCtx)
+	}
+	checker := health.NewChecker(cfg.Health.CheckTimeout, readinessChecks(a, sqlDB, monitor)...)
+
+	// Setup HTTP router with the API endpoints. Request contexts expire with
+	// the write timeout, since no response can be sent after it.
+	e := transport.NewRouter(transport.Handlers{
+		Logger:         a.logger,
+		ServiceName:    cfg.Tracing.ServiceName,
+		RequestTimeout: cfg.Server.WriteTimeout,
+		Health:         transport.NewHealthHandler(checker),
+		Auth:           a.authService,
+		Organizations:  transport.NewOrganizationHandler(a.orgService, a.confluenceService, a.workspaceService),
+		Workspaces:     transport.NewWorkspaceHandler(a.workspaceService),
+		Documents:      transport.NewDocumentHandler(a.documentService),
+		Flags:          transport.NewFlagHandler(a.flagService),
+		CodeChanges:    transport.NewCodeChangeHandler(a.codeChangeService),
+		Notifications:  transport.NewNotificationHandler(a.notificationService),
+		Webhooks:       transport.NewWebhookHandler(a.webhookService),
+	})
+	e.Server.ReadTimeout = cfg.Server.ReadTimeout
+	e.Server.WriteTimeout = cfg.Server.WriteTimeout
+	e.Server.IdleTimeout = cfg.Server.IdleTimeout
+
+	a.logger.Info("starting server", "port", cfg.Server.Port)
+
+	// Start server in background
+	go func() {
+		if err := e.Start(fmt.Sprintf(":%d", cfg.Server.Port)); err != nil && err != http.ErrServerClosed {
+			a.logger.Error("server failed to start", "error", err)
+			os.Exit(1)
+		}
+	}()
+
+	// Wait for interrupt or termination signal for graceful shutdown
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
+	<-quit
+
+	// Fail readiness first so load balancers stop sending new requests
+	checker.Drain()
+	a.logger.Info("draining", "delay", cfg.Health.DrainDelay)
+	time.Sleep(cfg.Health.DrainDelay)
+
+	a.logger.Info("shutting down server")
+	stopWorkers()
+
+	// Graceful shutdown with timeout
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+
+	if err := e.Shutdown(ctx); err != nil {
+		a.logger.Error("server forced to shutdown", "error", err)
+	} else {
+		a.logger.Info("server exited gracefully")
+	}
+
+	// Flush spans still buffered by the exporter
+	if err := shutdownTracing(ctx); err != nil {
+		a.logger.Warn("failed to flush traces", "error", err)
+	}
+	return nil
+}
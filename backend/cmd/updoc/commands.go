@@ -0,0 +1,467 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/shaunpua/updoc/pkg/client"
+)
+
+// parseArgs parses flags that may appear before or after positional
+// arguments (Go's flag package stops at the first positional one)
+func parseArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+func runLogin(ctx context.Context, args []string) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	fs := flag.NewFlagSet("login", flag.ContinueOnError)
+	server := fs.String("server", cfg.Server, "UpDoc server URL, e.g. http://localhost:9000")
+	token := fs.String("token", "", "API token (read from stdin if omitted)")
+	if _, err := parseArgs(fs, args); err != nil {
+		return err
+	}
+
+	if *server == "" {
+		*server = "http://localhost:9000"
+	}
+	if *token == "" {
+		fmt.Fprint(os.Stderr, "API token: ")
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+		*token = strings.TrimSpace(line)
+	}
+	if *token == "" {
+		return errors.New("an API token is required")
+	}
+
+	me, err := client.New(*server, client.WithToken(*token)).Me(ctx)
+	if err != nil {
+		return fmt.Errorf("could not verify token: %w", err)
+	}
+
+	path, err := saveConfig(&config{Server: *server, Token: *token, Email: me.Email})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Logged in to %s as %s (%s). Credentials saved to %s\n", *server, me.Name, me.Email, path)
+	return nil
+}
+
+func runFlag(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("flag", flag.ContinueOnError)
+	priority := fs.String("priority", "medium", "urgent, high, medium or low")
+	assign := fs.String("assign", "", "assignee email")
+	title := fs.String("title", "Documentation is outdated", "flag title")
+	note := fs.String("note", "", "what is wrong with the document")
+	output := outputFlag(fs)
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return errors.New("usage: updoc flag <document-url> [--priority high] [--assign email] [--title ...] [--note ...]")
+	}
+
+	c, err := newClient()
+	if err != nil {
+		return err
+	}
+
+	f, err := c.CreateFlag(ctx, client.CreateFlagRequest{
+		DocumentURL: positional[0],
+		Title:       *title,
+		Description: *note,
+		Priority:    *priority,
+		AssignTo:    *assign,
+	})
+	if err != nil {
+		return err
+	}
+	return render(*output, f, flagTable([]*client.Flag{f}))
+}
+
+func runMine(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("mine", flag.ContinueOnError)
+	created := fs.Bool("created", false, "list flags you created instead of flags assigned to you")
+	status := fs.String("status", "", "filter by status (pending, in_progress, resolved, archived)")
+	output := outputFlag(fs)
+	if _, err := parseArgs(fs, args); err != nil {
+		return err
+	}
+
+	c, err := newClient()
+	if err != nil {
+		return err
+	}
+
+	filters := client.FlagFilters{Status: *status, AssignedTo: client.Me}
+	if *created {
+		filters = client.FlagFilters{Status: *status, CreatedBy: client.Me}
+	}
+	flags, err := c.ListFlags(ctx, filters)
+	if err != nil {
+		return err
+	}
+	return render(*output, flags, flagTable(flags))
+}
+
+func runResolve(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("resolve", flag.ContinueOnError)
+	note := fs.String("note", "", "resolution note")
+	output := outputFlag(fs)
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return errors.New("usage: updoc resolve <flag-id> [--note ...]")
+	}
+
+	c, err := newClient()
+	if err != nil {
+		return err
+	}
+
+	f, err := c.ResolveFlag(ctx, positional[0], *note)
+	if err != nil {
+		return err
+	}
+	if f.ResolutionWarning != "" {
+		fmt.Fprintf(os.Stderr, "warning: %s\n", f.ResolutionWarning)
+	}
+	return render(*output, f, flagTable([]*client.Flag{f}))
+}
+
+func runConfirm(ctx context.Context, args []string) error {
+	return answerVerification(ctx, "confirm", args, (*client.Client).ConfirmFlag)
+}
+
+func runReopen(ctx context.Context, args []string) error {
+	return answerVerification(ctx, "reopen", args, (*client.Client).ReopenFlag)
+}
+
+// answerVerification runs confirm or reopen, which share their arguments
+func answerVerification(ctx context.Context, name string, args []string, call func(*client.Client, context.Context, string, string) (*client.Flag, error)) error {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	note := fs.String("note", "", "note for the creator and assignee")
+	output := outputFlag(fs)
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return fmt.Errorf("usage: updoc %s <flag-id> [--note ...]", name)
+	}
+
+	c, err := newClient()
+	if err != nil {
+		return err
+	}
+
+	f, err := call(c, ctx, positional[0], *note)
+	if err != nil {
+		return err
+	}
+	return render(*output, f, flagTable([]*client.Flag{f}))
+}
+
+func runNotifications(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("notifications", flag.ContinueOnError)
+	all := fs.Bool("all", false, "include notifications already read")
+	markRead := fs.Bool("mark-read", false, "then mark all your notifications read")
+	output := outputFlag(fs)
+	if _, err := parseArgs(fs, args); err != nil {
+		return err
+	}
+
+	c, err := newClient()
+	if err != nil {
+		return err
+	}
+
+	notifications, err := c.ListNotifications(ctx, !*all, 0)
+	if err != nil {
+		return err
+	}
+	err = render(*output, notifications, func(w io.Writer) {
+		fmt.Fprintln(w, "FLAG\tTYPE\tWHEN\tMESSAGE")
+		for _, n := range notifications {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", n.FlagID, n.Type, n.CreatedAt.Format("2006-01-02 15:04"), n.Message)
+		}
+	})
+	if err != nil || !*markRead {
+		return err
+	}
+	return c.MarkAllNotificationsRead(ctx)
+}
+
+func runDiff(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("diff", flag.ContinueOnError)
+	sideBySide := fs.Bool("side-by-side", false, "show the versions in two columns")
+	contextLines := fs.Int("context", 3, "unchanged lines to show around each change")
+	output := outputFlag(fs)
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return errors.New("usage: updoc diff <flag-id> [--side-by-side] [--context N]")
+	}
+
+	c, err := newClient()
+	if err != nil {
+		return err
+	}
+
+	format := "unified"
+	if *sideBySide {
+		format = "side_by_side"
+	}
+	d, err := c.GetFlagDiff(ctx, positional[0], format, *contextLines)
+	if err != nil {
+		return err
+	}
+	if d.Warning != "" {
+		fmt.Fprintf(os.Stderr, "warning: %s\n", d.Warning)
+	}
+	return render(*output, d, func(w io.Writer) {
+		fmt.Fprintf(w, "%s: version %d to %d, +%d -%d\n", d.Title, d.FromVersion, d.ToVersion, d.Added, d.Removed)
+		if !d.Changed {
+			fmt.Fprintln(w, "No changes.")
+			return
+		}
+		if d.Format == "unified" {
+			fmt.Fprint(w, d.Unified)
+			return
+		}
+		for _, h := range d.Hunks {
+			fmt.Fprintln(w, h.Header)
+			for _, r := range h.Rows {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", lineNumber(r.LeftLine), truncate(r.Left, 60), diffMarker(string(r.Op)), lineNumber(r.RightLine), truncate(r.Right, 60))
+			}
+		}
+	})
+}
+
+func lineNumber(n int) string {
+	if n == 0 {
+		return ""
+	}
+	return fmt.Sprint(n)
+}
+
+func diffMarker(op string) string {
+	switch op {
+	case "delete":
+		return "<"
+	case "insert":
+		return ">"
+	case "change":
+		return "|"
+	}
+	return ""
+}
+
+func runWorkspaces(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("workspaces", flag.ContinueOnError)
+	output := outputFlag(fs)
+	if _, err := parseArgs(fs, args); err != nil {
+		return err
+	}
+
+	c, err := newClient()
+	if err != nil {
+		return err
+	}
+
+	workspaces, err := c.ListWorkspaces(ctx)
+	if err != nil {
+		return err
+	}
+	return render(*output, workspaces, func(w io.Writer) {
+		fmt.Fprintln(w, "ID\tNAME\tTYPE\tDEFAULT")
+		for _, ws := range workspaces {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%t\n", ws.ID, ws.Name, ws.IntegrationType, ws.IsDefault)
+		}
+	})
+}
+
+func runSync(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("sync", flag.ContinueOnError)
+	output := outputFlag(fs)
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return errors.New("usage: updoc sync <workspace-id>")
+	}
+
+	c, err := newClient()
+	if err != nil {
+		return err
+	}
+
+	result, err := c.SyncWorkspace(ctx, positional[0])
+	if err != nil {
+		return err
+	}
+	return render(*output, result, func(w io.Writer) {
+		fmt.Fprintln(w, "WORKSPACE\tTOTAL\tCREATED\tUPDATED")
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\n", result.WorkspaceID, result.Total, result.Created, result.Updated)
+	})
+}
+
+func runTree(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("tree", flag.ContinueOnError)
+	flagged := fs.Bool("flagged", false, "only show sections with open flags")
+	output := outputFlag(fs)
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return errors.New("usage: updoc tree <workspace-id>")
+	}
+
+	c, err := newClient()
+	if err != nil {
+		return err
+	}
+
+	tree, err := c.GetDocumentTree(ctx, positional[0])
+	if err != nil {
+		return err
+	}
+	return render(*output, tree, func(w io.Writer) {
+		fmt.Fprintln(w, "PAGE\tOPEN\tSUBTREE\tDOCUMENT")
+		var walk func(nodes []*client.DocumentTreeNode, depth int)
+		walk = func(nodes []*client.DocumentTreeNode, depth int) {
+			for _, n := range nodes {
+				if *flagged && n.SubtreeOpenFlags == 0 {
+					continue
+				}
+				fmt.Fprintf(w, "%s%s\t%d\t%d\t%s\n", strings.Repeat("  ", depth), n.Document.Title, n.OpenFlags, n.SubtreeOpenFlags, n.Document.ID)
+				walk(n.Children, depth+1)
+			}
+		}
+		walk(tree.Roots, 0)
+		fmt.Fprintf(w, "\n%d document(s), %d open flag(s)\n", tree.Documents, tree.OpenFlags)
+	})
+}
+
+func runCodeChanges(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("code-changes", flag.ContinueOnError)
+	from := fs.String("from", "", "commit the range starts after; only --to itself when empty")
+	to := fs.String("to", "HEAD", "commit the range ends at")
+	priority := fs.String("priority", "medium", "priority of flags opened: urgent, high, medium or low")
+	output := outputFlag(fs)
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return errors.New("usage: updoc code-changes <git-workspace-id|repository> [--from sha] [--to sha] [--priority medium]")
+	}
+
+	c, err := newClient()
+	if err != nil {
+		return err
+	}
+
+	result, err := c.ReportCodeChange(ctx, client.CodeChangeRequest{
+		Repository: positional[0],
+		From:       *from,
+		To:         *to,
+		Priority:   *priority,
+	})
+	if err != nil {
+		return err
+	}
+	return render(*output, result, func(w io.Writer) {
+		fmt.Fprintln(w, "DOCUMENT\tFLAG\tOPENED\tCOMMITS")
+		for _, d := range result.Documents {
+			fmt.Fprintf(w, "%s\t%s\t%t\t%d\n", truncate(d.Document.Title, 50), d.Flag.ID, d.Opened, len(d.Commits))
+		}
+		fmt.Fprintf(w, "\n%d commit(s), %d flag(s) opened, %d updated\n", result.Commits, result.FlagsOpened, result.FlagsUpdated)
+	})
+}
+
+func runImpact(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("impact", flag.ContinueOnError)
+	repo := fs.String("repo", "", "git workspace ID or repository URL the pull request is against")
+	pr := fs.String("pr", "", "pull request reference, such as acme/app#42")
+	create := fs.Bool("flag", false, "open a flag tagged with --pr on each affected document")
+	priority := fs.String("priority", "medium", "priority of flags opened: urgent, high, medium or low")
+	output := outputFlag(fs)
+	files, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	// CI can pipe in `git diff --name-only` instead of listing the files
+	if len(files) == 0 {
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			if line := strings.TrimSpace(scanner.Text()); line != "" {
+				files = append(files, line)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return err
+		}
+	}
+	if len(files) == 0 || *repo == "" {
+		return errors.New("usage: updoc impact --repo <git-workspace-id|repository> [--pr ref] [--flag] <file>... (or changed files on stdin)")
+	}
+
+	c, err := newClient()
+	if err != nil {
+		return err
+	}
+
+	result, err := c.CheckImpact(ctx, client.ImpactRequest{
+		Repository:  *repo,
+		Files:       files,
+		PullRequest: *pr,
+		CreateFlags: *create,
+		Priority:    *priority,
+	})
+	if err != nil {
+		return err
+	}
+	return render(*output, result, func(w io.Writer) {
+		fmt.Fprintln(w, "DOCUMENT\tOWNER\tOPEN FLAGS\tFILES\tURL")
+		for _, d := range result.Documents {
+			owner := "-"
+			if d.Owner != nil {
+				owner = d.Owner.Email
+			}
+			fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%s\n", truncate(d.Document.Title, 50), owner, len(d.OpenFlags), len(d.Files), d.Document.URL)
+		}
+		fmt.Fprintf(w, "\n%d document(s) affected by %d file(s), %d flag(s) opened\n", len(result.Documents), result.Files, result.FlagsOpened)
+	})
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/shaunpua/updoc/pkg/client"
+)
+
+// config is persisted as JSON in the user's config directory. UPDOC_SERVER and
+// UPDOC_TOKEN override the file, which is handy in CI.
+type config struct {
+	Server string `json:"server"`
+	Token  string `json:"token"`
+	Email  string `json:"email,omitempty"`
+}
+
+func configPath() (string, error) {
+	if path := os.Getenv("UPDOC_CONFIG"); path != "" {
+		return path, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "updoc", "config.json"), nil
+}
+
+func loadConfig() (*config, error) {
+	cfg := &config{}
+
+	path, err := configPath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(data, cfg); err != nil {
+			return nil, fmt.Errorf("parse %s: %w", path, err)
+		}
+	case !errors.Is(err, os.ErrNotExist):
+		return nil, err
+	}
+
+	if server := os.Getenv("UPDOC_SERVER"); server != "" {
+		cfg.Server = server
+	}
+	if token := os.Getenv("UPDOC_TOKEN"); token != "" {
+		cfg.Token = token
+	}
+	return cfg, nil
+}
+
+// saveConfig writes the config readable only by the current user, since it holds the API token
+func saveConfig(cfg *config) (string, error) {
+	path, err := configPath()
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return "", err
+	}
+
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return path, os.WriteFile(path, append(data, '\n'), 0o600)
+}
+
+// newClient builds an API client from the saved config
+func newClient() (*client.Client, error) {
+	cfg, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Server == "" || cfg.Token == "" {
+		return nil, errors.New("not logged in; run 'updoc login' first")
+	}
+	return client.New(cfg.Server, client.WithToken(cfg.Token), client.WithUserAgent("updoc-cli")), nil
+}
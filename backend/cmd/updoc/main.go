@@ -0,0 +1,81 @@
+// Command updoc flags and triages documentation from the terminal.
+//
+//	updoc login --server http://localhost:9000 --token updoc_...
+//	updoc flag https://acme.atlassian.net/wiki/spaces/ENG/pages/123/API --priority high --assign alice@acme.com
+//	updoc mine
+//	updoc resolve <flag-id> --note "Updated the examples"
+//	updoc diff <flag-id>
+//	updoc notifications
+//	updoc confirm <flag-id>
+//	updoc sync <workspace-id>
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+)
+
+type command struct {
+	name    string
+	summary string
+	run     func(ctx context.Context, args []string) error
+}
+
+var commands = []command{
+	{"login", "Save the server URL and API token to the config file", runLogin},
+	{"flag", "Flag a document URL as outdated", runFlag},
+	{"mine", "List flags assigned to (or created by) you", runMine},
+	{"resolve", "Resolve a flag with a note", runResolve},
+	{"diff", "Show what changed in a flagged page since it was flagged", runDiff},
+	{"notifications", "List your unread notifications", runNotifications},
+	{"confirm", "Confirm a page edit fixes a flag awaiting verification", runConfirm},
+	{"reopen", "Reopen a flag awaiting verification or resolved", runReopen},
+	{"workspaces", "List workspaces in your organization", runWorkspaces},
+	{"sync", "Import a workspace's pages from Confluence, Notion or git", runSync},
+	{"tree", "Show a workspace's page tree with open flags", runTree},
+	{"code-changes", "Flag documents linked to code changed in a commit range", runCodeChanges},
+	{"impact", "List documents a pull request's changed files may affect", runImpact},
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if len(os.Args) < 2 || os.Args[1] == "help" || os.Args[1] == "-h" || os.Args[1] == "--help" {
+		usage()
+		os.Exit(2)
+	}
+
+	for _, cmd := range commands {
+		if cmd.name != os.Args[1] {
+			continue
+		}
+		if err := cmd.run(ctx, os.Args[2:]); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				os.Exit(2)
+			}
+			fmt.Fprintf(os.Stderr, "updoc %s: %v\n", cmd.name, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	fmt.Fprintf(os.Stderr, "updoc: unknown command %q\n\n", os.Args[1])
+	usage()
+	os.Exit(2)
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: updoc <command> [arguments]")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-14s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Run 'updoc <command> -h' for command flags.")
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/shaunpua/updoc/pkg/client"
+)
+
+// outputFlag registers -o/--output on fs and returns the selected format
+func outputFlag(fs *flag.FlagSet) *string {
+	format := fs.String("output", "table", "output format: table or json")
+	fs.StringVar(format, "o", "table", "shorthand for --output")
+	return format
+}
+
+func render(format string, v interface{}, table func(w io.Writer)) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	case "table":
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		table(w)
+		return w.Flush()
+	default:
+		return fmt.Errorf("unknown output format %q (want table or json)", format)
+	}
+}
+
+func flagTable(flags []*client.Flag) func(w io.Writer) {
+	return func(w io.Writer) {
+		fmt.Fprintln(w, "ID\tPRIORITY\tSTATUS\tTITLE\tDOCUMENT\tASSIGNEE")
+		for _, f := range flags {
+			document := f.DocumentID
+			if f.Document != nil {
+				document = f.Document.Title
+			}
+			assignee := "-"
+			if f.Assignee != nil {
+				assignee = f.Assignee.Email
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+				f.ID, f.Priority, f.Status, truncate(f.Title, 40), truncate(document, 40), assignee)
+		}
+	}
+}
+
+func truncate(s string, n int) string {
+	r := []rune(strings.TrimSpace(s))
+	if len(r) <= n {
+		return string(r)
+	}
+	return string(r[:n-1]) + "…"
+}
@@ -0,0 +1,530 @@
+// Package config loads the server configuration. Sources are layered, later
+// ones winning: built-in defaults, a YAML file, environment variables, then
+// command-line flags.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/shaunpua/updoc/internal/secret"
+	"gopkg.in/yaml.v3"
+)
+
+type Config struct {
+	Server     ServerConfig     `yaml:"server"`
+	Database   DatabaseConfig   `yaml:"database"`
+	Confluence ConfluenceConfig `yaml:"confluence"`
+	Notion     NotionConfig     `yaml:"notion"`
+	Git        GitConfig        `yaml:"git"`
+	Security   SecurityConfig   `yaml:"security"`
+	Log        LogConfig        `yaml:"log"`
+	Tracing    TracingConfig    `yaml:"tracing"`
+	Health     HealthConfig     `yaml:"health"`
+}
+
+type ServerConfig struct {
+	Port            int           `yaml:"port"`
+	ReadTimeout     time.Duration `yaml:"read_timeout"`
+	WriteTimeout    time.Duration `yaml:"write_timeout"`
+	IdleTimeout     time.Duration `yaml:"idle_timeout"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+}
+
+type DatabaseConfig struct {
+	// URL, when set, is used verbatim instead of the individual fields
+	URL      string `yaml:"url"`
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"`
+	User     string `yaml:"user"`
+	Password string `yaml:"password"`
+	Name     string `yaml:"name"`
+	SSLMode  string `yaml:"sslmode"`
+
+	MaxOpenConns    int           `yaml:"max_open_conns"`
+	MaxIdleConns    int           `yaml:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime"`
+	ConnMaxIdleTime time.Duration `yaml:"conn_max_idle_time"`
+
+	// SlowQueryThreshold logs queries slower than this as warnings (0 disables)
+	SlowQueryThreshold time.Duration `yaml:"slow_query_threshold"`
+}
+
+type ConfluenceConfig struct {
+	// Timeout bounds each request to the Confluence REST API, including reading the body
+	Timeout time.Duration `yaml:"timeout"`
+	// ConnectTimeout bounds the TCP connect and TLS handshake
+	ConnectTimeout time.Duration `yaml:"connect_timeout"`
+	// ReadTimeout bounds the wait for response headers once the request is sent
+	ReadTimeout time.Duration `yaml:"read_timeout"`
+	// MaxIdleConnsPerHost is how many idle connections are kept per Atlassian site
+	MaxIdleConnsPerHost int `yaml:"max_idle_conns_per_host"`
+
+	// MaxRetries is how many times a call that got a 429, a 5xx or a
+	// transport error is retried; 0 disables retries
+	MaxRetries int `yaml:"max_retries"`
+	// RetryBaseDelay is the first backoff; each retry doubles it, with jitter
+	RetryBaseDelay time.Duration `yaml:"retry_base_delay"`
+	// RetryMaxDelay caps each backoff. A Retry-After longer than this is not
+	// waited out; the call fails instead.
+	RetryMaxDelay time.Duration `yaml:"retry_max_delay"`
+
+	// RateLimit is the sustained requests per second allowed per organization
+	RateLimit float64 `yaml:"rate_limit"`
+	// RateBurst is how many requests an organization may make at once
+	RateBurst int `yaml:"rate_burst"`
+
+	// BreakerThreshold is how many consecutive failed calls open an
+	// organization's circuit breaker, marking its integration degraded
+	BreakerThreshold int `yaml:"breaker_threshold"`
+	// BreakerCooldown is how long the breaker stays open before a trial call
+	BreakerCooldown time.Duration `yaml:"breaker_cooldown"`
+
+	// PageWatchInterval is how often the pages behind open flags are checked
+	// for edits, which put the flags up for verification (0 disables)
+	PageWatchInterval time.Duration `yaml:"page_watch_interval"`
+
+	// OAuth is the Atlassian OAuth 2.0 (3LO) app organizations can connect
+	// through instead of pasting an API token
+	OAuth AtlassianOAuthConfig `yaml:"oauth"`
+}
+
+// AtlassianOAuthConfig is an OAuth 2.0 integration registered in the
+// Atlassian developer console. It is disabled while ClientID is empty.
+type AtlassianOAuthConfig struct {
+	ClientID     string `yaml:"client_id"`
+	ClientSecret string `yaml:"client_secret"`
+	// RedirectURL is UpDoc's callback as registered with the app, e.g.
+	// https://updoc.example.com/api/v1/confluence/oauth/callback
+	RedirectURL string   `yaml:"redirect_url"`
+	Scopes      []string `yaml:"scopes"`
+	// AuthURL serves /authorize and /oauth/token
+	AuthURL string `yaml:"auth_url"`
+	// APIURL serves the accessible-resources list and the API gateway that
+	// calls are made through, /ex/confluence/{cloudid}
+	APIURL string `yaml:"api_url"`
+	// RefreshBefore is how long before an access token expires it is refreshed
+	RefreshBefore time.Duration `yaml:"refresh_before"`
+	// StateTTL is how long an admin has to approve access after starting
+	StateTTL time.Duration `yaml:"state_ttl"`
+}
+
+// Enabled reports whether an OAuth app is configured
+func (o AtlassianOAuthConfig) Enabled() bool { return o.ClientID != "" }
+
+// NotionConfig is how UpDoc reaches the Notion API for notion workspaces.
+// Each workspace brings its own integration token.
+type NotionConfig struct {
+	// BaseURL is the API root, https://api.notion.com; point it at
+	// cmd/fakenotion to run without a Notion account
+	BaseURL string `yaml:"base_url"`
+	// Version is sent as the Notion-Version header
+	Version string `yaml:"version"`
+	// Timeout bounds each request, including reading the body
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// GitConfig is how UpDoc reads the repositories of git workspaces, with the
+// git command-line tool. Remote repositories are cloned into CacheDir; local
+// ones are read in place.
+type GitConfig struct {
+	// Binary is the git executable, looked up in PATH unless absolute
+	Binary string `yaml:"binary"`
+	// CacheDir holds bare clones of remote repositories
+	CacheDir string `yaml:"cache_dir"`
+	// LocalRoots are the directories workspaces may open repositories from
+	// by path; empty allows only remote repositories
+	LocalRoots []string `yaml:"local_roots"`
+	// RemoteSchemes are the URL schemes remote repositories may use, out of
+	// https, http and ssh (which includes git@host:path)
+	RemoteSchemes []string `yaml:"remote_schemes"`
+	// AllowedRemotes are the hosts, such as github.com, or URL prefixes,
+	// such as https://github.com/acme/, remote repositories may be cloned
+	// from; empty allows no remote repositories
+	AllowedRemotes []string `yaml:"allowed_remotes"`
+	// Timeout bounds each git command that reads a repository
+	Timeout time.Duration `yaml:"timeout"`
+	// CloneTimeout bounds cloning and fetching remote repositories
+	CloneTimeout time.Duration `yaml:"clone_timeout"`
+	// FetchInterval is how long a remote clone is used before it is fetched
+	// again (0 fetches every time it's read)
+	FetchInterval time.Duration `yaml:"fetch_interval"`
+}
+
+type LogConfig struct {
+	// Format is json or text
+	Format string `yaml:"format"`
+	// Level is debug, info, warn or error
+	Level string `yaml:"level"`
+}
+
+type TracingConfig struct {
+	// Endpoint is the OTLP/HTTP collector base URL, e.g. http://localhost:4318;
+	// spans are exported to its /v1/traces path. Empty disables export.
+	Endpoint string `yaml:"endpoint"`
+	// ServiceName is reported as the service.name resource attribute
+	ServiceName string `yaml:"service_name"`
+	// SampleRatio is the fraction of new traces recorded, from 0 to 1. Traces
+	// started upstream follow the caller's sampling decision.
+	SampleRatio float64 `yaml:"sample_ratio"`
+}
+
+type HealthConfig struct {
+	// CheckTimeout bounds each readiness check
+	CheckTimeout time.Duration `yaml:"check_timeout"`
+	// DrainDelay is how long /readyz reports draining before shutdown begins,
+	// giving load balancers time to stop routing new requests
+	DrainDelay time.Duration `yaml:"drain_delay"`
+	// ConfluenceProbeInterval is how often each organization's Confluence
+	// connection is tested for the readiness report (0 disables)
+	ConfluenceProbeInterval time.Duration `yaml:"confluence_probe_interval"`
+}
+
+type SecurityConfig struct {
+	// EncryptionKey is a base64 32-byte key used to encrypt stored credentials
+	EncryptionKey string `yaml:"encryption_key"`
+	// PreviousEncryptionKeys are still accepted for decryption during key rotation
+	PreviousEncryptionKeys []string `yaml:"previous_encryption_keys"`
+}
+
+// Default returns the configuration used when nothing else is set. The
+// database defaults match docker-compose.yaml.
+func Default() Config {
+	return Config{
+		Server: ServerConfig{
+			Port:            9000,
+			ReadTimeout:     15 * time.Second,
+			WriteTimeout:    60 * time.Second,
+			IdleTimeout:     120 * time.Second,
+			ShutdownTimeout: 10 * time.Second,
+		},
+		Database: DatabaseConfig{
+			Host: "localhost",
+			// 5433 because docker-compose maps 5433->5432
+			Port:            5433,
+			User:            "updoc",
+			Password:        "updoc",
+			Name:            "updoc",
+			SSLMode:         "disable",
+			MaxOpenConns:    25,
+			MaxIdleConns:    5,
+			ConnMaxLifetime: 30 * time.Minute,
+			ConnMaxIdleTime: 5 * time.Minute,
+
+			SlowQueryThreshold: 200 * time.Millisecond,
+		},
+		Confluence: ConfluenceConfig{
+			Timeout:             30 * time.Second,
+			ConnectTimeout:      5 * time.Second,
+			ReadTimeout:         20 * time.Second,
+			MaxIdleConnsPerHost: 10,
+
+			MaxRetries:     3,
+			RetryBaseDelay: 500 * time.Millisecond,
+			RetryMaxDelay:  30 * time.Second,
+
+			RateLimit: 10,
+			RateBurst: 20,
+
+			BreakerThreshold: 5,
+			BreakerCooldown:  30 * time.Second,
+
+			PageWatchInterval: 10 * time.Minute,
+
+			OAuth: AtlassianOAuthConfig{
+				Scopes: []string{
+					"read:confluence-content.all",
+					"read:confluence-content.summary",
+					"read:confluence-space.summary",
+					"read:confluence-user",
+					"search:confluence",
+					"offline_access",
+				},
+				AuthURL:       "https://auth.atlassian.com",
+				APIURL:        "https://api.atlassian.com",
+				RefreshBefore: 5 * time.Minute,
+				StateTTL:      10 * time.Minute,
+			},
+		},
+		Notion: NotionConfig{
+			BaseURL: "https://api.notion.com",
+			Version: "2022-06-28",
+			Timeout: 30 * time.Second,
+		},
+		Git: GitConfig{
+			Binary:        "git",
+			CacheDir:      filepath.Join(os.TempDir(), "updoc-git"),
+			RemoteSchemes: []string{"https"},
+			Timeout:       30 * time.Second,
+			CloneTimeout:  5 * time.Minute,
+			FetchInterval: time.Minute,
+		},
+		Log: LogConfig{
+			Format: "text",
+			Level:  "info",
+		},
+		Tracing: TracingConfig{
+			ServiceName: "updoc-server",
+			SampleRatio: 1,
+		},
+		Health: HealthConfig{
+			CheckTimeout:            2 * time.Second,
+			DrainDelay:              5 * time.Second,
+			ConfluenceProbeInterval: 5 * time.Minute,
+		},
+	}
+}
+
+// LoadFile merges the YAML file at path over cfg. Keys missing from the file
+// keep their current values; unknown keys are an error so typos don't go unnoticed.
+func LoadFile(cfg *Config, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("config file: %w", err)
+	}
+	defer f.Close()
+
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+	if err := dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// DSN returns the Postgres connection string
+func (d DatabaseConfig) DSN() string {
+	if d.URL != "" {
+		return d.URL
+	}
+	return fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%d sslmode=%s",
+		d.Host, d.User, d.Password, d.Name, d.Port, d.SSLMode)
+}
+
+// Validate reports every invalid setting at once so a bad deploy fails fast
+func (c Config) Validate() error {
+	var problems []string
+	add := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if c.Server.Port < 1 || c.Server.Port > 65535 {
+		add("server.port must be between 1 and 65535, got %d", c.Server.Port)
+	}
+	for _, d := range []struct {
+		name  string
+		value time.Duration
+	}{
+		{"server.read_timeout", c.Server.ReadTimeout},
+		{"server.write_timeout", c.Server.WriteTimeout},
+		{"server.idle_timeout", c.Server.IdleTimeout},
+		{"server.shutdown_timeout", c.Server.ShutdownTimeout},
+		{"confluence.timeout", c.Confluence.Timeout},
+		{"confluence.connect_timeout", c.Confluence.ConnectTimeout},
+		{"confluence.read_timeout", c.Confluence.ReadTimeout},
+		{"confluence.retry_base_delay", c.Confluence.RetryBaseDelay},
+		{"confluence.retry_max_delay", c.Confluence.RetryMaxDelay},
+		{"confluence.breaker_cooldown", c.Confluence.BreakerCooldown},
+		{"notion.timeout", c.Notion.Timeout},
+		{"git.timeout", c.Git.Timeout},
+		{"git.clone_timeout", c.Git.CloneTimeout},
+		{"health.check_timeout", c.Health.CheckTimeout},
+	} {
+		if d.value <= 0 {
+			add("%s must be positive, got %s", d.name, d.value)
+		}
+	}
+
+	if c.Database.URL == "" {
+		if c.Database.Host == "" || c.Database.Name == "" || c.Database.User == "" {
+			add("database.host, database.name and database.user are required when database.url is not set")
+		}
+		if c.Database.Port < 1 || c.Database.Port > 65535 {
+			add("database.port must be between 1 and 65535, got %d", c.Database.Port)
+		}
+	} else if _, err := url.Parse(c.Database.URL); err != nil {
+		add("database.url is invalid: %v", err)
+	}
+	if c.Database.MaxOpenConns < 0 || c.Database.MaxIdleConns < 0 {
+		add("database pool sizes must not be negative")
+	}
+	if c.Database.MaxOpenConns > 0 && c.Database.MaxIdleConns > c.Database.MaxOpenConns {
+		add("database.max_idle_conns (%d) must not exceed database.max_open_conns (%d)",
+			c.Database.MaxIdleConns, c.Database.MaxOpenConns)
+	}
+
+	if c.Confluence.MaxIdleConnsPerHost < 1 {
+		add("confluence.max_idle_conns_per_host must be at least 1, got %d", c.Confluence.MaxIdleConnsPerHost)
+	}
+	if c.Confluence.MaxRetries < 0 {
+		add("confluence.max_retries must not be negative, got %d", c.Confluence.MaxRetries)
+	}
+	if c.Confluence.RetryMaxDelay < c.Confluence.RetryBaseDelay {
+		add("confluence.retry_max_delay (%s) must not be less than confluence.retry_base_delay (%s)",
+			c.Confluence.RetryMaxDelay, c.Confluence.RetryBaseDelay)
+	}
+	if c.Confluence.RateLimit <= 0 || c.Confluence.RateBurst < 1 {
+		add("confluence.rate_limit must be positive and confluence.rate_burst at least 1")
+	}
+	if c.Confluence.BreakerThreshold < 1 {
+		add("confluence.breaker_threshold must be at least 1, got %d", c.Confluence.BreakerThreshold)
+	}
+	if c.Confluence.PageWatchInterval < 0 {
+		add("confluence.page_watch_interval must not be negative")
+	}
+	if oauth := c.Confluence.OAuth; oauth.Enabled() {
+		if oauth.ClientSecret == "" || oauth.RedirectURL == "" {
+			add("confluence.oauth.client_secret and confluence.oauth.redirect_url are required when confluence.oauth.client_id is set")
+		}
+		for _, u := range []struct{ name, value string }{
+			{"confluence.oauth.redirect_url", oauth.RedirectURL},
+			{"confluence.oauth.auth_url", oauth.AuthURL},
+			{"confluence.oauth.api_url", oauth.APIURL},
+		} {
+			if parsed, err := url.Parse(u.value); u.value != "" && (err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "") {
+				add("%s must be an http(s) URL, got %q", u.name, u.value)
+			}
+		}
+		if oauth.RefreshBefore < 0 || oauth.StateTTL <= 0 {
+			add("confluence.oauth.refresh_before must not be negative and confluence.oauth.state_ttl must be positive")
+		}
+	}
+	if u, err := url.Parse(c.Notion.BaseURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		add("notion.base_url must be an http(s) URL, got %q", c.Notion.BaseURL)
+	}
+	if c.Notion.Version == "" {
+		add("notion.version is required")
+	}
+	if c.Git.Binary == "" || c.Git.CacheDir == "" {
+		add("git.binary and git.cache_dir are required")
+	}
+	for _, root := range c.Git.LocalRoots {
+		if !filepath.IsAbs(root) {
+			add("git.local_roots must be absolute paths, got %q", root)
+		}
+	}
+	if c.Git.FetchInterval < 0 {
+		add("git.fetch_interval must not be negative")
+	}
+	for _, scheme := range c.Git.RemoteSchemes {
+		if scheme != "https" && scheme != "http" && scheme != "ssh" {
+			add("git.remote_schemes must be https, http or ssh, got %q", scheme)
+		}
+	}
+	for _, remote := range c.Git.AllowedRemotes {
+		if strings.TrimSpace(remote) == "" || strings.ContainsAny(remote, " \t") {
+			add("git.allowed_remotes must be hosts or URL prefixes, got %q", remote)
+		}
+	}
+
+	if c.Database.SlowQueryThreshold < 0 {
+		add("database.slow_query_threshold must not be negative")
+	}
+	if c.Health.DrainDelay < 0 || c.Health.ConfluenceProbeInterval < 0 {
+		add("health.drain_delay and health.confluence_probe_interval must not be negative")
+	}
+
+	if c.Log.Format != "json" && c.Log.Format != "text" {
+		add("log.format must be json or text, got %q", c.Log.Format)
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.Log.Level)); err != nil {
+		add("log.level must be debug, info, warn or error, got %q", c.Log.Level)
+	}
+
+	if c.Tracing.Endpoint != "" {
+		if u, err := url.Parse(c.Tracing.Endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			add("tracing.endpoint must be an http(s) URL like http://localhost:4318, got %q", c.Tracing.Endpoint)
+		}
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		add("tracing.sample_ratio must be between 0 and 1, got %g", c.Tracing.SampleRatio)
+	}
+	if c.Tracing.ServiceName == "" {
+		add("tracing.service_name must not be empty")
+	}
+
+	if c.Security.EncryptionKey == "" {
+		add("security.encryption_key (UPDOC_ENCRYPTION_KEY) is required; generate one with 'openssl rand -base64 32'")
+	} else if err := secret.ValidateKey(c.Security.EncryptionKey); err != nil {
+		add("security.encryption_key: %v", err)
+	}
+	for i, key := range c.Security.PreviousEncryptionKeys {
+		if err := secret.ValidateKey(key); err != nil {
+			add("security.previous_encryption_keys[%d]: %v", i, err)
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid configuration:\n  - %s", strings.Join(problems, "\n  - "))
+	}
+	return nil
+}
+
+// Redacted returns a copy with passwords and keys masked, safe to print or log
+func (c Config) Redacted() Config {
+	const mask = "********"
+
+	r := c
+	if r.Database.Password != "" {
+		r.Database.Password = mask
+	}
+	if r.Database.URL != "" {
+		r.Database.URL = RedactDSN(r.Database.URL)
+	}
+	if r.Confluence.OAuth.ClientSecret != "" {
+		r.Confluence.OAuth.ClientSecret = mask
+	}
+	if r.Security.EncryptionKey != "" {
+		r.Security.EncryptionKey = mask
+	}
+	if len(r.Security.PreviousEncryptionKeys) > 0 {
+		r.Security.PreviousEncryptionKeys = make([]string, len(c.Security.PreviousEncryptionKeys))
+		for i := range r.Security.PreviousEncryptionKeys {
+			r.Security.PreviousEncryptionKeys[i] = mask
+		}
+	}
+	return r
+}
+
+// WriteYAML writes the redacted configuration as YAML
+func (c Config) WriteYAML(w io.Writer) error {
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(c.Redacted()); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// dsnPassword matches a password in a key=value DSN, quoted or not
+var dsnPassword = regexp.MustCompile(`(?i)\b((?:ssl)?password)\s*=\s*('(?:[^'\\]|\\.)*'|\S+)`)
+
+// RedactDSN masks the password in a postgres:// URL, including one passed
+// as a query parameter, or in a key=value DSN
+func RedactDSN(dsn string) string {
+	if u, err := url.Parse(dsn); err == nil && u.Scheme != "" {
+		if u.User != nil {
+			if _, ok := u.User.Password(); ok {
+				u.User = url.UserPassword(u.User.Username(), "xxxxx")
+			}
+		}
+		query := u.Query()
+		for key := range query {
+			if strings.EqualFold(key, "password") || strings.EqualFold(key, "sslpassword") {
+				query.Set(key, "xxxxx")
+				u.RawQuery = query.Encode()
+			}
+		}
+		return u.String()
+	}
+	return dsnPassword.ReplaceAllString(dsn, "$1=xxxxx")
+}
@@ -0,0 +1,155 @@
+package config
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testKey = "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY=" // 32 bytes
+
+func validConfig() Config {
+	cfg := Default()
+	cfg.Security.EncryptionKey = testKey
+	return cfg
+}
+
+func TestValidate(t *testing.T) {
+	if err := validConfig().Validate(); err != nil {
+		t.Fatalf("default config with a key: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(*Config)
+		want   string
+	}{
+		{"port", func(c *Config) { c.Server.Port = 70000 }, "server.port"},
+		{"zero timeout", func(c *Config) { c.Server.WriteTimeout = 0 }, "server.write_timeout must be positive"},
+		{"negative timeout", func(c *Config) { c.Confluence.ConnectTimeout = -time.Second }, "confluence.connect_timeout must be positive"},
+		{"git timeout", func(c *Config) { c.Git.CloneTimeout = 0 }, "git.clone_timeout must be positive"},
+		{"database fields", func(c *Config) { c.Database.Host = "" }, "database.host, database.name and database.user are required"},
+		{"database port", func(c *Config) { c.Database.Port = 0 }, "database.port"},
+		{"database URL", func(c *Config) { c.Database.URL = "postgres://db:bad port/updoc" }, "database.url is invalid"},
+		{"negative pool", func(c *Config) { c.Database.MaxIdleConns = -1 }, "database pool sizes must not be negative"},
+		{"idle above open", func(c *Config) { c.Database.MaxIdleConns = 30 }, "database.max_idle_conns (30) must not exceed"},
+		{"slow query threshold", func(c *Config) { c.Database.SlowQueryThreshold = -1 }, "database.slow_query_threshold"},
+		{"idle conns per host", func(c *Config) { c.Confluence.MaxIdleConnsPerHost = 0 }, "confluence.max_idle_conns_per_host"},
+		{"retries", func(c *Config) { c.Confluence.MaxRetries = -1 }, "confluence.max_retries"},
+		{"retry delays", func(c *Config) { c.Confluence.RetryMaxDelay = 100 * time.Millisecond }, "confluence.retry_max_delay (100ms) must not be less than"},
+		{"rate limit", func(c *Config) { c.Confluence.RateLimit = 0 }, "confluence.rate_limit"},
+		{"rate burst", func(c *Config) { c.Confluence.RateBurst = 0 }, "confluence.rate_burst"},
+		{"breaker", func(c *Config) { c.Confluence.BreakerThreshold = 0 }, "confluence.breaker_threshold"},
+		{"page watch", func(c *Config) { c.Confluence.PageWatchInterval = -1 }, "confluence.page_watch_interval"},
+		{"oauth secret", func(c *Config) { c.Confluence.OAuth.ClientID = "app" }, "confluence.oauth.client_secret and confluence.oauth.redirect_url are required"},
+		{"oauth redirect URL", func(c *Config) {
+			c.Confluence.OAuth = AtlassianOAuthConfig{ClientID: "app", ClientSecret: "s", RedirectURL: "updoc.example.com/cb", AuthURL: "https://auth.example.com", APIURL: "https://api.example.com", StateTTL: time.Minute}
+		}, "confluence.oauth.redirect_url must be an http(s) URL"},
+		{"oauth API URL", func(c *Config) {
+			c.Confluence.OAuth = AtlassianOAuthConfig{ClientID: "app", ClientSecret: "s", RedirectURL: "https://updoc.example.com/cb", AuthURL: "https://auth.example.com", APIURL: "ftp://api.example.com", StateTTL: time.Minute}
+		}, "confluence.oauth.api_url must be an http(s) URL"},
+		{"oauth state TTL", func(c *Config) {
+			c.Confluence.OAuth = AtlassianOAuthConfig{ClientID: "app", ClientSecret: "s", RedirectURL: "https://updoc.example.com/cb", AuthURL: "https://auth.example.com", APIURL: "https://api.example.com"}
+		}, "confluence.oauth.state_ttl must be positive"},
+		{"notion URL", func(c *Config) { c.Notion.BaseURL = "api.notion.com" }, "notion.base_url"},
+		{"notion version", func(c *Config) { c.Notion.Version = "" }, "notion.version is required"},
+		{"git binary", func(c *Config) { c.Git.Binary = "" }, "git.binary and git.cache_dir are required"},
+		{"git local root", func(c *Config) { c.Git.LocalRoots = []string{"repos"} }, `git.local_roots must be absolute paths, got "repos"`},
+		{"git fetch interval", func(c *Config) { c.Git.FetchInterval = -1 }, "git.fetch_interval"},
+		{"git scheme", func(c *Config) { c.Git.RemoteSchemes = []string{"file"} }, `git.remote_schemes must be https, http or ssh, got "file"`},
+		{"git remote", func(c *Config) { c.Git.AllowedRemotes = []string{"github.com acme"} }, "git.allowed_remotes"},
+		{"drain delay", func(c *Config) { c.Health.DrainDelay = -1 }, "health.drain_delay"},
+		{"log format", func(c *Config) { c.Log.Format = "xml" }, `log.format must be json or text, got "xml"`},
+		{"log level", func(c *Config) { c.Log.Level = "verbose" }, `log.level must be debug, info, warn or error, got "verbose"`},
+		{"tracing endpoint", func(c *Config) { c.Tracing.Endpoint = "localhost:4318" }, "tracing.endpoint"},
+		{"sample ratio", func(c *Config) { c.Tracing.SampleRatio = 1.5 }, "tracing.sample_ratio"},
+		{"service name", func(c *Config) { c.Tracing.ServiceName = "" }, "tracing.service_name"},
+		{"missing key", func(c *Config) { c.Security.EncryptionKey = "" }, "security.encryption_key (UPDOC_ENCRYPTION_KEY) is required"},
+		{"short key", func(c *Config) { c.Security.EncryptionKey = "c2hvcnQ=" }, "security.encryption_key:"},
+		{"previous key", func(c *Config) { c.Security.PreviousEncryptionKeys = []string{testKey, "not base64!"} }, "security.previous_encryption_keys[1]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := validConfig()
+			tt.modify(&cfg)
+			err := cfg.Validate()
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Validate = %v, want a problem mentioning %q", err, tt.want)
+			}
+		})
+	}
+
+	// Every problem is reported at once
+	cfg := validConfig()
+	cfg.Server.Port, cfg.Log.Format, cfg.Security.EncryptionKey = 0, "xml", ""
+	if err := cfg.Validate(); err == nil || strings.Count(err.Error(), "\n  - ") != 3 {
+		t.Errorf("Validate = %v, want three problems", err)
+	}
+}
+
+func TestRedacted(t *testing.T) {
+	const (
+		dbPassword   = "db-pa55word"
+		clientSecret = "oauth-client-s3cret"
+		previousKey  = "cHJldmlvdXNrZXlwcmV2aW91c2tleXByZXZpb3Vzaw=="
+	)
+	secrets := []string{dbPassword, clientSecret, testKey, previousKey}
+
+	for _, dbURL := range []string{
+		"",
+		"postgres://updoc:" + dbPassword + "@db:5432/updoc?sslmode=require",
+		"host=db user=updoc password=" + dbPassword + " dbname=updoc",
+		"host=db user=updoc PASSWORD=" + dbPassword,
+		"host=db user=updoc password='" + dbPassword + " with spaces'",
+		"postgres://db/updoc?user=updoc&password=" + dbPassword,
+	} {
+		cfg := validConfig()
+		cfg.Database.URL = dbURL
+		cfg.Database.Password = dbPassword
+		cfg.Confluence.OAuth.ClientSecret = clientSecret
+		cfg.Security.PreviousEncryptionKeys = []string{previousKey}
+
+		var buf bytes.Buffer
+		if err := cfg.WriteYAML(&buf); err != nil {
+			t.Fatal(err)
+		}
+		for _, s := range secrets {
+			if strings.Contains(buf.String(), s) {
+				t.Errorf("WriteYAML with database.url %q shows %q:\n%s", dbURL, s, buf.String())
+			}
+		}
+		if dbURL != "" && !strings.Contains(buf.String(), "updoc") {
+			t.Errorf("WriteYAML hid the whole database.url:\n%s", buf.String())
+		}
+
+		// The original is left alone
+		if cfg.Database.Password != dbPassword || cfg.Security.PreviousEncryptionKeys[0] != previousKey {
+			t.Errorf("Redacted changed the config it was called on: %+v", cfg.Security)
+		}
+	}
+
+	// Nothing set stays empty rather than showing a mask
+	if r := (Config{}).Redacted(); r.Database.Password != "" || r.Security.EncryptionKey != "" || r.Confluence.OAuth.ClientSecret != "" {
+		t.Errorf("Redacted of an empty config = %+v", r)
+	}
+}
+
+func TestRedactDSN(t *testing.T) {
+	tests := []struct {
+		dsn, want string
+	}{
+		{"postgres://updoc:hunter2@db:5432/updoc", "postgres://updoc:xxxxx@db:5432/updoc"},
+		{"postgres://updoc@db/updoc", "postgres://updoc@db/updoc"},
+		{"host=db password=hunter2 user=updoc", "host=db password=xxxxx user=updoc"},
+		{"host=db user=updoc", "host=db user=updoc"},
+		{"host=db password='hunter 2\\' x' user=updoc", "host=db password=xxxxx user=updoc"},
+		{"host=db Password = hunter2 sslpassword=keypass", "host=db Password=xxxxx sslpassword=xxxxx"},
+		{"postgres://db/updoc?user=updoc&password=hunter2", "postgres://db/updoc?password=xxxxx&user=updoc"},
+	}
+	for _, tt := range tests {
+		if got := RedactDSN(tt.dsn); got != tt.want {
+			t.Errorf("RedactDSN(%q) = %q, want %q", tt.dsn, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// setting ties one config field to its environment variable and flag name.
+// Existing variable names (PORT, DATABASE_URL, POSTGRES_*) are kept so
+// deployments configured before this package existed keep working.
+type setting struct {
+	env   string
+	flag  string
+	usage string
+	field func(*Config) interface{} // pointer to the field
+}
+
+var settings = []setting{
+	{"PORT", "port", "HTTP listen port", func(c *Config) interface{} { return &c.Server.Port }},
+	{"UPDOC_HTTP_READ_TIMEOUT", "http-read-timeout", "HTTP server read timeout", func(c *Config) interface{} { return &c.Server.ReadTimeout }},
+	{"UPDOC_HTTP_WRITE_TIMEOUT", "http-write-timeout", "HTTP server write timeout", func(c *Config) interface{} { return &c.Server.WriteTimeout }},
+	{"UPDOC_HTTP_IDLE_TIMEOUT", "http-idle-timeout", "HTTP keep-alive idle timeout", func(c *Config) interface{} { return &c.Server.IdleTimeout }},
+	{"UPDOC_SHUTDOWN_TIMEOUT", "shutdown-timeout", "graceful shutdown timeout", func(c *Config) interface{} { return &c.Server.ShutdownTimeout }},
+
+	{"DATABASE_URL", "database-url", "Postgres URL; overrides the individual database settings", func(c *Config) interface{} { return &c.Database.URL }},
+	{"POSTGRES_HOST", "db-host", "Postgres host", func(c *Config) interface{} { return &c.Database.Host }},
+	{"POSTGRES_PORT", "db-port", "Postgres port", func(c *Config) interface{} { return &c.Database.Port }},
+	{"POSTGRES_USER", "db-user", "Postgres user", func(c *Config) interface{} { return &c.Database.User }},
+	{"POSTGRES_PASSWORD", "db-password", "Postgres password", func(c *Config) interface{} { return &c.Database.Password }},
+	{"POSTGRES_DB", "db-name", "Postgres database name", func(c *Config) interface{} { return &c.Database.Name }},
+	{"POSTGRES_SSLMODE", "db-sslmode", "Postgres sslmode", func(c *Config) interface{} { return &c.Database.SSLMode }},
+	{"UPDOC_DB_MAX_OPEN_CONNS", "db-max-open-conns", "maximum open database connections (0 = unlimited)", func(c *Config) interface{} { return &c.Database.MaxOpenConns }},
+	{"UPDOC_DB_MAX_IDLE_CONNS", "db-max-idle-conns", "maximum idle database connections", func(c *Config) interface{} { return &c.Database.MaxIdleConns }},
+	{"UPDOC_DB_CONN_MAX_LIFETIME", "db-conn-max-lifetime", "maximum lifetime of a database connection", func(c *Config) interface{} { return &c.Database.ConnMaxLifetime }},
+	{"UPDOC_DB_CONN_MAX_IDLE_TIME", "db-conn-max-idle-time", "maximum idle time of a database connection", func(c *Config) interface{} { return &c.Database.ConnMaxIdleTime }},
+
+	{"UPDOC_DB_SLOW_QUERY_THRESHOLD", "db-slow-query-threshold", "log queries slower than this as warnings (0 disables)", func(c *Config) interface{} { return &c.Database.SlowQueryThreshold }},
+
+	{"UPDOC_CONFLUENCE_TIMEOUT", "confluence-timeout", "timeout for each Confluence API request", func(c *Config) interface{} { return &c.Confluence.Timeout }},
+	{"UPDOC_CONFLUENCE_CONNECT_TIMEOUT", "confluence-connect-timeout", "timeout for connecting to Confluence, including TLS", func(c *Config) interface{} { return &c.Confluence.ConnectTimeout }},
+	{"UPDOC_CONFLUENCE_READ_TIMEOUT", "confluence-read-timeout", "timeout waiting for Confluence response headers", func(c *Config) interface{} { return &c.Confluence.ReadTimeout }},
+	{"UPDOC_CONFLUENCE_MAX_IDLE_CONNS_PER_HOST", "confluence-max-idle-conns-per-host", "idle connections kept per Confluence site", func(c *Config) interface{} { return &c.Confluence.MaxIdleConnsPerHost }},
+	{"UPDOC_CONFLUENCE_MAX_RETRIES", "confluence-max-retries", "retries for Confluence calls that hit 429, 5xx or a transport error", func(c *Config) interface{} { return &c.Confluence.MaxRetries }},
+	{"UPDOC_CONFLUENCE_RETRY_BASE_DELAY", "confluence-retry-base-delay", "first Confluence retry backoff, doubled per retry", func(c *Config) interface{} { return &c.Confluence.RetryBaseDelay }},
+	{"UPDOC_CONFLUENCE_RETRY_MAX_DELAY", "confluence-retry-max-delay", "longest Confluence retry backoff or Retry-After to wait", func(c *Config) interface{} { return &c.Confluence.RetryMaxDelay }},
+	{"UPDOC_CONFLUENCE_RATE_LIMIT", "confluence-rate-limit", "Confluence requests per second allowed per organization", func(c *Config) interface{} { return &c.Confluence.RateLimit }},
+	{"UPDOC_CONFLUENCE_RATE_BURST", "confluence-rate-burst", "Confluence request burst allowed per organization", func(c *Config) interface{} { return &c.Confluence.RateBurst }},
+	{"UPDOC_CONFLUENCE_BREAKER_THRESHOLD", "confluence-breaker-threshold", "consecutive failed Confluence calls that mark an integration degraded", func(c *Config) interface{} { return &c.Confluence.BreakerThreshold }},
+	{"UPDOC_CONFLUENCE_BREAKER_COOLDOWN", "confluence-breaker-cooldown", "how long a degraded integration waits before a trial call", func(c *Config) interface{} { return &c.Confluence.BreakerCooldown }},
+	{"UPDOC_CONFLUENCE_PAGE_WATCH_INTERVAL", "confluence-page-watch-interval", "how often to check flagged pages for edits (0 disables)", func(c *Config) interface{} { return &c.Confluence.PageWatchInterval }},
+
+	{"UPDOC_ATLASSIAN_CLIENT_ID", "atlassian-client-id", "Atlassian OAuth app client ID (empty disables OAuth connections)", func(c *Config) interface{} { return &c.Confluence.OAuth.ClientID }},
+	{"UPDOC_ATLASSIAN_CLIENT_SECRET", "atlassian-client-secret", "Atlassian OAuth app client secret", func(c *Config) interface{} { return &c.Confluence.OAuth.ClientSecret }},
+	{"UPDOC_ATLASSIAN_REDIRECT_URL", "atlassian-redirect-url", "OAuth callback URL registered with the Atlassian app", func(c *Config) interface{} { return &c.Confluence.OAuth.RedirectURL }},
+	{"UPDOC_ATLASSIAN_SCOPES", "atlassian-scopes", "comma-separated OAuth scopes to request", func(c *Config) interface{} { return &c.Confluence.OAuth.Scopes }},
+	{"UPDOC_ATLASSIAN_AUTH_URL", "atlassian-auth-url", "Atlassian authorization server URL", func(c *Config) interface{} { return &c.Confluence.OAuth.AuthURL }},
+	{"UPDOC_ATLASSIAN_API_URL", "atlassian-api-url", "Atlassian API gateway URL", func(c *Config) interface{} { return &c.Confluence.OAuth.APIURL }},
+	{"UPDOC_ATLASSIAN_REFRESH_BEFORE", "atlassian-refresh-before", "refresh OAuth access tokens this long before they expire", func(c *Config) interface{} { return &c.Confluence.OAuth.RefreshBefore }},
+
+	{"UPDOC_NOTION_BASE_URL", "notion-base-url", "Notion API base URL", func(c *Config) interface{} { return &c.Notion.BaseURL }},
+	{"UPDOC_NOTION_VERSION", "notion-version", "Notion-Version header sent with every Notion request", func(c *Config) interface{} { return &c.Notion.Version }},
+	{"UPDOC_NOTION_TIMEOUT", "notion-timeout", "timeout for each Notion API request", func(c *Config) interface{} { return &c.Notion.Timeout }},
+
+	{"UPDOC_GIT_BINARY", "git-binary", "git executable used to read git workspaces", func(c *Config) interface{} { return &c.Git.Binary }},
+	{"UPDOC_GIT_CACHE_DIR", "git-cache-dir", "directory holding clones of remote repositories", func(c *Config) interface{} { return &c.Git.CacheDir }},
+	{"UPDOC_GIT_LOCAL_ROOTS", "git-local-roots", "comma-separated directories git workspaces may open repositories from", func(c *Config) interface{} { return &c.Git.LocalRoots }},
+	{"UPDOC_GIT_REMOTE_SCHEMES", "git-remote-schemes", "comma-separated URL schemes remote repositories may use: https, http, ssh", func(c *Config) interface{} { return &c.Git.RemoteSchemes }},
+	{"UPDOC_GIT_ALLOWED_REMOTES", "git-allowed-remotes", "comma-separated hosts or URL prefixes remote repositories may be cloned from", func(c *Config) interface{} { return &c.Git.AllowedRemotes }},
+	{"UPDOC_GIT_TIMEOUT", "git-timeout", "timeout for each git command reading a repository", func(c *Config) interface{} { return &c.Git.Timeout }},
+	{"UPDOC_GIT_CLONE_TIMEOUT", "git-clone-timeout", "timeout for cloning or fetching a remote repository", func(c *Config) interface{} { return &c.Git.CloneTimeout }},
+	{"UPDOC_GIT_FETCH_INTERVAL", "git-fetch-interval", "how long a remote clone is used before fetching it again", func(c *Config) interface{} { return &c.Git.FetchInterval }},
+
+	{"UPDOC_LOG_FORMAT", "log-format", "log output format: json or text", func(c *Config) interface{} { return &c.Log.Format }},
+	{"UPDOC_LOG_LEVEL", "log-level", "minimum log level: debug, info, warn or error", func(c *Config) interface{} { return &c.Log.Level }},
+
+	{"UPDOC_HEALTH_CHECK_TIMEOUT", "health-check-timeout", "timeout for each readiness check", func(c *Config) interface{} { return &c.Health.CheckTimeout }},
+	{"UPDOC_DRAIN_DELAY", "drain-delay", "how long /readyz reports draining before shutdown", func(c *Config) interface{} { return &c.Health.DrainDelay }},
+	{"UPDOC_CONFLUENCE_PROBE_INTERVAL", "confluence-probe-interval", "how often to test Confluence connections for /readyz (0 disables)", func(c *Config) interface{} { return &c.Health.ConfluenceProbeInterval }},
+
+	// Tracing keeps the standard OpenTelemetry variable names where one exists
+	{"OTEL_EXPORTER_OTLP_ENDPOINT", "otlp-endpoint", "OTLP/HTTP collector URL for traces (empty disables tracing)", func(c *Config) interface{} { return &c.Tracing.Endpoint }},
+	{"OTEL_SERVICE_NAME", "service-name", "service name reported on traces", func(c *Config) interface{} { return &c.Tracing.ServiceName }},
+	{"UPDOC_TRACE_SAMPLE_RATIO", "trace-sample-ratio", "fraction of new traces to record, 0 to 1", func(c *Config) interface{} { return &c.Tracing.SampleRatio }},
+
+	{"UPDOC_ENCRYPTION_KEY", "encryption-key", "base64 32-byte key for stored credentials", func(c *Config) interface{} { return &c.Security.EncryptionKey }},
+	{"UPDOC_PREVIOUS_ENCRYPTION_KEYS", "previous-encryption-keys", "comma-separated keys still accepted for decryption", func(c *Config) interface{} { return &c.Security.PreviousEncryptionKeys }},
+}
+
+// Flags holds the command-line flags bound by BindFlags
+type Flags struct {
+	fs     *flag.FlagSet
+	file   string
+	values map[string]string
+}
+
+// BindFlags registers --config and one flag per setting on fs
+func BindFlags(fs *flag.FlagSet) *Flags {
+	f := &Flags{fs: fs, values: map[string]string{}}
+	fs.StringVar(&f.file, "config", "", "YAML config file (default $UPDOC_CONFIG_FILE)")
+	for _, s := range settings {
+		fs.Func(s.flag, s.usage+" (env "+s.env+")", func(value string) error {
+			f.values[s.flag] = value
+			return nil
+		})
+	}
+	return f
+}
+
+// Load builds the configuration from defaults, the config file, the
+// environment and flags (in that order), then validates it.
+// f may be nil when the caller has no flags.
+func Load(f *Flags) (Config, error) {
+	cfg := Default()
+
+	path := os.Getenv("UPDOC_CONFIG_FILE")
+	if f != nil && f.file != "" {
+		path = f.file
+	}
+	if path != "" {
+		if err := LoadFile(&cfg, path); err != nil {
+			return cfg, err
+		}
+	}
+
+	for _, s := range settings {
+		if value, ok := os.LookupEnv(s.env); ok && value != "" {
+			if err := assign(s.field(&cfg), value); err != nil {
+				return cfg, fmt.Errorf("%s: %w", s.env, err)
+			}
+		}
+	}
+
+	if f != nil {
+		for _, s := range settings {
+			if value, ok := f.values[s.flag]; ok {
+				if err := assign(s.field(&cfg), value); err != nil {
+					return cfg, fmt.Errorf("--%s: %w", s.flag, err)
+				}
+			}
+		}
+	}
+
+	return cfg, cfg.Validate()
+}
+
+func assign(field interface{}, value string) error {
+	switch p := field.(type) {
+	case *string:
+		*p = value
+	case *int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("expected an integer, got %q", value)
+		}
+		*p = n
+	case *float64:
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("expected a number, got %q", value)
+		}
+		*p = n
+	case *time.Duration:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("expected a duration like 30s, got %q", value)
+		}
+		*p = d
+	case *[]string:
+		*p = nil
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				*p = append(*p, item)
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported setting type %T", field)
+	}
+	return nil
+}
@@ -0,0 +1,261 @@
+package confluence
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// User is the account a site's credentials belong to. Cloud identifies it by
+// AccountID, Data Center by Username and UserKey.
+type User struct {
+	Type        string `json:"type"`
+	AccountID   string `json:"accountId"`
+	Username    string `json:"username"`
+	UserKey     string `json:"userKey"`
+	Email       string `json:"email"`
+	DisplayName string `json:"displayName"`
+}
+
+// CurrentUser returns the authenticated account, which makes it a cheap way
+// to check the credentials
+func (s *Site) CurrentUser(ctx context.Context) (*User, error) {
+	var user User
+	if _, err := s.get(ctx, "/rest/api/user/current", nil, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// Detection is what Detect learned about a site
+type Detection struct {
+	// Deployment is "" when the site could not be identified
+	Deployment Deployment
+	// User is the authenticated account; nil when the call failed
+	User *User
+}
+
+// Detect calls the current-user endpoint and works out which flavour of
+// Confluence the site is, from the user it returns or, when the credentials
+// are rejected, from the response headers and host name. A 404 after /wiki
+// was added for Cloud is retried at the URL as configured, where a Data Center
+// site would answer. The error is the first call's, so a site can be
+// identified yet unusable.
+func (s *Site) Detect(ctx context.Context) (*Detection, error) {
+	var user User
+	header, err := s.get(ctx, "/rest/api/user/current", nil, &user)
+	if err == nil {
+		return &Detection{Deployment: detectDeployment(s.creds.BaseURL, header, &user), User: &user}, nil
+	}
+
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		return &Detection{Deployment: detectDeployment(s.creds.BaseURL, nil, nil)}, err
+	}
+	header = apiErr.Header
+	if configured := strings.TrimRight(s.creds.BaseURL, "/"); apiErr.StatusCode == http.StatusNotFound && s.base != configured && s.creds.AuthMode != AuthOAuth {
+		asConfigured := *s
+		asConfigured.base = configured
+		altHeader, altErr := asConfigured.get(ctx, "/rest/api/user/current", nil, &user)
+		if altErr == nil {
+			return &Detection{Deployment: detectDeployment(s.creds.BaseURL, altHeader, &user)}, err
+		}
+		if errors.As(altErr, &apiErr) {
+			header = apiErr.Header
+		}
+	}
+	return &Detection{Deployment: detectDeployment(s.creds.BaseURL, header, nil)}, err
+}
+
+// Content is a page or blog post
+type Content struct {
+	ID    string `json:"id"`
+	Type  string `json:"type"`
+	Title string `json:"title"`
+	Space struct {
+		Key string `json:"key"`
+	} `json:"space"`
+	// Version is only returned when expanded
+	Version *ContentVersion `json:"version"`
+	// Body holds the representations asked for with expand, e.g. body.storage
+	Body struct {
+		Storage *ContentBody `json:"storage"`
+		View    *ContentBody `json:"view"`
+	} `json:"body"`
+	// Ancestors are the page's parents, root first, when expanded
+	Ancestors []Content `json:"ancestors"`
+	// Metadata holds the labels when metadata.labels is expanded
+	Metadata struct {
+		Labels struct {
+			Results []Label `json:"results"`
+		} `json:"labels"`
+	} `json:"metadata"`
+	Links struct {
+		WebUI string `json:"webui"`
+		// Base is only returned for single content
+		Base string `json:"base"`
+	} `json:"_links"`
+}
+
+// LabelNames returns the names of the content's expanded labels
+func (c *Content) LabelNames() []string {
+	names := make([]string, len(c.Metadata.Labels.Results))
+	for i, l := range c.Metadata.Labels.Results {
+		names[i] = l.Name
+	}
+	return names
+}
+
+// AncestorIDs returns the IDs of the content's expanded ancestors, root first
+func (c *Content) AncestorIDs() []string {
+	ids := make([]string, len(c.Ancestors))
+	for i, a := range c.Ancestors {
+		ids[i] = a.ID
+	}
+	return ids
+}
+
+// Label is a label on a piece of content
+type Label struct {
+	Prefix string `json:"prefix"`
+	Name   string `json:"name"`
+}
+
+// ContentBody is a page body in one representation
+type ContentBody struct {
+	Value          string `json:"value"`
+	Representation string `json:"representation"`
+}
+
+// ContentVersion is a version of a piece of content and who made it
+type ContentVersion struct {
+	Number int       `json:"number"`
+	When   time.Time `json:"when"`
+	By     User      `json:"by"`
+}
+
+// ContentList is one page of content results
+type ContentList struct {
+	Results []Content `json:"results"`
+	Start   int       `json:"start"`
+	Limit   int       `json:"limit"`
+	Size    int       `json:"size"`
+	// TotalSize is only reported by some endpoints, such as search
+	TotalSize int `json:"totalSize"`
+	Links     struct {
+		// Base is the site's public base URL that webui links are relative to
+		Base string `json:"base"`
+		Next string `json:"next"`
+	} `json:"_links"`
+}
+
+// HasMore reports whether another page of results follows
+func (l *ContentList) HasMore() bool { return l.Links.Next != "" }
+
+// NextCursor is the cursor Confluence Cloud's search puts in its next link,
+// which replaces start there; "" when the next link pages by start instead
+func (l *ContentList) NextCursor() string {
+	next, err := url.Parse(l.Links.Next)
+	if err != nil {
+		return ""
+	}
+	return next.Query().Get("cursor")
+}
+
+// ContentQuery filters ListContent; zero values are left to the server
+type ContentQuery struct {
+	SpaceKey string
+	Start    int
+	Limit    int
+	Expand   []string
+}
+
+// ListContent returns one page of content, optionally limited to a space
+func (s *Site) ListContent(ctx context.Context, q ContentQuery) (*ContentList, error) {
+	query := url.Values{}
+	if q.SpaceKey != "" {
+		query.Set("spaceKey", q.SpaceKey)
+	}
+	if q.Start > 0 {
+		query.Set("start", strconv.Itoa(q.Start))
+	}
+	if q.Limit > 0 {
+		query.Set("limit", strconv.Itoa(q.Limit))
+	}
+	if len(q.Expand) > 0 {
+		query.Set("expand", strings.Join(q.Expand, ","))
+	}
+
+	var list ContentList
+	if _, err := s.get(ctx, "/rest/api/content", query, &list); err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
+// ContentGetQuery selects what GetContent returns; a zero Version is the
+// current one
+type ContentGetQuery struct {
+	Version int
+	Expand  []string
+}
+
+// GetContent returns a page or blog post, at a historical version if asked
+func (s *Site) GetContent(ctx context.Context, id string, q ContentGetQuery) (*Content, error) {
+	query := url.Values{}
+	if q.Version > 0 {
+		query.Set("status", "historical")
+		query.Set("version", strconv.Itoa(q.Version))
+	}
+	if len(q.Expand) > 0 {
+		query.Set("expand", strings.Join(q.Expand, ","))
+	}
+
+	var content Content
+	if _, err := s.get(ctx, "/rest/api/content/"+url.PathEscape(id), query, &content); err != nil {
+		return nil, err
+	}
+	return &content, nil
+}
+
+// SearchQuery is a CQL search. Cursor, from ContentList.NextCursor, takes
+// precedence over Start.
+type SearchQuery struct {
+	CQL    string
+	Cursor string
+	Start  int
+	Limit  int
+	Expand []string
+}
+
+// Search returns one page of the content matching a CQL query
+func (s *Site) Search(ctx context.Context, q SearchQuery) (*ContentList, error) {
+	query := url.Values{}
+	query.Set("cql", q.CQL)
+	if q.Cursor != "" {
+		query.Set("cursor", q.Cursor)
+	} else if q.Start > 0 {
+		query.Set("start", strconv.Itoa(q.Start))
+	}
+	if q.Limit > 0 {
+		query.Set("limit", strconv.Itoa(q.Limit))
+	}
+	if len(q.Expand) > 0 {
+		query.Set("expand", strings.Join(q.Expand, ","))
+	}
+
+	var list ContentList
+	if _, err := s.get(ctx, "/rest/api/content/search", query, &list); err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
+// QuoteCQL quotes a value for use in a CQL clause
+func QuoteCQL(value string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+}
@@ -0,0 +1,122 @@
+package confluence
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// AuthMode is how a site authenticates, which also tells Cloud sites from
+// Data Center and Server ones
+type AuthMode string
+
+const (
+	// AuthCloudBasic is Atlassian Cloud: account email and API token
+	AuthCloudBasic AuthMode = "cloud_basic"
+	// AuthDCBearer is Data Center or Server with a personal access token
+	AuthDCBearer AuthMode = "dc_bearer"
+	// AuthDCBasic is Data Center or Server with a username and password
+	AuthDCBasic AuthMode = "dc_basic"
+	// AuthOAuth is Atlassian Cloud through an OAuth 2.0 (3LO) grant. It is
+	// set by connecting, not configured directly.
+	AuthOAuth AuthMode = "oauth"
+)
+
+// ParseAuthMode validates a configured mode; "" is allowed and means the mode
+// is picked by DefaultAuthMode
+func ParseAuthMode(s string) (AuthMode, error) {
+	switch m := AuthMode(strings.ToLower(strings.TrimSpace(s))); m {
+	case "", AuthCloudBasic, AuthDCBearer, AuthDCBasic:
+		return m, nil
+	}
+	return "", fmt.Errorf("confluence auth mode must be %s, %s or %s, got %q", AuthCloudBasic, AuthDCBearer, AuthDCBasic, s)
+}
+
+// DefaultAuthMode picks a mode for a site with none configured: Cloud for
+// *.atlassian.net, otherwise a Data Center personal access token when there is
+// no username and basic auth when there is
+func DefaultAuthMode(baseURL, username string) AuthMode {
+	if isCloudHost(baseURL) {
+		return AuthCloudBasic
+	}
+	if username == "" {
+		return AuthDCBearer
+	}
+	return AuthDCBasic
+}
+
+// Deployment returns the flavour of Confluence the mode is for
+func (m AuthMode) Deployment() Deployment {
+	if m == AuthDCBearer || m == AuthDCBasic {
+		return DeploymentDataCenter
+	}
+	return DeploymentCloud
+}
+
+// NeedsUsername reports whether the mode sends a username with the token
+func (m AuthMode) NeedsUsername() bool { return m != AuthDCBearer && m != AuthOAuth }
+
+// Deployment is a flavour of Confluence
+type Deployment string
+
+const (
+	DeploymentCloud      Deployment = "cloud"
+	DeploymentDataCenter Deployment = "data_center"
+)
+
+// Title is the deployment's product name, for messages
+func (d Deployment) Title() string {
+	if d == DeploymentDataCenter {
+		return "Confluence Data Center"
+	}
+	return "Confluence Cloud"
+}
+
+func isCloudHost(baseURL string) bool {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+	return strings.HasSuffix(host, ".atlassian.net") || strings.HasSuffix(host, ".jira.com")
+}
+
+// apiBase is the URL the REST API lives under. Cloud sites always serve it
+// under /wiki, so it is added when the configured URL is just the site root;
+// Data Center URLs are used as configured, since their context path (often
+// none) is chosen by the administrator.
+func apiBase(baseURL string, mode AuthMode) string {
+	base := strings.TrimRight(baseURL, "/")
+	if mode.Deployment() == DeploymentCloud && !strings.HasSuffix(base, "/wiki") {
+		base += "/wiki"
+	}
+	return base
+}
+
+// detectDeployment guesses the flavour from the current-user response: Cloud
+// identifies users by accountId, Data Center by username and userKey. When
+// there is no user, such as after a 401, it falls back to response headers
+// and the host name. It returns "" when there is no telling.
+func detectDeployment(baseURL string, header http.Header, user *User) Deployment {
+	if user != nil {
+		if user.AccountID != "" {
+			return DeploymentCloud
+		}
+		if user.Username != "" || user.UserKey != "" {
+			return DeploymentDataCenter
+		}
+	}
+	if header != nil {
+		if header.Get("X-AUSERNAME") != "" || header.Get("X-Confluence-Request-Time") != "" {
+			return DeploymentDataCenter
+		}
+		if header.Get("Atl-Traceid") != "" {
+			return DeploymentCloud
+		}
+	}
+	if isCloudHost(baseURL) {
+		return DeploymentCloud
+	}
+	return ""
+}
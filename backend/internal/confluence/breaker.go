@@ -0,0 +1,118 @@
+package confluence
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+type breakerState int
+
+const (
+	stateClosed breakerState = iota
+	stateOpen
+	// stateHalfOpen lets a single trial call through after the cooldown
+	stateHalfOpen
+)
+
+type outcome int
+
+const (
+	outcomeSuccess outcome = iota
+	outcomeFailure
+	// outcomeIgnored is a call abandoned by its caller, which says nothing
+	// about Confluence's health
+	outcomeIgnored
+)
+
+// outcomeFor classifies a failed call. Only failures that retries couldn't
+// get past count against the breaker; a 4xx other than 429 means Confluence
+// answered, so it counts as a success.
+func outcomeFor(err error) outcome {
+	if retryable(err) {
+		return outcomeFailure
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return outcomeSuccess
+	}
+	return outcomeIgnored
+}
+
+// breaker opens after threshold consecutive failures and rejects calls until
+// cooldown has passed, then lets one trial call decide whether to close again
+type breaker struct {
+	threshold int
+	cooldown  time.Duration
+	onChange  func(open bool)
+
+	mu       sync.Mutex
+	current  breakerState
+	failures int
+	openedAt time.Time
+	trial    bool
+}
+
+func newBreaker(threshold int, cooldown time.Duration, onChange func(open bool)) *breaker {
+	return &breaker{threshold: threshold, cooldown: cooldown, onChange: onChange}
+}
+
+func (b *breaker) state() breakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.current
+}
+
+// allow returns ErrCircuitOpen unless a call may proceed. Every allowed call
+// must be followed by exactly one record.
+func (b *breaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.current {
+	case stateOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return ErrCircuitOpen
+		}
+		b.current = stateHalfOpen
+		b.trial = true
+		return nil
+	case stateHalfOpen:
+		if b.trial {
+			return ErrCircuitOpen
+		}
+		b.trial = true
+		return nil
+	}
+	return nil
+}
+
+func (b *breaker) record(o outcome) {
+	b.mu.Lock()
+	var changed, open bool
+	defer func() {
+		b.mu.Unlock()
+		if changed && b.onChange != nil {
+			b.onChange(open)
+		}
+	}()
+
+	if b.current == stateHalfOpen {
+		b.trial = false
+	}
+
+	switch o {
+	case outcomeSuccess:
+		changed = b.current != stateClosed
+		b.current = stateClosed
+		b.failures = 0
+	case outcomeFailure:
+		b.failures++
+		if b.current == stateHalfOpen || b.failures >= b.threshold {
+			changed = b.current == stateClosed
+			open = true
+			b.current = stateOpen
+			b.openedAt = time.Now()
+		}
+	}
+}
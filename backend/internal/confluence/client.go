@@ -0,0 +1,326 @@
+// Package confluence is a client for the Confluence REST API shared by every
+// organization. Calls that hit a 429, a 5xx or a transport error are retried
+// with exponential backoff and jitter, honouring Retry-After. Each
+// organization has its own token-bucket rate limiter, so one org's sync can't
+// starve another's, and its own circuit breaker, which marks the integration
+// degraded after repeated failures and fails calls fast until a trial call
+// succeeds. Point a Site at the fake in package confluencetest to exercise it
+// without Atlassian.
+package confluence
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/shaunpua/updoc/internal/config"
+	"github.com/shaunpua/updoc/internal/logging"
+	"github.com/shaunpua/updoc/internal/metrics"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"golang.org/x/time/rate"
+)
+
+// Client holds the HTTP connections, rate limiters and circuit breakers for
+// every site. It is safe for concurrent use and should be shared.
+type Client struct {
+	cfg    config.ConfluenceConfig
+	http   *resty.Client
+	logger *slog.Logger
+
+	oauth *OAuth
+
+	mu       sync.Mutex
+	limiters map[string]*rate.Limiter
+	breakers map[string]*breaker
+	tokens   map[string]*tokenState
+}
+
+// New builds a client whose transport keeps connections to each Atlassian
+// site alive between calls and bounds how long connecting and waiting for
+// response headers may take; cfg.Timeout bounds each attempt including
+// reading the body.
+func New(cfg config.ConfluenceConfig, logger *slog.Logger) *Client {
+	c := &Client{
+		cfg:      cfg,
+		logger:   logger.With("component", "confluence"),
+		limiters: make(map[string]*rate.Limiter),
+		breakers: make(map[string]*breaker),
+		tokens:   make(map[string]*tokenState),
+	}
+
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   cfg.ConnectTimeout,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		TLSHandshakeTimeout:   cfg.ConnectTimeout,
+		ResponseHeaderTimeout: cfg.ReadTimeout,
+		ExpectContinueTimeout: time.Second,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   cfg.MaxIdleConnsPerHost,
+		IdleConnTimeout:       90 * time.Second,
+	}
+
+	c.http = resty.New().
+		SetTimeout(cfg.Timeout).
+		SetTransport(otelhttp.NewTransport(transport))
+	c.http.OnAfterResponse(func(_ *resty.Client, resp *resty.Response) error {
+		ctx := resp.Request.Context()
+		key, _ := ctx.Value(siteKey{}).(string)
+		metrics.ObserveConfluenceRequest(key, resp.Request.Method, resp.StatusCode(), resp.Time())
+		c.logger.DebugContext(ctx, "confluence request",
+			"org", key,
+			"method", resp.Request.Method,
+			"url", logging.RedactURL(resp.Request.URL),
+			"status", resp.StatusCode(),
+			"duration", resp.Time())
+		return nil
+	})
+	c.http.OnError(func(req *resty.Request, err error) {
+		ctx := req.Context()
+		key, _ := ctx.Value(siteKey{}).(string)
+		metrics.ObserveConfluenceRequest(key, req.Method, 0, time.Since(req.Time))
+		c.logger.WarnContext(ctx, "confluence request failed",
+			"org", key, "method", req.Method, "url", logging.RedactURL(req.URL), "error", err)
+	})
+	c.oauth = &OAuth{cfg: cfg.OAuth, http: c.http}
+	return c
+}
+
+// Credentials identify a Confluence site and the account used to call it
+type Credentials struct {
+	BaseURL string
+	// AuthMode is how to authenticate; "" picks one with DefaultAuthMode
+	AuthMode AuthMode
+	// Username is the account email on Cloud, or the username on Data Center.
+	// It is not sent with a personal access token.
+	Username string
+	Token    string
+
+	// CloudID and OAuth are used instead with AuthOAuth: calls go through the
+	// API gateway to the site CloudID names, with OAuth's access token, which
+	// is refreshed when it nears expiry. SaveToken stores each refreshed grant.
+	CloudID   string
+	OAuth     *OAuthToken
+	SaveToken func(ctx context.Context, token *OAuthToken) error
+}
+
+// Site is one organization's Confluence instance. Sites are cheap; build one
+// per call with Client.Site.
+type Site struct {
+	client *Client
+	key    string
+	creds  Credentials
+	base   string
+	// web is what page links are relative to; it differs from base when
+	// calls go through the OAuth gateway
+	web string
+}
+
+// Site returns a handle for calling creds.BaseURL. key names the organization
+// for rate limiting, circuit breaking and metrics, so every call for the same
+// organization must use the same key.
+func (c *Client) Site(key string, creds Credentials) *Site {
+	if creds.AuthMode == "" {
+		creds.AuthMode = DefaultAuthMode(creds.BaseURL, creds.Username)
+	}
+	s := &Site{client: c, key: key, creds: creds, base: apiBase(creds.BaseURL, creds.AuthMode)}
+	s.web = s.base
+	if creds.AuthMode == AuthOAuth {
+		s.base = c.oauth.gatewayURL(creds.CloudID)
+	}
+	return s
+}
+
+// AuthMode is the mode the site authenticates with
+func (s *Site) AuthMode() AuthMode { return s.creds.AuthMode }
+
+// BaseURL is the site's base URL, which page links are relative to:
+// https://acme.atlassian.net/wiki on Cloud, or the configured URL on Data
+// Center. The REST API lives under it too, except with OAuth.
+func (s *Site) BaseURL() string { return s.web }
+
+// WebURL turns a _links.webui path into an absolute URL. base is the list's
+// _links.base, which is the site's canonical public URL; "" uses BaseURL.
+func (s *Site) WebURL(base, webui string) string {
+	if strings.HasPrefix(webui, "http://") || strings.HasPrefix(webui, "https://") {
+		return webui
+	}
+	if base == "" {
+		base = s.web
+	}
+	return strings.TrimRight(base, "/") + webui
+}
+
+// Degraded reports whether key's circuit breaker has opened, meaning recent
+// calls failed and new ones are rejected until a trial call succeeds
+func (c *Client) Degraded(key string) bool {
+	return c.breaker(key).state() != stateClosed
+}
+
+// siteKey carries the site key from a request to the client's hooks
+type siteKey struct{}
+
+func (c *Client) limiter(key string) *rate.Limiter {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	l, ok := c.limiters[key]
+	if !ok {
+		l = rate.NewLimiter(rate.Limit(c.cfg.RateLimit), c.cfg.RateBurst)
+		c.limiters[key] = l
+	}
+	return l
+}
+
+func (c *Client) breaker(key string) *breaker {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	b, ok := c.breakers[key]
+	if !ok {
+		b = newBreaker(c.cfg.BreakerThreshold, c.cfg.BreakerCooldown, func(open bool) {
+			metrics.SetConfluenceCircuitOpen(key, open)
+			if open {
+				c.logger.Warn("confluence integration degraded", "org", key, "cooldown", c.cfg.BreakerCooldown)
+			} else {
+				c.logger.Info("confluence integration recovered", "org", key)
+			}
+		})
+		c.breakers[key] = b
+	}
+	return b
+}
+
+// get calls path on the site and decodes the JSON response into out,
+// returning the response headers
+func (s *Site) get(ctx context.Context, path string, query url.Values, out interface{}) (http.Header, error) {
+	return s.call(ctx, http.MethodGet, path, query, nil, out)
+}
+
+// send makes a request that changes content, with body encoded as JSON, and
+// decodes the response into out unless it is nil
+func (s *Site) send(ctx context.Context, method, path string, body, out interface{}) error {
+	_, err := s.call(ctx, method, path, nil, body, out)
+	return err
+}
+
+// call makes a request to the site and decodes the JSON response into out,
+// returning the response headers. It waits for the organization's rate
+// limiter before every attempt and retries retryable failures while ctx
+// allows. A POST is retried only when it was rate limited, since otherwise
+// it may have taken effect.
+func (s *Site) call(ctx context.Context, method, path string, query url.Values, body, out interface{}) (http.Header, error) {
+	c := s.client
+	b := c.breaker(s.key)
+	if err := b.allow(); err != nil {
+		return nil, err
+	}
+
+	ctx = context.WithValue(ctx, siteKey{}, s.key)
+	for attempt := 0; ; attempt++ {
+		if err := c.limiter(s.key).Wait(ctx); err != nil {
+			b.record(outcomeIgnored)
+			return nil, fmt.Errorf("confluence rate limit: %w", err)
+		}
+
+		req, err := s.request(ctx)
+		if err != nil {
+			b.record(outcomeIgnored)
+			return nil, err
+		}
+		req.SetQueryParamsFromValues(query)
+		if body != nil {
+			req.SetHeader("Content-Type", "application/json").SetBody(body)
+		}
+		resp, err := req.Execute(method, s.base+path)
+		err = checkResponse(resp, err)
+		if err == nil {
+			b.record(outcomeSuccess)
+			if out != nil && len(resp.Body()) > 0 {
+				if err := json.Unmarshal(resp.Body(), out); err != nil {
+					return resp.Header(), fmt.Errorf("failed to parse Confluence response: %w", err)
+				}
+			}
+			return resp.Header(), nil
+		}
+
+		if ctx.Err() != nil {
+			b.record(outcomeIgnored)
+			return nil, ctx.Err()
+		}
+		delay, retry := c.retryDelay(ctx, attempt, err)
+		if retry && method == http.MethodPost && !rateLimited(err) {
+			retry = false
+		}
+		if !retry {
+			b.record(outcomeFor(err))
+			var header http.Header
+			if resp != nil {
+				header = resp.Header()
+			}
+			return header, err
+		}
+
+		status := 0
+		if resp != nil {
+			status = resp.StatusCode()
+		}
+		metrics.ObserveConfluenceRetry(s.key, status)
+		c.logger.InfoContext(ctx, "retrying confluence request",
+			"org", s.key, "method", method, "path", path, "attempt", attempt+1, "delay", delay, "error", err)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			b.record(outcomeIgnored)
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// request returns an authenticated request that runs under ctx, so it is
+// cancelled when the incoming request is, and forwards the caller's request
+// ID and trace context. It fails only when an OAuth token can't be refreshed.
+func (s *Site) request(ctx context.Context) (*resty.Request, error) {
+	req := s.client.http.R().
+		SetContext(ctx).
+		SetHeader("Accept", "application/json")
+	switch s.creds.AuthMode {
+	case AuthOAuth:
+		token, err := s.accessToken(ctx)
+		if err != nil {
+			return nil, err
+		}
+		req.SetAuthToken(token)
+	case AuthDCBearer:
+		req.SetAuthToken(s.creds.Token)
+	default:
+		req.SetBasicAuth(s.creds.Username, s.creds.Token)
+	}
+	if id := logging.RequestID(ctx); id != "" {
+		req.SetHeader("X-Request-ID", id)
+	}
+	return req, nil
+}
+
+// checkResponse turns a transport error or non-2xx response into an error
+func checkResponse(resp *resty.Response, err error) error {
+	if err != nil {
+		return &TransportError{Err: err}
+	}
+	if resp.IsSuccess() {
+		return nil
+	}
+	return newAPIError(resp)
+}
@@ -0,0 +1,209 @@
+package confluencetest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Comment is a footer comment on a page, added through the REST API
+type Comment struct {
+	ID      string    `json:"id"`
+	PageID  string    `json:"page_id"`
+	Version int       `json:"version"`
+	Body    string    `json:"body"`
+	By      string    `json:"by"`
+	When    time.Time `json:"when"`
+}
+
+// Comments returns the comments on a page, oldest first
+func (s *Server) Comments(pageID string) []Comment {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []Comment
+	for _, c := range s.comments {
+		if c.PageID == pageID {
+			out = append(out, *c)
+		}
+	}
+	return out
+}
+
+// comment returns the comment with id, or nil. The caller must hold s.mu.
+func (s *Server) comment(id string) *Comment {
+	for _, c := range s.comments {
+		if c.ID == id {
+			return c
+		}
+	}
+	return nil
+}
+
+// commentJSON renders a comment the way Confluence does, with its version,
+// container and storage body. The caller must hold s.mu.
+func (s *Server) commentJSON(base string, c *Comment) map[string]interface{} {
+	out := map[string]interface{}{
+		"id":        c.ID,
+		"type":      "comment",
+		"status":    "current",
+		"version":   versionJSON(&Version{Number: c.Version, When: c.When, By: c.By}),
+		"container": map[string]interface{}{"id": c.PageID, "type": "page"},
+		"body": map[string]interface{}{
+			"storage": map[string]interface{}{"value": c.Body, "representation": "storage"},
+		},
+		"_links": map[string]interface{}{
+			"self": base + "/rest/api/content/" + c.ID,
+		},
+	}
+	if p, ok := s.byID[c.PageID]; ok {
+		out["title"] = "Re: " + p.Title
+		out["_links"].(map[string]interface{})["webui"] = s.webUIPath(p) + "?focusedCommentId=" + c.ID
+	}
+	return out
+}
+
+// contentRequest is the body of a content create or update
+type contentRequest struct {
+	Type      string `json:"type"`
+	Container struct {
+		ID string `json:"id"`
+	} `json:"container"`
+	Version struct {
+		Number int `json:"number"`
+	} `json:"version"`
+	Body struct {
+		Storage struct {
+			Value string `json:"value"`
+		} `json:"storage"`
+	} `json:"body"`
+}
+
+// createContent adds a comment; pages are created through /_fake/pages
+func (s *Server) createContent(w http.ResponseWriter, r *http.Request) {
+	var in contentRequest
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid content: "+err.Error())
+		return
+	}
+	if in.Type != "comment" {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Creating %q content is not supported", in.Type))
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.byID[in.Container.ID]; !ok {
+		notFound(w, in.Container.ID)
+		return
+	}
+	c := &Comment{
+		ID:      strconv.Itoa(s.nextID),
+		PageID:  in.Container.ID,
+		Version: 1,
+		Body:    in.Body.Storage.Value,
+		By:      s.user.DisplayName,
+		When:    time.Now().UTC(),
+	}
+	s.nextID++
+	s.comments = append(s.comments, c)
+	writeJSON(w, http.StatusOK, s.commentJSON(s.baseURL(r), c))
+}
+
+// updateContent saves a new version of a comment, which must be numbered one
+// more than the current one
+func (s *Server) updateContent(w http.ResponseWriter, r *http.Request) {
+	var in contentRequest
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid content: "+err.Error())
+		return
+	}
+
+	id := r.PathValue("id")
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := s.comment(id)
+	if c == nil {
+		if _, ok := s.byID[id]; ok {
+			writeError(w, http.StatusBadRequest, "Updating pages is not supported; use PUT /_fake/pages/"+id)
+			return
+		}
+		notFound(w, id)
+		return
+	}
+	if in.Version.Number != c.Version+1 {
+		writeError(w, http.StatusConflict, fmt.Sprintf("Version must be incremented on update. Current version is: %d", c.Version))
+		return
+	}
+	c.Version = in.Version.Number
+	c.Body = in.Body.Storage.Value
+	c.When = time.Now().UTC()
+	writeJSON(w, http.StatusOK, s.commentJSON(s.baseURL(r), c))
+}
+
+// deleteContent removes a comment
+func (s *Server) deleteContent(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, c := range s.comments {
+		if c.ID == id {
+			s.comments = append(s.comments[:i], s.comments[i+1:]...)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+	}
+	if _, ok := s.byID[id]; ok {
+		writeError(w, http.StatusBadRequest, "Deleting pages is not supported; use DELETE /_fake/pages/"+id)
+		return
+	}
+	notFound(w, id)
+}
+
+func (s *Server) listComments(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	s.mu.Lock()
+	_, ok := s.byID[id]
+	var results []interface{}
+	for _, c := range s.comments {
+		if c.PageID == id {
+			results = append(results, s.commentJSON(s.baseURL(r), c))
+		}
+	}
+	s.mu.Unlock()
+
+	if !ok {
+		notFound(w, id)
+		return
+	}
+	s.writeList(w, r, results)
+}
+
+// addLabels adds the labels in the body, an array of {prefix, name}, and
+// returns the page's labels
+func (s *Server) addLabels(w http.ResponseWriter, r *http.Request) {
+	var in []struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid labels: "+err.Error())
+		return
+	}
+	id := r.PathValue("id")
+	for _, l := range in {
+		if err := s.AddLabel(id, l.Name); err != nil {
+			writeControlError(w, err)
+			return
+		}
+	}
+	s.listLabels(w, r)
+}
+
+func (s *Server) deleteLabel(w http.ResponseWriter, r *http.Request) {
+	if err := s.RemoveLabel(r.PathValue("id"), r.PathValue("name")); err != nil {
+		writeControlError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,407 @@
+package confluencetest
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultLimit = 25
+	maxLimit     = 100
+)
+
+// baseURL is the site base URL as seen by the caller, which Confluence
+// returns in _links.base
+func (s *Server) baseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + s.contextPath()
+}
+
+func titleSlug(title string) string { return url.QueryEscape(title) }
+
+// webUIPath is a page's path relative to the site base URL, as Confluence
+// returns it in _links.webui: /spaces/KEY/pages/ID/Title on Cloud and
+// /display/KEY/Title on Data Center
+func (s *Server) webUIPath(p *page) string {
+	if s.opts.DataCenter {
+		return path.Join("/display", p.spaceKey, titleSlug(p.Title))
+	}
+	return path.Join("/spaces", p.spaceKey, "pages", p.ID, titleSlug(p.Title))
+}
+
+func (s *Server) currentUser(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	u := s.user
+	s.mu.Unlock()
+	if s.opts.DataCenter {
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"type":        "known",
+			"username":    u.Username,
+			"userKey":     fmt.Sprintf("%x", u.Username),
+			"displayName": u.DisplayName,
+		})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"type":        "known",
+		"accountId":   u.AccountID,
+		"accountType": "atlassian",
+		"email":       u.Email,
+		"publicName":  u.DisplayName,
+		"displayName": u.DisplayName,
+	})
+}
+
+func (s *Server) listSpaces(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	spaces := append([]Space(nil), s.spaces...)
+	s.mu.Unlock()
+
+	results := make([]interface{}, len(spaces))
+	for i, sp := range spaces {
+		results[i] = spaceJSON(sp)
+	}
+	s.writeList(w, r, results)
+}
+
+func (s *Server) listContent(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if t := q.Get("type"); t != "" && t != "page" {
+		// Only pages are modelled; other content types are always empty
+		s.writeList(w, r, nil)
+		return
+	}
+	if st := q.Get("status"); st != "" && st != "current" && st != "any" {
+		s.writeList(w, r, nil)
+		return
+	}
+
+	spaceKey, title := q.Get("spaceKey"), q.Get("title")
+	s.renderPages(w, r, func(p *page) bool {
+		return (spaceKey == "" || p.spaceKey == spaceKey) && (title == "" || p.Title == title)
+	}, nil)
+}
+
+func (s *Server) searchContent(w http.ResponseWriter, r *http.Request) {
+	query, err := parseCQL(r.URL.Query().Get("cql"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Could not parse cql : "+err.Error())
+		return
+	}
+	s.renderPages(w, r, query.match, query.order)
+}
+
+// renderPages writes the page of matching pages selected by start and limit,
+// with the fields requested by expand
+func (s *Server) renderPages(w http.ResponseWriter, r *http.Request, match func(*page) bool, order func([]*page)) {
+	s.mu.Lock()
+	var matched []*page
+	for _, p := range s.pages {
+		if match(p) {
+			matched = append(matched, p)
+		}
+	}
+	if order != nil {
+		order(matched)
+	}
+	expand := parseExpand(r.URL.Query().Get("expand"))
+	base := s.baseURL(r)
+	results := make([]interface{}, len(matched))
+	for i, p := range matched {
+		results[i] = s.contentJSON(base, p, p.current(), expand)
+	}
+	s.mu.Unlock()
+
+	s.writeList(w, r, results)
+}
+
+func (s *Server) getContent(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	q := r.URL.Query()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.byID[id]
+	if !ok {
+		if c := s.comment(id); c != nil {
+			writeJSON(w, http.StatusOK, s.commentJSON(s.baseURL(r), c))
+			return
+		}
+		notFound(w, id)
+		return
+	}
+
+	v := p.current()
+	if q.Get("status") == "historical" || q.Has("version") {
+		n, err := strconv.Atoi(q.Get("version"))
+		if err != nil || n < 1 || n > len(p.Versions) {
+			writeError(w, http.StatusNotFound, fmt.Sprintf("No version %s of content %s", q.Get("version"), id))
+			return
+		}
+		v = &p.Versions[n-1]
+	}
+	writeJSON(w, http.StatusOK, s.contentJSON(s.baseURL(r), p, v, parseExpand(q.Get("expand"))))
+}
+
+func (s *Server) listVersions(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	s.mu.Lock()
+	p, ok := s.byID[id]
+	var results []interface{}
+	if ok {
+		// Newest first, as Confluence lists them
+		for i := len(p.Versions) - 1; i >= 0; i-- {
+			results = append(results, versionJSON(&p.Versions[i]))
+		}
+	}
+	s.mu.Unlock()
+
+	if !ok {
+		notFound(w, id)
+		return
+	}
+	s.writeList(w, r, results)
+}
+
+func (s *Server) listLabels(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	s.mu.Lock()
+	p, ok := s.byID[id]
+	var results []interface{}
+	if ok {
+		results = labelsJSON(p.Labels)
+	}
+	s.mu.Unlock()
+
+	if !ok {
+		notFound(w, id)
+		return
+	}
+	s.writeList(w, r, results)
+}
+
+func (s *Server) listChildren(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	s.mu.Lock()
+	_, ok := s.byID[id]
+	s.mu.Unlock()
+	if !ok {
+		notFound(w, id)
+		return
+	}
+	s.renderPages(w, r, func(p *page) bool { return p.ParentID == id }, nil)
+}
+
+// writeList writes the standard paged result envelope for one window of
+// results, linking to the next window when there is one
+func (s *Server) writeList(w http.ResponseWriter, r *http.Request, all []interface{}) {
+	q := r.URL.Query()
+	start, _ := strconv.Atoi(q.Get("start"))
+	if start < 0 {
+		start = 0
+	}
+	limit, err := strconv.Atoi(q.Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = defaultLimit
+	}
+	if limit > maxLimit {
+		limit = maxLimit
+	}
+
+	end := start + limit
+	if start > len(all) {
+		start = len(all)
+	}
+	if end > len(all) {
+		end = len(all)
+	}
+	results := all[start:end]
+	if results == nil {
+		results = []interface{}{}
+	}
+
+	// Links are relative to the context path, or to the gateway prefix
+	apiPath := strings.TrimPrefix(r.URL.Path, s.contextPath())
+	if id := r.PathValue("cloudid"); id != "" {
+		apiPath = strings.TrimPrefix(r.URL.Path, "/ex/confluence/"+id+"/wiki")
+	}
+	links := map[string]interface{}{
+		"base":    s.baseURL(r),
+		"context": s.contextPath(),
+		"self":    s.baseURL(r) + apiPath,
+	}
+	if end < len(all) {
+		next := url.Values{}
+		for k, v := range q {
+			next[k] = v
+		}
+		next.Set("start", strconv.Itoa(end))
+		next.Set("limit", strconv.Itoa(limit))
+		links["next"] = apiPath + "?" + next.Encode()
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"results":   results,
+		"start":     start,
+		"limit":     limit,
+		"size":      len(results),
+		"totalSize": len(all),
+		"_links":    links,
+	})
+}
+
+// expansion is the set of fields requested with ?expand=, e.g.
+// "space,version,body.storage". Asking for a nested field implies its parents.
+type expansion map[string]bool
+
+func parseExpand(value string) expansion {
+	e := expansion{}
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		for field != "" {
+			e[field] = true
+			i := strings.LastIndex(field, ".")
+			if i < 0 {
+				break
+			}
+			field = field[:i]
+		}
+	}
+	return e
+}
+
+// contentJSON renders version v of p the way Confluence does, including only
+// the expanded fields and listing the others under _expandable. The caller
+// must hold s.mu.
+func (s *Server) contentJSON(base string, p *page, v *Version, expand expansion) map[string]interface{} {
+	status := "current"
+	if v.Number != p.current().Number {
+		status = "historical"
+	}
+	c := map[string]interface{}{
+		"id":     p.ID,
+		"type":   "page",
+		"status": status,
+		"title":  p.Title,
+		"_links": map[string]interface{}{
+			"webui":  s.webUIPath(p),
+			"tinyui": "/x/" + p.ID,
+			"self":   base + "/rest/api/content/" + p.ID,
+		},
+	}
+	expandable := map[string]interface{}{}
+
+	if expand["space"] {
+		for _, sp := range s.spaces {
+			if sp.Key == p.spaceKey {
+				c["space"] = spaceJSON(sp)
+			}
+		}
+	} else {
+		expandable["space"] = "/rest/api/space/" + p.spaceKey
+	}
+
+	if expand["version"] {
+		c["version"] = versionJSON(v)
+	} else {
+		expandable["version"] = ""
+	}
+
+	if expand["body"] {
+		body := map[string]interface{}{}
+		for _, representation := range []string{"storage", "view"} {
+			if expand["body."+representation] {
+				body[representation] = map[string]interface{}{
+					"value":          v.Body,
+					"representation": representation,
+				}
+			}
+		}
+		c["body"] = body
+	} else {
+		expandable["body"] = ""
+	}
+
+	if expand["metadata.labels"] {
+		labels := labelsJSON(p.Labels)
+		c["metadata"] = map[string]interface{}{
+			"labels": map[string]interface{}{"results": labels, "size": len(labels)},
+		}
+	} else {
+		expandable["metadata"] = ""
+	}
+
+	if expand["ancestors"] {
+		var ancestors []interface{}
+		for id := p.ParentID; id != ""; {
+			parent, ok := s.byID[id]
+			if !ok {
+				break
+			}
+			ancestors = append([]interface{}{map[string]interface{}{
+				"id": parent.ID, "type": "page", "title": parent.Title,
+			}}, ancestors...)
+			id = parent.ParentID
+		}
+		if ancestors == nil {
+			ancestors = []interface{}{}
+		}
+		c["ancestors"] = ancestors
+	} else {
+		expandable["ancestors"] = ""
+	}
+
+	if expand["history"] {
+		first := &p.Versions[0]
+		c["history"] = map[string]interface{}{
+			"latest":      status == "current",
+			"createdBy":   map[string]interface{}{"type": "known", "displayName": first.By},
+			"createdDate": formatTime(first.When),
+		}
+	} else {
+		expandable["history"] = ""
+	}
+
+	c["_expandable"] = expandable
+	return c
+}
+
+func spaceJSON(sp Space) map[string]interface{} {
+	return map[string]interface{}{
+		"key":    sp.Key,
+		"name":   sp.Name,
+		"type":   "global",
+		"_links": map[string]interface{}{"webui": "/spaces/" + sp.Key},
+	}
+}
+
+func versionJSON(v *Version) map[string]interface{} {
+	return map[string]interface{}{
+		"number":    v.Number,
+		"when":      formatTime(v.When),
+		"message":   v.Message,
+		"minorEdit": false,
+		"by":        map[string]interface{}{"type": "known", "displayName": v.By},
+	}
+}
+
+func labelsJSON(labels []string) []interface{} {
+	results := make([]interface{}, len(labels))
+	for i, name := range labels {
+		results[i] = map[string]interface{}{"prefix": "global", "name": name, "id": name, "label": name}
+	}
+	return results
+}
+
+// formatTime matches Confluence's timestamps, e.g. 2025-03-14T16:05:00.000Z
+func formatTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05.000Z")
+}
@@ -0,0 +1,418 @@
+package confluencetest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PageInput describes a page to create, or the changes for a new version.
+// Empty fields keep their current value on update.
+type PageInput struct {
+	SpaceKey string   `json:"space_key"`
+	ParentID string   `json:"parent_id"`
+	Title    string   `json:"title"`
+	Body     string   `json:"body"`
+	By       string   `json:"by"`
+	Message  string   `json:"message"`
+	Labels   []string `json:"labels"`
+}
+
+// CreatePage adds a page at version 1 and fires page_created
+func (s *Server) CreatePage(in PageInput) (id string, err error) {
+	s.mu.Lock()
+	if !s.hasSpace(in.SpaceKey) {
+		s.mu.Unlock()
+		return "", fmt.Errorf("space %q does not exist", in.SpaceKey)
+	}
+	if in.ParentID != "" && s.byID[in.ParentID] == nil {
+		s.mu.Unlock()
+		return "", fmt.Errorf("parent %s: %w", in.ParentID, errNotFound)
+	}
+	if in.Title == "" {
+		s.mu.Unlock()
+		return "", errors.New("title is required")
+	}
+
+	p := &page{
+		Page: Page{
+			ID:       strconv.Itoa(s.nextID),
+			ParentID: in.ParentID,
+			Title:    in.Title,
+			Labels:   append([]string{}, in.Labels...),
+			Versions: []Version{{Number: 1, When: time.Now().UTC(), By: s.author(in.By), Message: in.Message, Body: in.Body}},
+		},
+		spaceKey: in.SpaceKey,
+	}
+	s.nextID++
+	s.pages = append(s.pages, p)
+	s.byID[p.ID] = p
+	s.reindex()
+	e := s.newEvent(EventPageCreated, p, "")
+	s.mu.Unlock()
+
+	s.fire(e)
+	return p.ID, nil
+}
+
+// UpdatePage saves a new version of a page and fires page_updated
+func (s *Server) UpdatePage(id string, in PageInput) (version int, err error) {
+	s.mu.Lock()
+	p, ok := s.byID[id]
+	if !ok {
+		s.mu.Unlock()
+		return 0, fmt.Errorf("page %s: %w", id, errNotFound)
+	}
+
+	v := *p.current()
+	v.Number++
+	v.When = time.Now().UTC()
+	v.By = s.author(in.By)
+	v.Message = in.Message
+	if in.Body != "" {
+		v.Body = in.Body
+	}
+	if in.Title != "" {
+		p.Title = in.Title
+	}
+	p.Versions = append(p.Versions, v)
+	e := s.newEvent(EventPageUpdated, p, "")
+	s.mu.Unlock()
+
+	s.fire(e)
+	return v.Number, nil
+}
+
+// DeletePage moves a page to the trash and fires page_removed. Its children
+// move up to its parent.
+func (s *Server) DeletePage(id string) error {
+	s.mu.Lock()
+	p, ok := s.byID[id]
+	if !ok {
+		s.mu.Unlock()
+		return fmt.Errorf("page %s: %w", id, errNotFound)
+	}
+	e := s.newEvent(EventPageRemoved, p, "")
+
+	delete(s.byID, id)
+	s.trash[id] = p
+	for i, other := range s.pages {
+		if other == p {
+			s.pages = append(s.pages[:i], s.pages[i+1:]...)
+			break
+		}
+	}
+	for _, other := range s.pages {
+		if other.ParentID == id {
+			other.ParentID = p.ParentID
+		}
+	}
+	s.reindex()
+	s.mu.Unlock()
+
+	s.fire(e)
+	return nil
+}
+
+// MoveInput is where to move a page. An empty SpaceKey keeps its space; an
+// empty ParentID makes it a top-level page.
+type MoveInput struct {
+	SpaceKey string `json:"space_key"`
+	ParentID string `json:"parent_id"`
+}
+
+// MovePage moves a page, with its descendants, under another parent or into
+// another space and fires page_moved. The payload's oldSpaceKey names the
+// space it left.
+func (s *Server) MovePage(id string, in MoveInput) error {
+	s.mu.Lock()
+	p, ok := s.byID[id]
+	if !ok {
+		s.mu.Unlock()
+		return fmt.Errorf("page %s: %w", id, errNotFound)
+	}
+	spaceKey := in.SpaceKey
+	if spaceKey == "" {
+		spaceKey = p.spaceKey
+	}
+	if !s.hasSpace(spaceKey) {
+		s.mu.Unlock()
+		return fmt.Errorf("space %q does not exist", spaceKey)
+	}
+	if in.ParentID != "" {
+		parent, ok := s.byID[in.ParentID]
+		if !ok {
+			s.mu.Unlock()
+			return fmt.Errorf("parent %s: %w", in.ParentID, errNotFound)
+		}
+		if parent == p || slices.Contains(parent.ancestors, id) {
+			s.mu.Unlock()
+			return errors.New("a page can't be moved under itself")
+		}
+		if parent.spaceKey != spaceKey {
+			s.mu.Unlock()
+			return fmt.Errorf("parent %s is not in space %s", in.ParentID, spaceKey)
+		}
+	}
+
+	oldSpaceKey := p.spaceKey
+	p.ParentID = in.ParentID
+	p.spaceKey = spaceKey
+	for _, other := range s.pages {
+		if slices.Contains(other.ancestors, id) {
+			other.spaceKey = spaceKey
+		}
+	}
+	s.reindex()
+	e := s.newEvent(EventPageMoved, p, "")
+	e.payload["oldSpaceKey"] = oldSpaceKey
+	s.mu.Unlock()
+
+	s.fire(e)
+	return nil
+}
+
+// RestorePage brings a deleted page back from the trash and fires
+// page_restored. It becomes a top-level page if its parent is gone.
+func (s *Server) RestorePage(id string) error {
+	s.mu.Lock()
+	p, ok := s.trash[id]
+	if !ok {
+		s.mu.Unlock()
+		return fmt.Errorf("deleted page %s: %w", id, errNotFound)
+	}
+	delete(s.trash, id)
+	if s.byID[p.ParentID] == nil {
+		p.ParentID = ""
+	}
+	s.pages = append(s.pages, p)
+	s.byID[id] = p
+	s.reindex()
+	e := s.newEvent(EventPageRestored, p, "")
+	s.mu.Unlock()
+
+	s.fire(e)
+	return nil
+}
+
+// AddLabel labels a page and fires label_added; adding an existing label
+// does nothing
+func (s *Server) AddLabel(id, name string) error {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		return errors.New("label name is required")
+	}
+
+	s.mu.Lock()
+	p, ok := s.byID[id]
+	if !ok {
+		s.mu.Unlock()
+		return fmt.Errorf("page %s: %w", id, errNotFound)
+	}
+	if hasKeyword(p.Labels, name) {
+		s.mu.Unlock()
+		return nil
+	}
+	p.Labels = append(p.Labels, name)
+	e := s.newEvent(EventLabelAdded, p, name)
+	s.mu.Unlock()
+
+	s.fire(e)
+	return nil
+}
+
+// RemoveLabel removes a label from a page and fires label_removed
+func (s *Server) RemoveLabel(id, name string) error {
+	s.mu.Lock()
+	p, ok := s.byID[id]
+	if !ok {
+		s.mu.Unlock()
+		return fmt.Errorf("page %s: %w", id, errNotFound)
+	}
+	for i, l := range p.Labels {
+		if strings.EqualFold(l, name) {
+			p.Labels = append(p.Labels[:i], p.Labels[i+1:]...)
+			e := s.newEvent(EventLabelRemoved, p, l)
+			s.mu.Unlock()
+			s.fire(e)
+			return nil
+		}
+	}
+	s.mu.Unlock()
+	return fmt.Errorf("label %q on page %s: %w", name, id, errNotFound)
+}
+
+func (s *Server) hasSpace(key string) bool {
+	for _, sp := range s.spaces {
+		if sp.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) author(by string) string {
+	if by != "" {
+		return by
+	}
+	return s.user.DisplayName
+}
+
+// faultsJSON is Faults on the wire, with durations such as "250ms"
+type faultsJSON struct {
+	Latency        string `json:"latency,omitempty"`
+	RejectAuth     bool   `json:"reject_auth"`
+	ServerErrors   int    `json:"server_errors"`
+	RateLimit      int    `json:"rate_limit"`
+	RateLimitEvery int    `json:"rate_limit_every"`
+	RetryAfter     string `json:"retry_after,omitempty"`
+}
+
+func (s *Server) getFaults(w http.ResponseWriter, r *http.Request) {
+	f := s.Faults()
+	out := faultsJSON{
+		RejectAuth:     f.RejectAuth,
+		ServerErrors:   f.ServerErrors,
+		RateLimit:      f.RateLimit,
+		RateLimitEvery: f.RateLimitEvery,
+	}
+	if f.Latency > 0 {
+		out.Latency = f.Latency.String()
+	}
+	if f.RetryAfter > 0 {
+		out.RetryAfter = f.RetryAfter.String()
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// putFaults replaces the injected faults; an empty object clears them
+func (s *Server) putFaults(w http.ResponseWriter, r *http.Request) {
+	var in faultsJSON
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	f := Faults{
+		RejectAuth:     in.RejectAuth,
+		ServerErrors:   in.ServerErrors,
+		RateLimit:      in.RateLimit,
+		RateLimitEvery: in.RateLimitEvery,
+	}
+	var err error
+	if in.Latency != "" {
+		if f.Latency, err = time.ParseDuration(in.Latency); err != nil {
+			writeError(w, http.StatusBadRequest, "latency: "+err.Error())
+			return
+		}
+	}
+	if in.RetryAfter != "" {
+		if f.RetryAfter, err = time.ParseDuration(in.RetryAfter); err != nil {
+			writeError(w, http.StatusBadRequest, "retry_after: "+err.Error())
+			return
+		}
+	}
+	s.SetFaults(f)
+	s.getFaults(w, r)
+}
+
+func (s *Server) postPage(w http.ResponseWriter, r *http.Request) {
+	var in PageInput
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	id, err := s.CreatePage(in)
+	if err != nil {
+		writeControlError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, map[string]interface{}{"id": id, "version": 1})
+}
+
+func (s *Server) putPage(w http.ResponseWriter, r *http.Request) {
+	var in PageInput
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	id := r.PathValue("id")
+	version, err := s.UpdatePage(id, in)
+	if err != nil {
+		writeControlError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"id": id, "version": version})
+}
+
+func (s *Server) removePage(w http.ResponseWriter, r *http.Request) {
+	if err := s.DeletePage(r.PathValue("id")); err != nil {
+		writeControlError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) postMove(w http.ResponseWriter, r *http.Request) {
+	var in MoveInput
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := s.MovePage(r.PathValue("id"), in); err != nil {
+		writeControlError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) postRestore(w http.ResponseWriter, r *http.Request) {
+	if err := s.RestorePage(r.PathValue("id")); err != nil {
+		writeControlError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) postLabel(w http.ResponseWriter, r *http.Request) {
+	var in struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := s.AddLabel(r.PathValue("id"), in.Name); err != nil {
+		writeControlError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) removeLabel(w http.ResponseWriter, r *http.Request) {
+	if err := s.RemoveLabel(r.PathValue("id"), r.PathValue("name")); err != nil {
+		writeControlError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) getDeliveries(w http.ResponseWriter, r *http.Request) {
+	deliveries := s.Deliveries()
+	if deliveries == nil {
+		deliveries = []Delivery{}
+	}
+	writeJSON(w, http.StatusOK, deliveries)
+}
+
+func writeControlError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errNotFound) {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	writeError(w, http.StatusBadRequest, err.Error())
+}
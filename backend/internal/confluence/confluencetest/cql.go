@@ -0,0 +1,548 @@
+package confluencetest
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// cqlQuery is a parsed CQL statement. The supported subset is:
+//
+//	field op value             op is =, !=, ~, !~, <, <=, > or >=
+//	field [NOT] IN (v1, v2)
+//	NOT, AND, OR and parentheses
+//	ORDER BY field [ASC|DESC], ...
+//
+// over the fields id, type, space (or space.key), title, text, label, parent,
+// ancestor, creator, contributor, created and lastmodified. creator and
+// contributor match the names versions are by. Dates are "yyyy-mm-dd", optionally with
+// " hh:mm", or now("-7d") with h, d, w, M or y offsets.
+type cqlQuery struct {
+	match func(*page) bool
+	order func([]*page)
+}
+
+func parseCQL(input string) (*cqlQuery, error) {
+	tokens, err := lexCQL(input)
+	if err != nil {
+		return nil, err
+	}
+	p := &cqlParser{tokens: tokens}
+	if len(tokens) == 0 || p.peekKeyword("order") {
+		return nil, fmt.Errorf("cql must have at least one clause")
+	}
+
+	match, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	q := &cqlQuery{match: match}
+	if p.peekKeyword("order") {
+		if q.order, err = p.parseOrderBy(); err != nil {
+			return nil, err
+		}
+	}
+	if !p.done() {
+		return nil, fmt.Errorf("unexpected %q", p.peek().text)
+	}
+	return q, nil
+}
+
+type tokenKind int
+
+const (
+	tokWord tokenKind = iota
+	tokString
+	tokOp
+	tokLParen
+	tokRParen
+	tokComma
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+func lexCQL(input string) ([]token, error) {
+	var tokens []token
+	runes := []rune(input)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, token{tokLParen, "("})
+			i++
+		case r == ')':
+			tokens = append(tokens, token{tokRParen, ")"})
+			i++
+		case r == ',':
+			tokens = append(tokens, token{tokComma, ","})
+			i++
+		case r == '"' || r == '\'':
+			var sb strings.Builder
+			j := i + 1
+			for ; j < len(runes) && runes[j] != r; j++ {
+				if runes[j] == '\\' && j+1 < len(runes) {
+					j++
+				}
+				sb.WriteRune(runes[j])
+			}
+			if j >= len(runes) {
+				return nil, fmt.Errorf("unterminated string at position %d", i)
+			}
+			tokens = append(tokens, token{tokString, sb.String()})
+			i = j + 1
+		case strings.ContainsRune("=!~<>", r):
+			op := string(r)
+			if i+1 < len(runes) && (runes[i+1] == '=' || (r == '!' && runes[i+1] == '~')) {
+				op += string(runes[i+1])
+			}
+			if op == "!" {
+				return nil, fmt.Errorf("unexpected '!' at position %d", i)
+			}
+			tokens = append(tokens, token{tokOp, op})
+			i += len(op)
+		default:
+			j := i
+			for j < len(runes) && !unicode.IsSpace(runes[j]) && !strings.ContainsRune("()=!~<>,\"'", runes[j]) {
+				j++
+			}
+			tokens = append(tokens, token{tokWord, string(runes[i:j])})
+			i = j
+		}
+	}
+	return tokens, nil
+}
+
+type cqlParser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *cqlParser) done() bool { return p.pos >= len(p.tokens) }
+
+func (p *cqlParser) peek() token {
+	if p.done() {
+		return token{kind: -1}
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *cqlParser) next() token {
+	t := p.peek()
+	p.pos++
+	return t
+}
+
+func (p *cqlParser) peekKeyword(kw string) bool {
+	t := p.peek()
+	return t.kind == tokWord && strings.EqualFold(t.text, kw)
+}
+
+func (p *cqlParser) expect(kind tokenKind, what string) (token, error) {
+	t := p.next()
+	if t.kind != kind {
+		if t.kind == -1 {
+			return t, fmt.Errorf("expected %s at end of query", what)
+		}
+		return t, fmt.Errorf("expected %s, got %q", what, t.text)
+	}
+	return t, nil
+}
+
+func (p *cqlParser) parseOr() (func(*page) bool, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peekKeyword("or") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(pg *page) bool { return l(pg) || right(pg) }
+	}
+	return left, nil
+}
+
+func (p *cqlParser) parseAnd() (func(*page) bool, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.peekKeyword("and") {
+		p.next()
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(pg *page) bool { return l(pg) && right(pg) }
+	}
+	return left, nil
+}
+
+func (p *cqlParser) parseNot() (func(*page) bool, error) {
+	if p.peekKeyword("not") {
+		p.next()
+		inner, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return func(pg *page) bool { return !inner(pg) }, nil
+	}
+	if p.peek().kind == tokLParen {
+		p.next()
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(tokRParen, "')'"); err != nil {
+			return nil, err
+		}
+		return inner, nil
+	}
+	return p.parseClause()
+}
+
+func (p *cqlParser) parseClause() (func(*page) bool, error) {
+	field, err := p.expect(tokWord, "a field")
+	if err != nil {
+		return nil, err
+	}
+	name := strings.ToLower(field.text)
+
+	if p.peekKeyword("in") || p.peekKeyword("not") {
+		negate := p.peekKeyword("not")
+		p.next()
+		if negate {
+			if !p.peekKeyword("in") {
+				return nil, fmt.Errorf("expected IN after NOT")
+			}
+			p.next()
+		}
+		values, err := p.parseList()
+		if err != nil {
+			return nil, err
+		}
+		get, err := keywordField(name)
+		if err != nil {
+			return nil, err
+		}
+		return func(pg *page) bool {
+			found := false
+			for _, v := range values {
+				if hasKeyword(get(pg), v) {
+					found = true
+					break
+				}
+			}
+			return found != negate
+		}, nil
+	}
+
+	op, err := p.expect(tokOp, "an operator")
+	if err != nil {
+		return nil, err
+	}
+	value, err := p.parseValue()
+	if err != nil {
+		return nil, err
+	}
+	return clause(name, op.text, value)
+}
+
+func (p *cqlParser) parseList() ([]string, error) {
+	if _, err := p.expect(tokLParen, "'('"); err != nil {
+		return nil, err
+	}
+	var values []string
+	for {
+		v, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+		if p.peek().kind == tokComma {
+			p.next()
+			continue
+		}
+		if _, err := p.expect(tokRParen, "')'"); err != nil {
+			return nil, err
+		}
+		return values, nil
+	}
+}
+
+// parseValue reads a string, a bare word or a now("...") call, which is
+// returned as its resolved timestamp
+func (p *cqlParser) parseValue() (string, error) {
+	t := p.next()
+	switch t.kind {
+	case tokString:
+		return t.text, nil
+	case tokWord:
+		if strings.EqualFold(t.text, "now") && p.peek().kind == tokLParen {
+			p.next()
+			offset := ""
+			if p.peek().kind == tokString {
+				offset = p.next().text
+			}
+			if _, err := p.expect(tokRParen, "')'"); err != nil {
+				return "", err
+			}
+			ts, err := nowOffset(offset, time.Now())
+			if err != nil {
+				return "", err
+			}
+			return ts.Format(time.RFC3339), nil
+		}
+		return t.text, nil
+	case -1:
+		return "", fmt.Errorf("expected a value at end of query")
+	}
+	return "", fmt.Errorf("expected a value, got %q", t.text)
+}
+
+func (p *cqlParser) parseOrderBy() (func([]*page), error) {
+	p.next()
+	if !p.peekKeyword("by") {
+		return nil, fmt.Errorf("expected BY after ORDER")
+	}
+	p.next()
+
+	type key struct {
+		less func(a, b *page) bool
+		desc bool
+	}
+	var keys []key
+	for {
+		field, err := p.expect(tokWord, "a field to order by")
+		if err != nil {
+			return nil, err
+		}
+		less, err := orderField(strings.ToLower(field.text))
+		if err != nil {
+			return nil, err
+		}
+		k := key{less: less}
+		if p.peekKeyword("desc") {
+			p.next()
+			k.desc = true
+		} else if p.peekKeyword("asc") {
+			p.next()
+		}
+		keys = append(keys, k)
+		if p.peek().kind != tokComma {
+			break
+		}
+		p.next()
+	}
+
+	return func(pages []*page) {
+		sort.SliceStable(pages, func(i, j int) bool {
+			for _, k := range keys {
+				a, b := pages[i], pages[j]
+				if k.desc {
+					a, b = b, a
+				}
+				if k.less(a, b) {
+					return true
+				}
+				if k.less(b, a) {
+					return false
+				}
+			}
+			return false
+		})
+	}, nil
+}
+
+func clause(field, op, value string) (func(*page) bool, error) {
+	switch field {
+	case "title", "text":
+		get := func(pg *page) string { return pg.Title }
+		if field == "text" {
+			get = func(pg *page) string { return pg.Title + " " + plainText(pg.current().Body) }
+		}
+		switch {
+		case op == "~" || op == "!~":
+			negate := op == "!~"
+			return func(pg *page) bool { return containsWords(get(pg), value) != negate }, nil
+		case field == "title" && (op == "=" || op == "!="):
+			negate := op == "!="
+			return func(pg *page) bool { return strings.EqualFold(pg.Title, value) != negate }, nil
+		}
+	case "created", "lastmodified":
+		at, dayOnly, err := parseCQLTime(value)
+		if err != nil {
+			return nil, err
+		}
+		get := func(pg *page) time.Time { return pg.current().When }
+		if field == "created" {
+			get = func(pg *page) time.Time { return pg.Versions[0].When }
+		}
+		cmp := func(t time.Time) int {
+			if dayOnly {
+				t = t.UTC().Truncate(24 * time.Hour)
+			}
+			return t.Compare(at)
+		}
+		switch op {
+		case "=":
+			return func(pg *page) bool { return cmp(get(pg)) == 0 }, nil
+		case "!=":
+			return func(pg *page) bool { return cmp(get(pg)) != 0 }, nil
+		case "<":
+			return func(pg *page) bool { return cmp(get(pg)) < 0 }, nil
+		case "<=":
+			return func(pg *page) bool { return cmp(get(pg)) <= 0 }, nil
+		case ">":
+			return func(pg *page) bool { return cmp(get(pg)) > 0 }, nil
+		case ">=":
+			return func(pg *page) bool { return cmp(get(pg)) >= 0 }, nil
+		}
+	default:
+		get, err := keywordField(field)
+		if err != nil {
+			return nil, err
+		}
+		switch op {
+		case "=":
+			return func(pg *page) bool { return hasKeyword(get(pg), value) }, nil
+		case "!=":
+			return func(pg *page) bool { return !hasKeyword(get(pg), value) }, nil
+		}
+	}
+	return nil, fmt.Errorf("operator %s is not supported for field %s", op, field)
+}
+
+// keywordField returns the values of a field matched exactly, ignoring case
+func keywordField(field string) (func(*page) []string, error) {
+	switch field {
+	case "id":
+		return func(pg *page) []string { return []string{pg.ID} }, nil
+	case "type":
+		return func(*page) []string { return []string{"page"} }, nil
+	case "space", "space.key":
+		return func(pg *page) []string { return []string{pg.spaceKey} }, nil
+	case "label":
+		return func(pg *page) []string { return pg.Labels }, nil
+	case "parent":
+		return func(pg *page) []string { return []string{pg.ParentID} }, nil
+	case "ancestor":
+		return func(pg *page) []string { return pg.ancestors }, nil
+	case "creator":
+		return func(pg *page) []string { return []string{pg.Versions[0].By} }, nil
+	case "contributor":
+		return func(pg *page) []string {
+			by := make([]string, len(pg.Versions))
+			for i, v := range pg.Versions {
+				by[i] = v.By
+			}
+			return by
+		}, nil
+	}
+	return nil, fmt.Errorf("field %s is not supported", field)
+}
+
+func hasKeyword(values []string, want string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, want) {
+			return true
+		}
+	}
+	return false
+}
+
+func orderField(field string) (func(a, b *page) bool, error) {
+	switch field {
+	case "title":
+		return func(a, b *page) bool { return strings.ToLower(a.Title) < strings.ToLower(b.Title) }, nil
+	case "id":
+		return func(a, b *page) bool {
+			x, _ := strconv.Atoi(a.ID)
+			y, _ := strconv.Atoi(b.ID)
+			return x < y
+		}, nil
+	case "created":
+		return func(a, b *page) bool { return a.Versions[0].When.Before(b.Versions[0].When) }, nil
+	case "lastmodified":
+		return func(a, b *page) bool { return a.current().When.Before(b.current().When) }, nil
+	}
+	return nil, fmt.Errorf("cannot order by %s", field)
+}
+
+// containsWords reports whether every word of query appears in text,
+// ignoring case. Wildcards are accepted and ignored, so "deploy*" matches
+// "deploying".
+func containsWords(text, query string) bool {
+	text = strings.ToLower(text)
+	words := strings.Fields(strings.ToLower(strings.ReplaceAll(query, "*", " ")))
+	for _, w := range words {
+		if !strings.Contains(text, w) {
+			return false
+		}
+	}
+	return len(words) > 0
+}
+
+var tagPattern = regexp.MustCompile(`<[^>]*>`)
+
+// plainText strips tags from storage-format XHTML
+func plainText(body string) string {
+	return html.UnescapeString(tagPattern.ReplaceAllString(body, " "))
+}
+
+// parseCQLTime reads a CQL date; dayOnly is true when it has no time of day
+func parseCQLTime(value string) (t time.Time, dayOnly bool, err error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, false, nil
+	}
+	normalized := strings.ReplaceAll(value, "/", "-")
+	if t, err := time.Parse("2006-01-02 15:04", normalized); err == nil {
+		return t, false, nil
+	}
+	if t, err := time.Parse("2006-01-02", normalized); err == nil {
+		return t, true, nil
+	}
+	return time.Time{}, false, fmt.Errorf("invalid date %q", value)
+}
+
+// nowOffset resolves the argument of now(), such as "-4w" or "+1d"
+func nowOffset(offset string, now time.Time) (time.Time, error) {
+	offset = strings.TrimSpace(offset)
+	if offset == "" {
+		return now, nil
+	}
+	unit := offset[len(offset)-1]
+	n, err := strconv.Atoi(strings.TrimPrefix(offset[:len(offset)-1], "+"))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid now() offset %q", offset)
+	}
+	switch unit {
+	case 'm':
+		return now.Add(time.Duration(n) * time.Minute), nil
+	case 'h':
+		return now.Add(time.Duration(n) * time.Hour), nil
+	case 'd':
+		return now.AddDate(0, 0, n), nil
+	case 'w':
+		return now.AddDate(0, 0, 7*n), nil
+	case 'M':
+		return now.AddDate(0, n, 0), nil
+	case 'y':
+		return now.AddDate(n, 0, 0), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid now() offset %q", offset)
+}
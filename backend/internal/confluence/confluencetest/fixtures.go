@@ -0,0 +1,139 @@
+package confluencetest
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Fixtures is the content a Server starts with
+type Fixtures struct {
+	User   User
+	Spaces []Space
+}
+
+// User is the account every authenticated request acts as. Cloud sites
+// identify it by AccountID, Data Center sites by Username, which defaults to
+// the part of Email before the @.
+type User struct {
+	AccountID   string `json:"account_id"`
+	Username    string `json:"username"`
+	Email       string `json:"email"`
+	DisplayName string `json:"display_name"`
+}
+
+type Space struct {
+	Key   string `json:"key"`
+	Name  string `json:"name"`
+	Pages []Page `json:"pages"`
+}
+
+// Page is a page and its full history; the last version is the current one
+type Page struct {
+	ID       string    `json:"id"`
+	ParentID string    `json:"parent_id,omitempty"`
+	Title    string    `json:"title"`
+	Labels   []string  `json:"labels"`
+	Versions []Version `json:"versions"`
+}
+
+type Version struct {
+	Number  int       `json:"number"`
+	When    time.Time `json:"when"`
+	By      string    `json:"by"`
+	Message string    `json:"message"`
+	// Body is the page in Confluence storage format (XHTML)
+	Body string `json:"body"`
+}
+
+//go:embed fixtures/*.json
+var defaultFixtures embed.FS
+
+// DefaultFixtures is a small demo site with an ENG and an OPS space
+func DefaultFixtures() (*Fixtures, error) {
+	sub, err := fs.Sub(defaultFixtures, "fixtures")
+	if err != nil {
+		return nil, err
+	}
+	return LoadFixtures(sub)
+}
+
+// LoadFixtures reads the *.json files at the top of fsys. site.json holds the
+// current user; every other file is one space. Spaces are ordered by file name
+// and pages keep their order within the file.
+func LoadFixtures(fsys fs.FS) (*Fixtures, error) {
+	names, err := fs.Glob(fsys, "*.json")
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+
+	f := &Fixtures{}
+	for _, name := range names {
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+		if name == "site.json" {
+			var site struct {
+				User User `json:"user"`
+			}
+			if err := json.Unmarshal(data, &site); err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+			f.User = site.User
+			continue
+		}
+		var space Space
+		if err := json.Unmarshal(data, &space); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		if space.Key == "" {
+			return nil, fmt.Errorf("%s: space key is required", name)
+		}
+		f.Spaces = append(f.Spaces, space)
+	}
+
+	if f.User.AccountID == "" {
+		f.User = User{AccountID: "fake-account", Email: "fake@example.com", DisplayName: "Fake User"}
+	}
+	if f.User.Username == "" {
+		f.User.Username, _, _ = strings.Cut(f.User.Email, "@")
+	}
+	if err := f.validate(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *Fixtures) validate() error {
+	ids := make(map[string]bool)
+	for _, space := range f.Spaces {
+		for _, p := range space.Pages {
+			if p.ID == "" || ids[p.ID] {
+				return fmt.Errorf("space %s: page IDs must be unique and non-empty, got %q", space.Key, p.ID)
+			}
+			ids[p.ID] = true
+			if len(p.Versions) == 0 {
+				return fmt.Errorf("page %s: at least one version is required", p.ID)
+			}
+			for i, v := range p.Versions {
+				if v.Number != i+1 {
+					return fmt.Errorf("page %s: versions must be numbered 1, 2, … in order", p.ID)
+				}
+			}
+		}
+	}
+	for _, space := range f.Spaces {
+		for _, p := range space.Pages {
+			if p.ParentID != "" && !ids[p.ParentID] {
+				return fmt.Errorf("page %s: parent %s does not exist", p.ID, p.ParentID)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,233 @@
+package confluencetest
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// CloudID is the site's cloudid on the OAuth gateway
+const CloudID = "f4ce0000-c0f1-4e4c-9000-000000000001"
+
+// gatewayPrefix is where the API is served for OAuth access tokens, as on
+// api.atlassian.com
+const gatewayPrefix = "/ex/confluence/{cloudid}/wiki"
+
+const defaultTokenTTL = time.Hour
+
+// oauthCode is an authorization code waiting to be exchanged
+type oauthCode struct {
+	redirectURI string
+	scope       string
+	expires     time.Time
+}
+
+// grant is the scope and expiry behind an issued token
+type grant struct {
+	scope   string
+	expires time.Time
+}
+
+func (s *Server) oauthEnabled() bool {
+	return s.opts.OAuthClientID != "" && !s.opts.DataCenter
+}
+
+func (s *Server) tokenTTL() time.Duration {
+	if s.opts.OAuthTokenTTL > 0 {
+		return s.opts.OAuthTokenTTL
+	}
+	return defaultTokenTTL
+}
+
+// authorize stands in for Atlassian's consent screen and approves at once,
+// redirecting back with a code
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("client_id") != s.opts.OAuthClientID {
+		http.Error(w, "unknown client_id", http.StatusBadRequest)
+		return
+	}
+	if q.Get("response_type") != "code" {
+		http.Error(w, "response_type must be code", http.StatusBadRequest)
+		return
+	}
+	redirect, err := url.Parse(q.Get("redirect_uri"))
+	if err != nil || redirect.Host == "" {
+		http.Error(w, "redirect_uri is required", http.StatusBadRequest)
+		return
+	}
+
+	back := redirect.Query()
+	if q.Get("deny") != "" {
+		back.Set("error", "access_denied")
+		back.Set("error_description", "The user denied access")
+	} else {
+		code := randomToken("code")
+		s.mu.Lock()
+		s.codes[code] = oauthCode{redirectURI: redirect.String(), scope: q.Get("scope"), expires: time.Now().Add(time.Minute)}
+		s.mu.Unlock()
+		back.Set("code", code)
+	}
+	back.Set("state", q.Get("state"))
+	redirect.RawQuery = back.Encode()
+	s.logger.Info("oauth authorize", "redirect_uri", redirect.Scheme+"://"+redirect.Host+redirect.Path)
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+// token issues tokens for the authorization_code and refresh_token grants.
+// Refresh tokens are single use, as on Atlassian.
+func (s *Server) token(w http.ResponseWriter, r *http.Request) {
+	var in struct {
+		GrantType    string `json:"grant_type"`
+		ClientID     string `json:"client_id"`
+		ClientSecret string `json:"client_secret"`
+		Code         string `json:"code"`
+		RedirectURI  string `json:"redirect_uri"`
+		RefreshToken string `json:"refresh_token"`
+	}
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+			writeOAuthError(w, http.StatusBadRequest, "invalid_request", err.Error())
+			return
+		}
+	} else {
+		r.ParseForm()
+		in.GrantType = r.PostForm.Get("grant_type")
+		in.ClientID = r.PostForm.Get("client_id")
+		in.ClientSecret = r.PostForm.Get("client_secret")
+		in.Code = r.PostForm.Get("code")
+		in.RedirectURI = r.PostForm.Get("redirect_uri")
+		in.RefreshToken = r.PostForm.Get("refresh_token")
+	}
+
+	if subtle.ConstantTimeCompare([]byte(in.ClientID), []byte(s.opts.OAuthClientID)) != 1 ||
+		subtle.ConstantTimeCompare([]byte(in.ClientSecret), []byte(s.opts.OAuthClientSecret)) != 1 {
+		writeOAuthError(w, http.StatusUnauthorized, "access_denied", "Unauthorized")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var scope string
+	switch in.GrantType {
+	case "authorization_code":
+		code, ok := s.codes[in.Code]
+		delete(s.codes, in.Code)
+		if !ok || time.Now().After(code.expires) {
+			writeOAuthError(w, http.StatusForbidden, "invalid_grant", "Invalid authorization code")
+			return
+		}
+		if in.RedirectURI != code.redirectURI {
+			writeOAuthError(w, http.StatusForbidden, "invalid_grant", "redirect_uri does not match")
+			return
+		}
+		scope = code.scope
+	case "refresh_token":
+		g, ok := s.refreshTokens[in.RefreshToken]
+		delete(s.refreshTokens, in.RefreshToken)
+		if !ok {
+			writeOAuthError(w, http.StatusForbidden, "invalid_grant", "Unknown or invalid refresh token.")
+			return
+		}
+		scope = g.scope
+	default:
+		writeOAuthError(w, http.StatusBadRequest, "unsupported_grant_type", in.GrantType)
+		return
+	}
+
+	ttl := s.tokenTTL()
+	access := randomToken("at")
+	s.accessTokens[access] = grant{scope: scope, expires: time.Now().Add(ttl)}
+	out := map[string]interface{}{
+		"access_token": access,
+		"token_type":   "Bearer",
+		"expires_in":   int(ttl / time.Second),
+		"scope":        scope,
+	}
+	if hasKeyword(strings.Fields(scope), "offline_access") {
+		refresh := randomToken("rt")
+		s.refreshTokens[refresh] = grant{scope: scope}
+		out["refresh_token"] = refresh
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// accessibleResources lists the one site every token can reach
+func (s *Server) accessibleResources(w http.ResponseWriter, r *http.Request) {
+	g, ok := s.accessGrant(r)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	writeJSON(w, http.StatusOK, []map[string]interface{}{{
+		"id":        CloudID,
+		"url":       scheme + "://" + r.Host,
+		"name":      "fake",
+		"scopes":    strings.Fields(g.scope),
+		"avatarUrl": "",
+	}})
+}
+
+// accessGrant returns the grant behind the request's bearer access token,
+// if it is one this server issued and it hasn't expired
+func (s *Server) accessGrant(r *http.Request) (grant, bool) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return grant{}, false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	g, ok := s.accessTokens[token]
+	if !ok || time.Now().After(g.expires) {
+		return grant{}, false
+	}
+	return g, true
+}
+
+// ExpireTokens expires every access token, so the next call must refresh
+func (s *Server) ExpireTokens() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for token, g := range s.accessTokens {
+		g.expires = time.Now()
+		s.accessTokens[token] = g
+	}
+}
+
+// RevokeTokens drops every access and refresh token, as when a user revokes
+// the app's access
+func (s *Server) RevokeTokens() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.accessTokens = make(map[string]grant)
+	s.refreshTokens = make(map[string]grant)
+}
+
+func (s *Server) postExpireTokens(w http.ResponseWriter, r *http.Request) {
+	s.ExpireTokens()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) postRevokeTokens(w http.ResponseWriter, r *http.Request) {
+	s.RevokeTokens()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeOAuthError(w http.ResponseWriter, status int, code, description string) {
+	writeJSON(w, status, map[string]string{"error": code, "error_description": description})
+}
+
+func randomToken(kind string) string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return "fake-" + kind + "-" + hex.EncodeToString(b)
+}
@@ -0,0 +1,416 @@
+// Package confluencetest is a fake Confluence Cloud or Data Center site implementing the
+// subset of the REST API UpDoc uses: the current user, content listing with
+// paging, spaces, versions, labels, footer comments and CQL search, plus
+// webhooks. Content comes from fixture files and can be changed while the
+// server runs, which fires the registered webhooks. Auth failures, 429s,
+// 5xxs and latency can be injected to exercise the client's retries and
+// circuit breaker.
+//
+// A Data Center site (Options.DataCenter) serves the API without the /wiki
+// context path, accepts personal access tokens as bearer tokens and returns
+// users and links the way Data Center does. A Cloud site can also stand in
+// for Atlassian's OAuth 2.0 (3LO) authorization server and API gateway
+// (Options.OAuthClientID), approving every authorization at once.
+//
+// Use NewServer in Go code, like httptest.NewServer, or run
+// cmd/fakeconfluence for demos. The /_fake/ routes control the server and
+// need no credentials.
+package confluencetest
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ContextPath prefixes every API route on Cloud sites, as on Atlassian Cloud.
+// Data Center sites have none.
+const ContextPath = "/wiki"
+
+type Options struct {
+	// Fixtures is the initial content; nil loads DefaultFixtures
+	Fixtures *Fixtures
+	// DataCenter serves a Data Center site instead of a Cloud one
+	DataCenter bool
+	// Email and Token are the basic auth credentials accepted; on Data Center
+	// the fixture user's username replaces Email, and Token is also accepted
+	// alone as a bearer personal access token. When Email and Token are both
+	// empty any credentials are accepted, but some must be sent.
+	Email string
+	Token string
+	// BaseURL is the site base URL used in webhook payloads, including the
+	// context path. NewServer sets it to the started server's URL.
+	BaseURL string
+	// Logger records requests and webhook deliveries; nil discards them
+	Logger *slog.Logger
+
+	// OAuthClientID and OAuthClientSecret enable the OAuth stub on a Cloud
+	// site: /authorize, /oauth/token, /oauth/token/accessible-resources and
+	// the API under /ex/confluence/{cloudid}/wiki for the access tokens it
+	// issues. Point the Atlassian auth and API URLs at the server's root.
+	OAuthClientID     string
+	OAuthClientSecret string
+	// OAuthTokenTTL is how long access tokens last; 0 means an hour
+	OAuthTokenTTL time.Duration
+}
+
+// Faults make API requests fail or slow down. They apply to API routes only,
+// checked in field order.
+type Faults struct {
+	// Latency delays every request
+	Latency time.Duration
+	// RejectAuth fails every request with 401
+	RejectAuth bool
+	// ServerErrors fails the next N requests with 503
+	ServerErrors int
+	// RateLimit fails the next N requests with 429
+	RateLimit int
+	// RateLimitEvery fails every Nth request with 429
+	RateLimitEvery int
+	// RetryAfter is sent with 429s; 0 omits the header
+	RetryAfter time.Duration
+}
+
+// Server is the fake site. It is an http.Handler, so it can be mounted on any
+// listener; NewServer also starts one.
+type Server struct {
+	opts   Options
+	logger *slog.Logger
+	mux    *http.ServeMux
+	ts     *httptest.Server
+
+	mu         sync.Mutex
+	user       User
+	spaces     []Space // metadata only; pages live in pages
+	pages      []*page
+	byID       map[string]*page
+	trash      map[string]*page // deleted pages, by ID, until restored
+	comments   []*Comment
+	nextID     int
+	faults     Faults
+	requests   int
+	webhooks   []*Webhook
+	deliveries []Delivery
+
+	codes         map[string]oauthCode
+	accessTokens  map[string]grant
+	refreshTokens map[string]grant
+}
+
+// page is a fixture page together with the space it belongs to
+type page struct {
+	Page
+	spaceKey string
+	// ancestors are the IDs of the page's parent, grandparent and so on
+	ancestors []string
+}
+
+func (p *page) current() *Version { return &p.Versions[len(p.Versions)-1] }
+
+// New builds a server without starting a listener
+func New(opts Options) (*Server, error) {
+	if opts.Fixtures == nil {
+		f, err := DefaultFixtures()
+		if err != nil {
+			return nil, err
+		}
+		opts.Fixtures = f
+	}
+	logger := opts.Logger
+	if logger == nil {
+		logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	}
+
+	s := &Server{
+		opts:   opts,
+		logger: logger,
+		user:   opts.Fixtures.User,
+		byID:   make(map[string]*page),
+		trash:  make(map[string]*page),
+		nextID: 1000,
+
+		codes:         make(map[string]oauthCode),
+		accessTokens:  make(map[string]grant),
+		refreshTokens: make(map[string]grant),
+	}
+	for _, space := range opts.Fixtures.Spaces {
+		s.spaces = append(s.spaces, Space{Key: space.Key, Name: space.Name})
+		for _, fp := range space.Pages {
+			p := &page{Page: fp, spaceKey: space.Key}
+			p.Labels = append([]string(nil), fp.Labels...)
+			p.Versions = append([]Version(nil), fp.Versions...)
+			s.pages = append(s.pages, p)
+			s.byID[p.ID] = p
+			if n, err := strconv.Atoi(p.ID); err == nil && n >= s.nextID {
+				s.nextID = n + 1
+			}
+		}
+	}
+	s.reindex()
+	s.routes()
+	return s, nil
+}
+
+// reindex recomputes every page's ancestors after the tree changes. The
+// caller must hold s.mu, or have sole access to s.
+func (s *Server) reindex() {
+	for _, p := range s.pages {
+		p.ancestors = nil
+		seen := map[string]bool{p.ID: true}
+		for id := p.ParentID; id != "" && !seen[id]; {
+			seen[id] = true
+			p.ancestors = append(p.ancestors, id)
+			parent, ok := s.byID[id]
+			if !ok {
+				break
+			}
+			id = parent.ParentID
+		}
+	}
+}
+
+// NewServer starts a server on a local port. Close it when done.
+func NewServer(opts Options) (*Server, error) {
+	s, err := New(opts)
+	if err != nil {
+		return nil, err
+	}
+	s.ts = httptest.NewServer(s)
+	if s.opts.BaseURL == "" {
+		s.opts.BaseURL = s.URL()
+	}
+	return s, nil
+}
+
+// URL is the site base URL to configure in UpDoc, including the context
+// path. It is empty unless the server was started with NewServer.
+func (s *Server) URL() string {
+	if s.ts == nil {
+		return ""
+	}
+	return s.ts.URL + s.contextPath()
+}
+
+// contextPath is ContextPath on Cloud and empty on Data Center
+func (s *Server) contextPath() string {
+	if s.opts.DataCenter {
+		return ""
+	}
+	return ContextPath
+}
+
+// Close stops a server started with NewServer
+func (s *Server) Close() {
+	if s.ts != nil {
+		s.ts.Close()
+	}
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// SetFaults replaces the injected faults and resets the request count used
+// by RateLimitEvery
+func (s *Server) SetFaults(f Faults) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = f
+	s.requests = 0
+}
+
+// Faults returns the injected faults, with ServerErrors and RateLimit reduced
+// by the requests they have already failed
+func (s *Server) Faults() Faults {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.faults
+}
+
+func (s *Server) routes() {
+	s.mux = http.NewServeMux()
+	api := func(pattern string, h http.HandlerFunc) {
+		method, p, _ := strings.Cut(pattern, " ")
+		s.mux.Handle(method+" "+s.contextPath()+p, s.apiMiddleware(h))
+		if s.oauthEnabled() {
+			s.mux.Handle(method+" "+gatewayPrefix+p, s.apiMiddleware(h))
+		}
+	}
+	api("GET /rest/api/user/current", s.currentUser)
+	api("GET /rest/api/space", s.listSpaces)
+	api("GET /rest/api/content", s.listContent)
+	api("GET /rest/api/content/search", s.searchContent)
+	api("POST /rest/api/content", s.createContent)
+	api("GET /rest/api/content/{id}", s.getContent)
+	api("PUT /rest/api/content/{id}", s.updateContent)
+	api("DELETE /rest/api/content/{id}", s.deleteContent)
+	api("GET /rest/api/content/{id}/version", s.listVersions)
+	api("GET /rest/api/content/{id}/label", s.listLabels)
+	api("POST /rest/api/content/{id}/label", s.addLabels)
+	api("DELETE /rest/api/content/{id}/label/{name}", s.deleteLabel)
+	api("GET /rest/api/content/{id}/child/comment", s.listComments)
+	api("GET /rest/api/content/{id}/child/page", s.listChildren)
+	api("GET /rest/api/webhooks", s.listWebhooks)
+	api("POST /rest/api/webhooks", s.createWebhook)
+	api("DELETE /rest/api/webhooks/{id}", s.deleteWebhook)
+
+	if s.oauthEnabled() {
+		s.mux.HandleFunc("GET /authorize", s.authorize)
+		s.mux.HandleFunc("POST /oauth/token", s.token)
+		s.mux.HandleFunc("GET /oauth/token/accessible-resources", s.accessibleResources)
+		s.mux.HandleFunc("POST /_fake/oauth/expire", s.postExpireTokens)
+		s.mux.HandleFunc("POST /_fake/oauth/revoke", s.postRevokeTokens)
+	}
+
+	s.mux.HandleFunc("GET /_fake/faults", s.getFaults)
+	s.mux.HandleFunc("PUT /_fake/faults", s.putFaults)
+	s.mux.HandleFunc("POST /_fake/pages", s.postPage)
+	s.mux.HandleFunc("PUT /_fake/pages/{id}", s.putPage)
+	s.mux.HandleFunc("DELETE /_fake/pages/{id}", s.removePage)
+	s.mux.HandleFunc("POST /_fake/pages/{id}/move", s.postMove)
+	s.mux.HandleFunc("POST /_fake/pages/{id}/restore", s.postRestore)
+	s.mux.HandleFunc("POST /_fake/pages/{id}/labels", s.postLabel)
+	s.mux.HandleFunc("DELETE /_fake/pages/{id}/labels/{name}", s.removeLabel)
+	s.mux.HandleFunc("GET /_fake/deliveries", s.getDeliveries)
+}
+
+// apiMiddleware applies injected faults and authentication, then logs the request
+func (s *Server) apiMiddleware(next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		if !s.opts.DataCenter {
+			rec.Header().Set("ATL-TraceId", strconv.FormatInt(time.Now().UnixNano(), 16))
+		}
+		start := time.Now()
+		defer func() {
+			s.logger.Info("request", "method", r.Method, "path", r.URL.Path, "query", r.URL.RawQuery,
+				"status", rec.status, "duration", time.Since(start))
+		}()
+
+		if id := r.PathValue("cloudid"); id != "" && id != CloudID {
+			writeError(rec, http.StatusNotFound, "Site not found")
+			return
+		}
+
+		f, status := s.nextFault()
+		if f.Latency > 0 {
+			select {
+			case <-time.After(f.Latency):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		switch status {
+		case http.StatusTooManyRequests:
+			if f.RetryAfter > 0 {
+				rec.Header().Set("Retry-After", strconv.Itoa(int((f.RetryAfter+time.Second-1)/time.Second)))
+			}
+			writeError(rec, status, "Rate limit exceeded")
+			return
+		case http.StatusServiceUnavailable:
+			writeError(rec, status, "Service unavailable")
+			return
+		case http.StatusUnauthorized:
+			writeError(rec, status, "Current user not permitted to use Confluence")
+			return
+		}
+
+		if !s.authorized(r) {
+			rec.Header().Set("WWW-Authenticate", `Basic realm="Confluence"`)
+			writeError(rec, http.StatusUnauthorized, "Current user not permitted to use Confluence")
+			return
+		}
+		if s.opts.DataCenter {
+			rec.Header().Set("X-AUSERNAME", s.user.Username)
+		}
+		next(rec, r)
+	})
+}
+
+// nextFault counts the request and returns the faults in effect and the
+// status to fail it with, or 0 to let it through
+func (s *Server) nextFault() (Faults, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests++
+	f := s.faults
+	switch {
+	case f.RejectAuth:
+		return f, http.StatusUnauthorized
+	case f.ServerErrors > 0:
+		s.faults.ServerErrors--
+		return f, http.StatusServiceUnavailable
+	case f.RateLimit > 0:
+		s.faults.RateLimit--
+		return f, http.StatusTooManyRequests
+	case f.RateLimitEvery > 0 && s.requests%f.RateLimitEvery == 0:
+		return f, http.StatusTooManyRequests
+	}
+	return f, 0
+}
+
+func (s *Server) authorized(r *http.Request) bool {
+	if r.PathValue("cloudid") != "" {
+		_, ok := s.accessGrant(r)
+		return ok
+	}
+	anyCreds := s.opts.Email == "" && s.opts.Token == ""
+	if s.opts.DataCenter {
+		if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+			return anyCreds || subtle.ConstantTimeCompare([]byte(bearer), []byte(s.opts.Token)) == 1
+		}
+	}
+	user, token, ok := r.BasicAuth()
+	if !ok {
+		return false
+	}
+	if anyCreds {
+		return true
+	}
+	want := s.opts.Email
+	if s.opts.DataCenter {
+		want = s.user.Username
+	}
+	return subtle.ConstantTimeCompare([]byte(user), []byte(want)) == 1 &&
+		subtle.ConstantTimeCompare([]byte(token), []byte(s.opts.Token)) == 1
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes the error body shape Confluence uses
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]interface{}{
+		"statusCode": status,
+		"message":    message,
+	})
+}
+
+// errNotFound is returned by mutations on a page that doesn't exist
+var errNotFound = errors.New("not found")
+
+func notFound(w http.ResponseWriter, id string) {
+	writeError(w, http.StatusNotFound, fmt.Sprintf("No content found with id: ContentId{id=%s}", id))
+}
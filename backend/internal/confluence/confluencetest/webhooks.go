@@ -0,0 +1,218 @@
+package confluencetest
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Webhook events fired when content changes
+const (
+	EventPageCreated  = "page_created"
+	EventPageUpdated  = "page_updated"
+	EventPageRemoved  = "page_removed"
+	EventPageMoved    = "page_moved"
+	EventPageRestored = "page_restored"
+	EventLabelAdded   = "label_added"
+	EventLabelRemoved = "label_removed"
+)
+
+var knownEvents = map[string]bool{
+	EventPageCreated:  true,
+	EventPageUpdated:  true,
+	EventPageRemoved:  true,
+	EventPageMoved:    true,
+	EventPageRestored: true,
+	EventLabelAdded:   true,
+	EventLabelRemoved: true,
+}
+
+// Webhook is a registered receiver. Deliveries are POSTed as JSON with the
+// event name in X-Event-Key, an ID unique to the event in
+// X-Atlassian-Webhook-Identifier and, when Secret is set, an HMAC-SHA256 of
+// the body in X-Hub-Signature as "sha256=<hex>".
+type Webhook struct {
+	ID     int      `json:"id"`
+	Name   string   `json:"name"`
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+	Active bool     `json:"active"`
+	Secret string   `json:"secret,omitempty"`
+}
+
+// Delivery records one attempt to send an event to a webhook
+type Delivery struct {
+	WebhookID int       `json:"webhook_id"`
+	Event     string    `json:"event"`
+	PageID    string    `json:"page_id"`
+	Status    int       `json:"status,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	At        time.Time `json:"at"`
+}
+
+// deliveryClient bounds each delivery so a stuck receiver can't stall the
+// change that fired it
+var deliveryClient = &http.Client{Timeout: 5 * time.Second}
+
+// Deliveries returns every delivery attempted so far, oldest first
+func (s *Server) Deliveries() []Delivery {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Delivery(nil), s.deliveries...)
+}
+
+func (s *Server) listWebhooks(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	results := make([]interface{}, len(s.webhooks))
+	for i, wh := range s.webhooks {
+		redacted := *wh
+		redacted.Secret = ""
+		results[i] = redacted
+	}
+	s.mu.Unlock()
+	s.writeList(w, r, results)
+}
+
+func (s *Server) createWebhook(w http.ResponseWriter, r *http.Request) {
+	var wh Webhook
+	if err := json.NewDecoder(r.Body).Decode(&wh); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid webhook: "+err.Error())
+		return
+	}
+	if wh.URL == "" || len(wh.Events) == 0 {
+		writeError(w, http.StatusBadRequest, "Webhook url and events are required")
+		return
+	}
+	for _, e := range wh.Events {
+		if !knownEvents[e] {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("Unknown webhook event %q", e))
+			return
+		}
+	}
+
+	s.mu.Lock()
+	wh.ID = len(s.webhooks) + 1
+	for _, existing := range s.webhooks {
+		if existing.ID >= wh.ID {
+			wh.ID = existing.ID + 1
+		}
+	}
+	s.webhooks = append(s.webhooks, &wh)
+	s.mu.Unlock()
+
+	created := wh
+	created.Secret = ""
+	writeJSON(w, http.StatusCreated, created)
+}
+
+func (s *Server) deleteWebhook(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(r.PathValue("id"))
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, wh := range s.webhooks {
+		if wh.ID == id {
+			s.webhooks = append(s.webhooks[:i], s.webhooks[i+1:]...)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+	}
+	writeError(w, http.StatusNotFound, "No webhook with id "+r.PathValue("id"))
+}
+
+// event is a change to deliver, captured while s.mu is held
+type event struct {
+	id      string
+	name    string
+	payload map[string]interface{}
+	pageID  string
+	targets []Webhook
+}
+
+// newEvent builds the payload for a change to p and snapshots the webhooks
+// subscribed to it. The caller must hold s.mu; deliver the result with fire
+// after releasing it.
+func (s *Server) newEvent(name string, p *page, label string) event {
+	v := p.current()
+	payload := map[string]interface{}{
+		"event":         name,
+		"timestamp":     time.Now().UnixMilli(),
+		"userAccountId": s.user.AccountID,
+		"page": map[string]interface{}{
+			"id":               p.ID,
+			"title":            p.Title,
+			"spaceKey":         p.spaceKey,
+			"version":          v.Number,
+			"self":             s.opts.BaseURL + s.webUIPath(p),
+			"creationDate":     p.Versions[0].When.UnixMilli(),
+			"modificationDate": v.When.UnixMilli(),
+		},
+	}
+	if label != "" {
+		payload["label"] = map[string]interface{}{"name": label, "prefix": "global"}
+	}
+
+	e := event{id: "event-" + strconv.Itoa(s.nextID), name: name, payload: payload, pageID: p.ID}
+	s.nextID++
+	for _, wh := range s.webhooks {
+		if !wh.Active {
+			continue
+		}
+		for _, subscribed := range wh.Events {
+			if subscribed == name {
+				e.targets = append(e.targets, *wh)
+				break
+			}
+		}
+	}
+	return e
+}
+
+// fire delivers e to each subscribed webhook in turn and records the outcome.
+// Deliveries are synchronous, so a change made through the Server has reached
+// every receiver by the time it returns.
+func (s *Server) fire(e event) {
+	if len(e.targets) == 0 {
+		return
+	}
+	body, err := json.Marshal(e.payload)
+	if err != nil {
+		s.logger.Error("failed to encode webhook payload", "event", e.name, "error", err)
+		return
+	}
+
+	for _, wh := range e.targets {
+		d := Delivery{WebhookID: wh.ID, Event: e.name, PageID: e.pageID, At: time.Now()}
+		req, err := http.NewRequest(http.MethodPost, wh.URL, bytes.NewReader(body))
+		if err == nil {
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("User-Agent", "Atlassian Webhook HTTP Client")
+			req.Header.Set("X-Event-Key", e.name)
+			req.Header.Set("X-Atlassian-Webhook-Identifier", e.id)
+			if wh.Secret != "" {
+				mac := hmac.New(sha256.New, []byte(wh.Secret))
+				mac.Write(body)
+				req.Header.Set("X-Hub-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+			}
+			var resp *http.Response
+			if resp, err = deliveryClient.Do(req); err == nil {
+				resp.Body.Close()
+				d.Status = resp.StatusCode
+			}
+		}
+		if err != nil {
+			d.Error = err.Error()
+		}
+		s.logger.Info("webhook delivered", "webhook", wh.ID, "event", e.name, "page", e.pageID,
+			"status", d.Status, "error", d.Error)
+
+		s.mu.Lock()
+		s.deliveries = append(s.deliveries, d)
+		s.mu.Unlock()
+	}
+}
@@ -0,0 +1,73 @@
+package confluence
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+)
+
+// ErrCircuitOpen is returned without calling Confluence while an
+// organization's circuit breaker is open
+var ErrCircuitOpen = errors.New("confluence integration degraded: circuit breaker open")
+
+// APIError is a non-2xx response from Confluence
+type APIError struct {
+	StatusCode int
+	// Message is Atlassian's error message, or the start of the body when it
+	// isn't JSON
+	Message string
+	// RetryAfter is the wait the server asked for, if any
+	RetryAfter time.Duration
+	// Header holds the response headers
+	Header http.Header
+}
+
+func (e *APIError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("confluence API error: HTTP %d", e.StatusCode)
+	}
+	return fmt.Sprintf("confluence API error: HTTP %d: %s", e.StatusCode, e.Message)
+}
+
+// Unauthorized reports whether Confluence rejected the credentials
+func (e *APIError) Unauthorized() bool {
+	return e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden
+}
+
+// TransportError is a call that failed before a response arrived
+type TransportError struct {
+	Err error
+}
+
+func (e *TransportError) Error() string { return "confluence request failed: " + e.Err.Error() }
+
+func (e *TransportError) Unwrap() error { return e.Err }
+
+// maxMessageLen bounds how much of a non-JSON error body is kept
+const maxMessageLen = 200
+
+func newAPIError(resp *resty.Response) *APIError {
+	e := &APIError{StatusCode: resp.StatusCode(), Header: resp.Header()}
+	if d, ok := parseRetryAfter(resp.Header().Get("Retry-After"), time.Now()); ok {
+		e.RetryAfter = d
+	}
+
+	var body struct {
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(resp.Body(), &body); err == nil && body.Message != "" {
+		e.Message = body.Message
+		return e
+	}
+	msg := strings.TrimSpace(resp.String())
+	if len(msg) > maxMessageLen {
+		msg = msg[:maxMessageLen] + "…"
+	}
+	e.Message = msg
+	return e
+}
@@ -0,0 +1,227 @@
+package confluence
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/shaunpua/updoc/internal/config"
+)
+
+// OAuthToken is an Atlassian OAuth 2.0 grant. Atlassian rotates refresh
+// tokens, so the one returned by each refresh replaces the last.
+type OAuthToken struct {
+	AccessToken  string
+	RefreshToken string
+	Expiry       time.Time
+	Scope        string
+}
+
+// OAuthError is an error response from the authorization server, such as
+// invalid_grant when a refresh token was revoked
+type OAuthError struct {
+	StatusCode  int
+	Code        string
+	Description string
+}
+
+func (e *OAuthError) Error() string {
+	msg := e.Code
+	if msg == "" {
+		msg = fmt.Sprintf("HTTP %d", e.StatusCode)
+	}
+	if e.Description != "" {
+		msg += ": " + e.Description
+	}
+	return "atlassian oauth: " + msg
+}
+
+// Resource is a site an OAuth grant can reach
+type Resource struct {
+	// ID is the cloudid API calls are routed by
+	ID     string   `json:"id"`
+	URL    string   `json:"url"`
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+}
+
+// OAuth is the Atlassian OAuth 2.0 (3LO) authorization-code flow
+type OAuth struct {
+	cfg  config.AtlassianOAuthConfig
+	http *resty.Client
+}
+
+// OAuth returns the client's OAuth app; check Enabled before starting a flow
+func (c *Client) OAuth() *OAuth { return c.oauth }
+
+// Enabled reports whether an OAuth app is configured
+func (o *OAuth) Enabled() bool { return o.cfg.Enabled() }
+
+// StateTTL is how long an authorization may take from start to callback
+func (o *OAuth) StateTTL() time.Duration { return o.cfg.StateTTL }
+
+// AuthCodeURL is where an admin approves access. state comes back unchanged
+// on the callback.
+func (o *OAuth) AuthCodeURL(state string) string {
+	q := url.Values{}
+	q.Set("audience", "api.atlassian.com")
+	q.Set("client_id", o.cfg.ClientID)
+	q.Set("scope", strings.Join(o.cfg.Scopes, " "))
+	q.Set("redirect_uri", o.cfg.RedirectURL)
+	q.Set("state", state)
+	q.Set("response_type", "code")
+	q.Set("prompt", "consent")
+	return strings.TrimRight(o.cfg.AuthURL, "/") + "/authorize?" + q.Encode()
+}
+
+// Exchange trades the code from the callback for tokens
+func (o *OAuth) Exchange(ctx context.Context, code string) (*OAuthToken, error) {
+	return o.token(ctx, map[string]string{
+		"grant_type":   "authorization_code",
+		"code":         code,
+		"redirect_uri": o.cfg.RedirectURL,
+	})
+}
+
+// Refresh trades a refresh token for a new access and refresh token
+func (o *OAuth) Refresh(ctx context.Context, refreshToken string) (*OAuthToken, error) {
+	return o.token(ctx, map[string]string{
+		"grant_type":    "refresh_token",
+		"refresh_token": refreshToken,
+	})
+}
+
+func (o *OAuth) token(ctx context.Context, body map[string]string) (*OAuthToken, error) {
+	body["client_id"] = o.cfg.ClientID
+	body["client_secret"] = o.cfg.ClientSecret
+
+	var out struct {
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+		ExpiresIn    int    `json:"expires_in"`
+		Scope        string `json:"scope"`
+	}
+	resp, err := o.http.R().
+		SetContext(ctx).
+		SetHeader("Accept", "application/json").
+		SetBody(body).
+		Post(strings.TrimRight(o.cfg.AuthURL, "/") + "/oauth/token")
+	if err != nil {
+		return nil, &TransportError{Err: err}
+	}
+	if !resp.IsSuccess() {
+		var e struct {
+			Error            string `json:"error"`
+			ErrorDescription string `json:"error_description"`
+		}
+		json.Unmarshal(resp.Body(), &e)
+		return nil, &OAuthError{StatusCode: resp.StatusCode(), Code: e.Error, Description: e.ErrorDescription}
+	}
+	if err := json.Unmarshal(resp.Body(), &out); err != nil || out.AccessToken == "" {
+		return nil, fmt.Errorf("atlassian oauth: unexpected token response")
+	}
+
+	tok := &OAuthToken{
+		AccessToken:  out.AccessToken,
+		RefreshToken: out.RefreshToken,
+		Expiry:       time.Now().Add(time.Duration(out.ExpiresIn) * time.Second),
+		Scope:        out.Scope,
+	}
+	if tok.RefreshToken == "" {
+		// Without offline_access there is no refresh token, only this one
+		// access token; keep any refresh token the caller already holds
+		tok.RefreshToken = body["refresh_token"]
+	}
+	return tok, nil
+}
+
+// Resources lists the sites accessToken can reach
+func (o *OAuth) Resources(ctx context.Context, accessToken string) ([]Resource, error) {
+	resp, err := o.http.R().
+		SetContext(ctx).
+		SetHeader("Accept", "application/json").
+		SetAuthToken(accessToken).
+		Get(strings.TrimRight(o.cfg.APIURL, "/") + "/oauth/token/accessible-resources")
+	if err := checkResponse(resp, err); err != nil {
+		return nil, err
+	}
+	var resources []Resource
+	if err := json.Unmarshal(resp.Body(), &resources); err != nil {
+		return nil, fmt.Errorf("failed to parse accessible resources: %w", err)
+	}
+	return resources, nil
+}
+
+// gatewayURL is the base for a cloud site's REST API through the gateway
+func (o *OAuth) gatewayURL(cloudID string) string {
+	return strings.TrimRight(o.cfg.APIURL, "/") + "/ex/confluence/" + url.PathEscape(cloudID) + "/wiki"
+}
+
+// tokenState is the newest grant seen for an organization. Its lock makes
+// concurrent calls wait for one refresh instead of each spending the
+// rotating refresh token.
+type tokenState struct {
+	mu    sync.Mutex
+	token OAuthToken
+}
+
+func (c *Client) tokenState(key string) *tokenState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ts, ok := c.tokens[key]
+	if !ok {
+		ts = &tokenState{}
+		c.tokens[key] = ts
+	}
+	return ts
+}
+
+// accessToken returns a current OAuth access token for the site, refreshing
+// it when it expires within the configured margin and handing the new grant
+// to Credentials.SaveToken
+func (s *Site) accessToken(ctx context.Context) (string, error) {
+	c := s.client
+	ts := c.tokenState(s.key)
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	// The stored grant wins when it is newer than the cached one, e.g. after
+	// the organization reconnected
+	if s.creds.OAuth != nil && s.creds.OAuth.Expiry.After(ts.token.Expiry) {
+		ts.token = *s.creds.OAuth
+	}
+	if ts.token.AccessToken == "" {
+		return "", &OAuthError{Code: "not_connected", Description: "no OAuth grant is stored for this organization"}
+	}
+	if time.Until(ts.token.Expiry) > c.cfg.OAuth.RefreshBefore {
+		return ts.token.AccessToken, nil
+	}
+	if ts.token.RefreshToken == "" {
+		return "", &OAuthError{Code: "expired", Description: "the access token expired and there is no refresh token; reconnect"}
+	}
+
+	// Atlassian spends the refresh token as soon as it answers, so the
+	// refresh and saving the new grant must finish even if the caller gives
+	// up; the client's timeout still bounds the call
+	refreshCtx := context.WithoutCancel(context.WithValue(ctx, siteKey{}, s.key))
+	fresh, err := c.oauth.Refresh(refreshCtx, ts.token.RefreshToken)
+	if err != nil {
+		c.logger.WarnContext(ctx, "confluence oauth refresh failed", "org", s.key, "error", err)
+		return "", err
+	}
+	ts.token = *fresh
+	if s.creds.SaveToken != nil {
+		if err := s.creds.SaveToken(refreshCtx, fresh); err != nil {
+			// The refresh token is spent; the cached one keeps this process
+			// working, but the stored grant can no longer be refreshed
+			c.logger.ErrorContext(ctx, "failed to save refreshed confluence oauth token", "org", s.key, "error", err)
+		}
+	}
+	c.logger.InfoContext(ctx, "refreshed confluence oauth token", "org", s.key, "expires", fresh.Expiry)
+	return fresh.AccessToken, nil
+}
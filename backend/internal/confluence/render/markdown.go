@@ -0,0 +1,303 @@
+package render
+
+import (
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// markdown writes a sanitized tree as CommonMark, with GitHub's tables, task
+// lists and strikethrough
+func markdown(root *html.Node) string {
+	return strings.TrimSpace(blocks(root, "\n\n")) + "\n"
+}
+
+var blockElements = map[string]bool{
+	"p": true, "div": true, "pre": true, "blockquote": true, "ul": true, "ol": true,
+	"table": true, "hr": true, "details": true, "summary": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+}
+
+func isBlock(n *html.Node) bool {
+	return n.Type == html.ElementNode && blockElements[n.Data]
+}
+
+// blocks renders n's children, joining blocks with sep. Inline content
+// between blocks forms a paragraph of its own.
+func blocks(n *html.Node, sep string) string {
+	var out []string
+	var inlines strings.Builder
+	flush := func() {
+		if p := tidyInline(inlines.String()); p != "" {
+			out = append(out, p)
+		}
+		inlines.Reset()
+	}
+	for ch := n.FirstChild; ch != nil; ch = ch.NextSibling {
+		if !isBlock(ch) {
+			inlines.WriteString(inline(ch))
+			continue
+		}
+		flush()
+		if b := block(ch); b != "" {
+			out = append(out, b)
+		}
+	}
+	flush()
+	return strings.Join(out, sep)
+}
+
+func block(n *html.Node) string {
+	switch n.Data {
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		level, _ := strconv.Atoi(n.Data[1:])
+		title := strings.ReplaceAll(tidyInline(inlineChildren(n)), "\n", " ")
+		if title == "" {
+			return ""
+		}
+		return strings.Repeat("#", level) + " " + title
+	case "p", "summary":
+		p := tidyInline(inlineChildren(n))
+		if n.Data == "summary" && p != "" {
+			p = "**" + p + "**"
+		}
+		return p
+	case "pre":
+		code := strings.TrimRight(textContent(n), "\n")
+		lang := ""
+		if c := child(n, "code"); c != nil {
+			lang = languageClass(c)
+		}
+		fence := "```"
+		for strings.Contains(code, fence) {
+			fence += "`"
+		}
+		return fence + lang + "\n" + code + "\n" + fence
+	case "blockquote", "details":
+		body := blocks(n, "\n\n")
+		if body == "" {
+			return ""
+		}
+		return prefixLines(body, "> ", ">")
+	case "ul", "ol":
+		return list(n)
+	case "table":
+		return table(n)
+	case "hr":
+		return "---"
+	}
+	return blocks(n, "\n\n")
+}
+
+func list(n *html.Node) string {
+	var items []string
+	number := 1
+	if start, err := strconv.Atoi(attr(n, "start")); err == nil {
+		number = start
+	}
+	for li := n.FirstChild; li != nil; li = li.NextSibling {
+		if li.Type != html.ElementNode || li.Data != "li" {
+			continue
+		}
+		marker := "- "
+		if n.Data == "ol" {
+			marker = strconv.Itoa(number) + ". "
+			number++
+		}
+		indent := strings.Repeat(" ", len(marker))
+		item := blocks(li, "\n")
+		// Task boxes are escaped like any other brackets in text
+		for _, box := range []string{"[ ] ", "[x] "} {
+			if rest, ok := strings.CutPrefix(item, escapeMarkdown(box)); ok {
+				item = box + rest
+			}
+		}
+		body := prefixLines(item, indent, "")
+		items = append(items, strings.TrimRight(marker+strings.TrimPrefix(body, indent), " "))
+	}
+	return strings.Join(items, "\n")
+}
+
+func table(n *html.Node) string {
+	var rows [][]string
+	var collect func(*html.Node)
+	collect = func(n *html.Node) {
+		for ch := n.FirstChild; ch != nil; ch = ch.NextSibling {
+			if ch.Type != html.ElementNode {
+				continue
+			}
+			switch ch.Data {
+			case "thead", "tbody", "tfoot":
+				collect(ch)
+			case "tr":
+				var row []string
+				for cell := ch.FirstChild; cell != nil; cell = cell.NextSibling {
+					if cell.Type == html.ElementNode && (cell.Data == "td" || cell.Data == "th") {
+						text := tidyInline(strings.ReplaceAll(cellText(cell), "\n", " "))
+						row = append(row, strings.ReplaceAll(text, "|", `\|`))
+					}
+				}
+				rows = append(rows, row)
+			}
+		}
+	}
+	collect(n)
+	if len(rows) == 0 {
+		return ""
+	}
+
+	width := 0
+	for _, row := range rows {
+		width = max(width, len(row))
+	}
+	if width == 0 {
+		return ""
+	}
+	line := func(cells []string) string {
+		padded := make([]string, width)
+		copy(padded, cells)
+		return "| " + strings.Join(padded, " | ") + " |"
+	}
+	// Markdown tables need a header row; the first row serves as one
+	lines := []string{line(rows[0]), line(strings.Split(strings.Repeat("---,", width-1)+"---", ","))}
+	for _, row := range rows[1:] {
+		lines = append(lines, line(row))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// cellText flattens a table cell, whose Markdown must fit on one line
+func cellText(n *html.Node) string {
+	var parts []string
+	for ch := n.FirstChild; ch != nil; ch = ch.NextSibling {
+		if isBlock(ch) {
+			parts = append(parts, cellText(ch))
+		} else {
+			parts = append(parts, inline(ch))
+		}
+	}
+	return strings.ReplaceAll(strings.Join(parts, " "), "\\\n", " ")
+}
+
+func inline(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return escapeMarkdown(collapseSpace(n.Data))
+	}
+	if n.Type != html.ElementNode {
+		return ""
+	}
+	inner := inlineChildren(n)
+	switch n.Data {
+	case "strong", "b":
+		return wrapInline(inner, "**")
+	case "em", "i":
+		return wrapInline(inner, "_")
+	case "s", "del":
+		return wrapInline(inner, "~~")
+	case "code":
+		code := collapseSpace(textContent(n))
+		if strings.TrimSpace(code) == "" {
+			return code
+		}
+		tick := "`"
+		for strings.Contains(code, tick) {
+			tick += "`"
+		}
+		if strings.HasPrefix(code, "`") || strings.HasSuffix(code, "`") {
+			code = " " + code + " "
+		}
+		return tick + code + tick
+	case "a":
+		href := attr(n, "href")
+		label := strings.TrimSpace(inner)
+		if href == "" {
+			return inner
+		}
+		if label == "" {
+			label = escapeMarkdown(href)
+		}
+		return "[" + label + "](" + markdownURL(href) + ")"
+	case "img":
+		src := attr(n, "src")
+		if src == "" {
+			return ""
+		}
+		return "![" + escapeMarkdown(attr(n, "alt")) + "](" + markdownURL(src) + ")"
+	case "br":
+		return "\\\n"
+	}
+	if isBlock(n) {
+		return " " + inner + " "
+	}
+	return inner
+}
+
+func inlineChildren(n *html.Node) string {
+	var sb strings.Builder
+	for ch := n.FirstChild; ch != nil; ch = ch.NextSibling {
+		sb.WriteString(inline(ch))
+	}
+	return sb.String()
+}
+
+// wrapInline puts emphasis markers around text, outside its surrounding
+// spaces, which would stop the markers from applying
+func wrapInline(s, marker string) string {
+	trimmed := strings.TrimSpace(s)
+	if trimmed == "" {
+		return s
+	}
+	lead := s[:strings.Index(s, trimmed)]
+	trail := s[len(lead)+len(trimmed):]
+	return lead + marker + trimmed + marker + trail
+}
+
+// tidyInline joins runs of spaces and trims each line of a paragraph
+func tidyInline(s string) string {
+	lines := strings.Split(s, "\n")
+	for i, l := range lines {
+		lines[i] = strings.Join(strings.Fields(l), " ")
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+func collapseSpace(s string) string {
+	if s == "" {
+		return ""
+	}
+	collapsed := strings.Join(strings.Fields(s), " ")
+	if strings.TrimLeft(s, " \t\r\n") != s {
+		collapsed = " " + collapsed
+	}
+	if strings.TrimRight(s, " \t\r\n") != s && collapsed != " " {
+		collapsed += " "
+	}
+	return collapsed
+}
+
+var markdownEscaper = strings.NewReplacer(`\`, `\\`, "*", `\*`, "_", `\_`, "`", "\\`", "[", `\[`, "]", `\]`, "<", `\<`)
+
+func escapeMarkdown(s string) string { return markdownEscaper.Replace(s) }
+
+// markdownURL writes a link destination, in angle brackets when it has
+// characters that would end it early
+func markdownURL(u string) string {
+	if strings.ContainsAny(u, " ()<>") {
+		return "<" + strings.NewReplacer("<", "%3C", ">", "%3E").Replace(u) + ">"
+	}
+	return u
+}
+
+// prefixLines prefixes each line of s, using blank for empty lines
+func prefixLines(s, prefix, blank string) string {
+	lines := strings.Split(s, "\n")
+	for i, l := range lines {
+		if l == "" {
+			lines[i] = blank
+		} else {
+			lines[i] = prefix + l
+		}
+	}
+	return strings.Join(lines, "\n")
+}
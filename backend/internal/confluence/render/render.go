@@ -0,0 +1,508 @@
+// Package render turns Confluence page bodies into HTML that is safe to embed
+// in UpDoc, and into Markdown. Storage-format macros with a plain equivalent
+// (code blocks, panels, expands, links to pages and attachments, images and
+// task lists) are rewritten as ordinary HTML; other macros keep their body, if
+// they have one, and are otherwise dropped. Everything outside a small
+// allowlist of elements and attributes is removed, and links and images are
+// limited to http, https and mailto URLs.
+package render
+
+import (
+	"bytes"
+	"net/url"
+	"path"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Page is a page body in both output formats
+type Page struct {
+	HTML     string
+	Markdown string
+}
+
+// Options give the context a body's relative links are resolved in
+type Options struct {
+	// BaseURL is the site's base URL, such as https://acme.atlassian.net/wiki
+	BaseURL string
+	// SpaceKey is the page's space, for links to pages that don't name one
+	SpaceKey string
+	// PageID is the page the body belongs to, for links to its attachments
+	PageID string
+}
+
+// Storage renders a body in storage format, Confluence's XHTML with ac: and
+// ri: elements
+func Storage(body string, opts Options) *Page {
+	c := &converter{opts: opts, storage: true}
+	return c.render(parseXHTML(body))
+}
+
+// View renders a body in view format, the HTML Confluence shows readers
+func View(body string, opts Options) (*Page, error) {
+	root := newElement("div")
+	nodes, err := html.ParseFragment(strings.NewReader(body), &html.Node{Type: html.ElementNode, Data: "div", DataAtom: atom.Div})
+	if err != nil {
+		return nil, err
+	}
+	for _, n := range nodes {
+		root.AppendChild(n)
+	}
+	c := &converter{opts: opts}
+	return c.render(root), nil
+}
+
+// voidElements never have children, whether or not they are written self-closing
+var voidElements = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true, "embed": true, "hr": true,
+	"img": true, "input": true, "link": true, "meta": true, "source": true, "track": true, "wbr": true,
+}
+
+// parseXHTML builds a tree from storage format. html.Parse can't be used: it
+// ignores the self-closing slash on unknown elements such as <ri:page/>, which
+// would swallow their following siblings.
+func parseXHTML(body string) *html.Node {
+	root := newElement("div")
+	stack := []*html.Node{root}
+	z := html.NewTokenizer(strings.NewReader(expandCDATA(body)))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			return root
+		}
+		t := z.Token()
+		top := stack[len(stack)-1]
+		switch tt {
+		case html.TextToken:
+			top.AppendChild(&html.Node{Type: html.TextNode, Data: t.Data})
+		case html.StartTagToken, html.SelfClosingTagToken:
+			n := &html.Node{Type: html.ElementNode, Data: t.Data, DataAtom: t.DataAtom, Attr: t.Attr}
+			top.AppendChild(n)
+			if tt == html.StartTagToken && !voidElements[t.Data] {
+				stack = append(stack, n)
+			}
+		case html.EndTagToken:
+			// Close the nearest matching element; stray end tags are ignored
+			for i := len(stack) - 1; i > 0; i-- {
+				if stack[i].Data == t.Data {
+					stack = stack[:i]
+					break
+				}
+			}
+		}
+	}
+}
+
+// expandCDATA replaces CDATA sections, which hold code and plain-text bodies,
+// with escaped text. The HTML tokenizer would read one as a comment ending at
+// the first '>'.
+func expandCDATA(body string) string {
+	var sb strings.Builder
+	for {
+		start := strings.Index(body, "<![CDATA[")
+		if start < 0 {
+			sb.WriteString(body)
+			return sb.String()
+		}
+		sb.WriteString(body[:start])
+		body = body[start+len("<![CDATA["):]
+		end := strings.Index(body, "]]>")
+		if end < 0 {
+			end = len(body)
+		}
+		sb.WriteString(html.EscapeString(body[:end]))
+		body = body[min(end+len("]]>"), len(body)):]
+	}
+}
+
+// allowedAttrs lists the elements kept in the output and the attributes each may keep
+var allowedAttrs = map[string][]string{
+	"p": nil, "div": nil, "span": nil, "br": nil, "hr": nil,
+	"h1": nil, "h2": nil, "h3": nil, "h4": nil, "h5": nil, "h6": nil,
+	"strong": nil, "b": nil, "em": nil, "i": nil, "u": nil, "s": nil, "del": nil,
+	"sub": nil, "sup": nil, "code": nil, "pre": nil, "blockquote": nil,
+	"ul": nil, "ol": {"start"}, "li": nil,
+	"table": nil, "thead": nil, "tbody": nil, "tfoot": nil, "tr": nil,
+	"th": {"colspan", "rowspan"}, "td": {"colspan", "rowspan"},
+	"a": {"href", "title"}, "img": {"src", "alt", "title", "width", "height"},
+	"details": nil, "summary": nil,
+}
+
+// droppedElements are removed along with everything inside them
+var droppedElements = map[string]bool{
+	"script": true, "style": true, "iframe": true, "object": true, "embed": true, "applet": true,
+	"form": true, "input": true, "button": true, "select": true, "textarea": true, "noscript": true,
+	"template": true, "svg": true, "math": true, "head": true, "title": true, "meta": true, "link": true, "base": true,
+}
+
+type converter struct {
+	opts    Options
+	storage bool
+}
+
+func (c *converter) render(root *html.Node) *Page {
+	out := newElement("div")
+	c.children(out, root)
+
+	var buf bytes.Buffer
+	for n := out.FirstChild; n != nil; n = n.NextSibling {
+		html.Render(&buf, n)
+	}
+	return &Page{HTML: buf.String(), Markdown: markdown(out)}
+}
+
+func (c *converter) children(dst, src *html.Node) {
+	for n := src.FirstChild; n != nil; n = n.NextSibling {
+		c.node(dst, n)
+	}
+}
+
+func (c *converter) node(dst, n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		dst.AppendChild(text(n.Data))
+	case html.ElementNode:
+		switch {
+		case c.storage && (strings.HasPrefix(n.Data, "ac:") || strings.HasPrefix(n.Data, "ri:")):
+			c.macro(dst, n)
+		case c.storage && n.Data == "time":
+			// <time datetime="2025-01-31"/> is a date picked in the editor
+			dst.AppendChild(text(attr(n, "datetime")))
+		case droppedElements[n.Data]:
+		default:
+			allowed, ok := allowedAttrs[n.Data]
+			if !ok {
+				c.children(dst, n)
+				return
+			}
+			el := newElement(n.Data)
+			for _, a := range n.Attr {
+				if !contains(allowed, a.Key) {
+					continue
+				}
+				value := a.Val
+				if a.Key == "href" || a.Key == "src" {
+					if value = c.safeURL(value, a.Key == "href"); value == "" {
+						continue
+					}
+				}
+				el.Attr = append(el.Attr, html.Attribute{Key: a.Key, Val: value})
+			}
+			switch {
+			case n.Data == "img" && attr(el, "src") == "":
+				return
+			case n.Data == "a" && attr(el, "href") == "":
+				// A link whose target was removed keeps its text
+				c.children(dst, n)
+				return
+			case n.Data == "a":
+				el.Attr = append(el.Attr, html.Attribute{Key: "rel", Val: "noopener noreferrer"})
+			}
+			if n.Data == "code" {
+				if lang := languageClass(n); lang != "" {
+					el.Attr = append(el.Attr, html.Attribute{Key: "class", Val: "language-" + lang})
+				}
+			}
+			dst.AppendChild(el)
+			c.children(el, n)
+		}
+	}
+}
+
+// panelMacros are rendered as a blockquote headed by their title
+var panelMacros = map[string]string{
+	"info": "Info", "note": "Note", "warning": "Warning", "tip": "Tip", "panel": "",
+}
+
+// macro rewrites a storage-format element
+func (c *converter) macro(dst, n *html.Node) {
+	switch n.Data {
+	case "ac:structured-macro", "ac:macro":
+		c.structuredMacro(dst, n)
+	case "ac:link":
+		c.link(dst, n)
+	case "ac:image":
+		c.image(dst, n)
+	case "ac:task-list":
+		ul := newElement("ul")
+		dst.AppendChild(ul)
+		for task := n.FirstChild; task != nil; task = task.NextSibling {
+			if task.Type != html.ElementNode || task.Data != "ac:task" {
+				continue
+			}
+			li := newElement("li")
+			box := "[ ] "
+			if status := child(task, "ac:task-status"); status != nil && strings.TrimSpace(textContent(status)) == "complete" {
+				box = "[x] "
+			}
+			li.AppendChild(text(box))
+			if body := child(task, "ac:task-body"); body != nil {
+				c.children(li, body)
+			}
+			ul.AppendChild(li)
+		}
+	case "ac:emoticon":
+		if fallback := attr(n, "ac:emoji-fallback"); fallback != "" {
+			dst.AppendChild(text(fallback))
+		}
+	case "ac:parameter", "ac:plain-text-body", "ac:placeholder", "ac:task-id":
+	default:
+		// Layouts, inline comment markers, rich text bodies and the like
+		// only wrap content
+		c.children(dst, n)
+	}
+}
+
+func (c *converter) structuredMacro(dst, n *html.Node) {
+	name := attr(n, "ac:name")
+	switch name {
+	case "code", "noformat":
+		pre := newElement("pre")
+		code := newElement("code")
+		if lang := macroParam(n, "language"); lang != "" && name == "code" {
+			code.Attr = append(code.Attr, html.Attribute{Key: "class", Val: "language-" + sanitizeLanguage(lang)})
+		}
+		if body := child(n, "ac:plain-text-body"); body != nil {
+			code.AppendChild(text(textContent(body)))
+		}
+		pre.AppendChild(code)
+		dst.AppendChild(pre)
+	case "info", "note", "warning", "tip", "panel":
+		quote := newElement("blockquote")
+		title := macroParam(n, "title")
+		if title == "" {
+			title = panelMacros[name]
+		}
+		if title != "" {
+			p := newElement("p")
+			strong := newElement("strong")
+			strong.AppendChild(text(title))
+			p.AppendChild(strong)
+			quote.AppendChild(p)
+		}
+		if body := child(n, "ac:rich-text-body"); body != nil {
+			c.children(quote, body)
+		}
+		dst.AppendChild(quote)
+	case "expand":
+		details := newElement("details")
+		summary := newElement("summary")
+		title := macroParam(n, "title")
+		if title == "" {
+			title = "Click here to expand..."
+		}
+		summary.AppendChild(text(title))
+		details.AppendChild(summary)
+		if body := child(n, "ac:rich-text-body"); body != nil {
+			c.children(details, body)
+		}
+		dst.AppendChild(details)
+	case "status":
+		if title := macroParam(n, "title"); title != "" {
+			strong := newElement("strong")
+			strong.AppendChild(text("[" + title + "]"))
+			dst.AppendChild(strong)
+		}
+	case "jira":
+		if key := macroParam(n, "key"); key != "" {
+			dst.AppendChild(text(key))
+		}
+	default:
+		// Dynamic macros such as toc or children have nothing to show
+		// outside Confluence; others keep their body
+		if body := child(n, "ac:rich-text-body"); body != nil {
+			c.children(dst, body)
+		}
+	}
+}
+
+// link rewrites <ac:link>, whose target is a ri: element and whose text is
+// in a link body or defaults to the target's name
+func (c *converter) link(dst, n *html.Node) {
+	var href, label string
+	for t := n.FirstChild; t != nil; t = t.NextSibling {
+		if t.Type != html.ElementNode {
+			continue
+		}
+		switch t.Data {
+		case "ri:page", "ri:blog-post":
+			label = attr(t, "ri:content-title")
+			space := attr(t, "ri:space-key")
+			if space == "" {
+				space = c.opts.SpaceKey
+			}
+			if label != "" && space != "" && c.opts.BaseURL != "" {
+				href = strings.TrimRight(c.opts.BaseURL, "/") + "/display/" + url.PathEscape(space) + "/" + url.QueryEscape(label)
+			}
+		case "ri:attachment":
+			label = attr(t, "ri:filename")
+			href = c.attachmentURL(label)
+		case "ri:url":
+			href = attr(t, "ri:value")
+			label = href
+		case "ri:user":
+			label = "@user"
+		case "ri:space":
+			label = attr(t, "ri:space-key")
+		}
+	}
+	if anchor := attr(n, "ac:anchor"); anchor != "" {
+		href += "#" + url.PathEscape(anchor)
+	}
+
+	a := newElement("a")
+	if href = c.safeURL(href, true); href != "" {
+		a.Attr = append(a.Attr, html.Attribute{Key: "href", Val: href}, html.Attribute{Key: "rel", Val: "noopener noreferrer"})
+	}
+	if body := child(n, "ac:link-body"); body != nil {
+		c.children(a, body)
+	} else if body := child(n, "ac:plain-text-link-body"); body != nil && strings.TrimSpace(textContent(body)) != "" {
+		a.AppendChild(text(textContent(body)))
+	} else {
+		a.AppendChild(text(label))
+	}
+	if href == "" {
+		c.children(dst, a)
+		return
+	}
+	dst.AppendChild(a)
+}
+
+func (c *converter) image(dst, n *html.Node) {
+	var src, name string
+	if u := child(n, "ri:url"); u != nil {
+		src = attr(u, "ri:value")
+		name = path.Base(src)
+	} else if file := child(n, "ri:attachment"); file != nil {
+		name = attr(file, "ri:filename")
+		src = c.attachmentURL(name)
+	}
+	alt := attr(n, "ac:alt")
+	if alt == "" {
+		alt = name
+	}
+	if src = c.safeURL(src, false); src == "" {
+		if alt != "" {
+			dst.AppendChild(text("[image: " + alt + "]"))
+		}
+		return
+	}
+	img := newElement("img")
+	img.Attr = append(img.Attr, html.Attribute{Key: "src", Val: src}, html.Attribute{Key: "alt", Val: alt})
+	dst.AppendChild(img)
+}
+
+// attachmentURL is where an attachment of the page is downloaded, or "" when
+// the page isn't known
+func (c *converter) attachmentURL(filename string) string {
+	if filename == "" || c.opts.BaseURL == "" || c.opts.PageID == "" {
+		return ""
+	}
+	return strings.TrimRight(c.opts.BaseURL, "/") + "/download/attachments/" + url.PathEscape(c.opts.PageID) + "/" + url.PathEscape(filename)
+}
+
+// safeURL resolves a link against the site and returns it if it is http or
+// https, or mailto for links; "" otherwise. Fragments are kept as they are.
+func (c *converter) safeURL(raw string, link bool) string {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return ""
+	}
+	if strings.HasPrefix(raw, "#") {
+		return raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return ""
+	}
+	if !u.IsAbs() && c.opts.BaseURL != "" {
+		if base, err := url.Parse(c.opts.BaseURL); err == nil {
+			u = base.ResolveReference(u)
+		}
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https":
+		return u.String()
+	case "mailto":
+		if link {
+			return u.String()
+		}
+	}
+	return ""
+}
+
+// languageClass is the language of a <code class="language-x"> element
+func languageClass(n *html.Node) string {
+	for _, class := range strings.Fields(attr(n, "class")) {
+		if lang, ok := strings.CutPrefix(class, "language-"); ok {
+			return sanitizeLanguage(lang)
+		}
+	}
+	return ""
+}
+
+// sanitizeLanguage keeps a code block's language to characters that are safe
+// in a class name and after a Markdown fence
+func sanitizeLanguage(lang string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("+#-_.", r) {
+			return r
+		}
+		return -1
+	}, lang)
+}
+
+func macroParam(n *html.Node, name string) string {
+	for p := n.FirstChild; p != nil; p = p.NextSibling {
+		if p.Type == html.ElementNode && p.Data == "ac:parameter" && attr(p, "ac:name") == name {
+			return strings.TrimSpace(textContent(p))
+		}
+	}
+	return ""
+}
+
+func child(n *html.Node, name string) *html.Node {
+	for ch := n.FirstChild; ch != nil; ch = ch.NextSibling {
+		if ch.Type == html.ElementNode && ch.Data == name {
+			return ch
+		}
+	}
+	return nil
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func textContent(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	var sb strings.Builder
+	for ch := n.FirstChild; ch != nil; ch = ch.NextSibling {
+		sb.WriteString(textContent(ch))
+	}
+	return sb.String()
+}
+
+func newElement(name string) *html.Node {
+	return &html.Node{Type: html.ElementNode, Data: name, DataAtom: atom.Lookup([]byte(name))}
+}
+
+func text(s string) *html.Node { return &html.Node{Type: html.TextNode, Data: s} }
+
+func contains(values []string, want string) bool {
+	for _, v := range values {
+		if v == want {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,169 @@
+package render
+
+import (
+	"strings"
+	"testing"
+)
+
+var testOpts = Options{BaseURL: "https://acme.atlassian.net/wiki", SpaceKey: "ENG", PageID: "102"}
+
+func TestViewSanitizes(t *testing.T) {
+	tests := []struct {
+		name, body string
+		want       string
+		unwanted   []string
+	}{
+		{"javascript href", `<a href="javascript:alert(1)">Docs</a>`, "Docs", []string{"href", "javascript"}},
+		{"mixed-case javascript href", `<a href=" JaVaScRiPt:alert(1)">Docs</a>`, "Docs", []string{"href", "alert"}},
+		{"data href", `<a href="data:text/html;base64,PHNjcmlwdD4=">Docs</a>`, "Docs", []string{"href", "data:"}},
+		{"data image", `<p><img src="data:image/svg+xml;base64,PHN2Zz4=" alt="x"></p>`, "<p></p>", []string{"img", "data:"}},
+		{"vbscript href", `<a href="vbscript:msgbox(1)">Docs</a>`, "Docs", []string{"href", "vbscript"}},
+		{"entity-encoded scheme", `<a href="&#106;avascript&#58;alert(1)">Docs</a>`, "Docs", []string{"href", "alert"}},
+		{"hex entity-encoded scheme", `<a href="&#x6A;&#x61;vascript:alert(1)">Docs</a>`, "Docs", []string{"href", "alert"}},
+		{"tab in scheme", "<a href=\"java\tscript:alert(1)\">Docs</a>", "Docs", []string{"javascript", "java\tscript"}},
+		{"entity-encoded tab in scheme", `<a href="java&#x09;script:alert(1)">Docs</a>`, "Docs", []string{"javascript", "java\tscript"}},
+		{"event handlers", `<p onclick="alert(1)" onmouseover="alert(2)">Hi <img src="https://x.example.com/a.png" onerror="alert(3)"></p>`,
+			`<p>Hi <img src="https://x.example.com/a.png"/></p>`, []string{"onclick", "onmouseover", "onerror", "alert"}},
+		{"style attribute", `<p style="background:url(javascript:alert(1))">Hi</p>`, "<p>Hi</p>", []string{"style", "alert"}},
+		{"script", `<p>Hi</p><script>alert(1)</script>`, "<p>Hi</p>", []string{"script", "alert"}},
+		{"style element", `<style>body{display:none}</style><p>Hi</p>`, "<p>Hi</p>", []string{"style", "display"}},
+		{"iframe", `<iframe src="https://evil.example.com"></iframe><p>Hi</p>`, "<p>Hi</p>", []string{"iframe", "evil"}},
+		{"nested in unknown element", `<custom-el><script>alert(1)</script>Hi</custom-el>`, "Hi", []string{"script", "custom-el"}},
+		{"svg", `<svg><script>alert(1)</script></svg><p>Hi</p>`, "<p>Hi</p>", []string{"svg", "alert"}},
+		{"form", `<form action="https://evil.example.com"><input name="password"></form>`, "", []string{"form", "input"}},
+		{"safe link", `<a href="/spaces/ENG/pages/103">Runbook</a>`,
+			`<a href="https://acme.atlassian.net/spaces/ENG/pages/103" rel="noopener noreferrer">Runbook</a>`, nil},
+		{"mailto", `<a href="mailto:docs@acme.example.com">Mail us</a>`, `href="mailto:docs@acme.example.com"`, nil},
+		{"fragment", `<a href="#setup">Setup</a>`, `href="#setup"`, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, err := View(tt.body, testOpts)
+			if err != nil {
+				t.Fatalf("View: %v", err)
+			}
+			if !strings.Contains(page.HTML, tt.want) {
+				t.Errorf("HTML = %q, want it to contain %q", page.HTML, tt.want)
+			}
+			for _, s := range tt.unwanted {
+				if strings.Contains(page.HTML, s) || strings.Contains(page.Markdown, s) {
+					t.Errorf("output contains %q:\nHTML: %s\nMarkdown: %s", s, page.HTML, page.Markdown)
+				}
+			}
+		})
+	}
+}
+
+func TestStorageMacros(t *testing.T) {
+	tests := []struct {
+		name, body string
+		html       []string
+		markdown   []string
+		unwanted   []string
+	}{
+		{
+			name: "code block",
+			body: `<ac:structured-macro ac:name="code"><ac:parameter ac:name="language">go" onclick="x</ac:parameter>` +
+				`<ac:plain-text-body><![CDATA[if a < b && c > d { return "<script>" }]]></ac:plain-text-body></ac:structured-macro>`,
+			html:     []string{`<pre><code class="language-goonclickx">if a &lt; b &amp;&amp; c &gt; d { return &#34;&lt;script&gt;&#34; }</code></pre>`},
+			markdown: []string{"```goonclickx\nif a < b && c > d { return \"<script>\" }\n```"},
+			unwanted: []string{`onclick="`, "<script>\"</code>"},
+		},
+		{
+			name:     "panel",
+			body:     `<ac:structured-macro ac:name="warning"><ac:rich-text-body><p>Back up <strong>first</strong>.</p></ac:rich-text-body></ac:structured-macro>`,
+			html:     []string{"<blockquote><p><strong>Warning</strong></p><p>Back up <strong>first</strong>.</p></blockquote>"},
+			markdown: []string{"> **Warning**", "> Back up **first**."},
+		},
+		{
+			name:     "expand",
+			body:     `<ac:structured-macro ac:name="expand"><ac:parameter ac:name="title">Details</ac:parameter><ac:rich-text-body><p>Hidden</p></ac:rich-text-body></ac:structured-macro>`,
+			html:     []string{"<details><summary>Details</summary><p>Hidden</p></details>"},
+			markdown: []string{"Details", "Hidden"},
+		},
+		{
+			name:     "page link",
+			body:     `<ac:link><ri:page ri:content-title="Deploy Runbook"/></ac:link> and more`,
+			html:     []string{`<a href="https://acme.atlassian.net/wiki/display/ENG/Deploy+Runbook" rel="noopener noreferrer">Deploy Runbook</a> and more`},
+			markdown: []string{"[Deploy Runbook](https://acme.atlassian.net/wiki/display/ENG/Deploy+Runbook) and more"},
+		},
+		{
+			name: "attachment image",
+			body: `<ac:image ac:alt="Diagram"><ri:attachment ri:filename="flow chart.png"/></ac:image>`,
+			html: []string{`<img src="https://acme.atlassian.net/wiki/download/attachments/102/flow%20chart.png" alt="Diagram"/>`},
+		},
+		{
+			name:     "javascript URL link",
+			body:     `<ac:link><ri:url ri:value="javascript:alert(1)"/><ac:plain-text-link-body><![CDATA[Click]]></ac:plain-text-link-body></ac:link>`,
+			html:     []string{"Click"},
+			unwanted: []string{"href", "javascript"},
+		},
+		{
+			name:     "entity-encoded URL link",
+			body:     `<ac:link><ri:url ri:value="&#106;avascript:alert(1)"/></ac:link>`,
+			html:     []string{"javascript:alert(1)"},
+			unwanted: []string{"<a", "href", "]("},
+		},
+		{
+			name:     "data URL image",
+			body:     `<ac:image ac:alt="Logo"><ri:url ri:value="data:image/png;base64,AAAA"/></ac:image>`,
+			html:     []string{"[image: Logo]"},
+			unwanted: []string{"<img", "data:"},
+		},
+		{
+			name:     "task list",
+			body:     `<ac:task-list><ac:task><ac:task-id>1</ac:task-id><ac:task-status>complete</ac:task-status><ac:task-body>Ship it</ac:task-body></ac:task><ac:task><ac:task-status>incomplete</ac:task-status><ac:task-body>Announce</ac:task-body></ac:task></ac:task-list>`,
+			html:     []string{"<ul><li>[x] Ship it</li><li>[ ] Announce</li></ul>"},
+			unwanted: []string{">1<"},
+		},
+		{
+			name:     "dynamic macro",
+			body:     `<p>Before</p><ac:structured-macro ac:name="toc"><ac:parameter ac:name="maxLevel">2</ac:parameter></ac:structured-macro><p>After</p>`,
+			html:     []string{"<p>Before</p><p>After</p>"},
+			unwanted: []string{"maxLevel", "2"},
+		},
+		{
+			name:     "unknown macro keeps its body",
+			body:     `<ac:structured-macro ac:name="section"><ac:rich-text-body><p>Kept <script>alert(1)</script></p></ac:rich-text-body></ac:structured-macro>`,
+			html:     []string{"<p>Kept </p>"},
+			unwanted: []string{"script", "alert"},
+		},
+		{
+			name: "status and jira",
+			body: `<p><ac:structured-macro ac:name="status"><ac:parameter ac:name="title">Done</ac:parameter></ac:structured-macro> ` +
+				`<ac:structured-macro ac:name="jira"><ac:parameter ac:name="key">OPS-12</ac:parameter></ac:structured-macro></p>`,
+			html: []string{"<p><strong>[Done]</strong> OPS-12</p>"},
+		},
+		{
+			name: "self-closing elements don't swallow siblings",
+			body: `<p><ac:emoticon ac:name="tick" ac:emoji-fallback="✅"/> done <time datetime="2025-01-31"/> today</p>`,
+			html: []string{"<p>✅ done 2025-01-31 today</p>"},
+		},
+		{
+			name:     "event handlers",
+			body:     `<p onclick="alert(1)">Hi</p><table><tr><td colspan="2" onmouseover="alert(2)">x</td></tr></table>`,
+			html:     []string{"<p>Hi</p>", `<td colspan="2">x</td>`},
+			unwanted: []string{"onclick", "onmouseover", "alert"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page := Storage(tt.body, testOpts)
+			for _, s := range tt.html {
+				if !strings.Contains(page.HTML, s) {
+					t.Errorf("HTML = %q, want it to contain %q", page.HTML, s)
+				}
+			}
+			for _, s := range tt.markdown {
+				if !strings.Contains(page.Markdown, s) {
+					t.Errorf("Markdown = %q, want it to contain %q", page.Markdown, s)
+				}
+			}
+			for _, s := range tt.unwanted {
+				if strings.Contains(page.HTML, s) || strings.Contains(page.Markdown, s) {
+					t.Errorf("output contains %q:\nHTML: %s\nMarkdown: %s", s, page.HTML, page.Markdown)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package confluence
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// retryable reports whether err is worth another attempt: rate limiting,
+// server errors and transport failures are; other client errors are not
+func retryable(err error) bool {
+	var transportErr *TransportError
+	if errors.As(err, &transportErr) {
+		return true
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode == http.StatusTooManyRequests || apiErr.StatusCode >= 500
+	}
+	return false
+}
+
+// rateLimited reports whether err is a 429, which Confluence returns before
+// doing any work
+func rateLimited(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusTooManyRequests
+}
+
+// retryDelay decides whether to retry after attempt (counting from 0) failed
+// with err, and how long to wait first. A Retry-After from the server is
+// honoured as long as it is within RetryMaxDelay; otherwise the delay is an
+// equal-jitter exponential backoff. No retry is made when the wait would
+// outlast ctx's deadline.
+func (c *Client) retryDelay(ctx context.Context, attempt int, err error) (time.Duration, bool) {
+	if attempt >= c.cfg.MaxRetries || !retryable(err) {
+		return 0, false
+	}
+
+	var delay time.Duration
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.RetryAfter > 0 {
+		if apiErr.RetryAfter > c.cfg.RetryMaxDelay {
+			return 0, false
+		}
+		delay = apiErr.RetryAfter
+	} else {
+		delay = backoff(c.cfg.RetryBaseDelay, c.cfg.RetryMaxDelay, attempt)
+	}
+
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+		return 0, false
+	}
+	return delay, true
+}
+
+// backoff returns a random delay between half and all of base*2^attempt,
+// capped at max. Keeping half the exponential delay guarantees progress while
+// the jitter spreads out clients that failed together.
+func backoff(base, max time.Duration, attempt int) time.Duration {
+	d := base
+	for i := 0; i < attempt && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	half := d / 2
+	return half + rand.N(d-half+1)
+}
+
+// parseRetryAfter reads a Retry-After header, given either as seconds or as
+// an HTTP date relative to now
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(value); err == nil {
+		if secs < 0 {
+			return 0, false
+		}
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		d := t.Sub(now)
+		if d < 0 {
+			d = 0
+		}
+		return d, true
+	}
+	return 0, false
+}
@@ -0,0 +1,302 @@
+package confluence
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/shaunpua/updoc/internal/config"
+)
+
+// reply is a scripted response: a status and, if set, a Retry-After header
+type reply struct {
+	status     int
+	retryAfter string
+}
+
+// scriptedSite serves replies in order, then 200s, and counts the requests
+type scriptedSite struct {
+	mu       sync.Mutex
+	replies  []reply
+	requests int
+}
+
+func (s *scriptedSite) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.requests++
+	next := reply{status: http.StatusOK}
+	if len(s.replies) > 0 {
+		next, s.replies = s.replies[0], s.replies[1:]
+	}
+	s.mu.Unlock()
+
+	if next.retryAfter != "" {
+		w.Header().Set("Retry-After", next.retryAfter)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(next.status)
+	if next.status == http.StatusOK {
+		_, _ = io.WriteString(w, `{"accountId":"557058:bot","displayName":"Bot"}`)
+	}
+}
+
+func (s *scriptedSite) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+func testConfig() config.ConfluenceConfig {
+	return config.ConfluenceConfig{
+		Timeout:          5 * time.Second,
+		MaxRetries:       3,
+		RetryBaseDelay:   time.Millisecond,
+		RetryMaxDelay:    50 * time.Millisecond,
+		RateLimit:        1000,
+		RateBurst:        1000,
+		BreakerThreshold: 2,
+		BreakerCooldown:  time.Hour,
+	}
+}
+
+// newTestSite starts a scripted site and returns a Site calling it with cfg
+func newTestSite(t *testing.T, cfg config.ConfluenceConfig, replies ...reply) (*Site, *scriptedSite) {
+	t.Helper()
+	script := &scriptedSite{replies: replies}
+	srv := httptest.NewServer(script)
+	t.Cleanup(srv.Close)
+	client := New(cfg, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	return client.Site("acme", Credentials{BaseURL: srv.URL, Username: "bot", Token: "secret"}), script
+}
+
+func TestCallRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		replies  []reply
+		post     bool
+		status   int // 0 means the call succeeds
+		requests int
+	}{
+		{"success", nil, false, 0, 1},
+		{"server errors then success", []reply{{status: 503}, {status: 502}}, false, 0, 3},
+		{"rate limited then success", []reply{{status: 429}}, false, 0, 2},
+		{"retries exhausted", []reply{{status: 500}, {status: 500}, {status: 500}, {status: 500}}, false, 500, 4},
+		{"client error not retried", []reply{{status: 404}}, false, 404, 1},
+		{"retry-after within max honoured", []reply{{status: 429, retryAfter: "0"}}, false, 0, 2},
+		{"retry-after beyond max gives up", []reply{{status: 429, retryAfter: "60"}}, false, 429, 1},
+		{"post not retried after server error", []reply{{status: 503}}, true, 503, 1},
+		{"post retried when rate limited", []reply{{status: 429}}, true, 0, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			site, script := newTestSite(t, testConfig(), tt.replies...)
+
+			var err error
+			if tt.post {
+				err = site.AddLabels(context.Background(), "101", "stale")
+			} else {
+				_, err = site.CurrentUser(context.Background())
+			}
+
+			var apiErr *APIError
+			switch {
+			case tt.status == 0 && err != nil:
+				t.Errorf("err = %v, want success", err)
+			case tt.status != 0 && (!errors.As(err, &apiErr) || apiErr.StatusCode != tt.status):
+				t.Errorf("err = %v, want HTTP %d", err, tt.status)
+			}
+			if got := script.count(); got != tt.requests {
+				t.Errorf("requests = %d, want %d", got, tt.requests)
+			}
+		})
+	}
+}
+
+func TestCallWaitsForRetryAfter(t *testing.T) {
+	cfg := testConfig()
+	cfg.RetryMaxDelay = 2 * time.Second
+	site, script := newTestSite(t, cfg, reply{status: 429, retryAfter: "1"})
+
+	start := time.Now()
+	if _, err := site.CurrentUser(context.Background()); err != nil {
+		t.Fatalf("CurrentUser: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("retried after %v, want at least the 1s Retry-After", elapsed)
+	}
+	if got := script.count(); got != 2 {
+		t.Errorf("requests = %d, want 2", got)
+	}
+}
+
+func TestCallGivesUpBeforeDeadline(t *testing.T) {
+	cfg := testConfig()
+	cfg.RetryMaxDelay = time.Minute
+	site, script := newTestSite(t, cfg, reply{status: 429, retryAfter: "30"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	_, err := site.CurrentUser(ctx)
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("err = %v, want the 429 without waiting past the deadline", err)
+	}
+	if got := script.count(); got != 1 {
+		t.Errorf("requests = %d, want 1", got)
+	}
+}
+
+func TestCallOpensBreaker(t *testing.T) {
+	cfg := testConfig()
+	cfg.MaxRetries = 0
+	site, script := newTestSite(t, cfg, reply{status: 503}, reply{status: 503})
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if _, err := site.CurrentUser(ctx); err == nil {
+			t.Fatalf("call %d succeeded, want a 503", i+1)
+		}
+	}
+	if !site.client.Degraded("acme") {
+		t.Fatal("Degraded = false after reaching the threshold")
+	}
+	if _, err := site.CurrentUser(ctx); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("err = %v, want ErrCircuitOpen", err)
+	}
+	if got := script.count(); got != 2 {
+		t.Errorf("requests = %d, want 2: an open breaker must not call the site", got)
+	}
+	if site.client.Degraded("globex") {
+		t.Error("another organization's breaker opened too")
+	}
+}
+
+func TestBreaker(t *testing.T) {
+	const cooldown = 20 * time.Millisecond
+
+	t.Run("client errors don't count", func(t *testing.T) {
+		b := newBreaker(2, cooldown, nil)
+		for i := 0; i < 3; i++ {
+			if err := b.allow(); err != nil {
+				t.Fatal(err)
+			}
+			b.record(outcomeFor(&APIError{StatusCode: http.StatusNotFound}))
+		}
+		if b.state() != stateClosed {
+			t.Errorf("state = %v, want closed", b.state())
+		}
+	})
+
+	t.Run("success resets the count", func(t *testing.T) {
+		b := newBreaker(2, cooldown, nil)
+		b.record(outcomeFailure)
+		b.record(outcomeSuccess)
+		b.record(outcomeFailure)
+		if b.state() != stateClosed {
+			t.Errorf("state = %v, want closed", b.state())
+		}
+	})
+
+	t.Run("half-open trial", func(t *testing.T) {
+		var changes []bool
+		b := newBreaker(2, cooldown, func(open bool) { changes = append(changes, open) })
+		b.record(outcomeFailure)
+		b.record(outcomeFailure)
+		if err := b.allow(); !errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("allow during cooldown = %v, want ErrCircuitOpen", err)
+		}
+
+		time.Sleep(cooldown)
+		if err := b.allow(); err != nil {
+			t.Fatalf("allow after cooldown = %v, want the trial call", err)
+		}
+		if b.state() != stateHalfOpen {
+			t.Fatalf("state = %v, want half-open", b.state())
+		}
+		if err := b.allow(); !errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("second allow during the trial = %v, want ErrCircuitOpen", err)
+		}
+
+		// A failed trial opens the breaker for another cooldown
+		b.record(outcomeFailure)
+		if err := b.allow(); !errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("allow after a failed trial = %v, want ErrCircuitOpen", err)
+		}
+
+		time.Sleep(cooldown)
+		if err := b.allow(); err != nil {
+			t.Fatalf("allow after the second cooldown = %v", err)
+		}
+		b.record(outcomeSuccess)
+		if b.state() != stateClosed {
+			t.Errorf("state = %v after a successful trial, want closed", b.state())
+		}
+		if want := []bool{true, false}; len(changes) != 2 || changes[0] != want[0] || changes[1] != want[1] {
+			t.Errorf("onChange calls = %v, want %v", changes, want)
+		}
+	})
+
+	t.Run("abandoned trial", func(t *testing.T) {
+		b := newBreaker(1, cooldown, nil)
+		b.record(outcomeFailure)
+		time.Sleep(cooldown)
+		if err := b.allow(); err != nil {
+			t.Fatal(err)
+		}
+		b.record(outcomeIgnored)
+		if err := b.allow(); err != nil {
+			t.Errorf("allow after an abandoned trial = %v, want another trial", err)
+		}
+	})
+}
+
+func TestBackoff(t *testing.T) {
+	base, max := 100*time.Millisecond, time.Second
+	tests := []struct {
+		attempt int
+		ceiling time.Duration
+	}{
+		{0, 100 * time.Millisecond},
+		{1, 200 * time.Millisecond},
+		{3, 800 * time.Millisecond},
+		{4, time.Second},
+		{20, time.Second},
+	}
+	for _, tt := range tests {
+		for i := 0; i < 100; i++ {
+			d := backoff(base, max, tt.attempt)
+			if d < tt.ceiling/2 || d > tt.ceiling {
+				t.Fatalf("backoff(attempt %d) = %v, want between %v and %v", tt.attempt, d, tt.ceiling/2, tt.ceiling)
+			}
+		}
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value string
+		want  time.Duration
+		ok    bool
+	}{
+		{"", 0, false},
+		{"120", 2 * time.Minute, true},
+		{" 5 ", 5 * time.Second, true},
+		{"-1", 0, false},
+		{"soon", 0, false},
+		{now.Add(30 * time.Second).Format(http.TimeFormat), 30 * time.Second, true},
+		{now.Add(-time.Minute).Format(http.TimeFormat), 0, true},
+	}
+	for _, tt := range tests {
+		got, ok := parseRetryAfter(tt.value, now)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("parseRetryAfter(%q) = %v, %v, want %v, %v", tt.value, got, ok, tt.want, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package confluence
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+// CreateComment adds a footer comment to a page, with body in the storage
+// format, and returns it
+func (s *Site) CreateComment(ctx context.Context, pageID, body string) (*Content, error) {
+	req := map[string]interface{}{
+		"type":      "comment",
+		"container": map[string]string{"id": pageID, "type": "page"},
+		"body":      map[string]ContentBody{"storage": {Value: body, Representation: "storage"}},
+	}
+	var comment Content
+	if err := s.send(ctx, http.MethodPost, "/rest/api/content", req, &comment); err != nil {
+		return nil, err
+	}
+	return &comment, nil
+}
+
+// UpdateComment replaces a comment's body. version is the comment's new
+// version number, one more than its current one; Confluence rejects any
+// other with a 409.
+func (s *Site) UpdateComment(ctx context.Context, id string, version int, body string) (*Content, error) {
+	req := map[string]interface{}{
+		"type":    "comment",
+		"version": map[string]int{"number": version},
+		"body":    map[string]ContentBody{"storage": {Value: body, Representation: "storage"}},
+	}
+	var comment Content
+	if err := s.send(ctx, http.MethodPut, "/rest/api/content/"+url.PathEscape(id), req, &comment); err != nil {
+		return nil, err
+	}
+	return &comment, nil
+}
+
+// DeleteContent moves a page, blog post or comment to the trash
+func (s *Site) DeleteContent(ctx context.Context, id string) error {
+	return s.send(ctx, http.MethodDelete, "/rest/api/content/"+url.PathEscape(id), nil, nil)
+}
+
+// AddLabels adds global labels to a page; labels it already has are kept
+func (s *Site) AddLabels(ctx context.Context, pageID string, names ...string) error {
+	labels := make([]map[string]string, len(names))
+	for i, name := range names {
+		labels[i] = map[string]string{"prefix": "global", "name": name}
+	}
+	return s.send(ctx, http.MethodPost, "/rest/api/content/"+url.PathEscape(pageID)+"/label", labels, nil)
+}
+
+// RemoveLabel removes a label from a page. Confluence answers 404 if the
+// page doesn't have it.
+func (s *Site) RemoveLabel(ctx context.Context, pageID, name string) error {
+	return s.send(ctx, http.MethodDelete, "/rest/api/content/"+url.PathEscape(pageID)+"/label/"+url.PathEscape(name), nil, nil)
+}
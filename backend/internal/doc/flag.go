@@ -1,141 +1,156 @@
 package doc
 
-import "time"
+import (
+	"context"
+	"time"
+
+	"github.com/shaunpua/updoc/pkg/api"
+)
 
 // Repository interfaces
 type OrganizationRepository interface {
-	Create(org *Organization) error
-	GetBySlug(slug string) (*Organization, error)
-	GetByID(id string) (*Organization, error)
+	Create(ctx context.Context, org *Organization) error
+	GetBySlug(ctx context.Context, slug string) (*Organization, error)
+	GetByID(ctx context.Context, id string) (*Organization, error)
+	List(ctx context.Context) ([]*Organization, error)
+	// UpdateConfluence saves org's Confluence connection, e.g. after an OAuth grant
+	UpdateConfluence(ctx context.Context, org *Organization) error
+	// SaveConfluenceToken stores a refreshed OAuth grant
+	SaveConfluenceToken(ctx context.Context, id, accessToken, refreshToken string, expiry time.Time) error
 }
 
 type UserRepository interface {
-	Create(user *User) error
-	GetByEmail(email string) (*User, error)
-	GetByOrgID(orgID string) ([]*User, error)
-	GetByID(id string) (*User, error)
+	Create(ctx context.Context, user *User) error
+	GetByEmail(ctx context.Context, email string) (*User, error)
+	GetByOrgID(ctx context.Context, orgID string) ([]*User, error)
+	GetByID(ctx context.Context, id string) (*User, error)
+	GetByAPITokenHash(ctx context.Context, hash string) (*User, error)
+	SetAPITokenHash(ctx context.Context, id, hash string) error
 }
 
 type WorkspaceRepository interface {
-	Create(workspace *Workspace) error
-	GetByOrgID(orgID string) ([]*Workspace, error)
-	GetByID(id string) (*Workspace, error)
-	UpdateIntegration(id string, config map[string]interface{}) error
+	Create(ctx context.Context, workspace *Workspace) error
+	GetByOrgID(ctx context.Context, orgID string) ([]*Workspace, error)
+	GetByID(ctx context.Context, id string) (*Workspace, error)
+	UpdateIntegration(ctx context.Context, id string, config map[string]interface{}) error
 }
 
 type DocumentRepository interface {
-	Create(doc *Document) error
-	GetByWorkspaceID(workspaceID string) ([]*Document, error)
-	GetByURL(url string) (*Document, error)
-	GetByID(id string) (*Document, error)
-	BulkCreate(docs []*Document) error
+	Create(ctx context.Context, doc *Document) error
+	GetByWorkspaceID(ctx context.Context, workspaceID string) ([]*Document, error)
+	// GetByURL returns the oldest document at url in any of the given
+	// workspaces; the same page may be tracked once per workspace
+	GetByURL(ctx context.Context, workspaceIDs []string, url string) (*Document, error)
+	GetByID(ctx context.Context, id string) (*Document, error)
+	// GetByExternalIDs returns the documents in the given workspaces whose
+	// external ID is one of externalIDs
+	GetByExternalIDs(ctx context.Context, workspaceIDs, externalIDs []string) ([]*Document, error)
+	BulkCreate(ctx context.Context, docs []*Document) error
+	Update(ctx context.Context, doc *Document) error
 }
 
 type FlagRepository interface {
-	Create(flag *Flag) error
-	GetByID(id string) (*Flag, error)
-	GetByDocumentID(documentID string) ([]*Flag, error)
-	GetByFilters(filters FlagFilters) ([]*Flag, error)
-	Update(flag *Flag) error
+	Create(ctx context.Context, flag *Flag) error
+	GetByID(ctx context.Context, id string) (*Flag, error)
+	GetByDocumentID(ctx context.Context, documentID string) ([]*Flag, error)
+	// GetByDocumentIDs returns the flags on any of documentIDs
+	GetByDocumentIDs(ctx context.Context, documentIDs []string) ([]*Flag, error)
+	GetByFilters(ctx context.Context, filters FlagFilters) ([]*Flag, error)
+	Update(ctx context.Context, flag *Flag) error
+	CountOpen(ctx context.Context) ([]FlagCount, error)
+	// CountOpenByDocument counts open flags per document, omitting documents without any
+	CountOpenByDocument(ctx context.Context, documentIDs []string) (map[string]int, error)
+	// GetWatched returns pending and in-progress flags with a recorded page
+	// version, with their documents, whose pages are watched for edits
+	GetWatched(ctx context.Context) ([]*Flag, error)
 }
 
 type NotificationRepository interface {
-	Create(notification *Notification) error
-	GetByUserID(userID string, limit int) ([]*Notification, error)
-	MarkAsRead(id string) error
-	MarkAllAsRead(userID string) error
+	Create(ctx context.Context, notification *Notification) error
+	GetByID(ctx context.Context, id string) (*Notification, error)
+	// GetByUserID returns a user's newest notifications first, only unread ones if unreadOnly
+	GetByUserID(ctx context.Context, userID string, unreadOnly bool, limit int) ([]*Notification, error)
+	MarkAsRead(ctx context.Context, id string) error
+	MarkAllAsRead(ctx context.Context, userID string) error
 }
 
-// Domain Models
+// Domain Models. Those sent over the API are defined in pkg/api, so the
+// server and pkg/client share them.
+type (
+	User         = api.User
+	Workspace    = api.Workspace
+	Document     = api.Document
+	Flag         = api.Flag
+	Notification = api.Notification
+
+	NotificationAction = api.NotificationAction
+
+	FlagFilters            = api.FlagFilters
+	CreateFlagRequest      = api.CreateFlagRequest
+	UpdateFlagRequest      = api.UpdateFlagRequest
+	CreateWorkspaceRequest = api.CreateWorkspaceRequest
+	SyncResult             = api.SyncResult
+)
+
+// Organization is an organization with its Confluence credentials, which
+// are never sent over the API
 type Organization struct {
-	ID        string    `json:"id"`
-	Name      string    `json:"name"`
-	Slug      string    `json:"slug"`
-	CreatedAt time.Time `json:"created_at"`
-	
-	// Confluence Integration
-	ConfluenceBaseURL  string `json:"confluence_base_url,omitempty"`
-	ConfluenceEmail    string `json:"confluence_email,omitempty"`
-	ConfluenceToken    string `json:"-"` // Never expose in JSON
-	ConfluenceSpaceKey string `json:"confluence_space_key,omitempty"`
-}
-
-type Workspace struct {
-	ID                string                 `json:"id"`
-	OrgID             string                 `json:"org_id"`
-	Name              string                 `json:"name"`
-	IntegrationType   string                 `json:"integration_type"`
-	IntegrationConfig map[string]interface{} `json:"integration_config"`
-	IsDefault         bool                   `json:"is_default"`
-	CreatedAt         time.Time              `json:"created_at"`
-}
-
-type Document struct {
-	ID          string    `json:"id"`
-	WorkspaceID string    `json:"workspace_id"`
-	Title       string    `json:"title"`
-	URL         string    `json:"url"`
-	ExternalID  string    `json:"external_id"`
-	OwnerID     string    `json:"owner_id"`
-	LastChecked time.Time `json:"last_checked"`
-	CreatedAt   time.Time `json:"created_at"`
-}
-
-type Flag struct {
-	ID          string     `json:"id"`
-	DocumentID  string     `json:"document_id"`
-	CreatedBy   string     `json:"created_by"`
-	AssignedTo  *string    `json:"assigned_to"`
-	Title       string     `json:"title"`
-	Description string     `json:"description"`
-	Priority    string     `json:"priority"`
-	Status      string     `json:"status"`
-	Resolution  string     `json:"resolution"`
-	ResolvedAt  *time.Time `json:"resolved_at"`
-	CreatedAt   time.Time  `json:"created_at"`
-	UpdatedAt   time.Time  `json:"updated_at"`
-
-	// Related entities (populated by repository)
-	Document *Document `json:"document,omitempty"`
-	Creator  *User     `json:"creator,omitempty"`
-	Assignee *User     `json:"assignee,omitempty"`
-}
+	api.Organization
 
-type Notification struct {
-	ID        string     `json:"id"`
-	UserID    string     `json:"user_id"`
-	FlagID    string     `json:"flag_id"`
-	Type      string     `json:"type"`
-	Message   string     `json:"message"`
-	ReadAt    *time.Time `json:"read_at"`
-	CreatedAt time.Time  `json:"created_at"`
+	ConfluenceToken string `json:"-"`
+	// OAuth connections (auth mode oauth): ConfluenceToken holds the access
+	// token, and calls go through the API gateway to ConfluenceCloudID
+	ConfluenceRefreshToken string    `json:"-"`
+	ConfluenceTokenExpiry  time.Time `json:"-"`
 }
 
-// Request/Response types
-type FlagFilters struct {
-	WorkspaceID string `json:"workspace_id"`
-	Status      string `json:"status"`
-	Priority    string `json:"priority"`
-	AssignedTo  string `json:"assigned_to"`
-	CreatedBy   string `json:"created_by"`
-	Search      string `json:"search"`
+// Flag priorities and statuses
+const (
+	PriorityUrgent = "urgent"
+	PriorityHigh   = "high"
+	PriorityMedium = "medium"
+	PriorityLow    = "low"
+
+	FlagStatusPending    = "pending"
+	FlagStatusInProgress = "in_progress"
+	FlagStatusResolved   = "resolved"
+	FlagStatusArchived   = "archived"
+	// FlagStatusAwaitingVerification means the page was edited since the
+	// flag was raised, and someone should confirm the edit fixes it
+	FlagStatusAwaitingVerification = "awaiting_verification"
+)
+
+// ValidPriority reports whether p is one of the known flag priorities
+func ValidPriority(p string) bool {
+	switch p {
+	case PriorityUrgent, PriorityHigh, PriorityMedium, PriorityLow:
+		return true
+	}
+	return false
 }
 
-type CreateFlagRequest struct {
-	DocumentID  string  `json:"document_id" validate:"required"`
-	Title       string  `json:"title" validate:"required,min=3,max=200"`
-	Description string  `json:"description" validate:"required,min=10,max=1000"`
-	Priority    string  `json:"priority" validate:"required,oneof=urgent high medium low"`
-	AssignedTo  *string `json:"assigned_to"`
+// ValidFlagStatus reports whether s is one of the known flag statuses
+func ValidFlagStatus(s string) bool {
+	switch s {
+	case FlagStatusPending, FlagStatusInProgress, FlagStatusAwaitingVerification, FlagStatusResolved, FlagStatusArchived:
+		return true
+	}
+	return false
 }
 
-type UpdateFlagRequest struct {
-	Title       *string `json:"title"`
-	Description *string `json:"description"`
-	Priority    *string `json:"priority"`
-	Status      *string `json:"status"`
-	AssignedTo  *string `json:"assigned_to"`
-	Resolution  *string `json:"resolution"`
+// Notification types
+const (
+	NotificationFlagResolved          = "flag_resolved"
+	NotificationFlagReopened          = "flag_reopened"
+	NotificationVerificationRequested = "verification_requested"
+	NotificationPageRemoved           = "page_removed"
+)
+
+// FlagCount is the number of flags sharing a priority and status
+type FlagCount struct {
+	Priority string `json:"priority"`
+	Status   string `json:"status"`
+	Count    int64  `json:"count"`
 }
 
 // Legacy types (for backward compatibility during migration)
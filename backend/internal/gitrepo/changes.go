@@ -0,0 +1,91 @@
+package gitrepo
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Commit is a commit and the files it changed
+type Commit struct {
+	Hash        string    `json:"hash"`
+	Author      string    `json:"author"`
+	AuthorEmail string    `json:"author_email"`
+	Time        time.Time `json:"time"`
+	Subject     string    `json:"subject"`
+	// Files are the paths the commit added, changed or deleted; a rename
+	// lists both the old and the new path
+	Files []string `json:"files"`
+}
+
+// Commits lists the commits reachable from to but not from, newest first,
+// at most limit of them. With from empty only to itself is listed. Merge
+// commits list no files, as what they bring in is in the commits merged.
+func (r *Repo) Commits(ctx context.Context, from, to string, limit int) ([]Commit, error) {
+	rev := from + ".." + to
+	if from == "" {
+		rev, limit = to, 1
+	}
+	out, err := r.git(ctx, r.g.cfg.Timeout, nil,
+		"log", "-z", "--no-renames", "--name-only", "--max-count="+strconv.Itoa(limit),
+		"--format=%x1e%H%x1f%an%x1f%ae%x1f%cI%x1f%s", "--end-of-options", rev, "--")
+	if err != nil {
+		return nil, err
+	}
+
+	// Each commit is "\x1e<header>\x00\n" and then its paths, each ending in \x00
+	var commits []Commit
+	for _, record := range strings.Split(string(out), "\x1e") {
+		header, names, _ := strings.Cut(record, "\x00")
+		fields := strings.SplitN(header, "\x1f", 5)
+		if len(fields) != 5 {
+			continue
+		}
+		at, _ := time.Parse(time.RFC3339, fields[3])
+		commit := Commit{Hash: fields[0], Author: fields[1], AuthorEmail: fields[2], Time: at, Subject: fields[4]}
+		for _, name := range strings.Split(strings.TrimPrefix(names, "\n"), "\x00") {
+			if name != "" {
+				commit.Files = append(commit.Files, name)
+			}
+		}
+		commits = append(commits, commit)
+	}
+	return commits, nil
+}
+
+// symbolPattern is what Mentioning accepts: an identifier, or identifiers
+// joined by dots such as billing.Charge
+var symbolPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)*$`)
+
+// ValidSymbol reports whether Mentioning can look for symbol
+func ValidSymbol(symbol string) bool {
+	return len(symbol) <= 200 && symbolPattern.MatchString(symbol)
+}
+
+// Mentioning returns which commits in the range Commits takes added or
+// removed a line naming symbol as a whole word
+func (r *Repo) Mentioning(ctx context.Context, from, to, symbol string) (map[string]bool, error) {
+	if !ValidSymbol(symbol) {
+		return nil, fmt.Errorf("symbol %q is not an identifier", symbol)
+	}
+	// git takes -G as a POSIX extended regexp, which has no \b
+	pattern := "(^|[^A-Za-z0-9_])" + strings.ReplaceAll(symbol, ".", "[.]") + "([^A-Za-z0-9_]|$)"
+	args := []string{"log", "--format=%H", "-G" + pattern}
+	rev := from + ".." + to
+	if from == "" {
+		rev = to
+		args = append(args, "--max-count=1")
+	}
+	out, err := r.git(ctx, r.g.cfg.Timeout, nil, append(args, "--end-of-options", rev, "--")...)
+	if err != nil {
+		return nil, err
+	}
+	matched := make(map[string]bool)
+	for _, hash := range strings.Fields(string(out)) {
+		matched[hash] = true
+	}
+	return matched, nil
+}
@@ -0,0 +1,116 @@
+package gitrepo
+
+import (
+	"regexp"
+	"strings"
+)
+
+// CodeownersPaths are where GitHub and GitLab look for a CODEOWNERS file, in
+// the order they look
+var CodeownersPaths = []string{".github/CODEOWNERS", "CODEOWNERS", "docs/CODEOWNERS", ".gitlab/CODEOWNERS"}
+
+// Codeowners is a parsed CODEOWNERS file
+type Codeowners struct {
+	rules []ownerRule
+}
+
+type ownerRule struct {
+	pattern *regexp.Regexp
+	owners  []string
+}
+
+// ParseCodeowners reads a CODEOWNERS file: one gitignore-style pattern per
+// line followed by its owners, @users, @org/teams or emails. Comments,
+// GitLab section headers and patterns that don't parse are skipped.
+func ParseCodeowners(data []byte) *Codeowners {
+	c := &Codeowners{}
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "[") || strings.HasPrefix(line, "^[") {
+			continue
+		}
+		if i := strings.Index(line, " #"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		pattern, err := regexp.Compile(ownersPattern(fields[0]))
+		if err != nil {
+			continue
+		}
+		c.rules = append(c.rules, ownerRule{pattern: pattern, owners: fields[1:]})
+	}
+	return c
+}
+
+// Owners returns the owners of path, those of the last pattern matching it.
+// A pattern without owners leaves the path unowned.
+func (c *Codeowners) Owners(path string) []string {
+	if c == nil {
+		return nil
+	}
+	for i := len(c.rules) - 1; i >= 0; i-- {
+		if c.rules[i].pattern.MatchString(path) {
+			return c.rules[i].owners
+		}
+	}
+	return nil
+}
+
+// ownersPattern turns a gitignore-style pattern into a regexp. A pattern
+// with a slash before its end is anchored at the repository root, and one
+// without matches at any depth. A pattern naming a directory matches its
+// whole contents, but as on GitHub, docs/* only matches the files directly
+// in docs.
+func ownersPattern(p string) string {
+	anchored := strings.Contains(strings.TrimSuffix(p, "/"), "/")
+	p = strings.TrimPrefix(strings.TrimSuffix(p, "/"), "/")
+	prefix, suffix := "^", "(?:/.*)?$"
+	if !anchored {
+		prefix = "^(?:.*/)?"
+	}
+	if strings.ContainsAny(p[strings.LastIndex(p, "/")+1:], "*?") {
+		suffix = "$"
+	}
+	return prefix + globPattern(p) + suffix
+}
+
+// Glob matches repository paths against a pattern where * matches within a
+// path segment, ? one character of one, and ** any number of whole segments
+type Glob struct {
+	re *regexp.Regexp
+}
+
+func CompileGlob(pattern string) (*Glob, error) {
+	re, err := regexp.Compile("^" + globPattern(strings.TrimPrefix(pattern, "/")) + "$")
+	if err != nil {
+		return nil, err
+	}
+	return &Glob{re: re}, nil
+}
+
+func (g *Glob) Match(path string) bool { return g.re.MatchString(path) }
+
+// globPattern is the regexp body matching what glob does
+func globPattern(glob string) string {
+	var b strings.Builder
+	for i := 0; i < len(glob); i++ {
+		switch ch := glob[i]; {
+		case strings.HasPrefix(glob[i:], "**/"):
+			b.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case ch == '*':
+			b.WriteString("[^/]*")
+		case ch == '?':
+			b.WriteString("[^/]")
+		case ch == '\\' && i+1 < len(glob):
+			i++
+			b.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		default:
+			b.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,641 @@
+package gitrepo
+
+import (
+	"fmt"
+	"html"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Markdown is a Markdown or MDX file split into its metadata and body
+type Markdown struct {
+	// Title is the front matter's title, else the first level-one heading,
+	// else the file name
+	Title string
+	// Labels are the front matter's tags or labels
+	Labels []string
+	// Body is the Markdown without front matter, and for MDX without its
+	// import and export statements
+	Body string
+}
+
+// frontMatter is the YAML block some generators put at the top of a page
+type frontMatter struct {
+	Title  string      `yaml:"title"`
+	Tags   interface{} `yaml:"tags"`
+	Labels interface{} `yaml:"labels"`
+}
+
+var (
+	atxHeading   = regexp.MustCompile(`^ {0,3}(#{1,6})(?:[ \t]+(.*?))?(?:[ \t]+#+)?[ \t]*$`)
+	thematic     = regexp.MustCompile(`^ {0,3}(?:(?:-[ \t]*){3,}|(?:\*[ \t]*){3,}|(?:_[ \t]*){3,})$`)
+	fence        = regexp.MustCompile("^( {0,3})(`{3,}|~{3,})[ \t]*([^`\\s]*)")
+	listItem     = regexp.MustCompile(`^( {0,3})([-*+]|\d{1,9}[.)])(?:[ \t]+|$)`)
+	setextUnder  = regexp.MustCompile(`^ {0,3}(=+|-+)[ \t]*$`)
+	tableDivider = regexp.MustCompile(`^ {0,3}\|?[ \t]*:?-+:?[ \t]*(?:\|[ \t]*:?-+:?[ \t]*)*\|?[ \t]*$`)
+	taskMarker   = regexp.MustCompile(`^\[([ xX])\][ \t]+`)
+	mdxStatement = regexp.MustCompile(`^(?:import|export)\s`)
+)
+
+// ParseMarkdown reads the file at name, an .md or .mdx file
+func ParseMarkdown(name string, data []byte) *Markdown {
+	body := strings.ReplaceAll(string(data), "\r\n", "\n")
+	body = strings.TrimPrefix(body, "\ufeff")
+	md := &Markdown{}
+
+	if rest, ok := strings.CutPrefix(body, "---\n"); ok {
+		if end := strings.Index(rest, "\n---\n"); end >= 0 || strings.HasSuffix(rest, "\n---") {
+			if end < 0 {
+				end = len(rest) - len("\n---")
+			}
+			var fm frontMatter
+			if yaml.Unmarshal([]byte(rest[:end]), &fm) == nil {
+				md.Title = strings.TrimSpace(fm.Title)
+				md.Labels = append(stringList(fm.Tags), stringList(fm.Labels)...)
+			}
+			body = strings.TrimPrefix(rest[end:], "\n---")
+			body = strings.TrimPrefix(body, "\n")
+		}
+	}
+
+	if strings.EqualFold(path.Ext(name), ".mdx") {
+		var kept []string
+		inFence := false
+		for _, line := range strings.Split(body, "\n") {
+			if fence.MatchString(line) {
+				inFence = !inFence
+			}
+			if !inFence && mdxStatement.MatchString(line) {
+				continue
+			}
+			kept = append(kept, line)
+		}
+		body = strings.Join(kept, "\n")
+	}
+	md.Body = strings.TrimSpace(body) + "\n"
+
+	if md.Title == "" {
+		inFence := false
+		for _, line := range strings.Split(md.Body, "\n") {
+			if fence.MatchString(line) {
+				inFence = !inFence
+			}
+			if m := atxHeading.FindStringSubmatch(line); !inFence && m != nil && m[1] == "#" && m[2] != "" {
+				md.Title = stripInline(m[2])
+				break
+			}
+		}
+	}
+	if md.Title == "" {
+		base := strings.TrimSuffix(path.Base(name), path.Ext(name))
+		md.Title = strings.NewReplacer("-", " ", "_", " ").Replace(base)
+	}
+	return md
+}
+
+// stringList reads a front matter list, which may also be a comma-separated
+// string
+func stringList(v interface{}) []string {
+	var out []string
+	switch v := v.(type) {
+	case string:
+		for _, s := range strings.Split(v, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				out = append(out, s)
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			if s := strings.TrimSpace(fmt.Sprint(item)); s != "" {
+				out = append(out, s)
+			}
+		}
+	}
+	return out
+}
+
+// stripInline drops the markup from a line of inline Markdown
+func stripInline(s string) string {
+	s = linkPattern.ReplaceAllString(s, "$1")
+	return strings.TrimSpace(strings.NewReplacer("**", "", "__", "", "`", "", "~~", "").Replace(s))
+}
+
+// RenderOptions give the context a file's relative links are resolved in
+type RenderOptions struct {
+	// BaseURL is the file's own URL, such as
+	// https://github.com/acme/docs/blob/main/guides/setup.md. Without one,
+	// relative links are dropped and their text kept.
+	BaseURL string
+}
+
+// RenderHTML renders Markdown as HTML that is safe to embed: CommonMark's
+// blocks and inlines, with GitHub's tables, task lists and strikethrough.
+// Raw HTML and JSX are escaped rather than passed through, and links and
+// images are limited to http, https and mailto URLs.
+func RenderHTML(body string, opts RenderOptions) string {
+	r := &renderer{opts: opts}
+	if base, err := url.Parse(opts.BaseURL); err == nil && opts.BaseURL != "" {
+		r.base = base
+	}
+	var b strings.Builder
+	r.blocks(&b, strings.Split(strings.TrimRight(body, "\n"), "\n"), false)
+	return b.String()
+}
+
+type renderer struct {
+	opts RenderOptions
+	base *url.URL
+}
+
+// blocks renders lines as block elements. In a tight list item, paragraphs
+// are written without <p>.
+func (r *renderer) blocks(b *strings.Builder, lines []string, tight bool) {
+	var para []string
+	flush := func() {
+		if len(para) == 0 {
+			return
+		}
+		text := r.inline(strings.TrimSpace(strings.Join(para, "\n")))
+		if tight {
+			b.WriteString(text)
+		} else {
+			b.WriteString("<p>" + text + "</p>\n")
+		}
+		para = nil
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+
+		switch {
+		case trimmed == "":
+			flush()
+
+		case len(para) > 0 && setextUnder.MatchString(line):
+			level := "h1"
+			if strings.HasPrefix(trimmed, "-") {
+				level = "h2"
+			}
+			text := r.inline(strings.TrimSpace(strings.Join(para, " ")))
+			para = nil
+			fmt.Fprintf(b, "<%s>%s</%s>\n", level, text, level)
+
+		case atxHeading.MatchString(line):
+			flush()
+			m := atxHeading.FindStringSubmatch(line)
+			fmt.Fprintf(b, "<h%d>%s</h%d>\n", len(m[1]), r.inline(m[2]), len(m[1]))
+
+		case thematic.MatchString(line):
+			flush()
+			b.WriteString("<hr>\n")
+
+		case fence.MatchString(line):
+			flush()
+			m := fence.FindStringSubmatch(line)
+			indent, marker, lang := len(m[1]), m[2], m[3]
+			var code []string
+			for i++; i < len(lines); i++ {
+				if strings.HasPrefix(strings.TrimSpace(lines[i]), marker) && strings.Trim(strings.TrimSpace(lines[i]), marker[:1]) == "" {
+					break
+				}
+				code = append(code, trimIndent(lines[i], indent))
+			}
+			b.WriteString("<pre><code")
+			if lang != "" {
+				b.WriteString(` class="language-` + html.EscapeString(lang) + `"`)
+			}
+			b.WriteString(">" + html.EscapeString(strings.Join(code, "\n")))
+			if len(code) > 0 {
+				b.WriteString("\n")
+			}
+			b.WriteString("</code></pre>\n")
+
+		case len(para) == 0 && (strings.HasPrefix(line, "    ") || strings.HasPrefix(line, "\t")):
+			var code []string
+			for ; i < len(lines); i++ {
+				if strings.TrimSpace(lines[i]) != "" && !strings.HasPrefix(lines[i], "    ") && !strings.HasPrefix(lines[i], "\t") {
+					break
+				}
+				code = append(code, trimIndent(lines[i], 4))
+			}
+			i--
+			for len(code) > 0 && strings.TrimSpace(code[len(code)-1]) == "" {
+				code = code[:len(code)-1]
+			}
+			b.WriteString("<pre><code>" + html.EscapeString(strings.Join(code, "\n")) + "\n</code></pre>\n")
+
+		case strings.HasPrefix(trimmed, ">"):
+			flush()
+			var quoted []string
+			for ; i < len(lines); i++ {
+				t := strings.TrimSpace(lines[i])
+				if !strings.HasPrefix(t, ">") {
+					break
+				}
+				t = strings.TrimPrefix(t, ">")
+				quoted = append(quoted, strings.TrimPrefix(t, " "))
+			}
+			i--
+			b.WriteString("<blockquote>\n")
+			r.blocks(b, quoted, false)
+			b.WriteString("</blockquote>\n")
+
+		case listItem.MatchString(line) && (len(para) == 0 || interruptsParagraph(line)):
+			flush()
+			i = r.list(b, lines, i) - 1
+
+		case len(para) == 0 && strings.Contains(line, "|") && i+1 < len(lines) && tableDivider.MatchString(lines[i+1]):
+			i = r.table(b, lines, i) - 1
+
+		default:
+			para = append(para, line)
+		}
+	}
+	flush()
+}
+
+// list renders the list starting at lines[start] and returns the index of
+// the first line after it
+func (r *renderer) list(b *strings.Builder, lines []string, start int) int {
+	first := listItem.FindStringSubmatch(lines[start])
+	marker := first[2]
+	tag := "ul"
+	if ordered(marker) {
+		tag = "ol"
+		if n := strings.TrimLeft(marker[:len(marker)-1], "0"); n != "1" && n != "" {
+			tag += ` start="` + n + `"`
+		}
+	}
+	b.WriteString("<" + tag + ">\n")
+
+	type item struct{ lines []string }
+	var items []item
+	loose := false
+	i := start
+	for i < len(lines) {
+		m := listItem.FindStringSubmatch(lines[i])
+		if m == nil || !sameList(marker, m[2]) {
+			break
+		}
+		width := len(m[0])
+		content := []string{lines[i][width:]}
+		if strings.TrimSpace(content[0]) == "" {
+			width = len(m[1]) + len(m[2]) + 1
+		}
+		for i++; i < len(lines); i++ {
+			line := lines[i]
+			if strings.TrimSpace(line) == "" {
+				// A blank line ends the list unless an indented line follows
+				if i+1 < len(lines) && indentOf(lines[i+1]) >= width {
+					content = append(content, "")
+					loose = true
+					continue
+				}
+				break
+			}
+			if indentOf(line) >= width {
+				content = append(content, trimIndent(line, width))
+				continue
+			}
+			// Unindented lines continue the item's paragraph, lazily
+			if startsBlock(line) {
+				break
+			}
+			content = append(content, strings.TrimSpace(line))
+		}
+		items = append(items, item{lines: content})
+		// Skip blank lines between items, which make the list loose
+		if i < len(lines) && strings.TrimSpace(lines[i]) == "" {
+			j := i
+			for j < len(lines) && strings.TrimSpace(lines[j]) == "" {
+				j++
+			}
+			if j < len(lines) {
+				if m := listItem.FindStringSubmatch(lines[j]); m != nil && sameList(marker, m[2]) {
+					loose = true
+					i = j
+				}
+			}
+		}
+	}
+
+	for _, it := range items {
+		b.WriteString("<li>")
+		content := it.lines
+		if m := taskMarker.FindStringSubmatch(content[0]); m != nil {
+			if m[1] == " " {
+				b.WriteString(`<input type="checkbox" disabled> `)
+			} else {
+				b.WriteString(`<input type="checkbox" checked disabled> `)
+			}
+			content = append([]string{content[0][len(m[0]):]}, content[1:]...)
+		}
+		r.itemBody(b, content, !loose)
+		b.WriteString("</li>\n")
+	}
+	b.WriteString("</" + tag[:2] + ">\n")
+	return i
+}
+
+func ordered(marker string) bool {
+	return marker != "-" && marker != "*" && marker != "+"
+}
+
+// sameList reports whether an item marked b continues the list whose first
+// item is marked a: the same bullet, or numbers with the same delimiter
+func sameList(a, b string) bool {
+	if ordered(a) != ordered(b) {
+		return false
+	}
+	return a[len(a)-1] == b[len(b)-1]
+}
+
+// interruptsParagraph reports whether the list item line starts a list
+// right after a paragraph line, which only bullets and lists starting at 1
+// do
+func interruptsParagraph(line string) bool {
+	marker := listItem.FindStringSubmatch(line)[2]
+	return !ordered(marker) || strings.TrimLeft(marker[:len(marker)-1], "0") == "1"
+}
+
+// itemBody renders a list item's lines. A tight item's leading paragraph is
+// written inline, and its other blocks as usual.
+func (r *renderer) itemBody(b *strings.Builder, lines []string, tight bool) {
+	if !tight {
+		r.blocks(b, lines, false)
+		return
+	}
+	end := 0
+	for end < len(lines) && strings.TrimSpace(lines[end]) != "" && (end == 0 || !startsBlock(lines[end])) {
+		end++
+	}
+	r.blocks(b, lines[:end], true)
+	if end < len(lines) {
+		b.WriteString("\n")
+		r.blocks(b, lines[end:], false)
+	}
+}
+
+// startsBlock reports whether line opens a block that interrupts a paragraph
+func startsBlock(line string) bool {
+	return listItem.MatchString(line) || atxHeading.MatchString(line) || fence.MatchString(line) ||
+		thematic.MatchString(line) || strings.HasPrefix(strings.TrimSpace(line), ">")
+}
+
+// table renders the GitHub table starting at lines[start] and returns the
+// index of the first line after it
+func (r *renderer) table(b *strings.Builder, lines []string, start int) int {
+	header := tableCells(lines[start])
+	var aligns []string
+	for _, cell := range tableCells(lines[start+1]) {
+		switch {
+		case strings.HasPrefix(cell, ":") && strings.HasSuffix(cell, ":"):
+			aligns = append(aligns, "center")
+		case strings.HasSuffix(cell, ":"):
+			aligns = append(aligns, "right")
+		case strings.HasPrefix(cell, ":"):
+			aligns = append(aligns, "left")
+		default:
+			aligns = append(aligns, "")
+		}
+	}
+	row := func(tag string, cells []string) {
+		b.WriteString("<tr>")
+		for j := range header {
+			cell := ""
+			if j < len(cells) {
+				cell = cells[j]
+			}
+			b.WriteString("<" + tag)
+			if j < len(aligns) && aligns[j] != "" {
+				b.WriteString(` style="text-align: ` + aligns[j] + `"`)
+			}
+			b.WriteString(">" + r.inline(cell) + "</" + tag + ">")
+		}
+		b.WriteString("</tr>\n")
+	}
+
+	b.WriteString("<table>\n<thead>\n")
+	row("th", header)
+	b.WriteString("</thead>\n<tbody>\n")
+	i := start + 2
+	for ; i < len(lines) && strings.TrimSpace(lines[i]) != "" && strings.Contains(lines[i], "|"); i++ {
+		row("td", tableCells(lines[i]))
+	}
+	b.WriteString("</tbody>\n</table>\n")
+	return i
+}
+
+// tableCells splits a table row on pipes that aren't escaped
+func tableCells(line string) []string {
+	line = strings.TrimSpace(line)
+	line = strings.TrimPrefix(line, "|")
+	if strings.HasSuffix(line, "|") && !strings.HasSuffix(line, `\|`) {
+		line = line[:len(line)-1]
+	}
+	var cells []string
+	var cell strings.Builder
+	for i := 0; i < len(line); i++ {
+		switch {
+		case line[i] == '\\' && i+1 < len(line) && line[i+1] == '|':
+			cell.WriteByte('|')
+			i++
+		case line[i] == '|':
+			cells = append(cells, strings.TrimSpace(cell.String()))
+			cell.Reset()
+		default:
+			cell.WriteByte(line[i])
+		}
+	}
+	return append(cells, strings.TrimSpace(cell.String()))
+}
+
+func indentOf(line string) int {
+	n := 0
+	for _, ch := range line {
+		switch ch {
+		case ' ':
+			n++
+		case '\t':
+			n += 4 - n%4
+		default:
+			return n
+		}
+	}
+	return n
+}
+
+// trimIndent removes up to n columns of leading whitespace
+func trimIndent(line string, n int) string {
+	col := 0
+	for i, ch := range line {
+		if col >= n || (ch != ' ' && ch != '\t') {
+			return line[i:]
+		}
+		if ch == '\t' {
+			col += 4 - col%4
+		} else {
+			col++
+		}
+	}
+	return ""
+}
+
+var (
+	linkPattern     = regexp.MustCompile(`!?\[([^\]]*)\]\(\s*<?([^)\s>]*)>?(?:\s+"[^"]*")?\s*\)`)
+	linkAt          = regexp.MustCompile(`^` + linkPattern.String())
+	autolinkPattern = regexp.MustCompile(`^<((?:https?://|mailto:)[^\s<>]+)>`)
+)
+
+// inline renders a paragraph's text: code spans, links, images, autolinks,
+// emphasis, strikethrough, backslash escapes and two-space line breaks. Anything
+// else, raw HTML included, is escaped.
+func (r *renderer) inline(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		rest := s[i:]
+		switch ch := s[i]; {
+		case ch == '\\' && i+1 < len(s) && strings.ContainsRune("\\`*_{}[]()#+-.!|~<>", rune(s[i+1])):
+			b.WriteString(html.EscapeString(s[i+1 : i+2]))
+			i += 2
+			continue
+
+		case ch == '`':
+			run := len(rest) - len(strings.TrimLeft(rest, "`"))
+			if end := strings.Index(rest[run:], rest[:run]); end >= 0 {
+				code := strings.TrimSpace(strings.ReplaceAll(rest[run:run+end], "\n", " "))
+				b.WriteString("<code>" + html.EscapeString(code) + "</code>")
+				i += run + end + run
+				continue
+			}
+			b.WriteString(rest[:run])
+			i += run
+			continue
+
+		case ch == '[' || (ch == '!' && strings.HasPrefix(rest, "![")):
+			if loc := linkAt.FindStringSubmatchIndex(rest); loc != nil {
+				text, target := rest[loc[2]:loc[3]], rest[loc[4]:loc[5]]
+				b.WriteString(r.link(ch == '!', text, target))
+				i += loc[1]
+				continue
+			}
+
+		case ch == '<':
+			if m := autolinkPattern.FindStringSubmatch(rest); m != nil {
+				b.WriteString(r.link(false, m[1], m[1]))
+				i += len(m[0])
+				continue
+			}
+
+		case ch == '*' || ch == '_' || ch == '~':
+			if out, n := r.emphasis(s, i); n > 0 {
+				b.WriteString(out)
+				i += n
+				continue
+			}
+
+		case ch == '\n':
+			if strings.HasSuffix(b.String(), "  ") {
+				trimmed := strings.TrimRight(b.String(), " ")
+				b.Reset()
+				b.WriteString(trimmed + "<br>")
+			}
+		}
+		b.WriteString(html.EscapeString(s[i : i+1]))
+		i++
+	}
+	return b.String()
+}
+
+// emphasis renders the emphasis or strikethrough opening at s[i], returning
+// the HTML and how many bytes it spans, or 0 if the delimiter isn't closed
+func (r *renderer) emphasis(s string, i int) (string, int) {
+	ch := s[i]
+	run := 1
+	for i+run < len(s) && s[i+run] == ch && run < 2 {
+		run++
+	}
+	if ch == '~' && run != 2 {
+		return "", 0
+	}
+	delim := s[i : i+run]
+	// Underscores inside words, as in snake_case, aren't emphasis
+	if ch == '_' && i > 0 && isWordByte(s[i-1]) {
+		return "", 0
+	}
+	if i+run >= len(s) || s[i+run] == ' ' {
+		return "", 0
+	}
+	for j := i + run; j <= len(s)-run; j++ {
+		if s[j] == '`' {
+			// Skip code spans, which can't hold emphasis delimiters
+			if end := strings.IndexByte(s[j+1:], '`'); end >= 0 {
+				j += end + 1
+			}
+			continue
+		}
+		if s[j:j+run] != delim || s[j-1] == ' ' {
+			continue
+		}
+		if run == 1 && j+1 < len(s) && s[j+1] == ch {
+			j++
+			continue
+		}
+		if ch == '_' && j+run < len(s) && isWordByte(s[j+run]) {
+			continue
+		}
+		inner := r.inline(s[i+run : j])
+		tag := "em"
+		switch {
+		case ch == '~':
+			tag = "del"
+		case run == 2:
+			tag = "strong"
+		}
+		return "<" + tag + ">" + inner + "</" + tag + ">", j + run - i
+	}
+	return "", 0
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
+
+// link renders a link or image. Relative targets are resolved against the
+// file's URL; without one, or for other schemes, only the text is kept.
+func (r *renderer) link(image bool, text, target string) string {
+	href := r.resolve(target)
+	if image {
+		if href == "" {
+			return html.EscapeString(text)
+		}
+		return `<img src="` + html.EscapeString(href) + `" alt="` + html.EscapeString(text) + `">`
+	}
+	label := r.inline(text)
+	if href == "" {
+		return label
+	}
+	return `<a href="` + html.EscapeString(href) + `">` + label + `</a>`
+}
+
+func (r *renderer) resolve(target string) string {
+	u, err := url.Parse(target)
+	if err != nil {
+		return ""
+	}
+	if u.Scheme == "" && u.Host == "" {
+		if r.base == nil {
+			return ""
+		}
+		u = r.base.ResolveReference(u)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "mailto" {
+		return ""
+	}
+	return u.String()
+}
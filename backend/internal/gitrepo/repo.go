@@ -0,0 +1,492 @@
+// Package gitrepo reads Markdown documentation from git repositories with the
+// git command-line tool. Files are read at a commit, from git's object store,
+// so bare repositories work as well as checkouts and no working tree is ever
+// touched. Remote repositories are mirrored into a cache directory and fetched
+// again once they get stale; local ones are read in place, but only from under
+// the configured roots.
+package gitrepo
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shaunpua/updoc/internal/config"
+)
+
+var (
+	// ErrNotFound is a repository, ref or file that doesn't exist
+	ErrNotFound = errors.New("not found")
+	// ErrNotAllowed is a repository UpDoc may not read: a local path outside
+	// the configured roots, or a URL with an unsupported scheme
+	ErrNotAllowed = errors.New("repository not allowed")
+)
+
+// CommandError is a git command that failed or timed out
+type CommandError struct {
+	Command string
+	Stderr  string
+	Err     error
+}
+
+func (e *CommandError) Error() string {
+	if e.Stderr != "" {
+		return fmt.Sprintf("git %s: %s", e.Command, e.Stderr)
+	}
+	return fmt.Sprintf("git %s: %v", e.Command, e.Err)
+}
+
+func (e *CommandError) Unwrap() error { return e.Err }
+
+// maxStderr caps how much of a failed command's output is kept
+const maxStderr = 2048
+
+// Git runs git for every repository. It is safe for concurrent use and should
+// be shared.
+type Git struct {
+	cfg    config.GitConfig
+	logger *slog.Logger
+
+	mu sync.Mutex
+	// clones serializes cloning and fetching each remote repository, and
+	// remembers when it was last fetched
+	clones map[string]*clone
+}
+
+type clone struct {
+	mu      sync.Mutex
+	fetched time.Time
+}
+
+func New(cfg config.GitConfig, logger *slog.Logger) *Git {
+	return &Git{
+		cfg:    cfg,
+		logger: logger.With("component", "git"),
+		clones: make(map[string]*clone),
+	}
+}
+
+// Repo is a repository ready to be read
+type Repo struct {
+	g *Git
+	// Dir is the repository on disk, the clone for remote repositories
+	Dir string
+	// Source is the path or URL the repository was opened from
+	Source string
+	local  bool
+}
+
+// scpURL matches scp-style remotes such as git@github.com:acme/docs.git
+var scpURL = regexp.MustCompile(`^[A-Za-z0-9._-]+@[A-Za-z0-9.-]+:[^/]`)
+
+// IsRemote reports whether source is a URL to clone rather than a local path
+func IsRemote(source string) bool {
+	for _, scheme := range []string{"https://", "http://", "ssh://"} {
+		if strings.HasPrefix(source, scheme) {
+			return true
+		}
+	}
+	return scpURL.MatchString(source)
+}
+
+// Open returns the repository at source: an https, http, ssh or scp-style
+// URL with an allowed scheme and remote, which is cloned on first use and
+// fetched when stale, or the path of a repository under one of the local
+// roots, with or without file://.
+func (g *Git) Open(ctx context.Context, source string) (*Repo, error) {
+	if strings.HasPrefix(source, "-") {
+		return nil, fmt.Errorf("%w: %q", ErrNotAllowed, source)
+	}
+	if IsRemote(source) {
+		return g.openRemote(ctx, source)
+	}
+	if strings.Contains(source, "://") && !strings.HasPrefix(source, "file://") {
+		return nil, fmt.Errorf("%w: %q uses an unsupported scheme", ErrNotAllowed, source)
+	}
+	return g.openLocal(ctx, source)
+}
+
+func (g *Git) openLocal(ctx context.Context, source string) (*Repo, error) {
+	path := strings.TrimPrefix(source, "file://")
+	if !filepath.IsAbs(path) {
+		return nil, fmt.Errorf("%w: %q is not an absolute path", ErrNotAllowed, source)
+	}
+	dir, err := filepath.EvalSymlinks(filepath.Clean(path))
+	if err != nil {
+		return nil, fmt.Errorf("repository %s: %w", source, ErrNotFound)
+	}
+	if !g.underLocalRoot(dir) {
+		return nil, fmt.Errorf("%w: %s is not under a configured local root", ErrNotAllowed, source)
+	}
+
+	repo := &Repo{g: g, Dir: dir, Source: source, local: true}
+	if _, err := repo.git(ctx, g.cfg.Timeout, nil, "rev-parse", "--git-dir"); err != nil {
+		return nil, fmt.Errorf("repository %s is not a git repository: %w", source, ErrNotFound)
+	}
+	return repo, nil
+}
+
+func (g *Git) underLocalRoot(dir string) bool {
+	for _, root := range g.cfg.LocalRoots {
+		if resolved, err := filepath.EvalSymlinks(root); err == nil {
+			root = resolved
+		}
+		if rel, err := filepath.Rel(root, dir); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// openRemote mirrors source into the cache directory, or fetches the mirror
+// if it was last fetched more than the fetch interval ago. A failed fetch is
+// logged and the stale mirror read, so a flaky remote doesn't stop syncs.
+func (g *Git) openRemote(ctx context.Context, source string) (*Repo, error) {
+	if err := g.remoteAllowed(source); err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256([]byte(source))
+	dir := filepath.Join(g.cfg.CacheDir, hex.EncodeToString(sum[:12])+".git")
+	repo := &Repo{g: g, Dir: dir, Source: source}
+
+	g.mu.Lock()
+	c, ok := g.clones[dir]
+	if !ok {
+		c = &clone{}
+		g.clones[dir] = c
+	}
+	g.mu.Unlock()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, err := os.Stat(dir); errors.Is(err, os.ErrNotExist) {
+		if err := os.MkdirAll(g.cfg.CacheDir, 0o700); err != nil {
+			return nil, fmt.Errorf("failed to create git cache directory: %w", err)
+		}
+		tmp, err := os.MkdirTemp(g.cfg.CacheDir, "clone-")
+		if err != nil {
+			return nil, fmt.Errorf("failed to create git cache directory: %w", err)
+		}
+		defer os.RemoveAll(tmp)
+		if _, err := g.remote(ctx, g.cfg.CacheDir, "clone", "--mirror", "--quiet", "--", source, tmp); err != nil {
+			return nil, err
+		}
+		if err := os.Rename(tmp, dir); err != nil {
+			return nil, fmt.Errorf("failed to move clone into place: %w", err)
+		}
+		c.fetched = time.Now()
+		g.logger.InfoContext(ctx, "repository cloned", "repository", source, "dir", dir)
+		return repo, nil
+	}
+
+	if time.Since(c.fetched) >= g.cfg.FetchInterval {
+		if _, err := g.remote(ctx, dir, "fetch", "--prune", "--quiet", "origin"); err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			g.logger.WarnContext(ctx, "failed to fetch repository; reading the last fetch", "repository", source, "error", err)
+		}
+		c.fetched = time.Now()
+	}
+	return repo, nil
+}
+
+// remote runs a command that talks to a remote. Only the configured network
+// transports are allowed, so a repository URL can't reach into the server's
+// files or run commands; redirects aren't followed, so an allowed host can't
+// send git elsewhere, and git never stops to ask for credentials.
+func (g *Git) remote(ctx context.Context, dir string, args ...string) ([]byte, error) {
+	config := []string{"-c", "protocol.allow=never", "-c", "http.followRedirects=false"}
+	for _, scheme := range g.cfg.RemoteSchemes {
+		config = append(config, "-c", "protocol."+scheme+".allow=always")
+	}
+	return g.run(ctx, g.cfg.CloneTimeout, dir, nil, append(config, args...)...)
+}
+
+// remoteURL is a remote's scheme, host (with any port) and path, with
+// scp-style remotes read as ssh
+func remoteURL(source string) (*url.URL, error) {
+	if scpURL.MatchString(source) {
+		userHost, path, _ := strings.Cut(source, ":")
+		_, host, _ := strings.Cut(userHost, "@")
+		return &url.URL{Scheme: "ssh", Host: host, Path: "/" + path}, nil
+	}
+	return url.Parse(source)
+}
+
+// remoteAllowed checks source against the configured schemes and remotes.
+// A remote whose path has . or .. segments is refused, as git would resolve
+// them past a URL prefix.
+func (g *Git) remoteAllowed(source string) error {
+	u, err := remoteURL(source)
+	if err != nil || u.Hostname() == "" || strings.HasPrefix(u.Host, "-") {
+		return fmt.Errorf("%w: %q is not a valid repository URL", ErrNotAllowed, source)
+	}
+	if !slices.Contains(g.cfg.RemoteSchemes, strings.ToLower(u.Scheme)) {
+		return fmt.Errorf("%w: %s repositories are not allowed", ErrNotAllowed, u.Scheme)
+	}
+	for _, segment := range strings.Split(u.Path, "/") {
+		if segment == "." || segment == ".." {
+			return fmt.Errorf("%w: %q has a relative path", ErrNotAllowed, source)
+		}
+	}
+	for _, allowed := range g.cfg.AllowedRemotes {
+		if !strings.Contains(allowed, "://") {
+			if strings.EqualFold(u.Hostname(), allowed) {
+				return nil
+			}
+			continue
+		}
+		prefix, err := url.Parse(allowed)
+		if err != nil || !strings.EqualFold(prefix.Scheme, u.Scheme) || !strings.EqualFold(prefix.Host, u.Host) {
+			continue
+		}
+		base := strings.TrimSuffix(prefix.Path, "/")
+		if base == "" || u.Path == base || strings.HasPrefix(u.Path, base+"/") {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s is not an allowed remote", ErrNotAllowed, source)
+}
+
+func (g *Git) run(ctx context.Context, timeout time.Duration, dir string, stdin io.Reader, args ...string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, g.cfg.Binary, args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0", "GCM_INTERACTIVE=never", "LC_ALL=C")
+	cmd.Stdin = stdin
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		msg := strings.TrimSpace(stderr.String())
+		if len(msg) > maxStderr {
+			msg = msg[:maxStderr]
+		}
+		return nil, &CommandError{Command: subcommand(args), Stderr: msg, Err: err}
+	}
+	return stdout.Bytes(), nil
+}
+
+// subcommand names a command by its first argument that isn't an option
+func subcommand(args []string) string {
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == "-c":
+			i++
+		case !strings.HasPrefix(args[i], "-"):
+			return args[i]
+		}
+	}
+	return ""
+}
+
+// git runs a read-only command in the repository
+func (r *Repo) git(ctx context.Context, timeout time.Duration, stdin io.Reader, args ...string) ([]byte, error) {
+	if r.local {
+		// Repositories under a local root may belong to another user
+		args = append([]string{"-c", "safe.directory=" + r.Dir}, args...)
+	}
+	return r.g.run(ctx, timeout, r.Dir, stdin, args...)
+}
+
+// Resolve returns the commit ref points at; "" is the default branch
+func (r *Repo) Resolve(ctx context.Context, ref string) (string, error) {
+	if ref == "" {
+		ref = "HEAD"
+	}
+	out, err := r.git(ctx, r.g.cfg.Timeout, nil, "rev-parse", "--verify", "--quiet", "--end-of-options", ref+"^{commit}")
+	if err != nil {
+		var cmdErr *CommandError
+		if errors.As(err, &cmdErr) && cmdErr.Stderr == "" && exitCode(cmdErr) == 1 {
+			return "", fmt.Errorf("ref %s: %w", ref, ErrNotFound)
+		}
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// exitCode is the status a failed command exited with, or -1 if it timed out
+// or didn't start
+func exitCode(err *CommandError) int {
+	var exitErr *exec.ExitError
+	if errors.As(err.Err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+	return -1
+}
+
+// Files lists the path of every file at commit
+func (r *Repo) Files(ctx context.Context, commit string) ([]string, error) {
+	out, err := r.git(ctx, r.g.cfg.Timeout, nil, "ls-tree", "-r", "-z", "--name-only", "--full-tree", commit)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, name := range strings.Split(string(out), "\x00") {
+		if name != "" {
+			files = append(files, name)
+		}
+	}
+	return files, nil
+}
+
+// ReadFiles returns the contents of paths at commit, read by a single git
+// process. Paths that don't exist or aren't files are left out.
+func (r *Repo) ReadFiles(ctx context.Context, commit string, paths []string) (map[string][]byte, error) {
+	var stdin bytes.Buffer
+	var asked []string
+	for _, path := range paths {
+		if strings.ContainsAny(path, "\n\r") {
+			continue
+		}
+		asked = append(asked, path)
+		stdin.WriteString(commit + ":" + path + "\n")
+	}
+	if len(asked) == 0 {
+		return map[string][]byte{}, nil
+	}
+	out, err := r.git(ctx, r.g.cfg.Timeout, &stdin, "cat-file", "--batch")
+	if err != nil {
+		return nil, err
+	}
+
+	// Each answer is "<oid> <type> <size>\n<content>\n" or "<name> missing\n"
+	files := make(map[string][]byte, len(asked))
+	rd := bufio.NewReader(bytes.NewReader(out))
+	for _, path := range asked {
+		header, err := rd.ReadString('\n')
+		if err != nil {
+			return nil, fmt.Errorf("git cat-file: truncated output: %w", err)
+		}
+		fields := strings.Fields(header)
+		if len(fields) != 3 {
+			continue
+		}
+		size, err := strconv.Atoi(fields[2])
+		if err != nil {
+			return nil, fmt.Errorf("git cat-file: unexpected header %q", strings.TrimSpace(header))
+		}
+		content := make([]byte, size+1)
+		if _, err := io.ReadFull(rd, content); err != nil {
+			return nil, fmt.Errorf("git cat-file: truncated output: %w", err)
+		}
+		if fields[1] == "blob" {
+			files[path] = content[:size]
+		}
+	}
+	return files, nil
+}
+
+// ReadFile returns the contents of path at commit
+func (r *Repo) ReadFile(ctx context.Context, commit, path string) ([]byte, error) {
+	files, err := r.ReadFiles(ctx, commit, []string{path})
+	if err != nil {
+		return nil, err
+	}
+	content, ok := files[path]
+	if !ok {
+		return nil, fmt.Errorf("file %s: %w", path, ErrNotFound)
+	}
+	return content, nil
+}
+
+// FileHistory is what a file's history says about it
+type FileHistory struct {
+	// Commits counts the commits that changed the file
+	Commits int
+	// LastCommit is the latest of them, by Author at Time
+	LastCommit  string
+	Author      string
+	AuthorEmail string
+	Time        time.Time
+}
+
+// History follows history back from commit and returns the history of each
+// of paths. Renames aren't followed, so a moved file's history starts at the
+// move.
+func (r *Repo) History(ctx context.Context, commit string, paths []string) (map[string]*FileHistory, error) {
+	wanted := make(map[string]bool, len(paths))
+	for _, path := range paths {
+		wanted[path] = true
+	}
+	out, err := r.git(ctx, r.g.cfg.Timeout, nil,
+		"log", "-z", "--no-renames", "--name-only", "--format=%x1e%H%x1f%an%x1f%ae%x1f%cI", commit, "--")
+	if err != nil {
+		return nil, err
+	}
+
+	// Each commit is "\x1e<header>\x00\n" and then its paths, each ending in \x00
+	history := make(map[string]*FileHistory, len(paths))
+	for _, record := range strings.Split(string(out), "\x1e") {
+		header, names, _ := strings.Cut(record, "\x00")
+		fields := strings.Split(header, "\x1f")
+		if len(fields) != 4 {
+			continue
+		}
+		at, _ := time.Parse(time.RFC3339, fields[3])
+		for _, name := range strings.Split(strings.TrimPrefix(names, "\n"), "\x00") {
+			if !wanted[name] {
+				continue
+			}
+			h, ok := history[name]
+			if !ok {
+				// git log lists newest first
+				h = &FileHistory{LastCommit: fields[0], Author: fields[1], AuthorEmail: fields[2], Time: at}
+				history[name] = h
+			}
+			h.Commits++
+		}
+	}
+	return history, nil
+}
+
+// Grep returns which of paths contain query at commit, ignoring case
+func (r *Repo) Grep(ctx context.Context, commit, query string, paths []string) (map[string]bool, error) {
+	matched := make(map[string]bool)
+	if len(paths) == 0 {
+		return matched, nil
+	}
+	wanted := make(map[string]bool, len(paths))
+	for _, path := range paths {
+		wanted[path] = true
+	}
+	out, err := r.git(ctx, r.g.cfg.Timeout, nil, "grep", "-I", "-i", "-l", "-z", "-F", "-e", query, commit, "--")
+	if err != nil {
+		// grep exits 1 when nothing matches
+		var cmdErr *CommandError
+		if errors.As(err, &cmdErr) && exitCode(cmdErr) == 1 {
+			return matched, nil
+		}
+		return nil, err
+	}
+	for _, name := range strings.Split(string(out), "\x00") {
+		if path, ok := strings.CutPrefix(name, commit+":"); ok && wanted[path] {
+			matched[path] = true
+		}
+	}
+	return matched, nil
+}
@@ -0,0 +1,316 @@
+package gitrepo
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/cgi"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shaunpua/updoc/internal/config"
+)
+
+// gitCmd runs git in dir as a fixed author, failing the test on error
+func gitCmd(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"GIT_CONFIG_GLOBAL=/dev/null", "GIT_CONFIG_NOSYSTEM=1",
+		"GIT_AUTHOR_NAME=Alice Park", "GIT_AUTHOR_EMAIL=alice@acme.example.com",
+		"GIT_COMMITTER_NAME=Alice Park", "GIT_COMMITTER_EMAIL=alice@acme.example.com",
+	)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// commit writes files into the work tree at dir and commits them
+func commit(t *testing.T, dir, message string, files map[string]string) string {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	gitCmd(t, dir, "add", "-A")
+	gitCmd(t, dir, "commit", "--quiet", "-m", message)
+	return gitCmd(t, dir, "rev-parse", "HEAD")
+}
+
+// newWorkTree creates a repository on main at dir with a first commit
+func newWorkTree(t *testing.T, dir string) string {
+	t.Helper()
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	gitCmd(t, dir, "init", "--quiet", "--initial-branch=main")
+	return commit(t, dir, "Add docs", map[string]string{
+		"README.md":        "# Acme\n",
+		"docs/guide.md":    "# Guide\n",
+		"docs/api/auth.md": "# Auth\n",
+		"main.go":          "package main\n",
+	})
+}
+
+func testConfig(t *testing.T) config.GitConfig {
+	cfg := config.Default().Git
+	cfg.CacheDir = t.TempDir()
+	cfg.Timeout = 10 * time.Second
+	cfg.CloneTimeout = 30 * time.Second
+	return cfg
+}
+
+func newGit(cfg config.GitConfig) *Git {
+	return New(cfg, slog.New(slog.NewTextHandler(io.Discard, nil)))
+}
+
+func TestRemoteAllowed(t *testing.T) {
+	g := newGit(config.GitConfig{
+		RemoteSchemes:  []string{"https", "ssh"},
+		AllowedRemotes: []string{"github.com", "https://gitlab.example.com/acme/"},
+	})
+	tests := []struct {
+		source string
+		ok     bool
+	}{
+		{"https://github.com/acme/docs.git", true},
+		{"https://GitHub.com/anyone/else", true},
+		{"git@github.com:acme/docs.git", true},
+		{"ssh://git@github.com/acme/docs.git", true},
+		{"https://gitlab.example.com/acme/docs.git", true},
+		{"https://gitlab.example.com/acme", true},
+		{"https://gitlab.example.com/acmecorp/docs.git", false},
+		{"https://gitlab.example.com/other/docs.git", false},
+		{"https://gitlab.example.com/acme/../other/docs.git", false},
+		{"https://gitlab.example.com/acme/./docs.git", false},
+		{"http://gitlab.example.com/acme/docs.git", false},
+		{"http://github.com/acme/docs.git", false},
+		{"https://github.com.evil.example/acme/docs.git", false},
+		{"https://bitbucket.org/acme/docs.git", false},
+		{"ssh://-oProxyCommand=touch/acme/docs.git", false},
+		{"https:///acme/docs.git", false},
+	}
+	for _, tt := range tests {
+		err := g.remoteAllowed(tt.source)
+		switch {
+		case tt.ok && err != nil:
+			t.Errorf("remoteAllowed(%q) = %v, want allowed", tt.source, err)
+		case !tt.ok && !errors.Is(err, ErrNotAllowed):
+			t.Errorf("remoteAllowed(%q) = %v, want ErrNotAllowed", tt.source, err)
+		}
+	}
+}
+
+func TestOpenLocal(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+	dir := filepath.Join(root, "docs")
+	head := newWorkTree(t, dir)
+	newWorkTree(t, filepath.Join(outside, "secret"))
+	if err := os.Symlink(filepath.Join(outside, "secret"), filepath.Join(root, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := testConfig(t)
+	cfg.LocalRoots = []string{root}
+	g := newGit(cfg)
+	ctx := context.Background()
+
+	for _, source := range []string{dir, "file://" + dir} {
+		repo, err := g.Open(ctx, source)
+		if err != nil {
+			t.Fatalf("Open(%q): %v", source, err)
+		}
+		if got, err := repo.Resolve(ctx, ""); err != nil || got != head {
+			t.Errorf("Resolve(%q) = %q, %v, want %q", source, got, err, head)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		source string
+		want   error
+	}{
+		{"outside the roots", filepath.Join(outside, "secret"), ErrNotAllowed},
+		{"dot-dot out of the root", filepath.Join(root, "..", filepath.Base(outside), "secret"), ErrNotAllowed},
+		{"symlink out of the root", filepath.Join(root, "link"), ErrNotAllowed},
+		{"relative path", "docs", ErrNotAllowed},
+		{"option", "--upload-pack=touch /tmp/pwned", ErrNotAllowed},
+		{"ext transport", "ext::sh -c touch% /tmp/pwned", ErrNotAllowed},
+		{"other scheme", "ftp://example.com/docs.git", ErrNotAllowed},
+		{"missing", filepath.Join(root, "missing"), ErrNotFound},
+		{"not a repository", root, ErrNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := g.Open(ctx, tt.source); !errors.Is(err, tt.want) {
+				t.Errorf("Open(%q) = %v, want %v", tt.source, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestRepoReads(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "docs")
+	first := newWorkTree(t, dir)
+	second := commit(t, dir, "Expand the guide", map[string]string{"docs/guide.md": "# Guide\n\nCall `CreateFlag` first.\n"})
+
+	cfg := testConfig(t)
+	cfg.LocalRoots = []string{root}
+	repo, err := newGit(cfg).Open(context.Background(), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	files, err := repo.Files(ctx, second)
+	if err != nil {
+		t.Fatalf("Files: %v", err)
+	}
+	slices.Sort(files)
+	if want := []string{"README.md", "docs/api/auth.md", "docs/guide.md", "main.go"}; !slices.Equal(files, want) {
+		t.Errorf("Files = %v, want %v", files, want)
+	}
+
+	if data, err := repo.ReadFile(ctx, first, "docs/guide.md"); err != nil || string(data) != "# Guide\n" {
+		t.Errorf("ReadFile at the first commit = %q, %v", data, err)
+	}
+	if _, err := repo.ReadFile(ctx, second, "docs/missing.md"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("ReadFile of a missing file = %v, want ErrNotFound", err)
+	}
+
+	history, err := repo.History(ctx, second, []string{"docs/guide.md", "README.md"})
+	if err != nil {
+		t.Fatalf("History: %v", err)
+	}
+	if h := history["docs/guide.md"]; h == nil || h.Commits != 2 || h.LastCommit != second || h.AuthorEmail != "alice@acme.example.com" {
+		t.Errorf("guide history = %+v", h)
+	}
+	if h := history["README.md"]; h == nil || h.Commits != 1 || h.LastCommit != first {
+		t.Errorf("README history = %+v", h)
+	}
+
+	found, err := repo.Grep(ctx, second, "createflag", []string{"docs/guide.md", "README.md"})
+	if err != nil || !found["docs/guide.md"] || found["README.md"] {
+		t.Errorf("Grep = %v, %v, want only the guide", found, err)
+	}
+
+	// Refs are never read as options
+	for _, ref := range []string{"missing", "--output=/tmp/pwned", "-h"} {
+		if _, err := repo.Resolve(ctx, ref); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Resolve(%q) = %v, want ErrNotFound", ref, err)
+		}
+	}
+	if got, err := repo.Resolve(ctx, "main"); err != nil || got != second {
+		t.Errorf("Resolve(main) = %q, %v, want %q", got, err, second)
+	}
+}
+
+// serveRepos serves the bare repositories under root over smart HTTP
+func serveRepos(t *testing.T, root string) *httptest.Server {
+	t.Helper()
+	execPath := gitCmd(t, root, "--exec-path")
+	srv := httptest.NewServer(&cgi.Handler{
+		Path: filepath.Join(execPath, "git-http-backend"),
+		Env:  []string{"GIT_PROJECT_ROOT=" + root, "GIT_HTTP_EXPORT_ALL=1"},
+	})
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestOpenRemote(t *testing.T) {
+	served := t.TempDir()
+	work := filepath.Join(t.TempDir(), "work")
+	first := newWorkTree(t, work)
+	origin := filepath.Join(served, "docs.git")
+	gitCmd(t, served, "clone", "--quiet", "--bare", work, origin)
+	srv := serveRepos(t, served)
+	source := srv.URL + "/docs.git"
+
+	cfg := testConfig(t)
+	cfg.RemoteSchemes = []string{"http"}
+	cfg.AllowedRemotes = []string{"127.0.0.1"}
+	cfg.FetchInterval = 0
+	g := newGit(cfg)
+	ctx := context.Background()
+
+	repo, err := g.Open(ctx, source)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if !strings.HasPrefix(repo.Dir, cfg.CacheDir) {
+		t.Errorf("clone at %s, want under the cache directory %s", repo.Dir, cfg.CacheDir)
+	}
+	if got, err := repo.Resolve(ctx, "main"); err != nil || got != first {
+		t.Errorf("Resolve after cloning = %q, %v, want %q", got, err, first)
+	}
+
+	// A push to the origin is seen once the clone is fetched
+	second := commit(t, work, "Add the runbook", map[string]string{"docs/runbook.md": "# Runbook\n"})
+	gitCmd(t, work, "push", "--quiet", origin, "main")
+	if repo, err = g.Open(ctx, source); err != nil {
+		t.Fatalf("Open after pushing: %v", err)
+	}
+	if got, err := repo.Resolve(ctx, "main"); err != nil || got != second {
+		t.Errorf("Resolve after fetching = %q, %v, want %q", got, err, second)
+	}
+
+	// With the remote down the last fetch is read
+	srv.Close()
+	if repo, err = g.Open(ctx, source); err != nil {
+		t.Fatalf("Open with the remote down = %v, want the stale clone", err)
+	}
+	if got, err := repo.Resolve(ctx, "main"); err != nil || got != second {
+		t.Errorf("Resolve with the remote down = %q, %v, want %q", got, err, second)
+	}
+}
+
+func TestOpenRemoteRefused(t *testing.T) {
+	served := t.TempDir()
+	newWorkTree(t, filepath.Join(served, "docs"))
+	gitCmd(t, served, "clone", "--quiet", "--bare", "docs", "docs.git")
+	srv := serveRepos(t, served)
+
+	// An allowed host redirecting elsewhere isn't followed
+	redirect := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, srv.URL+r.URL.RequestURI(), http.StatusFound)
+	}))
+	t.Cleanup(redirect.Close)
+
+	cfg := testConfig(t)
+	cfg.RemoteSchemes = []string{"http"}
+	cfg.AllowedRemotes = []string{redirect.URL + "/acme/"}
+	g := newGit(cfg)
+	ctx := context.Background()
+
+	var cmdErr *CommandError
+	if _, err := g.Open(ctx, redirect.URL+"/acme/docs.git"); !errors.As(err, &cmdErr) || cmdErr.Command != "clone" {
+		t.Errorf("Open through a redirect = %v, want the clone to fail", err)
+	}
+	for _, source := range []string{srv.URL + "/docs.git", redirect.URL + "/acme/../docs.git", "https://127.0.0.1/acme/docs.git"} {
+		if _, err := g.Open(ctx, source); !errors.Is(err, ErrNotAllowed) {
+			t.Errorf("Open(%q) = %v, want ErrNotAllowed", source, err)
+		}
+	}
+	entries, err := os.ReadDir(cfg.CacheDir)
+	if err != nil || len(entries) != 0 {
+		t.Errorf("cache directory holds %v, %v, want nothing after failed clones", entries, err)
+	}
+}
@@ -0,0 +1,137 @@
+// Package health runs the readiness checks behind /readyz. Checks run
+// concurrently, each bounded by a timeout, and a checker can be put into
+// drain mode so readiness turns off before the server shuts down.
+package health
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	StatusOK       = "ok"
+	StatusFail     = "fail"
+	StatusDraining = "draining"
+)
+
+// Check is one named readiness check. Run may return details to include in
+// the report alongside its status.
+type Check struct {
+	Name string
+	// Critical checks fail readiness; the rest are reported only
+	Critical bool
+	Run      func(ctx context.Context) (details interface{}, err error)
+}
+
+// Result is the outcome of one check
+type Result struct {
+	Status    string      `json:"status"`
+	Critical  bool        `json:"critical"`
+	LatencyMS float64     `json:"latency_ms"`
+	Error     string      `json:"error,omitempty"`
+	Details   interface{} `json:"details,omitempty"`
+}
+
+// Report is the body served by /readyz
+type Report struct {
+	Status string            `json:"status"`
+	Checks map[string]Result `json:"checks,omitempty"`
+}
+
+type Checker struct {
+	checks   []Check
+	timeout  time.Duration
+	draining atomic.Bool
+}
+
+// NewChecker returns a checker that gives each check at most timeout
+func NewChecker(timeout time.Duration, checks ...Check) *Checker {
+	return &Checker{checks: checks, timeout: timeout}
+}
+
+// Drain makes every later report "draining" so load balancers stop routing
+// new requests here while in-flight ones finish
+func (c *Checker) Drain() { c.draining.Store(true) }
+
+func (c *Checker) Draining() bool { return c.draining.Load() }
+
+// Ready runs every check and reports "ok" unless a critical check failed
+func (c *Checker) Ready(ctx context.Context) Report {
+	if c.Draining() {
+		return Report{Status: StatusDraining}
+	}
+
+	results := make([]Result, len(c.checks))
+	var wg sync.WaitGroup
+	for i, check := range c.checks {
+		wg.Add(1)
+		go func(i int, check Check) {
+			defer wg.Done()
+			results[i] = c.run(ctx, check)
+		}(i, check)
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusOK, Checks: make(map[string]Result, len(c.checks))}
+	for i, check := range c.checks {
+		report.Checks[check.Name] = results[i]
+		if check.Critical && results[i].Status != StatusOK {
+			report.Status = StatusFail
+		}
+	}
+	return report
+}
+
+func (c *Checker) run(ctx context.Context, check Check) Result {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	start := time.Now()
+	details, err := check.Run(ctx)
+	result := Result{
+		Status:    StatusOK,
+		Critical:  check.Critical,
+		LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+		Details:   details,
+	}
+	if err != nil {
+		result.Status = StatusFail
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// Worker is a background loop whose progress readiness tracks
+type Worker struct {
+	Name string
+	// LastBeat returns when the worker last completed a round
+	LastBeat func() time.Time
+	// MaxAge is how stale LastBeat may get before the worker counts as stuck
+	MaxAge time.Duration
+}
+
+// WorkersCheck fails when any worker has stopped making progress
+func WorkersCheck(workers ...Worker) Check {
+	return Check{
+		Name:     "workers",
+		Critical: true,
+		Run: func(ctx context.Context) (interface{}, error) {
+			ages := make(map[string]string, len(workers))
+			var stuck []string
+			for _, w := range workers {
+				age := time.Since(w.LastBeat()).Round(time.Second)
+				ages[w.Name] = age.String()
+				if age > w.MaxAge {
+					stuck = append(stuck, w.Name)
+				}
+			}
+			if len(stuck) > 0 {
+				return ages, fmt.Errorf("no progress within the allowed interval: %v", stuck)
+			}
+			return ages, nil
+		},
+	}
+}
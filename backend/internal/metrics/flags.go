@@ -0,0 +1,60 @@
+package metrics
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/shaunpua/updoc/internal/doc"
+)
+
+var openFlagsDesc = prometheus.NewDesc(
+	prometheus.BuildFQName(namespace, "flags", "open"),
+	"Flags that are neither resolved nor archived, by priority and status.",
+	[]string{"priority", "status"}, nil,
+)
+
+// flagCollector queries flag counts at scrape time so the gauge is never stale
+type flagCollector struct {
+	repo   doc.FlagRepository
+	logger *slog.Logger
+}
+
+// RegisterFlags exports open flag counts from repo. Known priority and status
+// combinations are always reported, as zero when there are no such flags.
+func RegisterFlags(repo doc.FlagRepository, logger *slog.Logger) error {
+	return Registry.Register(&flagCollector{repo: repo, logger: logger})
+}
+
+func (c *flagCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- openFlagsDesc
+}
+
+func (c *flagCollector) Collect(ch chan<- prometheus.Metric) {
+	// Collect has no caller context; bound the query so a slow database can't stall scrapes
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	counts, err := c.repo.CountOpen(ctx)
+	if err != nil {
+		c.logger.Warn("failed to count open flags", "error", err)
+		ch <- prometheus.NewInvalidMetric(openFlagsDesc, err)
+		return
+	}
+
+	type key struct{ priority, status string }
+	values := make(map[key]float64)
+	for _, p := range []string{doc.PriorityUrgent, doc.PriorityHigh, doc.PriorityMedium, doc.PriorityLow} {
+		for _, s := range []string{doc.FlagStatusPending, doc.FlagStatusInProgress, doc.FlagStatusAwaitingVerification} {
+			values[key{p, s}] = 0
+		}
+	}
+	for _, fc := range counts {
+		values[key{fc.Priority, fc.Status}] += float64(fc.Count)
+	}
+
+	for k, v := range values {
+		ch <- prometheus.MustNewConstMetric(openFlagsDesc, prometheus.GaugeValue, v, k.priority, k.status)
+	}
+}
@@ -0,0 +1,168 @@
+// Package metrics holds the Prometheus collectors exported on /metrics.
+// Collectors live on a dedicated registry rather than the global default so
+// only UpDoc's own series (plus Go runtime and process stats) are exposed.
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "updoc"
+
+// Registry is the registry served by Handler
+var Registry = prometheus.NewRegistry()
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "requests_total",
+		Help:      "HTTP requests handled, by route and status code.",
+	}, []string{"method", "route", "status"})
+
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "HTTP request latency, by route.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	dbQueryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "db",
+		Name:      "query_duration_seconds",
+		Help:      "Database query latency, by operation.",
+		Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"operation", "table"})
+
+	dbQueryErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "db",
+		Name:      "query_errors_total",
+		Help:      "Failed database queries, by operation. Record-not-found is not counted.",
+	}, []string{"operation", "table"})
+
+	confluenceRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "confluence",
+		Name:      "requests_total",
+		Help:      "Confluence API calls, by organization and status code (\"error\" for transport failures).",
+	}, []string{"org", "method", "status"})
+
+	confluenceDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "confluence",
+		Name:      "request_duration_seconds",
+		Help:      "Confluence API call latency, by organization.",
+		Buckets:   []float64{.05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+	}, []string{"org", "method"})
+
+	confluenceRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "confluence",
+		Name:      "retries_total",
+		Help:      "Confluence API calls retried, by organization and reason (status code or \"error\").",
+	}, []string{"org", "reason"})
+
+	confluenceCircuitOpen = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "confluence",
+		Name:      "circuit_open",
+		Help:      "1 while an organization's Confluence circuit breaker is open (integration degraded), else 0.",
+	}, []string{"org"})
+
+	syncDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "sync",
+		Name:      "duration_seconds",
+		Help:      "Workspace sync duration, by result (success or error).",
+		Buckets:   []float64{.5, 1, 2.5, 5, 10, 30, 60, 120, 300},
+	}, []string{"result"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequests,
+		httpDuration,
+		dbQueryDuration,
+		dbQueryErrors,
+		confluenceRequests,
+		confluenceDuration,
+		confluenceRetries,
+		confluenceCircuitOpen,
+		syncDuration,
+	)
+}
+
+// Handler serves Registry in the Prometheus exposition format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
+
+// RegisterDB exports connection pool stats for db
+func RegisterDB(db *sql.DB) error {
+	return Registry.Register(collectors.NewDBStatsCollector(db, "updoc"))
+}
+
+// ObserveHTTPRequest records one handled HTTP request
+func ObserveHTTPRequest(method, route string, status int, elapsed time.Duration) {
+	httpRequests.WithLabelValues(method, route, strconv.Itoa(status)).Inc()
+	httpDuration.WithLabelValues(method, route).Observe(elapsed.Seconds())
+}
+
+// ObserveDBQuery records one database query; failed marks it as an error
+func ObserveDBQuery(operation, table string, elapsed time.Duration, failed bool) {
+	dbQueryDuration.WithLabelValues(operation, table).Observe(elapsed.Seconds())
+	if failed {
+		dbQueryErrors.WithLabelValues(operation, table).Inc()
+	}
+}
+
+// ObserveConfluenceRequest records one Confluence API call. A status of 0
+// means the request failed before a response arrived.
+func ObserveConfluenceRequest(org, method string, status int, elapsed time.Duration) {
+	code := "error"
+	if status > 0 {
+		code = strconv.Itoa(status)
+	}
+	confluenceRequests.WithLabelValues(org, method, code).Inc()
+	confluenceDuration.WithLabelValues(org, method).Observe(elapsed.Seconds())
+}
+
+// ObserveConfluenceRetry records a Confluence API call about to be retried.
+// A status of 0 means the previous attempt failed before a response arrived.
+func ObserveConfluenceRetry(org string, status int) {
+	reason := "error"
+	if status > 0 {
+		reason = strconv.Itoa(status)
+	}
+	confluenceRetries.WithLabelValues(org, reason).Inc()
+}
+
+// SetConfluenceCircuitOpen records whether org's circuit breaker is open
+func SetConfluenceCircuitOpen(org string, open bool) {
+	v := 0.0
+	if open {
+		v = 1
+	}
+	confluenceCircuitOpen.WithLabelValues(org).Set(v)
+}
+
+// ObserveSync records one workspace sync run
+func ObserveSync(elapsed time.Duration, err error) {
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	syncDuration.WithLabelValues(result).Observe(elapsed.Seconds())
+}
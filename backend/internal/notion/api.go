@@ -0,0 +1,285 @@
+package notion
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// User is a Notion user or bot
+type User struct {
+	Object string `json:"object"`
+	ID     string `json:"id"`
+	Name   string `json:"name,omitempty"`
+	// Type is person or bot
+	Type string `json:"type,omitempty"`
+	Bot  *Bot   `json:"bot,omitempty"`
+}
+
+// Bot is what a bot user knows about the workspace it was added to
+type Bot struct {
+	WorkspaceName string `json:"workspace_name,omitempty"`
+}
+
+// Parent is where a page lives: under another page, in a database, or at
+// the top of the workspace
+type Parent struct {
+	// Type is page_id, database_id, block_id or workspace
+	Type       string `json:"type"`
+	PageID     string `json:"page_id,omitempty"`
+	DatabaseID string `json:"database_id,omitempty"`
+	BlockID    string `json:"block_id,omitempty"`
+	Workspace  bool   `json:"workspace,omitempty"`
+}
+
+// ID is the parent page, database or block's ID, empty at the top of the
+// workspace
+func (p Parent) ID() string {
+	switch p.Type {
+	case "page_id":
+		return p.PageID
+	case "database_id":
+		return p.DatabaseID
+	case "block_id":
+		return p.BlockID
+	}
+	return ""
+}
+
+// RichText is one run of formatted text
+type RichText struct {
+	PlainText   string      `json:"plain_text"`
+	Href        string      `json:"href,omitempty"`
+	Annotations Annotations `json:"annotations"`
+}
+
+type Annotations struct {
+	Bold          bool `json:"bold,omitempty"`
+	Italic        bool `json:"italic,omitempty"`
+	Strikethrough bool `json:"strikethrough,omitempty"`
+	Code          bool `json:"code,omitempty"`
+}
+
+// PlainText joins the runs' text
+func PlainText(runs []RichText) string {
+	var b strings.Builder
+	for _, run := range runs {
+		b.WriteString(run.PlainText)
+	}
+	return b.String()
+}
+
+// Property is one of a page's properties. Only the title is decoded.
+type Property struct {
+	ID    string     `json:"id,omitempty"`
+	Type  string     `json:"type"`
+	Title []RichText `json:"title,omitempty"`
+}
+
+// Page is a Notion page, or a database when Object is database
+type Page struct {
+	Object         string    `json:"object"`
+	ID             string    `json:"id"`
+	CreatedTime    time.Time `json:"created_time"`
+	LastEditedTime time.Time `json:"last_edited_time"`
+	LastEditedBy   User      `json:"last_edited_by"`
+	Parent         Parent    `json:"parent"`
+	Archived       bool      `json:"archived"`
+	InTrash        bool      `json:"in_trash,omitempty"`
+	URL            string    `json:"url"`
+	// Properties of a page, keyed by name; one has type title
+	Properties map[string]Property `json:"properties,omitempty"`
+	// DatabaseTitle is a database's title, which pages keep in Properties
+	DatabaseTitle []RichText `json:"title,omitempty"`
+}
+
+// Title is the page or database's title as plain text
+func (p *Page) Title() string {
+	if p.Object == "database" {
+		return PlainText(p.DatabaseTitle)
+	}
+	for _, prop := range p.Properties {
+		if prop.Type == "title" {
+			return PlainText(prop.Title)
+		}
+	}
+	return ""
+}
+
+// Block is one block of a page's content. Only the block types UpDoc renders
+// are decoded; others keep just their Type.
+type Block struct {
+	Object         string    `json:"object"`
+	ID             string    `json:"id"`
+	Type           string    `json:"type"`
+	HasChildren    bool      `json:"has_children"`
+	LastEditedTime time.Time `json:"last_edited_time"`
+
+	Paragraph        *Text      `json:"paragraph,omitempty"`
+	Heading1         *Text      `json:"heading_1,omitempty"`
+	Heading2         *Text      `json:"heading_2,omitempty"`
+	Heading3         *Text      `json:"heading_3,omitempty"`
+	BulletedListItem *Text      `json:"bulleted_list_item,omitempty"`
+	NumberedListItem *Text      `json:"numbered_list_item,omitempty"`
+	ToDo             *Text      `json:"to_do,omitempty"`
+	Toggle           *Text      `json:"toggle,omitempty"`
+	Quote            *Text      `json:"quote,omitempty"`
+	Callout          *Text      `json:"callout,omitempty"`
+	Code             *Text      `json:"code,omitempty"`
+	ChildPage        *ChildPage `json:"child_page,omitempty"`
+	Divider          *struct{}  `json:"divider,omitempty"`
+
+	// Children are the block's own blocks, when fetched with Blocks
+	Children []Block `json:"-"`
+}
+
+// Text is the content of a text block
+type Text struct {
+	RichText []RichText `json:"rich_text"`
+	// Checked is set on to_do blocks
+	Checked bool `json:"checked,omitempty"`
+	// Language is set on code blocks
+	Language string `json:"language,omitempty"`
+}
+
+// ChildPage is a link to a page nested in another
+type ChildPage struct {
+	Title string `json:"title"`
+}
+
+// List is one page of results. NextCursor is passed back as the start cursor
+// to get the next one.
+type List[T any] struct {
+	Object     string `json:"object"`
+	Results    []T    `json:"results"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	HasMore    bool   `json:"has_more"`
+}
+
+// MaxPageSize is the most results Notion returns per request
+const MaxPageSize = 100
+
+// Me returns the integration's bot user, which is how a token is checked
+func (i *Integration) Me(ctx context.Context) (*User, error) {
+	var user User
+	if err := i.do(ctx, http.MethodGet, "/v1/users/me", nil, nil, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// SearchQuery asks for pages shared with the integration whose title matches
+// Query, every page if it is empty, most recently edited first
+type SearchQuery struct {
+	Query    string
+	Cursor   string
+	PageSize int
+}
+
+// Search finds pages shared with the integration
+func (i *Integration) Search(ctx context.Context, q SearchQuery) (*List[Page], error) {
+	body := map[string]interface{}{
+		"filter": map[string]string{"property": "object", "value": "page"},
+		"sort":   map[string]string{"timestamp": "last_edited_time", "direction": "descending"},
+	}
+	if q.Query != "" {
+		body["query"] = q.Query
+	}
+	addPaging(body, q.Cursor, q.PageSize)
+
+	var list List[Page]
+	if err := i.do(ctx, http.MethodPost, "/v1/search", nil, body, &list); err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
+// QueryDatabase lists the pages of a database
+func (i *Integration) QueryDatabase(ctx context.Context, databaseID, cursor string, pageSize int) (*List[Page], error) {
+	body := map[string]interface{}{}
+	addPaging(body, cursor, pageSize)
+
+	var list List[Page]
+	if err := i.do(ctx, http.MethodPost, "/v1/databases/"+databaseID+"/query", nil, body, &list); err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
+// Database returns a database's metadata
+func (i *Integration) Database(ctx context.Context, id string) (*Page, error) {
+	var db Page
+	if err := i.do(ctx, http.MethodGet, "/v1/databases/"+id, nil, nil, &db); err != nil {
+		return nil, err
+	}
+	return &db, nil
+}
+
+// Page returns a page's metadata and properties, without its content
+func (i *Integration) Page(ctx context.Context, id string) (*Page, error) {
+	var page Page
+	if err := i.do(ctx, http.MethodGet, "/v1/pages/"+id, nil, nil, &page); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+// BlockChildren returns one page of a block or page's child blocks
+func (i *Integration) BlockChildren(ctx context.Context, id, cursor string, pageSize int) (*List[Block], error) {
+	query := map[string]string{}
+	if cursor != "" {
+		query["start_cursor"] = cursor
+	}
+	if pageSize > 0 {
+		query["page_size"] = strconv.Itoa(min(pageSize, MaxPageSize))
+	}
+
+	var list List[Block]
+	if err := i.do(ctx, http.MethodGet, "/v1/blocks/"+id+"/children", query, nil, &list); err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
+// Blocks returns a page's whole content, following nested blocks up to
+// depth levels below the page; deeper blocks are left without Children
+func (i *Integration) Blocks(ctx context.Context, id string, depth int) ([]Block, error) {
+	var blocks []Block
+	for cursor := ""; ; {
+		list, err := i.BlockChildren(ctx, id, cursor, MaxPageSize)
+		if err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, list.Results...)
+		if !list.HasMore || list.NextCursor == "" {
+			break
+		}
+		cursor = list.NextCursor
+	}
+
+	if depth > 1 {
+		for j := range blocks {
+			// Child pages are documents of their own
+			if !blocks[j].HasChildren || blocks[j].Type == "child_page" {
+				continue
+			}
+			children, err := i.Blocks(ctx, blocks[j].ID, depth-1)
+			if err != nil {
+				return nil, err
+			}
+			blocks[j].Children = children
+		}
+	}
+	return blocks, nil
+}
+
+func addPaging(body map[string]interface{}, cursor string, pageSize int) {
+	if cursor != "" {
+		body["start_cursor"] = cursor
+	}
+	if pageSize > 0 {
+		body["page_size"] = min(pageSize, MaxPageSize)
+	}
+}
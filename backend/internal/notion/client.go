@@ -0,0 +1,145 @@
+// Package notion is a client for the parts of the Notion REST API UpDoc
+// reads: the integration's bot user, search, database queries, pages and
+// their block children. Notion has no per-site URL; each workspace brings its
+// own internal integration token, so calls go through an Integration made
+// from the shared Client. Point the Client at the fake in package notiontest
+// to exercise it without a Notion account.
+package notion
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/shaunpua/updoc/internal/config"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+// Client holds the HTTP connections shared by every integration. It is safe
+// for concurrent use and should be shared.
+type Client struct {
+	cfg    config.NotionConfig
+	http   *resty.Client
+	logger *slog.Logger
+}
+
+// New builds a client for the API at cfg.BaseURL
+func New(cfg config.NotionConfig, logger *slog.Logger) *Client {
+	return &Client{
+		cfg:    cfg,
+		logger: logger.With("component", "notion"),
+		http: resty.New().
+			SetTimeout(cfg.Timeout).
+			SetTransport(otelhttp.NewTransport(http.DefaultTransport)).
+			SetBaseURL(strings.TrimRight(cfg.BaseURL, "/")).
+			SetHeader("Notion-Version", cfg.Version).
+			SetHeader("Accept", "application/json"),
+	}
+}
+
+// Integration is the client acting with one integration token
+type Integration struct {
+	c     *Client
+	token string
+}
+
+// Integration returns the client acting with token
+func (c *Client) Integration(token string) *Integration {
+	return &Integration{c: c, token: token}
+}
+
+// APIError is a non-2xx response from Notion
+type APIError struct {
+	StatusCode int
+	// Code is Notion's error code, e.g. unauthorized or object_not_found
+	Code    string
+	Message string
+}
+
+func (e *APIError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("notion API error: HTTP %d", e.StatusCode)
+	}
+	return fmt.Sprintf("notion API error: HTTP %d: %s", e.StatusCode, e.Message)
+}
+
+// Unauthorized reports whether Notion rejected the token
+func (e *APIError) Unauthorized() bool {
+	return e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden
+}
+
+// NotFound reports whether the object doesn't exist or isn't shared with
+// the integration, which Notion doesn't tell apart
+func (e *APIError) NotFound() bool {
+	return e.StatusCode == http.StatusNotFound
+}
+
+// TransportError is a call that failed before a response arrived
+type TransportError struct {
+	Err error
+}
+
+func (e *TransportError) Error() string { return "notion request failed: " + e.Err.Error() }
+
+func (e *TransportError) Unwrap() error { return e.Err }
+
+// maxMessageLen bounds how much of a non-JSON error body is kept
+const maxMessageLen = 200
+
+// do sends a request and decodes a 2xx response into out
+func (i *Integration) do(ctx context.Context, method, path string, query map[string]string, body, out interface{}) error {
+	start := time.Now()
+	req := i.c.http.R().
+		SetContext(ctx).
+		SetAuthToken(i.token).
+		SetQueryParams(query)
+	if body != nil {
+		req.SetBody(body)
+	}
+	resp, err := req.Execute(method, path)
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return &TransportError{Err: err}
+	}
+	i.c.logger.DebugContext(ctx, "notion request", "method", method, "path", path, "status", resp.StatusCode(), "duration", time.Since(start))
+
+	if resp.IsError() {
+		apiErr := &APIError{StatusCode: resp.StatusCode()}
+		var e struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(resp.Body(), &e) == nil && (e.Code != "" || e.Message != "") {
+			apiErr.Code, apiErr.Message = e.Code, e.Message
+		} else {
+			msg := strings.TrimSpace(string(resp.Body()))
+			if len(msg) > maxMessageLen {
+				msg = msg[:maxMessageLen]
+			}
+			apiErr.Message = msg
+		}
+		return apiErr
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(resp.Body(), out); err != nil {
+		return fmt.Errorf("notion returned an unexpected response to %s %s: %w", method, path, err)
+	}
+	return nil
+}
+
+// IsNotFound reports whether err is Notion saying an object doesn't exist or
+// isn't shared with the integration
+func IsNotFound(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.NotFound()
+}
@@ -0,0 +1,151 @@
+package notiontest
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/shaunpua/updoc/internal/notion"
+)
+
+// PageSpec is a page or database created or changed through the control
+// routes. A page goes in DatabaseID if set, under ParentID if set, and at
+// the top of the workspace otherwise.
+type PageSpec struct {
+	// Object is page, the default, or database
+	Object     string  `json:"object,omitempty"`
+	Title      *string `json:"title,omitempty"`
+	ParentID   *string `json:"parent_id,omitempty"`
+	DatabaseID *string `json:"database_id,omitempty"`
+	// Text replaces the content: "# " lines are headings, "- " lines list
+	// items and other lines paragraphs
+	Text *string `json:"text,omitempty"`
+}
+
+// PageInfo describes a page or database for the control routes
+type PageInfo struct {
+	notion.Page
+	Title string `json:"title_text"`
+}
+
+func (s *Server) info(p *page) PageInfo {
+	return PageInfo{Page: p.view(), Title: p.title}
+}
+
+// fakeList lists every page and database, trashed ones included
+func (s *Server) fakeList(w http.ResponseWriter, _ *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]PageInfo, len(s.pages))
+	for i, p := range s.pages {
+		out[i] = s.info(p)
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+func (s *Server) fakeCreate(w http.ResponseWriter, r *http.Request) {
+	var spec PageSpec
+	if !readJSON(w, r, &spec) {
+		return
+	}
+	if spec.Title == nil || *spec.Title == "" {
+		writeError(w, http.StatusBadRequest, "validation_error", "title is required")
+		return
+	}
+	if spec.Object == "" {
+		spec.Object = "page"
+	}
+	if spec.Object != "page" && spec.Object != "database" {
+		writeError(w, http.StatusBadRequest, "validation_error", "object must be page or database")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	parent, ok := s.parent(w, spec)
+	if !ok {
+		return
+	}
+	text := ""
+	if spec.Text != nil {
+		text = *spec.Text
+	}
+	writeJSON(w, http.StatusCreated, s.info(s.add(spec.Object, *spec.Title, parent, text)))
+}
+
+// fakeUpdate changes a page's title, content or parent, which counts as an
+// edit by the integration's bot
+func (s *Server) fakeUpdate(w http.ResponseWriter, r *http.Request) {
+	var spec PageSpec
+	if !readJSON(w, r, &spec) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.byID[r.PathValue("id")]
+	if !ok {
+		writeError(w, http.StatusNotFound, "object_not_found", "no page "+r.PathValue("id"))
+		return
+	}
+	if spec.Title != nil {
+		p.title = *spec.Title
+	}
+	if spec.Text != nil {
+		p.blocks = blocks(p.ID, *spec.Text)
+	}
+	if spec.ParentID != nil || spec.DatabaseID != nil {
+		parent, ok := s.parent(w, spec)
+		if !ok {
+			return
+		}
+		p.Parent = parent
+	}
+	p.Archived = false
+	s.touch(p)
+	writeJSON(w, http.StatusOK, s.info(p))
+}
+
+// fakeTrash moves a page to the trash; PATCHing it restores it
+func (s *Server) fakeTrash(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.byID[r.PathValue("id")]
+	if !ok {
+		writeError(w, http.StatusNotFound, "object_not_found", "no page "+r.PathValue("id"))
+		return
+	}
+	p.Archived = true
+	s.touch(p)
+	writeJSON(w, http.StatusOK, s.info(p))
+}
+
+// touch records an edit. Notion's edit times are coarse, so the time always
+// moves forward at least a second to keep every edit visible.
+func (s *Server) touch(p *page) {
+	now := time.Now().UTC().Truncate(time.Second)
+	if !now.After(p.LastEditedTime) {
+		now = p.LastEditedTime.Add(time.Second)
+	}
+	p.LastEditedTime = now
+	p.LastEditedBy = bot
+}
+
+// parent resolves spec's parent, writing an error if it doesn't exist. The
+// caller must hold s.mu.
+func (s *Server) parent(w http.ResponseWriter, spec PageSpec) (notion.Parent, bool) {
+	switch {
+	case spec.DatabaseID != nil && *spec.DatabaseID != "":
+		if db, ok := s.byID[*spec.DatabaseID]; !ok || db.Object != "database" {
+			writeError(w, http.StatusBadRequest, "validation_error", "no database "+*spec.DatabaseID)
+			return notion.Parent{}, false
+		}
+		return notion.Parent{Type: "database_id", DatabaseID: *spec.DatabaseID}, true
+	case spec.ParentID != nil && *spec.ParentID != "":
+		if p, ok := s.byID[*spec.ParentID]; !ok || p.Object != "page" {
+			writeError(w, http.StatusBadRequest, "validation_error", "no page "+*spec.ParentID)
+			return notion.Parent{}, false
+		}
+		return notion.Parent{Type: "page_id", PageID: *spec.ParentID}, true
+	}
+	return notion.Parent{Type: "workspace", Workspace: true}, true
+}
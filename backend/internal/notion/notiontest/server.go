@@ -0,0 +1,389 @@
+// Package notiontest is a fake Notion API implementing the subset UpDoc
+// uses: the bot user, search, database queries, pages and block children,
+// with Notion's cursor paging. Pages can be added, edited, moved and trashed
+// while the server runs through the /_fake/ routes, which need no token, so
+// updates can be detected the way they would be on Notion.
+//
+// Use NewServer in Go code, like httptest.NewServer, or run cmd/fakenotion
+// for demos.
+package notiontest
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shaunpua/updoc/internal/notion"
+)
+
+type Options struct {
+	// Token is the integration token accepted as a bearer token; empty
+	// accepts any, but one must be sent
+	Token string
+	// WorkspaceName is reported on the bot user
+	WorkspaceName string
+	// Empty starts without the demo databases and pages
+	Empty bool
+	// Logger records requests; nil discards them
+	Logger *slog.Logger
+}
+
+// Server is the fake API. It is an http.Handler, so it can be mounted on any
+// listener; NewServer also starts one.
+type Server struct {
+	opts   Options
+	logger *slog.Logger
+	mux    *http.ServeMux
+	ts     *httptest.Server
+
+	mu     sync.Mutex
+	pages  []*page
+	byID   map[string]*page
+	nextID int
+}
+
+// page is a page or database together with its content
+type page struct {
+	notion.Page
+	title  string
+	blocks []notion.Block
+}
+
+// bot is the user every edit made through the control routes is attributed to
+var bot = notion.User{Object: "user", ID: "a1b2c3d4-0000-4000-8000-000000000001"}
+
+// New builds a server without starting a listener
+func New(opts Options) *Server {
+	if opts.WorkspaceName == "" {
+		opts.WorkspaceName = "Acme"
+	}
+	logger := opts.Logger
+	if logger == nil {
+		logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	}
+	s := &Server{opts: opts, logger: logger, byID: make(map[string]*page), nextID: 1}
+	if !opts.Empty {
+		s.seed()
+	}
+	s.routes()
+	return s
+}
+
+// NewServer starts a server on a local port. Close it when done.
+func NewServer(opts Options) *Server {
+	s := New(opts)
+	s.ts = httptest.NewServer(s)
+	return s
+}
+
+// URL is the API base URL to configure as notion.base_url. It is empty
+// unless the server was started with NewServer.
+func (s *Server) URL() string {
+	if s.ts == nil {
+		return ""
+	}
+	return s.ts.URL
+}
+
+// Close stops a server started with NewServer
+func (s *Server) Close() {
+	if s.ts != nil {
+		s.ts.Close()
+	}
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// seed adds an engineering database of two pages and a handbook page with a
+// child page
+func (s *Server) seed() {
+	db := s.add("database", "Engineering Docs", notion.Parent{Type: "workspace", Workspace: true}, "")
+	s.add("page", "API Guide", notion.Parent{Type: "database_id", DatabaseID: db.ID},
+		"# Authentication\nSend the API key in the Authorization header.\n\n- Keys are scoped to one project\n- Rotate keys every 90 days")
+	s.add("page", "Deployment Runbook", notion.Parent{Type: "database_id", DatabaseID: db.ID},
+		"Deploys go out from the main branch every weekday.\n\n# Rolling back\nRun the previous release's pipeline again.")
+	handbook := s.add("page", "Team Handbook", notion.Parent{Type: "workspace", Workspace: true},
+		"Everything a new teammate needs in their first week.")
+	s.add("page", "Onboarding", notion.Parent{Type: "page_id", PageID: handbook.ID},
+		"- Get a laptop\n- Join the on-call rotation after a month")
+}
+
+// add creates a page or database. The caller must hold s.mu, or have sole
+// access to s.
+func (s *Server) add(object, title string, parent notion.Parent, text string) *page {
+	id := fmt.Sprintf("5e1f%04x-0000-4000-8000-%012x", s.nextID, s.nextID)
+	s.nextID++
+	now := time.Now().UTC().Truncate(time.Second)
+	p := &page{
+		Page: notion.Page{
+			Object:         object,
+			ID:             id,
+			CreatedTime:    now,
+			LastEditedTime: now,
+			LastEditedBy:   bot,
+			Parent:         parent,
+		},
+		title: title,
+	}
+	p.blocks = blocks(id, text)
+	s.pages = append(s.pages, p)
+	s.byID[id] = p
+	if parent.Type == "page_id" {
+		if parentPage, ok := s.byID[parent.PageID]; ok {
+			parentPage.blocks = append(parentPage.blocks, notion.Block{
+				Object: "block", ID: id, Type: "child_page", ChildPage: &notion.ChildPage{Title: title},
+			})
+		}
+	}
+	return p
+}
+
+// view is p as the API returns it
+func (p *page) view() notion.Page {
+	out := p.Page
+	out.URL = "https://www.notion.so/" + slug(p.title) + "-" + strings.ReplaceAll(p.ID, "-", "")
+	out.InTrash = p.Archived
+	runs := []notion.RichText{{PlainText: p.title}}
+	if p.Object == "database" {
+		out.DatabaseTitle = runs
+		out.Properties = map[string]notion.Property{"Name": {ID: "title", Type: "title"}}
+	} else {
+		out.Properties = map[string]notion.Property{"title": {ID: "title", Type: "title", Title: runs}}
+		if p.Parent.Type == "database_id" {
+			out.Properties = map[string]notion.Property{"Name": {ID: "title", Type: "title", Title: runs}}
+		}
+	}
+	return out
+}
+
+// blocks turns text into blocks: a line starting "# " is a heading, "- " a
+// bulleted list item, and any other line a paragraph
+func blocks(pageID, text string) []notion.Block {
+	var out []notion.Block
+	for i, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		b := notion.Block{Object: "block", ID: fmt.Sprintf("%s-b%d", pageID[:8], i)}
+		switch {
+		case strings.HasPrefix(line, "# "):
+			b.Type, b.Heading2 = "heading_2", textOf(line[2:])
+		case strings.HasPrefix(line, "- "):
+			b.Type, b.BulletedListItem = "bulleted_list_item", textOf(line[2:])
+		default:
+			b.Type, b.Paragraph = "paragraph", textOf(line)
+		}
+		out = append(out, b)
+	}
+	return out
+}
+
+func textOf(s string) *notion.Text {
+	return &notion.Text{RichText: []notion.RichText{{PlainText: s}}}
+}
+
+func slug(title string) string {
+	return strings.Trim(strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '-'
+	}, title), "-")
+}
+
+func (s *Server) routes() {
+	s.mux = http.NewServeMux()
+	api := func(pattern string, h http.HandlerFunc) {
+		s.mux.Handle(pattern, s.apiMiddleware(h))
+	}
+	api("GET /v1/users/me", s.me)
+	api("POST /v1/search", s.search)
+	api("GET /v1/databases/{id}", s.getDatabase)
+	api("POST /v1/databases/{id}/query", s.queryDatabase)
+	api("GET /v1/pages/{id}", s.getPage)
+	api("GET /v1/blocks/{id}/children", s.blockChildren)
+
+	s.mux.HandleFunc("GET /_fake/pages", s.fakeList)
+	s.mux.HandleFunc("POST /_fake/pages", s.fakeCreate)
+	s.mux.HandleFunc("PATCH /_fake/pages/{id}", s.fakeUpdate)
+	s.mux.HandleFunc("DELETE /_fake/pages/{id}", s.fakeTrash)
+}
+
+// apiMiddleware logs requests and checks the bearer token and Notion-Version
+func (s *Server) apiMiddleware(next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.logger.Info("notion request", "method", r.Method, "path", r.URL.Path)
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || token == "" || (s.opts.Token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(s.opts.Token)) != 1) {
+			writeError(w, http.StatusUnauthorized, "unauthorized", "API token is invalid.")
+			return
+		}
+		if r.Header.Get("Notion-Version") == "" {
+			writeError(w, http.StatusBadRequest, "missing_version", "Notion-Version header failed validation: Notion-Version header should be defined.")
+			return
+		}
+		next(w, r)
+	})
+}
+
+func (s *Server) me(w http.ResponseWriter, _ *http.Request) {
+	user := bot
+	user.Name = "UpDoc"
+	user.Type = "bot"
+	user.Bot = &notion.Bot{WorkspaceName: s.opts.WorkspaceName}
+	writeJSON(w, http.StatusOK, user)
+}
+
+// pagingRequest is the paging part of a POST body
+type pagingRequest struct {
+	Query       string `json:"query"`
+	StartCursor string `json:"start_cursor"`
+	PageSize    int    `json:"page_size"`
+	Filter      struct {
+		Value string `json:"value"`
+	} `json:"filter"`
+}
+
+func (s *Server) search(w http.ResponseWriter, r *http.Request) {
+	var req pagingRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+	query := strings.ToLower(req.Query)
+
+	s.mu.Lock()
+	var matches []notion.Page
+	for _, p := range s.pages {
+		if p.Archived || (req.Filter.Value != "" && p.Object != req.Filter.Value) {
+			continue
+		}
+		if query == "" || strings.Contains(strings.ToLower(p.title), query) {
+			matches = append(matches, p.view())
+		}
+	}
+	s.mu.Unlock()
+	slices.SortStableFunc(matches, func(a, b notion.Page) int { return b.LastEditedTime.Compare(a.LastEditedTime) })
+	writePage(w, matches, req.StartCursor, req.PageSize)
+}
+
+func (s *Server) getDatabase(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.byID[r.PathValue("id")]
+	if !ok || p.Object != "database" {
+		writeError(w, http.StatusNotFound, "object_not_found", "Could not find database with ID: "+r.PathValue("id")+".")
+		return
+	}
+	writeJSON(w, http.StatusOK, p.view())
+}
+
+func (s *Server) queryDatabase(w http.ResponseWriter, r *http.Request) {
+	var req pagingRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+	id := r.PathValue("id")
+
+	s.mu.Lock()
+	db, ok := s.byID[id]
+	if !ok || db.Object != "database" {
+		s.mu.Unlock()
+		writeError(w, http.StatusNotFound, "object_not_found", "Could not find database with ID: "+id+".")
+		return
+	}
+	var rows []notion.Page
+	for _, p := range s.pages {
+		if !p.Archived && p.Parent.DatabaseID == id {
+			rows = append(rows, p.view())
+		}
+	}
+	s.mu.Unlock()
+	writePage(w, rows, req.StartCursor, req.PageSize)
+}
+
+func (s *Server) getPage(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.byID[r.PathValue("id")]
+	if !ok || p.Object != "page" {
+		writeError(w, http.StatusNotFound, "object_not_found", "Could not find page with ID: "+r.PathValue("id")+".")
+		return
+	}
+	// Trashed pages are still returned, marked archived, as on Notion
+	writeJSON(w, http.StatusOK, p.view())
+}
+
+func (s *Server) blockChildren(w http.ResponseWriter, r *http.Request) {
+	pageSize, _ := strconv.Atoi(r.URL.Query().Get("page_size"))
+
+	s.mu.Lock()
+	p, ok := s.byID[r.PathValue("id")]
+	var children []notion.Block
+	if ok {
+		children = append(children, p.blocks...)
+	}
+	s.mu.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, "object_not_found", "Could not find block with ID: "+r.PathValue("id")+".")
+		return
+	}
+	writePage(w, children, r.URL.Query().Get("start_cursor"), pageSize)
+}
+
+// writePage writes one page of results. Cursors are offsets, which Notion's
+// opaque cursors are not, but callers can't tell.
+func writePage[T any](w http.ResponseWriter, results []T, cursor string, pageSize int) {
+	if pageSize <= 0 || pageSize > notion.MaxPageSize {
+		pageSize = notion.MaxPageSize
+	}
+	start, _ := strconv.Atoi(cursor)
+	start = min(max(start, 0), len(results))
+	end := min(start+pageSize, len(results))
+
+	list := notion.List[T]{Object: "list", Results: results[start:end], HasMore: end < len(results)}
+	if list.Results == nil {
+		list.Results = []T{}
+	}
+	if list.HasMore {
+		list.NextCursor = strconv.Itoa(end)
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+func readJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_json", err.Error())
+		return false
+	}
+	if len(body) == 0 {
+		return true
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_json", "Error parsing JSON body.")
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	writeJSON(w, status, map[string]interface{}{"object": "error", "status": status, "code": code, "message": message})
+}
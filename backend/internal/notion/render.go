@@ -0,0 +1,172 @@
+package notion
+
+import (
+	"fmt"
+	"html"
+	"net/url"
+	"strings"
+)
+
+// Render turns a page's blocks into HTML and Markdown. Text is escaped and
+// only http, https and mailto links are kept, so the HTML is safe to embed.
+// Block types it doesn't know are skipped.
+func Render(blocks []Block) (htmlOut, markdown string) {
+	var h, md strings.Builder
+	renderBlocks(&h, &md, blocks, 0)
+	return h.String(), strings.TrimSpace(md.String()) + "\n"
+}
+
+func renderBlocks(h, md *strings.Builder, blocks []Block, depth int) {
+	indent := strings.Repeat("  ", depth)
+	for i := 0; i < len(blocks); i++ {
+		b := blocks[i]
+
+		// Consecutive list items share one list
+		if b.Type == "bulleted_list_item" || b.Type == "numbered_list_item" {
+			tag := "ul"
+			if b.Type == "numbered_list_item" {
+				tag = "ol"
+			}
+			h.WriteString("<" + tag + ">")
+			for n := 1; i < len(blocks) && blocks[i].Type == b.Type; i, n = i+1, n+1 {
+				item := blocks[i]
+				text := listText(item)
+				marker := "-"
+				if tag == "ol" {
+					marker = fmt.Sprintf("%d.", n)
+				}
+				fmt.Fprintf(md, "%s%s %s\n", indent, marker, markdownText(text.RichText))
+				h.WriteString("<li>" + htmlText(text.RichText))
+				if len(item.Children) > 0 {
+					renderBlocks(h, md, item.Children, depth+1)
+				}
+				h.WriteString("</li>")
+			}
+			h.WriteString("</" + tag + ">")
+			i--
+			if depth == 0 {
+				md.WriteString("\n")
+			}
+			continue
+		}
+
+		switch {
+		case b.Paragraph != nil:
+			h.WriteString("<p>" + htmlText(b.Paragraph.RichText) + "</p>")
+			fmt.Fprintf(md, "%s%s\n\n", indent, markdownText(b.Paragraph.RichText))
+		case b.Heading1 != nil, b.Heading2 != nil, b.Heading3 != nil:
+			level, text := 1, b.Heading1
+			if b.Heading2 != nil {
+				level, text = 2, b.Heading2
+			} else if b.Heading3 != nil {
+				level, text = 3, b.Heading3
+			}
+			fmt.Fprintf(h, "<h%d>%s</h%d>", level, htmlText(text.RichText), level)
+			fmt.Fprintf(md, "%s %s\n\n", strings.Repeat("#", level), markdownText(text.RichText))
+		case b.ToDo != nil:
+			box, checked := "[ ]", ""
+			if b.ToDo.Checked {
+				box, checked = "[x]", " checked"
+			}
+			fmt.Fprintf(h, `<p><input type="checkbox" disabled%s> %s</p>`, checked, htmlText(b.ToDo.RichText))
+			fmt.Fprintf(md, "%s- %s %s\n", indent, box, markdownText(b.ToDo.RichText))
+		case b.Quote != nil, b.Callout != nil:
+			text := b.Quote
+			if text == nil {
+				text = b.Callout
+			}
+			h.WriteString("<blockquote>" + htmlText(text.RichText) + "</blockquote>")
+			fmt.Fprintf(md, "%s> %s\n\n", indent, markdownText(text.RichText))
+		case b.Toggle != nil:
+			h.WriteString("<details><summary>" + htmlText(b.Toggle.RichText) + "</summary>")
+			fmt.Fprintf(md, "%s%s\n\n", indent, markdownText(b.Toggle.RichText))
+			renderBlocks(h, md, b.Children, depth+1)
+			h.WriteString("</details>")
+			continue
+		case b.Code != nil:
+			code := PlainText(b.Code.RichText)
+			fmt.Fprintf(h, `<pre><code class="language-%s">%s</code></pre>`, html.EscapeString(b.Code.Language), html.EscapeString(code))
+			fmt.Fprintf(md, "```%s\n%s\n```\n\n", b.Code.Language, code)
+		case b.ChildPage != nil:
+			h.WriteString("<p><em>" + html.EscapeString(b.ChildPage.Title) + "</em></p>")
+			fmt.Fprintf(md, "%s*%s*\n\n", indent, b.ChildPage.Title)
+		case b.Divider != nil:
+			h.WriteString("<hr>")
+			md.WriteString("---\n\n")
+		default:
+			continue
+		}
+		if len(b.Children) > 0 {
+			renderBlocks(h, md, b.Children, depth+1)
+		}
+	}
+}
+
+func listText(b Block) *Text {
+	text := b.BulletedListItem
+	if text == nil {
+		text = b.NumberedListItem
+	}
+	if text == nil {
+		return &Text{}
+	}
+	return text
+}
+
+func htmlText(runs []RichText) string {
+	var b strings.Builder
+	for _, run := range runs {
+		s := html.EscapeString(run.PlainText)
+		a := run.Annotations
+		if a.Code {
+			s = "<code>" + s + "</code>"
+		}
+		if a.Bold {
+			s = "<strong>" + s + "</strong>"
+		}
+		if a.Italic {
+			s = "<em>" + s + "</em>"
+		}
+		if a.Strikethrough {
+			s = "<s>" + s + "</s>"
+		}
+		if safeLink(run.Href) {
+			s = `<a href="` + html.EscapeString(run.Href) + `">` + s + "</a>"
+		}
+		b.WriteString(s)
+	}
+	return b.String()
+}
+
+func markdownText(runs []RichText) string {
+	var b strings.Builder
+	for _, run := range runs {
+		s := run.PlainText
+		a := run.Annotations
+		if a.Code {
+			s = "`" + s + "`"
+		}
+		if a.Bold {
+			s = "**" + s + "**"
+		}
+		if a.Italic {
+			s = "*" + s + "*"
+		}
+		if a.Strikethrough {
+			s = "~~" + s + "~~"
+		}
+		if safeLink(run.Href) {
+			s = "[" + s + "](" + run.Href + ")"
+		}
+		b.WriteString(s)
+	}
+	return b.String()
+}
+
+func safeLink(href string) bool {
+	if href == "" {
+		return false
+	}
+	u, err := url.Parse(href)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https" || u.Scheme == "mailto")
+}
@@ -0,0 +1,126 @@
+// Package secret encrypts credentials (Confluence tokens etc.) before they are stored.
+package secret
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// prefix marks encrypted values so plaintext rows written before encryption
+// was enabled can still be read (and re-encrypted by key rotation)
+const prefix = "enc:v1:"
+
+// KeySize is the length of an AES-256 key in bytes
+const KeySize = 32
+
+// Cipher encrypts with its primary key and decrypts with any of its keys,
+// so values written under a previous key stay readable during rotation.
+type Cipher struct {
+	primary  cipher.AEAD
+	fallback []cipher.AEAD
+}
+
+// NewCipher builds a cipher from base64-encoded 32-byte keys. The first key
+// encrypts; the rest are only tried when decrypting.
+func NewCipher(primaryKey string, previousKeys ...string) (*Cipher, error) {
+	primary, err := newAEAD(primaryKey)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Cipher{primary: primary}
+	for _, key := range previousKeys {
+		aead, err := newAEAD(key)
+		if err != nil {
+			return nil, fmt.Errorf("previous key: %w", err)
+		}
+		c.fallback = append(c.fallback, aead)
+	}
+	return c, nil
+}
+
+// GenerateKey returns a new random base64-encoded key
+func GenerateKey() (string, error) {
+	key := make([]byte, KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+// ValidateKey checks that key decodes to a 32-byte AES key
+func ValidateKey(key string) error {
+	_, err := decodeKey(key)
+	return err
+}
+
+// IsEncrypted reports whether value was produced by Encrypt
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, prefix)
+}
+
+// Encrypt seals plaintext with the primary key. Empty strings stay empty.
+func (c *Cipher) Encrypt(plaintext string) (string, error) {
+	if plaintext == "" {
+		return "", nil
+	}
+
+	nonce := make([]byte, c.primary.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := c.primary.Seal(nonce, nonce, []byte(plaintext), nil)
+	return prefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt opens a value produced by Encrypt. Values without the encryption
+// prefix are legacy plaintext and returned unchanged.
+func (c *Cipher) Decrypt(value string) (string, error) {
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, prefix))
+	if err != nil {
+		return "", fmt.Errorf("malformed encrypted value: %w", err)
+	}
+
+	for _, aead := range append([]cipher.AEAD{c.primary}, c.fallback...) {
+		if len(sealed) < aead.NonceSize() {
+			break
+		}
+		nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+		if plaintext, err := aead.Open(nil, nonce, ciphertext, nil); err == nil {
+			return string(plaintext), nil
+		}
+	}
+	return "", errors.New("value was not encrypted with any configured key")
+}
+
+func newAEAD(key string) (cipher.AEAD, error) {
+	raw, err := decodeKey(key)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(raw)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func decodeKey(key string) ([]byte, error) {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(key))
+	if err != nil {
+		return nil, fmt.Errorf("encryption key must be base64: %w", err)
+	}
+	if len(raw) != KeySize {
+		return nil, fmt.Errorf("encryption key must be %d bytes, got %d", KeySize, len(raw))
+	}
+	return raw, nil
+}
@@ -0,0 +1,61 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/shaunpua/updoc/internal/doc"
+)
+
+// apiTokenPrefix makes tokens easy to spot (and redact) in configs and logs
+const apiTokenPrefix = "updoc_"
+
+type AuthService struct {
+	userRepo doc.UserRepository
+}
+
+func NewAuthService(userRepo doc.UserRepository) *AuthService {
+	return &AuthService{userRepo: userRepo}
+}
+
+// IssueToken generates a new API token for the user, replacing any previous one.
+// The plaintext token is only ever returned here.
+func (s *AuthService) IssueToken(ctx context.Context, userID string) (string, error) {
+	return issueAPIToken(ctx, s.userRepo, userID)
+}
+
+// Authenticate resolves an API token to its active user
+func (s *AuthService) Authenticate(ctx context.Context, token string) (*doc.User, error) {
+	if !strings.HasPrefix(token, apiTokenPrefix) {
+		return nil, fmt.Errorf("malformed API token: %w", ErrForbidden)
+	}
+
+	user, err := s.userRepo.GetByAPITokenHash(ctx, hashAPIToken(token))
+	if err != nil {
+		return nil, fmt.Errorf("unknown API token: %w", ErrForbidden)
+	}
+	return user, nil
+}
+
+func issueAPIToken(ctx context.Context, userRepo doc.UserRepository, userID string) (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	token := apiTokenPrefix + base64.RawURLEncoding.EncodeToString(buf)
+
+	if err := userRepo.SetAPITokenHash(ctx, userID, hashAPIToken(token)); err != nil {
+		return "", fmt.Errorf("failed to store token: %w", err)
+	}
+	return token, nil
+}
+
+func hashAPIToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
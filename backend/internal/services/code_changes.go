@@ -0,0 +1,422 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/shaunpua/updoc/internal/doc"
+	"github.com/shaunpua/updoc/internal/gitrepo"
+	"github.com/shaunpua/updoc/pkg/api"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// maxSourceLinks bounds how many paths and symbols a document links to
+	maxSourceLinks = 100
+	// maxCodeChangeCommits bounds the commit range one report may cover
+	maxCodeChangeCommits = 500
+	// codeChangeTitle is the title of flags opened by code changes
+	codeChangeTitle = "Code changed since doc last updated"
+)
+
+// SetSourceLinks replaces the repository paths and symbols a document is
+// linked to. Paths are globs relative to the repository root, such as
+// services/billing/**; symbols are identifiers like ChargeCustomer, or
+// dotted ones like billing.Charge. Both are matched against the commits
+// reported to CodeChangeService for repository: the ID of one of the org's
+// git workspaces, by default the document's own if it is in one, or a
+// repository's path or URL. Only admins may name a repository by path or
+// URL, as a report on it makes the server open it.
+func (s *DocumentService) SetSourceLinks(ctx context.Context, user *doc.User, id, repository string, paths, symbols []string) (*doc.Document, error) {
+	document, ws, err := s.Get(ctx, user, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(paths)+len(symbols) > maxSourceLinks {
+		return nil, fmt.Errorf("a document can link at most %d paths and symbols: %w", maxSourceLinks, ErrInvalidInput)
+	}
+
+	var cleanPaths, cleanSymbols []string
+	for _, path := range paths {
+		path = strings.TrimPrefix(strings.TrimSpace(path), "/")
+		if path == "" {
+			return nil, fmt.Errorf("source paths can't be empty: %w", ErrInvalidInput)
+		}
+		if _, err := gitrepo.CompileGlob(path); err != nil {
+			return nil, fmt.Errorf("source path %q is not a valid glob: %w", path, ErrInvalidInput)
+		}
+		if !slices.Contains(cleanPaths, path) {
+			cleanPaths = append(cleanPaths, path)
+		}
+	}
+	for _, symbol := range symbols {
+		symbol = strings.TrimSpace(symbol)
+		if !gitrepo.ValidSymbol(symbol) {
+			return nil, fmt.Errorf("source symbol %q must be an identifier, optionally dotted: %w", symbol, ErrInvalidInput)
+		}
+		if !slices.Contains(cleanSymbols, symbol) {
+			cleanSymbols = append(cleanSymbols, symbol)
+		}
+	}
+
+	repository = sourceRepository(repository)
+	switch {
+	case len(cleanPaths)+len(cleanSymbols) == 0:
+		repository = ""
+	case repository == "" && ws.IntegrationType == "git":
+		repository = ws.ID
+	case repository == "":
+		return nil, fmt.Errorf("repository is required: %w", ErrInvalidInput)
+	default:
+		if linked, err := s.workspaceService.Get(ctx, user, repository); err == nil {
+			if linked.IntegrationType != "git" {
+				return nil, fmt.Errorf("workspace %s is not a git workspace: %w", repository, ErrInvalidInput)
+			}
+		} else if user.Role != "admin" {
+			return nil, fmt.Errorf("only admins can link documents to a repository that isn't a git workspace's: %w", ErrForbidden)
+		}
+	}
+
+	document.SourceRepository = repository
+	document.SourcePaths = cleanPaths
+	document.SourceSymbols = cleanSymbols
+	if err := s.documentRepo.Update(ctx, document); err != nil {
+		return nil, fmt.Errorf("failed to save source links: %w", err)
+	}
+	s.logger.InfoContext(ctx, "document source links changed", "document_id", document.ID,
+		"repository", repository, "paths", len(cleanPaths), "symbols", len(cleanSymbols), "user_id", user.ID)
+	return document, nil
+}
+
+// sourceRepository trims the spaces and any trailing slash off a
+// repository's name, so the same repository is always named alike
+func sourceRepository(name string) string {
+	name = strings.TrimSpace(name)
+	if len(name) > 1 {
+		name = strings.TrimSuffix(name, "/")
+	}
+	return name
+}
+
+// Code change reports are API types
+type (
+	CodeChangeRequest  = api.CodeChangeRequest
+	CodeChangeResult   = api.CodeChangeResult
+	CodeChangeDocument = api.CodeChangeDocument
+)
+
+// CodeChangeService flags documents whose linked code changed, and tells
+// pull requests which documents their changes may affect
+type CodeChangeService struct {
+	git              *gitrepo.Git
+	documentRepo     doc.DocumentRepository
+	flagRepo         doc.FlagRepository
+	userRepo         doc.UserRepository
+	workspaceService *WorkspaceService
+	flagService      *FlagService
+	logger           *slog.Logger
+}
+
+func NewCodeChangeService(git *gitrepo.Git, documentRepo doc.DocumentRepository, flagRepo doc.FlagRepository, userRepo doc.UserRepository, workspaceService *WorkspaceService, flagService *FlagService, logger *slog.Logger) *CodeChangeService {
+	return &CodeChangeService{
+		git:              git,
+		documentRepo:     documentRepo,
+		flagRepo:         flagRepo,
+		userRepo:         userRepo,
+		workspaceService: workspaceService,
+		flagService:      flagService,
+		logger:           logger,
+	}
+}
+
+// Report checks the commits in a range of a repository against the source
+// links of the documents in the user's organization linked to it. A document
+// is flagged by the commits that change a file matching one of its paths, or
+// add or remove a line naming one of its symbols, and that were made after
+// the document was last edited; commits cited on any of its flags before are
+// skipped, so reporting the same range twice changes nothing. The commits are added to the
+// document's open code change flag, or a pending one is opened, raised by
+// the user, assigned to the document's owner and written back to the page
+// like any other flag.
+func (s *CodeChangeService) Report(ctx context.Context, user *doc.User, req CodeChangeRequest) (result *CodeChangeResult, err error) {
+	if strings.TrimSpace(req.Repository) == "" {
+		return nil, fmt.Errorf("repository is required: %w", ErrInvalidInput)
+	}
+	if req.To == "" {
+		return nil, fmt.Errorf("to is required: %w", ErrInvalidInput)
+	}
+	if req.Priority == "" {
+		req.Priority = doc.PriorityMedium
+	}
+	if !doc.ValidPriority(req.Priority) {
+		return nil, fmt.Errorf("priority must be one of urgent, high, medium, low: %w", ErrInvalidInput)
+	}
+
+	ctx, span := tracer.Start(ctx, "CodeChangeService.Report", trace.WithAttributes(
+		attribute.String("updoc.org_id", user.OrgID),
+		attribute.String("git.from", req.From),
+		attribute.String("git.to", req.To),
+	))
+	defer func() { finishSpan(span, err) }()
+
+	workspaces, err := s.workspaceService.List(ctx, user)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load workspaces: %w", err)
+	}
+	documents, err := s.linkedDocuments(ctx, workspaces)
+	if err != nil {
+		return nil, err
+	}
+	source, names := reportedRepository(workspaces, sourceRepository(req.Repository))
+	if source == "" {
+		return nil, fmt.Errorf("git workspace %s has no repository: %w", req.Repository, ErrInvalidInput)
+	}
+	documents = slices.DeleteFunc(documents, func(document *doc.Document) bool {
+		return !slices.Contains(names, document.SourceRepository)
+	})
+	// Members may only report on repositories the org already reads, so
+	// they can't make the server clone whatever they like
+	if len(names) == 1 && len(documents) == 0 && user.Role != "admin" {
+		return nil, fmt.Errorf("no git workspace or document uses repository %s: %w", req.Repository, ErrForbidden)
+	}
+
+	repo, err := s.git.Open(ctx, source)
+	if err != nil {
+		return nil, gitFailure(err)
+	}
+	result = &CodeChangeResult{Repository: req.Repository, Documents: []*CodeChangeDocument{}}
+	if result.To, err = repo.Resolve(ctx, req.To); err != nil {
+		return nil, gitFailure(err)
+	}
+	if req.From != "" {
+		if result.From, err = repo.Resolve(ctx, req.From); err != nil {
+			return nil, gitFailure(err)
+		}
+	}
+	commits, err := repo.Commits(ctx, result.From, result.To, maxCodeChangeCommits+1)
+	if err != nil {
+		return nil, gitFailure(err)
+	}
+	if len(commits) > maxCodeChangeCommits {
+		return nil, fmt.Errorf("the range has more than %d commits; report smaller ranges: %w", maxCodeChangeCommits, ErrInvalidInput)
+	}
+	result.Commits = len(commits)
+
+	// Symbols are looked up once each, however many documents name them
+	mentions := make(map[string]map[string]bool)
+	for _, document := range documents {
+		for _, symbol := range document.SourceSymbols {
+			if _, ok := mentions[symbol]; ok {
+				continue
+			}
+			if mentions[symbol], err = repo.Mentioning(ctx, result.From, result.To, symbol); err != nil {
+				return nil, gitFailure(err)
+			}
+		}
+	}
+
+	for _, document := range documents {
+		touched := touchingCommits(document, commits, mentions)
+		if len(touched) == 0 {
+			continue
+		}
+		changed, err := s.flagDocument(ctx, user, document, touched, req.Priority)
+		if err != nil {
+			return nil, err
+		}
+		if changed == nil {
+			continue
+		}
+		if changed.Opened {
+			result.FlagsOpened++
+		} else {
+			result.FlagsUpdated++
+		}
+		result.Documents = append(result.Documents, changed)
+	}
+
+	s.logger.InfoContext(ctx, "code change reported",
+		"repository", req.Repository, "from", result.From, "to", result.To, "commits", result.Commits,
+		"flags_opened", result.FlagsOpened, "flags_updated", result.FlagsUpdated, "user_id", user.ID)
+	return result, nil
+}
+
+// linkedDocuments returns the documents in workspaces that link to any
+// source path or symbol, leaving out removed pages
+func (s *CodeChangeService) linkedDocuments(ctx context.Context, workspaces []*doc.Workspace) ([]*doc.Document, error) {
+	var linked []*doc.Document
+	for _, ws := range workspaces {
+		docs, err := s.documentRepo.GetByWorkspaceID(ctx, ws.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load documents: %w", err)
+		}
+		for _, document := range docs {
+			if document.RemovedAt == nil && len(document.SourcePaths)+len(document.SourceSymbols) > 0 {
+				linked = append(linked, document)
+			}
+		}
+	}
+	return linked, nil
+}
+
+// reportedRepository resolves the repository a report names, the ID of one
+// of the org's git workspaces or a repository's path or URL, to the source
+// to open and every name documents may link it by: the source and the IDs
+// of the git workspaces reading it
+func reportedRepository(workspaces []*doc.Workspace, name string) (source string, names []string) {
+	source = name
+	for _, ws := range workspaces {
+		if ws.ID == name && ws.IntegrationType == "git" {
+			source = sourceRepository(gitSetting(ws, gitRepositoryKey))
+		}
+	}
+	names = []string{source}
+	for _, ws := range workspaces {
+		if ws.IntegrationType == "git" && sourceRepository(gitSetting(ws, gitRepositoryKey)) == source {
+			names = append(names, ws.ID)
+		}
+	}
+	return source, names
+}
+
+// touchingCommits returns the commits that change a file under one of the
+// document's source paths or, going by mentions, a line naming one of its
+// symbols
+func touchingCommits(document *doc.Document, commits []gitrepo.Commit, mentions map[string]map[string]bool) []gitrepo.Commit {
+	globs := sourceGlobs(document)
+	var touched []gitrepo.Commit
+	for _, commit := range commits {
+		hit := len(sourceFiles(globs, commit.Files)) > 0
+		for _, symbol := range document.SourceSymbols {
+			hit = hit || mentions[symbol][commit.Hash]
+		}
+		if hit {
+			touched = append(touched, commit)
+		}
+	}
+	return touched
+}
+
+// sourceGlobs compiles the document's source paths
+func sourceGlobs(document *doc.Document) []*gitrepo.Glob {
+	globs := make([]*gitrepo.Glob, 0, len(document.SourcePaths))
+	for _, path := range document.SourcePaths {
+		if glob, err := gitrepo.CompileGlob(path); err == nil {
+			globs = append(globs, glob)
+		}
+	}
+	return globs
+}
+
+// sourceFiles returns the files matching any of globs
+func sourceFiles(globs []*gitrepo.Glob, files []string) []string {
+	var matched []string
+	for _, file := range files {
+		if slices.ContainsFunc(globs, func(glob *gitrepo.Glob) bool { return glob.Match(file) }) {
+			matched = append(matched, file)
+		}
+	}
+	return matched
+}
+
+// flagDocument cites commits on the document's code change flag, opening one
+// if none is open. Commits made before the document's last edit, or cited
+// on one of its flags already, are left out; nil is returned if none are
+// left.
+func (s *CodeChangeService) flagDocument(ctx context.Context, user *doc.User, document *doc.Document, commits []gitrepo.Commit, priority string) (*CodeChangeDocument, error) {
+	flags, err := s.flagRepo.GetByDocumentID(ctx, document.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load flags: %w", err)
+	}
+	cited := make(map[string]bool)
+	var open *doc.Flag
+	for _, flag := range flags {
+		for _, hash := range flag.SourceCommits {
+			cited[hash] = true
+		}
+		if open == nil && len(flag.SourceCommits) > 0 && openFlag(flag) {
+			open = flag
+		}
+	}
+
+	// A document whose provider can't be reached is still flagged; its
+	// edit time just can't rule any commit out
+	var current *ProviderDocument
+	if document.ExternalID != "" {
+		if current, err = s.workspaceService.currentDocument(ctx, document); err != nil {
+			s.logger.WarnContext(ctx, "failed to load document's last edit", "document_id", document.ID, "error", err)
+			current = nil
+		}
+	}
+	commits = slices.DeleteFunc(slices.Clone(commits), func(commit gitrepo.Commit) bool {
+		return cited[commit.Hash] || (current != nil && current.EditedAt != nil && !commit.Time.After(*current.EditedAt))
+	})
+	if len(commits) == 0 {
+		return nil, nil
+	}
+
+	now := time.Now()
+	flag := open
+	if flag == nil {
+		flag = &doc.Flag{
+			DocumentID:  document.ID,
+			CreatedBy:   user.ID,
+			Title:       codeChangeTitle,
+			Description: "Code this document is linked to changed after it was last updated:\n",
+			Priority:    priority,
+			Status:      doc.FlagStatusPending,
+			CreatedAt:   now,
+		}
+		if document.OwnerID != "" {
+			owner := document.OwnerID
+			flag.AssignedTo = &owner
+		}
+		if current != nil {
+			flag.PageVersion = current.Version
+		}
+	}
+	// Commits come newest first; flags cite them oldest first
+	for i := len(commits) - 1; i >= 0; i-- {
+		commit := commits[i]
+		flag.SourceCommits = append(flag.SourceCommits, commit.Hash)
+		flag.Description += fmt.Sprintf("\n- %s %s (%s, %s)", shortHash(commit.Hash), commit.Subject, commit.Author, commit.Time.Format(time.DateOnly))
+	}
+	flag.UpdatedAt = now
+
+	if open == nil {
+		err = s.flagRepo.Create(ctx, flag)
+	} else {
+		err = s.flagRepo.Update(ctx, flag)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to save flag for document %s: %w", document.ID, err)
+	}
+	s.logger.InfoContext(ctx, "flag raised by code change",
+		"flag_id", flag.ID, "document_id", document.ID, "commits", len(commits), "opened", open == nil)
+
+	// Reload so the response carries the creator, assignee and document
+	if loaded, err := s.flagRepo.GetByID(ctx, flag.ID); err == nil {
+		flag = loaded
+	} else {
+		flag.Document = document
+	}
+	s.flagService.writeBack(ctx, flag)
+	newCommits := make([]api.Commit, len(commits))
+	for i, commit := range commits {
+		newCommits[i] = api.Commit(commit)
+	}
+	return &CodeChangeDocument{Document: document, Flag: flag, Opened: open == nil, Commits: newCommits}, nil
+}
+
+// shortHash abbreviates a commit hash as git does by default
+func shortHash(hash string) string {
+	if len(hash) > 7 {
+		return hash[:7]
+	}
+	return hash
+}
@@ -0,0 +1,177 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/shaunpua/updoc/internal/config"
+	"github.com/shaunpua/updoc/internal/confluence/confluencetest"
+	"github.com/shaunpua/updoc/internal/doc"
+)
+
+// codeEnv is a test env with two repositories under its local root, app
+// read by a git workspace and billing by none
+type codeEnv struct {
+	*testEnv
+	root, app, billing string
+	gitWS              *doc.Workspace
+}
+
+func newCodeEnv(t *testing.T) *codeEnv {
+	t.Helper()
+	root := t.TempDir()
+	env := &codeEnv{root: root, app: filepath.Join(root, "app"), billing: filepath.Join(root, "billing")}
+	gitCommit(t, env.app, "Start app", map[string]string{"README.md": "# App\n", "services/billing/charge.go": "package billing\n"})
+	gitCommit(t, env.billing, "Start billing", map[string]string{"services/billing/charge.go": "package billing\n"})
+	env.testEnv = newTestEnv(t, func(cfg *config.Config, _ *confluencetest.Options) {
+		cfg.Git.LocalRoots = []string{root}
+	})
+	env.sync(t)
+
+	var err error
+	env.gitWS, err = env.workspaces.Create(context.Background(), env.admin, doc.CreateWorkspaceRequest{
+		Name:              "App",
+		IntegrationType:   "git",
+		IntegrationConfig: map[string]interface{}{gitRepositoryKey: env.app},
+	})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	return env
+}
+
+func TestSetSourceLinks(t *testing.T) {
+	env := newCodeEnv(t)
+	ctx := context.Background()
+	member := env.addUser(t, "ben@acme.example.com", "Ben Ortiz")
+	guide := env.document(t, "102")
+	paths := []string{"services/billing/**"}
+
+	tests := []struct {
+		name       string
+		user       *doc.User
+		repository string
+		want       string
+		err        error
+	}{
+		{"git workspace", member, env.gitWS.ID, env.gitWS.ID, nil},
+		{"repository by an admin", env.admin, env.billing + "/", env.billing, nil},
+		{"repository by a member", member, env.billing, "", ErrForbidden},
+		{"URL by a member", member, "https://github.com/acme/app.git", "", ErrForbidden},
+		{"workspace that isn't git", member, env.ws.ID, "", ErrInvalidInput},
+		{"no repository", member, "", "", ErrInvalidInput},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			document, err := env.documents.SetSourceLinks(ctx, tt.user, guide.ID, tt.repository, paths, nil)
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Errorf("SetSourceLinks = %v, want %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil || document.SourceRepository != tt.want || !slices.Equal(document.SourcePaths, paths) {
+				t.Errorf("SetSourceLinks = %+v, %v, want repository %q", document, err, tt.want)
+			}
+		})
+	}
+
+	// Removing every link forgets the repository
+	document, err := env.documents.SetSourceLinks(ctx, member, guide.ID, env.gitWS.ID, nil, nil)
+	if err != nil || document.SourceRepository != "" {
+		t.Errorf("SetSourceLinks without links = %+v, %v, want no repository", document, err)
+	}
+
+	// A git workspace's documents are linked to its own repository
+	if _, err := env.workspaces.Sync(ctx, env.admin, env.gitWS.ID); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	readme, err := env.store.Documents().GetByExternalIDs(ctx, []string{env.gitWS.ID}, []string{"README.md"})
+	if err != nil || len(readme) != 1 {
+		t.Fatalf("README = %v, %v", readme, err)
+	}
+	if document, err := env.documents.SetSourceLinks(ctx, member, readme[0].ID, "", paths, nil); err != nil || document.SourceRepository != env.gitWS.ID {
+		t.Errorf("SetSourceLinks in a git workspace = %+v, %v, want its own repository", document, err)
+	}
+}
+
+func TestReportCodeChange(t *testing.T) {
+	env := newCodeEnv(t)
+	ctx := context.Background()
+	member := env.addUser(t, "ben@acme.example.com", "Ben Ortiz")
+
+	// The guide describes the app's billing code, the runbook the billing
+	// repository's, at the same paths
+	guide, runbook := env.document(t, "102"), env.document(t, "103")
+	paths := []string{"services/billing/**"}
+	if _, err := env.documents.SetSourceLinks(ctx, member, guide.ID, env.gitWS.ID, paths, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.documents.SetSourceLinks(ctx, env.admin, runbook.ID, env.billing, paths, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// Commits only count once they're newer than the pages' last edits
+	t.Setenv("GIT_COMMITTER_DATE", time.Now().Add(time.Minute).Format(time.RFC3339))
+	appCommit := gitCommit(t, env.app, "Charge in cents", map[string]string{"services/billing/charge.go": "package billing\n\n// cents\n"})
+	billingCommit := gitCommit(t, env.billing, "Refund in cents", map[string]string{"services/billing/charge.go": "package billing\n\n// refunds\n"})
+
+	flagged := func(result *CodeChangeResult) []string {
+		var ids []string
+		for _, d := range result.Documents {
+			ids = append(ids, d.Document.ID)
+		}
+		return ids
+	}
+
+	t.Run("by git workspace", func(t *testing.T) {
+		result, err := env.codes.Report(ctx, member, CodeChangeRequest{Repository: env.gitWS.ID, To: appCommit})
+		if err != nil {
+			t.Fatalf("Report: %v", err)
+		}
+		if ids := flagged(result); !slices.Equal(ids, []string{guide.ID}) || result.FlagsOpened != 1 {
+			t.Errorf("Report flagged %v, opened %d, want the guide alone", ids, result.FlagsOpened)
+		}
+		// The workspace's repository by path is the same repository
+		result, err = env.codes.Report(ctx, member, CodeChangeRequest{Repository: env.app, To: appCommit})
+		if err != nil || result.FlagsOpened+result.FlagsUpdated != 0 {
+			t.Errorf("Report by path = %+v, %v, want the commit already cited", result, err)
+		}
+	})
+
+	t.Run("by linked repository", func(t *testing.T) {
+		result, err := env.codes.Report(ctx, member, CodeChangeRequest{Repository: env.billing, To: billingCommit})
+		if err != nil {
+			t.Fatalf("Report: %v", err)
+		}
+		if ids := flagged(result); !slices.Equal(ids, []string{runbook.ID}) {
+			t.Errorf("Report flagged %v, want the runbook alone", ids)
+		}
+		flags, err := env.store.Flags().GetByDocumentID(ctx, runbook.ID)
+		if err != nil || len(flags) != 1 || !slices.Equal(flags[0].SourceCommits, []string{billingCommit}) {
+			t.Errorf("runbook flags = %v, %v, want one citing the billing commit", flags, err)
+		}
+	})
+
+	t.Run("unused repository", func(t *testing.T) {
+		other := filepath.Join(env.root, "other")
+		otherCommit := gitCommit(t, other, "Start other", map[string]string{"services/billing/charge.go": "package billing\n"})
+		for _, repository := range []string{other, "https://github.com/acme/other.git"} {
+			if _, err := env.codes.Report(ctx, member, CodeChangeRequest{Repository: repository, To: "HEAD"}); !errors.Is(err, ErrForbidden) {
+				t.Errorf("Report on %s by a member = %v, want ErrForbidden", repository, err)
+			}
+		}
+		result, err := env.codes.Report(ctx, env.admin, CodeChangeRequest{Repository: other, To: otherCommit})
+		if err != nil || len(result.Documents) != 0 || result.Commits != 1 {
+			t.Errorf("Report on %s by an admin = %+v, %v, want nothing flagged", other, result, err)
+		}
+	})
+
+	if _, err := env.codes.Report(ctx, member, CodeChangeRequest{Repository: env.ws.ID, To: "HEAD"}); !errors.Is(err, ErrForbidden) {
+		t.Errorf("Report on a Confluence workspace = %v, want ErrForbidden", err)
+	}
+}
@@ -0,0 +1,193 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/shaunpua/updoc/internal/doc"
+	"github.com/shaunpua/updoc/pkg/api"
+)
+
+const (
+	// maxImpactFiles bounds how many changed files one impact check takes
+	maxImpactFiles = 10000
+	// maxImpactFilesListed bounds how many files a pull request flag lists
+	maxImpactFilesListed = 20
+	// maxPullRequestLength bounds the pull request reference flags are tagged with
+	maxPullRequestLength = 200
+)
+
+// Impact checks are API types
+type (
+	ImpactRequest    = api.ImpactRequest
+	ImpactResult     = api.ImpactResult
+	ImpactedDocument = api.ImpactedDocument
+)
+
+// Impact returns the documents in the user's organization linked to a pull
+// request's repository whose source paths match any of the files it
+// changes, ordered by title, with their owners and open flags. Only what
+// UpDoc has stored is read to find them, so it works without reaching the
+// repository or any provider; for the same reason source symbols aren't
+// matched. With CreateFlags each
+// document gets a pending flag tagged with the pull request, raised by the
+// user, assigned to the document's owner and written back to the page like
+// any other flag, unless one was opened for it before.
+func (s *CodeChangeService) Impact(ctx context.Context, user *doc.User, req ImpactRequest) (*ImpactResult, error) {
+	if strings.TrimSpace(req.Repository) == "" {
+		return nil, fmt.Errorf("repository is required: %w", ErrInvalidInput)
+	}
+	req.PullRequest = strings.TrimSpace(req.PullRequest)
+	if len(req.PullRequest) > maxPullRequestLength {
+		return nil, fmt.Errorf("pull_request can be at most %d characters: %w", maxPullRequestLength, ErrInvalidInput)
+	}
+	if req.CreateFlags {
+		if req.PullRequest == "" {
+			return nil, fmt.Errorf("pull_request is required to create flags: %w", ErrInvalidInput)
+		}
+		if req.Priority == "" {
+			req.Priority = doc.PriorityMedium
+		}
+		if !doc.ValidPriority(req.Priority) {
+			return nil, fmt.Errorf("priority must be one of urgent, high, medium, low: %w", ErrInvalidInput)
+		}
+	}
+	if len(req.Files) > maxImpactFiles {
+		return nil, fmt.Errorf("at most %d files can be checked at once: %w", maxImpactFiles, ErrInvalidInput)
+	}
+	var files []string
+	seen := make(map[string]bool, len(req.Files))
+	for _, file := range req.Files {
+		file = strings.TrimPrefix(strings.TrimPrefix(strings.TrimSpace(file), "./"), "/")
+		if file != "" && !seen[file] {
+			seen[file] = true
+			files = append(files, file)
+		}
+	}
+
+	workspaces, err := s.workspaceService.List(ctx, user)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load workspaces: %w", err)
+	}
+	documents, err := s.linkedDocuments(ctx, workspaces)
+	if err != nil {
+		return nil, err
+	}
+	// Repositories often share paths, so only the pull request's counts
+	_, names := reportedRepository(workspaces, sourceRepository(req.Repository))
+	documents = slices.DeleteFunc(documents, func(document *doc.Document) bool {
+		return !slices.Contains(names, document.SourceRepository)
+	})
+	users, err := s.userRepo.GetByOrgID(ctx, user.OrgID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load users: %w", err)
+	}
+
+	// The affected documents' flags are loaded together
+	matches := make(map[string][]string)
+	var affected []string
+	for _, document := range documents {
+		if matched := sourceFiles(sourceGlobs(document), files); len(matched) > 0 {
+			matches[document.ID] = matched
+			affected = append(affected, document.ID)
+		}
+	}
+	flags, err := s.flagRepo.GetByDocumentIDs(ctx, affected)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load flags: %w", err)
+	}
+	byDocument := make(map[string][]*doc.Flag, len(affected))
+	for _, flag := range flags {
+		byDocument[flag.DocumentID] = append(byDocument[flag.DocumentID], flag)
+	}
+
+	result := &ImpactResult{Repository: req.Repository, PullRequest: req.PullRequest, Files: len(files), Documents: []*ImpactedDocument{}}
+	for _, document := range documents {
+		matched := matches[document.ID]
+		if len(matched) == 0 {
+			continue
+		}
+		impacted := &ImpactedDocument{Document: document, Files: matched, OpenFlags: []*doc.Flag{}}
+		for _, u := range users {
+			if u.ID == document.OwnerID {
+				impacted.Owner = u
+			}
+		}
+
+		for _, flag := range byDocument[document.ID] {
+			if openFlag(flag) {
+				impacted.OpenFlags = append(impacted.OpenFlags, flag)
+			}
+			if req.PullRequest != "" && flag.PullRequest == req.PullRequest && impacted.Flag == nil {
+				impacted.Flag = flag
+			}
+		}
+
+		if req.CreateFlags && impacted.Flag == nil {
+			flag, err := s.openImpactFlag(ctx, user, document, req, matched)
+			if err != nil {
+				return nil, err
+			}
+			impacted.Flag = flag
+			impacted.Opened = true
+			impacted.OpenFlags = append(impacted.OpenFlags, flag)
+			result.FlagsOpened++
+		}
+		result.Documents = append(result.Documents, impacted)
+	}
+	slices.SortFunc(result.Documents, func(a, b *ImpactedDocument) int {
+		return strings.Compare(strings.ToLower(a.Document.Title), strings.ToLower(b.Document.Title))
+	})
+
+	s.logger.InfoContext(ctx, "pull request impact checked",
+		"repository", req.Repository, "pull_request", req.PullRequest, "files", len(files), "documents", len(result.Documents),
+		"flags_opened", result.FlagsOpened, "user_id", user.ID)
+	return result, nil
+}
+
+// openImpactFlag opens a pending flag on document for the pull request in
+// req, listing the changed files it is linked to, and writes it back
+func (s *CodeChangeService) openImpactFlag(ctx context.Context, user *doc.User, document *doc.Document, req ImpactRequest, files []string) (*doc.Flag, error) {
+	var description strings.Builder
+	fmt.Fprintf(&description, "%s changes files this document is linked to:\n", req.PullRequest)
+	for i, file := range files {
+		if i == maxImpactFilesListed {
+			fmt.Fprintf(&description, "\n- and %d more", len(files)-i)
+			break
+		}
+		fmt.Fprintf(&description, "\n- %s", file)
+	}
+
+	now := time.Now()
+	flag := &doc.Flag{
+		DocumentID:  document.ID,
+		CreatedBy:   user.ID,
+		Title:       fmt.Sprintf("May need updating for %s", req.PullRequest),
+		Description: description.String(),
+		Priority:    req.Priority,
+		Status:      doc.FlagStatusPending,
+		PullRequest: req.PullRequest,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if document.OwnerID != "" {
+		owner := document.OwnerID
+		flag.AssignedTo = &owner
+	}
+	if err := s.flagRepo.Create(ctx, flag); err != nil {
+		return nil, fmt.Errorf("failed to create flag for document %s: %w", document.ID, err)
+	}
+	s.logger.InfoContext(ctx, "flag opened for pull request", "flag_id", flag.ID, "document_id", document.ID, "pull_request", req.PullRequest)
+
+	// Reload so the response carries the creator, assignee and document
+	if loaded, err := s.flagRepo.GetByID(ctx, flag.ID); err == nil {
+		flag = loaded
+	} else {
+		flag.Document = document
+	}
+	s.flagService.writeBack(ctx, flag)
+	return flag, nil
+}
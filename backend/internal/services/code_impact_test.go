@@ -0,0 +1,136 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/shaunpua/updoc/internal/doc"
+)
+
+func TestImpact(t *testing.T) {
+	env := newCodeEnv(t)
+	ctx := context.Background()
+	ben := env.addUser(t, "ben@acme.example.com", "Ben Ortiz")
+	if _, err := env.workspaces.SetWriteBack(ctx, env.admin, env.ws.ID, WriteBackSettings{Mode: WriteBackComment}); err != nil {
+		t.Fatalf("SetWriteBack: %v", err)
+	}
+
+	guide, runbook, webhooks := env.document(t, "102"), env.document(t, "103"), env.document(t, "104")
+	guide.OwnerID = ben.ID
+	if err := env.store.Documents().Update(ctx, guide); err != nil {
+		t.Fatal(err)
+	}
+	for document, paths := range map[*doc.Document][]string{
+		guide:    {"services/billing/**"},
+		runbook:  {"deploy/**", "services/billing/refund.go"},
+		webhooks: {"services/hooks/**"},
+	} {
+		if _, err := env.documents.SetSourceLinks(ctx, env.admin, document.ID, env.gitWS.ID, paths, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stale, err := env.flags.Create(ctx, env.admin, doc.CreateFlagRequest{DocumentID: guide.ID, Title: "Examples are stale", Priority: doc.PriorityLow})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := ImpactRequest{
+		Repository:  env.gitWS.ID,
+		Files:       []string{"./services/billing/charge.go", "/services/billing/refund.go", "README.md"},
+		PullRequest: "acme/app#42",
+	}
+	result, err := env.codes.Impact(ctx, ben, req)
+	if err != nil {
+		t.Fatalf("Impact: %v", err)
+	}
+	if len(result.Documents) != 2 || result.Documents[0].Document.ID != guide.ID || result.Documents[1].Document.ID != runbook.ID {
+		t.Fatalf("Impact = %+v, want the guide and the runbook by title", result.Documents)
+	}
+	impacted := result.Documents[0]
+	if impacted.Owner == nil || impacted.Owner.ID != ben.ID || !slices.Equal(impacted.Files, []string{"services/billing/charge.go", "services/billing/refund.go"}) {
+		t.Errorf("guide = owner %+v, files %v", impacted.Owner, impacted.Files)
+	}
+	if len(impacted.OpenFlags) != 1 || impacted.OpenFlags[0].ID != stale.ID || impacted.Flag != nil || result.FlagsOpened != 0 {
+		t.Errorf("guide flags = %+v, want only its open flag", impacted.OpenFlags)
+	}
+	if files := result.Documents[1].Files; !slices.Equal(files, []string{"services/billing/refund.go"}) {
+		t.Errorf("runbook files = %v", files)
+	}
+
+	// Flags opened for the pull request are written back, once
+	req.CreateFlags = true
+	if result, err = env.codes.Impact(ctx, ben, req); err != nil {
+		t.Fatalf("Impact creating flags: %v", err)
+	}
+	if result.FlagsOpened != 2 {
+		t.Fatalf("Impact opened %d flags, want 2", result.FlagsOpened)
+	}
+	flag := result.Documents[0].Flag
+	if flag == nil || flag.PullRequest != req.PullRequest || flag.AssignedTo == nil || *flag.AssignedTo != ben.ID || len(result.Documents[0].OpenFlags) != 2 {
+		t.Errorf("guide flag = %+v", flag)
+	}
+	comments := env.site.Comments("103")
+	if len(comments) != 1 || !strings.Contains(comments[0].Body, "May need updating for acme/app#42") {
+		t.Errorf("comments on the runbook = %+v, want the pull request flag's", comments)
+	}
+	if stored, _ := env.store.Flags().GetByID(ctx, result.Documents[1].Flag.ID); stored.ConfluenceCommentID == "" {
+		t.Error("the pull request flag's comment ID wasn't saved")
+	}
+
+	if result, err = env.codes.Impact(ctx, ben, req); err != nil {
+		t.Fatalf("second Impact: %v", err)
+	}
+	if result.FlagsOpened != 0 || result.Documents[0].Flag == nil || result.Documents[0].Flag.ID != flag.ID {
+		t.Errorf("second Impact = %+v, want the same flags found again", result)
+	}
+	if comments := env.site.Comments("103"); len(comments) != 1 {
+		t.Errorf("comments on the runbook after checking again = %d, want 1", len(comments))
+	}
+}
+
+func TestImpactRepositories(t *testing.T) {
+	env := newCodeEnv(t)
+	ctx := context.Background()
+
+	// Both repositories have services/billing; each document is linked to one
+	guide, runbook := env.document(t, "102"), env.document(t, "103")
+	if _, err := env.documents.SetSourceLinks(ctx, env.admin, guide.ID, env.gitWS.ID, []string{"services/billing/**"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.documents.SetSourceLinks(ctx, env.admin, runbook.ID, env.billing, []string{"services/billing/**"}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		repository string
+		want       []string
+	}{
+		{"git workspace", env.gitWS.ID, []string{guide.ID}},
+		{"git workspace's repository", env.app + "/", []string{guide.ID}},
+		{"repository", env.billing, []string{runbook.ID}},
+		{"unlinked repository", env.root, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := env.codes.Impact(ctx, env.admin, ImpactRequest{Repository: tt.repository, Files: []string{"services/billing/charge.go"}})
+			if err != nil {
+				t.Fatalf("Impact: %v", err)
+			}
+			var got []string
+			for _, d := range result.Documents {
+				got = append(got, d.Document.ID)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Impact documents = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := env.codes.Impact(ctx, env.admin, ImpactRequest{Files: []string{"services/billing/charge.go"}}); !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("Impact without a repository = %v, want ErrInvalidInput", err)
+	}
+}
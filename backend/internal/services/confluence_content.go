@@ -0,0 +1,269 @@
+package services
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/shaunpua/updoc/internal/confluence"
+	"github.com/shaunpua/updoc/internal/confluence/render"
+	"github.com/shaunpua/updoc/pkg/api"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// contentCacheBytes bounds the rendered page bodies kept in memory
+const contentCacheBytes = 32 << 20
+
+// ConfluencePageContent is a page body at one version, rendered for display
+type ConfluencePageContent = api.ConfluencePageContent
+
+// PageContent fetches a page's body in representation (storage, the
+// default, or view) at version, 0 being the current one, and renders it as
+// sanitized HTML and Markdown. A version's body never changes, so renderings
+// are cached by version; finding the current version costs a small request.
+func (s *ConfluenceService) PageContent(ctx context.Context, orgID, pageID string, version int, representation string) (_ *ConfluencePageContent, err error) {
+	if representation == "" {
+		representation = "storage"
+	}
+	ctx, span := tracer.Start(ctx, "ConfluenceService.PageContent", trace.WithAttributes(
+		attribute.String("updoc.org_id", orgID),
+		attribute.String("confluence.page_id", pageID),
+		attribute.Int("confluence.version", version),
+		attribute.String("confluence.representation", representation),
+	))
+	defer func() { finishSpan(span, err) }()
+
+	if representation != "storage" && representation != "view" {
+		return nil, fmt.Errorf("format must be storage or view: %w", ErrInvalidInput)
+	}
+	org, err := s.orgRepo.GetByID(ctx, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("organization %s: %w", orgID, ErrNotFound)
+	}
+	if !configured(org) {
+		return nil, fmt.Errorf("confluence integration not configured: %w", ErrInvalidInput)
+	}
+	site := s.site(org)
+
+	current := version
+	if current == 0 {
+		head, err := currentVersion(ctx, site, pageID)
+		if err != nil {
+			return nil, err
+		}
+		current = head.Number
+	}
+
+	key := org.ID + "/" + pageID + "/" + strconv.Itoa(current) + "/" + representation
+	if cached, ok := s.content.get(key); ok {
+		span.SetAttributes(attribute.Bool("confluence.cached", true))
+		cached.Cached = true
+		return &cached, nil
+	}
+
+	page, err := site.GetContent(ctx, pageID, confluence.ContentGetQuery{
+		Version: version,
+		Expand:  []string{"body." + representation, "version", "space"},
+	})
+	if err != nil {
+		return nil, pageFailure(pageID, err)
+	}
+
+	body := page.Body.Storage
+	if representation == "view" {
+		body = page.Body.View
+	}
+	if body == nil {
+		return nil, fmt.Errorf("confluence returned no %s body for page %s", representation, pageID)
+	}
+	opts := render.Options{BaseURL: site.BaseURL(), SpaceKey: page.Space.Key, PageID: page.ID}
+	var rendered *render.Page
+	if representation == "view" {
+		if rendered, err = render.View(body.Value, opts); err != nil {
+			return nil, fmt.Errorf("failed to render page %s: %w", pageID, err)
+		}
+	} else {
+		rendered = render.Storage(body.Value, opts)
+	}
+
+	content := ConfluencePageContent{
+		PageID:         page.ID,
+		Title:          page.Title,
+		URL:            site.WebURL(page.Links.Base, page.Links.WebUI),
+		Representation: representation,
+		HTML:           rendered.HTML,
+		Markdown:       rendered.Markdown,
+		FetchedAt:      time.Now(),
+	}
+	if v := page.Version; v != nil {
+		content.Version = v.Number
+		if !v.When.IsZero() {
+			when := v.When
+			content.ModifiedAt = &when
+		}
+		content.ModifiedBy = v.By.DisplayName
+	}
+	// Key by the version actually returned, which is newer than current if
+	// the page was edited in between
+	if content.Version > 0 {
+		s.content.put(org.ID+"/"+pageID+"/"+strconv.Itoa(content.Version)+"/"+representation, content)
+	}
+	return &content, nil
+}
+
+// ConfluencePageVersion is a page's current version and who made it
+type ConfluencePageVersion struct {
+	Number     int        `json:"number"`
+	ModifiedAt *time.Time `json:"modified_at,omitempty"`
+	ModifiedBy string     `json:"modified_by,omitempty"`
+}
+
+// PageVersion returns a page's current version
+func (s *ConfluenceService) PageVersion(ctx context.Context, orgID, pageID string) (_ *ConfluencePageVersion, err error) {
+	ctx, span := tracer.Start(ctx, "ConfluenceService.PageVersion", trace.WithAttributes(
+		attribute.String("updoc.org_id", orgID),
+		attribute.String("confluence.page_id", pageID),
+	))
+	defer func() { finishSpan(span, err) }()
+
+	org, err := s.orgRepo.GetByID(ctx, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("organization %s: %w", orgID, ErrNotFound)
+	}
+	if !configured(org) {
+		return nil, fmt.Errorf("confluence integration not configured: %w", ErrInvalidInput)
+	}
+	return currentVersion(ctx, s.site(org), pageID)
+}
+
+// Page returns a page's metadata, its place in the page tree and labels
+// included, with its current version
+func (s *ConfluenceService) Page(ctx context.Context, orgID, pageID string) (_ *ConfluencePageInfo, _ *ConfluencePageVersion, err error) {
+	ctx, span := tracer.Start(ctx, "ConfluenceService.Page", trace.WithAttributes(
+		attribute.String("updoc.org_id", orgID),
+		attribute.String("confluence.page_id", pageID),
+	))
+	defer func() { finishSpan(span, err) }()
+
+	org, err := s.orgRepo.GetByID(ctx, orgID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("organization %s: %w", orgID, ErrNotFound)
+	}
+	if !configured(org) {
+		return nil, nil, fmt.Errorf("confluence integration not configured: %w", ErrInvalidInput)
+	}
+	site := s.site(org)
+	page, err := site.GetContent(ctx, pageID, confluence.ContentGetQuery{
+		Expand: []string{"version", "space", "ancestors", "metadata.labels"},
+	})
+	if err != nil {
+		return nil, nil, pageFailure(pageID, err)
+	}
+	if page.Version == nil {
+		return nil, nil, fmt.Errorf("confluence returned no version for page %s", pageID)
+	}
+
+	info := &ConfluencePageInfo{
+		ID:     page.ID,
+		Title:  page.Title,
+		URL:    site.WebURL(page.Links.Base, page.Links.WebUI),
+		Space:  page.Space.Key,
+		Labels: page.LabelNames(),
+	}
+	if ancestors := page.AncestorIDs(); len(ancestors) > 0 {
+		info.Ancestors = ancestors
+		info.ParentID = ancestors[len(ancestors)-1]
+	}
+	version := &ConfluencePageVersion{Number: page.Version.Number, ModifiedBy: page.Version.By.DisplayName}
+	if !page.Version.When.IsZero() {
+		when := page.Version.When
+		version.ModifiedAt = &when
+	}
+	return info, version, nil
+}
+
+// currentVersion fetches a page without its body to learn its version
+func currentVersion(ctx context.Context, site *confluence.Site, pageID string) (*ConfluencePageVersion, error) {
+	head, err := site.GetContent(ctx, pageID, confluence.ContentGetQuery{Expand: []string{"version"}})
+	if err != nil {
+		return nil, pageFailure(pageID, err)
+	}
+	if head.Version == nil {
+		return nil, fmt.Errorf("confluence returned no version for page %s", pageID)
+	}
+	version := &ConfluencePageVersion{Number: head.Version.Number, ModifiedBy: head.Version.By.DisplayName}
+	if !head.Version.When.IsZero() {
+		when := head.Version.When
+		version.ModifiedAt = &when
+	}
+	return version, nil
+}
+
+// pageFailure maps a failed page fetch: a missing page is not found,
+// anything else is Confluence's problem or unexpected
+func pageFailure(pageID string, err error) error {
+	var apiErr *confluence.APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("confluence page %s: %w", pageID, ErrNotFound)
+	}
+	return fmt.Errorf("failed to fetch page %s: %w", pageID, unavailable(err))
+}
+
+// contentCache keeps rendered page bodies up to a total size, evicting the
+// least recently used
+type contentCache struct {
+	mu       sync.Mutex
+	maxBytes int
+	bytes    int
+	order    *list.List
+	entries  map[string]*list.Element
+}
+
+type cacheEntry struct {
+	key     string
+	content ConfluencePageContent
+	size    int
+}
+
+func newContentCache(maxBytes int) *contentCache {
+	return &contentCache{maxBytes: maxBytes, order: list.New(), entries: make(map[string]*list.Element)}
+}
+
+func (c *contentCache) get(key string) (ConfluencePageContent, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[key]
+	if !ok {
+		return ConfluencePageContent{}, false
+	}
+	c.order.MoveToFront(el)
+	return el.Value.(*cacheEntry).content, true
+}
+
+func (c *contentCache) put(key string, content ConfluencePageContent) {
+	size := len(content.HTML) + len(content.Markdown) + len(content.Title)
+	if size > c.maxBytes {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[key]; ok {
+		c.bytes -= el.Value.(*cacheEntry).size
+		c.order.Remove(el)
+	}
+	c.entries[key] = c.order.PushFront(&cacheEntry{key: key, content: content, size: size})
+	c.bytes += size
+	for c.bytes > c.maxBytes {
+		oldest := c.order.Back()
+		entry := oldest.Value.(*cacheEntry)
+		c.order.Remove(oldest)
+		delete(c.entries, entry.key)
+		c.bytes -= entry.size
+	}
+}
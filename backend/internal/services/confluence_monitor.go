@@ -0,0 +1,115 @@
+package services
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/shaunpua/updoc/internal/doc"
+)
+
+// ConfluenceSummary is the result of the monitor's latest round
+type ConfluenceSummary struct {
+	CheckedAt  time.Time `json:"checked_at"`
+	Configured int       `json:"configured"`
+	Reachable  int       `json:"reachable"`
+	// Unreachable lists the slugs of organizations whose connection test failed
+	Unreachable []string `json:"unreachable,omitempty"`
+	// Degraded lists the slugs of organizations whose circuit breaker is open
+	Degraded []string `json:"degraded,omitempty"`
+}
+
+// ConfluenceMonitor periodically tests every organization's Confluence
+// connection and caches the results, so readiness probes can report
+// Atlassian reachability without calling it on every probe
+type ConfluenceMonitor struct {
+	orgRepo           doc.OrganizationRepository
+	confluenceService *ConfluenceService
+	interval          time.Duration
+	timeout           time.Duration
+	logger            *slog.Logger
+
+	mu       sync.RWMutex
+	summary  ConfluenceSummary
+	lastBeat time.Time
+}
+
+// NewConfluenceMonitor checks every interval, giving each organization at most timeout
+func NewConfluenceMonitor(orgRepo doc.OrganizationRepository, confluenceService *ConfluenceService, interval, timeout time.Duration, logger *slog.Logger) *ConfluenceMonitor {
+	return &ConfluenceMonitor{
+		orgRepo:           orgRepo,
+		confluenceService: confluenceService,
+		interval:          interval,
+		timeout:           timeout,
+		logger:            logger.With("component", "confluence_monitor"),
+		lastBeat:          time.Now(),
+	}
+}
+
+// Run checks immediately and then every interval until ctx is cancelled
+func (m *ConfluenceMonitor) Run(ctx context.Context) {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	for {
+		m.check(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Summary returns the latest results; ok is false until the first round finishes
+func (m *ConfluenceMonitor) Summary() (summary ConfluenceSummary, ok bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.summary, !m.summary.CheckedAt.IsZero()
+}
+
+// LastBeat is when the monitor last completed a round, or was created
+func (m *ConfluenceMonitor) LastBeat() time.Time {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.lastBeat
+}
+
+func (m *ConfluenceMonitor) check(ctx context.Context) {
+	orgs, err := m.orgRepo.List(ctx)
+	if err != nil {
+		m.logger.WarnContext(ctx, "failed to list organizations", "error", err)
+		return
+	}
+
+	summary := ConfluenceSummary{}
+	for _, org := range orgs {
+		if org.ConfluenceBaseURL == "" {
+			continue
+		}
+		summary.Configured++
+
+		checkCtx, cancel := context.WithTimeout(ctx, m.timeout)
+		result, err := m.confluenceService.TestConnection(checkCtx, org.ID)
+		cancel()
+		if m.confluenceService.Degraded(org) {
+			summary.Degraded = append(summary.Degraded, org.Slug)
+		}
+		if err != nil || !result.Success {
+			summary.Unreachable = append(summary.Unreachable, org.Slug)
+			continue
+		}
+		summary.Reachable++
+	}
+	summary.CheckedAt = time.Now()
+
+	if len(summary.Unreachable) > 0 {
+		m.logger.WarnContext(ctx, "confluence unreachable", "orgs", summary.Unreachable)
+	}
+
+	m.mu.Lock()
+	m.summary = summary
+	m.lastBeat = summary.CheckedAt
+	m.mu.Unlock()
+}
@@ -0,0 +1,189 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/shaunpua/updoc/internal/confluence"
+	"github.com/shaunpua/updoc/internal/doc"
+	"github.com/shaunpua/updoc/internal/secret"
+	"github.com/shaunpua/updoc/pkg/api"
+)
+
+// oauthState is carried through Atlassian in the state parameter, sealed
+// with the encryption key so the callback can trust which organization and
+// admin started the flow, and when
+type oauthState struct {
+	OrgID   string    `json:"org"`
+	UserID  string    `json:"user"`
+	Expires time.Time `json:"exp"`
+	Nonce   string    `json:"nonce"`
+}
+
+// ConfluenceOAuthStart is where to send an admin to connect Confluence
+type ConfluenceOAuthStart = api.ConfluenceOAuthStart
+
+type ConfluenceOAuthResult struct {
+	Organization *doc.Organization `json:"organization"`
+	SiteName     string            `json:"site_name"`
+	SiteURL      string            `json:"site_url"`
+	CloudID      string            `json:"cloud_id"`
+	Scopes       []string          `json:"scopes"`
+	ExpiresAt    time.Time         `json:"expires_at"`
+}
+
+// StartOAuth begins connecting orgID's Confluence through Atlassian OAuth on
+// behalf of one of its admins
+func (s *ConfluenceService) StartOAuth(ctx context.Context, admin *doc.User, orgID string) (*ConfluenceOAuthStart, error) {
+	if admin.OrgID != orgID || admin.Role != "admin" {
+		return nil, fmt.Errorf("only admins of this organization can connect Confluence: %w", ErrForbidden)
+	}
+	oauth := s.client.OAuth()
+	if !oauth.Enabled() {
+		return nil, fmt.Errorf("Atlassian OAuth is not configured on this server: %w", ErrInvalidInput)
+	}
+	if _, err := s.orgRepo.GetByID(ctx, orgID); err != nil {
+		return nil, fmt.Errorf("organization %s: %w", orgID, ErrNotFound)
+	}
+
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	st := oauthState{
+		OrgID:   orgID,
+		UserID:  admin.ID,
+		Expires: time.Now().Add(oauth.StateTTL()).UTC(),
+		Nonce:   base64.RawURLEncoding.EncodeToString(nonce),
+	}
+	raw, err := json.Marshal(st)
+	if err != nil {
+		return nil, err
+	}
+	state, err := s.cipher.Encrypt(string(raw))
+	if err != nil {
+		return nil, fmt.Errorf("failed to seal oauth state: %w", err)
+	}
+
+	s.logger.InfoContext(ctx, "confluence oauth started", "org_id", orgID, "user_id", admin.ID)
+	return &ConfluenceOAuthStart{AuthorizationURL: oauth.AuthCodeURL(state), ExpiresAt: st.Expires}, nil
+}
+
+// CompleteOAuth handles Atlassian's redirect back: it checks state, trades
+// code for tokens, works out which site the grant is for and stores the
+// connection on the organization
+func (s *ConfluenceService) CompleteOAuth(ctx context.Context, code, state string) (*ConfluenceOAuthResult, error) {
+	if code == "" || state == "" {
+		return nil, fmt.Errorf("code and state are required: %w", ErrInvalidInput)
+	}
+	// Decrypt passes unsealed values through as legacy plaintext, which
+	// would let anyone forge a state
+	if !secret.IsEncrypted(state) {
+		return nil, fmt.Errorf("invalid oauth state: %w", ErrInvalidInput)
+	}
+	raw, err := s.cipher.Decrypt(state)
+	var st oauthState
+	if err == nil {
+		err = json.Unmarshal([]byte(raw), &st)
+	}
+	if err != nil || st.OrgID == "" {
+		return nil, fmt.Errorf("invalid oauth state: %w", ErrInvalidInput)
+	}
+	if time.Now().After(st.Expires) {
+		return nil, fmt.Errorf("oauth state expired; start connecting again: %w", ErrInvalidInput)
+	}
+
+	org, err := s.orgRepo.GetByID(ctx, st.OrgID)
+	if err != nil {
+		return nil, fmt.Errorf("organization %s: %w", st.OrgID, ErrNotFound)
+	}
+
+	oauth := s.client.OAuth()
+	token, err := oauth.Exchange(ctx, code)
+	if err != nil {
+		return nil, oauthFailure(err)
+	}
+	resources, err := oauth.Resources(ctx, token.AccessToken)
+	if err != nil {
+		return nil, oauthFailure(err)
+	}
+	site, err := pickResource(resources, org.ConfluenceBaseURL)
+	if err != nil {
+		return nil, err
+	}
+
+	org.ConfluenceAuthMode = string(confluence.AuthOAuth)
+	org.ConfluenceBaseURL = strings.TrimRight(site.URL, "/") + "/wiki"
+	org.ConfluenceEmail = ""
+	org.ConfluenceToken = token.AccessToken
+	org.ConfluenceRefreshToken = token.RefreshToken
+	org.ConfluenceTokenExpiry = token.Expiry
+	org.ConfluenceCloudID = site.ID
+	if err := s.orgRepo.UpdateConfluence(ctx, org); err != nil {
+		return nil, fmt.Errorf("failed to save confluence connection: %w", err)
+	}
+
+	s.logger.InfoContext(ctx, "confluence connected through oauth",
+		"org_id", org.ID, "user_id", st.UserID, "site", site.URL, "cloud_id", site.ID)
+	return &ConfluenceOAuthResult{
+		Organization: org,
+		SiteName:     site.Name,
+		SiteURL:      site.URL,
+		CloudID:      site.ID,
+		Scopes:       strings.Fields(token.Scope),
+		ExpiresAt:    token.Expiry,
+	}, nil
+}
+
+// pickResource chooses the site to connect: the one matching the org's
+// configured base URL, or the only one granted when none is configured
+func pickResource(resources []confluence.Resource, baseURL string) (*confluence.Resource, error) {
+	if len(resources) == 0 {
+		return nil, fmt.Errorf("the grant doesn't include any Confluence site: %w", ErrInvalidInput)
+	}
+	if baseURL == "" {
+		if len(resources) > 1 {
+			urls := make([]string, len(resources))
+			for i, r := range resources {
+				urls[i] = r.URL
+			}
+			return nil, fmt.Errorf("access was granted to several sites (%s); set the organization's confluence_base_url to choose one: %w",
+				strings.Join(urls, ", "), ErrInvalidInput)
+		}
+		return &resources[0], nil
+	}
+
+	want := hostOf(baseURL)
+	for i, r := range resources {
+		if hostOf(r.URL) == want {
+			return &resources[i], nil
+		}
+	}
+	return nil, fmt.Errorf("access wasn't granted to %s; approve that site when connecting: %w", want, ErrInvalidInput)
+}
+
+func hostOf(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	return strings.ToLower(u.Host)
+}
+
+// oauthFailure maps a failed token exchange or site lookup: a rejected code
+// or token is the caller's problem, anything else is Atlassian's
+func oauthFailure(err error) error {
+	var oauthErr *confluence.OAuthError
+	var apiErr *confluence.APIError
+	if (errors.As(err, &oauthErr) && oauthErr.StatusCode < 500) || (errors.As(err, &apiErr) && apiErr.Unauthorized()) {
+		return fmt.Errorf("%w: %w", ErrInvalidInput, err)
+	}
+	return unavailable(err)
+}
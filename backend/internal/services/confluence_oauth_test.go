@@ -0,0 +1,179 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/shaunpua/updoc/internal/config"
+	"github.com/shaunpua/updoc/internal/confluence"
+	"github.com/shaunpua/updoc/internal/confluence/confluencetest"
+)
+
+// withOAuth enables the fake site's OAuth stub and the app UpDoc uses with
+// it. tokenTTL is how long access tokens last; 0 means an hour.
+func withOAuth(tokenTTL time.Duration) testOption {
+	return func(cfg *config.Config, site *confluencetest.Options) {
+		site.OAuthClientID, site.OAuthClientSecret, site.OAuthTokenTTL = "updoc-app", "app-secret", tokenTTL
+		cfg.Confluence.OAuth.ClientID = "updoc-app"
+		cfg.Confluence.OAuth.ClientSecret = "app-secret"
+		cfg.Confluence.OAuth.RedirectURL = "https://updoc.example.com/api/v1/confluence/oauth/callback"
+	}
+}
+
+// authorize starts connecting the env's org and approves it on the fake
+// site, returning the code and state Atlassian redirects back with
+func (env *testEnv) authorize(t *testing.T) (code, state string) {
+	t.Helper()
+	start, err := env.confluence.StartOAuth(context.Background(), env.admin, env.org.ID)
+	if err != nil {
+		t.Fatalf("StartOAuth: %v", err)
+	}
+
+	noRedirect := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := noRedirect.Get(start.AuthorizationURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	back, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil || resp.StatusCode != http.StatusFound {
+		t.Fatalf("authorize = HTTP %d to %q, want a redirect", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	if back.Host != "updoc.example.com" {
+		t.Fatalf("redirected to %s, want the configured callback", back)
+	}
+	return back.Query().Get("code"), back.Query().Get("state")
+}
+
+func TestCompleteOAuth(t *testing.T) {
+	env := newTestEnv(t, withOAuth(0))
+	ctx := context.Background()
+
+	code, state := env.authorize(t)
+	result, err := env.confluence.CompleteOAuth(ctx, code, state)
+	if err != nil {
+		t.Fatalf("CompleteOAuth: %v", err)
+	}
+	if result.CloudID != confluencetest.CloudID {
+		t.Errorf("cloud ID = %q, want %q", result.CloudID, confluencetest.CloudID)
+	}
+
+	org, err := env.store.Organizations().GetByID(ctx, env.org.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if org.ConfluenceAuthMode != string(confluence.AuthOAuth) || org.ConfluenceEmail != "" ||
+		org.ConfluenceToken == "" || org.ConfluenceRefreshToken == "" || org.ConfluenceTokenExpiry.IsZero() {
+		t.Errorf("organization after connecting = %+v, want an OAuth grant in place of the API token", org)
+	}
+
+	// Calls now go through the gateway with the access token
+	if result := env.sync(t); result.Created != 5 {
+		t.Errorf("sync through the gateway = %+v, want 5 pages created", result)
+	}
+
+	// Codes are single use
+	if _, err := env.confluence.CompleteOAuth(ctx, code, state); !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("CompleteOAuth with a spent code = %v, want ErrInvalidInput", err)
+	}
+}
+
+func TestCompleteOAuthRejectsState(t *testing.T) {
+	env := newTestEnv(t, withOAuth(0))
+	ctx := context.Background()
+	code, state := env.authorize(t)
+
+	forged, _ := json.Marshal(oauthState{OrgID: env.org.ID, UserID: env.admin.ID, Expires: time.Now().Add(time.Hour)})
+	tampered := []byte(state)
+	tampered[len(tampered)/2] ^= 1
+
+	tests := []struct {
+		name, code, state string
+	}{
+		{"missing code", "", state},
+		{"missing state", code, ""},
+		{"unsealed state", code, string(forged)},
+		{"tampered state", code, string(tampered)},
+		{"unknown code", "code-bogus", state},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := env.confluence.CompleteOAuth(ctx, tt.code, tt.state); !errors.Is(err, ErrInvalidInput) {
+				t.Errorf("CompleteOAuth = %v, want ErrInvalidInput", err)
+			}
+		})
+	}
+
+	org, err := env.store.Organizations().GetByID(ctx, env.org.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if org.ConfluenceAuthMode == string(confluence.AuthOAuth) {
+		t.Error("a rejected callback connected the organization")
+	}
+}
+
+func TestCompleteOAuthExpiredState(t *testing.T) {
+	env := newTestEnv(t, withOAuth(0), func(cfg *config.Config, _ *confluencetest.Options) {
+		cfg.Confluence.OAuth.StateTTL = -time.Second
+	})
+	code, state := env.authorize(t)
+	if _, err := env.confluence.CompleteOAuth(context.Background(), code, state); !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("CompleteOAuth = %v, want ErrInvalidInput for an expired state", err)
+	}
+}
+
+func TestStartOAuthRequiresAdmin(t *testing.T) {
+	env := newTestEnv(t, withOAuth(0))
+	ctx := context.Background()
+
+	member := env.addUser(t, "ben@acme.example.com", "Ben Ortiz")
+	if _, err := env.confluence.StartOAuth(ctx, member, env.org.ID); !errors.Is(err, ErrForbidden) {
+		t.Errorf("StartOAuth by a member = %v, want ErrForbidden", err)
+	}
+	if _, err := env.confluence.StartOAuth(ctx, env.admin, "00000000-0000-4000-8000-999999999999"); !errors.Is(err, ErrForbidden) {
+		t.Errorf("StartOAuth for another org = %v, want ErrForbidden", err)
+	}
+}
+
+func TestOAuthRefresh(t *testing.T) {
+	// Tokens that last less than RefreshBefore are refreshed before every call
+	env := newTestEnv(t, withOAuth(time.Minute))
+	ctx := context.Background()
+
+	code, state := env.authorize(t)
+	if _, err := env.confluence.CompleteOAuth(ctx, code, state); err != nil {
+		t.Fatalf("CompleteOAuth: %v", err)
+	}
+	before, err := env.store.Organizations().GetByID(ctx, env.org.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result := env.sync(t); result.Created != 5 {
+		t.Errorf("sync = %+v, want 5 pages created", result)
+	}
+	after, err := env.store.Organizations().GetByID(ctx, env.org.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.ConfluenceToken == before.ConfluenceToken || after.ConfluenceRefreshToken == before.ConfluenceRefreshToken {
+		t.Error("the refreshed grant wasn't saved")
+	}
+	if !after.ConfluenceTokenExpiry.After(before.ConfluenceTokenExpiry) {
+		t.Errorf("token expiry = %v, want after %v", after.ConfluenceTokenExpiry, before.ConfluenceTokenExpiry)
+	}
+
+	// Once access is revoked the refresh fails and the org must reconnect
+	env.site.RevokeTokens()
+	_, err = env.workspaces.Sync(ctx, env.admin, env.ws.ID)
+	var oauthErr *confluence.OAuthError
+	if !errors.As(err, &oauthErr) {
+		t.Errorf("Sync after revoking = %v, want the OAuth error", err)
+	}
+}
@@ -0,0 +1,131 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/shaunpua/updoc/internal/doc"
+)
+
+// ConfluenceProvider serves confluence workspaces from their organization's
+// Confluence site. A workspace's space_key picks its space, the org's
+// configured space if unset. Cursors are result offsets, or Confluence's own
+// cursors where search pages by cursor.
+type ConfluenceProvider struct {
+	confluenceService *ConfluenceService
+}
+
+func NewConfluenceProvider(confluenceService *ConfluenceService) *ConfluenceProvider {
+	return &ConfluenceProvider{confluenceService: confluenceService}
+}
+
+func (p *ConfluenceProvider) Type() string { return "confluence" }
+
+func spaceKey(ws *doc.Workspace) string {
+	key, _ := ws.IntegrationConfig["space_key"].(string)
+	return key
+}
+
+func (p *ConfluenceProvider) TestConnection(ctx context.Context, ws *doc.Workspace) (*ConnectionTest, error) {
+	result, err := p.confluenceService.TestConnection(ctx, ws.OrgID)
+	if err != nil {
+		return nil, err
+	}
+	return &ConnectionTest{
+		Provider: p.Type(),
+		Success:  result.Success,
+		Message:  result.Message,
+		Details:  result.Details,
+		Warning:  result.Warning,
+	}, nil
+}
+
+func (p *ConfluenceProvider) ListDocuments(ctx context.Context, ws *doc.Workspace, cursor string, limit int) (*ProviderDocumentList, error) {
+	start, err := offset(cursor)
+	if err != nil {
+		return nil, err
+	}
+	list, err := p.confluenceService.ListSpacePages(ctx, ws.OrgID, spaceKey(ws), start, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ProviderDocumentList{Documents: make([]ProviderDocument, len(list.Pages))}
+	for i, page := range list.Pages {
+		result.Documents[i] = pageDocument(page)
+	}
+	if list.HasMore && len(list.Pages) > 0 {
+		result.NextCursor = strconv.Itoa(start + len(list.Pages))
+	}
+	return result, nil
+}
+
+func (p *ConfluenceProvider) SearchDocuments(ctx context.Context, ws *doc.Workspace, query, cursor string, limit int) (*ProviderDocumentList, error) {
+	req := ConfluenceSearchRequest{Query: query, Limit: limit}
+	if start, err := strconv.Atoi(cursor); err == nil {
+		req.Start = start
+	} else {
+		req.Cursor = cursor
+	}
+	found, err := p.confluenceService.Search(ctx, ws.OrgID, req, []string{spaceKey(ws)})
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ProviderDocumentList{Documents: make([]ProviderDocument, len(found.Results))}
+	for i, hit := range found.Results {
+		result.Documents[i] = pageDocument(hit.ConfluencePageInfo)
+		result.Documents[i].Version = hit.Version
+		result.Documents[i].EditedAt = hit.LastModified
+		result.Documents[i].EditedBy = hit.ModifiedBy
+	}
+	switch {
+	case found.NextCursor != "":
+		result.NextCursor = found.NextCursor
+	case found.HasMore && len(found.Results) > 0:
+		result.NextCursor = strconv.Itoa(found.Start + len(found.Results))
+	}
+	return result, nil
+}
+
+func (p *ConfluenceProvider) Document(ctx context.Context, ws *doc.Workspace, id string) (*ProviderDocument, error) {
+	page, version, err := p.confluenceService.Page(ctx, ws.OrgID, id)
+	if err != nil {
+		return nil, err
+	}
+	document := pageDocument(*page)
+	document.Version = version.Number
+	document.EditedAt = version.ModifiedAt
+	document.EditedBy = version.ModifiedBy
+	return &document, nil
+}
+
+// Content renders the page's storage format, or its view with representation
+// view
+func (p *ConfluenceProvider) Content(ctx context.Context, ws *doc.Workspace, id, representation string) (*ConfluencePageContent, error) {
+	return p.confluenceService.PageContent(ctx, ws.OrgID, id, 0, representation)
+}
+
+func pageDocument(page ConfluencePageInfo) ProviderDocument {
+	return ProviderDocument{
+		ID:        page.ID,
+		Title:     page.Title,
+		URL:       page.URL,
+		ParentID:  page.ParentID,
+		Ancestors: page.Ancestors,
+		Labels:    page.Labels,
+	}
+}
+
+// offset reads a cursor that is a result offset, "" being the start
+func offset(cursor string) (int, error) {
+	if cursor == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(cursor)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("cursor %q is not valid: %w", cursor, ErrInvalidInput)
+	}
+	return n, nil
+}
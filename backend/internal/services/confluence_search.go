@@ -0,0 +1,206 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/shaunpua/updoc/internal/confluence"
+	"github.com/shaunpua/updoc/pkg/api"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	defaultSearchLimit = 25
+	maxSearchLimit     = 100
+)
+
+// Search requests and results are API types
+type (
+	ConfluenceSearchRequest = api.ConfluenceSearchRequest
+	ConfluenceSearchHit     = api.ConfluenceSearchHit
+	ConfluenceSearchResult  = api.ConfluenceSearchResult
+)
+
+// Search runs a CQL search for pages in orgID's Confluence, within connected
+// or the one of them req names. connected are space keys; "" stands for the
+// org's configured space. With no connected spaces there is nothing to
+// search, rather than the whole site.
+func (s *ConfluenceService) Search(ctx context.Context, orgID string, req ConfluenceSearchRequest, connected []string) (_ *ConfluenceSearchResult, err error) {
+	ctx, span := tracer.Start(ctx, "ConfluenceService.Search", trace.WithAttributes(
+		attribute.String("updoc.org_id", orgID),
+		attribute.String("confluence.space_key", req.Space),
+		attribute.Int("confluence.start", req.Start),
+		attribute.Int("confluence.limit", req.Limit),
+	))
+	defer func() { finishSpan(span, err) }()
+
+	org, err := s.orgRepo.GetByID(ctx, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("organization %s: %w", orgID, ErrNotFound)
+	}
+	if !configured(org) {
+		return nil, fmt.Errorf("confluence integration not configured: %w", ErrInvalidInput)
+	}
+
+	var spaces []string
+	for _, key := range connected {
+		if key == "" {
+			key = org.ConfluenceSpaceKey
+		}
+		if key != "" && indexFold(spaces, key) < 0 {
+			spaces = append(spaces, key)
+		}
+	}
+	if len(spaces) == 0 {
+		return nil, fmt.Errorf("no Confluence space is connected to a workspace: %w", ErrInvalidInput)
+	}
+	if req.Space != "" {
+		i := indexFold(spaces, req.Space)
+		if i < 0 {
+			return nil, fmt.Errorf("space %s is not connected to a workspace: %w", req.Space, ErrInvalidInput)
+		}
+		spaces = []string{spaces[i]}
+	}
+
+	cql, err := searchCQL(req, spaces)
+	if err != nil {
+		return nil, err
+	}
+	span.SetAttributes(attribute.String("confluence.cql", cql))
+
+	if req.Limit <= 0 {
+		req.Limit = defaultSearchLimit
+	}
+	if req.Limit > maxSearchLimit {
+		req.Limit = maxSearchLimit
+	}
+	if req.Start < 0 {
+		req.Start = 0
+	}
+
+	site := s.site(org)
+	result, err := site.Search(ctx, confluence.SearchQuery{
+		CQL:    cql,
+		Cursor: req.Cursor,
+		Start:  req.Start,
+		Limit:  req.Limit,
+		Expand: []string{"space", "version"},
+	})
+	if err != nil {
+		var apiErr *confluence.APIError
+		if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusBadRequest {
+			return nil, fmt.Errorf("confluence rejected the search: %w: %w", ErrInvalidInput, err)
+		}
+		return nil, fmt.Errorf("failed to search pages: %w", unavailable(err))
+	}
+
+	hits := make([]ConfluenceSearchHit, len(result.Results))
+	for i, page := range result.Results {
+		hits[i] = ConfluenceSearchHit{ConfluencePageInfo: ConfluencePageInfo{
+			ID:    page.ID,
+			Title: page.Title,
+			URL:   site.WebURL(result.Links.Base, page.Links.WebUI),
+			Space: page.Space.Key,
+		}}
+		if v := page.Version; v != nil {
+			hits[i].Version = v.Number
+			if !v.When.IsZero() {
+				when := v.When
+				hits[i].LastModified = &when
+			}
+			hits[i].ModifiedBy = v.By.DisplayName
+		}
+	}
+
+	span.SetAttributes(attribute.Int("confluence.results", len(hits)))
+	return &ConfluenceSearchResult{
+		Results:    hits,
+		CQL:        cql,
+		Start:      result.Start,
+		Limit:      req.Limit,
+		HasMore:    result.HasMore(),
+		NextCursor: result.NextCursor(),
+		TotalSize:  result.TotalSize,
+	}, nil
+}
+
+// searchCQL turns a search request into CQL for pages in spaces
+func searchCQL(req ConfluenceSearchRequest, spaces []string) (string, error) {
+	clauses := []string{"type = page"}
+	filtered := false
+
+	if q := strings.TrimSpace(req.Query); q != "" {
+		clauses = append(clauses, "text ~ "+confluence.QuoteCQL(q))
+		filtered = true
+	}
+	switch len(spaces) {
+	case 0:
+	case 1:
+		clauses = append(clauses, "space = "+confluence.QuoteCQL(spaces[0]))
+	default:
+		clauses = append(clauses, "space IN ("+quoteCQLList(spaces)+")")
+	}
+	if req.Space != "" {
+		filtered = true
+	}
+
+	var labels []string
+	for _, label := range req.Labels {
+		if label = strings.TrimSpace(label); label != "" {
+			labels = append(labels, label)
+		}
+	}
+	if len(labels) > 0 {
+		clauses = append(clauses, "label IN ("+quoteCQLList(labels)+")")
+		filtered = true
+	}
+
+	for _, bound := range []struct {
+		param, value, op string
+	}{
+		{"modified_after", req.ModifiedAfter, ">="},
+		{"modified_before", req.ModifiedBefore, "<"},
+	} {
+		if bound.value == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", bound.value); err != nil {
+			return "", fmt.Errorf("%s must be a yyyy-mm-dd date: %w", bound.param, ErrInvalidInput)
+		}
+		clauses = append(clauses, "lastmodified "+bound.op+" "+confluence.QuoteCQL(bound.value))
+		filtered = true
+	}
+
+	if c := strings.TrimSpace(req.Contributor); c != "" {
+		clauses = append(clauses, "contributor = "+confluence.QuoteCQL(c))
+		filtered = true
+	}
+
+	if !filtered {
+		return "", fmt.Errorf("q or a filter (space, label, modified_after, modified_before, contributor) is required: %w", ErrInvalidInput)
+	}
+	return strings.Join(clauses, " AND "), nil
+}
+
+func quoteCQLList(values []string) string {
+	quoted := make([]string, len(values))
+	for i, v := range values {
+		quoted[i] = confluence.QuoteCQL(v)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// indexFold is the index of want in values ignoring case, or -1
+func indexFold(values []string, want string) int {
+	for i, v := range values {
+		if strings.EqualFold(v, want) {
+			return i
+		}
+	}
+	return -1
+}
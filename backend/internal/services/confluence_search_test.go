@@ -0,0 +1,91 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestSearchCQL(t *testing.T) {
+	tests := []struct {
+		name   string
+		req    ConfluenceSearchRequest
+		spaces []string
+		want   string
+		err    error
+	}{
+		{"query", ConfluenceSearchRequest{Query: " deploy "}, []string{"ENG"}, `type = page AND text ~ "deploy" AND space = "ENG"`, nil},
+		{"quotes and backslashes", ConfluenceSearchRequest{Query: `say "hi" C:\temp`}, []string{"ENG"}, `type = page AND text ~ "say \"hi\" C:\\temp" AND space = "ENG"`, nil},
+		{"injected clause", ConfluenceSearchRequest{Query: `x" OR space = "OPS`}, []string{"ENG"}, `type = page AND text ~ "x\" OR space = \"OPS" AND space = "ENG"`, nil},
+		{"injected escape", ConfluenceSearchRequest{Query: `x\" OR type = "blogpost`}, []string{"ENG"}, `type = page AND text ~ "x\\\" OR type = \"blogpost" AND space = "ENG"`, nil},
+		{"several spaces", ConfluenceSearchRequest{Query: "deploy"}, []string{"ENG", "OPS"}, `type = page AND text ~ "deploy" AND space IN ("ENG", "OPS")`, nil},
+		{"space alone is a filter", ConfluenceSearchRequest{Space: "ENG"}, []string{"ENG"}, `type = page AND space = "ENG"`, nil},
+		{"labels", ConfluenceSearchRequest{Labels: []string{" api ", "", `run"book`}}, []string{"ENG"}, `type = page AND space = "ENG" AND label IN ("api", "run\"book")`, nil},
+		{"dates", ConfluenceSearchRequest{ModifiedAfter: "2025-01-01", ModifiedBefore: "2025-02-01"}, []string{"ENG"},
+			`type = page AND space = "ENG" AND lastmodified >= "2025-01-01" AND lastmodified < "2025-02-01"`, nil},
+		{"contributor", ConfluenceSearchRequest{Contributor: `ben" OR creator != "x`}, []string{"ENG"}, `type = page AND space = "ENG" AND contributor = "ben\" OR creator != \"x"`, nil},
+		{"no filter", ConfluenceSearchRequest{Query: "  ", Labels: []string{" "}}, []string{"ENG"}, "", ErrInvalidInput},
+		{"date with time", ConfluenceSearchRequest{ModifiedAfter: "2025-01-01 10:00"}, []string{"ENG"}, "", ErrInvalidInput},
+		{"impossible date", ConfluenceSearchRequest{ModifiedBefore: "2025-02-30"}, []string{"ENG"}, "", ErrInvalidInput},
+		{"relative date", ConfluenceSearchRequest{ModifiedAfter: `now("-7d")`}, []string{"ENG"}, "", ErrInvalidInput},
+		{"injected date", ConfluenceSearchRequest{ModifiedAfter: `2025-01-01" OR space = "OPS`}, []string{"ENG"}, "", ErrInvalidInput},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := searchCQL(tt.req, tt.spaces)
+			if !errors.Is(err, tt.err) || got != tt.want {
+				t.Errorf("searchCQL = %q, %v, want %q, %v", got, err, tt.want, tt.err)
+			}
+		})
+	}
+}
+
+func TestSearchConfluence(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	search := func(req ConfluenceSearchRequest) ([]string, error) {
+		result, err := env.workspaces.SearchConfluence(ctx, env.admin, env.org.ID, req)
+		if err != nil {
+			return nil, err
+		}
+		var ids []string
+		for _, hit := range result.Results {
+			ids = append(ids, hit.ID)
+		}
+		slices.Sort(ids)
+		return ids, nil
+	}
+
+	tests := []struct {
+		name string
+		req  ConfluenceSearchRequest
+		want []string
+		err  error
+	}{
+		// OPS has a runbook too, but only ENG is connected
+		{"label", ConfluenceSearchRequest{Labels: []string{"runbook"}}, []string{"103"}, nil},
+		{"space named in another case", ConfluenceSearchRequest{Space: "eng", Labels: []string{"api"}}, []string{"102", "104"}, nil},
+		{"injected clause", ConfluenceSearchRequest{Query: `deploy" OR space = "OPS`}, nil, nil},
+		{"contributor and dates", ConfluenceSearchRequest{Contributor: "Ben Ortiz", ModifiedAfter: "2025-03-01", ModifiedBefore: "2025-04-01"}, []string{"102"}, nil},
+		{"unconnected space", ConfluenceSearchRequest{Space: "OPS", Query: "incident"}, nil, ErrInvalidInput},
+		{"invalid date", ConfluenceSearchRequest{ModifiedAfter: "01/02/2025"}, nil, ErrInvalidInput},
+		{"no filter", ConfluenceSearchRequest{}, nil, ErrInvalidInput},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := search(tt.req)
+			if !errors.Is(err, tt.err) || !slices.Equal(got, tt.want) {
+				t.Errorf("search = %v, %v, want %v, %v", got, err, tt.want, tt.err)
+			}
+		})
+	}
+
+	// Without a connected space nothing is searched, rather than the whole site
+	if _, err := env.confluence.Search(ctx, env.org.ID, ConfluenceSearchRequest{Query: "incident"}, nil); !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("Search with no connected spaces = %v, want ErrInvalidInput", err)
+	}
+	if _, err := env.confluence.Search(ctx, env.org.ID, ConfluenceSearchRequest{Space: "OPS", Query: "incident"}, nil); !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("Search of a space with no connected spaces = %v, want ErrInvalidInput", err)
+	}
+}
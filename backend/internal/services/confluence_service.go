@@ -2,142 +2,337 @@ package services
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
 
-	"github.com/go-resty/resty/v2"
+	"github.com/shaunpua/updoc/internal/confluence"
 	"github.com/shaunpua/updoc/internal/doc"
+	"github.com/shaunpua/updoc/internal/secret"
+	"github.com/shaunpua/updoc/pkg/api"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type ConfluenceService struct {
 	orgRepo doc.OrganizationRepository
+	client  *confluence.Client
+	// cipher seals the OAuth state parameter
+	cipher *secret.Cipher
+	// content caches rendered page bodies by version
+	content *contentCache
+	logger  *slog.Logger
 }
 
-func NewConfluenceService(orgRepo doc.OrganizationRepository) *ConfluenceService {
-	return &ConfluenceService{orgRepo: orgRepo}
+func NewConfluenceService(orgRepo doc.OrganizationRepository, client *confluence.Client, cipher *secret.Cipher, logger *slog.Logger) *ConfluenceService {
+	return &ConfluenceService{
+		orgRepo: orgRepo,
+		client:  client,
+		cipher:  cipher,
+		content: newContentCache(contentCacheBytes),
+		logger:  logger.With("component", "confluence"),
+	}
+}
+
+// site returns org's Confluence instance, keyed by slug so rate limiting,
+// circuit breaking and metrics are per organization
+func (s *ConfluenceService) site(org *doc.Organization) *confluence.Site {
+	creds := confluence.Credentials{
+		BaseURL:  org.ConfluenceBaseURL,
+		AuthMode: confluence.AuthMode(org.ConfluenceAuthMode),
+		Username: org.ConfluenceEmail,
+		Token:    org.ConfluenceToken,
+	}
+	if creds.AuthMode == confluence.AuthOAuth {
+		creds.CloudID = org.ConfluenceCloudID
+		creds.OAuth = &confluence.OAuthToken{
+			AccessToken:  org.ConfluenceToken,
+			RefreshToken: org.ConfluenceRefreshToken,
+			Expiry:       org.ConfluenceTokenExpiry,
+		}
+		creds.SaveToken = func(ctx context.Context, token *confluence.OAuthToken) error {
+			return s.orgRepo.SaveConfluenceToken(ctx, org.ID, token.AccessToken, token.RefreshToken, token.Expiry)
+		}
+	}
+	return s.client.Site(org.Slug, creds)
+}
+
+// configured reports whether org has everything its auth mode needs: a base
+// URL and token, plus a username unless it uses a personal access token, or
+// an OAuth grant and cloudid
+func configured(org *doc.Organization) bool {
+	if org.ConfluenceBaseURL == "" || org.ConfluenceToken == "" {
+		return false
+	}
+	mode := confluence.AuthMode(org.ConfluenceAuthMode)
+	if mode == "" {
+		mode = confluence.DefaultAuthMode(org.ConfluenceBaseURL, org.ConfluenceEmail)
+	}
+	if mode == confluence.AuthOAuth {
+		return org.ConfluenceCloudID != ""
+	}
+	return org.ConfluenceEmail != "" || !mode.NeedsUsername()
 }
 
-type ConfluenceTestResponse struct {
-	Success bool   `json:"success"`
-	Message string `json:"message"`
-	Details string `json:"details,omitempty"`
+// Degraded reports whether org's Confluence integration has been failing and
+// calls to it are being rejected until a trial call succeeds
+func (s *ConfluenceService) Degraded(org *doc.Organization) bool {
+	return s.client.Degraded(org.Slug)
 }
 
-// TestConnection tests the Confluence connection for an organization
-func (s *ConfluenceService) TestConnection(ctx context.Context, orgID string) (*ConfluenceTestResponse, error) {
-	org, err := s.orgRepo.GetByID(orgID)
+// unavailable wraps err with ErrUnavailable when Confluence itself is the
+// problem: the circuit breaker is open, or retries didn't get past a 429, a
+// 5xx or a transport failure
+func unavailable(err error) error {
+	var apiErr *confluence.APIError
+	var transportErr *confluence.TransportError
+	switch {
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, context.Canceled):
+		return err
+	case errors.Is(err, confluence.ErrCircuitOpen), errors.As(err, &transportErr):
+		return fmt.Errorf("%w: %w", ErrUnavailable, err)
+	case errors.As(err, &apiErr) && (apiErr.StatusCode == http.StatusTooManyRequests || apiErr.StatusCode >= 500):
+		return fmt.Errorf("%w: %w", ErrUnavailable, err)
+	}
+	return err
+}
+
+type (
+	ConfluenceTestResponse = api.ConfluenceTestResponse
+	ConfluencePageInfo     = api.ConfluencePageInfo
+)
+
+// TestOrgConnection is TestConnection for a member of the organization.
+// A failed connection is an error: ErrInvalidInput when Confluence rejects
+// the org's credentials, ErrUnavailable when it is down and ErrUpstream for
+// anything else it answers with.
+func (s *ConfluenceService) TestOrgConnection(ctx context.Context, user *doc.User, orgID string) (*ConfluenceTestResponse, error) {
+	if user.OrgID != orgID {
+		return nil, fmt.Errorf("organization %s: %w", orgID, ErrNotFound)
+	}
+	result, cause, err := s.testConnection(ctx, orgID)
 	if err != nil {
-		return nil, fmt.Errorf("organization not found: %w", err)
+		return nil, err
+	}
+	if cause != nil {
+		return nil, fmt.Errorf("%s: %w", result.Message, connectionError(cause))
+	}
+	return result, nil
+}
+
+// connectionError wraps a failed connection test's cause with the sentinel
+// for its status code
+func connectionError(err error) error {
+	var apiErr *confluence.APIError
+	var oauthErr *confluence.OAuthError
+	switch {
+	case errors.As(err, &apiErr) && apiErr.Unauthorized(), errors.As(err, &oauthErr):
+		return fmt.Errorf("%w: %w", ErrInvalidInput, err)
+	case errors.Is(unavailable(err), ErrUnavailable):
+		return unavailable(err)
+	}
+	return fmt.Errorf("%w: %w", ErrUpstream, err)
+}
+
+// TestConnection tests the Confluence connection for an organization and
+// detects whether it is Confluence Cloud or Data Center
+func (s *ConfluenceService) TestConnection(ctx context.Context, orgID string) (result *ConfluenceTestResponse, err error) {
+	ctx, span := tracer.Start(ctx, "ConfluenceService.TestConnection", trace.WithAttributes(attribute.String("updoc.org_id", orgID)))
+	defer func() {
+		if result != nil {
+			span.SetAttributes(
+				attribute.Bool("confluence.success", result.Success),
+				attribute.String("confluence.deployment", result.Deployment),
+			)
+		}
+		finishSpan(span, err)
+	}()
+
+	result, _, err = s.testConnection(ctx, orgID)
+	return result, err
+}
+
+// testConnection is TestConnection, also returning the cause of a failed test
+func (s *ConfluenceService) testConnection(ctx context.Context, orgID string) (result *ConfluenceTestResponse, cause, err error) {
+	org, err := s.orgRepo.GetByID(ctx, orgID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("organization %s: %w", orgID, ErrNotFound)
 	}
 
-	if org.ConfluenceBaseURL == "" || org.ConfluenceEmail == "" || org.ConfluenceToken == "" {
+	if !configured(org) {
 		return &ConfluenceTestResponse{
 			Success: false,
 			Message: "Confluence integration not configured",
-			Details: "Missing base URL, email, or token",
-		}, nil
+			Details: "Missing base URL, token, or the username its auth mode needs",
+		}, nil, nil
 	}
 
 	// Test connection by trying to get user info
-	client := resty.New()
-	resp, err := client.R().
-		SetBasicAuth(org.ConfluenceEmail, org.ConfluenceToken).
-		Get(org.ConfluenceBaseURL + "/rest/api/user/current")
+	site := s.site(org)
+	detection, err := site.Detect(ctx)
+	if ctx.Err() != nil {
+		return nil, nil, ctx.Err()
+	}
+	result = &ConfluenceTestResponse{
+		Deployment: string(detection.Deployment),
+		AuthMode:   string(site.AuthMode()),
+	}
+	if detection.Deployment != "" && detection.Deployment != site.AuthMode().Deployment() {
+		result.Warning = authModeHint(detection.Deployment, site.AuthMode())
+	}
 
-	if err != nil {
-		return &ConfluenceTestResponse{
-			Success: false,
-			Message: "Connection failed",
-			Details: err.Error(),
-		}, nil
+	var apiErr *confluence.APIError
+	var oauthErr *confluence.OAuthError
+	switch {
+	case err == nil:
+		result.Success = true
+		result.Message = "Connection successful"
+		product := "Confluence"
+		if detection.Deployment != "" {
+			product = detection.Deployment.Title()
+		}
+		result.Details = "Successfully authenticated with " + product
+	case errors.As(err, &apiErr) && apiErr.Unauthorized():
+		result.Message = "Authentication failed"
+		result.Details = err.Error()
+	case errors.As(err, &oauthErr):
+		result.Message = "Authentication failed"
+		result.Details = err.Error() + "; reconnect the organization through OAuth"
+	case errors.Is(err, confluence.ErrCircuitOpen):
+		result.Message = "Integration degraded"
+		result.Details = "Recent Confluence calls failed; they resume after a successful trial call"
+	default:
+		result.Message = "Connection failed"
+		result.Details = err.Error()
 	}
+	return result, err, nil
+}
 
-	if resp.StatusCode() != 200 {
-		return &ConfluenceTestResponse{
-			Success: false,
-			Message: "Authentication failed",
-			Details: fmt.Sprintf("HTTP %d: %s", resp.StatusCode(), resp.String()),
-		}, nil
+// authModeHint suggests the mode to use when mode doesn't suit the detected
+// deployment
+func authModeHint(detected confluence.Deployment, mode confluence.AuthMode) string {
+	if detected == confluence.DeploymentDataCenter {
+		return fmt.Sprintf("This looks like %s but confluence_auth_mode is %s; use %s with a personal access token, or %s with a username and password",
+			detected.Title(), mode, confluence.AuthDCBearer, confluence.AuthDCBasic)
 	}
+	return fmt.Sprintf("This looks like %s but confluence_auth_mode is %s; use %s with an account email and API token",
+		detected.Title(), mode, confluence.AuthCloudBasic)
+}
 
-	return &ConfluenceTestResponse{
-		Success: true,
-		Message: "Connection successful",
-		Details: "Successfully authenticated with Confluence",
-	}, nil
+// ConfluencePageList is one page of results from ListPages
+type ConfluencePageList struct {
+	Pages   []ConfluencePageInfo `json:"pages"`
+	Start   int                  `json:"start"`
+	Limit   int                  `json:"limit"`
+	HasMore bool                 `json:"has_more"`
 }
 
-type ConfluencePageInfo struct {
-	ID    string `json:"id"`
-	Title string `json:"title"`
-	URL   string `json:"url"`
-	Space string `json:"space"`
+// ListPages gets pages from the configured space of the user's organization,
+// starting at the given offset
+func (s *ConfluenceService) ListPages(ctx context.Context, user *doc.User, orgID string, start, limit int) (*ConfluencePageList, error) {
+	if user.OrgID != orgID {
+		return nil, fmt.Errorf("organization %s: %w", orgID, ErrNotFound)
+	}
+	return s.ListSpacePages(ctx, orgID, "", start, limit)
 }
 
-// ListPages gets pages from the configured space
-func (s *ConfluenceService) ListPages(ctx context.Context, orgID string, limit int) ([]ConfluencePageInfo, error) {
-	org, err := s.orgRepo.GetByID(orgID)
+// ListSpacePages is ListPages for an explicit space key; "" falls back to the org's configured space
+func (s *ConfluenceService) ListSpacePages(ctx context.Context, orgID, spaceKey string, start, limit int) (_ *ConfluencePageList, err error) {
+	ctx, span := tracer.Start(ctx, "ConfluenceService.ListSpacePages", trace.WithAttributes(
+		attribute.String("updoc.org_id", orgID),
+		attribute.String("confluence.space_key", spaceKey),
+		attribute.Int("confluence.start", start),
+		attribute.Int("confluence.limit", limit),
+	))
+	defer func() { finishSpan(span, err) }()
+
+	org, err := s.orgRepo.GetByID(ctx, orgID)
 	if err != nil {
 		return nil, fmt.Errorf("organization not found: %w", err)
 	}
 
-	if org.ConfluenceBaseURL == "" || org.ConfluenceEmail == "" || org.ConfluenceToken == "" {
+	if !configured(org) {
 		return nil, fmt.Errorf("confluence integration not configured")
 	}
 
+	if spaceKey == "" {
+		spaceKey = org.ConfluenceSpaceKey
+	}
+
 	if limit <= 0 {
 		limit = 10
 	}
-
-	client := resty.New()
-	
-	url := fmt.Sprintf("%s/rest/api/content", org.ConfluenceBaseURL)
-	req := client.R().SetBasicAuth(org.ConfluenceEmail, org.ConfluenceToken)
-	
-	if org.ConfluenceSpaceKey != "" {
-		req.SetQueryParam("spaceKey", org.ConfluenceSpaceKey)
+	if start < 0 {
+		start = 0
 	}
-	
-	resp, err := req.
-		SetQueryParam("limit", fmt.Sprintf("%d", limit)).
-		SetQueryParam("expand", "space").
-		Get(url)
 
+	site := s.site(org)
+	result, err := site.ListContent(ctx, confluence.ContentQuery{
+		SpaceKey: spaceKey,
+		Start:    start,
+		Limit:    limit,
+		Expand:   []string{"space", "metadata.labels", "ancestors"},
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch pages: %w", err)
+		return nil, fmt.Errorf("failed to fetch pages: %w", unavailable(err))
 	}
 
-	if resp.StatusCode() != 200 {
-		return nil, fmt.Errorf("confluence API error: HTTP %d", resp.StatusCode())
+	pages := make([]ConfluencePageInfo, len(result.Results))
+	for i, page := range result.Results {
+		pages[i] = ConfluencePageInfo{
+			ID:     page.ID,
+			Title:  page.Title,
+			URL:    site.WebURL(result.Links.Base, page.Links.WebUI),
+			Space:  page.Space.Key,
+			Labels: page.LabelNames(),
+		}
+		if ancestors := page.AncestorIDs(); len(ancestors) > 0 {
+			pages[i].Ancestors = ancestors
+			pages[i].ParentID = ancestors[len(ancestors)-1]
+		}
 	}
 
-	// Simple response parsing (you might want to use a proper struct)
-	var result struct {
-		Results []struct {
-			ID    string `json:"id"`
-			Title string `json:"title"`
-			Links struct {
-				WebUI string `json:"webui"`
-			} `json:"_links"`
-			Space struct {
-				Key string `json:"key"`
-			} `json:"space"`
-		} `json:"results"`
+	return &ConfluencePageList{
+		Pages:   pages,
+		Start:   start,
+		Limit:   limit,
+		HasMore: result.HasMore(),
+	}, nil
+}
+
+// ParseConfluencePageURL extracts the page ID and a best-effort title from a
+// Confluence page URL: Cloud's https://acme.atlassian.net/wiki/spaces/ENG/pages/123456/API+Docs,
+// or Data Center's https://confluence.acme.com/pages/viewpage.action?pageId=123456 and
+// https://confluence.acme.com/display/ENG/API+Docs, which has a title but no ID
+func ParseConfluencePageURL(rawURL string) (pageID, title string) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", ""
 	}
 
-	if err := json.Unmarshal(resp.Body(), &result); err != nil {
-		return nil, fmt.Errorf("failed to parse response: %w", err)
+	if id := u.Query().Get("pageId"); id != "" {
+		pageID = id
 	}
 
-	pages := make([]ConfluencePageInfo, len(result.Results))
-	for i, page := range result.Results {
-		pages[i] = ConfluencePageInfo{
-			ID:    page.ID,
-			Title: page.Title,
-			URL:   org.ConfluenceBaseURL + page.Links.WebUI,
-			Space: page.Space.Key,
+	segments := strings.Split(strings.Trim(u.Path, "/"), "/")
+	for i, seg := range segments {
+		if i+1 >= len(segments) {
+			break
+		}
+		switch {
+		case seg == "pages" && !strings.HasSuffix(segments[i+1], ".action"):
+			pageID = segments[i+1]
+			if i+2 < len(segments) {
+				title, _ = url.QueryUnescape(segments[i+2])
+			}
+			return pageID, title
+		case seg == "display" && i+2 < len(segments):
+			title, _ = url.QueryUnescape(segments[i+2])
+			return pageID, title
 		}
 	}
-
-	return pages, nil
+	return pageID, title
 }
@@ -0,0 +1,591 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/shaunpua/updoc/internal/doc"
+	"github.com/shaunpua/updoc/pkg/api"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Confluence webhook events handled by ConfluenceWebhookService
+const (
+	WebhookPageCreated  = "page_created"
+	WebhookPageUpdated  = "page_updated"
+	WebhookPageRemoved  = "page_removed"
+	WebhookPageMoved    = "page_moved"
+	WebhookPageRestored = "page_restored"
+	WebhookLabelAdded   = "label_added"
+	WebhookLabelRemoved = "label_removed"
+)
+
+// ConfluenceWebhookEvents are the events to subscribe a Confluence webhook to
+var ConfluenceWebhookEvents = []string{
+	WebhookPageCreated, WebhookPageUpdated, WebhookPageRemoved, WebhookPageMoved, WebhookPageRestored,
+	WebhookLabelAdded, WebhookLabelRemoved,
+}
+
+// Outcomes of a webhook delivery
+const (
+	WebhookCreated   = "created"
+	WebhookUpdated   = "updated"
+	WebhookRemoved   = "removed"
+	WebhookIgnored   = "ignored"
+	WebhookDuplicate = "duplicate"
+)
+
+// webhookSecretKey is where a workspace's webhook secret is kept in its
+// integration config
+const webhookSecretKey = "webhook_secret"
+
+const (
+	// jwtLeeway allows for clock skew when checking a webhook JWT's expiry
+	jwtLeeway = time.Minute
+	// jwtMaxLifetime bounds how far ahead of now, or of its iat, a webhook
+	// JWT may expire, so a leaked token is only briefly useful
+	jwtMaxLifetime = 5 * time.Minute
+	// maxEventIDs bounds the delivery IDs remembered for one timestamp
+	maxEventIDs = 20
+)
+
+// ConfluenceWebhookDelivery is one webhook request as received
+type ConfluenceWebhookDelivery struct {
+	// Event is the X-Event-Key header; the payload's event is used if empty
+	Event string
+	// Signature is the X-Hub-Signature header, "sha256=<hex HMAC of Body>"
+	Signature string
+	// Authorization is the Authorization header, "JWT <token>" or
+	// "Bearer <token>", checked when there is no signature. The token must
+	// expire and carry the hex SHA-256 of Body as its body_sha256 claim.
+	Authorization string
+	// ID is the X-Atlassian-Webhook-Identifier header, the same for every
+	// attempt to deliver an event; the SHA-256 of Body is used if empty
+	ID   string
+	Body []byte
+}
+
+// ConfluenceWebhookResult reports what a delivery changed
+type ConfluenceWebhookResult struct {
+	Event      string `json:"event"`
+	PageID     string `json:"page_id,omitempty"`
+	DocumentID string `json:"document_id,omitempty"`
+	// Outcome is created, updated, removed, ignored or duplicate
+	Outcome string `json:"outcome"`
+	// Reason explains an ignored or duplicate delivery
+	Reason string `json:"reason,omitempty"`
+	// FlagsAwaitingVerification counts flags moved to awaiting verification
+	// by a page edit
+	FlagsAwaitingVerification int `json:"flags_awaiting_verification,omitempty"`
+	// OpenFlags counts the open flags on a removed page whose people were told
+	OpenFlags int `json:"open_flags,omitempty"`
+	// FlagsOpened and FlagsResolved count flags opened and resolved by the
+	// workspace's label rules
+	FlagsOpened   int `json:"flags_opened,omitempty"`
+	FlagsResolved int `json:"flags_resolved,omitempty"`
+}
+
+// ConfluenceWebhookSetup is what to register with Confluence to send a
+// workspace's page events to UpDoc
+type ConfluenceWebhookSetup = api.ConfluenceWebhookSetup
+
+// webhookPayload is the body Confluence sends for page events
+type webhookPayload struct {
+	Event         string `json:"event"`
+	Timestamp     int64  `json:"timestamp"`
+	UserAccountID string `json:"userAccountId"`
+	Page          struct {
+		ID               json.Number `json:"id"`
+		Title            string      `json:"title"`
+		SpaceKey         string      `json:"spaceKey"`
+		Version          int         `json:"version"`
+		Self             string      `json:"self"`
+		ModificationDate int64       `json:"modificationDate"`
+	} `json:"page"`
+	// Label is set for label events
+	Label struct {
+		Name string `json:"name"`
+	} `json:"label"`
+}
+
+// ConfluenceWebhookService applies Confluence page events to a workspace's
+// documents as they happen, instead of waiting for a sync or the page watcher
+type ConfluenceWebhookService struct {
+	orgRepo       doc.OrganizationRepository
+	workspaceRepo doc.WorkspaceRepository
+	documentRepo  doc.DocumentRepository
+	flagService   *FlagService
+	logger        *slog.Logger
+}
+
+func NewConfluenceWebhookService(orgRepo doc.OrganizationRepository, workspaceRepo doc.WorkspaceRepository, documentRepo doc.DocumentRepository, flagService *FlagService, logger *slog.Logger) *ConfluenceWebhookService {
+	return &ConfluenceWebhookService{
+		orgRepo:       orgRepo,
+		workspaceRepo: workspaceRepo,
+		documentRepo:  documentRepo,
+		flagService:   flagService,
+		logger:        logger,
+	}
+}
+
+// EnableWebhook gives the workspace a new webhook secret, replacing any
+// earlier one, and returns what to register with Confluence. Only org admins
+// may enable webhooks.
+func (s *WorkspaceService) EnableWebhook(ctx context.Context, user *doc.User, id string) (*ConfluenceWebhookSetup, error) {
+	ws, err := s.Get(ctx, user, id)
+	if err != nil {
+		return nil, err
+	}
+	if user.Role != "admin" {
+		return nil, fmt.Errorf("only admins can enable webhooks: %w", ErrForbidden)
+	}
+	if ws.IntegrationType != "confluence" {
+		return nil, fmt.Errorf("webhooks are not supported for %q workspaces: %w", ws.IntegrationType, ErrInvalidInput)
+	}
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, fmt.Errorf("failed to generate webhook secret: %w", err)
+	}
+	secret := hex.EncodeToString(raw)
+
+	config := make(map[string]interface{}, len(ws.IntegrationConfig)+1)
+	for k, v := range ws.IntegrationConfig {
+		config[k] = v
+	}
+	config[webhookSecretKey] = secret
+	if err := s.workspaceRepo.UpdateIntegration(ctx, ws.ID, config); err != nil {
+		return nil, fmt.Errorf("failed to save webhook secret: %w", err)
+	}
+	s.logger.InfoContext(ctx, "workspace webhook enabled", "workspace_id", ws.ID, "user_id", user.ID)
+
+	return &ConfluenceWebhookSetup{
+		WorkspaceID: ws.ID,
+		Path:        "/webhooks/confluence/" + ws.ID,
+		Secret:      secret,
+		Events:      ConfluenceWebhookEvents,
+	}, nil
+}
+
+// redactedConfigKeys are the integration config keys holding secrets, each
+// with the key set to true in its place when a workspace is returned
+var redactedConfigKeys = map[string]string{
+	webhookSecretKey: "webhook_enabled",
+	notionTokenKey:   "notion_token_set",
+}
+
+// RedactWorkspace returns ws without its secrets: the webhook secret, which
+// is only shown once when the webhook is enabled, and integration tokens
+func RedactWorkspace(ws *doc.Workspace) *doc.Workspace {
+	var redacted *doc.Workspace
+	for key, flag := range redactedConfigKeys {
+		if _, ok := ws.IntegrationConfig[key]; !ok {
+			continue
+		}
+		if redacted == nil {
+			copied := *ws
+			copied.IntegrationConfig = make(map[string]interface{}, len(ws.IntegrationConfig))
+			for k, v := range ws.IntegrationConfig {
+				copied.IntegrationConfig[k] = v
+			}
+			redacted = &copied
+		}
+		delete(redacted.IntegrationConfig, key)
+		redacted.IntegrationConfig[flag] = true
+	}
+	if redacted == nil {
+		return ws
+	}
+	return redacted
+}
+
+// Handle verifies and applies a webhook delivery for a workspace. Created,
+// updated, restored and moved pages are upserted as documents by page ID;
+// edits feed FlagService.PageEdited, and removed pages, or pages moved out
+// of the workspace's space, are marked removed and their open flags' people
+// told. Label events update the document's labels and apply the workspace's
+// label rules, adding pages a rule tracks. Events for other spaces, or
+// without a space, are ignored, as are redeliveries, told apart by delivery
+// ID, and events older than the last one applied to the document, so
+// Confluence can retry safely. Payloads without a timestamp are refused.
+func (s *ConfluenceWebhookService) Handle(ctx context.Context, workspaceID string, delivery ConfluenceWebhookDelivery) (_ *ConfluenceWebhookResult, err error) {
+	ctx, span := tracer.Start(ctx, "ConfluenceWebhookService.Handle", trace.WithAttributes(
+		attribute.String("updoc.workspace_id", workspaceID),
+		attribute.String("confluence.webhook_event", delivery.Event),
+	))
+	defer func() { finishSpan(span, err) }()
+
+	ws, err := s.workspaceRepo.GetByID(ctx, workspaceID)
+	if err != nil || ws.IntegrationType != "confluence" {
+		return nil, fmt.Errorf("workspace %s: %w", workspaceID, ErrNotFound)
+	}
+	secret, _ := ws.IntegrationConfig[webhookSecretKey].(string)
+	if secret == "" {
+		return nil, fmt.Errorf("webhooks are not enabled for workspace %s: %w", workspaceID, ErrNotFound)
+	}
+	if err := verifyWebhook(delivery, secret, time.Now()); err != nil {
+		return nil, err
+	}
+
+	var payload webhookPayload
+	if err := json.Unmarshal(delivery.Body, &payload); err != nil {
+		return nil, fmt.Errorf("invalid webhook payload: %v: %w", err, ErrInvalidInput)
+	}
+	// Events are ordered by their timestamp, so one without can't be placed
+	if payload.Timestamp <= 0 {
+		return nil, fmt.Errorf("webhook payload has no timestamp: %w", ErrInvalidInput)
+	}
+	at := time.UnixMilli(payload.Timestamp)
+	deliveryID := delivery.ID
+	if deliveryID == "" {
+		sum := sha256.Sum256(delivery.Body)
+		deliveryID = hex.EncodeToString(sum[:])
+	}
+	event := delivery.Event
+	if event == "" {
+		event = payload.Event
+	}
+	pageID := payload.Page.ID.String()
+	result := &ConfluenceWebhookResult{Event: event, PageID: pageID, Outcome: WebhookIgnored}
+	span.SetAttributes(attribute.String("confluence.webhook_event", event), attribute.String("confluence.page_id", pageID))
+
+	switch event {
+	case WebhookPageCreated, WebhookPageUpdated, WebhookPageRemoved, WebhookPageMoved, WebhookPageRestored,
+		WebhookLabelAdded, WebhookLabelRemoved:
+	default:
+		result.Reason = "event is not handled"
+		return result, nil
+	}
+	if pageID == "" {
+		return nil, fmt.Errorf("webhook payload has no page ID: %w", ErrInvalidInput)
+	}
+
+	spaceKey, _ := ws.IntegrationConfig["space_key"].(string)
+	if spaceKey == "" {
+		// A workspace without a space key syncs the org's configured space
+		org, err := s.orgRepo.GetByID(ctx, ws.OrgID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load organization: %w", err)
+		}
+		spaceKey = org.ConfluenceSpaceKey
+	}
+	// A page whose space can't be told isn't assumed to be in the workspace's
+	inSpace := payload.Page.SpaceKey != "" && strings.EqualFold(payload.Page.SpaceKey, spaceKey)
+
+	document, err := s.findDocument(ctx, ws.ID, pageID, payload.Page.Self)
+	if err != nil {
+		return nil, err
+	}
+	if document != nil {
+		result.DocumentID = document.ID
+	}
+
+	if document != nil && document.LastEventAt != nil {
+		switch {
+		case at.Before(*document.LastEventAt):
+			result.Outcome = WebhookDuplicate
+			result.Reason = "a newer event was already applied"
+			return result, nil
+		case at.Equal(*document.LastEventAt) && slices.Contains(document.LastEventIDs, deliveryID):
+			result.Outcome = WebhookDuplicate
+			result.Reason = "the event was already applied"
+			return result, nil
+		}
+	}
+	applied := webhookEvent{at: at, id: deliveryID}
+
+	removed := event == WebhookPageRemoved || (event == WebhookPageMoved && !inSpace)
+	switch {
+	case removed:
+		if document == nil {
+			result.Reason = "page is not tracked"
+			return result, nil
+		}
+		if err := s.markRemoved(ctx, document, applied, result); err != nil {
+			return nil, err
+		}
+	case !inSpace:
+		result.Reason = fmt.Sprintf("space %s is not connected to the workspace", payload.Page.SpaceKey)
+		if payload.Page.SpaceKey == "" {
+			result.Reason = "payload has no space key"
+		}
+		return result, nil
+	case event == WebhookLabelAdded || event == WebhookLabelRemoved:
+		if payload.Label.Name == "" {
+			return nil, fmt.Errorf("label webhook payload has no label: %w", ErrInvalidInput)
+		}
+		if err := s.relabel(ctx, ws, document, pageID, &payload, event == WebhookLabelAdded, applied, result); err != nil {
+			return nil, err
+		}
+		if result.Outcome == WebhookIgnored {
+			return result, nil
+		}
+	default:
+		if document == nil && payload.Page.Self == "" {
+			result.Reason = "page is not tracked and the payload has no URL"
+			return result, nil
+		}
+		// Page events carry no labels; a page a track rule picks up is added
+		// by the label event or the next sync
+		if document == nil && !tracksPage(labelRules(ws), nil) {
+			result.Reason = "page is not tracked and no label rule tracks it yet"
+			return result, nil
+		}
+		if document, err = s.upsert(ctx, ws.ID, document, pageID, &payload, applied, result); err != nil {
+			return nil, err
+		}
+
+		if (event == WebhookPageUpdated || event == WebhookPageRestored) && payload.Page.Version > 0 {
+			version := &ConfluencePageVersion{Number: payload.Page.Version, ModifiedBy: payload.UserAccountID}
+			if payload.Page.ModificationDate > 0 {
+				modified := time.UnixMilli(payload.Page.ModificationDate)
+				version.ModifiedAt = &modified
+			}
+			n, err := s.flagService.PageEdited(ctx, document, version)
+			if err != nil {
+				return nil, err
+			}
+			result.FlagsAwaitingVerification = n
+		}
+	}
+
+	s.logger.InfoContext(ctx, "confluence webhook applied",
+		"workspace_id", ws.ID, "event", event, "page_id", pageID, "document_id", result.DocumentID,
+		"outcome", result.Outcome, "flags_awaiting_verification", result.FlagsAwaitingVerification,
+		"flags_opened", result.FlagsOpened, "flags_resolved", result.FlagsResolved)
+	return result, nil
+}
+
+// findDocument returns the workspace's document for a page, matching by page
+// ID and then by URL for documents flagged before a sync resolved their ID.
+// It returns nil if the page isn't tracked in the workspace.
+func (s *ConfluenceWebhookService) findDocument(ctx context.Context, workspaceID, pageID, url string) (*doc.Document, error) {
+	docs, err := s.documentRepo.GetByExternalIDs(ctx, []string{workspaceID}, []string{pageID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up document: %w", err)
+	}
+	if len(docs) > 0 {
+		return docs[0], nil
+	}
+	if url == "" {
+		return nil, nil
+	}
+	if d, err := s.documentRepo.GetByURL(ctx, []string{workspaceID}, url); err == nil && d.ExternalID == "" {
+		return d, nil
+	}
+	return nil, nil
+}
+
+// webhookEvent identifies a delivery applied to a document: its timestamp,
+// which orders events, and its delivery ID, which tells a redelivery from
+// another event with the same timestamp
+type webhookEvent struct {
+	at time.Time
+	id string
+}
+
+// record marks e as the latest event applied to document
+func (e webhookEvent) record(document *doc.Document) {
+	if document.LastEventAt == nil || !e.at.Equal(*document.LastEventAt) {
+		document.LastEventIDs = nil
+	}
+	at := e.at
+	document.LastEventAt = &at
+	if len(document.LastEventIDs) < maxEventIDs {
+		document.LastEventIDs = append(document.LastEventIDs, e.id)
+	}
+}
+
+func (s *ConfluenceWebhookService) upsert(ctx context.Context, workspaceID string, document *doc.Document, pageID string, payload *webhookPayload, event webhookEvent, result *ConfluenceWebhookResult) (*doc.Document, error) {
+	now := time.Now()
+	if document == nil {
+		document = &doc.Document{
+			WorkspaceID: workspaceID,
+			Title:       payload.Page.Title,
+			URL:         payload.Page.Self,
+			ExternalID:  pageID,
+			LastChecked: now,
+		}
+		event.record(document)
+		if err := s.documentRepo.Create(ctx, document); err != nil {
+			return nil, fmt.Errorf("failed to create document: %w", err)
+		}
+		result.DocumentID = document.ID
+		result.Outcome = WebhookCreated
+		return document, nil
+	}
+
+	if payload.Page.Title != "" {
+		document.Title = payload.Page.Title
+	}
+	if payload.Page.Self != "" {
+		document.URL = payload.Page.Self
+	}
+	document.ExternalID = pageID
+	document.RemovedAt = nil
+	document.LastChecked = now
+	event.record(document)
+	if err := s.documentRepo.Update(ctx, document); err != nil {
+		return nil, fmt.Errorf("failed to update document %s: %w", document.ID, err)
+	}
+	result.Outcome = WebhookUpdated
+	return document, nil
+}
+
+// relabel adds the event's label to, or removes it from, the document's
+// labels and applies the workspace's label rules. An untracked page is added
+// as a document when a rule names the label added to it.
+func (s *ConfluenceWebhookService) relabel(ctx context.Context, ws *doc.Workspace, document *doc.Document, pageID string, payload *webhookPayload, added bool, event webhookEvent, result *ConfluenceWebhookResult) error {
+	label := strings.ToLower(payload.Label.Name)
+	if document == nil {
+		named := slices.ContainsFunc(labelRules(ws), func(rule LabelRule) bool { return rule.Label == label })
+		if !added || !named || payload.Page.Self == "" {
+			result.Reason = "page is not tracked"
+			return nil
+		}
+	}
+
+	var before []string
+	if document != nil {
+		before = document.Labels
+	}
+	document, err := s.upsert(ctx, ws.ID, document, pageID, payload, event, result)
+	if err != nil {
+		return err
+	}
+	labels := slices.DeleteFunc(slices.Clone(before), func(l string) bool { return l == label })
+	if added {
+		labels = append(labels, label)
+	}
+	document.Labels = labels
+	if err := s.documentRepo.Update(ctx, document); err != nil {
+		return fmt.Errorf("failed to update document %s: %w", document.ID, err)
+	}
+
+	opened, resolved, err := s.flagService.workspaceService.applyLabelRules(ctx, ws, document, before)
+	result.FlagsOpened, result.FlagsResolved = opened, resolved
+	if err != nil {
+		return fmt.Errorf("failed to apply label rules to document %s: %w", document.ID, err)
+	}
+	return nil
+}
+
+func (s *ConfluenceWebhookService) markRemoved(ctx context.Context, document *doc.Document, event webhookEvent, result *ConfluenceWebhookResult) error {
+	alreadyRemoved := document.RemovedAt != nil
+	at := event.at
+	document.RemovedAt = &at
+	event.record(document)
+	if err := s.documentRepo.Update(ctx, document); err != nil {
+		return fmt.Errorf("failed to update document %s: %w", document.ID, err)
+	}
+	result.Outcome = WebhookRemoved
+	if alreadyRemoved {
+		return nil
+	}
+
+	n, err := s.flagService.PageRemoved(ctx, document)
+	if err != nil {
+		return err
+	}
+	result.OpenFlags = n
+	return nil
+}
+
+// verifyWebhook checks a delivery's X-Hub-Signature HMAC or, without one,
+// its HS256 JWT, against the workspace's secret
+func verifyWebhook(delivery ConfluenceWebhookDelivery, secret string, now time.Time) error {
+	if delivery.Signature != "" {
+		sig, ok := strings.CutPrefix(delivery.Signature, "sha256=")
+		got, err := hex.DecodeString(sig)
+		if !ok || err != nil {
+			return fmt.Errorf("malformed webhook signature: %w", ErrUnauthorized)
+		}
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(delivery.Body)
+		if !hmac.Equal(got, mac.Sum(nil)) {
+			return fmt.Errorf("webhook signature does not match: %w", ErrUnauthorized)
+		}
+		return nil
+	}
+
+	scheme, token, _ := strings.Cut(delivery.Authorization, " ")
+	if token == "" || (!strings.EqualFold(scheme, "JWT") && !strings.EqualFold(scheme, "Bearer")) {
+		return fmt.Errorf("webhook signature or JWT required: %w", ErrUnauthorized)
+	}
+	return verifyJWT(strings.TrimSpace(token), secret, delivery.Body, now)
+}
+
+// verifyJWT checks an HS256 JWT's signature, its exp and, if present, nbf
+// and iat claims, and that its body_sha256 claim is the hash of body. A
+// token must expire within jwtMaxLifetime, so one taken from a delivery
+// can't be replayed for long, nor with another body.
+func verifyJWT(token, secret string, body []byte, now time.Time) error {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return fmt.Errorf("malformed webhook JWT: %w", ErrUnauthorized)
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := decodeJWTPart(parts[0], &header); err != nil || header.Alg != "HS256" {
+		return fmt.Errorf("webhook JWT must be signed with HS256: %w", ErrUnauthorized)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return fmt.Errorf("malformed webhook JWT: %w", ErrUnauthorized)
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	if !hmac.Equal(sig, mac.Sum(nil)) {
+		return fmt.Errorf("webhook JWT signature does not match: %w", ErrUnauthorized)
+	}
+
+	var claims struct {
+		Exp        int64  `json:"exp"`
+		Nbf        int64  `json:"nbf"`
+		Iat        int64  `json:"iat"`
+		BodySHA256 string `json:"body_sha256"`
+	}
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return fmt.Errorf("malformed webhook JWT claims: %w", ErrUnauthorized)
+	}
+	if claims.Exp <= 0 {
+		return fmt.Errorf("webhook JWT has no expiry: %w", ErrUnauthorized)
+	}
+	exp := time.Unix(claims.Exp, 0)
+	if now.After(exp.Add(jwtLeeway)) {
+		return fmt.Errorf("webhook JWT has expired: %w", ErrUnauthorized)
+	}
+	if exp.After(now.Add(jwtMaxLifetime+jwtLeeway)) ||
+		(claims.Iat > 0 && exp.Sub(time.Unix(claims.Iat, 0)) > jwtMaxLifetime) {
+		return fmt.Errorf("webhook JWT must expire within %s: %w", jwtMaxLifetime, ErrUnauthorized)
+	}
+	if claims.Nbf > 0 && now.Add(jwtLeeway).Before(time.Unix(claims.Nbf, 0)) {
+		return fmt.Errorf("webhook JWT is not valid yet: %w", ErrUnauthorized)
+	}
+	sum := sha256.Sum256(body)
+	if !hmac.Equal([]byte(strings.ToLower(claims.BodySHA256)), []byte(hex.EncodeToString(sum[:]))) {
+		return fmt.Errorf("webhook JWT body_sha256 does not match the body: %w", ErrUnauthorized)
+	}
+	return nil
+}
+
+func decodeJWTPart(part string, v interface{}) error {
+	raw, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, v)
+}
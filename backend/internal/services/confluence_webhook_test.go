@@ -0,0 +1,86 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/shaunpua/updoc/internal/doc"
+)
+
+func signJWT(t *testing.T, secret string, claims map[string]interface{}) string {
+	t.Helper()
+	header, _ := json.Marshal(map[string]string{"alg": "HS256", "typ": "JWT"})
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(unsigned))
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestVerifyJWT(t *testing.T) {
+	const secret = "s3cret"
+	now := time.Unix(1_700_000_000, 0)
+	body := []byte(`{"event":"page_updated","timestamp":1700000000000}`)
+	sum := sha256.Sum256(body)
+	bodyHash := hex.EncodeToString(sum[:])
+
+	tests := []struct {
+		name   string
+		claims map[string]interface{}
+		secret string
+		body   []byte
+		ok     bool
+	}{
+		{"valid", map[string]interface{}{"exp": now.Add(time.Minute).Unix(), "body_sha256": bodyHash}, secret, body, true},
+		{"valid with iat", map[string]interface{}{"iat": now.Unix(), "exp": now.Add(jwtMaxLifetime).Unix(), "body_sha256": bodyHash}, secret, body, true},
+		{"no exp", map[string]interface{}{"body_sha256": bodyHash}, secret, body, false},
+		{"expired", map[string]interface{}{"exp": now.Add(-jwtLeeway - time.Second).Unix(), "body_sha256": bodyHash}, secret, body, false},
+		{"expires too late", map[string]interface{}{"exp": now.Add(time.Hour).Unix(), "body_sha256": bodyHash}, secret, body, false},
+		{"lifetime too long", map[string]interface{}{"iat": now.Add(-time.Hour).Unix(), "exp": now.Add(time.Minute).Unix(), "body_sha256": bodyHash}, secret, body, false},
+		{"not valid yet", map[string]interface{}{"nbf": now.Add(2 * jwtLeeway).Unix(), "exp": now.Add(jwtMaxLifetime).Unix(), "body_sha256": bodyHash}, secret, body, false},
+		{"no body hash", map[string]interface{}{"exp": now.Add(time.Minute).Unix()}, secret, body, false},
+		{"other body", map[string]interface{}{"exp": now.Add(time.Minute).Unix(), "body_sha256": bodyHash}, secret, []byte(`{"event":"page_removed"}`), false},
+		{"wrong secret", map[string]interface{}{"exp": now.Add(time.Minute).Unix(), "body_sha256": bodyHash}, "other", body, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := signJWT(t, tt.secret, tt.claims)
+			err := verifyJWT(token, secret, tt.body, now)
+			if tt.ok && err != nil {
+				t.Fatalf("verifyJWT: %v", err)
+			}
+			if !tt.ok && !errors.Is(err, ErrUnauthorized) {
+				t.Fatalf("verifyJWT = %v, want ErrUnauthorized", err)
+			}
+		})
+	}
+}
+
+func TestWebhookEventRecord(t *testing.T) {
+	at := time.UnixMilli(1_700_000_000_000)
+	document := &doc.Document{}
+
+	webhookEvent{at: at, id: "a"}.record(document)
+	webhookEvent{at: at, id: "b"}.record(document)
+	if got := document.LastEventIDs; len(got) != 2 || got[0] != "a" || got[1] != "b" {
+		t.Fatalf("LastEventIDs = %v, want [a b]", got)
+	}
+
+	later := at.Add(time.Millisecond)
+	webhookEvent{at: later, id: "c"}.record(document)
+	if !document.LastEventAt.Equal(later) {
+		t.Fatalf("LastEventAt = %v, want %v", document.LastEventAt, later)
+	}
+	if got := document.LastEventIDs; len(got) != 1 || got[0] != "c" {
+		t.Fatalf("LastEventIDs = %v, want [c]", got)
+	}
+}
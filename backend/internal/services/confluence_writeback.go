@@ -0,0 +1,150 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/shaunpua/updoc/internal/confluence"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// AddPageComment adds a footer comment, in the storage format, to a page and
+// returns the comment's ID
+func (s *ConfluenceService) AddPageComment(ctx context.Context, orgID, pageID, body string) (_ string, err error) {
+	ctx, span := tracer.Start(ctx, "ConfluenceService.AddPageComment", trace.WithAttributes(
+		attribute.String("updoc.org_id", orgID),
+		attribute.String("confluence.page_id", pageID),
+	))
+	defer func() { finishSpan(span, err) }()
+
+	site, err := s.orgSite(ctx, orgID)
+	if err != nil {
+		return "", err
+	}
+	comment, err := site.CreateComment(ctx, pageID, body)
+	if err != nil {
+		return "", writeFailure("page", pageID, err)
+	}
+	return comment.ID, nil
+}
+
+// UpdatePageComment replaces a comment's body. It fails with ErrNotFound if
+// the comment was deleted on Confluence.
+func (s *ConfluenceService) UpdatePageComment(ctx context.Context, orgID, commentID, body string) (err error) {
+	ctx, span := tracer.Start(ctx, "ConfluenceService.UpdatePageComment", trace.WithAttributes(
+		attribute.String("updoc.org_id", orgID),
+		attribute.String("confluence.comment_id", commentID),
+	))
+	defer func() { finishSpan(span, err) }()
+
+	site, err := s.orgSite(ctx, orgID)
+	if err != nil {
+		return err
+	}
+	current, err := site.GetContent(ctx, commentID, confluence.ContentGetQuery{Expand: []string{"version"}})
+	if err != nil {
+		return writeFailure("comment", commentID, err)
+	}
+	if current.Version == nil {
+		return fmt.Errorf("confluence returned no version for comment %s", commentID)
+	}
+	if _, err := site.UpdateComment(ctx, commentID, current.Version.Number+1, body); err != nil {
+		return writeFailure("comment", commentID, err)
+	}
+	return nil
+}
+
+// DeletePageComment deletes a comment; one already gone is not an error
+func (s *ConfluenceService) DeletePageComment(ctx context.Context, orgID, commentID string) (err error) {
+	ctx, span := tracer.Start(ctx, "ConfluenceService.DeletePageComment", trace.WithAttributes(
+		attribute.String("updoc.org_id", orgID),
+		attribute.String("confluence.comment_id", commentID),
+	))
+	defer func() { finishSpan(span, err) }()
+
+	site, err := s.orgSite(ctx, orgID)
+	if err != nil {
+		return err
+	}
+	if err := site.DeleteContent(ctx, commentID); err != nil {
+		if err = writeFailure("comment", commentID, err); errors.Is(err, ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+// AddPageLabel labels a page; a label it already has is kept
+func (s *ConfluenceService) AddPageLabel(ctx context.Context, orgID, pageID, label string) (err error) {
+	ctx, span := tracer.Start(ctx, "ConfluenceService.AddPageLabel", trace.WithAttributes(
+		attribute.String("updoc.org_id", orgID),
+		attribute.String("confluence.page_id", pageID),
+		attribute.String("confluence.label", label),
+	))
+	defer func() { finishSpan(span, err) }()
+
+	site, err := s.orgSite(ctx, orgID)
+	if err != nil {
+		return err
+	}
+	if err := site.AddLabels(ctx, pageID, label); err != nil {
+		return writeFailure("page", pageID, err)
+	}
+	return nil
+}
+
+// RemovePageLabel removes a label from a page; a label the page doesn't have
+// is not an error
+func (s *ConfluenceService) RemovePageLabel(ctx context.Context, orgID, pageID, label string) (err error) {
+	ctx, span := tracer.Start(ctx, "ConfluenceService.RemovePageLabel", trace.WithAttributes(
+		attribute.String("updoc.org_id", orgID),
+		attribute.String("confluence.page_id", pageID),
+		attribute.String("confluence.label", label),
+	))
+	defer func() { finishSpan(span, err) }()
+
+	site, err := s.orgSite(ctx, orgID)
+	if err != nil {
+		return err
+	}
+	if err := site.RemoveLabel(ctx, pageID, label); err != nil {
+		if err = writeFailure("page", pageID, err); errors.Is(err, ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+// orgSite returns the Confluence site of an organization whose integration
+// is configured
+func (s *ConfluenceService) orgSite(ctx context.Context, orgID string) (*confluence.Site, error) {
+	org, err := s.orgRepo.GetByID(ctx, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("organization %s: %w", orgID, ErrNotFound)
+	}
+	if !configured(org) {
+		return nil, fmt.Errorf("confluence integration not configured: %w", ErrInvalidInput)
+	}
+	return s.site(org), nil
+}
+
+// writeFailure maps a failed write: missing content is not found, a refusal
+// means the credentials can't write there, and anything else is Confluence's
+// problem or unexpected
+func writeFailure(kind, id string, err error) error {
+	var apiErr *confluence.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.StatusCode {
+		case http.StatusNotFound:
+			return fmt.Errorf("confluence %s %s: %w", kind, id, ErrNotFound)
+		case http.StatusForbidden:
+			return fmt.Errorf("not allowed to write to confluence %s %s: %w", kind, id, ErrForbidden)
+		}
+	}
+	return fmt.Errorf("failed to write to confluence %s %s: %w", kind, id, unavailable(err))
+}
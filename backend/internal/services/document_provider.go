@@ -0,0 +1,73 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/shaunpua/updoc/internal/doc"
+	"github.com/shaunpua/updoc/pkg/api"
+)
+
+// DocumentProvider is where a workspace's documents live, e.g. a Confluence
+// space, a Notion workspace or a git repository. Each workspace's integration
+// type picks its provider, and its integration config says where to look and,
+// for providers with per-workspace credentials, how to sign in.
+type DocumentProvider interface {
+	// Type is the integration type the provider serves
+	Type() string
+	// TestConnection checks that the provider can be reached with the
+	// workspace's settings. A failed check is a result, not an error.
+	TestConnection(ctx context.Context, ws *doc.Workspace) (*ConnectionTest, error)
+	// ListDocuments returns one page of the workspace's documents, starting
+	// at cursor ("" for the first page)
+	ListDocuments(ctx context.Context, ws *doc.Workspace, cursor string, limit int) (*ProviderDocumentList, error)
+	// SearchDocuments finds the workspace's documents matching query
+	SearchDocuments(ctx context.Context, ws *doc.Workspace, query, cursor string, limit int) (*ProviderDocumentList, error)
+	// Document returns a document's current metadata. Comparing its Version
+	// with one recorded earlier tells whether it was edited since.
+	Document(ctx context.Context, ws *doc.Workspace, id string) (*ProviderDocument, error)
+	// Content returns a document's current body as sanitized HTML and
+	// Markdown. representation picks a provider-specific rendering; ""
+	// is the provider's default.
+	Content(ctx context.Context, ws *doc.Workspace, id, representation string) (*ConfluencePageContent, error)
+}
+
+// Connection tests and provider documents are API types
+type (
+	ConnectionTest       = api.ConnectionTest
+	ProviderDocument     = api.ProviderDocument
+	ProviderDocumentList = api.ProviderDocumentList
+)
+
+// providerVersion is the document's version as FlagService.PageEdited takes it
+func providerVersion(d *ProviderDocument) *ConfluencePageVersion {
+	return &ConfluencePageVersion{Number: d.Version, ModifiedAt: d.EditedAt, ModifiedBy: d.EditedBy}
+}
+
+// Providers looks up the provider for a workspace's integration type
+type Providers struct {
+	byType map[string]DocumentProvider
+}
+
+func NewProviders(providers ...DocumentProvider) *Providers {
+	p := &Providers{byType: make(map[string]DocumentProvider, len(providers))}
+	for _, provider := range providers {
+		p.byType[provider.Type()] = provider
+	}
+	return p
+}
+
+// Supports reports whether integrationType has a provider
+func (p *Providers) Supports(integrationType string) bool {
+	_, ok := p.byType[integrationType]
+	return ok
+}
+
+// For returns ws's provider
+func (p *Providers) For(ws *doc.Workspace) (DocumentProvider, error) {
+	provider, ok := p.byType[ws.IntegrationType]
+	if !ok {
+		return nil, fmt.Errorf("%q workspaces are not supported: %w", ws.IntegrationType, ErrInvalidInput)
+	}
+	return provider, nil
+}
@@ -0,0 +1,78 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/shaunpua/updoc/internal/doc"
+	"github.com/shaunpua/updoc/pkg/api"
+)
+
+type DocumentService struct {
+	documentRepo     doc.DocumentRepository
+	flagRepo         doc.FlagRepository
+	workspaceService *WorkspaceService
+	logger           *slog.Logger
+}
+
+func NewDocumentService(documentRepo doc.DocumentRepository, flagRepo doc.FlagRepository, workspaceService *WorkspaceService, logger *slog.Logger) *DocumentService {
+	return &DocumentService{
+		documentRepo:     documentRepo,
+		flagRepo:         flagRepo,
+		workspaceService: workspaceService,
+		logger:           logger,
+	}
+}
+
+// DocumentContent is a tracked document with its page body
+type DocumentContent = api.DocumentContent
+
+// Get returns a document if it belongs to a workspace of the user's organization
+func (s *DocumentService) Get(ctx context.Context, user *doc.User, id string) (*doc.Document, *doc.Workspace, error) {
+	document, err := s.documentRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, nil, fmt.Errorf("document %s: %w", id, ErrNotFound)
+	}
+	ws, err := s.workspaceService.Get(ctx, user, document.WorkspaceID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("document %s: %w", id, ErrNotFound)
+	}
+	return document, ws, nil
+}
+
+// Content fetches the current body of the page behind a document from its
+// workspace's provider, rendered as sanitized HTML and Markdown.
+// representation is provider-specific: storage (the default) or view for
+// Confluence pages, and empty for Notion ones.
+func (s *DocumentService) Content(ctx context.Context, user *doc.User, id, representation string) (*DocumentContent, error) {
+	document, ws, err := s.Get(ctx, user, id)
+	if err != nil {
+		return nil, err
+	}
+	if document.ExternalID == "" {
+		return nil, fmt.Errorf("document %s has no page ID; sync its workspace to resolve it: %w", document.ID, ErrInvalidInput)
+	}
+	provider, err := s.workspaceService.providers.For(ws)
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := provider.Content(ctx, ws, document.ExternalID, representation)
+	if err != nil {
+		return nil, err
+	}
+	return &DocumentContent{Document: document, Content: content}, nil
+}
+
+// confluencePageID returns the ID of the Confluence page behind a document
+// in ws, failing for other integrations and pages not yet resolved by a sync
+func confluencePageID(document *doc.Document, ws *doc.Workspace) (string, error) {
+	if ws.IntegrationType != "confluence" {
+		return "", fmt.Errorf("pages are not supported for %q workspaces: %w", ws.IntegrationType, ErrInvalidInput)
+	}
+	if document.ExternalID == "" {
+		return "", fmt.Errorf("document %s has no Confluence page ID; sync its workspace to resolve it: %w", document.ID, ErrInvalidInput)
+	}
+	return document.ExternalID, nil
+}
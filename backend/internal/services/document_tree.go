@@ -0,0 +1,123 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/shaunpua/updoc/internal/doc"
+	"github.com/shaunpua/updoc/pkg/api"
+)
+
+// DocumentTree and DocumentTreeNode arrange a workspace's documents as their
+// pages are in the provider
+type (
+	DocumentTree     = api.DocumentTree
+	DocumentTreeNode = api.DocumentTreeNode
+)
+
+// Tree returns the workspace's documents as a tree, with open flags rolled up
+// per subtree so the sections of a space that need the most work stand out.
+// A document hangs under its nearest ancestor page that is tracked too, so
+// pages left out by label rules don't break the tree. Documents not yet placed
+// by a sync are shown at the top, and pages removed from the space are left
+// out. Children are ordered by title.
+func (s *DocumentService) Tree(ctx context.Context, user *doc.User, workspaceID string) (*DocumentTree, error) {
+	ws, err := s.workspaceService.Get(ctx, user, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	docs, err := s.documentRepo.GetByWorkspaceID(ctx, ws.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load documents: %w", err)
+	}
+	docs = slices.DeleteFunc(docs, func(d *doc.Document) bool { return d.RemovedAt != nil })
+
+	ids := make([]string, len(docs))
+	for i, d := range docs {
+		ids[i] = d.ID
+	}
+	openFlags, err := s.flagRepo.CountOpenByDocument(ctx, ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count open flags: %w", err)
+	}
+
+	nodes := make([]*DocumentTreeNode, len(docs))
+	byPage := make(map[string]*DocumentTreeNode, len(docs))
+	for i, d := range docs {
+		nodes[i] = &DocumentTreeNode{Document: d, OpenFlags: openFlags[d.ID], Children: []*DocumentTreeNode{}}
+		if d.ExternalID != "" {
+			byPage[d.ExternalID] = nodes[i]
+		}
+	}
+
+	parents := make(map[*DocumentTreeNode]*DocumentTreeNode, len(nodes))
+	for _, n := range nodes {
+		ancestors := n.Document.AncestorPageIDs
+		for i := len(ancestors) - 1; i >= 0; i-- {
+			if p, ok := byPage[ancestors[i]]; ok && p != n {
+				parents[n] = p
+				p.Children = append(p.Children, n)
+				break
+			}
+		}
+	}
+
+	tree := &DocumentTree{WorkspaceID: ws.ID, Roots: []*DocumentTreeNode{}}
+	visited := make(map[*DocumentTreeNode]bool, len(nodes))
+	for _, n := range nodes {
+		if _, ok := parents[n]; !ok {
+			tree.Roots = append(tree.Roots, n)
+			rollUp(n, visited)
+		}
+	}
+	// Ancestors recorded by syncs on either side of a move can form a loop;
+	// cut it at one of its pages and show that page at the top. A page left
+	// unvisited may only hang below the loop, so its parents are followed
+	// until one repeats, which is on the loop.
+	for _, n := range nodes {
+		if visited[n] {
+			continue
+		}
+		cut, seen := n, make(map[*DocumentTreeNode]bool)
+		for !seen[cut] {
+			seen[cut] = true
+			cut = parents[cut]
+		}
+		p := parents[cut]
+		p.Children = slices.DeleteFunc(p.Children, func(c *DocumentTreeNode) bool { return c == cut })
+		delete(parents, cut)
+		tree.Roots = append(tree.Roots, cut)
+		rollUp(cut, visited)
+	}
+
+	sortByTitle(tree.Roots)
+	for _, root := range tree.Roots {
+		tree.Documents += root.SubtreeDocuments
+		tree.OpenFlags += root.SubtreeOpenFlags
+	}
+	return tree, nil
+}
+
+// rollUp totals n's subtree, marking the nodes it reaches
+func rollUp(n *DocumentTreeNode, visited map[*DocumentTreeNode]bool) {
+	visited[n] = true
+	n.SubtreeDocuments = 1
+	n.SubtreeOpenFlags = n.OpenFlags
+	for _, c := range n.Children {
+		if visited[c] {
+			continue
+		}
+		rollUp(c, visited)
+		n.SubtreeDocuments += c.SubtreeDocuments
+		n.SubtreeOpenFlags += c.SubtreeOpenFlags
+	}
+	sortByTitle(n.Children)
+}
+
+func sortByTitle(nodes []*DocumentTreeNode) {
+	slices.SortStableFunc(nodes, func(a, b *DocumentTreeNode) int {
+		return strings.Compare(strings.ToLower(a.Document.Title), strings.ToLower(b.Document.Title))
+	})
+}
@@ -0,0 +1,166 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/shaunpua/updoc/internal/doc"
+)
+
+// treeShape maps each page in a tree to its parent page, "" for roots, and
+// checks the rolled-up counts on the way
+func treeShape(t *testing.T, tree *DocumentTree) map[string]string {
+	t.Helper()
+	shape := make(map[string]string)
+	var walk func(n *DocumentTreeNode, parent string) (documents, flags int)
+	walk = func(n *DocumentTreeNode, parent string) (documents, flags int) {
+		page := n.Document.ExternalID
+		if _, ok := shape[page]; ok {
+			t.Fatalf("page %s is in the tree twice", page)
+		}
+		shape[page] = parent
+		documents, flags = 1, n.OpenFlags
+		for _, c := range n.Children {
+			d, f := walk(c, page)
+			documents += d
+			flags += f
+		}
+		if n.SubtreeDocuments != documents || n.SubtreeOpenFlags != flags {
+			t.Errorf("page %s totals %d documents and %d flags, want %d and %d", page, n.SubtreeDocuments, n.SubtreeOpenFlags, documents, flags)
+		}
+		return documents, flags
+	}
+	var documents, flags int
+	for _, root := range tree.Roots {
+		d, f := walk(root, "")
+		documents += d
+		flags += f
+	}
+	if tree.Documents != documents || tree.OpenFlags != flags {
+		t.Errorf("tree totals %d documents and %d flags, want %d and %d", tree.Documents, tree.OpenFlags, documents, flags)
+	}
+	return shape
+}
+
+func TestDocumentTree(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	env.sync(t)
+
+	open := func(pageID, title string) *doc.Flag {
+		t.Helper()
+		flag, err := env.flags.Create(ctx, env.admin, doc.CreateFlagRequest{DocumentID: env.document(t, pageID).ID, Title: title, Priority: doc.PriorityLow})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return flag
+	}
+	open("102", "Token expiry is wrong")
+	open("102", "Examples are stale")
+	open("104", "Retries are undocumented")
+	resolved := open("103", "Rollback is missing")
+	if _, err := env.flags.Resolve(ctx, env.admin, resolved.ID, "Added"); err != nil {
+		t.Fatal(err)
+	}
+
+	tree, err := env.documents.Tree(ctx, env.admin, env.ws.ID)
+	if err != nil {
+		t.Fatalf("Tree: %v", err)
+	}
+	shape := treeShape(t, tree)
+	if len(shape) != 5 || shape["101"] != "" || shape["102"] != "101" || shape["104"] != "102" {
+		t.Errorf("tree = %v", shape)
+	}
+	if tree.Documents != 5 || tree.OpenFlags != 3 {
+		t.Errorf("tree totals %d documents and %d flags, want 5 and 3", tree.Documents, tree.OpenFlags)
+	}
+	var titles []string
+	for _, c := range tree.Roots[0].Children {
+		titles = append(titles, c.Document.Title)
+	}
+	if len(titles) < 2 || titles[0] > titles[1] {
+		t.Errorf("children of the home page = %v, want them by title", titles)
+	}
+}
+
+func TestDocumentTreeAncestors(t *testing.T) {
+	tests := []struct {
+		name string
+		// ancestors replaces the recorded ancestors of pages, nearest last
+		ancestors map[string][]string
+		removed   []string
+		want      map[string]string
+	}{
+		{
+			name:      "untracked parent",
+			ancestors: map[string][]string{"104": {"101", "999"}, "105": {"998"}},
+			want:      map[string]string{"101": "", "102": "101", "103": "101", "104": "101", "105": ""},
+		},
+		{
+			name:    "removed parent",
+			removed: []string{"102"},
+			want:    map[string]string{"101": "", "103": "101", "104": "101", "105": "101"},
+		},
+		{
+			name:      "two-page loop",
+			ancestors: map[string][]string{"102": {"103"}, "103": {"102"}},
+			want:      map[string]string{"101": "", "102": "", "103": "102", "104": "102", "105": "101"},
+		},
+		{
+			// 101 comes first and hangs below the loop; the loop is cut
+			// at one of its own pages, not at 101
+			name:      "pages below a loop",
+			ancestors: map[string][]string{"101": {"104"}, "104": {"105"}, "105": {"104"}},
+			want:      map[string]string{"104": "", "105": "104", "101": "104", "102": "101", "103": "101"},
+		},
+		{
+			name:      "page its own ancestor",
+			ancestors: map[string][]string{"103": {"103"}},
+			want:      map[string]string{"101": "", "102": "101", "103": "", "104": "102", "105": "101"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t)
+			ctx := context.Background()
+			env.sync(t)
+			if _, err := env.flags.Create(ctx, env.admin, doc.CreateFlagRequest{DocumentID: env.document(t, "104").ID, Title: "Stale", Priority: doc.PriorityLow}); err != nil {
+				t.Fatal(err)
+			}
+			for page, ancestors := range tt.ancestors {
+				d := env.document(t, page)
+				d.AncestorPageIDs = ancestors
+				d.ParentPageID = ancestors[len(ancestors)-1]
+				if err := env.store.Documents().Update(ctx, d); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for _, page := range tt.removed {
+				d := env.document(t, page)
+				now := time.Now()
+				d.RemovedAt = &now
+				if err := env.store.Documents().Update(ctx, d); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			tree, err := env.documents.Tree(ctx, env.admin, env.ws.ID)
+			if err != nil {
+				t.Fatalf("Tree: %v", err)
+			}
+			shape := treeShape(t, tree)
+			if len(shape) != len(tt.want) {
+				t.Errorf("tree = %v, want %v", shape, tt.want)
+			}
+			for page, parent := range tt.want {
+				if got, ok := shape[page]; !ok || got != parent {
+					t.Errorf("parent of %s = %q, want %q (tree %v)", page, got, parent, shape)
+				}
+			}
+			if tree.OpenFlags != 1 {
+				t.Errorf("tree has %d open flags, want 1", tree.OpenFlags)
+			}
+		})
+	}
+}
@@ -0,0 +1,162 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shaunpua/updoc/internal/config"
+	"github.com/shaunpua/updoc/internal/confluence"
+	"github.com/shaunpua/updoc/internal/confluence/confluencetest"
+	"github.com/shaunpua/updoc/internal/doc"
+	"github.com/shaunpua/updoc/internal/gitrepo"
+	"github.com/shaunpua/updoc/internal/notion"
+	"github.com/shaunpua/updoc/internal/secret"
+	"github.com/shaunpua/updoc/internal/storage/memstore"
+)
+
+// testEnv is the services wired over an in-memory store, with an org whose
+// default workspace is the ENG space of a fake Confluence site
+type testEnv struct {
+	cfg   config.Config
+	store *memstore.Store
+	site  *confluencetest.Server
+
+	confluence *ConfluenceService
+	workspaces *WorkspaceService
+	documents  *DocumentService
+	flags      *FlagService
+	codes      *CodeChangeService
+
+	org   *doc.Organization
+	admin *doc.User
+	ws    *doc.Workspace
+}
+
+// testOption adjusts the configuration or the fake site before the
+// services are built
+type testOption func(*config.Config, *confluencetest.Options)
+
+func newTestEnv(t *testing.T, opts ...testOption) *testEnv {
+	t.Helper()
+
+	cfg := config.Default()
+	cfg.Confluence.MaxRetries = 2
+	cfg.Confluence.RetryBaseDelay = time.Millisecond
+	cfg.Confluence.RetryMaxDelay = 10 * time.Millisecond
+	cfg.Git.CacheDir = t.TempDir()
+	siteOpts := confluencetest.Options{Email: "bot@example.com", Token: "secret"}
+	for _, opt := range opts {
+		opt(&cfg, &siteOpts)
+	}
+
+	site, err := confluencetest.NewServer(siteOpts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(site.Close)
+	if siteOpts.OAuthClientID != "" {
+		// The site stands in for Atlassian's auth server and API gateway too
+		root := strings.TrimSuffix(site.URL(), confluencetest.ContextPath)
+		cfg.Confluence.OAuth.AuthURL, cfg.Confluence.OAuth.APIURL = root, root
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+	cipher, err := secret.NewCipher(base64.StdEncoding.EncodeToString(key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	env := &testEnv{cfg: cfg, store: memstore.New(), site: site}
+	orgs, users, workspaces := env.store.Organizations(), env.store.Users(), env.store.Workspaces()
+	documents, flags := env.store.Documents(), env.store.Flags()
+
+	env.confluence = NewConfluenceService(orgs, confluence.New(cfg.Confluence, logger), cipher, logger)
+	git := gitrepo.New(cfg.Git, logger)
+	providers := NewProviders(
+		NewConfluenceProvider(env.confluence),
+		NewNotionProvider(notion.New(cfg.Notion, logger)),
+		NewGitProvider(git),
+	)
+	env.workspaces = NewWorkspaceService(workspaces, documents, flags, users, env.confluence, providers, logger)
+	env.documents = NewDocumentService(documents, flags, env.workspaces, logger)
+	env.flags = NewFlagService(flags, documents, users, env.store.Notifications(), env.workspaces, env.confluence, logger)
+	env.codes = NewCodeChangeService(git, documents, flags, users, env.workspaces, env.flags, logger)
+
+	created, err := NewOrganizationService(orgs, users, workspaces, logger).CreateWithUser(context.Background(), CreateOrgRequest{
+		Name:               "Acme",
+		UserName:           "Alice Park",
+		UserEmail:          "alice@acme.example.com",
+		ConfluenceBaseURL:  site.URL(),
+		ConfluenceEmail:    "bot@example.com",
+		ConfluenceToken:    "secret",
+		ConfluenceSpaceKey: "ENG",
+	})
+	if err != nil {
+		t.Fatalf("CreateWithUser: %v", err)
+	}
+	if env.org, err = orgs.GetByID(context.Background(), created.Organization.ID); err != nil {
+		t.Fatal(err)
+	}
+	env.admin, env.ws = created.User, created.Workspace
+	return env
+}
+
+// addUser adds a member to the env's org
+func (env *testEnv) addUser(t *testing.T, email, name string) *doc.User {
+	t.Helper()
+	user := &doc.User{Email: email, Name: name, OrgID: env.org.ID, Role: "member", IsActive: true}
+	if err := env.store.Users().Create(context.Background(), user); err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// sync syncs the default workspace, failing the test on error
+func (env *testEnv) sync(t *testing.T) *doc.SyncResult {
+	t.Helper()
+	result, err := env.workspaces.Sync(context.Background(), env.admin, env.ws.ID)
+	if err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	return result
+}
+
+// document returns the default workspace's document for a page
+func (env *testEnv) document(t *testing.T, pageID string) *doc.Document {
+	t.Helper()
+	documents, err := env.store.Documents().GetByExternalIDs(context.Background(), []string{env.ws.ID}, []string{pageID})
+	if err != nil || len(documents) != 1 {
+		t.Fatalf("document for page %s: %v, %v", pageID, documents, err)
+	}
+	return documents[0]
+}
+
+// addOrg creates another org whose default workspace is the same ENG space
+// of the env's site, returning its admin and workspace
+func (env *testEnv) addOrg(t *testing.T, name, email string) (*doc.User, *doc.Workspace) {
+	t.Helper()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	created, err := NewOrganizationService(env.store.Organizations(), env.store.Users(), env.store.Workspaces(), logger).CreateWithUser(context.Background(), CreateOrgRequest{
+		Name:               name,
+		UserName:           name + " Admin",
+		UserEmail:          email,
+		ConfluenceBaseURL:  env.site.URL(),
+		ConfluenceEmail:    "bot@example.com",
+		ConfluenceToken:    "secret",
+		ConfluenceSpaceKey: "ENG",
+	})
+	if err != nil {
+		t.Fatalf("CreateWithUser: %v", err)
+	}
+	return created.User, created.Workspace
+}
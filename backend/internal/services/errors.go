@@ -0,0 +1,19 @@
+package services
+
+import "errors"
+
+// Sentinel errors wrapped by services so handlers can pick a status code
+var (
+	ErrNotFound     = errors.New("not found")
+	ErrForbidden    = errors.New("forbidden")
+	ErrInvalidInput = errors.New("invalid input")
+	// ErrUnauthorized means the caller's credentials, such as a webhook
+	// signature, are missing or don't check out
+	ErrUnauthorized = errors.New("unauthorized")
+	// ErrUnavailable means a dependency such as Confluence is failing or
+	// rejecting calls, so retrying later may succeed
+	ErrUnavailable = errors.New("service unavailable")
+	// ErrUpstream means a dependency such as Confluence answered with an
+	// error that retrying won't fix
+	ErrUpstream = errors.New("upstream error")
+)
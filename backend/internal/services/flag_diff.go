@@ -0,0 +1,123 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/shaunpua/updoc/internal/doc"
+	"github.com/shaunpua/updoc/internal/textdiff"
+	"github.com/shaunpua/updoc/pkg/api"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// DefaultDiffContext is how many unchanged lines surround each change
+const DefaultDiffContext = 3
+
+// Diff formats
+const (
+	DiffUnified    = "unified"
+	DiffSideBySide = "side_by_side"
+)
+
+// FlagDiff is what changed in a flagged page between the version flagged and
+// the current one
+type (
+	FlagDiff     = api.FlagDiff
+	FlagDiffHunk = api.FlagDiffHunk
+)
+
+// Diff compares the page behind a flag at the version recorded when the flag
+// was raised with its current version. format is unified (the default) or
+// side_by_side; contextLines is the number of unchanged lines around changes.
+func (s *FlagService) Diff(ctx context.Context, user *doc.User, id, format string, contextLines int) (_ *FlagDiff, err error) {
+	if format == "" {
+		format = DiffUnified
+	}
+	ctx, span := tracer.Start(ctx, "FlagService.Diff", trace.WithAttributes(
+		attribute.String("updoc.flag_id", id),
+		attribute.String("updoc.diff_format", format),
+	))
+	defer func() { finishSpan(span, err) }()
+
+	if format != DiffUnified && format != DiffSideBySide {
+		return nil, fmt.Errorf("format must be unified or side_by_side: %w", ErrInvalidInput)
+	}
+	if contextLines < 0 {
+		return nil, fmt.Errorf("context must not be negative: %w", ErrInvalidInput)
+	}
+
+	flag, err := s.Get(ctx, user, id)
+	if err != nil {
+		return nil, err
+	}
+	ws, err := s.workspaceService.Get(ctx, user, flag.Document.WorkspaceID)
+	if err != nil {
+		return nil, fmt.Errorf("flag %s: %w", id, ErrNotFound)
+	}
+	pageID, err := confluencePageID(flag.Document, ws)
+	if err != nil {
+		return nil, err
+	}
+	if flag.PageVersion == 0 {
+		return nil, fmt.Errorf("flag %s has no recorded page version to diff from: %w", id, ErrInvalidInput)
+	}
+
+	from, err := s.confluenceService.PageContent(ctx, ws.OrgID, pageID, flag.PageVersion, "storage")
+	if err != nil {
+		return nil, err
+	}
+	to, err := s.confluenceService.PageContent(ctx, ws.OrgID, pageID, 0, "storage")
+	if err != nil {
+		return nil, err
+	}
+
+	edits := textdiff.Lines(from.Markdown, to.Markdown)
+	added, removed := textdiff.Stats(edits)
+	diff := &FlagDiff{
+		FlagID:      flag.ID,
+		DocumentID:  flag.DocumentID,
+		PageID:      pageID,
+		Title:       to.Title,
+		URL:         to.URL,
+		FromVersion: from.Version,
+		ToVersion:   to.Version,
+		ModifiedAt:  to.ModifiedAt,
+		ModifiedBy:  to.ModifiedBy,
+		Changed:     added+removed > 0,
+		Added:       added,
+		Removed:     removed,
+		Format:      format,
+	}
+	span.SetAttributes(
+		attribute.Int("confluence.from_version", diff.FromVersion),
+		attribute.Int("confluence.to_version", diff.ToVersion),
+		attribute.Bool("updoc.diff_changed", diff.Changed),
+	)
+
+	if format == DiffUnified {
+		diff.Unified = textdiff.Unified(edits,
+			fmt.Sprintf("%s (version %d)", from.Title, from.Version),
+			fmt.Sprintf("%s (version %d)", to.Title, to.Version),
+			contextLines)
+	} else {
+		for _, h := range textdiff.Hunks(edits, contextLines) {
+			hunk := FlagDiffHunk{Header: h.Header()}
+			for _, row := range h.Rows() {
+				hunk.Rows = append(hunk.Rows, api.DiffRow{
+					Op: string(row.Op), LeftLine: row.LeftLine, Left: row.Left, RightLine: row.RightLine, Right: row.Right,
+				})
+			}
+			diff.Hunks = append(diff.Hunks, hunk)
+		}
+	}
+
+	if flag.Status == doc.FlagStatusResolved && !diff.Changed {
+		if diff.FromVersion == diff.ToVersion {
+			diff.Warning = "the flag is resolved but the page has not been edited since it was raised"
+		} else {
+			diff.Warning = "the flag is resolved but the page's text is the same as when it was raised"
+		}
+	}
+	return diff, nil
+}
@@ -0,0 +1,297 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/shaunpua/updoc/internal/doc"
+)
+
+type FlagService struct {
+	flagRepo          doc.FlagRepository
+	documentRepo      doc.DocumentRepository
+	userRepo          doc.UserRepository
+	notificationRepo  doc.NotificationRepository
+	workspaceService  *WorkspaceService
+	confluenceService *ConfluenceService
+	logger            *slog.Logger
+}
+
+func NewFlagService(flagRepo doc.FlagRepository, documentRepo doc.DocumentRepository, userRepo doc.UserRepository, notificationRepo doc.NotificationRepository, workspaceService *WorkspaceService, confluenceService *ConfluenceService, logger *slog.Logger) *FlagService {
+	return &FlagService{
+		flagRepo:          flagRepo,
+		documentRepo:      documentRepo,
+		userRepo:          userRepo,
+		notificationRepo:  notificationRepo,
+		workspaceService:  workspaceService,
+		confluenceService: confluenceService,
+		logger:            logger,
+	}
+}
+
+// Create opens a flag on a document. The document can be referenced by ID or by
+// URL; URLs that aren't tracked yet are added to the org's default workspace.
+// The document's current version is recorded, so the flag can be watched for
+// edits and, for Confluence pages, later diffed against what the page
+// became; the flag is written back to the page if the workspace asks for it.
+func (s *FlagService) Create(ctx context.Context, user *doc.User, req doc.CreateFlagRequest) (*doc.Flag, error) {
+	if strings.TrimSpace(req.Title) == "" {
+		return nil, fmt.Errorf("title is required: %w", ErrInvalidInput)
+	}
+	if req.Priority == "" {
+		req.Priority = doc.PriorityMedium
+	}
+	if !doc.ValidPriority(req.Priority) {
+		return nil, fmt.Errorf("priority must be one of urgent, high, medium, low: %w", ErrInvalidInput)
+	}
+
+	document, _, err := s.resolveDocument(ctx, user, req)
+	if err != nil {
+		return nil, err
+	}
+
+	assignedTo := req.AssignedTo
+	if assignedTo != nil && *assignedTo == "" {
+		assignedTo = nil
+	}
+	if assignedTo != nil {
+		if _, err := s.orgUserByID(ctx, user.OrgID, *assignedTo); err != nil {
+			return nil, err
+		}
+	}
+	if req.AssignTo != "" {
+		assignee, err := s.orgUserByEmail(ctx, user.OrgID, req.AssignTo)
+		if err != nil {
+			return nil, err
+		}
+		assignedTo = &assignee.ID
+	}
+
+	now := time.Now()
+	flag := &doc.Flag{
+		DocumentID:  document.ID,
+		CreatedBy:   user.ID,
+		AssignedTo:  assignedTo,
+		Title:       req.Title,
+		Description: req.Description,
+		Priority:    req.Priority,
+		Status:      doc.FlagStatusPending,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if document.ExternalID != "" {
+		// The provider being unreachable shouldn't stop anyone flagging a
+		// page; the flag just can't be diffed or watched for edits
+		if current, err := s.workspaceService.currentDocument(ctx, document); err != nil {
+			s.logger.WarnContext(ctx, "failed to record page version", "document_id", document.ID, "page_id", document.ExternalID, "error", err)
+		} else {
+			flag.PageVersion = current.Version
+		}
+	}
+	if err := s.flagRepo.Create(ctx, flag); err != nil {
+		return nil, fmt.Errorf("failed to create flag: %w", err)
+	}
+	s.logger.InfoContext(ctx, "flag created",
+		"flag_id", flag.ID, "document_id", document.ID, "priority", flag.Priority, "page_version", flag.PageVersion, "user_id", user.ID)
+
+	// Reload so the response carries the creator, assignee and document
+	if loaded, err := s.flagRepo.GetByID(ctx, flag.ID); err == nil {
+		flag = loaded
+	} else {
+		flag.Document = document
+	}
+	s.writeBack(ctx, flag)
+	return flag, nil
+}
+
+// List returns flags in the user's organization matching filters
+func (s *FlagService) List(ctx context.Context, user *doc.User, filters doc.FlagFilters) ([]*doc.Flag, error) {
+	filters.OrgID = user.OrgID
+	return s.flagRepo.GetByFilters(ctx, filters)
+}
+
+// Get returns a flag if its document belongs to the user's organization
+func (s *FlagService) Get(ctx context.Context, user *doc.User, id string) (*doc.Flag, error) {
+	flag, err := s.flagRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("flag %s: %w", id, ErrNotFound)
+	}
+	if flag.Document == nil {
+		return nil, fmt.Errorf("flag %s has no document: %w", id, ErrNotFound)
+	}
+	if _, err := s.workspaceService.Get(ctx, user, flag.Document.WorkspaceID); err != nil {
+		return nil, fmt.Errorf("flag %s: %w", id, ErrNotFound)
+	}
+	return flag, nil
+}
+
+// Update applies a partial update. Moving a flag to resolved stamps ResolvedAt,
+// with a ResolutionWarning if the page is still at the version flagged; moving
+// it out of resolved clears both. The change is written back to Confluence if
+// the workspace asks for it.
+func (s *FlagService) Update(ctx context.Context, user *doc.User, id string, req doc.UpdateFlagRequest) (*doc.Flag, error) {
+	flag, err := s.Get(ctx, user, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Title != nil {
+		flag.Title = *req.Title
+	}
+	if req.Description != nil {
+		flag.Description = *req.Description
+	}
+	if req.Priority != nil {
+		if !doc.ValidPriority(*req.Priority) {
+			return nil, fmt.Errorf("priority must be one of urgent, high, medium, low: %w", ErrInvalidInput)
+		}
+		flag.Priority = *req.Priority
+	}
+	if req.AssignedTo != nil {
+		if *req.AssignedTo == "" {
+			flag.AssignedTo = nil
+		} else {
+			if _, err := s.orgUserByID(ctx, user.OrgID, *req.AssignedTo); err != nil {
+				return nil, err
+			}
+			flag.AssignedTo = req.AssignedTo
+		}
+	}
+	if req.Resolution != nil {
+		flag.Resolution = *req.Resolution
+	}
+	if req.Status != nil && *req.Status != flag.Status {
+		if !doc.ValidFlagStatus(*req.Status) {
+			return nil, fmt.Errorf("unknown status %q: %w", *req.Status, ErrInvalidInput)
+		}
+		flag.Status = *req.Status
+		if flag.Status == doc.FlagStatusResolved {
+			now := time.Now()
+			flag.ResolvedAt = &now
+			flag.ResolutionWarning = s.unchangedWarning(ctx, user, flag)
+		} else {
+			flag.ResolvedAt = nil
+			flag.ResolutionWarning = ""
+		}
+	}
+
+	flag.UpdatedAt = time.Now()
+	if err := s.flagRepo.Update(ctx, flag); err != nil {
+		return nil, fmt.Errorf("failed to update flag: %w", err)
+	}
+	s.logger.InfoContext(ctx, "flag updated", "flag_id", flag.ID, "status", flag.Status, "user_id", user.ID)
+	if flag.ResolutionWarning != "" {
+		s.logger.WarnContext(ctx, "flag resolved without a page change", "flag_id", flag.ID, "page_version", flag.PageVersion, "user_id", user.ID)
+	}
+	s.writeBack(ctx, flag)
+	return flag, nil
+}
+
+// unchangedWarning explains why resolving flag looks premature, or returns ""
+// if the page has moved on from the version flagged or that can't be told
+func (s *FlagService) unchangedWarning(ctx context.Context, user *doc.User, flag *doc.Flag) string {
+	if flag.PageVersion == 0 || flag.Document == nil || flag.Document.ExternalID == "" {
+		return ""
+	}
+	current, err := s.workspaceService.currentDocument(ctx, flag.Document)
+	if err != nil {
+		s.logger.WarnContext(ctx, "failed to check page version on resolve", "flag_id", flag.ID, "error", err)
+		return ""
+	}
+	if current.Version != flag.PageVersion {
+		return ""
+	}
+	return fmt.Sprintf("the page has not changed since the flag was raised (still version %d)", current.Version)
+}
+
+// Resolve marks a flag resolved with an optional note
+func (s *FlagService) Resolve(ctx context.Context, user *doc.User, id, note string) (*doc.Flag, error) {
+	status := doc.FlagStatusResolved
+	return s.Update(ctx, user, id, doc.UpdateFlagRequest{Status: &status, Resolution: &note})
+}
+
+func (s *FlagService) resolveDocument(ctx context.Context, user *doc.User, req doc.CreateFlagRequest) (*doc.Document, *doc.Workspace, error) {
+	if req.DocumentID != "" {
+		document, err := s.documentRepo.GetByID(ctx, req.DocumentID)
+		if err != nil {
+			return nil, nil, fmt.Errorf("document %s: %w", req.DocumentID, ErrNotFound)
+		}
+		ws, err := s.workspaceService.Get(ctx, user, document.WorkspaceID)
+		if err != nil {
+			return nil, nil, fmt.Errorf("document %s: %w", req.DocumentID, ErrNotFound)
+		}
+		return document, ws, nil
+	}
+
+	if req.DocumentURL == "" {
+		return nil, nil, fmt.Errorf("document_id or document_url is required: %w", ErrInvalidInput)
+	}
+
+	// Other orgs may track the same page; only the user's own workspaces
+	// are searched
+	workspaces, err := s.workspaceService.List(ctx, user)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load workspaces: %w", err)
+	}
+	workspaceIDs := make([]string, len(workspaces))
+	for i, ws := range workspaces {
+		workspaceIDs[i] = ws.ID
+	}
+	if document, err := s.documentRepo.GetByURL(ctx, workspaceIDs, req.DocumentURL); err == nil {
+		ws, err := s.workspaceService.Get(ctx, user, document.WorkspaceID)
+		if err != nil {
+			return nil, nil, fmt.Errorf("document %s: %w", req.DocumentURL, ErrNotFound)
+		}
+		return document, ws, nil
+	}
+
+	ws, err := s.workspaceService.Default(ctx, user.OrgID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot track %s: %w", req.DocumentURL, err)
+	}
+
+	var pageID, title string
+	switch ws.IntegrationType {
+	case "notion":
+		pageID, title = ParseNotionPageURL(req.DocumentURL)
+	case "git":
+		pageID, title = ParseGitDocumentURL(ws, req.DocumentURL)
+	default:
+		pageID, title = ParseConfluencePageURL(req.DocumentURL)
+	}
+	if title == "" {
+		title = req.DocumentURL
+	}
+	document := &doc.Document{
+		WorkspaceID: ws.ID,
+		Title:       title,
+		URL:         req.DocumentURL,
+		ExternalID:  pageID,
+		LastChecked: time.Now(),
+	}
+	if err := s.documentRepo.Create(ctx, document); err != nil {
+		return nil, nil, fmt.Errorf("failed to track document: %w", err)
+	}
+	s.logger.InfoContext(ctx, "document tracked", "document_id", document.ID, "workspace_id", ws.ID, "url", document.URL)
+	return document, ws, nil
+}
+
+// orgUserByID returns the user with the given ID if they belong to the org
+func (s *FlagService) orgUserByID(ctx context.Context, orgID, id string) (*doc.User, error) {
+	user, err := s.userRepo.GetByID(ctx, id)
+	if err != nil || user.OrgID != orgID {
+		return nil, fmt.Errorf("user %s: %w", id, ErrNotFound)
+	}
+	return user, nil
+}
+
+func (s *FlagService) orgUserByEmail(ctx context.Context, orgID, email string) (*doc.User, error) {
+	user, err := s.userRepo.GetByEmail(ctx, email)
+	if err != nil || user.OrgID != orgID {
+		return nil, fmt.Errorf("user %s: %w", email, ErrNotFound)
+	}
+	return user, nil
+}
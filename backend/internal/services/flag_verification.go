@@ -0,0 +1,170 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/shaunpua/updoc/internal/doc"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// PageEdited records that the page behind document reached version. Pending
+// and in-progress flags raised on an earlier version, and not yet put up for
+// verification at this one, move to awaiting verification, and their
+// creators and assignees are asked to confirm the edit fixes them. It
+// returns how many flags moved.
+func (s *FlagService) PageEdited(ctx context.Context, document *doc.Document, version *ConfluencePageVersion) (_ int, err error) {
+	ctx, span := tracer.Start(ctx, "FlagService.PageEdited", trace.WithAttributes(
+		attribute.String("updoc.document_id", document.ID),
+		attribute.Int("confluence.version", version.Number),
+	))
+	defer func() { finishSpan(span, err) }()
+
+	flags, err := s.flagRepo.GetByDocumentID(ctx, document.ID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to load flags: %w", err)
+	}
+
+	editor := version.ModifiedBy
+	if editor == "" {
+		editor = "someone"
+	}
+	moved := 0
+	for _, flag := range flags {
+		if flag.Status != doc.FlagStatusPending && flag.Status != doc.FlagStatusInProgress {
+			continue
+		}
+		if flag.PageVersion == 0 || version.Number <= max(flag.PageVersion, flag.CheckedVersion) {
+			continue
+		}
+
+		flag.Status = doc.FlagStatusAwaitingVerification
+		flag.CheckedVersion = version.Number
+		flag.UpdatedAt = time.Now()
+		if err := s.flagRepo.Update(ctx, flag); err != nil {
+			return moved, fmt.Errorf("failed to update flag %s: %w", flag.ID, err)
+		}
+		moved++
+		s.writeBack(ctx, flag)
+		s.logger.InfoContext(ctx, "flag awaiting verification",
+			"flag_id", flag.ID, "document_id", document.ID, "page_version", version.Number, "edited_by", version.ModifiedBy)
+
+		s.notify(ctx, flag, "", doc.NotificationVerificationRequested, fmt.Sprintf(
+			"%q was edited by %s (version %d). Please confirm this fixes the flag %q, or reopen it.",
+			document.Title, editor, version.Number, flag.Title))
+	}
+	span.SetAttributes(attribute.Int("updoc.flags_moved", moved))
+	return moved, nil
+}
+
+// PageRemoved tells the creators and assignees of the document's open flags
+// that its page was deleted or moved out of the workspace's space. The flags
+// stay open for someone to resolve. It returns how many flags were open.
+func (s *FlagService) PageRemoved(ctx context.Context, document *doc.Document) (_ int, err error) {
+	ctx, span := tracer.Start(ctx, "FlagService.PageRemoved", trace.WithAttributes(
+		attribute.String("updoc.document_id", document.ID),
+	))
+	defer func() { finishSpan(span, err) }()
+
+	flags, err := s.flagRepo.GetByDocumentID(ctx, document.ID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to load flags: %w", err)
+	}
+
+	open := 0
+	for _, flag := range flags {
+		if flag.Status == doc.FlagStatusResolved || flag.Status == doc.FlagStatusArchived {
+			continue
+		}
+		open++
+		s.notify(ctx, flag, "", doc.NotificationPageRemoved, fmt.Sprintf(
+			"%q was removed from Confluence. The flag %q is still open; resolve it if the page is no longer needed.",
+			document.Title, flag.Title))
+	}
+	span.SetAttributes(attribute.Int("updoc.open_flags", open))
+	return open, nil
+}
+
+// Confirm resolves a flag awaiting verification, accepting the page edit as
+// the fix. note defaults to naming the version confirmed.
+func (s *FlagService) Confirm(ctx context.Context, user *doc.User, id, note string) (*doc.Flag, error) {
+	flag, err := s.Get(ctx, user, id)
+	if err != nil {
+		return nil, err
+	}
+	if flag.Status != doc.FlagStatusAwaitingVerification {
+		return nil, fmt.Errorf("flag %s is %s, not awaiting verification: %w", id, flag.Status, ErrInvalidInput)
+	}
+	if note == "" {
+		note = fmt.Sprintf("Confirmed fixed by page version %d", flag.CheckedVersion)
+	}
+
+	flag, err = s.Resolve(ctx, user, id, note)
+	if err != nil {
+		return nil, err
+	}
+	s.notify(ctx, flag, user.ID, doc.NotificationFlagResolved,
+		fmt.Sprintf("%s confirmed the page edit fixes the flag %q.", user.Name, flag.Title))
+	return flag, nil
+}
+
+// Reopen sends a flag awaiting verification, or already resolved, back to
+// in progress, or to pending if nobody is assigned. The page stays watched:
+// the version it is at now counts as checked, and a later edit asks for
+// verification again.
+func (s *FlagService) Reopen(ctx context.Context, user *doc.User, id, note string) (*doc.Flag, error) {
+	flag, err := s.Get(ctx, user, id)
+	if err != nil {
+		return nil, err
+	}
+	if flag.Status != doc.FlagStatusAwaitingVerification && flag.Status != doc.FlagStatusResolved {
+		return nil, fmt.Errorf("flag %s is %s, not awaiting verification or resolved: %w", id, flag.Status, ErrInvalidInput)
+	}
+
+	flag.Status = doc.FlagStatusPending
+	if flag.AssignedTo != nil {
+		flag.Status = doc.FlagStatusInProgress
+	}
+	flag.ResolvedAt = nil
+	flag.ResolutionWarning = ""
+	if flag.PageVersion > 0 && flag.Document.ExternalID != "" {
+		if current, err := s.workspaceService.currentDocument(ctx, flag.Document); err != nil {
+			s.logger.WarnContext(ctx, "failed to check page version on reopen", "flag_id", flag.ID, "error", err)
+		} else {
+			flag.CheckedVersion = max(flag.CheckedVersion, current.Version)
+		}
+	}
+	flag.UpdatedAt = time.Now()
+	if err := s.flagRepo.Update(ctx, flag); err != nil {
+		return nil, fmt.Errorf("failed to update flag: %w", err)
+	}
+	s.logger.InfoContext(ctx, "flag reopened", "flag_id", flag.ID, "status", flag.Status, "user_id", user.ID)
+	s.writeBack(ctx, flag)
+
+	message := fmt.Sprintf("%s reopened the flag %q.", user.Name, flag.Title)
+	if note != "" {
+		message = fmt.Sprintf("%s reopened the flag %q: %s", user.Name, flag.Title, note)
+	}
+	s.notify(ctx, flag, user.ID, doc.NotificationFlagReopened, message)
+	return flag, nil
+}
+
+// notify sends a notification about flag to its creator and assignee, except
+// the user whose action caused it. Failures are logged; the action stands.
+func (s *FlagService) notify(ctx context.Context, flag *doc.Flag, actorID, kind, message string) {
+	recipients := []string{flag.CreatedBy}
+	if flag.AssignedTo != nil && *flag.AssignedTo != flag.CreatedBy {
+		recipients = append(recipients, *flag.AssignedTo)
+	}
+	for _, userID := range recipients {
+		if userID == actorID {
+			continue
+		}
+		n := &doc.Notification{UserID: userID, FlagID: flag.ID, Type: kind, Message: message}
+		if err := s.notificationRepo.Create(ctx, n); err != nil {
+			s.logger.WarnContext(ctx, "failed to notify user", "flag_id", flag.ID, "user_id", userID, "type", kind, "error", err)
+		}
+	}
+}
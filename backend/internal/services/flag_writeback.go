@@ -0,0 +1,275 @@
+package services
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+
+	"github.com/shaunpua/updoc/internal/doc"
+	"github.com/shaunpua/updoc/pkg/api"
+)
+
+// Write-back modes, set per workspace
+const (
+	// WriteBackOff leaves Confluence alone, the default
+	WriteBackOff = "off"
+	// WriteBackComment adds a footer comment to the page for each open flag
+	WriteBackComment = "comment"
+	// WriteBackLabel labels the page while it has open flags
+	WriteBackLabel = "label"
+)
+
+// DefaultWriteBackLabel is the label put on flagged pages in label mode
+const DefaultWriteBackLabel = "updoc-outdated"
+
+// Integration config keys holding a workspace's write-back settings
+const (
+	writeBackModeKey  = "write_back"
+	writeBackLabelKey = "write_back_label"
+)
+
+// labelPattern is what Confluence accepts as a label: lower case, without
+// spaces or the characters it reserves
+var labelPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_.-]{0,254}$`)
+
+// WriteBackSettings control whether flags on a workspace's pages are shown
+// to readers on Confluence
+type WriteBackSettings = api.WriteBackSettings
+
+// writeBackSettings reads a workspace's write-back settings from its
+// integration config
+func writeBackSettings(ws *doc.Workspace) WriteBackSettings {
+	settings := WriteBackSettings{Mode: WriteBackOff}
+	if mode, _ := ws.IntegrationConfig[writeBackModeKey].(string); mode == WriteBackComment || mode == WriteBackLabel {
+		settings.Mode = mode
+	}
+	if settings.Mode == WriteBackLabel {
+		settings.Label, _ = ws.IntegrationConfig[writeBackLabelKey].(string)
+		if settings.Label == "" {
+			settings.Label = DefaultWriteBackLabel
+		}
+	}
+	return settings
+}
+
+// SetWriteBack changes whether flags on the workspace's pages are written
+// back to Confluence. Only org admins may change it. Turning it off leaves
+// existing comments and labels where they are; comments already written
+// still follow their flags.
+func (s *WorkspaceService) SetWriteBack(ctx context.Context, user *doc.User, id string, settings WriteBackSettings) (*doc.Workspace, error) {
+	ws, err := s.Get(ctx, user, id)
+	if err != nil {
+		return nil, err
+	}
+	if user.Role != "admin" {
+		return nil, fmt.Errorf("only admins can change write-back: %w", ErrForbidden)
+	}
+	if ws.IntegrationType != "confluence" {
+		return nil, fmt.Errorf("write-back is not supported for %q workspaces: %w", ws.IntegrationType, ErrInvalidInput)
+	}
+
+	settings.Label = strings.ToLower(strings.TrimSpace(settings.Label))
+	switch settings.Mode {
+	case WriteBackOff, WriteBackComment:
+		if settings.Label != "" {
+			return nil, fmt.Errorf("label is only used in label mode: %w", ErrInvalidInput)
+		}
+	case WriteBackLabel:
+		if settings.Label != "" && !labelPattern.MatchString(settings.Label) {
+			return nil, fmt.Errorf("label %q is not a valid Confluence label: %w", settings.Label, ErrInvalidInput)
+		}
+		label := cmp.Or(settings.Label, DefaultWriteBackLabel)
+		for _, rule := range labelRules(ws) {
+			if rule.Action == LabelActionFlag && rule.Label == label {
+				return nil, fmt.Errorf("label %q opens flags by a label rule: %w", label, ErrInvalidInput)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("mode must be off, comment or label: %w", ErrInvalidInput)
+	}
+
+	config := make(map[string]interface{}, len(ws.IntegrationConfig)+2)
+	for k, v := range ws.IntegrationConfig {
+		config[k] = v
+	}
+	delete(config, writeBackModeKey)
+	delete(config, writeBackLabelKey)
+	if settings.Mode != WriteBackOff {
+		config[writeBackModeKey] = settings.Mode
+	}
+	if settings.Label != "" {
+		config[writeBackLabelKey] = settings.Label
+	}
+	if err := s.workspaceRepo.UpdateIntegration(ctx, ws.ID, config); err != nil {
+		return nil, fmt.Errorf("failed to save write-back settings: %w", err)
+	}
+	s.logger.InfoContext(ctx, "workspace write-back changed", "workspace_id", ws.ID, "mode", settings.Mode, "user_id", user.ID)
+
+	ws.IntegrationConfig = config
+	return RedactWorkspace(ws), nil
+}
+
+// writeBack shows flag's state on its Confluence page as the workspace's
+// write-back settings ask: its comment is added, rewritten or deleted, or the
+// page's label added or, once no flag on the page is open, removed. Failures
+// are logged; the flag change stands. Flags opened by a label rule are left
+// alone, as their label already shows on the page.
+func (s *FlagService) writeBack(ctx context.Context, flag *doc.Flag) {
+	if flag.SourceLabel != "" {
+		return
+	}
+	document := flag.Document
+	if document == nil {
+		var err error
+		if document, err = s.documentRepo.GetByID(ctx, flag.DocumentID); err != nil {
+			s.logger.WarnContext(ctx, "failed to load document for write-back", "flag_id", flag.ID, "error", err)
+			return
+		}
+	}
+	if document.ExternalID == "" || document.RemovedAt != nil {
+		return
+	}
+	ws, err := s.workspaceService.workspaceRepo.GetByID(ctx, document.WorkspaceID)
+	if err != nil {
+		s.logger.WarnContext(ctx, "failed to load workspace for write-back", "flag_id", flag.ID, "error", err)
+		return
+	}
+	if ws.IntegrationType != "confluence" {
+		return
+	}
+
+	settings := writeBackSettings(ws)
+	if settings.Mode == WriteBackComment || flag.ConfluenceCommentID != "" {
+		if err := s.syncComment(ctx, ws.OrgID, document, flag); err != nil {
+			s.logger.WarnContext(ctx, "failed to write flag back as a comment",
+				"flag_id", flag.ID, "page_id", document.ExternalID, "comment_id", flag.ConfluenceCommentID, "error", err)
+		}
+	}
+	if settings.Mode == WriteBackLabel {
+		if err := s.syncLabel(ctx, ws.OrgID, document, flag, settings.Label); err != nil {
+			s.logger.WarnContext(ctx, "failed to write flag back as a label",
+				"flag_id", flag.ID, "page_id", document.ExternalID, "label", settings.Label, "error", err)
+		}
+	}
+}
+
+// syncComment brings flag's comment in line with the flag, recording the
+// comment's ID on the flag when it is created or found deleted
+func (s *FlagService) syncComment(ctx context.Context, orgID string, document *doc.Document, flag *doc.Flag) error {
+	if flag.Status == doc.FlagStatusArchived {
+		if flag.ConfluenceCommentID == "" {
+			return nil
+		}
+		if err := s.confluenceService.DeletePageComment(ctx, orgID, flag.ConfluenceCommentID); err != nil {
+			return err
+		}
+		return s.setCommentID(ctx, flag, "")
+	}
+
+	body := s.commentBody(ctx, flag)
+	if flag.ConfluenceCommentID != "" {
+		err := s.confluenceService.UpdatePageComment(ctx, orgID, flag.ConfluenceCommentID, body)
+		if !errors.Is(err, ErrNotFound) {
+			return err
+		}
+		// Someone deleted the comment on Confluence; an open flag gets a new one
+		if !openFlag(flag) {
+			return s.setCommentID(ctx, flag, "")
+		}
+	} else if !openFlag(flag) {
+		return nil
+	}
+
+	commentID, err := s.confluenceService.AddPageComment(ctx, orgID, document.ExternalID, body)
+	if err != nil {
+		return err
+	}
+	return s.setCommentID(ctx, flag, commentID)
+}
+
+func (s *FlagService) setCommentID(ctx context.Context, flag *doc.Flag, commentID string) error {
+	flag.ConfluenceCommentID = commentID
+	if err := s.flagRepo.Update(ctx, flag); err != nil {
+		return fmt.Errorf("failed to record comment on flag: %w", err)
+	}
+	return nil
+}
+
+// syncLabel labels the page while flag is open, and removes the label when
+// flag closes unless another flag on the page is still open
+func (s *FlagService) syncLabel(ctx context.Context, orgID string, document *doc.Document, flag *doc.Flag, label string) error {
+	if openFlag(flag) {
+		return s.confluenceService.AddPageLabel(ctx, orgID, document.ExternalID, label)
+	}
+
+	others, err := s.flagRepo.GetByDocumentID(ctx, document.ID)
+	if err != nil {
+		return fmt.Errorf("failed to load flags: %w", err)
+	}
+	for _, other := range others {
+		if other.ID != flag.ID && openFlag(other) {
+			return nil
+		}
+	}
+	return s.confluenceService.RemovePageLabel(ctx, orgID, document.ExternalID, label)
+}
+
+// commentBody renders flag as a Confluence storage format comment: a warning
+// panel while it is open and a tip panel once resolved
+func (s *FlagService) commentBody(ctx context.Context, flag *doc.Flag) string {
+	var b strings.Builder
+	panel := func(macro, title string) {
+		fmt.Fprintf(&b, `<ac:structured-macro ac:name="%s"><ac:parameter ac:name="title">%s</ac:parameter><ac:rich-text-body>`,
+			macro, html.EscapeString(title))
+	}
+
+	if flag.Status == doc.FlagStatusResolved {
+		panel("tip", "Resolved in UpDoc")
+		fmt.Fprintf(&b, "<p><strong>%s</strong> was resolved.</p>", html.EscapeString(flag.Title))
+		if flag.Resolution != "" {
+			fmt.Fprintf(&b, "<p>%s</p>", html.EscapeString(flag.Resolution))
+		}
+	} else {
+		panel("warning", "Flagged as outdated in UpDoc")
+		fmt.Fprintf(&b, "<p><strong>%s</strong> (%s priority)</p>", html.EscapeString(flag.Title), html.EscapeString(flag.Priority))
+		if flag.Description != "" {
+			fmt.Fprintf(&b, "<p>%s</p>", html.EscapeString(flag.Description))
+		}
+
+		raised := "Raised by " + s.userName(ctx, flag.CreatedBy, flag.Creator)
+		if flag.AssignedTo != nil {
+			raised += ", assigned to " + s.userName(ctx, *flag.AssignedTo, flag.Assignee)
+		}
+		status := strings.ReplaceAll(flag.Status, "_", " ")
+		if flag.Status == doc.FlagStatusAwaitingVerification {
+			status = fmt.Sprintf("edited in version %d, awaiting verification", flag.CheckedVersion)
+		}
+		fmt.Fprintf(&b, "<p>%s. Status: %s.</p>", html.EscapeString(raised), html.EscapeString(status))
+	}
+	b.WriteString("</ac:rich-text-body></ac:structured-macro>")
+	return b.String()
+}
+
+// userName names a user, using loaded when it is still the user meant
+func (s *FlagService) userName(ctx context.Context, id string, loaded *doc.User) string {
+	if loaded != nil && loaded.ID == id {
+		return loaded.Name
+	}
+	if user, err := s.userRepo.GetByID(ctx, id); err == nil {
+		return user.Name
+	}
+	return "someone"
+}
+
+// openFlag reports whether flag still needs work
+func openFlag(flag *doc.Flag) bool {
+	switch flag.Status {
+	case doc.FlagStatusPending, doc.FlagStatusInProgress, doc.FlagStatusAwaitingVerification:
+		return true
+	}
+	return false
+}
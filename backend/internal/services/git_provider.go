@@ -0,0 +1,462 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shaunpua/updoc/internal/doc"
+	"github.com/shaunpua/updoc/internal/gitrepo"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Integration config keys of git workspaces
+const (
+	// gitRepositoryKey is the repository's URL, or its path under one of the
+	// server's local roots
+	gitRepositoryKey = "repository"
+	// gitBranchKey is the branch or other ref read, the default branch if unset
+	gitBranchKey = "branch"
+	// gitPathsKey lists globs picking the Markdown files that are documents
+	gitPathsKey = "paths"
+	// gitWebURLKey is where the repository's files are browsed at the same
+	// ref, such as https://github.com/acme/docs/blob/main; documents link
+	// there, and relative links in them resolve against it
+	gitWebURLKey = "web_url"
+	// gitOwnersKey maps CODEOWNERS handles such as @alice or @acme/docs to
+	// the emails of UpDoc users
+	gitOwnersKey = "owners"
+)
+
+var defaultGitPaths = []string{"**/*.md", "**/*.mdx"}
+
+// gitIndexFiles are the names of a directory's own page, which the documents
+// beside and below it hang under in the tree
+var gitIndexFiles = []string{"README.md", "readme.md", "index.md", "index.mdx", "_index.md"}
+
+// GitProvider serves git workspaces: the Markdown and MDX files of a
+// repository, read at the head of a branch. A document's ID is its path, its
+// Version the number of commits that changed it, and its owners come from
+// the repository's CODEOWNERS. Front matter gives titles and labels.
+type GitProvider struct {
+	git *gitrepo.Git
+
+	mu sync.Mutex
+	// indexes caches each workspace's documents by the commit they were
+	// read at, so paging through a sync reads the repository once
+	indexes map[string]*gitIndex
+}
+
+type gitIndex struct {
+	// settings are the integration settings the index was built with
+	settings  string
+	commit    string
+	documents []ProviderDocument
+	byPath    map[string]int
+}
+
+func NewGitProvider(git *gitrepo.Git) *GitProvider {
+	return &GitProvider{git: git, indexes: make(map[string]*gitIndex)}
+}
+
+func (p *GitProvider) Type() string { return "git" }
+
+func gitSetting(ws *doc.Workspace, key string) string {
+	value, _ := ws.IntegrationConfig[key].(string)
+	return strings.TrimSpace(value)
+}
+
+// gitGlobs returns the workspace's path globs, compiled
+func gitGlobs(ws *doc.Workspace) ([]*gitrepo.Glob, error) {
+	var patterns []string
+	switch v := ws.IntegrationConfig[gitPathsKey].(type) {
+	case string:
+		patterns = strings.Split(v, ",")
+	case []interface{}:
+		for _, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s must be a list of globs: %w", gitPathsKey, ErrInvalidInput)
+			}
+			patterns = append(patterns, s)
+		}
+	}
+	patterns = slices.DeleteFunc(patterns, func(s string) bool { return strings.TrimSpace(s) == "" })
+	if len(patterns) == 0 {
+		patterns = defaultGitPaths
+	}
+
+	globs := make([]*gitrepo.Glob, len(patterns))
+	for i, pattern := range patterns {
+		glob, err := gitrepo.CompileGlob(strings.TrimSpace(pattern))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %q is not a valid glob: %w", gitPathsKey, pattern, ErrInvalidInput)
+		}
+		globs[i] = glob
+	}
+	return globs, nil
+}
+
+// open opens the workspace's repository and resolves its branch
+func (p *GitProvider) open(ctx context.Context, ws *doc.Workspace) (*gitrepo.Repo, string, error) {
+	source := gitSetting(ws, gitRepositoryKey)
+	if source == "" {
+		return nil, "", fmt.Errorf("git integration not configured: %s is missing: %w", gitRepositoryKey, ErrInvalidInput)
+	}
+	repo, err := p.git.Open(ctx, source)
+	if err != nil {
+		return nil, "", gitFailure(err)
+	}
+	commit, err := repo.Resolve(ctx, gitSetting(ws, gitBranchKey))
+	if err != nil {
+		return nil, "", gitFailure(err)
+	}
+	return repo, commit, nil
+}
+
+// index returns the workspace's documents at the head of its branch,
+// reading the repository again only once the branch has moved
+func (p *GitProvider) index(ctx context.Context, ws *doc.Workspace) (*gitIndex, *gitrepo.Repo, error) {
+	globs, err := gitGlobs(ws)
+	if err != nil {
+		return nil, nil, err
+	}
+	repo, commit, err := p.open(ctx, ws)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	settings := fmt.Sprint(ws.IntegrationConfig[gitRepositoryKey], ws.IntegrationConfig[gitBranchKey], ws.IntegrationConfig[gitPathsKey], ws.IntegrationConfig[gitWebURLKey])
+	p.mu.Lock()
+	cached := p.indexes[ws.ID]
+	p.mu.Unlock()
+	if cached != nil && cached.commit == commit && cached.settings == settings {
+		return cached, repo, nil
+	}
+
+	idx, err := p.build(ctx, ws, repo, commit, globs)
+	if err != nil {
+		return nil, nil, gitFailure(err)
+	}
+	idx.settings = settings
+	p.mu.Lock()
+	p.indexes[ws.ID] = idx
+	p.mu.Unlock()
+	return idx, repo, nil
+}
+
+func (p *GitProvider) build(ctx context.Context, ws *doc.Workspace, repo *gitrepo.Repo, commit string, globs []*gitrepo.Glob) (*gitIndex, error) {
+	files, err := repo.Files(ctx, commit)
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, file := range files {
+		if isMarkdownFile(file) && slices.ContainsFunc(globs, func(g *gitrepo.Glob) bool { return g.Match(file) }) {
+			paths = append(paths, file)
+		}
+	}
+
+	contents, err := repo.ReadFiles(ctx, commit, append(slices.Clone(paths), gitrepo.CodeownersPaths...))
+	if err != nil {
+		return nil, err
+	}
+	var owners *gitrepo.Codeowners
+	for _, name := range gitrepo.CodeownersPaths {
+		if data, ok := contents[name]; ok {
+			owners = gitrepo.ParseCodeowners(data)
+			break
+		}
+	}
+	history, err := repo.History(ctx, commit, paths)
+	if err != nil {
+		return nil, err
+	}
+
+	idx := &gitIndex{
+		commit:    commit,
+		documents: make([]ProviderDocument, len(paths)),
+		byPath:    make(map[string]int, len(paths)),
+	}
+	for i, file := range paths {
+		idx.byPath[file] = i
+	}
+	for i, file := range paths {
+		md := gitrepo.ParseMarkdown(file, contents[file])
+		// Label rules compare lowercase labels, as Confluence keeps them
+		for j, label := range md.Labels {
+			md.Labels[j] = strings.ToLower(label)
+		}
+		d := ProviderDocument{
+			ID:       file,
+			Title:    md.Title,
+			URL:      gitDocumentURL(ws, file),
+			ParentID: gitParent(file, idx.byPath),
+			Labels:   md.Labels,
+			Owners:   append([]string{}, owners.Owners(file)...),
+		}
+		if h := history[file]; h != nil {
+			d.Version = h.Commits
+			d.EditedAt = &h.Time
+			d.EditedBy = h.Author
+		}
+		idx.documents[i] = d
+	}
+	return idx, nil
+}
+
+func isMarkdownFile(name string) bool {
+	ext := strings.ToLower(path.Ext(name))
+	return ext == ".md" || ext == ".mdx"
+}
+
+// gitParent returns the index file of the nearest directory above file that
+// has one, so a folder's README holds the documents in and below it
+func gitParent(file string, documents map[string]int) string {
+	dir := path.Dir(file)
+	if slices.Contains(gitIndexFiles, path.Base(file)) {
+		if dir == "." {
+			return ""
+		}
+		dir = path.Dir(dir)
+	}
+	for {
+		for _, name := range gitIndexFiles {
+			if candidate := path.Join(dir, name); candidate != file {
+				if _, ok := documents[candidate]; ok {
+					return candidate
+				}
+			}
+		}
+		if dir == "." {
+			return ""
+		}
+		dir = path.Dir(dir)
+	}
+}
+
+// gitDocumentURL links to the file on the workspace's web_url, or otherwise
+// names it within the repository, as repository#path or
+// repository#branch:path
+func gitDocumentURL(ws *doc.Workspace, file string) string {
+	if web := strings.TrimRight(gitSetting(ws, gitWebURLKey), "/"); web != "" {
+		segments := strings.Split(file, "/")
+		for i, s := range segments {
+			segments[i] = url.PathEscape(s)
+		}
+		return web + "/" + strings.Join(segments, "/")
+	}
+	if branch := gitSetting(ws, gitBranchKey); branch != "" {
+		return gitSetting(ws, gitRepositoryKey) + "#" + branch + ":" + file
+	}
+	return gitSetting(ws, gitRepositoryKey) + "#" + file
+}
+
+// ParseGitDocumentURL extracts the path and a title from the URL of a
+// document in a git workspace, as gitDocumentURL builds them
+func ParseGitDocumentURL(ws *doc.Workspace, rawURL string) (file, title string) {
+	if web := strings.TrimRight(gitSetting(ws, gitWebURLKey), "/"); web != "" {
+		if rest, ok := strings.CutPrefix(rawURL, web+"/"); ok {
+			file, _ = url.PathUnescape(rest)
+		}
+	} else if rest, ok := strings.CutPrefix(rawURL, gitSetting(ws, gitRepositoryKey)+"#"); ok {
+		file = rest
+		if branch := gitSetting(ws, gitBranchKey); branch != "" {
+			file = strings.TrimPrefix(rest, branch+":")
+		}
+	}
+	file, _, _ = strings.Cut(file, "#")
+	if file == "" || !isMarkdownFile(file) {
+		return "", ""
+	}
+	return file, strings.TrimSuffix(path.Base(file), path.Ext(file))
+}
+
+func (p *GitProvider) TestConnection(ctx context.Context, ws *doc.Workspace) (result *ConnectionTest, err error) {
+	ctx, span := tracer.Start(ctx, "GitProvider.TestConnection", trace.WithAttributes(attribute.String("updoc.workspace_id", ws.ID)))
+	defer func() {
+		if result != nil {
+			span.SetAttributes(attribute.Bool("git.success", result.Success))
+		}
+		finishSpan(span, err)
+	}()
+
+	result = &ConnectionTest{Provider: p.Type()}
+	idx, _, err := p.index(ctx, ws)
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	switch {
+	case err == nil:
+		result.Success = true
+		result.Message = "Connection successful"
+		result.Details = fmt.Sprintf("Found %d Markdown documents at commit %.12s", len(idx.documents), idx.commit)
+		if len(idx.documents) == 0 {
+			result.Warning = "No Markdown files match the workspace's " + gitPathsKey
+		}
+	case errors.Is(err, gitrepo.ErrNotAllowed):
+		result.Message = "Repository not allowed"
+		result.Details = err.Error()
+	case errors.Is(err, gitrepo.ErrNotFound):
+		result.Message = "Repository or branch not found"
+		result.Details = err.Error()
+	case errors.Is(err, ErrInvalidInput):
+		result.Message = "Git integration not configured"
+		result.Details = err.Error()
+	default:
+		result.Message = "Connection failed"
+		result.Details = err.Error()
+	}
+	return result, nil
+}
+
+// ListDocuments lists the repository's documents by path
+func (p *GitProvider) ListDocuments(ctx context.Context, ws *doc.Workspace, cursor string, limit int) (_ *ProviderDocumentList, err error) {
+	ctx, span := tracer.Start(ctx, "GitProvider.ListDocuments", trace.WithAttributes(attribute.String("updoc.workspace_id", ws.ID)))
+	defer func() { finishSpan(span, err) }()
+
+	start, err := offset(cursor)
+	if err != nil {
+		return nil, err
+	}
+	idx, _, err := p.index(ctx, ws)
+	if err != nil {
+		return nil, err
+	}
+	return gitPage(idx.documents, start, limit), nil
+}
+
+// SearchDocuments matches query against the documents' titles, paths and
+// text, ignoring case
+func (p *GitProvider) SearchDocuments(ctx context.Context, ws *doc.Workspace, query, cursor string, limit int) (_ *ProviderDocumentList, err error) {
+	ctx, span := tracer.Start(ctx, "GitProvider.SearchDocuments", trace.WithAttributes(attribute.String("updoc.workspace_id", ws.ID)))
+	defer func() { finishSpan(span, err) }()
+
+	start, err := offset(cursor)
+	if err != nil {
+		return nil, err
+	}
+	idx, repo, err := p.index(ctx, ws)
+	if err != nil {
+		return nil, err
+	}
+	paths := make([]string, len(idx.documents))
+	for i, d := range idx.documents {
+		paths[i] = d.ID
+	}
+	inText, err := repo.Grep(ctx, idx.commit, query, paths)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search documents: %w", gitFailure(err))
+	}
+
+	q := strings.ToLower(query)
+	var found []ProviderDocument
+	for _, d := range idx.documents {
+		if inText[d.ID] || strings.Contains(strings.ToLower(d.Title), q) || strings.Contains(strings.ToLower(d.ID), q) {
+			found = append(found, d)
+		}
+	}
+	return gitPage(found, start, limit), nil
+}
+
+// gitPage returns limit documents from start, with the offset after them as
+// the cursor
+func gitPage(documents []ProviderDocument, start, limit int) *ProviderDocumentList {
+	end := min(start+limit, len(documents))
+	if start >= end {
+		return &ProviderDocumentList{Documents: []ProviderDocument{}}
+	}
+	result := &ProviderDocumentList{Documents: documents[start:end]}
+	if end < len(documents) {
+		result.NextCursor = fmt.Sprint(end)
+	}
+	return result
+}
+
+func (p *GitProvider) Document(ctx context.Context, ws *doc.Workspace, id string) (_ *ProviderDocument, err error) {
+	ctx, span := tracer.Start(ctx, "GitProvider.Document", trace.WithAttributes(
+		attribute.String("updoc.workspace_id", ws.ID),
+		attribute.String("git.path", id),
+	))
+	defer func() { finishSpan(span, err) }()
+
+	idx, _, err := p.index(ctx, ws)
+	if err != nil {
+		return nil, err
+	}
+	i, ok := idx.byPath[id]
+	if !ok {
+		return nil, fmt.Errorf("git document %s: %w", id, ErrNotFound)
+	}
+	document := idx.documents[i]
+	return &document, nil
+}
+
+// Content renders the document's Markdown as HTML. Git documents have one
+// rendering, so representation must be empty.
+func (p *GitProvider) Content(ctx context.Context, ws *doc.Workspace, id, representation string) (_ *ConfluencePageContent, err error) {
+	ctx, span := tracer.Start(ctx, "GitProvider.Content", trace.WithAttributes(
+		attribute.String("updoc.workspace_id", ws.ID),
+		attribute.String("git.path", id),
+	))
+	defer func() { finishSpan(span, err) }()
+
+	if representation != "" {
+		return nil, fmt.Errorf("format is not supported for git documents: %w", ErrInvalidInput)
+	}
+	idx, repo, err := p.index(ctx, ws)
+	if err != nil {
+		return nil, err
+	}
+	i, ok := idx.byPath[id]
+	if !ok {
+		return nil, fmt.Errorf("git document %s: %w", id, ErrNotFound)
+	}
+	document := idx.documents[i]
+	data, err := repo.ReadFile(ctx, idx.commit, id)
+	if err != nil {
+		if errors.Is(err, gitrepo.ErrNotFound) {
+			return nil, fmt.Errorf("git document %s: %w", id, ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to read %s: %w", id, gitFailure(err))
+	}
+
+	md := gitrepo.ParseMarkdown(id, data)
+	var opts gitrepo.RenderOptions
+	if gitSetting(ws, gitWebURLKey) != "" {
+		opts.BaseURL = document.URL
+	}
+	return &ConfluencePageContent{
+		PageID:         id,
+		Title:          document.Title,
+		URL:            document.URL,
+		Version:        document.Version,
+		Representation: "markdown",
+		ModifiedAt:     document.EditedAt,
+		ModifiedBy:     document.EditedBy,
+		HTML:           gitrepo.RenderHTML(md.Body, opts),
+		Markdown:       md.Body,
+		FetchedAt:      time.Now(),
+	}, nil
+}
+
+// gitFailure marks repositories UpDoc may not read, and missing repositories
+// and branches, as invalid settings, and git failing or timing out as
+// unavailable
+func gitFailure(err error) error {
+	var cmdErr *gitrepo.CommandError
+	switch {
+	case errors.Is(err, gitrepo.ErrNotAllowed), errors.Is(err, gitrepo.ErrNotFound):
+		return fmt.Errorf("%w: %w", err, ErrInvalidInput)
+	case errors.As(err, &cmdErr):
+		return fmt.Errorf("%w: %w", ErrUnavailable, err)
+	}
+	return err
+}
@@ -0,0 +1,349 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/shaunpua/updoc/internal/config"
+	"github.com/shaunpua/updoc/internal/confluence/confluencetest"
+	"github.com/shaunpua/updoc/internal/doc"
+	"github.com/shaunpua/updoc/internal/gitrepo"
+)
+
+// gitCommit writes files into the repository at dir, creating it if need
+// be, and commits them as Alice, returning the commit
+func gitCommit(t *testing.T, dir, message string, files map[string]string) string {
+	t.Helper()
+	run := func(args ...string) string {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(),
+			"GIT_CONFIG_GLOBAL=/dev/null", "GIT_CONFIG_NOSYSTEM=1",
+			"GIT_AUTHOR_NAME=Alice Park", "GIT_AUTHOR_EMAIL=alice@acme.example.com",
+			"GIT_COMMITTER_NAME=Alice Park", "GIT_COMMITTER_EMAIL=alice@acme.example.com",
+		)
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	if _, err := os.Stat(filepath.Join(dir, ".git")); errors.Is(err, os.ErrNotExist) {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		run("init", "--quiet", "--initial-branch=main")
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	run("add", "-A")
+	run("commit", "--quiet", "-m", message)
+	return run("rev-parse", "HEAD")
+}
+
+// docsRepo is the files of a docs repository with a CODEOWNERS file
+var docsRepo = map[string]string{
+	"README.md": "# Acme\n",
+	"docs/README.md": "---\ntitle: Developer Docs\ntags: [Public]\n---\n" +
+		"Start with the [guide](guide.md).\n",
+	"docs/guide.md":        "# Getting Started\n\nCall `CreateFlag` to flag a page.\n",
+	"docs/api/auth.mdx":    "import Tabs from './tabs'\n\n# Auth\n",
+	"docs/api/tokens.md":   "No heading here.\n",
+	"docs/notes.txt":       "Not Markdown\n",
+	"vendor/lib/README.md": "# Vendored\n",
+	".github/CODEOWNERS":   "* @acme/docs\n/docs/api/ ben@acme.example.com\n",
+}
+
+// newGitProvider returns a provider reading repositories under root
+func newGitProvider(t *testing.T, root string) *GitProvider {
+	t.Helper()
+	cfg := config.Default().Git
+	cfg.CacheDir = t.TempDir()
+	cfg.LocalRoots = []string{root}
+	return NewGitProvider(gitrepo.New(cfg, slog.New(slog.NewTextHandler(io.Discard, nil))))
+}
+
+func gitWorkspace(repository string, settings map[string]interface{}) *doc.Workspace {
+	config := map[string]interface{}{gitRepositoryKey: repository}
+	for k, v := range settings {
+		config[k] = v
+	}
+	return &doc.Workspace{ID: "ws-git", IntegrationType: "git", IntegrationConfig: config}
+}
+
+func TestGitListDocuments(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "docs")
+	gitCommit(t, dir, "Add docs", docsRepo)
+	gitCommit(t, dir, "Expand the guide", map[string]string{"docs/guide.md": "# Getting Started\n\nMore.\n"})
+	p := newGitProvider(t, root)
+	ctx := context.Background()
+
+	t.Run("every Markdown file", func(t *testing.T) {
+		list, err := p.ListDocuments(ctx, gitWorkspace(dir, nil), "", 100)
+		if err != nil {
+			t.Fatalf("ListDocuments: %v", err)
+		}
+		byPath := make(map[string]ProviderDocument)
+		for _, d := range list.Documents {
+			byPath[d.ID] = d
+		}
+		want := []string{"README.md", "docs/README.md", "docs/api/auth.mdx", "docs/api/tokens.md", "docs/guide.md", "vendor/lib/README.md"}
+		if got := slices.Sorted(maps.Keys(byPath)); !slices.Equal(got, want) {
+			t.Fatalf("documents = %v, want %v", got, want)
+		}
+
+		tests := []struct {
+			path, title, parent string
+			owners              []string
+			version             int
+		}{
+			{"README.md", "Acme", "", []string{"@acme/docs"}, 1},
+			{"docs/README.md", "Developer Docs", "README.md", []string{"@acme/docs"}, 1},
+			{"docs/guide.md", "Getting Started", "docs/README.md", []string{"@acme/docs"}, 2},
+			{"docs/api/auth.mdx", "Auth", "docs/README.md", []string{"ben@acme.example.com"}, 1},
+			{"docs/api/tokens.md", "tokens", "docs/README.md", []string{"ben@acme.example.com"}, 1},
+		}
+		for _, tt := range tests {
+			d := byPath[tt.path]
+			if d.Title != tt.title || d.ParentID != tt.parent || !slices.Equal(d.Owners, tt.owners) || d.Version != tt.version {
+				t.Errorf("%s = %+v, want title %q, parent %q, owners %v, version %d", tt.path, d, tt.title, tt.parent, tt.owners, tt.version)
+			}
+		}
+		if labels := byPath["docs/README.md"].Labels; !slices.Equal(labels, []string{"public"}) {
+			t.Errorf("front matter labels = %v, want [public]", labels)
+		}
+		if d := byPath["docs/guide.md"]; d.URL != dir+"#docs/guide.md" || d.EditedBy != "Alice Park" {
+			t.Errorf("guide URL %q, edited by %q", d.URL, d.EditedBy)
+		}
+	})
+
+	t.Run("paths and paging", func(t *testing.T) {
+		ws := gitWorkspace(dir, map[string]interface{}{gitPathsKey: "docs/**"})
+		var paths []string
+		for cursor := ""; ; {
+			list, err := p.ListDocuments(ctx, ws, cursor, 3)
+			if err != nil {
+				t.Fatalf("ListDocuments: %v", err)
+			}
+			for _, d := range list.Documents {
+				paths = append(paths, d.ID)
+			}
+			if cursor = list.NextCursor; cursor == "" {
+				break
+			}
+		}
+		slices.Sort(paths)
+		if want := []string{"docs/README.md", "docs/api/auth.mdx", "docs/api/tokens.md", "docs/guide.md"}; !slices.Equal(paths, want) {
+			t.Errorf("documents = %v, want %v", paths, want)
+		}
+	})
+
+	t.Run("branch", func(t *testing.T) {
+		if _, err := p.ListDocuments(ctx, gitWorkspace(dir, map[string]interface{}{gitBranchKey: "missing"}), "", 100); !errors.Is(err, ErrInvalidInput) {
+			t.Errorf("ListDocuments on a missing branch = %v, want ErrInvalidInput", err)
+		}
+	})
+}
+
+func TestGitContent(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "docs")
+	gitCommit(t, dir, "Add docs", docsRepo)
+	p := newGitProvider(t, root)
+	ctx := context.Background()
+	ws := gitWorkspace(dir, map[string]interface{}{gitWebURLKey: "https://github.com/acme/docs/blob/main/"})
+
+	content, err := p.Content(ctx, ws, "docs/README.md", "")
+	if err != nil {
+		t.Fatalf("Content: %v", err)
+	}
+	if content.URL != "https://github.com/acme/docs/blob/main/docs/README.md" || content.Title != "Developer Docs" {
+		t.Errorf("Content = %+v", content)
+	}
+	if strings.Contains(content.Markdown, "title:") {
+		t.Errorf("Markdown = %q, want the front matter stripped", content.Markdown)
+	}
+	if want := `<a href="https://github.com/acme/docs/blob/main/docs/guide.md">guide</a>`; !strings.Contains(content.HTML, want) {
+		t.Errorf("HTML = %q, want the relative link resolved against web_url", content.HTML)
+	}
+	if file, title := ParseGitDocumentURL(ws, content.URL); file != "docs/README.md" || title != "README" {
+		t.Errorf("ParseGitDocumentURL = %q, %q", file, title)
+	}
+
+	if _, err := p.Content(ctx, ws, "docs/notes.txt", ""); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Content of a file that isn't a document = %v, want ErrNotFound", err)
+	}
+	if _, err := p.Content(ctx, ws, "docs/guide.md", "storage"); !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("Content in storage format = %v, want ErrInvalidInput", err)
+	}
+	if _, err := p.Document(ctx, ws, "../README.md"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Document outside the repository = %v, want ErrNotFound", err)
+	}
+}
+
+func TestGitRepositoryNotAllowed(t *testing.T) {
+	root := t.TempDir()
+	outside := filepath.Join(t.TempDir(), "secret")
+	gitCommit(t, outside, "Add secrets", map[string]string{"passwords.md": "# Passwords\n"})
+	if err := os.Symlink(outside, filepath.Join(root, "link")); err != nil {
+		t.Fatal(err)
+	}
+	p := newGitProvider(t, root)
+	ctx := context.Background()
+
+	for _, repository := range []string{
+		outside,
+		filepath.Join(root, "link"),
+		filepath.Join(root, "..", filepath.Base(filepath.Dir(outside)), "secret"),
+		"--upload-pack=touch /tmp/pwned",
+		"https://github.com/acme/docs.git",
+	} {
+		ws := gitWorkspace(repository, nil)
+		if _, err := p.ListDocuments(ctx, ws, "", 100); !errors.Is(err, ErrInvalidInput) || !errors.Is(err, gitrepo.ErrNotAllowed) {
+			t.Errorf("ListDocuments of %q = %v, want ErrNotAllowed", repository, err)
+		}
+		result, err := p.TestConnection(ctx, ws)
+		if err != nil || result.Success || result.Message != "Repository not allowed" {
+			t.Errorf("TestConnection of %q = %+v, %v", repository, result, err)
+		}
+	}
+}
+
+func TestSyncGitWorkspace(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "docs")
+	gitCommit(t, dir, "Add docs", docsRepo)
+	env := newTestEnv(t, func(cfg *config.Config, _ *confluencetest.Options) {
+		cfg.Git.LocalRoots = []string{root}
+	})
+	ctx := context.Background()
+	ben := env.addUser(t, "ben@acme.example.com", "Ben Ortiz")
+
+	if _, err := env.workspaces.Create(ctx, ben, doc.CreateWorkspaceRequest{Name: "Docs", IntegrationType: "git"}); !errors.Is(err, ErrForbidden) {
+		t.Errorf("Create by a member = %v, want ErrForbidden", err)
+	}
+	ws, err := env.workspaces.Create(ctx, env.admin, doc.CreateWorkspaceRequest{
+		Name:            "Docs",
+		IntegrationType: "git",
+		IntegrationConfig: map[string]interface{}{
+			gitRepositoryKey: dir,
+			gitPathsKey:      "docs/**",
+			gitOwnersKey:     map[string]interface{}{"@acme/docs": env.admin.Email},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	result, err := env.workspaces.Sync(ctx, env.admin, ws.ID)
+	if err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	if result.Total != 4 || result.Created != 4 {
+		t.Errorf("Sync = %+v, want 4 documents created", result)
+	}
+	documents, err := env.store.Documents().GetByExternalIDs(ctx, []string{ws.ID}, []string{"docs/guide.md", "docs/api/auth.mdx"})
+	if err != nil || len(documents) != 2 {
+		t.Fatalf("documents = %v, %v", documents, err)
+	}
+	for _, d := range documents {
+		want := env.admin.ID
+		if d.ExternalID == "docs/api/auth.mdx" {
+			want = ben.ID
+		}
+		if d.OwnerID != want {
+			t.Errorf("%s owner = %q, want %q", d.ExternalID, d.OwnerID, want)
+		}
+	}
+
+	// A deleted file leaves the workspace at the next sync
+	if err := os.Remove(filepath.Join(dir, "docs", "api", "tokens.md")); err != nil {
+		t.Fatal(err)
+	}
+	gitCommit(t, dir, "Remove tokens", nil)
+	if result, err = env.workspaces.Sync(ctx, env.admin, ws.ID); err != nil {
+		t.Fatalf("second Sync: %v", err)
+	}
+	if result.Total != 3 {
+		t.Errorf("second Sync = %+v, want 3 documents", result)
+	}
+}
+
+func TestSyncGitSharedRepository(t *testing.T) {
+	root := t.TempDir()
+	work := filepath.Join(root, "work")
+	gitCommit(t, work, "Add docs", docsRepo)
+	bare := filepath.Join(root, "docs.git")
+	if out, err := exec.Command("git", "clone", "--quiet", "--bare", work, bare).CombinedOutput(); err != nil {
+		t.Fatalf("git clone: %v\n%s", err, out)
+	}
+	env := newTestEnv(t, func(cfg *config.Config, _ *confluencetest.Options) {
+		cfg.Git.LocalRoots = []string{root}
+	})
+	ctx := context.Background()
+	other, _ := env.addOrg(t, "Globex", "admin@globex.example.com")
+
+	// Both orgs track the repository; each gets its own documents
+	workspaces := map[*doc.User]*doc.Workspace{}
+	for _, admin := range []*doc.User{env.admin, other} {
+		ws, err := env.workspaces.Create(ctx, admin, doc.CreateWorkspaceRequest{
+			Name:              "Docs",
+			IntegrationType:   "git",
+			IntegrationConfig: map[string]interface{}{gitRepositoryKey: bare, gitPathsKey: "docs/**"},
+		})
+		if err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		result, err := env.workspaces.Sync(ctx, admin, ws.ID)
+		if err != nil {
+			t.Fatalf("Sync: %v", err)
+		}
+		if result.Total != 4 || result.Created != 4 {
+			t.Errorf("Sync = %+v, want 4 documents created", result)
+		}
+		workspaces[admin] = ws
+	}
+
+	guide := func(ws *doc.Workspace) *doc.Document {
+		documents, err := env.store.Documents().GetByExternalIDs(ctx, []string{ws.ID}, []string{"docs/guide.md"})
+		if err != nil || len(documents) != 1 {
+			t.Fatalf("guide in %s = %v, %v", ws.ID, documents, err)
+		}
+		return documents[0]
+	}
+	mine, theirs := guide(workspaces[env.admin]), guide(workspaces[other])
+	if mine.ID == theirs.ID || mine.URL != theirs.URL {
+		t.Errorf("guides = %s at %s and %s at %s, want separate documents at one URL", mine.ID, mine.URL, theirs.ID, theirs.URL)
+	}
+
+	// Resyncing keeps the first org's documents its own, and flagging the
+	// URL flags the caller's copy
+	result, err := env.workspaces.Sync(ctx, env.admin, workspaces[env.admin].ID)
+	if err != nil || result.Created != 0 || result.Updated != 4 {
+		t.Errorf("resync = %+v, %v, want 4 documents updated", result, err)
+	}
+	flag, err := env.flags.Create(ctx, other, doc.CreateFlagRequest{DocumentURL: mine.URL, Title: "Guide is stale", Priority: doc.PriorityLow})
+	if err != nil {
+		t.Fatalf("Create flag: %v", err)
+	}
+	if flag.DocumentID != theirs.ID {
+		t.Errorf("flag document = %s, want the other org's %s", flag.DocumentID, theirs.ID)
+	}
+}
@@ -0,0 +1,234 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/shaunpua/updoc/internal/doc"
+	"github.com/shaunpua/updoc/pkg/api"
+)
+
+// Label rule actions
+const (
+	// LabelActionTrack tracks pages with the label as documents. Once a
+	// workspace has a track rule, a sync only adds pages that carry one of
+	// its rules' labels.
+	LabelActionTrack = "track"
+	// LabelActionFlag opens a flag when the label appears on a page and
+	// resolves it when the label is removed
+	LabelActionFlag = "flag"
+)
+
+// labelRulesKey is where a workspace's label rules are kept in its
+// integration config
+const labelRulesKey = "label_rules"
+
+// LabelRule maps a Confluence label to what UpDoc does with pages carrying it
+type LabelRule = api.LabelRule
+
+// labelRules reads a workspace's label rules from its integration config
+func labelRules(ws *doc.Workspace) []LabelRule {
+	raw, ok := ws.IntegrationConfig[labelRulesKey]
+	if !ok {
+		return nil
+	}
+	// Rules come back from the database as generic JSON
+	encoded, err := json.Marshal(raw)
+	if err != nil {
+		return nil
+	}
+	var rules []LabelRule
+	if err := json.Unmarshal(encoded, &rules); err != nil {
+		return nil
+	}
+	return rules
+}
+
+// tracksPage reports whether a sync should add a page with labels as a
+// document: any page when there are no track rules, otherwise one carrying
+// a label some rule acts on
+func tracksPage(rules []LabelRule, labels []string) bool {
+	tracking := false
+	for _, rule := range rules {
+		if rule.Action == LabelActionTrack {
+			tracking = true
+		}
+		if slices.Contains(labels, rule.Label) {
+			return true
+		}
+	}
+	return !tracking
+}
+
+// hasFlagRules reports whether any rule opens flags
+func hasFlagRules(rules []LabelRule) bool {
+	return slices.ContainsFunc(rules, func(rule LabelRule) bool { return rule.Action == LabelActionFlag })
+}
+
+// SetLabelRules replaces the workspace's label rules. Only org admins may
+// change them. They take effect at the next sync or label webhook.
+func (s *WorkspaceService) SetLabelRules(ctx context.Context, user *doc.User, id string, rules []LabelRule) (*doc.Workspace, error) {
+	ws, err := s.Get(ctx, user, id)
+	if err != nil {
+		return nil, err
+	}
+	if user.Role != "admin" {
+		return nil, fmt.Errorf("only admins can change label rules: %w", ErrForbidden)
+	}
+	// Git documents take their labels from front matter tags
+	if ws.IntegrationType != "confluence" && ws.IntegrationType != "git" {
+		return nil, fmt.Errorf("label rules are not supported for %q workspaces: %w", ws.IntegrationType, ErrInvalidInput)
+	}
+
+	writeBack := writeBackSettings(ws)
+	seen := make(map[LabelRule]bool, len(rules))
+	for i := range rules {
+		rule := &rules[i]
+		rule.Label = strings.ToLower(strings.TrimSpace(rule.Label))
+		if !labelPattern.MatchString(rule.Label) {
+			return nil, fmt.Errorf("label %q is not a valid Confluence label: %w", rule.Label, ErrInvalidInput)
+		}
+		switch rule.Action {
+		case LabelActionTrack:
+			if rule.Priority != "" {
+				return nil, fmt.Errorf("priority is only used by flag rules: %w", ErrInvalidInput)
+			}
+		case LabelActionFlag:
+			if rule.Priority == "" {
+				rule.Priority = doc.PriorityMedium
+			}
+			if !doc.ValidPriority(rule.Priority) {
+				return nil, fmt.Errorf("priority must be one of urgent, high, medium, low: %w", ErrInvalidInput)
+			}
+			// UpDoc labels flagged pages itself in label mode; flagging on
+			// that label would keep flags open forever
+			if writeBack.Mode == WriteBackLabel && rule.Label == writeBack.Label {
+				return nil, fmt.Errorf("label %q is the workspace's write-back label: %w", rule.Label, ErrInvalidInput)
+			}
+		default:
+			return nil, fmt.Errorf("action must be track or flag: %w", ErrInvalidInput)
+		}
+		key := LabelRule{Label: rule.Label, Action: rule.Action}
+		if seen[key] {
+			return nil, fmt.Errorf("more than one %s rule for label %q: %w", rule.Action, rule.Label, ErrInvalidInput)
+		}
+		seen[key] = true
+	}
+
+	config := make(map[string]interface{}, len(ws.IntegrationConfig)+1)
+	for k, v := range ws.IntegrationConfig {
+		config[k] = v
+	}
+	delete(config, labelRulesKey)
+	if len(rules) > 0 {
+		config[labelRulesKey] = rules
+	}
+	if err := s.workspaceRepo.UpdateIntegration(ctx, ws.ID, config); err != nil {
+		return nil, fmt.Errorf("failed to save label rules: %w", err)
+	}
+	s.logger.InfoContext(ctx, "workspace label rules changed", "workspace_id", ws.ID, "rules", len(rules), "user_id", user.ID)
+
+	ws.IntegrationConfig = config
+	return RedactWorkspace(ws), nil
+}
+
+// applyLabelRules acts on the flag rules whose label was added to or removed
+// from document's page, before being its labels until now. A flag is opened
+// when a rule's label is on the page without an open flag from that rule,
+// unless the label was already there and its flag was closed by hand; flags
+// from a rule whose label is gone are resolved. Rule flags are raised by the
+// org's first admin and assigned to the document's owner, and aren't written
+// back to Confluence: the label already shows readers the page is flagged.
+func (s *WorkspaceService) applyLabelRules(ctx context.Context, ws *doc.Workspace, document *doc.Document, before []string) (opened, resolved int, err error) {
+	rules := labelRules(ws)
+	if !hasFlagRules(rules) {
+		return 0, 0, nil
+	}
+	flags, err := s.flagRepo.GetByDocumentID(ctx, document.ID)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to load flags: %w", err)
+	}
+
+	now := time.Now()
+	for _, rule := range rules {
+		if rule.Action != LabelActionFlag {
+			continue
+		}
+		var open []*doc.Flag
+		raised := false
+		for _, flag := range flags {
+			if flag.SourceLabel != rule.Label {
+				continue
+			}
+			raised = true
+			if openFlag(flag) {
+				open = append(open, flag)
+			}
+		}
+
+		present := slices.Contains(document.Labels, rule.Label)
+		switch {
+		case present && len(open) == 0 && (!raised || !slices.Contains(before, rule.Label)):
+			creator, err := s.ruleCreator(ctx, ws.OrgID)
+			if err != nil {
+				return opened, resolved, err
+			}
+			flag := &doc.Flag{
+				DocumentID:  document.ID,
+				CreatedBy:   creator,
+				Title:       fmt.Sprintf("Labelled %s in Confluence", rule.Label),
+				Description: fmt.Sprintf("Opened because the page was labelled %q. Removing the label resolves this flag.", rule.Label),
+				Priority:    rule.Priority,
+				Status:      doc.FlagStatusPending,
+				SourceLabel: rule.Label,
+				CreatedAt:   now,
+				UpdatedAt:   now,
+			}
+			if document.OwnerID != "" {
+				owner := document.OwnerID
+				flag.AssignedTo = &owner
+			}
+			if err := s.flagRepo.Create(ctx, flag); err != nil {
+				return opened, resolved, fmt.Errorf("failed to create flag: %w", err)
+			}
+			opened++
+			s.logger.InfoContext(ctx, "flag opened by label", "flag_id", flag.ID, "document_id", document.ID, "label", rule.Label)
+		case !present:
+			for _, flag := range open {
+				flag.Status = doc.FlagStatusResolved
+				flag.Resolution = fmt.Sprintf("Label %q was removed from the page", rule.Label)
+				flag.ResolvedAt = &now
+				flag.UpdatedAt = now
+				if err := s.flagRepo.Update(ctx, flag); err != nil {
+					return opened, resolved, fmt.Errorf("failed to update flag %s: %w", flag.ID, err)
+				}
+				resolved++
+				s.logger.InfoContext(ctx, "flag resolved by label removal", "flag_id", flag.ID, "document_id", document.ID, "label", rule.Label)
+			}
+		}
+	}
+	return opened, resolved, nil
+}
+
+// ruleCreator returns who raises flags opened by label rules: the org's
+// first admin, or its first user if it has no admin
+func (s *WorkspaceService) ruleCreator(ctx context.Context, orgID string) (string, error) {
+	users, err := s.userRepo.GetByOrgID(ctx, orgID)
+	if err != nil {
+		return "", fmt.Errorf("failed to load users: %w", err)
+	}
+	if len(users) == 0 {
+		return "", fmt.Errorf("organization %s has no users to raise flags", orgID)
+	}
+	slices.SortFunc(users, func(a, b *doc.User) int { return a.CreatedAt.Compare(b.CreatedAt) })
+	for _, user := range users {
+		if user.Role == "admin" {
+			return user.ID, nil
+		}
+	}
+	return users[0].ID, nil
+}
@@ -0,0 +1,72 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/shaunpua/updoc/internal/doc"
+)
+
+const (
+	defaultNotificationLimit = 50
+	maxNotificationLimit     = 200
+)
+
+type NotificationService struct {
+	notificationRepo doc.NotificationRepository
+	logger           *slog.Logger
+}
+
+func NewNotificationService(notificationRepo doc.NotificationRepository, logger *slog.Logger) *NotificationService {
+	return &NotificationService{
+		notificationRepo: notificationRepo,
+		logger:           logger,
+	}
+}
+
+// List returns the user's newest notifications, only unread ones if
+// unreadOnly. Unread verification requests carry the actions that answer them.
+func (s *NotificationService) List(ctx context.Context, user *doc.User, unreadOnly bool, limit int) ([]*doc.Notification, error) {
+	if limit <= 0 {
+		limit = defaultNotificationLimit
+	}
+	if limit > maxNotificationLimit {
+		limit = maxNotificationLimit
+	}
+
+	notifications, err := s.notificationRepo.GetByUserID(ctx, user.ID, unreadOnly, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list notifications: %w", err)
+	}
+	for _, n := range notifications {
+		if n.Type == doc.NotificationVerificationRequested && n.ReadAt == nil {
+			n.Actions = []doc.NotificationAction{
+				{Label: "Confirm fix", Method: http.MethodPost, Path: "/flags/" + n.FlagID + "/confirm"},
+				{Label: "Reopen", Method: http.MethodPost, Path: "/flags/" + n.FlagID + "/reopen"},
+			}
+		}
+	}
+	return notifications, nil
+}
+
+// MarkRead marks one of the user's notifications read
+func (s *NotificationService) MarkRead(ctx context.Context, user *doc.User, id string) error {
+	n, err := s.notificationRepo.GetByID(ctx, id)
+	if err != nil || n.UserID != user.ID {
+		return fmt.Errorf("notification %s: %w", id, ErrNotFound)
+	}
+	if err := s.notificationRepo.MarkAsRead(ctx, id); err != nil {
+		return fmt.Errorf("failed to mark notification read: %w", err)
+	}
+	return nil
+}
+
+// MarkAllRead marks all of the user's notifications read
+func (s *NotificationService) MarkAllRead(ctx context.Context, user *doc.User) error {
+	if err := s.notificationRepo.MarkAllAsRead(ctx, user.ID); err != nil {
+		return fmt.Errorf("failed to mark notifications read: %w", err)
+	}
+	return nil
+}
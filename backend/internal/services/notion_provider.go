@@ -0,0 +1,296 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/shaunpua/updoc/internal/doc"
+	"github.com/shaunpua/updoc/internal/notion"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Integration config keys of notion workspaces
+const (
+	// notionTokenKey holds the workspace's internal integration token. It is
+	// encrypted at rest and never returned by the API.
+	notionTokenKey = "notion_token"
+	// notionDatabaseKey optionally limits the workspace to one database's
+	// pages; without it every page shared with the integration is a document
+	notionDatabaseKey = "database_id"
+)
+
+// notionContentDepth is how many levels of nested blocks are rendered
+const notionContentDepth = 3
+
+// NotionProvider serves notion workspaces through the Notion API, each
+// with its own integration token. Notion pages have no version numbers, so a
+// page's Version is its last edit time in Unix seconds; Notion rounds edit
+// times to the minute, so edits in the same minute as the last check aren't
+// seen until the page is edited again.
+type NotionProvider struct {
+	client *notion.Client
+}
+
+func NewNotionProvider(client *notion.Client) *NotionProvider {
+	return &NotionProvider{client: client}
+}
+
+func (p *NotionProvider) Type() string { return "notion" }
+
+// integration returns the client acting with ws's token
+func (p *NotionProvider) integration(ws *doc.Workspace) (*notion.Integration, error) {
+	token, _ := ws.IntegrationConfig[notionTokenKey].(string)
+	if token == "" {
+		return nil, fmt.Errorf("notion integration not configured: %s is missing: %w", notionTokenKey, ErrInvalidInput)
+	}
+	return p.client.Integration(token), nil
+}
+
+func notionDatabase(ws *doc.Workspace) string {
+	id, _ := ws.IntegrationConfig[notionDatabaseKey].(string)
+	return id
+}
+
+func (p *NotionProvider) TestConnection(ctx context.Context, ws *doc.Workspace) (result *ConnectionTest, err error) {
+	ctx, span := tracer.Start(ctx, "NotionProvider.TestConnection", trace.WithAttributes(attribute.String("updoc.workspace_id", ws.ID)))
+	defer func() {
+		if result != nil {
+			span.SetAttributes(attribute.Bool("notion.success", result.Success))
+		}
+		finishSpan(span, err)
+	}()
+
+	result = &ConnectionTest{Provider: p.Type()}
+	api, err := p.integration(ws)
+	if err != nil {
+		result.Message = "Notion integration not configured"
+		result.Details = "Set the workspace's " + notionTokenKey + " to an internal integration token"
+		return result, nil
+	}
+
+	me, err := api.Me(ctx)
+	if err == nil && notionDatabase(ws) != "" {
+		_, err = api.Database(ctx, notionDatabase(ws))
+		if notion.IsNotFound(err) {
+			result.Message = "Database not found"
+			result.Details = fmt.Sprintf("Database %s doesn't exist or isn't shared with the integration", notionDatabase(ws))
+			return result, nil
+		}
+	}
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	var apiErr *notion.APIError
+	switch {
+	case err == nil:
+		result.Success = true
+		result.Message = "Connection successful"
+		result.Details = "Authenticated with Notion"
+		if me.Bot != nil && me.Bot.WorkspaceName != "" {
+			result.Details += " workspace " + me.Bot.WorkspaceName
+		}
+		if me.Name != "" {
+			result.Details += " as " + me.Name
+		}
+	case errors.As(err, &apiErr) && apiErr.Unauthorized():
+		result.Message = "Authentication failed"
+		result.Details = err.Error()
+	default:
+		result.Message = "Connection failed"
+		result.Details = err.Error()
+	}
+	return result, nil
+}
+
+// ListDocuments lists the pages of the workspace's database, or every page
+// shared with the integration, most recently edited first
+func (p *NotionProvider) ListDocuments(ctx context.Context, ws *doc.Workspace, cursor string, limit int) (_ *ProviderDocumentList, err error) {
+	ctx, span := tracer.Start(ctx, "NotionProvider.ListDocuments", trace.WithAttributes(
+		attribute.String("updoc.workspace_id", ws.ID),
+		attribute.String("notion.database_id", notionDatabase(ws)),
+	))
+	defer func() { finishSpan(span, err) }()
+
+	api, err := p.integration(ws)
+	if err != nil {
+		return nil, err
+	}
+	var list *notion.List[notion.Page]
+	if db := notionDatabase(ws); db != "" {
+		list, err = api.QueryDatabase(ctx, db, cursor, limit)
+	} else {
+		list, err = api.Search(ctx, notion.SearchQuery{Cursor: cursor, PageSize: limit})
+	}
+	if err != nil {
+		return nil, notionFailure(err)
+	}
+	return notionList(list), nil
+}
+
+// SearchDocuments matches query against page titles, which is all Notion's
+// search covers. Pages outside the workspace's database are left out.
+func (p *NotionProvider) SearchDocuments(ctx context.Context, ws *doc.Workspace, query, cursor string, limit int) (_ *ProviderDocumentList, err error) {
+	ctx, span := tracer.Start(ctx, "NotionProvider.SearchDocuments", trace.WithAttributes(attribute.String("updoc.workspace_id", ws.ID)))
+	defer func() { finishSpan(span, err) }()
+
+	api, err := p.integration(ws)
+	if err != nil {
+		return nil, err
+	}
+	list, err := api.Search(ctx, notion.SearchQuery{Query: query, Cursor: cursor, PageSize: limit})
+	if err != nil {
+		return nil, fmt.Errorf("failed to search pages: %w", notionFailure(err))
+	}
+	result := notionList(list)
+	if db := notionDatabase(ws); db != "" {
+		kept := result.Documents[:0]
+		for i, page := range list.Results {
+			if page.Parent.DatabaseID == db {
+				kept = append(kept, result.Documents[i])
+			}
+		}
+		result.Documents = kept
+	}
+	return result, nil
+}
+
+func (p *NotionProvider) Document(ctx context.Context, ws *doc.Workspace, id string) (_ *ProviderDocument, err error) {
+	ctx, span := tracer.Start(ctx, "NotionProvider.Document", trace.WithAttributes(
+		attribute.String("updoc.workspace_id", ws.ID),
+		attribute.String("notion.page_id", id),
+	))
+	defer func() { finishSpan(span, err) }()
+
+	api, err := p.integration(ws)
+	if err != nil {
+		return nil, err
+	}
+	page, err := api.Page(ctx, id)
+	if err != nil {
+		return nil, notionPageFailure(id, err)
+	}
+	document := notionDocument(page)
+	return &document, nil
+}
+
+// Content renders the page's blocks, nested ones a few levels deep. Notion
+// has one rendering, so representation must be empty.
+func (p *NotionProvider) Content(ctx context.Context, ws *doc.Workspace, id, representation string) (_ *ConfluencePageContent, err error) {
+	ctx, span := tracer.Start(ctx, "NotionProvider.Content", trace.WithAttributes(
+		attribute.String("updoc.workspace_id", ws.ID),
+		attribute.String("notion.page_id", id),
+	))
+	defer func() { finishSpan(span, err) }()
+
+	if representation != "" {
+		return nil, fmt.Errorf("format is not supported for notion pages: %w", ErrInvalidInput)
+	}
+	api, err := p.integration(ws)
+	if err != nil {
+		return nil, err
+	}
+	page, err := api.Page(ctx, id)
+	if err != nil {
+		return nil, notionPageFailure(id, err)
+	}
+	blocks, err := api.Blocks(ctx, id, notionContentDepth)
+	if err != nil {
+		return nil, notionPageFailure(id, err)
+	}
+
+	document := notionDocument(page)
+	html, markdown := notion.Render(blocks)
+	return &ConfluencePageContent{
+		PageID:         document.ID,
+		Title:          document.Title,
+		URL:            document.URL,
+		Version:        document.Version,
+		Representation: "blocks",
+		ModifiedAt:     document.EditedAt,
+		ModifiedBy:     document.EditedBy,
+		HTML:           html,
+		Markdown:       markdown,
+		FetchedAt:      time.Now(),
+	}, nil
+}
+
+func notionList(list *notion.List[notion.Page]) *ProviderDocumentList {
+	result := &ProviderDocumentList{Documents: make([]ProviderDocument, len(list.Results))}
+	for i := range list.Results {
+		result.Documents[i] = notionDocument(&list.Results[i])
+	}
+	if list.HasMore {
+		result.NextCursor = list.NextCursor
+	}
+	return result
+}
+
+func notionDocument(page *notion.Page) ProviderDocument {
+	edited := page.LastEditedTime
+	document := ProviderDocument{
+		ID:       page.ID,
+		Title:    page.Title(),
+		URL:      page.URL,
+		ParentID: page.Parent.ID(),
+		Version:  int(edited.Unix()),
+		EditedAt: &edited,
+		EditedBy: page.LastEditedBy.Name,
+		Removed:  page.Archived || page.InTrash,
+	}
+	if document.EditedBy == "" {
+		document.EditedBy = page.LastEditedBy.ID
+	}
+	return document
+}
+
+// notionFailure marks Notion being down or rate limiting as unavailable
+func notionFailure(err error) error {
+	var apiErr *notion.APIError
+	var transportErr *notion.TransportError
+	switch {
+	case errors.As(err, &transportErr):
+		return fmt.Errorf("%w: %w", ErrUnavailable, err)
+	case errors.As(err, &apiErr) && (apiErr.StatusCode == http.StatusTooManyRequests || apiErr.StatusCode >= 500):
+		return fmt.Errorf("%w: %w", ErrUnavailable, err)
+	}
+	return err
+}
+
+// notionPageFailure maps a failed page fetch like pageFailure does for
+// Confluence
+func notionPageFailure(pageID string, err error) error {
+	if notion.IsNotFound(err) {
+		return fmt.Errorf("notion page %s: %w", pageID, ErrNotFound)
+	}
+	return fmt.Errorf("failed to fetch notion page %s: %w", pageID, notionFailure(err))
+}
+
+// notionIDPattern matches the 32 hex digit page ID that ends a Notion URL's
+// last path segment
+var notionIDPattern = regexp.MustCompile(`(?:^|-)([0-9a-fA-F]{32})$`)
+
+// ParseNotionPageURL extracts the page ID and a best-effort title from a
+// Notion page URL such as https://www.notion.so/acme/API-Guide-0123456789abcdef0123456789abcdef
+func ParseNotionPageURL(rawURL string) (pageID, title string) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", ""
+	}
+	segment := u.Path[strings.LastIndex(u.Path, "/")+1:]
+	m := notionIDPattern.FindStringSubmatch(segment)
+	if m == nil {
+		return "", ""
+	}
+	hex := strings.ToLower(m[1])
+	pageID = hex[:8] + "-" + hex[8:12] + "-" + hex[12:16] + "-" + hex[16:20] + "-" + hex[20:]
+	title = strings.ReplaceAll(strings.TrimSuffix(segment, m[0]), "-", " ")
+	return pageID, title
+}
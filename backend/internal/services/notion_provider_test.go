@@ -0,0 +1,328 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/shaunpua/updoc/internal/config"
+	"github.com/shaunpua/updoc/internal/confluence/confluencetest"
+	"github.com/shaunpua/updoc/internal/doc"
+	"github.com/shaunpua/updoc/internal/notion"
+	"github.com/shaunpua/updoc/internal/notion/notiontest"
+)
+
+const notionToken = "secret_integration"
+
+// newNotionProvider starts a fake Notion seeded with its demo pages and
+// returns a provider calling it
+func newNotionProvider(t *testing.T) (*NotionProvider, *notiontest.Server) {
+	t.Helper()
+	srv := notiontest.NewServer(notiontest.Options{Token: notionToken})
+	t.Cleanup(srv.Close)
+	cfg := config.Default().Notion
+	cfg.BaseURL = srv.URL()
+	return NewNotionProvider(notion.New(cfg, slog.New(slog.NewTextHandler(io.Discard, nil)))), srv
+}
+
+func notionWorkspace(token, databaseID string) *doc.Workspace {
+	config := map[string]interface{}{notionTokenKey: token}
+	if databaseID != "" {
+		config[notionDatabaseKey] = databaseID
+	}
+	return &doc.Workspace{ID: "ws-notion", IntegrationType: "notion", IntegrationConfig: config}
+}
+
+// fakeNotion calls one of the fake's control routes and returns the page it
+// describes, or every page for GET /_fake/pages
+func fakeNotion[T any](t *testing.T, srv *notiontest.Server, method, path string, spec *notiontest.PageSpec) T {
+	t.Helper()
+	var body io.Reader
+	if spec != nil {
+		encoded, err := json.Marshal(spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body = bytes.NewReader(encoded)
+	}
+	req, err := http.NewRequest(method, srv.URL()+path, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		t.Fatalf("%s %s = HTTP %d", method, path, resp.StatusCode)
+	}
+	var out T
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+// notionIDs maps the fake's page and database titles to their IDs
+func notionIDs(t *testing.T, srv *notiontest.Server) map[string]string {
+	t.Helper()
+	ids := make(map[string]string)
+	for _, p := range fakeNotion[[]notiontest.PageInfo](t, srv, http.MethodGet, "/_fake/pages", nil) {
+		ids[p.Title] = p.ID
+	}
+	return ids
+}
+
+// listAll pages through ListDocuments limit documents at a time, returning
+// the titles listed and how many requests it took
+func listAll(t *testing.T, p *NotionProvider, ws *doc.Workspace, limit int) ([]string, int) {
+	t.Helper()
+	var titles []string
+	calls := 0
+	for cursor := ""; ; {
+		list, err := p.ListDocuments(context.Background(), ws, cursor, limit)
+		if err != nil {
+			t.Fatalf("ListDocuments: %v", err)
+		}
+		calls++
+		for _, d := range list.Documents {
+			if !d.Removed {
+				titles = append(titles, d.Title)
+			}
+		}
+		if list.NextCursor == "" {
+			return titles, calls
+		}
+		cursor = list.NextCursor
+	}
+}
+
+func TestNotionListDocuments(t *testing.T) {
+	p, srv := newNotionProvider(t)
+	ids := notionIDs(t, srv)
+
+	tests := []struct {
+		name     string
+		database string
+		limit    int
+		want     []string
+		calls    int
+	}{
+		{"every shared page", "", 100, []string{"API Guide", "Deployment Runbook", "Onboarding", "Team Handbook"}, 1},
+		{"paged", "", 3, []string{"API Guide", "Deployment Runbook", "Onboarding", "Team Handbook"}, 2},
+		{"one database", ids["Engineering Docs"], 100, []string{"API Guide", "Deployment Runbook"}, 1},
+		{"one database paged", ids["Engineering Docs"], 1, []string{"API Guide", "Deployment Runbook"}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			titles, calls := listAll(t, p, notionWorkspace(notionToken, tt.database), tt.limit)
+			slices.Sort(titles)
+			if !slices.Equal(titles, tt.want) {
+				t.Errorf("titles = %v, want %v", titles, tt.want)
+			}
+			if calls != tt.calls {
+				t.Errorf("requests = %d, want %d", calls, tt.calls)
+			}
+		})
+	}
+}
+
+func TestNotionDocument(t *testing.T) {
+	p, srv := newNotionProvider(t)
+	ctx := context.Background()
+	ws := notionWorkspace(notionToken, "")
+	ids := notionIDs(t, srv)
+	onboarding := ids["Onboarding"]
+
+	before, err := p.Document(ctx, ws, onboarding)
+	if err != nil {
+		t.Fatalf("Document: %v", err)
+	}
+	if before.Title != "Onboarding" || before.ParentID != ids["Team Handbook"] || before.Version == 0 {
+		t.Errorf("Document = %+v", before)
+	}
+
+	// An edit moves the version on; trashing marks the page removed
+	text := "- Get a laptop\n- Pair with a buddy"
+	fakeNotion[notiontest.PageInfo](t, srv, http.MethodPatch, "/_fake/pages/"+onboarding, &notiontest.PageSpec{Text: &text})
+	edited, err := p.Document(ctx, ws, onboarding)
+	if err != nil {
+		t.Fatalf("Document after editing: %v", err)
+	}
+	if edited.Version <= before.Version {
+		t.Errorf("version after editing = %d, want more than %d", edited.Version, before.Version)
+	}
+	content, err := p.Content(ctx, ws, onboarding, "")
+	if err != nil {
+		t.Fatalf("Content: %v", err)
+	}
+	if !strings.Contains(content.Markdown, "- Pair with a buddy") || !strings.Contains(content.HTML, "<li>") {
+		t.Errorf("Content = %q / %q, want the edited list", content.Markdown, content.HTML)
+	}
+	if _, err := p.Content(ctx, ws, onboarding, "storage"); !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("Content in storage format = %v, want ErrInvalidInput", err)
+	}
+
+	fakeNotion[notiontest.PageInfo](t, srv, http.MethodDelete, "/_fake/pages/"+onboarding, nil)
+	trashed, err := p.Document(ctx, ws, onboarding)
+	if err != nil {
+		t.Fatalf("Document after trashing: %v", err)
+	}
+	if !trashed.Removed {
+		t.Error("trashed page isn't marked removed")
+	}
+
+	if _, err := p.Document(ctx, ws, "00000000-0000-4000-8000-000000000000"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Document for an unknown page = %v, want ErrNotFound", err)
+	}
+}
+
+func TestNotionTokenErrors(t *testing.T) {
+	p, srv := newNotionProvider(t)
+	ctx := context.Background()
+
+	t.Run("missing token", func(t *testing.T) {
+		ws := notionWorkspace("", "")
+		if _, err := p.ListDocuments(ctx, ws, "", 10); !errors.Is(err, ErrInvalidInput) {
+			t.Errorf("ListDocuments = %v, want ErrInvalidInput", err)
+		}
+		result, err := p.TestConnection(ctx, ws)
+		if err != nil || result.Success || result.Message != "Notion integration not configured" {
+			t.Errorf("TestConnection = %+v, %v", result, err)
+		}
+	})
+
+	t.Run("rejected token", func(t *testing.T) {
+		ws := notionWorkspace("secret_revoked", "")
+		_, err := p.ListDocuments(ctx, ws, "", 10)
+		var apiErr *notion.APIError
+		if !errors.As(err, &apiErr) || !apiErr.Unauthorized() || errors.Is(err, ErrUnavailable) {
+			t.Errorf("ListDocuments = %v, want an unauthorized error that isn't an outage", err)
+		}
+		result, err := p.TestConnection(ctx, ws)
+		if err != nil || result.Success || result.Message != "Authentication failed" {
+			t.Errorf("TestConnection = %+v, %v", result, err)
+		}
+	})
+
+	t.Run("valid token", func(t *testing.T) {
+		result, err := p.TestConnection(ctx, notionWorkspace(notionToken, notionIDs(t, srv)["Engineering Docs"]))
+		if err != nil || !result.Success || !strings.Contains(result.Details, "Acme") {
+			t.Errorf("TestConnection = %+v, %v", result, err)
+		}
+	})
+
+	t.Run("unshared database", func(t *testing.T) {
+		result, err := p.TestConnection(ctx, notionWorkspace(notionToken, "00000000-0000-4000-8000-000000000000"))
+		if err != nil || result.Success || result.Message != "Database not found" {
+			t.Errorf("TestConnection = %+v, %v", result, err)
+		}
+	})
+}
+
+func TestSyncNotionWorkspace(t *testing.T) {
+	srv := notiontest.NewServer(notiontest.Options{Token: notionToken})
+	t.Cleanup(srv.Close)
+	env := newTestEnv(t, func(cfg *config.Config, _ *confluencetest.Options) {
+		cfg.Notion.BaseURL = srv.URL()
+	})
+	ctx := context.Background()
+
+	ws, err := env.workspaces.Create(ctx, env.admin, doc.CreateWorkspaceRequest{
+		Name:              "Notion",
+		IntegrationType:   "notion",
+		IntegrationConfig: map[string]interface{}{notionTokenKey: notionToken},
+	})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if _, ok := ws.IntegrationConfig[notionTokenKey]; ok {
+		t.Error("Create returned the integration token")
+	}
+
+	result, err := env.workspaces.Sync(ctx, env.admin, ws.ID)
+	if err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	if result.Total != 4 || result.Created != 4 {
+		t.Errorf("Sync = %+v, want 4 pages created", result)
+	}
+
+	// A renamed page keeps its document, though its URL changes
+	ids := notionIDs(t, srv)
+	title := "Onboarding Guide"
+	fakeNotion[notiontest.PageInfo](t, srv, http.MethodPatch, "/_fake/pages/"+ids["Onboarding"], &notiontest.PageSpec{Title: &title})
+	if result, err = env.workspaces.Sync(ctx, env.admin, ws.ID); err != nil {
+		t.Fatalf("second Sync: %v", err)
+	}
+	if result.Created != 0 || result.Updated != 4 {
+		t.Errorf("second Sync = %+v, want every page updated", result)
+	}
+	documents, err := env.store.Documents().GetByExternalIDs(ctx, []string{ws.ID}, []string{ids["Onboarding"]})
+	if err != nil || len(documents) != 1 || documents[0].Title != title {
+		t.Errorf("renamed document = %v, %v", documents, err)
+	}
+}
+
+func TestSyncNotionSharedWorkspace(t *testing.T) {
+	srv := notiontest.NewServer(notiontest.Options{Token: notionToken})
+	t.Cleanup(srv.Close)
+	env := newTestEnv(t, func(cfg *config.Config, _ *confluencetest.Options) {
+		cfg.Notion.BaseURL = srv.URL()
+	})
+	ctx := context.Background()
+	other, _ := env.addOrg(t, "Globex", "admin@globex.example.com")
+	ids := notionIDs(t, srv)
+
+	// Both orgs connect the same Notion workspace; each gets its own
+	// documents, including after a page is renamed
+	admins := []*doc.User{env.admin, other}
+	var workspaces []*doc.Workspace
+	for _, admin := range admins {
+		ws, err := env.workspaces.Create(ctx, admin, doc.CreateWorkspaceRequest{
+			Name:              "Notion",
+			IntegrationType:   "notion",
+			IntegrationConfig: map[string]interface{}{notionTokenKey: notionToken},
+		})
+		if err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		workspaces = append(workspaces, ws)
+	}
+	syncBoth := func(created int) {
+		t.Helper()
+		for i, admin := range admins {
+			result, err := env.workspaces.Sync(ctx, admin, workspaces[i].ID)
+			if err != nil {
+				t.Fatalf("Sync: %v", err)
+			}
+			if result.Total != 4 || result.Created != created {
+				t.Errorf("Sync of %s = %+v, want %d pages created", workspaces[i].ID, result, created)
+			}
+		}
+	}
+	syncBoth(4)
+	title := "Onboarding Guide"
+	fakeNotion[notiontest.PageInfo](t, srv, http.MethodPatch, "/_fake/pages/"+ids["Onboarding"], &notiontest.PageSpec{Title: &title})
+	syncBoth(0)
+
+	var onboarding []string
+	for _, ws := range workspaces {
+		documents, err := env.store.Documents().GetByExternalIDs(ctx, []string{ws.ID}, []string{ids["Onboarding"]})
+		if err != nil || len(documents) != 1 || documents[0].Title != title || documents[0].WorkspaceID != ws.ID {
+			t.Fatalf("Onboarding in %s = %v, %v", ws.ID, documents, err)
+		}
+		onboarding = append(onboarding, documents[0].ID)
+	}
+	if onboarding[0] == onboarding[1] {
+		t.Errorf("both orgs share the Onboarding document %s", onboarding[0])
+	}
+}
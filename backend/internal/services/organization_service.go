@@ -3,63 +3,67 @@ package services
 import (
 	"context"
 	"fmt"
+	"log/slog"
 	"strings"
 	"time"
 
+	"github.com/shaunpua/updoc/internal/confluence"
 	"github.com/shaunpua/updoc/internal/doc"
+	"github.com/shaunpua/updoc/pkg/api"
 )
 
 type OrganizationService struct {
-	orgRepo  doc.OrganizationRepository
-	userRepo doc.UserRepository
+	orgRepo       doc.OrganizationRepository
+	userRepo      doc.UserRepository
+	workspaceRepo doc.WorkspaceRepository
+	logger        *slog.Logger
 }
 
-func NewOrganizationService(orgRepo doc.OrganizationRepository, userRepo doc.UserRepository) *OrganizationService {
+func NewOrganizationService(orgRepo doc.OrganizationRepository, userRepo doc.UserRepository, workspaceRepo doc.WorkspaceRepository, logger *slog.Logger) *OrganizationService {
 	return &OrganizationService{
-		orgRepo:  orgRepo,
-		userRepo: userRepo,
+		orgRepo:       orgRepo,
+		userRepo:      userRepo,
+		workspaceRepo: workspaceRepo,
+		logger:        logger,
 	}
 }
 
-type CreateOrgRequest struct {
-	Name      string `json:"name" validate:"required,min=2,max=100"`
-	UserName  string `json:"user_name" validate:"required,min=2,max=100"`
-	UserEmail string `json:"user_email" validate:"required,email"`
-	
-	// Optional Confluence Integration
-	ConfluenceBaseURL  string `json:"confluence_base_url,omitempty"`
-	ConfluenceEmail    string `json:"confluence_email,omitempty"`
-	ConfluenceToken    string `json:"confluence_token,omitempty"`
-	ConfluenceSpaceKey string `json:"confluence_space_key,omitempty"`
-}
-
-type CreateOrgResponse struct {
-	Organization *doc.Organization `json:"organization"`
-	User         *doc.User         `json:"user"`
-}
+type (
+	CreateOrgRequest  = api.CreateOrgRequest
+	CreateOrgResponse = api.CreateOrgResponse
+	AddUserResponse   = api.AddUserResponse
+)
 
 func (s *OrganizationService) CreateWithUser(ctx context.Context, req CreateOrgRequest) (*CreateOrgResponse, error) {
 	// Generate slug from organization name
 	slug := generateSlug(req.Name)
 
+	authMode, err := confluence.ParseAuthMode(req.ConfluenceAuthMode)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", err, ErrInvalidInput)
+	}
+
 	// Check if organization already exists
-	existing, err := s.orgRepo.GetBySlug(slug)
+	existing, err := s.orgRepo.GetBySlug(ctx, slug)
 	if err == nil && existing != nil {
 		return nil, fmt.Errorf("organization with slug '%s' already exists", slug)
 	}
 
 	// Create organization
 	org := &doc.Organization{
-		Name:               req.Name,
-		Slug:               slug,
-		CreatedAt:          time.Now(),
-		ConfluenceBaseURL:  req.ConfluenceBaseURL,
-		ConfluenceEmail:    req.ConfluenceEmail,
-		ConfluenceToken:    req.ConfluenceToken,
-		ConfluenceSpaceKey: req.ConfluenceSpaceKey,
+		Organization: api.Organization{
+			Name:               req.Name,
+			Slug:               slug,
+			CreatedAt:          time.Now(),
+			ConfluenceBaseURL:  req.ConfluenceBaseURL,
+			ConfluenceAuthMode: string(authMode),
+			ConfluenceEmail:    req.ConfluenceEmail,
+			ConfluenceSpaceKey: req.ConfluenceSpaceKey,
+		},
+		ConfluenceToken: req.ConfluenceToken,
 	}
 
-	if err := s.orgRepo.Create(org); err != nil {
+	if err := s.orgRepo.Create(ctx, org); err != nil {
 		return nil, fmt.Errorf("failed to create organization: %w", err)
 	}
 
@@ -73,18 +77,44 @@ func (s *OrganizationService) CreateWithUser(ctx context.Context, req CreateOrgR
 		CreatedAt: time.Now(),
 	}
 
-	if err := s.userRepo.Create(user); err != nil {
+	if err := s.userRepo.Create(ctx, user); err != nil {
 		return nil, fmt.Errorf("failed to create user: %w", err)
 	}
 
-	return &CreateOrgResponse{
-		Organization: org,
+	token, err := issueAPIToken(ctx, s.userRepo, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &CreateOrgResponse{
+		Organization: &org.Organization,
 		User:         user,
-	}, nil
+		APIToken:     token,
+	}
+
+	// Give Confluence-backed orgs a default workspace so flagged pages have somewhere to live
+	if org.ConfluenceBaseURL != "" {
+		ws := &doc.Workspace{
+			OrgID:           org.ID,
+			Name:            "Confluence",
+			IntegrationType: "confluence",
+			IntegrationConfig: map[string]interface{}{
+				"space_key": org.ConfluenceSpaceKey,
+			},
+			IsDefault: true,
+		}
+		if err := s.workspaceRepo.Create(ctx, ws); err != nil {
+			return nil, fmt.Errorf("failed to create default workspace: %w", err)
+		}
+		resp.Workspace = ws
+	}
+
+	s.logger.InfoContext(ctx, "organization created", "org_id", org.ID, "slug", org.Slug, "admin_id", user.ID)
+	return resp, nil
 }
 
 func (s *OrganizationService) GetBySlug(ctx context.Context, slug string) (*doc.Organization, error) {
-	org, err := s.orgRepo.GetBySlug(slug)
+	org, err := s.orgRepo.GetBySlug(ctx, slug)
 	if err != nil {
 		return nil, fmt.Errorf("organization not found: %w", err)
 	}
@@ -93,13 +123,13 @@ func (s *OrganizationService) GetBySlug(ctx context.Context, slug string) (*doc.
 
 func (s *OrganizationService) AddUser(ctx context.Context, orgID, email, name, role string) (*doc.User, error) {
 	// Check if organization exists
-	org, err := s.orgRepo.GetByID(orgID)
+	org, err := s.orgRepo.GetByID(ctx, orgID)
 	if err != nil {
 		return nil, fmt.Errorf("organization not found: %w", err)
 	}
 
 	// Check if user already exists
-	existing, err := s.userRepo.GetByEmail(email)
+	existing, err := s.userRepo.GetByEmail(ctx, email)
 	if err == nil && existing != nil {
 		return nil, fmt.Errorf("user with email '%s' already exists", email)
 	}
@@ -114,13 +144,37 @@ func (s *OrganizationService) AddUser(ctx context.Context, orgID, email, name, r
 		CreatedAt: time.Now(),
 	}
 
-	if err := s.userRepo.Create(user); err != nil {
+	if err := s.userRepo.Create(ctx, user); err != nil {
 		return nil, fmt.Errorf("failed to create user: %w", err)
 	}
 
 	return user, nil
 }
 
+// AddUserWithToken adds a user on behalf of an org admin and issues their first API token
+func (s *OrganizationService) AddUserWithToken(ctx context.Context, admin *doc.User, orgID, email, name, role string) (*AddUserResponse, error) {
+	if admin.OrgID != orgID || admin.Role != "admin" {
+		return nil, fmt.Errorf("only admins of this organization can add users: %w", ErrForbidden)
+	}
+	if role == "" {
+		role = "member"
+	}
+	if role != "admin" && role != "member" {
+		return nil, fmt.Errorf("role must be admin or member: %w", ErrInvalidInput)
+	}
+
+	user, err := s.AddUser(ctx, orgID, email, name, role)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := issueAPIToken(ctx, s.userRepo, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &AddUserResponse{User: user, APIToken: token}, nil
+}
+
 // Helper function to generate URL-friendly slug
 func generateSlug(name string) string {
 	slug := strings.ToLower(name)
@@ -0,0 +1,121 @@
+package services
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/shaunpua/updoc/internal/doc"
+)
+
+// PageWatcher periodically checks the pages behind open flags for new
+// versions through their workspace's provider, moving flags whose page was
+// edited to awaiting verification
+type PageWatcher struct {
+	flagRepo      doc.FlagRepository
+	workspaceRepo doc.WorkspaceRepository
+	providers     *Providers
+	flagService   *FlagService
+	interval      time.Duration
+	timeout       time.Duration
+	logger        *slog.Logger
+}
+
+// NewPageWatcher checks every interval, giving each page at most timeout
+func NewPageWatcher(flagRepo doc.FlagRepository, workspaceRepo doc.WorkspaceRepository, providers *Providers, flagService *FlagService, interval, timeout time.Duration, logger *slog.Logger) *PageWatcher {
+	return &PageWatcher{
+		flagRepo:      flagRepo,
+		workspaceRepo: workspaceRepo,
+		providers:     providers,
+		flagService:   flagService,
+		interval:      interval,
+		timeout:       timeout,
+		logger:        logger.With("component", "page_watcher"),
+	}
+}
+
+// Run checks immediately and then every interval until ctx is cancelled
+func (w *PageWatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		w.check(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (w *PageWatcher) check(ctx context.Context) {
+	flags, err := w.flagRepo.GetWatched(ctx)
+	if err != nil {
+		w.logger.WarnContext(ctx, "failed to list watched flags", "error", err)
+		return
+	}
+
+	// Each page is fetched once, however many flags it has, and only if one
+	// of them hasn't seen a version as new as it
+	type page struct {
+		document *doc.Document
+		seen     int
+	}
+	var pages []*page
+	byDocument := make(map[string]*page)
+	for _, flag := range flags {
+		if flag.Document == nil || flag.Document.ExternalID == "" || flag.Document.RemovedAt != nil {
+			continue
+		}
+		p, ok := byDocument[flag.DocumentID]
+		if !ok {
+			p = &page{document: flag.Document, seen: max(flag.PageVersion, flag.CheckedVersion)}
+			byDocument[flag.DocumentID] = p
+			pages = append(pages, p)
+		}
+		p.seen = min(p.seen, max(flag.PageVersion, flag.CheckedVersion))
+	}
+
+	workspaces := make(map[string]*doc.Workspace)
+	moved := 0
+	for _, p := range pages {
+		if ctx.Err() != nil {
+			return
+		}
+		ws, ok := workspaces[p.document.WorkspaceID]
+		if !ok {
+			var err error
+			if ws, err = w.workspaceRepo.GetByID(ctx, p.document.WorkspaceID); err != nil {
+				w.logger.WarnContext(ctx, "failed to load workspace", "workspace_id", p.document.WorkspaceID, "error", err)
+				continue
+			}
+			workspaces[p.document.WorkspaceID] = ws
+		}
+		provider, err := w.providers.For(ws)
+		if err != nil {
+			continue
+		}
+
+		checkCtx, cancel := context.WithTimeout(ctx, w.timeout)
+		current, err := provider.Document(checkCtx, ws, p.document.ExternalID)
+		cancel()
+		if err != nil {
+			w.logger.WarnContext(ctx, "failed to check page version", "document_id", p.document.ID, "page_id", p.document.ExternalID, "error", err)
+			continue
+		}
+		if current.Version <= p.seen {
+			continue
+		}
+
+		n, err := w.flagService.PageEdited(ctx, p.document, providerVersion(current))
+		if err != nil {
+			w.logger.WarnContext(ctx, "failed to record page edit", "document_id", p.document.ID, "error", err)
+		}
+		moved += n
+	}
+
+	if moved > 0 {
+		w.logger.InfoContext(ctx, "flagged pages edited", "pages", len(pages), "flags_awaiting_verification", moved)
+	}
+}
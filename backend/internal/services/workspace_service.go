@@ -0,0 +1,460 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/shaunpua/updoc/internal/doc"
+	"github.com/shaunpua/updoc/internal/metrics"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// syncPageSize is how many documents are fetched per request during a sync
+const syncPageSize = 50
+
+type WorkspaceService struct {
+	workspaceRepo     doc.WorkspaceRepository
+	documentRepo      doc.DocumentRepository
+	flagRepo          doc.FlagRepository
+	userRepo          doc.UserRepository
+	confluenceService *ConfluenceService
+	providers         *Providers
+	logger            *slog.Logger
+}
+
+func NewWorkspaceService(workspaceRepo doc.WorkspaceRepository, documentRepo doc.DocumentRepository, flagRepo doc.FlagRepository, userRepo doc.UserRepository, confluenceService *ConfluenceService, providers *Providers, logger *slog.Logger) *WorkspaceService {
+	return &WorkspaceService{
+		workspaceRepo:     workspaceRepo,
+		documentRepo:      documentRepo,
+		flagRepo:          flagRepo,
+		userRepo:          userRepo,
+		confluenceService: confluenceService,
+		providers:         providers,
+		logger:            logger,
+	}
+}
+
+// adminConfigKeys are the integration config keys only admins set, through
+// the endpoint that validates them, rather than when creating a workspace
+var adminConfigKeys = map[string]string{
+	writeBackModeKey:  "PUT /workspaces/{id}/write-back",
+	writeBackLabelKey: "PUT /workspaces/{id}/write-back",
+	labelRulesKey:     "PUT /workspaces/{id}/label-rules",
+	webhookSecretKey:  "POST /workspaces/{id}/webhook",
+}
+
+// Create adds a workspace to the user's organization. Only admins can create
+// git workspaces. Write-back, label rule and webhook settings can't be given
+// here; admins set them once it exists.
+func (s *WorkspaceService) Create(ctx context.Context, user *doc.User, req doc.CreateWorkspaceRequest) (*doc.Workspace, error) {
+	if strings.TrimSpace(req.Name) == "" {
+		return nil, fmt.Errorf("name is required: %w", ErrInvalidInput)
+	}
+	if req.IntegrationType == "" {
+		req.IntegrationType = "confluence"
+	}
+	if !s.providers.Supports(req.IntegrationType) {
+		return nil, fmt.Errorf("%q workspaces are not supported: %w", req.IntegrationType, ErrInvalidInput)
+	}
+	// A git workspace makes the server clone or read a repository
+	if req.IntegrationType == "git" && user.Role != "admin" {
+		return nil, fmt.Errorf("only admins can create git workspaces: %w", ErrForbidden)
+	}
+	for _, key := range slices.Sorted(maps.Keys(req.IntegrationConfig)) {
+		if endpoint, ok := adminConfigKeys[key]; ok {
+			return nil, fmt.Errorf("%s can only be set by an admin with %s: %w", key, endpoint, ErrInvalidInput)
+		}
+	}
+
+	ws := &doc.Workspace{
+		OrgID:             user.OrgID,
+		Name:              req.Name,
+		IntegrationType:   req.IntegrationType,
+		IntegrationConfig: req.IntegrationConfig,
+		IsDefault:         req.IsDefault,
+		CreatedAt:         time.Now(),
+	}
+	if err := s.workspaceRepo.Create(ctx, ws); err != nil {
+		return nil, fmt.Errorf("failed to create workspace: %w", err)
+	}
+	return RedactWorkspace(ws), nil
+}
+
+// List returns the workspaces of the user's organization, default first
+func (s *WorkspaceService) List(ctx context.Context, user *doc.User) ([]*doc.Workspace, error) {
+	workspaces, err := s.workspaceRepo.GetByOrgID(ctx, user.OrgID)
+	if err != nil {
+		return nil, err
+	}
+	for i, ws := range workspaces {
+		workspaces[i] = RedactWorkspace(ws)
+	}
+	return workspaces, nil
+}
+
+// Get returns a workspace if it belongs to the user's organization
+func (s *WorkspaceService) Get(ctx context.Context, user *doc.User, id string) (*doc.Workspace, error) {
+	ws, err := s.workspaceRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("workspace %s: %w", id, ErrNotFound)
+	}
+	if ws.OrgID != user.OrgID {
+		return nil, fmt.Errorf("workspace %s: %w", id, ErrNotFound)
+	}
+	return ws, nil
+}
+
+// Default returns the org's default workspace, or its oldest one if none is marked default
+func (s *WorkspaceService) Default(ctx context.Context, orgID string) (*doc.Workspace, error) {
+	workspaces, err := s.workspaceRepo.GetByOrgID(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+	if len(workspaces) == 0 {
+		return nil, fmt.Errorf("organization has no workspaces: %w", ErrNotFound)
+	}
+	// GetByOrgID orders default workspaces first
+	return workspaces[0], nil
+}
+
+// Sync imports every document the workspace's provider lists, such as the
+// pages of its Confluence space, updating titles, labels, owners and places
+// in the page tree of documents that are already tracked. With track label
+// rules only pages carrying a rule's label are imported, and flag rules open
+// and resolve flags as their labels come and go.
+func (s *WorkspaceService) Sync(ctx context.Context, user *doc.User, id string) (*doc.SyncResult, error) {
+	ws, err := s.Get(ctx, user, id)
+	if err != nil {
+		return nil, err
+	}
+	return s.SyncWorkspace(ctx, ws)
+}
+
+// SyncWorkspace is Sync without the caller's access check
+func (s *WorkspaceService) SyncWorkspace(ctx context.Context, ws *doc.Workspace) (*doc.SyncResult, error) {
+	provider, err := s.providers.For(ws)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, span := tracer.Start(ctx, "WorkspaceService.SyncWorkspace", trace.WithAttributes(
+		attribute.String("updoc.workspace_id", ws.ID),
+		attribute.String("updoc.org_id", ws.OrgID),
+	))
+	start := time.Now()
+	result, err := s.syncWorkspace(ctx, ws, provider)
+	metrics.ObserveSync(time.Since(start), err)
+	finishSpan(span, err)
+	if err != nil {
+		s.logger.WarnContext(ctx, "workspace sync failed", "workspace_id", ws.ID, "error", err, "duration", time.Since(start))
+		return nil, err
+	}
+
+	s.logger.InfoContext(ctx, "workspace synced",
+		"workspace_id", ws.ID, "pages", result.Total, "created", result.Created, "updated", result.Updated,
+		"untracked", result.Untracked, "flags_opened", result.FlagsOpened, "flags_resolved", result.FlagsResolved,
+		"duration", time.Since(start))
+	return result, nil
+}
+
+func (s *WorkspaceService) syncWorkspace(ctx context.Context, ws *doc.Workspace, provider DocumentProvider) (*doc.SyncResult, error) {
+	var listed []ProviderDocument
+	for cursor := ""; ; {
+		list, err := provider.ListDocuments(ctx, ws, cursor, syncPageSize)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list documents: %w", err)
+		}
+		listed = append(listed, list.Documents...)
+		if list.NextCursor == "" || len(list.Documents) == 0 {
+			break
+		}
+		cursor = list.NextCursor
+	}
+	listed = slices.DeleteFunc(listed, func(d ProviderDocument) bool { return d.Removed })
+	placeInTree(listed)
+
+	// Pages are matched by ID, since a page's URL changes when it is renamed,
+	// and then by URL for documents flagged before a sync resolved their ID
+	pageIDs := make([]string, len(listed))
+	for i, page := range listed {
+		pageIDs[i] = page.ID
+	}
+	tracked, err := s.documentRepo.GetByExternalIDs(ctx, []string{ws.ID}, pageIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up documents: %w", err)
+	}
+	byPageID := make(map[string]*doc.Document, len(tracked))
+	for _, document := range tracked {
+		byPageID[document.ExternalID] = document
+	}
+
+	rules := labelRules(ws)
+	result := &doc.SyncResult{WorkspaceID: ws.ID}
+	now := time.Now()
+
+	// Labels each document had before the sync, for the flag rules
+	type relabelled struct {
+		document *doc.Document
+		before   []string
+	}
+	var created []*doc.Document
+	var changed []relabelled
+	var owner func(owners []string) string
+	for _, page := range listed {
+		if page.Owners != nil && owner == nil {
+			var err error
+			if owner, err = s.documentOwner(ctx, ws); err != nil {
+				return nil, err
+			}
+		}
+		result.Total++
+		existing, ok := byPageID[page.ID]
+		if !ok {
+			var err error
+			existing, err = s.documentRepo.GetByURL(ctx, []string{ws.ID}, page.URL)
+			ok = err == nil
+		}
+		if !ok {
+			if !tracksPage(rules, page.Labels) {
+				result.Untracked++
+				continue
+			}
+			document := &doc.Document{
+				WorkspaceID: ws.ID,
+				Title:       page.Title,
+				URL:         page.URL,
+				ExternalID:  page.ID,
+				LastChecked: now,
+				Labels:      page.Labels,
+
+				ParentPageID:    page.ParentID,
+				AncestorPageIDs: page.Ancestors,
+			}
+			if page.Owners != nil {
+				document.OwnerID = owner(page.Owners)
+			}
+			created = append(created, document)
+			changed = append(changed, relabelled{document: document})
+			continue
+		}
+
+		before := existing.Labels
+		existing.Title = page.Title
+		existing.URL = page.URL
+		existing.ExternalID = page.ID
+		existing.LastChecked = now
+		existing.Labels = page.Labels
+		existing.ParentPageID = page.ParentID
+		existing.AncestorPageIDs = page.Ancestors
+		if page.Owners != nil {
+			existing.OwnerID = owner(page.Owners)
+		}
+		if err := s.documentRepo.Update(ctx, existing); err != nil {
+			return nil, fmt.Errorf("failed to update document %s: %w", existing.ID, err)
+		}
+		result.Updated++
+		changed = append(changed, relabelled{document: existing, before: before})
+	}
+
+	if err := s.documentRepo.BulkCreate(ctx, created); err != nil {
+		return nil, fmt.Errorf("failed to create documents: %w", err)
+	}
+	result.Created = len(created)
+
+	if hasFlagRules(rules) {
+		for _, c := range changed {
+			opened, resolved, err := s.applyLabelRules(ctx, ws, c.document, c.before)
+			result.FlagsOpened += opened
+			result.FlagsResolved += resolved
+			if err != nil {
+				return nil, fmt.Errorf("failed to apply label rules to document %s: %w", c.document.ID, err)
+			}
+		}
+	}
+	result.SyncedAt = now
+	return result, nil
+}
+
+// documentOwner returns a function picking the org user who owns a document
+// from its provider's owners: the first that is the email of one of the
+// org's users, or a handle the workspace's owners setting maps to one
+func (s *WorkspaceService) documentOwner(ctx context.Context, ws *doc.Workspace) (func(owners []string) string, error) {
+	users, err := s.userRepo.GetByOrgID(ctx, ws.OrgID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list users: %w", err)
+	}
+	byEmail := make(map[string]string, len(users))
+	for _, u := range users {
+		if u.IsActive {
+			byEmail[strings.ToLower(u.Email)] = u.ID
+		}
+	}
+	handles, _ := ws.IntegrationConfig[gitOwnersKey].(map[string]interface{})
+
+	return func(owners []string) string {
+		for _, owner := range owners {
+			email := owner
+			if strings.HasPrefix(owner, "@") {
+				email, _ = handles[owner].(string)
+			}
+			if id, ok := byEmail[strings.ToLower(email)]; ok {
+				return id
+			}
+		}
+		return ""
+	}, nil
+}
+
+// placeInTree fills in the ancestors of documents whose provider only knows
+// their parent, following parents through the other documents listed
+func placeInTree(documents []ProviderDocument) {
+	parents := make(map[string]string, len(documents))
+	for _, d := range documents {
+		parents[d.ID] = d.ParentID
+	}
+	for i := range documents {
+		d := &documents[i]
+		if len(d.Ancestors) > 0 || d.ParentID == "" {
+			continue
+		}
+		seen := map[string]bool{d.ID: true}
+		var ancestors []string
+		for id := d.ParentID; id != "" && !seen[id]; id = parents[id] {
+			seen[id] = true
+			ancestors = append(ancestors, id)
+		}
+		slices.Reverse(ancestors)
+		d.Ancestors = ancestors
+	}
+}
+
+// TestConnection checks that the workspace's provider can be reached with
+// its settings
+func (s *WorkspaceService) TestConnection(ctx context.Context, user *doc.User, id string) (*ConnectionTest, error) {
+	ws, err := s.Get(ctx, user, id)
+	if err != nil {
+		return nil, err
+	}
+	provider, err := s.providers.For(ws)
+	if err != nil {
+		return nil, err
+	}
+	return provider.TestConnection(ctx, ws)
+}
+
+// SearchDocuments searches the workspace's provider for documents matching
+// query, tracked or not
+func (s *WorkspaceService) SearchDocuments(ctx context.Context, user *doc.User, id, query, cursor string, limit int) (*ProviderDocumentList, error) {
+	if strings.TrimSpace(query) == "" {
+		return nil, fmt.Errorf("query is required: %w", ErrInvalidInput)
+	}
+	ws, err := s.Get(ctx, user, id)
+	if err != nil {
+		return nil, err
+	}
+	provider, err := s.providers.For(ws)
+	if err != nil {
+		return nil, err
+	}
+	if limit <= 0 {
+		limit = 25
+	}
+	return provider.SearchDocuments(ctx, ws, query, cursor, limit)
+}
+
+// provider returns the provider of the workspace document belongs to,
+// with the workspace
+func (s *WorkspaceService) provider(ctx context.Context, document *doc.Document) (DocumentProvider, *doc.Workspace, error) {
+	ws, err := s.workspaceRepo.GetByID(ctx, document.WorkspaceID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("workspace %s: %w", document.WorkspaceID, ErrNotFound)
+	}
+	provider, err := s.providers.For(ws)
+	if err != nil {
+		return nil, nil, err
+	}
+	return provider, ws, nil
+}
+
+// SearchConfluence searches the Confluence spaces connected to the org's
+// workspaces and marks which hits are tracked documents and how many open
+// flags they have
+func (s *WorkspaceService) SearchConfluence(ctx context.Context, user *doc.User, orgID string, req ConfluenceSearchRequest) (*ConfluenceSearchResult, error) {
+	if user.OrgID != orgID {
+		return nil, fmt.Errorf("organization %s: %w", orgID, ErrNotFound)
+	}
+
+	workspaces, err := s.workspaceRepo.GetByOrgID(ctx, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list workspaces: %w", err)
+	}
+	var workspaceIDs, spaces []string
+	for _, ws := range workspaces {
+		if ws.IntegrationType != "confluence" {
+			continue
+		}
+		workspaceIDs = append(workspaceIDs, ws.ID)
+		// A workspace without a space key syncs the org's configured space
+		spaceKey, _ := ws.IntegrationConfig["space_key"].(string)
+		spaces = append(spaces, spaceKey)
+	}
+
+	result, err := s.confluenceService.Search(ctx, orgID, req, spaces)
+	if err != nil {
+		return nil, err
+	}
+	if len(result.Results) == 0 {
+		return result, nil
+	}
+
+	pageIDs := make([]string, len(result.Results))
+	for i, hit := range result.Results {
+		pageIDs[i] = hit.ID
+	}
+	docs, err := s.documentRepo.GetByExternalIDs(ctx, workspaceIDs, pageIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up documents: %w", err)
+	}
+	// The oldest document wins when a page is tracked in several workspaces
+	byPage := make(map[string]*doc.Document, len(docs))
+	docIDs := make([]string, 0, len(docs))
+	for _, d := range docs {
+		if _, ok := byPage[d.ExternalID]; !ok {
+			byPage[d.ExternalID] = d
+			docIDs = append(docIDs, d.ID)
+		}
+	}
+	openFlags, err := s.flagRepo.CountOpenByDocument(ctx, docIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count open flags: %w", err)
+	}
+
+	for i := range result.Results {
+		hit := &result.Results[i]
+		if d, ok := byPage[hit.ID]; ok {
+			hit.Tracked = true
+			hit.DocumentID = d.ID
+			hit.OpenFlags = openFlags[d.ID]
+		}
+	}
+	return result, nil
+}
+
+// currentDocument fetches document's current metadata from its workspace's
+// provider
+func (s *WorkspaceService) currentDocument(ctx context.Context, document *doc.Document) (*ProviderDocument, error) {
+	if document.ExternalID == "" {
+		return nil, fmt.Errorf("document %s has no external ID; sync its workspace to resolve it: %w", document.ID, ErrInvalidInput)
+	}
+	provider, ws, err := s.provider(ctx, document)
+	if err != nil {
+		return nil, err
+	}
+	return provider.Document(ctx, ws, document.ExternalID)
+}
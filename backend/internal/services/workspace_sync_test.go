@@ -0,0 +1,231 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/shaunpua/updoc/internal/config"
+	"github.com/shaunpua/updoc/internal/confluence"
+	"github.com/shaunpua/updoc/internal/confluence/confluencetest"
+	"github.com/shaunpua/updoc/internal/doc"
+)
+
+func TestSyncWorkspace(t *testing.T) {
+	env := newTestEnv(t)
+
+	first := env.sync(t)
+	if first.Total != 5 || first.Created != 5 || first.Updated != 0 {
+		t.Fatalf("first sync = %+v, want 5 pages created", first)
+	}
+	guide := env.document(t, "102")
+	if guide.Title != "API Guide" || guide.ParentPageID != "101" || !slices.Equal(guide.Labels, []string{"api", "public"}) {
+		t.Errorf("API Guide = %+v", guide)
+	}
+
+	// Pages created, renamed, moved and deleted on Confluence show at the
+	// next sync; pages in other spaces never do
+	added, err := env.site.CreatePage(confluencetest.PageInput{SpaceKey: "ENG", ParentID: "102", Title: "Pagination", Body: "<p>Use cursors.</p>"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.site.UpdatePage("102", confluencetest.PageInput{Title: "REST API Guide"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.site.MovePage("103", confluencetest.MoveInput{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.site.DeletePage("105"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.site.CreatePage(confluencetest.PageInput{SpaceKey: "OPS", Title: "Capacity Planning"}); err != nil {
+		t.Fatal(err)
+	}
+
+	second := env.sync(t)
+	if second.Total != 5 || second.Created != 1 || second.Updated != 4 {
+		t.Errorf("second sync = %+v, want 1 page created and 4 updated", second)
+	}
+	if got := env.document(t, "102").Title; got != "REST API Guide" {
+		t.Errorf("renamed page title = %q", got)
+	}
+	if got := env.document(t, "103"); got.ParentPageID != "" || len(got.AncestorPageIDs) != 0 {
+		t.Errorf("moved page = parent %q, ancestors %v, want a top-level page", got.ParentPageID, got.AncestorPageIDs)
+	}
+	if got := env.document(t, added); !slices.Equal(got.AncestorPageIDs, []string{"101", "102"}) {
+		t.Errorf("new page ancestors = %v, want [101 102]", got.AncestorPageIDs)
+	}
+}
+
+func TestSyncSharedSpace(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	env.sync(t)
+	guide := env.document(t, "102")
+
+	// Another org tracking the same space gets its own documents; it never
+	// takes over the first org's
+	other, otherWS := env.addOrg(t, "Globex", "admin@globex.example.com")
+	result, err := env.workspaces.Sync(ctx, other, otherWS.ID)
+	if err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	if result.Total != 5 || result.Created != 5 {
+		t.Errorf("other org's sync = %+v, want 5 pages created", result)
+	}
+	if got := env.document(t, "102"); got.ID != guide.ID || got.WorkspaceID != env.ws.ID {
+		t.Errorf("API Guide = %+v, want it left in the first org's workspace", got)
+	}
+	otherDocs, _ := env.store.Documents().GetByWorkspaceID(ctx, otherWS.ID)
+	if len(otherDocs) != 5 {
+		t.Errorf("other org has %d documents, want 5", len(otherDocs))
+	}
+	if again := env.sync(t); again.Created != 0 || again.Updated != 5 {
+		t.Errorf("first org's resync = %+v, want 5 pages updated", again)
+	}
+
+	// Flagging by URL finds the caller's own copy of the page
+	flag, err := env.flags.Create(ctx, other, doc.CreateFlagRequest{DocumentURL: guide.URL, Title: "Auth section is outdated", Priority: doc.PriorityLow})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if flag.DocumentID == guide.ID || !slices.ContainsFunc(otherDocs, func(d *doc.Document) bool { return d.ID == flag.DocumentID }) {
+		t.Errorf("flag document = %s, want the other org's copy of the page", flag.DocumentID)
+	}
+	if flags, _ := env.store.Flags().GetByDocumentID(ctx, guide.ID); len(flags) != 0 {
+		t.Errorf("first org's document has %d flags, want none", len(flags))
+	}
+
+	// An org that hasn't synced yet starts tracking the page itself
+	third, thirdWS := env.addOrg(t, "Initech", "admin@initech.example.com")
+	flag, err = env.flags.Create(ctx, third, doc.CreateFlagRequest{DocumentURL: guide.URL, Title: "Auth section is outdated", Priority: doc.PriorityLow})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if tracked, err := env.store.Documents().GetByID(ctx, flag.DocumentID); err != nil || tracked.WorkspaceID != thirdWS.ID {
+		t.Errorf("flag document = %+v, %v, want one in the third org's workspace", tracked, err)
+	}
+}
+
+func TestSyncLabelRules(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+
+	_, err := env.workspaces.SetLabelRules(ctx, env.admin, env.ws.ID, []LabelRule{
+		{Label: "runbook", Action: LabelActionTrack},
+		{Label: "Outdated", Action: LabelActionFlag, Priority: doc.PriorityHigh},
+	})
+	if err != nil {
+		t.Fatalf("SetLabelRules: %v", err)
+	}
+	if err := env.site.AddLabel("104", "outdated"); err != nil {
+		t.Fatal(err)
+	}
+
+	result := env.sync(t)
+	if result.Created != 2 || result.Untracked != 3 || result.FlagsOpened != 1 {
+		t.Fatalf("sync = %+v, want the runbook and the outdated page tracked and one flag opened", result)
+	}
+	webhooks := env.document(t, "104")
+	flags, err := env.store.Flags().GetByDocumentID(ctx, webhooks.ID)
+	if err != nil || len(flags) != 1 {
+		t.Fatalf("flags on the outdated page = %v, %v, want one", flags, err)
+	}
+	if flags[0].SourceLabel != "outdated" || flags[0].Priority != doc.PriorityHigh || flags[0].CreatedBy != env.admin.ID {
+		t.Errorf("rule flag = %+v", flags[0])
+	}
+
+	// Syncing again doesn't open a second flag; removing the label resolves it
+	if result := env.sync(t); result.FlagsOpened != 0 {
+		t.Errorf("second sync opened %d flags", result.FlagsOpened)
+	}
+	if err := env.site.RemoveLabel("104", "outdated"); err != nil {
+		t.Fatal(err)
+	}
+	if result := env.sync(t); result.FlagsResolved != 1 {
+		t.Errorf("sync after removing the label = %+v, want one flag resolved", result)
+	}
+	flag, err := env.store.Flags().GetByID(ctx, flags[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if flag.Status != doc.FlagStatusResolved {
+		t.Errorf("rule flag status = %s, want resolved", flag.Status)
+	}
+}
+
+func TestSyncFaults(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("transient errors are retried", func(t *testing.T) {
+		env := newTestEnv(t)
+		env.site.SetFaults(confluencetest.Faults{ServerErrors: 2})
+		if result := env.sync(t); result.Created != 5 {
+			t.Errorf("sync = %+v, want 5 pages created", result)
+		}
+	})
+
+	t.Run("rejected credentials", func(t *testing.T) {
+		env := newTestEnv(t)
+		env.site.SetFaults(confluencetest.Faults{RejectAuth: true})
+		_, err := env.workspaces.Sync(ctx, env.admin, env.ws.ID)
+		var apiErr *confluence.APIError
+		if !errors.As(err, &apiErr) || apiErr.StatusCode != 401 {
+			t.Errorf("Sync = %v, want the 401", err)
+		}
+		if documents, _ := env.store.Documents().GetByWorkspaceID(ctx, env.ws.ID); len(documents) != 0 {
+			t.Errorf("a failed sync stored %d documents", len(documents))
+		}
+	})
+
+	t.Run("outage opens the breaker", func(t *testing.T) {
+		env := newTestEnv(t, func(cfg *config.Config, _ *confluencetest.Options) {
+			cfg.Confluence.MaxRetries = 0
+			cfg.Confluence.BreakerThreshold = 1
+		})
+		env.site.SetFaults(confluencetest.Faults{ServerErrors: 1})
+		if _, err := env.workspaces.Sync(ctx, env.admin, env.ws.ID); err == nil {
+			t.Fatal("Sync succeeded during the outage")
+		}
+		if _, err := env.workspaces.Sync(ctx, env.admin, env.ws.ID); !errors.Is(err, confluence.ErrCircuitOpen) {
+			t.Errorf("Sync = %v, want ErrCircuitOpen while the breaker cools down", err)
+		}
+	})
+}
+
+func TestFlagWriteBackComment(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	env.sync(t)
+
+	if _, err := env.workspaces.SetWriteBack(ctx, env.admin, env.ws.ID, WriteBackSettings{Mode: WriteBackComment}); err != nil {
+		t.Fatalf("SetWriteBack: %v", err)
+	}
+	flag, err := env.flags.Create(ctx, env.admin, doc.CreateFlagRequest{
+		DocumentID:  env.document(t, "103").ID,
+		Title:       "Rollback step is missing",
+		Description: "The runbook doesn't say how to roll back a bad deploy.",
+		Priority:    doc.PriorityUrgent,
+	})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	comments := env.site.Comments("103")
+	if len(comments) != 1 || !strings.Contains(comments[0].Body, "Rollback step is missing") {
+		t.Fatalf("comments on the page = %+v, want the flag's", comments)
+	}
+	if stored, _ := env.store.Flags().GetByID(ctx, flag.ID); stored.ConfluenceCommentID != comments[0].ID {
+		t.Errorf("flag comment ID = %q, want %q", stored.ConfluenceCommentID, comments[0].ID)
+	}
+
+	if _, err := env.flags.Resolve(ctx, env.admin, flag.ID, "Added the rollback section"); err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	comments = env.site.Comments("103")
+	if len(comments) != 1 || comments[0].Version != 2 {
+		t.Errorf("comments after resolving = %+v, want the flag's rewritten", comments)
+	}
+}
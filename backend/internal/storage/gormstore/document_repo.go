@@ -0,0 +1,161 @@
+package gormstore
+
+import (
+	"context"
+	"github.com/shaunpua/updoc/internal/doc"
+	"gorm.io/gorm"
+)
+
+type DocumentRepo struct{ DB *gorm.DB }
+
+func NewDocumentRepo(db *gorm.DB) *DocumentRepo { return &DocumentRepo{DB: db} }
+
+func (r *DocumentRepo) Create(ctx context.Context, d *doc.Document) error {
+	dbDoc := r.fromDomain(d)
+	if err := r.DB.WithContext(ctx).Create(&dbDoc).Error; err != nil {
+		return err
+	}
+
+	d.ID = dbDoc.ID
+	d.CreatedAt = dbDoc.CreatedAt
+	return nil
+}
+
+func (r *DocumentRepo) GetByWorkspaceID(ctx context.Context, workspaceID string) ([]*doc.Document, error) {
+	var dbDocs []Document
+	if err := r.DB.WithContext(ctx).Where("workspace_id = ?", workspaceID).Order("title").Find(&dbDocs).Error; err != nil {
+		return nil, err
+	}
+
+	docs := make([]*doc.Document, len(dbDocs))
+	for i, dbDoc := range dbDocs {
+		docs[i] = toDomainDocument(dbDoc)
+	}
+	return docs, nil
+}
+
+func (r *DocumentRepo) GetByURL(ctx context.Context, workspaceIDs []string, url string) (*doc.Document, error) {
+	if len(workspaceIDs) == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	var dbDoc Document
+	if err := r.DB.WithContext(ctx).Where("workspace_id IN ? AND url = ?", workspaceIDs, url).
+		Order("created_at").First(&dbDoc).Error; err != nil {
+		return nil, err
+	}
+	return toDomainDocument(dbDoc), nil
+}
+
+func (r *DocumentRepo) GetByID(ctx context.Context, id string) (*doc.Document, error) {
+	var dbDoc Document
+	if err := r.DB.WithContext(ctx).Where("id = ?", id).First(&dbDoc).Error; err != nil {
+		return nil, err
+	}
+	return toDomainDocument(dbDoc), nil
+}
+
+func (r *DocumentRepo) GetByExternalIDs(ctx context.Context, workspaceIDs, externalIDs []string) ([]*doc.Document, error) {
+	if len(workspaceIDs) == 0 || len(externalIDs) == 0 {
+		return nil, nil
+	}
+	var dbDocs []Document
+	if err := r.DB.WithContext(ctx).
+		Where("workspace_id IN ? AND external_id IN ?", workspaceIDs, externalIDs).
+		Order("created_at").
+		Find(&dbDocs).Error; err != nil {
+		return nil, err
+	}
+
+	docs := make([]*doc.Document, len(dbDocs))
+	for i, dbDoc := range dbDocs {
+		docs[i] = toDomainDocument(dbDoc)
+	}
+	return docs, nil
+}
+
+func (r *DocumentRepo) BulkCreate(ctx context.Context, docs []*doc.Document) error {
+	if len(docs) == 0 {
+		return nil
+	}
+
+	dbDocs := make([]Document, len(docs))
+	for i, d := range docs {
+		dbDocs[i] = r.fromDomain(d)
+	}
+	if err := r.DB.WithContext(ctx).Create(&dbDocs).Error; err != nil {
+		return err
+	}
+
+	for i := range docs {
+		docs[i].ID = dbDocs[i].ID
+		docs[i].CreatedAt = dbDocs[i].CreatedAt
+	}
+	return nil
+}
+
+func (r *DocumentRepo) Update(ctx context.Context, d *doc.Document) error {
+	dbDoc := r.fromDomain(d)
+	dbDoc.ID = d.ID
+	dbDoc.CreatedAt = d.CreatedAt
+	return r.DB.WithContext(ctx).Save(&dbDoc).Error
+}
+
+func (r *DocumentRepo) fromDomain(d *doc.Document) Document {
+	return Document{
+		WorkspaceID: d.WorkspaceID,
+		Title:       d.Title,
+		URL:         d.URL,
+		ExternalID:  d.ExternalID,
+		OwnerID:     nullableUUID(d.OwnerID),
+		LastChecked: d.LastChecked,
+
+		RemovedAt:    d.RemovedAt,
+		LastEventAt:  d.LastEventAt,
+		LastEventIDs: d.LastEventIDs,
+		Labels:       d.Labels,
+
+		ParentPageID:    d.ParentPageID,
+		AncestorPageIDs: d.AncestorPageIDs,
+
+		SourceRepository: d.SourceRepository,
+		SourcePaths:      d.SourcePaths,
+		SourceSymbols:    d.SourceSymbols,
+	}
+}
+
+// toDomainDocument converts a GORM document, shared with FlagRepo for preloaded documents
+func toDomainDocument(d Document) *doc.Document {
+	document := &doc.Document{
+		ID:          d.ID,
+		WorkspaceID: d.WorkspaceID,
+		Title:       d.Title,
+		URL:         d.URL,
+		ExternalID:  d.ExternalID,
+		LastChecked: d.LastChecked,
+		CreatedAt:   d.CreatedAt,
+
+		RemovedAt:    d.RemovedAt,
+		LastEventAt:  d.LastEventAt,
+		LastEventIDs: d.LastEventIDs,
+		Labels:       d.Labels,
+
+		ParentPageID:    d.ParentPageID,
+		AncestorPageIDs: d.AncestorPageIDs,
+
+		SourceRepository: d.SourceRepository,
+		SourcePaths:      d.SourcePaths,
+		SourceSymbols:    d.SourceSymbols,
+	}
+	if d.OwnerID != nil {
+		document.OwnerID = *d.OwnerID
+	}
+	return document
+}
+
+// nullableUUID maps "" to NULL so optional uuid columns don't reject empty strings
+func nullableUUID(id string) *string {
+	if id == "" {
+		return nil
+	}
+	return &id
+}
@@ -11,12 +11,26 @@ type Flag struct {
 	Title       string     `json:"title" gorm:"not null"`
 	Description string     `json:"description" gorm:"type:text;not null"`
 	Priority    string     `json:"priority" gorm:"default:'medium'"` // urgent, high, medium, low
-	Status      string     `json:"status" gorm:"default:'pending'"`  // pending, in_progress, resolved, archived
+	Status      string     `json:"status" gorm:"default:'pending'"`  // pending, in_progress, awaiting_verification, resolved, archived
 	Resolution  string     `json:"resolution" gorm:"type:text"`
 	ResolvedAt  *time.Time `json:"resolved_at"`
 	CreatedAt   time.Time  `json:"created_at" gorm:"autoCreateTime"`
 	UpdatedAt   time.Time  `json:"updated_at" gorm:"autoUpdateTime"`
 
+	// PageVersion is the Confluence page version when the flag was raised
+	PageVersion       int    `json:"page_version"`
+	ResolutionWarning string `json:"resolution_warning" gorm:"type:text"`
+	CheckedVersion    int    `json:"checked_version"`
+
+	// ConfluenceCommentID is the footer comment written back to the page
+	ConfluenceCommentID string `json:"confluence_comment_id"`
+	// SourceLabel is the Confluence label whose rule opened the flag
+	SourceLabel string `json:"source_label"`
+	// SourceCommits are the commits to linked code that opened the flag
+	SourceCommits []string `json:"source_commits" gorm:"type:jsonb;serializer:json"`
+	// PullRequest is the pull request whose changed files opened the flag
+	PullRequest string `json:"pull_request"`
+
 	// Relationships
 	Document      Document       `gorm:"foreignKey:DocumentID"`
 	Creator       User           `gorm:"foreignKey:CreatedBy"`
@@ -1,6 +1,7 @@
 package gormstore
 
 import (
+	"context"
 	"github.com/shaunpua/updoc/internal/doc"
 	"gorm.io/gorm"
 )
@@ -10,7 +11,7 @@ type FlagRepo struct{ DB *gorm.DB }
 func NewFlagRepo(db *gorm.DB) *FlagRepo { return &FlagRepo{DB: db} }
 
 // Implement new FlagRepository interface
-func (r *FlagRepo) Create(flag *doc.Flag) error {
+func (r *FlagRepo) Create(ctx context.Context, flag *doc.Flag) error {
 	dbFlag := Flag{
 		DocumentID:  flag.DocumentID,
 		CreatedBy:   flag.CreatedBy,
@@ -23,20 +24,31 @@ func (r *FlagRepo) Create(flag *doc.Flag) error {
 		ResolvedAt:  flag.ResolvedAt,
 		CreatedAt:   flag.CreatedAt,
 		UpdatedAt:   flag.UpdatedAt,
+
+		PageVersion:       flag.PageVersion,
+		ResolutionWarning: flag.ResolutionWarning,
+		CheckedVersion:    flag.CheckedVersion,
+
+		ConfluenceCommentID: flag.ConfluenceCommentID,
+		SourceLabel:         flag.SourceLabel,
+		SourceCommits:       flag.SourceCommits,
+		PullRequest:         flag.PullRequest,
 	}
 
-	if err := r.DB.Create(&dbFlag).Error; err != nil {
+	if err := r.DB.WithContext(ctx).Create(&dbFlag).Error; err != nil {
 		return err
 	}
 
-	// Update the flag with the generated ID
+	// Update the flag with the generated values
 	flag.ID = dbFlag.ID
+	flag.CreatedAt = dbFlag.CreatedAt
+	flag.UpdatedAt = dbFlag.UpdatedAt
 	return nil
 }
 
-func (r *FlagRepo) GetByID(id string) (*doc.Flag, error) {
+func (r *FlagRepo) GetByID(ctx context.Context, id string) (*doc.Flag, error) {
 	var dbFlag Flag
-	if err := r.DB.Preload("Creator").Preload("Assignee").Preload("Document").
+	if err := r.DB.WithContext(ctx).Preload("Creator").Preload("Assignee").Preload("Document").
 		First(&dbFlag, "id = ?", id).Error; err != nil {
 		return nil, err
 	}
@@ -44,9 +56,9 @@ func (r *FlagRepo) GetByID(id string) (*doc.Flag, error) {
 	return r.toDomainFlag(dbFlag), nil
 }
 
-func (r *FlagRepo) GetByDocumentID(documentID string) ([]*doc.Flag, error) {
+func (r *FlagRepo) GetByDocumentID(ctx context.Context, documentID string) ([]*doc.Flag, error) {
 	var dbFlags []Flag
-	if err := r.DB.Preload("Creator").Preload("Assignee").
+	if err := r.DB.WithContext(ctx).Preload("Creator").Preload("Assignee").
 		Where("document_id = ?", documentID).Find(&dbFlags).Error; err != nil {
 		return nil, err
 	}
@@ -58,33 +70,56 @@ func (r *FlagRepo) GetByDocumentID(documentID string) ([]*doc.Flag, error) {
 	return flags, nil
 }
 
-func (r *FlagRepo) GetByFilters(filters doc.FlagFilters) ([]*doc.Flag, error) {
-	query := r.DB.Preload("Creator").Preload("Assignee").Preload("Document")
+func (r *FlagRepo) GetByDocumentIDs(ctx context.Context, documentIDs []string) ([]*doc.Flag, error) {
+	if len(documentIDs) == 0 {
+		return []*doc.Flag{}, nil
+	}
+	var dbFlags []Flag
+	if err := r.DB.WithContext(ctx).Preload("Creator").Preload("Assignee").
+		Where("document_id IN ?", documentIDs).Find(&dbFlags).Error; err != nil {
+		return nil, err
+	}
+
+	flags := make([]*doc.Flag, len(dbFlags))
+	for i, dbFlag := range dbFlags {
+		flags[i] = r.toDomainFlag(dbFlag)
+	}
+	return flags, nil
+}
+
+func (r *FlagRepo) GetByFilters(ctx context.Context, filters doc.FlagFilters) ([]*doc.Flag, error) {
+	query := r.DB.WithContext(ctx).Preload("Creator").Preload("Assignee").Preload("Document")
 
 	if filters.Status != "" {
-		query = query.Where("status = ?", filters.Status)
+		query = query.Where("flags.status = ?", filters.Status)
 	}
 	if filters.Priority != "" {
-		query = query.Where("priority = ?", filters.Priority)
+		query = query.Where("flags.priority = ?", filters.Priority)
 	}
 	if filters.AssignedTo != "" {
-		query = query.Where("assigned_to = ?", filters.AssignedTo)
+		query = query.Where("flags.assigned_to = ?", filters.AssignedTo)
 	}
 	if filters.CreatedBy != "" {
-		query = query.Where("created_by = ?", filters.CreatedBy)
+		query = query.Where("flags.created_by = ?", filters.CreatedBy)
 	}
-	if filters.WorkspaceID != "" {
+	if filters.WorkspaceID != "" || filters.OrgID != "" {
 		// Join with documents table to filter by workspace
-		query = query.Joins("JOIN documents ON flags.document_id = documents.id").
-			Where("documents.workspace_id = ?", filters.WorkspaceID)
+		query = query.Joins("JOIN documents ON flags.document_id = documents.id")
+	}
+	if filters.WorkspaceID != "" {
+		query = query.Where("documents.workspace_id = ?", filters.WorkspaceID)
+	}
+	if filters.OrgID != "" {
+		query = query.Joins("JOIN workspaces ON documents.workspace_id = workspaces.id").
+			Where("workspaces.org_id = ?", filters.OrgID)
 	}
 	if filters.Search != "" {
-		query = query.Where("title ILIKE ? OR description ILIKE ?",
+		query = query.Where("flags.title ILIKE ? OR flags.description ILIKE ?",
 			"%"+filters.Search+"%", "%"+filters.Search+"%")
 	}
 
 	var dbFlags []Flag
-	if err := query.Find(&dbFlags).Error; err != nil {
+	if err := query.Order("flags.created_at DESC").Find(&dbFlags).Error; err != nil {
 		return nil, err
 	}
 
@@ -95,7 +130,7 @@ func (r *FlagRepo) GetByFilters(filters doc.FlagFilters) ([]*doc.Flag, error) {
 	return flags, nil
 }
 
-func (r *FlagRepo) Update(flag *doc.Flag) error {
+func (r *FlagRepo) Update(ctx context.Context, flag *doc.Flag) error {
 	dbFlag := Flag{
 		ID:          flag.ID,
 		DocumentID:  flag.DocumentID,
@@ -107,10 +142,76 @@ func (r *FlagRepo) Update(flag *doc.Flag) error {
 		Status:      flag.Status,
 		Resolution:  flag.Resolution,
 		ResolvedAt:  flag.ResolvedAt,
+		CreatedAt:   flag.CreatedAt,
 		UpdatedAt:   flag.UpdatedAt,
+
+		PageVersion:       flag.PageVersion,
+		ResolutionWarning: flag.ResolutionWarning,
+		CheckedVersion:    flag.CheckedVersion,
+
+		ConfluenceCommentID: flag.ConfluenceCommentID,
+		SourceLabel:         flag.SourceLabel,
+		SourceCommits:       flag.SourceCommits,
+		PullRequest:         flag.PullRequest,
+	}
+
+	if err := r.DB.WithContext(ctx).Save(&dbFlag).Error; err != nil {
+		return err
 	}
 
-	return r.DB.Save(&dbFlag).Error
+	flag.UpdatedAt = dbFlag.UpdatedAt
+	return nil
+}
+
+// CountOpen counts flags that are neither resolved nor archived, grouped by priority and status
+func (r *FlagRepo) CountOpen(ctx context.Context) ([]doc.FlagCount, error) {
+	var counts []doc.FlagCount
+	err := r.DB.WithContext(ctx).Model(&Flag{}).
+		Select("priority, status, COUNT(*) AS count").
+		Where("status NOT IN ?", []string{doc.FlagStatusResolved, doc.FlagStatusArchived}).
+		Group("priority, status").
+		Scan(&counts).Error
+	return counts, err
+}
+
+// CountOpenByDocument counts flags that are neither resolved nor archived on each of documentIDs
+func (r *FlagRepo) CountOpenByDocument(ctx context.Context, documentIDs []string) (map[string]int, error) {
+	counts := make(map[string]int)
+	if len(documentIDs) == 0 {
+		return counts, nil
+	}
+	var rows []struct {
+		DocumentID string
+		Count      int
+	}
+	err := r.DB.WithContext(ctx).Model(&Flag{}).
+		Select("document_id, COUNT(*) AS count").
+		Where("document_id IN ? AND status NOT IN ?", documentIDs, []string{doc.FlagStatusResolved, doc.FlagStatusArchived}).
+		Group("document_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		counts[row.DocumentID] = row.Count
+	}
+	return counts, nil
+}
+
+// GetWatched returns pending and in-progress flags with a recorded page version
+func (r *FlagRepo) GetWatched(ctx context.Context) ([]*doc.Flag, error) {
+	var dbFlags []Flag
+	if err := r.DB.WithContext(ctx).Preload("Document").
+		Where("status IN ? AND page_version > 0", []string{doc.FlagStatusPending, doc.FlagStatusInProgress}).
+		Order("document_id").Find(&dbFlags).Error; err != nil {
+		return nil, err
+	}
+
+	flags := make([]*doc.Flag, len(dbFlags))
+	for i, dbFlag := range dbFlags {
+		flags[i] = r.toDomainFlag(dbFlag)
+	}
+	return flags, nil
 }
 
 // Helper method to convert GORM model to domain model
@@ -128,6 +229,15 @@ func (r *FlagRepo) toDomainFlag(dbFlag Flag) *doc.Flag {
 		ResolvedAt:  dbFlag.ResolvedAt,
 		CreatedAt:   dbFlag.CreatedAt,
 		UpdatedAt:   dbFlag.UpdatedAt,
+
+		PageVersion:       dbFlag.PageVersion,
+		ResolutionWarning: dbFlag.ResolutionWarning,
+		CheckedVersion:    dbFlag.CheckedVersion,
+
+		ConfluenceCommentID: dbFlag.ConfluenceCommentID,
+		SourceLabel:         dbFlag.SourceLabel,
+		SourceCommits:       dbFlag.SourceCommits,
+		PullRequest:         dbFlag.PullRequest,
 	}
 
 	// Convert related entities if loaded
@@ -152,16 +262,7 @@ func (r *FlagRepo) toDomainFlag(dbFlag Flag) *doc.Flag {
 	}
 
 	if dbFlag.Document.ID != "" {
-		flag.Document = &doc.Document{
-			ID:          dbFlag.Document.ID,
-			WorkspaceID: dbFlag.Document.WorkspaceID,
-			Title:       dbFlag.Document.Title,
-			URL:         dbFlag.Document.URL,
-			ExternalID:  dbFlag.Document.ExternalID,
-			OwnerID:     dbFlag.Document.OwnerID,
-			LastChecked: dbFlag.Document.LastChecked,
-			CreatedAt:   dbFlag.Document.CreatedAt,
-		}
+		flag.Document = toDomainDocument(dbFlag.Document)
 	}
 
 	return flag
@@ -0,0 +1,40 @@
+package gormstore
+
+import (
+	"os"
+	"testing"
+
+	"github.com/shaunpua/updoc/internal/storage/storagetest"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// TestRepositories runs against the Postgres database at
+// UPDOC_TEST_DATABASE_URL, which it empties before each test
+func TestRepositories(t *testing.T) {
+	dsn := os.Getenv("UPDOC_TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("UPDOC_TEST_DATABASE_URL is not set")
+	}
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	if err := AutoMigrate(db); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	storagetest.Run(t, func(t *testing.T) storagetest.Repos {
+		if err := db.Exec("TRUNCATE organizations, users, workspaces, documents, flags, notifications CASCADE").Error; err != nil {
+			t.Fatalf("truncate: %v", err)
+		}
+		return storagetest.Repos{
+			Organizations: NewOrganizationRepo(db, nil),
+			Users:         NewUserRepo(db),
+			Workspaces:    NewWorkspaceRepo(db, nil),
+			Documents:     NewDocumentRepo(db),
+			Flags:         NewFlagRepo(db),
+		}
+	})
+}
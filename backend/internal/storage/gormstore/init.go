@@ -1,7 +1,66 @@
 package gormstore
 
-import "gorm.io/gorm"
+import (
+	"context"
+
+	"gorm.io/gorm"
+)
+
+// models are the tables managed by AutoMigrate
+var models = []interface{}{&Organization{}, &User{}, &Workspace{}, &Document{}, &Flag{}, &Notification{}}
+
+// legacyConstraints are unique constraints from earlier schemas that
+// AutoMigrate drops. documents.url was once unique across all workspaces,
+// under either name depending on the GORM version that created it.
+var legacyConstraints = []string{"documents_url_key", "uni_documents_url"}
 
 func AutoMigrate(db *gorm.DB) error {
-	return db.AutoMigrate(&Organization{}, &User{}, &Workspace{}, &Document{}, &Flag{}, &Notification{})
+	if db.Migrator().HasTable(&Document{}) {
+		for _, name := range legacyConstraints {
+			if err := db.Exec("ALTER TABLE documents DROP CONSTRAINT IF EXISTS " + name).Error; err != nil {
+				return err
+			}
+		}
+	}
+	return db.AutoMigrate(models...)
+}
+
+// PendingMigrations lists the tables, columns and indexes ("table.column",
+// "table.index") that AutoMigrate would still create, and the legacy
+// constraints it would drop. An empty result means the schema is current.
+func PendingMigrations(ctx context.Context, db *gorm.DB) ([]string, error) {
+	db = db.WithContext(ctx)
+	migrator := db.Migrator()
+
+	var pending []string
+	for _, model := range models {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(model); err != nil {
+			return nil, err
+		}
+
+		table := stmt.Schema.Table
+		if !migrator.HasTable(model) {
+			pending = append(pending, table)
+			continue
+		}
+		for _, field := range stmt.Schema.Fields {
+			if field.DBName != "" && !migrator.HasColumn(model, field.DBName) {
+				pending = append(pending, table+"."+field.DBName)
+			}
+		}
+		for _, index := range stmt.Schema.ParseIndexes() {
+			if !migrator.HasIndex(model, index.Name) {
+				pending = append(pending, table+"."+index.Name)
+			}
+		}
+	}
+	if migrator.HasTable(&Document{}) {
+		for _, name := range legacyConstraints {
+			if migrator.HasConstraint(&Document{}, name) {
+				pending = append(pending, "documents."+name)
+			}
+		}
+	}
+	return pending, nil
 }
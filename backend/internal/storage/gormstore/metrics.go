@@ -0,0 +1,59 @@
+package gormstore
+
+import (
+	"errors"
+	"time"
+
+	"github.com/shaunpua/updoc/internal/metrics"
+	"gorm.io/gorm"
+)
+
+const metricsStartKey = "updoc:metrics_start"
+
+// Metrics is a GORM plugin that records query latency and errors per
+// operation and table. Register it with db.Use(gormstore.Metrics{}).
+type Metrics struct{}
+
+func (Metrics) Name() string { return "updoc:metrics" }
+
+func (Metrics) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+	return errors.Join(
+		cb.Create().Before("gorm:create").Register("updoc:metrics_before_create", startTimer),
+		cb.Create().After("gorm:create").Register("updoc:metrics_after_create", observe("create")),
+		cb.Query().Before("gorm:query").Register("updoc:metrics_before_query", startTimer),
+		cb.Query().After("gorm:query").Register("updoc:metrics_after_query", observe("query")),
+		cb.Update().Before("gorm:update").Register("updoc:metrics_before_update", startTimer),
+		cb.Update().After("gorm:update").Register("updoc:metrics_after_update", observe("update")),
+		cb.Delete().Before("gorm:delete").Register("updoc:metrics_before_delete", startTimer),
+		cb.Delete().After("gorm:delete").Register("updoc:metrics_after_delete", observe("delete")),
+		cb.Row().Before("gorm:row").Register("updoc:metrics_before_row", startTimer),
+		cb.Row().After("gorm:row").Register("updoc:metrics_after_row", observe("row")),
+		cb.Raw().Before("gorm:raw").Register("updoc:metrics_before_raw", startTimer),
+		cb.Raw().After("gorm:raw").Register("updoc:metrics_after_raw", observe("raw")),
+	)
+}
+
+func startTimer(db *gorm.DB) {
+	db.InstanceSet(metricsStartKey, time.Now())
+}
+
+func observe(operation string) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		v, ok := db.InstanceGet(metricsStartKey)
+		if !ok {
+			return
+		}
+		start, ok := v.(time.Time)
+		if !ok {
+			return
+		}
+
+		table := "unknown"
+		if db.Statement != nil && db.Statement.Table != "" {
+			table = db.Statement.Table
+		}
+		failed := db.Error != nil && !errors.Is(db.Error, gorm.ErrRecordNotFound)
+		metrics.ObserveDBQuery(operation, table, time.Since(start), failed)
+	}
+}
@@ -0,0 +1,85 @@
+package gormstore
+
+import (
+	"context"
+	"time"
+
+	"github.com/shaunpua/updoc/internal/doc"
+	"gorm.io/gorm"
+)
+
+type NotificationRepo struct{ DB *gorm.DB }
+
+func NewNotificationRepo(db *gorm.DB) *NotificationRepo { return &NotificationRepo{DB: db} }
+
+func (r *NotificationRepo) Create(ctx context.Context, n *doc.Notification) error {
+	dbNotification := Notification{
+		UserID:  n.UserID,
+		FlagID:  n.FlagID,
+		Type:    n.Type,
+		Message: n.Message,
+		ReadAt:  n.ReadAt,
+	}
+	if err := r.DB.WithContext(ctx).Create(&dbNotification).Error; err != nil {
+		return err
+	}
+
+	n.ID = dbNotification.ID
+	n.CreatedAt = dbNotification.CreatedAt
+	return nil
+}
+
+func (r *NotificationRepo) GetByID(ctx context.Context, id string) (*doc.Notification, error) {
+	var dbNotification Notification
+	if err := r.DB.WithContext(ctx).First(&dbNotification, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return toDomainNotification(dbNotification), nil
+}
+
+// GetByUserID returns a user's newest notifications first, only unread ones if unreadOnly
+func (r *NotificationRepo) GetByUserID(ctx context.Context, userID string, unreadOnly bool, limit int) ([]*doc.Notification, error) {
+	query := r.DB.WithContext(ctx).Where("user_id = ?", userID)
+	if unreadOnly {
+		query = query.Where("read_at IS NULL")
+	}
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+
+	var dbNotifications []Notification
+	if err := query.Order("created_at DESC").Find(&dbNotifications).Error; err != nil {
+		return nil, err
+	}
+
+	notifications := make([]*doc.Notification, len(dbNotifications))
+	for i, dbNotification := range dbNotifications {
+		notifications[i] = toDomainNotification(dbNotification)
+	}
+	return notifications, nil
+}
+
+// MarkAsRead stamps a notification read, keeping the time it was first read
+func (r *NotificationRepo) MarkAsRead(ctx context.Context, id string) error {
+	return r.DB.WithContext(ctx).Model(&Notification{}).
+		Where("id = ? AND read_at IS NULL", id).
+		Update("read_at", time.Now()).Error
+}
+
+func (r *NotificationRepo) MarkAllAsRead(ctx context.Context, userID string) error {
+	return r.DB.WithContext(ctx).Model(&Notification{}).
+		Where("user_id = ? AND read_at IS NULL", userID).
+		Update("read_at", time.Now()).Error
+}
+
+func toDomainNotification(n Notification) *doc.Notification {
+	return &doc.Notification{
+		ID:        n.ID,
+		UserID:    n.UserID,
+		FlagID:    n.FlagID,
+		Type:      n.Type,
+		Message:   n.Message,
+		ReadAt:    n.ReadAt,
+		CreatedAt: n.CreatedAt,
+	}
+}
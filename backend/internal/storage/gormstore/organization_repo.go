@@ -1,63 +1,166 @@
 package gormstore
 
 import (
+	"context"
+	"fmt"
+	"time"
+
 	"github.com/shaunpua/updoc/internal/doc"
+	"github.com/shaunpua/updoc/internal/secret"
+	"github.com/shaunpua/updoc/pkg/api"
 	"gorm.io/gorm"
 )
 
 type OrganizationRepo struct {
 	DB *gorm.DB
+
+	// Cipher encrypts Confluence tokens, including OAuth refresh tokens, at
+	// rest; nil stores them as plaintext
+	Cipher *secret.Cipher
 }
 
-func NewOrganizationRepo(db *gorm.DB) *OrganizationRepo {
-	return &OrganizationRepo{DB: db}
+func NewOrganizationRepo(db *gorm.DB, cipher *secret.Cipher) *OrganizationRepo {
+	return &OrganizationRepo{DB: db, Cipher: cipher}
 }
 
-func (r *OrganizationRepo) Create(org *doc.Organization) error {
+func (r *OrganizationRepo) Create(ctx context.Context, org *doc.Organization) error {
+	token, err := encryptSecret(r.Cipher, org.ConfluenceToken)
+	if err != nil {
+		return err
+	}
+
 	dbOrg := Organization{
 		Name:               org.Name,
 		Slug:               org.Slug,
 		ConfluenceBaseURL:  org.ConfluenceBaseURL,
+		ConfluenceAuthMode: org.ConfluenceAuthMode,
 		ConfluenceEmail:    org.ConfluenceEmail,
-		ConfluenceToken:    org.ConfluenceToken,
+		ConfluenceToken:    token,
 		ConfluenceSpaceKey: org.ConfluenceSpaceKey,
 	}
-	
-	if err := r.DB.Create(&dbOrg).Error; err != nil {
+
+	if err := r.DB.WithContext(ctx).Create(&dbOrg).Error; err != nil {
 		return err
 	}
-	
+
 	// Update the domain object with generated values
 	org.ID = dbOrg.ID
 	org.CreatedAt = dbOrg.CreatedAt
 	return nil
 }
 
-func (r *OrganizationRepo) GetBySlug(slug string) (*doc.Organization, error) {
+func (r *OrganizationRepo) GetBySlug(ctx context.Context, slug string) (*doc.Organization, error) {
 	var dbOrg Organization
-	if err := r.DB.Where("slug = ?", slug).First(&dbOrg).Error; err != nil {
+	if err := r.DB.WithContext(ctx).Where("slug = ?", slug).First(&dbOrg).Error; err != nil {
 		return nil, err
 	}
-	return r.toDomain(dbOrg), nil
+	return r.toDomain(dbOrg)
 }
 
-func (r *OrganizationRepo) GetByID(id string) (*doc.Organization, error) {
+func (r *OrganizationRepo) GetByID(ctx context.Context, id string) (*doc.Organization, error) {
 	var dbOrg Organization
-	if err := r.DB.Where("id = ?", id).First(&dbOrg).Error; err != nil {
+	if err := r.DB.WithContext(ctx).Where("id = ?", id).First(&dbOrg).Error; err != nil {
 		return nil, err
 	}
-	return r.toDomain(dbOrg), nil
+	return r.toDomain(dbOrg)
 }
 
-func (r *OrganizationRepo) toDomain(o Organization) *doc.Organization {
+func (r *OrganizationRepo) List(ctx context.Context) ([]*doc.Organization, error) {
+	var dbOrgs []Organization
+	if err := r.DB.WithContext(ctx).Order("created_at").Find(&dbOrgs).Error; err != nil {
+		return nil, err
+	}
+
+	orgs := make([]*doc.Organization, len(dbOrgs))
+	for i, dbOrg := range dbOrgs {
+		org, err := r.toDomain(dbOrg)
+		if err != nil {
+			return nil, err
+		}
+		orgs[i] = org
+	}
+	return orgs, nil
+}
+
+// UpdateConfluence saves org's Confluence connection fields
+func (r *OrganizationRepo) UpdateConfluence(ctx context.Context, org *doc.Organization) error {
+	token, err := encryptSecret(r.Cipher, org.ConfluenceToken)
+	if err != nil {
+		return err
+	}
+	refresh, err := encryptSecret(r.Cipher, org.ConfluenceRefreshToken)
+	if err != nil {
+		return err
+	}
+
+	return r.DB.WithContext(ctx).Model(&Organization{}).Where("id = ?", org.ID).
+		Select("confluence_base_url", "confluence_auth_mode", "confluence_email", "confluence_token",
+			"confluence_space_key", "confluence_cloud_id", "confluence_refresh_token", "confluence_token_expiry").
+		Updates(Organization{
+			ConfluenceBaseURL:      org.ConfluenceBaseURL,
+			ConfluenceAuthMode:     org.ConfluenceAuthMode,
+			ConfluenceEmail:        org.ConfluenceEmail,
+			ConfluenceToken:        token,
+			ConfluenceSpaceKey:     org.ConfluenceSpaceKey,
+			ConfluenceCloudID:      org.ConfluenceCloudID,
+			ConfluenceRefreshToken: refresh,
+			ConfluenceTokenExpiry:  optionalTime(org.ConfluenceTokenExpiry),
+		}).Error
+}
+
+// SaveConfluenceToken stores a refreshed OAuth grant
+func (r *OrganizationRepo) SaveConfluenceToken(ctx context.Context, id, accessToken, refreshToken string, expiry time.Time) error {
+	token, err := encryptSecret(r.Cipher, accessToken)
+	if err != nil {
+		return err
+	}
+	refresh, err := encryptSecret(r.Cipher, refreshToken)
+	if err != nil {
+		return err
+	}
+
+	return r.DB.WithContext(ctx).Model(&Organization{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"confluence_token":         token,
+		"confluence_refresh_token": refresh,
+		"confluence_token_expiry":  expiry,
+	}).Error
+}
+
+func (r *OrganizationRepo) toDomain(o Organization) (*doc.Organization, error) {
+	token, err := decryptSecret(r.Cipher, o.ConfluenceToken)
+	if err != nil {
+		return nil, fmt.Errorf("organization %s: confluence token: %w", o.Slug, err)
+	}
+	refresh, err := decryptSecret(r.Cipher, o.ConfluenceRefreshToken)
+	if err != nil {
+		return nil, fmt.Errorf("organization %s: confluence refresh token: %w", o.Slug, err)
+	}
+	var expiry time.Time
+	if o.ConfluenceTokenExpiry != nil {
+		expiry = *o.ConfluenceTokenExpiry
+	}
+
 	return &doc.Organization{
-		ID:                 o.ID,
-		Name:               o.Name,
-		Slug:               o.Slug,
-		CreatedAt:          o.CreatedAt,
-		ConfluenceBaseURL:  o.ConfluenceBaseURL,
-		ConfluenceEmail:    o.ConfluenceEmail,
-		ConfluenceToken:    o.ConfluenceToken,
-		ConfluenceSpaceKey: o.ConfluenceSpaceKey,
+		Organization: api.Organization{
+			ID:                 o.ID,
+			Name:               o.Name,
+			Slug:               o.Slug,
+			CreatedAt:          o.CreatedAt,
+			ConfluenceBaseURL:  o.ConfluenceBaseURL,
+			ConfluenceAuthMode: o.ConfluenceAuthMode,
+			ConfluenceEmail:    o.ConfluenceEmail,
+			ConfluenceSpaceKey: o.ConfluenceSpaceKey,
+			ConfluenceCloudID:  o.ConfluenceCloudID,
+		},
+		ConfluenceToken:        token,
+		ConfluenceRefreshToken: refresh,
+		ConfluenceTokenExpiry:  expiry,
+	}, nil
+}
+
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
 	}
+	return &t
 }
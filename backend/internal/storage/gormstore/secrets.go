@@ -0,0 +1,152 @@
+package gormstore
+
+import (
+	"fmt"
+
+	"github.com/shaunpua/updoc/internal/secret"
+	"gorm.io/gorm"
+)
+
+func encryptSecret(c *secret.Cipher, value string) (string, error) {
+	if c == nil {
+		return value, nil
+	}
+	return c.Encrypt(value)
+}
+
+func decryptSecret(c *secret.Cipher, value string) (string, error) {
+	if c == nil {
+		if secret.IsEncrypted(value) {
+			return "", fmt.Errorf("value is encrypted but no encryption key is configured")
+		}
+		return value, nil
+	}
+	return c.Decrypt(value)
+}
+
+// RotateEncryptionKey re-encrypts every stored secret, organizations'
+// Confluence tokens and workspaces' integration credentials: values are read
+// with from (which may be nil for plaintext rows) and written with to. It
+// runs in one transaction and returns the number of rows rewritten.
+func RotateEncryptionKey(db *gorm.DB, from, to *secret.Cipher) (int, error) {
+	rotated := 0
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var orgs []Organization
+		if err := tx.Select("id", "slug", "confluence_token", "confluence_refresh_token").Find(&orgs).Error; err != nil {
+			return err
+		}
+
+		for _, org := range orgs {
+			updates := map[string]interface{}{}
+			for column, value := range map[string]string{
+				"confluence_token":         org.ConfluenceToken,
+				"confluence_refresh_token": org.ConfluenceRefreshToken,
+			} {
+				if value == "" {
+					continue
+				}
+				plaintext, err := decryptSecret(from, value)
+				if err != nil {
+					return fmt.Errorf("organization %s: %s: %w", org.Slug, column, err)
+				}
+				ciphertext, err := encryptSecret(to, plaintext)
+				if err != nil {
+					return fmt.Errorf("organization %s: %s: %w", org.Slug, column, err)
+				}
+				updates[column] = ciphertext
+			}
+			if len(updates) == 0 {
+				continue
+			}
+			if err := tx.Model(&Organization{}).Where("id = ?", org.ID).Updates(updates).Error; err != nil {
+				return err
+			}
+			rotated++
+		}
+
+		var workspaces []Workspace
+		if err := tx.Select("id", "name", "integration_config").Find(&workspaces).Error; err != nil {
+			return err
+		}
+		for _, ws := range workspaces {
+			if !hasSecrets(ws.IntegrationConfig) {
+				continue
+			}
+			plaintext, err := mapSecrets(ws.IntegrationConfig, func(v string) (string, error) { return decryptSecret(from, v) })
+			if err != nil {
+				return fmt.Errorf("workspace %s: %w", ws.Name, err)
+			}
+			config, err := mapSecrets(plaintext, func(v string) (string, error) { return encryptSecret(to, v) })
+			if err != nil {
+				return fmt.Errorf("workspace %s: %w", ws.Name, err)
+			}
+			if err := tx.Model(&Workspace{ID: ws.ID}).Select("IntegrationConfig").
+				Updates(Workspace{IntegrationConfig: config}).Error; err != nil {
+				return err
+			}
+			rotated++
+		}
+		return nil
+	})
+	return rotated, err
+}
+
+// EncryptWorkspaceSecrets encrypts integration credentials that are still
+// stored as plaintext, such as those saved before encryption was enabled or
+// before their key was treated as a secret, and returns the number of
+// workspaces rewritten. Encrypted values are left alone, so it is safe to
+// run on every start; with a nil cipher it does nothing.
+func EncryptWorkspaceSecrets(db *gorm.DB, c *secret.Cipher) (int, error) {
+	if c == nil {
+		return 0, nil
+	}
+	encrypted := 0
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var workspaces []Workspace
+		if err := tx.Select("id", "name", "integration_config").Find(&workspaces).Error; err != nil {
+			return err
+		}
+		for _, ws := range workspaces {
+			if !hasPlaintextSecrets(ws.IntegrationConfig) {
+				continue
+			}
+			config, err := mapSecrets(ws.IntegrationConfig, func(v string) (string, error) {
+				if secret.IsEncrypted(v) {
+					return v, nil
+				}
+				return c.Encrypt(v)
+			})
+			if err != nil {
+				return fmt.Errorf("workspace %s: %w", ws.Name, err)
+			}
+			if err := tx.Model(&Workspace{ID: ws.ID}).Select("IntegrationConfig").
+				Updates(Workspace{IntegrationConfig: config}).Error; err != nil {
+				return err
+			}
+			encrypted++
+		}
+		return nil
+	})
+	return encrypted, err
+}
+
+// hasPlaintextSecrets reports whether an integration config holds any
+// credentials that aren't encrypted
+func hasPlaintextSecrets(config map[string]interface{}) bool {
+	for _, key := range secretConfigKeys {
+		if value, _ := config[key].(string); value != "" && !secret.IsEncrypted(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasSecrets reports whether an integration config holds any credentials
+func hasSecrets(config map[string]interface{}) bool {
+	for _, key := range secretConfigKeys {
+		if value, _ := config[key].(string); value != "" {
+			return true
+		}
+	}
+	return false
+}
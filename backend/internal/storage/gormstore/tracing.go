@@ -0,0 +1,84 @@
+package gormstore
+
+import (
+	"errors"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+const tracingSpanKey = "updoc:tracing_span"
+
+var tracer = otel.Tracer("github.com/shaunpua/updoc/internal/storage/gormstore")
+
+// Tracing is a GORM plugin that records a client span per query, parented to
+// the span in the statement's context. Repositories must pass their context
+// with WithContext for spans to join the request's trace. Only the SQL text
+// is recorded, never bound parameters.
+type Tracing struct{}
+
+func (Tracing) Name() string { return "updoc:tracing" }
+
+func (Tracing) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+	return errors.Join(
+		cb.Create().Before("gorm:create").Register("updoc:tracing_before_create", startSpan("create")),
+		cb.Create().After("gorm:create").Register("updoc:tracing_after_create", endSpan),
+		cb.Query().Before("gorm:query").Register("updoc:tracing_before_query", startSpan("query")),
+		cb.Query().After("gorm:query").Register("updoc:tracing_after_query", endSpan),
+		cb.Update().Before("gorm:update").Register("updoc:tracing_before_update", startSpan("update")),
+		cb.Update().After("gorm:update").Register("updoc:tracing_after_update", endSpan),
+		cb.Delete().Before("gorm:delete").Register("updoc:tracing_before_delete", startSpan("delete")),
+		cb.Delete().After("gorm:delete").Register("updoc:tracing_after_delete", endSpan),
+		cb.Row().Before("gorm:row").Register("updoc:tracing_before_row", startSpan("row")),
+		cb.Row().After("gorm:row").Register("updoc:tracing_after_row", endSpan),
+		cb.Raw().Before("gorm:raw").Register("updoc:tracing_before_raw", startSpan("raw")),
+		cb.Raw().After("gorm:raw").Register("updoc:tracing_after_raw", endSpan),
+	)
+}
+
+func startSpan(operation string) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		if db.Statement == nil || db.Statement.Context == nil {
+			return
+		}
+
+		name := "db." + operation
+		if db.Statement.Table != "" {
+			name += " " + db.Statement.Table
+		}
+		ctx, span := tracer.Start(db.Statement.Context, name,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(
+				attribute.String("db.system", "postgresql"),
+				attribute.String("db.operation", operation),
+				attribute.String("db.sql.table", db.Statement.Table),
+			))
+		db.Statement.Context = ctx
+		db.InstanceSet(tracingSpanKey, span)
+	}
+}
+
+func endSpan(db *gorm.DB) {
+	v, ok := db.InstanceGet(tracingSpanKey)
+	if !ok {
+		return
+	}
+	span, ok := v.(trace.Span)
+	if !ok {
+		return
+	}
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("db.statement", db.Statement.SQL.String()),
+		attribute.Int64("db.rows_affected", db.RowsAffected),
+	)
+	if db.Error != nil && !errors.Is(db.Error, gorm.ErrRecordNotFound) {
+		span.RecordError(db.Error)
+		span.SetStatus(codes.Error, db.Error.Error())
+	}
+}
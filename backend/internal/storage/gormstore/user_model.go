@@ -11,10 +11,16 @@ type Organization struct {
 
 	// Confluence Integration (simplified)
 	ConfluenceBaseURL string `json:"confluence_base_url" gorm:"column:confluence_base_url"`
+	ConfluenceAuthMode string `json:"confluence_auth_mode" gorm:"column:confluence_auth_mode"`
 	ConfluenceEmail   string `json:"confluence_email" gorm:"column:confluence_email"`
 	ConfluenceToken   string `json:"confluence_token" gorm:"column:confluence_token"`
 	ConfluenceSpaceKey string `json:"confluence_space_key" gorm:"column:confluence_space_key"`
 
+	// OAuth connections; the access token is kept in confluence_token
+	ConfluenceCloudID      string     `json:"confluence_cloud_id" gorm:"column:confluence_cloud_id"`
+	ConfluenceRefreshToken string     `json:"-" gorm:"column:confluence_refresh_token"`
+	ConfluenceTokenExpiry  *time.Time `json:"-" gorm:"column:confluence_token_expiry"`
+
 	// Relationships
 	Users      []User      `gorm:"foreignKey:OrgID"`
 	Workspaces []Workspace `gorm:"foreignKey:OrgID"`
@@ -34,6 +40,9 @@ type User struct {
 	IsActive  bool      `json:"is_active" gorm:"default:true"`
 	CreatedAt time.Time `json:"created_at" gorm:"autoCreateTime"`
 
+	// SHA-256 of the user's API token; the token itself is never stored
+	APITokenHash string `json:"-" gorm:"column:api_token_hash;index"`
+
 	// Relationships
 	Organization   Organization   `gorm:"foreignKey:OrgID"`
 	CreatedFlags   []Flag         `gorm:"foreignKey:CreatedBy"`
@@ -52,7 +61,7 @@ type Workspace struct {
 	OrgID             string                 `json:"org_id" gorm:"not null;type:uuid"`
 	Name              string                 `json:"name" gorm:"not null"`
 	IntegrationType   string                 `json:"integration_type"` // confluence, notion, github
-	IntegrationConfig map[string]interface{} `json:"integration_config" gorm:"type:jsonb"`
+	IntegrationConfig map[string]interface{} `json:"integration_config" gorm:"type:jsonb;serializer:json"`
 	IsDefault         bool                   `json:"is_default" gorm:"default:false"`
 	CreatedAt         time.Time              `json:"created_at" gorm:"autoCreateTime"`
 
@@ -68,14 +77,26 @@ func (Workspace) TableName() string {
 // Document represents a trackable piece of documentation
 type Document struct {
 	ID          string    `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
-	WorkspaceID string    `json:"workspace_id" gorm:"not null;type:uuid"`
+	WorkspaceID string    `json:"workspace_id" gorm:"not null;type:uuid;uniqueIndex:idx_documents_workspace_url"`
 	Title       string    `json:"title" gorm:"not null"`
-	URL         string    `json:"url" gorm:"not null;unique"`
+	URL         string    `json:"url" gorm:"not null;uniqueIndex:idx_documents_workspace_url"` // unique per workspace; orgs may track the same page
 	ExternalID  string    `json:"external_id"` // page_id, file_path, etc.
-	OwnerID     string    `json:"owner_id" gorm:"type:uuid"`
+	OwnerID     *string   `json:"owner_id" gorm:"type:uuid"`
 	LastChecked time.Time `json:"last_checked"`
 	CreatedAt   time.Time `json:"created_at" gorm:"autoCreateTime"`
 
+	RemovedAt    *time.Time `json:"removed_at"`
+	LastEventAt  *time.Time `json:"last_event_at"`
+	LastEventIDs []string   `json:"last_event_ids" gorm:"type:jsonb;serializer:json"`
+	Labels       []string   `json:"labels" gorm:"type:jsonb;serializer:json"`
+
+	ParentPageID    string   `json:"parent_page_id"`
+	AncestorPageIDs []string `json:"ancestor_page_ids" gorm:"type:jsonb;serializer:json"`
+
+	SourceRepository string   `json:"source_repository"`
+	SourcePaths      []string `json:"source_paths" gorm:"type:jsonb;serializer:json"`
+	SourceSymbols    []string `json:"source_symbols" gorm:"type:jsonb;serializer:json"`
+
 	// Relationships
 	Workspace Workspace `gorm:"foreignKey:WorkspaceID"`
 	Owner     *User     `gorm:"foreignKey:OwnerID"`
@@ -91,7 +112,7 @@ type Notification struct {
 	ID        string     `json:"id" gorm:"primaryKey;type:uuid;default:gen_random_uuid()"`
 	UserID    string     `json:"user_id" gorm:"not null;type:uuid"`
 	FlagID    string     `json:"flag_id" gorm:"not null;type:uuid"`
-	Type      string     `json:"type" gorm:"not null"` // flag_created, flag_assigned, flag_resolved
+	Type      string     `json:"type" gorm:"not null"` // flag_created, flag_assigned, flag_resolved, flag_reopened, verification_requested
 	Message   string     `json:"message" gorm:"type:text"`
 	ReadAt    *time.Time `json:"read_at"`
 	CreatedAt time.Time  `json:"created_at" gorm:"autoCreateTime"`
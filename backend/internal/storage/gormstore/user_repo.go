@@ -1,6 +1,7 @@
 package gormstore
 
 import (
+	"context"
 	"github.com/shaunpua/updoc/internal/doc"
 	"gorm.io/gorm"
 )
@@ -10,7 +11,7 @@ type UserRepo struct{ DB *gorm.DB }
 func NewUserRepo(db *gorm.DB) *UserRepo { return &UserRepo{DB: db} }
 
 // Implement new UserRepository interface
-func (r *UserRepo) Create(user *doc.User) error {
+func (r *UserRepo) Create(ctx context.Context, user *doc.User) error {
 	dbUser := User{
 		Email:    user.Email,
 		Name:     user.Name,
@@ -19,7 +20,7 @@ func (r *UserRepo) Create(user *doc.User) error {
 		IsActive: true,
 	}
 
-	if err := r.DB.Create(&dbUser).Error; err != nil {
+	if err := r.DB.WithContext(ctx).Create(&dbUser).Error; err != nil {
 		return err
 	}
 
@@ -29,18 +30,18 @@ func (r *UserRepo) Create(user *doc.User) error {
 	return nil
 }
 
-func (r *UserRepo) GetByEmail(email string) (*doc.User, error) {
+func (r *UserRepo) GetByEmail(ctx context.Context, email string) (*doc.User, error) {
 	var dbUser User
-	if err := r.DB.Where("email = ?", email).First(&dbUser).Error; err != nil {
+	if err := r.DB.WithContext(ctx).Where("email = ?", email).First(&dbUser).Error; err != nil {
 		return nil, err
 	}
 
 	return r.toDomainUser(dbUser), nil
 }
 
-func (r *UserRepo) GetByOrgID(orgID string) ([]*doc.User, error) {
+func (r *UserRepo) GetByOrgID(ctx context.Context, orgID string) ([]*doc.User, error) {
 	var dbUsers []User
-	if err := r.DB.Where("org_id = ? AND is_active = true", orgID).Find(&dbUsers).Error; err != nil {
+	if err := r.DB.WithContext(ctx).Where("org_id = ? AND is_active = true", orgID).Find(&dbUsers).Error; err != nil {
 		return nil, err
 	}
 
@@ -51,15 +52,28 @@ func (r *UserRepo) GetByOrgID(orgID string) ([]*doc.User, error) {
 	return users, nil
 }
 
-func (r *UserRepo) GetByID(id string) (*doc.User, error) {
+func (r *UserRepo) GetByID(ctx context.Context, id string) (*doc.User, error) {
 	var dbUser User
-	if err := r.DB.Where("id = ?", id).First(&dbUser).Error; err != nil {
+	if err := r.DB.WithContext(ctx).Where("id = ?", id).First(&dbUser).Error; err != nil {
 		return nil, err
 	}
 
 	return r.toDomainUser(dbUser), nil
 }
 
+func (r *UserRepo) GetByAPITokenHash(ctx context.Context, hash string) (*doc.User, error) {
+	var dbUser User
+	if err := r.DB.WithContext(ctx).Where("api_token_hash = ? AND is_active = true", hash).First(&dbUser).Error; err != nil {
+		return nil, err
+	}
+
+	return r.toDomainUser(dbUser), nil
+}
+
+func (r *UserRepo) SetAPITokenHash(ctx context.Context, id, hash string) error {
+	return r.DB.WithContext(ctx).Model(&User{}).Where("id = ?", id).Update("api_token_hash", hash).Error
+}
+
 // Helper method to convert GORM model to domain model
 func (r *UserRepo) toDomainUser(dbUser User) *doc.User {
 	return &doc.User{
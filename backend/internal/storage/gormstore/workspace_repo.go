@@ -0,0 +1,128 @@
+package gormstore
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/shaunpua/updoc/internal/doc"
+	"github.com/shaunpua/updoc/internal/secret"
+	"gorm.io/gorm"
+)
+
+type WorkspaceRepo struct {
+	DB *gorm.DB
+
+	// Cipher encrypts the integration config's secretConfigKeys at rest;
+	// nil stores them as plaintext
+	Cipher *secret.Cipher
+}
+
+func NewWorkspaceRepo(db *gorm.DB, cipher *secret.Cipher) *WorkspaceRepo {
+	return &WorkspaceRepo{DB: db, Cipher: cipher}
+}
+
+// secretConfigKeys are the integration config keys holding credentials:
+// Notion tokens and Confluence webhook secrets
+var secretConfigKeys = []string{"notion_token", "webhook_secret"}
+
+func (r *WorkspaceRepo) Create(ctx context.Context, ws *doc.Workspace) error {
+	config, err := mapSecrets(ws.IntegrationConfig, func(v string) (string, error) { return encryptSecret(r.Cipher, v) })
+	if err != nil {
+		return err
+	}
+
+	dbWs := Workspace{
+		OrgID:             ws.OrgID,
+		Name:              ws.Name,
+		IntegrationType:   ws.IntegrationType,
+		IntegrationConfig: config,
+		IsDefault:         ws.IsDefault,
+	}
+
+	if err := r.DB.WithContext(ctx).Create(&dbWs).Error; err != nil {
+		return err
+	}
+
+	ws.ID = dbWs.ID
+	ws.CreatedAt = dbWs.CreatedAt
+	return nil
+}
+
+func (r *WorkspaceRepo) GetByOrgID(ctx context.Context, orgID string) ([]*doc.Workspace, error) {
+	var dbWorkspaces []Workspace
+	if err := r.DB.WithContext(ctx).Where("org_id = ?", orgID).Order("is_default DESC, created_at").
+		Find(&dbWorkspaces).Error; err != nil {
+		return nil, err
+	}
+
+	workspaces := make([]*doc.Workspace, len(dbWorkspaces))
+	for i, dbWs := range dbWorkspaces {
+		ws, err := r.toDomain(dbWs)
+		if err != nil {
+			return nil, err
+		}
+		workspaces[i] = ws
+	}
+	return workspaces, nil
+}
+
+func (r *WorkspaceRepo) GetByID(ctx context.Context, id string) (*doc.Workspace, error) {
+	var dbWs Workspace
+	if err := r.DB.WithContext(ctx).Where("id = ?", id).First(&dbWs).Error; err != nil {
+		return nil, err
+	}
+	return r.toDomain(dbWs)
+}
+
+func (r *WorkspaceRepo) UpdateIntegration(ctx context.Context, id string, config map[string]interface{}) error {
+	config, err := mapSecrets(config, func(v string) (string, error) { return encryptSecret(r.Cipher, v) })
+	if err != nil {
+		return err
+	}
+	return r.DB.WithContext(ctx).Model(&Workspace{ID: id}).
+		Select("IntegrationConfig").
+		Updates(Workspace{IntegrationConfig: config}).Error
+}
+
+func (r *WorkspaceRepo) toDomain(w Workspace) (*doc.Workspace, error) {
+	config, err := mapSecrets(w.IntegrationConfig, func(v string) (string, error) { return decryptSecret(r.Cipher, v) })
+	if err != nil {
+		return nil, fmt.Errorf("workspace %s: %w", w.ID, err)
+	}
+	return &doc.Workspace{
+		ID:                w.ID,
+		OrgID:             w.OrgID,
+		Name:              w.Name,
+		IntegrationType:   w.IntegrationType,
+		IntegrationConfig: config,
+		IsDefault:         w.IsDefault,
+		CreatedAt:         w.CreatedAt,
+	}, nil
+}
+
+// mapSecrets returns a copy of config with f applied to its non-empty
+// secrets, or config itself when it has none
+func mapSecrets(config map[string]interface{}, f func(string) (string, error)) (map[string]interface{}, error) {
+	var out map[string]interface{}
+	for _, key := range secretConfigKeys {
+		value, _ := config[key].(string)
+		if value == "" {
+			continue
+		}
+		mapped, err := f(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", key, err)
+		}
+		if out == nil {
+			out = make(map[string]interface{}, len(config))
+			for k, v := range config {
+				out[k] = v
+			}
+		}
+		out[key] = mapped
+	}
+	if out == nil {
+		return config, nil
+	}
+	return out, nil
+}
@@ -0,0 +1,647 @@
+// Package memstore keeps UpDoc's data in memory, for tests and demos. Its
+// repositories implement the doc interfaces with the same lookups and
+// ordering as gormstore's, and hand out copies so callers can't change
+// stored rows without saving them, but nothing outlives the process.
+package memstore
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shaunpua/updoc/internal/doc"
+)
+
+// ErrNotFound is returned for lookups that match nothing
+var ErrNotFound = errors.New("memstore: record not found")
+
+var (
+	_ doc.OrganizationRepository = (*OrganizationRepo)(nil)
+	_ doc.UserRepository         = (*UserRepo)(nil)
+	_ doc.WorkspaceRepository    = (*WorkspaceRepo)(nil)
+	_ doc.DocumentRepository     = (*DocumentRepo)(nil)
+	_ doc.FlagRepository         = (*FlagRepo)(nil)
+	_ doc.NotificationRepository = (*NotificationRepo)(nil)
+)
+
+// Store holds every table. Its repositories share it and are safe for
+// concurrent use.
+type Store struct {
+	mu  sync.Mutex
+	seq int
+
+	orgs          map[string]*doc.Organization
+	users         map[string]*doc.User
+	tokenHashes   map[string]string
+	workspaces    map[string]*doc.Workspace
+	documents     map[string]*doc.Document
+	flags         map[string]*doc.Flag
+	notifications map[string]*doc.Notification
+}
+
+func New() *Store {
+	return &Store{
+		orgs:          make(map[string]*doc.Organization),
+		users:         make(map[string]*doc.User),
+		tokenHashes:   make(map[string]string),
+		workspaces:    make(map[string]*doc.Workspace),
+		documents:     make(map[string]*doc.Document),
+		flags:         make(map[string]*doc.Flag),
+		notifications: make(map[string]*doc.Notification),
+	}
+}
+
+func (s *Store) Organizations() *OrganizationRepo { return &OrganizationRepo{s} }
+func (s *Store) Users() *UserRepo                 { return &UserRepo{s} }
+func (s *Store) Workspaces() *WorkspaceRepo       { return &WorkspaceRepo{s} }
+func (s *Store) Documents() *DocumentRepo         { return &DocumentRepo{s} }
+func (s *Store) Flags() *FlagRepo                 { return &FlagRepo{s} }
+func (s *Store) Notifications() *NotificationRepo { return &NotificationRepo{s} }
+
+// newID returns a UUID-shaped ID that sorts in creation order. The caller
+// must hold s.mu.
+func (s *Store) newID() string {
+	s.seq++
+	return fmt.Sprintf("00000000-0000-4000-8000-%012d", s.seq)
+}
+
+// now stands in for a column's default when t is unset
+func now(t time.Time) time.Time {
+	if t.IsZero() {
+		return time.Now()
+	}
+	return t
+}
+
+type OrganizationRepo struct{ s *Store }
+
+func (r *OrganizationRepo) Create(_ context.Context, org *doc.Organization) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	for _, o := range r.s.orgs {
+		if o.Slug == org.Slug {
+			return fmt.Errorf("memstore: organization slug %q already exists", org.Slug)
+		}
+	}
+	org.ID = r.s.newID()
+	org.CreatedAt = now(org.CreatedAt)
+	stored := *org
+	r.s.orgs[org.ID] = &stored
+	return nil
+}
+
+func (r *OrganizationRepo) GetBySlug(_ context.Context, slug string) (*doc.Organization, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	for _, o := range r.s.orgs {
+		if o.Slug == slug {
+			org := *o
+			return &org, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *OrganizationRepo) GetByID(_ context.Context, id string) (*doc.Organization, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	o, ok := r.s.orgs[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	org := *o
+	return &org, nil
+}
+
+func (r *OrganizationRepo) List(_ context.Context) ([]*doc.Organization, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	var orgs []*doc.Organization
+	for _, o := range r.s.orgs {
+		org := *o
+		orgs = append(orgs, &org)
+	}
+	slices.SortFunc(orgs, func(a, b *doc.Organization) int {
+		return cmp.Or(a.CreatedAt.Compare(b.CreatedAt), strings.Compare(a.ID, b.ID))
+	})
+	return orgs, nil
+}
+
+func (r *OrganizationRepo) UpdateConfluence(_ context.Context, org *doc.Organization) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	o, ok := r.s.orgs[org.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	o.ConfluenceBaseURL = org.ConfluenceBaseURL
+	o.ConfluenceAuthMode = org.ConfluenceAuthMode
+	o.ConfluenceEmail = org.ConfluenceEmail
+	o.ConfluenceToken = org.ConfluenceToken
+	o.ConfluenceSpaceKey = org.ConfluenceSpaceKey
+	o.ConfluenceCloudID = org.ConfluenceCloudID
+	o.ConfluenceRefreshToken = org.ConfluenceRefreshToken
+	o.ConfluenceTokenExpiry = org.ConfluenceTokenExpiry
+	return nil
+}
+
+func (r *OrganizationRepo) SaveConfluenceToken(_ context.Context, id, accessToken, refreshToken string, expiry time.Time) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	o, ok := r.s.orgs[id]
+	if !ok {
+		return ErrNotFound
+	}
+	o.ConfluenceToken, o.ConfluenceRefreshToken, o.ConfluenceTokenExpiry = accessToken, refreshToken, expiry
+	return nil
+}
+
+type UserRepo struct{ s *Store }
+
+func (r *UserRepo) Create(_ context.Context, user *doc.User) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	for _, u := range r.s.users {
+		if strings.EqualFold(u.Email, user.Email) {
+			return fmt.Errorf("memstore: user email %q already exists", user.Email)
+		}
+	}
+	user.ID = r.s.newID()
+	user.IsActive = true
+	user.CreatedAt = now(user.CreatedAt)
+	stored := *user
+	r.s.users[user.ID] = &stored
+	return nil
+}
+
+func (r *UserRepo) GetByEmail(_ context.Context, email string) (*doc.User, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	for _, u := range r.s.users {
+		if u.Email == email {
+			user := *u
+			return &user, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// GetByOrgID returns the organization's active users
+func (r *UserRepo) GetByOrgID(_ context.Context, orgID string) ([]*doc.User, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	var users []*doc.User
+	for _, u := range r.s.users {
+		if u.OrgID == orgID && u.IsActive {
+			user := *u
+			users = append(users, &user)
+		}
+	}
+	slices.SortFunc(users, func(a, b *doc.User) int {
+		return cmp.Or(a.CreatedAt.Compare(b.CreatedAt), strings.Compare(a.ID, b.ID))
+	})
+	return users, nil
+}
+
+func (r *UserRepo) GetByID(_ context.Context, id string) (*doc.User, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	u, ok := r.s.users[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	user := *u
+	return &user, nil
+}
+
+func (r *UserRepo) GetByAPITokenHash(_ context.Context, hash string) (*doc.User, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	for id, h := range r.s.tokenHashes {
+		if u := r.s.users[id]; h == hash && u != nil && u.IsActive {
+			user := *u
+			return &user, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *UserRepo) SetAPITokenHash(_ context.Context, id, hash string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	if _, ok := r.s.users[id]; !ok {
+		return ErrNotFound
+	}
+	r.s.tokenHashes[id] = hash
+	return nil
+}
+
+type WorkspaceRepo struct{ s *Store }
+
+func (r *WorkspaceRepo) Create(_ context.Context, ws *doc.Workspace) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	ws.ID = r.s.newID()
+	ws.CreatedAt = now(ws.CreatedAt)
+	stored := *ws
+	stored.IntegrationConfig = copyConfig(ws.IntegrationConfig)
+	r.s.workspaces[ws.ID] = &stored
+	return nil
+}
+
+// GetByOrgID returns the organization's workspaces, the default first
+func (r *WorkspaceRepo) GetByOrgID(_ context.Context, orgID string) ([]*doc.Workspace, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	var workspaces []*doc.Workspace
+	for _, w := range r.s.workspaces {
+		if w.OrgID == orgID {
+			workspaces = append(workspaces, copyWorkspace(w))
+		}
+	}
+	slices.SortFunc(workspaces, func(a, b *doc.Workspace) int {
+		if a.IsDefault != b.IsDefault {
+			if a.IsDefault {
+				return -1
+			}
+			return 1
+		}
+		return cmp.Or(a.CreatedAt.Compare(b.CreatedAt), strings.Compare(a.ID, b.ID))
+	})
+	return workspaces, nil
+}
+
+func (r *WorkspaceRepo) GetByID(_ context.Context, id string) (*doc.Workspace, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	w, ok := r.s.workspaces[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return copyWorkspace(w), nil
+}
+
+func (r *WorkspaceRepo) UpdateIntegration(_ context.Context, id string, config map[string]interface{}) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	w, ok := r.s.workspaces[id]
+	if !ok {
+		return ErrNotFound
+	}
+	w.IntegrationConfig = copyConfig(config)
+	return nil
+}
+
+func copyWorkspace(w *doc.Workspace) *doc.Workspace {
+	ws := *w
+	ws.IntegrationConfig = copyConfig(w.IntegrationConfig)
+	return &ws
+}
+
+// copyConfig copies the top level of an integration config; nested values
+// are replaced, never changed in place, by the services
+func copyConfig(config map[string]interface{}) map[string]interface{} {
+	if config == nil {
+		return nil
+	}
+	copied := make(map[string]interface{}, len(config))
+	for k, v := range config {
+		copied[k] = v
+	}
+	return copied
+}
+
+type DocumentRepo struct{ s *Store }
+
+func (r *DocumentRepo) Create(_ context.Context, d *doc.Document) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	return r.create(d)
+}
+
+// create stores d; the caller must hold r.s.mu
+func (r *DocumentRepo) create(d *doc.Document) error {
+	for _, existing := range r.s.documents {
+		if existing.WorkspaceID == d.WorkspaceID && existing.URL == d.URL {
+			return fmt.Errorf("memstore: document URL %q already exists in workspace %s", d.URL, d.WorkspaceID)
+		}
+	}
+	d.ID = r.s.newID()
+	d.CreatedAt = now(d.CreatedAt)
+	r.s.documents[d.ID] = copyDocument(d)
+	return nil
+}
+
+// GetByWorkspaceID returns the workspace's documents ordered by title
+func (r *DocumentRepo) GetByWorkspaceID(_ context.Context, workspaceID string) ([]*doc.Document, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	var docs []*doc.Document
+	for _, d := range r.s.documents {
+		if d.WorkspaceID == workspaceID {
+			docs = append(docs, copyDocument(d))
+		}
+	}
+	slices.SortFunc(docs, func(a, b *doc.Document) int {
+		return cmp.Or(strings.Compare(a.Title, b.Title), strings.Compare(a.ID, b.ID))
+	})
+	return docs, nil
+}
+
+func (r *DocumentRepo) GetByURL(_ context.Context, workspaceIDs []string, url string) (*doc.Document, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	var found *doc.Document
+	for _, d := range r.s.documents {
+		if d.URL == url && slices.Contains(workspaceIDs, d.WorkspaceID) && (found == nil || d.CreatedAt.Before(found.CreatedAt)) {
+			found = d
+		}
+	}
+	if found == nil {
+		return nil, ErrNotFound
+	}
+	return copyDocument(found), nil
+}
+
+func (r *DocumentRepo) GetByID(_ context.Context, id string) (*doc.Document, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	d, ok := r.s.documents[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return copyDocument(d), nil
+}
+
+func (r *DocumentRepo) GetByExternalIDs(_ context.Context, workspaceIDs, externalIDs []string) ([]*doc.Document, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	var docs []*doc.Document
+	for _, d := range r.s.documents {
+		if slices.Contains(workspaceIDs, d.WorkspaceID) && slices.Contains(externalIDs, d.ExternalID) {
+			docs = append(docs, copyDocument(d))
+		}
+	}
+	slices.SortFunc(docs, func(a, b *doc.Document) int {
+		return cmp.Or(a.CreatedAt.Compare(b.CreatedAt), strings.Compare(a.ID, b.ID))
+	})
+	return docs, nil
+}
+
+func (r *DocumentRepo) BulkCreate(_ context.Context, docs []*doc.Document) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	for _, d := range docs {
+		if err := r.create(d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *DocumentRepo) Update(_ context.Context, d *doc.Document) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	if _, ok := r.s.documents[d.ID]; !ok {
+		return ErrNotFound
+	}
+	r.s.documents[d.ID] = copyDocument(d)
+	return nil
+}
+
+func copyDocument(d *doc.Document) *doc.Document {
+	document := *d
+	document.LastEventIDs = slices.Clone(d.LastEventIDs)
+	document.Labels = slices.Clone(d.Labels)
+	document.AncestorPageIDs = slices.Clone(d.AncestorPageIDs)
+	document.SourcePaths = slices.Clone(d.SourcePaths)
+	document.SourceSymbols = slices.Clone(d.SourceSymbols)
+	return &document
+}
+
+type FlagRepo struct{ s *Store }
+
+func (r *FlagRepo) Create(_ context.Context, flag *doc.Flag) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	flag.ID = r.s.newID()
+	flag.CreatedAt = now(flag.CreatedAt)
+	flag.UpdatedAt = now(flag.UpdatedAt)
+	r.s.flags[flag.ID] = storedFlag(flag)
+	return nil
+}
+
+func (r *FlagRepo) GetByID(_ context.Context, id string) (*doc.Flag, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	f, ok := r.s.flags[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return r.load(f), nil
+}
+
+func (r *FlagRepo) GetByDocumentID(_ context.Context, documentID string) ([]*doc.Flag, error) {
+	return r.find(func(f *doc.Flag) bool { return f.DocumentID == documentID }), nil
+}
+
+func (r *FlagRepo) GetByDocumentIDs(_ context.Context, documentIDs []string) ([]*doc.Flag, error) {
+	return r.find(func(f *doc.Flag) bool { return slices.Contains(documentIDs, f.DocumentID) }), nil
+}
+
+// GetByFilters returns the flags matching every filter set, newest first
+func (r *FlagRepo) GetByFilters(_ context.Context, filters doc.FlagFilters) ([]*doc.Flag, error) {
+	search := strings.ToLower(filters.Search)
+	flags := r.find(func(f *doc.Flag) bool {
+		switch {
+		case filters.Status != "" && f.Status != filters.Status,
+			filters.Priority != "" && f.Priority != filters.Priority,
+			filters.AssignedTo != "" && (f.AssignedTo == nil || *f.AssignedTo != filters.AssignedTo),
+			filters.CreatedBy != "" && f.CreatedBy != filters.CreatedBy:
+			return false
+		case search != "" && !strings.Contains(strings.ToLower(f.Title), search) &&
+			!strings.Contains(strings.ToLower(f.Description), search):
+			return false
+		}
+		if filters.WorkspaceID == "" && filters.OrgID == "" {
+			return true
+		}
+		d, ok := r.s.documents[f.DocumentID]
+		if !ok || (filters.WorkspaceID != "" && d.WorkspaceID != filters.WorkspaceID) {
+			return false
+		}
+		ws, ok := r.s.workspaces[d.WorkspaceID]
+		return ok && (filters.OrgID == "" || ws.OrgID == filters.OrgID)
+	})
+	slices.Reverse(flags)
+	return flags, nil
+}
+
+func (r *FlagRepo) Update(_ context.Context, flag *doc.Flag) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	if _, ok := r.s.flags[flag.ID]; !ok {
+		return ErrNotFound
+	}
+	r.s.flags[flag.ID] = storedFlag(flag)
+	return nil
+}
+
+// CountOpen counts flags that are neither resolved nor archived, grouped by
+// priority and status
+func (r *FlagRepo) CountOpen(_ context.Context) ([]doc.FlagCount, error) {
+	counts := make(map[doc.FlagCount]int64)
+	for _, f := range r.find(open) {
+		counts[doc.FlagCount{Priority: f.Priority, Status: f.Status}]++
+	}
+	var out []doc.FlagCount
+	for key, n := range counts {
+		key.Count = n
+		out = append(out, key)
+	}
+	slices.SortFunc(out, func(a, b doc.FlagCount) int {
+		return cmp.Or(strings.Compare(a.Priority, b.Priority), strings.Compare(a.Status, b.Status))
+	})
+	return out, nil
+}
+
+func (r *FlagRepo) CountOpenByDocument(_ context.Context, documentIDs []string) (map[string]int, error) {
+	counts := make(map[string]int)
+	for _, f := range r.find(func(f *doc.Flag) bool { return open(f) && slices.Contains(documentIDs, f.DocumentID) }) {
+		counts[f.DocumentID]++
+	}
+	return counts, nil
+}
+
+func (r *FlagRepo) GetWatched(_ context.Context) ([]*doc.Flag, error) {
+	flags := r.find(func(f *doc.Flag) bool {
+		return (f.Status == doc.FlagStatusPending || f.Status == doc.FlagStatusInProgress) && f.PageVersion > 0
+	})
+	slices.SortStableFunc(flags, func(a, b *doc.Flag) int { return strings.Compare(a.DocumentID, b.DocumentID) })
+	return flags, nil
+}
+
+func open(f *doc.Flag) bool {
+	return f.Status != doc.FlagStatusResolved && f.Status != doc.FlagStatusArchived
+}
+
+// find returns the flags match accepts, oldest first, with their document,
+// creator and assignee
+func (r *FlagRepo) find(match func(*doc.Flag) bool) []*doc.Flag {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	var flags []*doc.Flag
+	for _, f := range r.s.flags {
+		if match(f) {
+			flags = append(flags, r.load(f))
+		}
+	}
+	slices.SortFunc(flags, func(a, b *doc.Flag) int {
+		return cmp.Or(a.CreatedAt.Compare(b.CreatedAt), strings.Compare(a.ID, b.ID))
+	})
+	return flags
+}
+
+// load copies a stored flag with its related rows, as gormstore preloads
+// them; the caller must hold r.s.mu
+func (r *FlagRepo) load(f *doc.Flag) *doc.Flag {
+	flag := storedFlag(f)
+	if d, ok := r.s.documents[f.DocumentID]; ok {
+		flag.Document = copyDocument(d)
+	}
+	if u, ok := r.s.users[f.CreatedBy]; ok {
+		creator := *u
+		flag.Creator = &creator
+	}
+	if f.AssignedTo != nil {
+		if u, ok := r.s.users[*f.AssignedTo]; ok {
+			assignee := *u
+			flag.Assignee = &assignee
+		}
+	}
+	return flag
+}
+
+// storedFlag copies a flag's own columns, leaving out related rows
+func storedFlag(f *doc.Flag) *doc.Flag {
+	flag := *f
+	if f.AssignedTo != nil {
+		assignedTo := *f.AssignedTo
+		flag.AssignedTo = &assignedTo
+	}
+	flag.SourceCommits = slices.Clone(f.SourceCommits)
+	flag.Document, flag.Creator, flag.Assignee = nil, nil, nil
+	return &flag
+}
+
+type NotificationRepo struct{ s *Store }
+
+func (r *NotificationRepo) Create(_ context.Context, n *doc.Notification) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	n.ID = r.s.newID()
+	n.CreatedAt = now(n.CreatedAt)
+	stored := *n
+	stored.Actions = nil
+	r.s.notifications[n.ID] = &stored
+	return nil
+}
+
+func (r *NotificationRepo) GetByID(_ context.Context, id string) (*doc.Notification, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	n, ok := r.s.notifications[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	notification := *n
+	return &notification, nil
+}
+
+// GetByUserID returns a user's newest notifications first, only unread ones
+// if unreadOnly
+func (r *NotificationRepo) GetByUserID(_ context.Context, userID string, unreadOnly bool, limit int) ([]*doc.Notification, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	var notifications []*doc.Notification
+	for _, n := range r.s.notifications {
+		if n.UserID == userID && (!unreadOnly || n.ReadAt == nil) {
+			notification := *n
+			notifications = append(notifications, &notification)
+		}
+	}
+	slices.SortFunc(notifications, func(a, b *doc.Notification) int {
+		return cmp.Or(b.CreatedAt.Compare(a.CreatedAt), strings.Compare(b.ID, a.ID))
+	})
+	if limit > 0 && len(notifications) > limit {
+		notifications = notifications[:limit]
+	}
+	return notifications, nil
+}
+
+func (r *NotificationRepo) MarkAsRead(_ context.Context, id string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	if n, ok := r.s.notifications[id]; ok && n.ReadAt == nil {
+		at := time.Now()
+		n.ReadAt = &at
+	}
+	return nil
+}
+
+func (r *NotificationRepo) MarkAllAsRead(_ context.Context, userID string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	at := time.Now()
+	for _, n := range r.s.notifications {
+		if n.UserID == userID && n.ReadAt == nil {
+			n.ReadAt = &at
+		}
+	}
+	return nil
+}
@@ -0,0 +1,20 @@
+package memstore
+
+import (
+	"testing"
+
+	"github.com/shaunpua/updoc/internal/storage/storagetest"
+)
+
+func TestRepositories(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storagetest.Repos {
+		s := New()
+		return storagetest.Repos{
+			Organizations: s.Organizations(),
+			Users:         s.Users(),
+			Workspaces:    s.Workspaces(),
+			Documents:     s.Documents(),
+			Flags:         s.Flags(),
+		}
+	})
+}
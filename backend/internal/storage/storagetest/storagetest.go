@@ -0,0 +1,344 @@
+// Package storagetest checks that a store's repositories agree on the
+// behaviour the services rely on, so tests over memstore stand for gormstore
+package storagetest
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shaunpua/updoc/internal/doc"
+)
+
+// Repos are the repositories of one store
+type Repos struct {
+	Organizations doc.OrganizationRepository
+	Users         doc.UserRepository
+	Workspaces    doc.WorkspaceRepository
+	Documents     doc.DocumentRepository
+	Flags         doc.FlagRepository
+}
+
+// missingID is a well-formed ID that no store hands out
+const missingID = "00000000-0000-4000-8000-000000000000"
+
+// Run runs the repository tests, calling newRepos for an empty store in each
+func Run(t *testing.T, newRepos func(t *testing.T) Repos) {
+	t.Run("CountOpen", func(t *testing.T) { testCountOpen(t, newRepos(t)) })
+	t.Run("CountOpenByDocument", func(t *testing.T) { testCountOpenByDocument(t, newRepos(t)) })
+	t.Run("GetByExternalIDs", func(t *testing.T) { testGetByExternalIDs(t, newRepos(t)) })
+	t.Run("DocumentPageColumns", func(t *testing.T) { testDocumentPageColumns(t, newRepos(t)) })
+	t.Run("GetByDocumentIDs", func(t *testing.T) { testGetByDocumentIDs(t, newRepos(t)) })
+	t.Run("SourceColumns", func(t *testing.T) { testSourceColumns(t, newRepos(t)) })
+}
+
+// fixture is an org with one user and workspace, to hang documents and
+// flags off
+type fixture struct {
+	Repos
+	user *doc.User
+	ws   *doc.Workspace
+	n    int
+}
+
+func newFixture(t *testing.T, repos Repos) *fixture {
+	t.Helper()
+	ctx := context.Background()
+	f := &fixture{Repos: repos}
+
+	org := &doc.Organization{}
+	org.Name, org.Slug = "Acme", "acme"
+	if err := repos.Organizations.Create(ctx, org); err != nil {
+		t.Fatalf("create org: %v", err)
+	}
+	f.user = &doc.User{Email: "admin@acme.test", Name: "Admin", OrgID: org.ID, Role: "admin"}
+	if err := repos.Users.Create(ctx, f.user); err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	f.ws = f.workspace(t, org.ID, "Engineering")
+	return f
+}
+
+func (f *fixture) workspace(t *testing.T, orgID, name string) *doc.Workspace {
+	t.Helper()
+	ws := &doc.Workspace{OrgID: orgID, Name: name, IntegrationType: "confluence"}
+	if err := f.Workspaces.Create(context.Background(), ws); err != nil {
+		t.Fatalf("create workspace %s: %v", name, err)
+	}
+	return ws
+}
+
+// document creates d in its workspace, or the fixture's, with a title and
+// URL when they're unset
+func (f *fixture) document(t *testing.T, d *doc.Document) *doc.Document {
+	t.Helper()
+	f.n++
+	if d.WorkspaceID == "" {
+		d.WorkspaceID = f.ws.ID
+	}
+	if d.Title == "" {
+		d.Title = fmt.Sprintf("Page %d", f.n)
+	}
+	if d.URL == "" {
+		d.URL = fmt.Sprintf("https://acme.atlassian.net/wiki/pages/%d", f.n)
+	}
+	if err := f.Documents.Create(context.Background(), d); err != nil {
+		t.Fatalf("create document %s: %v", d.Title, err)
+	}
+	return d
+}
+
+func (f *fixture) flag(t *testing.T, d *doc.Document, priority, status string) *doc.Flag {
+	t.Helper()
+	flag := &doc.Flag{
+		DocumentID:  d.ID,
+		CreatedBy:   f.user.ID,
+		Title:       "Out of date",
+		Description: "The page no longer matches the code",
+		Priority:    priority,
+		Status:      status,
+	}
+	if err := f.Flags.Create(context.Background(), flag); err != nil {
+		t.Fatalf("create flag: %v", err)
+	}
+	return flag
+}
+
+func testCountOpen(t *testing.T, repos Repos) {
+	f := newFixture(t, repos)
+	page, other := f.document(t, &doc.Document{}), f.document(t, &doc.Document{})
+	f.flag(t, page, doc.PriorityHigh, doc.FlagStatusPending)
+	f.flag(t, other, doc.PriorityHigh, doc.FlagStatusPending)
+	f.flag(t, page, doc.PriorityHigh, doc.FlagStatusInProgress)
+	f.flag(t, page, doc.PriorityLow, doc.FlagStatusAwaitingVerification)
+	f.flag(t, page, doc.PriorityUrgent, doc.FlagStatusResolved)
+	f.flag(t, other, doc.PriorityMedium, doc.FlagStatusArchived)
+
+	counts, err := repos.Flags.CountOpen(context.Background())
+	if err != nil {
+		t.Fatalf("CountOpen: %v", err)
+	}
+	slices.SortFunc(counts, func(a, b doc.FlagCount) int {
+		return cmp.Or(strings.Compare(a.Priority, b.Priority), strings.Compare(a.Status, b.Status))
+	})
+	want := []doc.FlagCount{
+		{Priority: doc.PriorityHigh, Status: doc.FlagStatusInProgress, Count: 1},
+		{Priority: doc.PriorityHigh, Status: doc.FlagStatusPending, Count: 2},
+		{Priority: doc.PriorityLow, Status: doc.FlagStatusAwaitingVerification, Count: 1},
+	}
+	if !slices.Equal(counts, want) {
+		t.Errorf("CountOpen = %+v, want %+v", counts, want)
+	}
+}
+
+func testCountOpenByDocument(t *testing.T, repos Repos) {
+	f := newFixture(t, repos)
+	ctx := context.Background()
+	busy, closed, unasked := f.document(t, &doc.Document{}), f.document(t, &doc.Document{}), f.document(t, &doc.Document{})
+	f.flag(t, busy, doc.PriorityHigh, doc.FlagStatusPending)
+	f.flag(t, busy, doc.PriorityLow, doc.FlagStatusAwaitingVerification)
+	f.flag(t, busy, doc.PriorityLow, doc.FlagStatusResolved)
+	f.flag(t, closed, doc.PriorityMedium, doc.FlagStatusArchived)
+	f.flag(t, unasked, doc.PriorityMedium, doc.FlagStatusPending)
+
+	counts, err := repos.Flags.CountOpenByDocument(ctx, []string{busy.ID, closed.ID, missingID})
+	if err != nil {
+		t.Fatalf("CountOpenByDocument: %v", err)
+	}
+	if want := map[string]int{busy.ID: 2}; !reflect.DeepEqual(counts, want) {
+		t.Errorf("CountOpenByDocument = %v, want %v", counts, want)
+	}
+
+	counts, err = repos.Flags.CountOpenByDocument(ctx, nil)
+	if err != nil || counts == nil || len(counts) != 0 {
+		t.Errorf("CountOpenByDocument(nil) = %v, %v; want an empty map", counts, err)
+	}
+}
+
+func testGetByExternalIDs(t *testing.T, repos Repos) {
+	f := newFixture(t, repos)
+	ctx := context.Background()
+	ops := f.workspace(t, f.ws.OrgID, "Operations")
+	engAPI := f.document(t, &doc.Document{ExternalID: "102"})
+	engRunbook := f.document(t, &doc.Document{ExternalID: "103"})
+	opsAPI := f.document(t, &doc.Document{WorkspaceID: ops.ID, ExternalID: "102"})
+	f.document(t, &doc.Document{WorkspaceID: ops.ID, ExternalID: "202"})
+
+	tests := []struct {
+		name         string
+		workspaceIDs []string
+		externalIDs  []string
+		want         []*doc.Document
+	}{
+		{"one workspace", []string{f.ws.ID}, []string{"102", "103", "999"}, []*doc.Document{engAPI, engRunbook}},
+		{"page in both", []string{f.ws.ID, ops.ID}, []string{"102"}, []*doc.Document{engAPI, opsAPI}},
+		{"other workspace's page", []string{ops.ID}, []string{"103"}, nil},
+		{"unknown workspace", []string{missingID}, []string{"102"}, nil},
+		{"no workspaces", nil, []string{"102"}, nil},
+		{"no pages", []string{f.ws.ID}, nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			docs, err := repos.Documents.GetByExternalIDs(ctx, tt.workspaceIDs, tt.externalIDs)
+			if err != nil {
+				t.Fatalf("GetByExternalIDs: %v", err)
+			}
+			if got, want := documentIDs(docs), documentIDs(tt.want); !slices.Equal(got, want) {
+				t.Errorf("GetByExternalIDs = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+// testDocumentPageColumns checks the Confluence page state a sync or webhook
+// records survives a round trip, and clears on update
+func testDocumentPageColumns(t *testing.T, repos Repos) {
+	f := newFixture(t, repos)
+	ctx := context.Background()
+	eventAt := time.Date(2025, 3, 14, 9, 30, 0, 0, time.UTC)
+	d := f.document(t, &doc.Document{
+		ExternalID:      "104",
+		LastEventAt:     &eventAt,
+		LastEventIDs:    []string{"evt-1", "evt-2"},
+		Labels:          []string{"api", "public"},
+		ParentPageID:    "102",
+		AncestorPageIDs: []string{"101", "102"},
+	})
+
+	got, err := repos.Documents.GetByID(ctx, d.ID)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if got.LastEventAt == nil || !got.LastEventAt.Equal(eventAt) {
+		t.Errorf("LastEventAt = %v, want %v", got.LastEventAt, eventAt)
+	}
+	if !slices.Equal(got.LastEventIDs, d.LastEventIDs) {
+		t.Errorf("LastEventIDs = %q, want %q", got.LastEventIDs, d.LastEventIDs)
+	}
+	if !slices.Equal(got.Labels, d.Labels) {
+		t.Errorf("Labels = %q, want %q", got.Labels, d.Labels)
+	}
+	if got.ParentPageID != "102" || !slices.Equal(got.AncestorPageIDs, d.AncestorPageIDs) {
+		t.Errorf("parent %q, ancestors %q; want 102, %q", got.ParentPageID, got.AncestorPageIDs, d.AncestorPageIDs)
+	}
+
+	// The page lost its labels and moved to the top of the space
+	got.Labels, got.ParentPageID, got.AncestorPageIDs = nil, "", nil
+	got.LastEventIDs = []string{"evt-3"}
+	if err := repos.Documents.Update(ctx, got); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	got, err = repos.Documents.GetByID(ctx, d.ID)
+	if err != nil {
+		t.Fatalf("GetByID after update: %v", err)
+	}
+	if len(got.Labels) != 0 || got.ParentPageID != "" || len(got.AncestorPageIDs) != 0 {
+		t.Errorf("after update: labels %q, parent %q, ancestors %q; want none", got.Labels, got.ParentPageID, got.AncestorPageIDs)
+	}
+	if !slices.Equal(got.LastEventIDs, []string{"evt-3"}) {
+		t.Errorf("LastEventIDs after update = %q, want [evt-3]", got.LastEventIDs)
+	}
+}
+
+func testGetByDocumentIDs(t *testing.T, repos Repos) {
+	f := newFixture(t, repos)
+	ctx := context.Background()
+	api, runbook, other := f.document(t, &doc.Document{}), f.document(t, &doc.Document{}), f.document(t, &doc.Document{})
+	apiPending := f.flag(t, api, doc.PriorityHigh, doc.FlagStatusPending)
+	apiResolved := f.flag(t, api, doc.PriorityLow, doc.FlagStatusResolved)
+	runbookPending := f.flag(t, runbook, doc.PriorityMedium, doc.FlagStatusPending)
+	f.flag(t, other, doc.PriorityMedium, doc.FlagStatusPending)
+
+	flags, err := repos.Flags.GetByDocumentIDs(ctx, []string{api.ID, runbook.ID, missingID})
+	if err != nil {
+		t.Fatalf("GetByDocumentIDs: %v", err)
+	}
+	got := make([]string, len(flags))
+	for i, flag := range flags {
+		got[i] = flag.ID
+		if flag.Creator == nil || flag.Creator.ID != f.user.ID {
+			t.Errorf("flag %s creator = %+v, want %s", flag.ID, flag.Creator, f.user.ID)
+		}
+	}
+	slices.Sort(got)
+	want := []string{apiPending.ID, apiResolved.ID, runbookPending.ID}
+	slices.Sort(want)
+	if !slices.Equal(got, want) {
+		t.Errorf("GetByDocumentIDs = %v, want %v", got, want)
+	}
+
+	flags, err = repos.Flags.GetByDocumentIDs(ctx, nil)
+	if err != nil || len(flags) != 0 {
+		t.Errorf("GetByDocumentIDs(nil) = %d flags, %v; want none", len(flags), err)
+	}
+}
+
+// testSourceColumns checks a document's links to code and the commits that
+// flagged it survive a round trip
+func testSourceColumns(t *testing.T, repos Repos) {
+	f := newFixture(t, repos)
+	ctx := context.Background()
+	d := f.document(t, &doc.Document{
+		SourceRepository: "https://github.com/acme/billing",
+		SourcePaths:      []string{"services/billing/**", "cmd/invoice/*.go"},
+		SourceSymbols:    []string{"ChargeCustomer"},
+	})
+
+	got, err := repos.Documents.GetByID(ctx, d.ID)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if got.SourceRepository != d.SourceRepository || !slices.Equal(got.SourcePaths, d.SourcePaths) || !slices.Equal(got.SourceSymbols, d.SourceSymbols) {
+		t.Errorf("source = %q %q %q, want %q %q %q", got.SourceRepository, got.SourcePaths, got.SourceSymbols,
+			d.SourceRepository, d.SourcePaths, d.SourceSymbols)
+	}
+
+	// Unlinking the code clears the paths and symbols
+	got.SourceRepository, got.SourcePaths, got.SourceSymbols = "", nil, nil
+	if err := repos.Documents.Update(ctx, got); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	got, err = repos.Documents.GetByID(ctx, d.ID)
+	if err != nil {
+		t.Fatalf("GetByID after update: %v", err)
+	}
+	if got.SourceRepository != "" || len(got.SourcePaths) != 0 || len(got.SourceSymbols) != 0 {
+		t.Errorf("source after update = %q %q %q, want none", got.SourceRepository, got.SourcePaths, got.SourceSymbols)
+	}
+
+	flag := &doc.Flag{
+		DocumentID:    d.ID,
+		CreatedBy:     f.user.ID,
+		Title:         "Linked code changed",
+		Description:   "services/billing/charge.go changed",
+		Priority:      doc.PriorityMedium,
+		Status:        doc.FlagStatusPending,
+		SourceCommits: []string{"4b825dc", "9fceb02"},
+		PullRequest:   "https://github.com/acme/billing/pull/42",
+	}
+	if err := repos.Flags.Create(ctx, flag); err != nil {
+		t.Fatalf("create flag: %v", err)
+	}
+	stored, err := repos.Flags.GetByID(ctx, flag.ID)
+	if err != nil {
+		t.Fatalf("GetByID flag: %v", err)
+	}
+	if !slices.Equal(stored.SourceCommits, flag.SourceCommits) || stored.PullRequest != flag.PullRequest {
+		t.Errorf("flag source = %q %q, want %q %q", stored.SourceCommits, stored.PullRequest, flag.SourceCommits, flag.PullRequest)
+	}
+}
+
+// documentIDs returns the documents' IDs, sorted
+func documentIDs(docs []*doc.Document) []string {
+	ids := make([]string, len(docs))
+	for i, d := range docs {
+		ids[i] = d.ID
+	}
+	slices.Sort(ids)
+	return ids
+}
@@ -0,0 +1,318 @@
+// Package textdiff compares texts line by line and formats the differences
+// as unified diffs or side-by-side rows.
+package textdiff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Op is what an edit does to a line
+type Op string
+
+const (
+	Equal  Op = "equal"
+	Delete Op = "delete"
+	Insert Op = "insert"
+	// Change pairs a deleted line with the line inserted in its place; it
+	// only appears in side-by-side rows
+	Change Op = "change"
+)
+
+// maxEditDistance bounds the search for a shortest diff, whose memory grows
+// with the square of the distance. Texts further apart than this are
+// reported as replaced wholesale past their common prefix and suffix.
+const maxEditDistance = 1000
+
+// Edit is one line of a diff
+type Edit struct {
+	Op   Op
+	Text string
+}
+
+// Lines diffs a and b split into lines. A trailing newline does not count as
+// an extra, empty line.
+func Lines(a, b string) []Edit {
+	return Diff(splitLines(a), splitLines(b))
+}
+
+func splitLines(s string) []string {
+	s = strings.TrimSuffix(strings.ReplaceAll(s, "\r\n", "\n"), "\n")
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
+
+// Diff returns a shortest sequence of edits turning a into b
+func Diff(a, b []string) []Edit {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	edits := make([]Edit, 0, len(a)+len(b)-prefix-suffix)
+	for _, line := range a[:prefix] {
+		edits = append(edits, Edit{Equal, line})
+	}
+	edits = append(edits, myers(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, line := range a[len(a)-suffix:] {
+		edits = append(edits, Edit{Equal, line})
+	}
+	return edits
+}
+
+// myers is Myers' O((N+M)D) shortest edit script
+func myers(a, b []string) []Edit {
+	n, m := len(a), len(b)
+	if n == 0 || m == 0 {
+		return replace(a, b)
+	}
+
+	offset := n + m + 1
+	v := make([]int, 2*offset+1)
+	// trace[d] holds v[k] for k in [-d-1, d+1] as it was before round d
+	var trace [][]int
+	for d := 0; d <= n+m; d++ {
+		if d > maxEditDistance {
+			return replace(a, b)
+		}
+		trace = append(trace, append([]int(nil), v[offset-d-1:offset+d+2]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				return backtrack(a, b, trace)
+			}
+		}
+	}
+	return replace(a, b)
+}
+
+func backtrack(a, b []string, trace [][]int) []Edit {
+	var reversed []Edit
+	x, y := len(a), len(b)
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		at := func(k int) int { return v[k+d+1] }
+		k := x - y
+		prevK := k - 1
+		if k == -d || (k != d && at(k-1) < at(k+1)) {
+			prevK = k + 1
+		}
+		prevX := at(prevK)
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			x--
+			y--
+			reversed = append(reversed, Edit{Equal, a[x]})
+		}
+		if d > 0 {
+			if x == prevX {
+				reversed = append(reversed, Edit{Insert, b[prevY]})
+			} else {
+				reversed = append(reversed, Edit{Delete, a[prevX]})
+			}
+		}
+		x, y = prevX, prevY
+	}
+
+	edits := make([]Edit, len(reversed))
+	for i, e := range reversed {
+		edits[len(reversed)-1-i] = e
+	}
+	return edits
+}
+
+func replace(a, b []string) []Edit {
+	edits := make([]Edit, 0, len(a)+len(b))
+	for _, line := range a {
+		edits = append(edits, Edit{Delete, line})
+	}
+	for _, line := range b {
+		edits = append(edits, Edit{Insert, line})
+	}
+	return edits
+}
+
+// Stats counts the lines added and removed by edits
+func Stats(edits []Edit) (added, removed int) {
+	for _, e := range edits {
+		switch e.Op {
+		case Insert:
+			added++
+		case Delete:
+			removed++
+		}
+	}
+	return added, removed
+}
+
+// Hunk is a run of changes with up to context unchanged lines around them.
+// Lines are 1-based; a hunk that adds to or removes everything from a side
+// has a count of 0 there and starts at the line before.
+type Hunk struct {
+	FromLine, FromCount int
+	ToLine, ToCount     int
+	Edits               []Edit
+}
+
+// Header is the hunk's unified diff range line
+func (h Hunk) Header() string {
+	return fmt.Sprintf("@@ -%s +%s @@", hunkRange(h.FromLine, h.FromCount), hunkRange(h.ToLine, h.ToCount))
+}
+
+func hunkRange(line, count int) string {
+	if count == 1 {
+		return fmt.Sprint(line)
+	}
+	return fmt.Sprintf("%d,%d", line, count)
+}
+
+// Hunks groups edits into hunks with context lines of unchanged text on
+// either side; changes closer than twice that share a hunk. Unchanged texts
+// have no hunks.
+func Hunks(edits []Edit, context int) []Hunk {
+	if context < 0 {
+		context = 0
+	}
+	var hunks []Hunk
+	from, to := 0, 0 // lines of each side before edits[i]
+	for i := 0; i < len(edits); {
+		if edits[i].Op == Equal {
+			from++
+			to++
+			i++
+			continue
+		}
+
+		start := max(0, i-context)
+		last := i
+		for j := i; j < len(edits); j++ {
+			if edits[j].Op != Equal {
+				last = j
+			} else if j-last > 2*context {
+				break
+			}
+		}
+		end := min(len(edits), last+1+context)
+
+		h := Hunk{Edits: edits[start:end]}
+		// Context lines before the change were already counted
+		h.FromLine, h.ToLine = from-(i-start)+1, to-(i-start)+1
+		for _, e := range h.Edits {
+			if e.Op != Insert {
+				h.FromCount++
+			}
+			if e.Op != Delete {
+				h.ToCount++
+			}
+		}
+		from += h.FromCount - (i - start)
+		to += h.ToCount - (i - start)
+		if h.FromCount == 0 {
+			h.FromLine--
+		}
+		if h.ToCount == 0 {
+			h.ToLine--
+		}
+		hunks = append(hunks, h)
+		i = end
+	}
+	return hunks
+}
+
+// Unified formats edits as a unified diff between files named from and to,
+// or returns "" if the texts are the same
+func Unified(edits []Edit, from, to string, context int) string {
+	hunks := Hunks(edits, context)
+	if len(hunks) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", from, to)
+	for _, h := range hunks {
+		sb.WriteString(h.Header() + "\n")
+		for _, e := range h.Edits {
+			switch e.Op {
+			case Equal:
+				sb.WriteString(" ")
+			case Delete:
+				sb.WriteString("-")
+			case Insert:
+				sb.WriteString("+")
+			}
+			sb.WriteString(e.Text + "\n")
+		}
+	}
+	return sb.String()
+}
+
+// Row is one line of a side-by-side diff. A side a row has no line on has
+// a line number of 0.
+type Row struct {
+	Op        Op     `json:"op"`
+	LeftLine  int    `json:"left_line,omitempty"`
+	Left      string `json:"left"`
+	RightLine int    `json:"right_line,omitempty"`
+	Right     string `json:"right"`
+}
+
+// Rows lays the hunk out side by side, pairing lines deleted with the lines
+// inserted in their place
+func (h Hunk) Rows() []Row {
+	var rows []Row
+	left, right := h.FromLine, h.ToLine
+	if h.FromCount == 0 {
+		left++
+	}
+	if h.ToCount == 0 {
+		right++
+	}
+	for i := 0; i < len(h.Edits); {
+		if h.Edits[i].Op == Equal {
+			rows = append(rows, Row{Op: Equal, LeftLine: left, Left: h.Edits[i].Text, RightLine: right, Right: h.Edits[i].Text})
+			left++
+			right++
+			i++
+			continue
+		}
+
+		var deleted, inserted []string
+		for ; i < len(h.Edits) && h.Edits[i].Op == Delete; i++ {
+			deleted = append(deleted, h.Edits[i].Text)
+		}
+		for ; i < len(h.Edits) && h.Edits[i].Op == Insert; i++ {
+			inserted = append(inserted, h.Edits[i].Text)
+		}
+		for j := 0; j < max(len(deleted), len(inserted)); j++ {
+			switch {
+			case j < len(deleted) && j < len(inserted):
+				rows = append(rows, Row{Op: Change, LeftLine: left, Left: deleted[j], RightLine: right, Right: inserted[j]})
+				left++
+				right++
+			case j < len(deleted):
+				rows = append(rows, Row{Op: Delete, LeftLine: left, Left: deleted[j]})
+				left++
+			default:
+				rows = append(rows, Row{Op: Insert, RightLine: right, Right: inserted[j]})
+				right++
+			}
+		}
+	}
+	return rows
+}
@@ -0,0 +1,200 @@
+package textdiff
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"testing"
+)
+
+// sides rebuilds the two texts edits were made from
+func sides(edits []Edit) (a, b []string) {
+	for _, e := range edits {
+		if e.Op != Insert {
+			a = append(a, e.Text)
+		}
+		if e.Op != Delete {
+			b = append(b, e.Text)
+		}
+	}
+	return a, b
+}
+
+// patch applies hunks to a by their line numbers alone, as patch(1) would
+func patch(t *testing.T, a []string, hunks []Hunk) []string {
+	t.Helper()
+	var out []string
+	next := 0 // index in a of the first line not yet copied
+	for _, h := range hunks {
+		start := h.FromLine - 1
+		if h.FromCount == 0 {
+			start = h.FromLine
+		}
+		if start < next || start > len(a) {
+			t.Fatalf("hunk %s starts outside the text", h.Header())
+		}
+		out = append(out, a[next:start]...)
+		next = start
+		for _, e := range h.Edits {
+			switch e.Op {
+			case Equal, Delete:
+				if next >= len(a) || a[next] != e.Text {
+					t.Fatalf("hunk %s doesn't match line %d", h.Header(), next+1)
+				}
+				if e.Op == Equal {
+					out = append(out, e.Text)
+				}
+				next++
+			case Insert:
+				out = append(out, e.Text)
+			}
+		}
+	}
+	return append(out, a[next:]...)
+}
+
+// lcs is the length of the longest common subsequence of a and b
+func lcs(a, b []string) int {
+	prev, cur := make([]int, len(b)+1), make([]int, len(b)+1)
+	for i := range a {
+		for j := range b {
+			if a[i] == b[j] {
+				cur[j+1] = prev[j] + 1
+			} else {
+				cur[j+1] = max(cur[j], prev[j+1])
+			}
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+func randomLines(r *rand.Rand, n int) []string {
+	lines := make([]string, n)
+	for i := range lines {
+		lines[i] = string(rune('a' + r.IntN(4)))
+	}
+	return lines
+}
+
+func TestDiffReproducesBothTexts(t *testing.T) {
+	r := rand.New(rand.NewPCG(1, 2))
+	for i := 0; i < 500; i++ {
+		a, b := randomLines(r, r.IntN(12)), randomLines(r, r.IntN(12))
+		edits := Diff(a, b)
+		gotA, gotB := sides(edits)
+		if !slices.Equal(gotA, a) || !slices.Equal(gotB, b) {
+			t.Fatalf("Diff(%v, %v) = %v, which turns %v into %v", a, b, edits, gotA, gotB)
+		}
+		// A shortest diff keeps every line of a longest common subsequence
+		added, removed := Stats(edits)
+		if want := len(a) + len(b) - 2*lcs(a, b); added+removed != want {
+			t.Fatalf("Diff(%v, %v) has %d edits, want %d", a, b, added+removed, want)
+		}
+		for _, context := range []int{0, 1, 3} {
+			if got := patch(t, a, Hunks(edits, context)); !slices.Equal(got, b) {
+				t.Fatalf("patching %v with context %d = %v, want %v", a, context, got, b)
+			}
+		}
+	}
+}
+
+func TestDiffBeyondMaxEditDistance(t *testing.T) {
+	var a, b []string
+	for i := 0; i < maxEditDistance; i++ {
+		a = append(a, fmt.Sprintf("old %d", i))
+		b = append(b, fmt.Sprintf("new %d", i))
+	}
+	a = append([]string{"head"}, append(a, "tail")...)
+	b = append([]string{"head"}, append(b, "tail")...)
+
+	edits := Diff(a, b)
+	gotA, gotB := sides(edits)
+	if !slices.Equal(gotA, a) || !slices.Equal(gotB, b) {
+		t.Fatal("a diff past the maximum distance doesn't reproduce the texts")
+	}
+	if edits[0] != (Edit{Equal, "head"}) || edits[len(edits)-1] != (Edit{Equal, "tail"}) {
+		t.Errorf("common prefix and suffix = %v, %v, want them kept", edits[0], edits[len(edits)-1])
+	}
+	if added, removed := Stats(edits); added != maxEditDistance || removed != maxEditDistance {
+		t.Errorf("Stats = +%d -%d, want every middle line replaced", added, removed)
+	}
+}
+
+func TestLines(t *testing.T) {
+	tests := []struct {
+		name, a, b string
+		want       []Edit
+	}{
+		{"both empty", "", "", nil},
+		{"identical", "one\ntwo\n", "one\ntwo\n", []Edit{{Equal, "one"}, {Equal, "two"}}},
+		{"trailing newline", "one\ntwo", "one\ntwo\n", []Edit{{Equal, "one"}, {Equal, "two"}}},
+		{"line endings", "one\r\ntwo\r\n", "one\ntwo\n", []Edit{{Equal, "one"}, {Equal, "two"}}},
+		{"from empty", "", "one\ntwo\n", []Edit{{Insert, "one"}, {Insert, "two"}}},
+		{"to empty", "one\n", "", []Edit{{Delete, "one"}}},
+		{"blank line", "one\ntwo\n", "one\n\ntwo\n", []Edit{{Equal, "one"}, {Insert, ""}, {Equal, "two"}}},
+		{"changed line", "one\ntwo\nthree\n", "one\n2\nthree\n", []Edit{{Equal, "one"}, {Delete, "two"}, {Insert, "2"}, {Equal, "three"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Lines(tt.a, tt.b); !slices.Equal(got, tt.want) {
+				t.Errorf("Lines = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnified(t *testing.T) {
+	if got := Unified(Lines("same\n", "same\n"), "a", "b", 3); got != "" {
+		t.Errorf("Unified of identical texts = %q, want empty", got)
+	}
+	if got := Unified(Lines("", ""), "a", "b", 3); got != "" {
+		t.Errorf("Unified of empty texts = %q, want empty", got)
+	}
+
+	tests := []struct {
+		name, a, b string
+		context    int
+		want       string
+	}{
+		{"from empty", "", "one\ntwo\n", 3, "--- a\n+++ b\n@@ -0,0 +1,2 @@\n+one\n+two\n"},
+		{"to empty", "one\ntwo\n", "", 3, "--- a\n+++ b\n@@ -1,2 +0,0 @@\n-one\n-two\n"},
+		{"change with context", "1\n2\n3\n4\n5\n", "1\n2\nthree\n4\n5\n", 1, "--- a\n+++ b\n@@ -2,3 +2,3 @@\n 2\n-3\n+three\n 4\n"},
+		{"separate hunks", "1\n2\n3\n4\n5\n6\n7\n8\n", "one\n2\n3\n4\n5\n6\n7\neight\n", 1,
+			"--- a\n+++ b\n@@ -1,2 +1,2 @@\n-1\n+one\n 2\n@@ -7,2 +7,2 @@\n 7\n-8\n+eight\n"},
+		{"nearby changes share a hunk", "1\n2\n3\n4\n", "one\n2\n3\nfour\n", 1,
+			"--- a\n+++ b\n@@ -1,4 +1,4 @@\n-1\n+one\n 2\n 3\n-4\n+four\n"},
+		{"insert without context", "1\n2\n", "1\nnew\n2\n", 0, "--- a\n+++ b\n@@ -1,0 +2 @@\n+new\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Unified(Lines(tt.a, tt.b), "a", "b", tt.context); got != tt.want {
+				t.Errorf("Unified =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRows(t *testing.T) {
+	hunks := Hunks(Lines("keep\nold 1\nold 2\nold 3\nend\n", "keep\nnew 1\nend\nadded\n"), 1)
+	if len(hunks) != 1 {
+		t.Fatalf("Hunks = %v, want one", hunks)
+	}
+	want := []Row{
+		{Op: Equal, LeftLine: 1, Left: "keep", RightLine: 1, Right: "keep"},
+		{Op: Change, LeftLine: 2, Left: "old 1", RightLine: 2, Right: "new 1"},
+		{Op: Delete, LeftLine: 3, Left: "old 2"},
+		{Op: Delete, LeftLine: 4, Left: "old 3"},
+		{Op: Equal, LeftLine: 5, Left: "end", RightLine: 3, Right: "end"},
+		{Op: Insert, RightLine: 4, Right: "added"},
+	}
+	if got := hunks[0].Rows(); !slices.Equal(got, want) {
+		t.Errorf("Rows =\n%v\nwant\n%v", got, want)
+	}
+
+	// A hunk that only adds has no left lines
+	rows := Hunks(Lines("", "one\n"), 3)[0].Rows()
+	if !slices.Equal(rows, []Row{{Op: Insert, RightLine: 1, Right: "one"}}) {
+		t.Errorf("Rows of an added file = %v", rows)
+	}
+}
@@ -0,0 +1,59 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/shaunpua/updoc/internal/services"
+)
+
+type CodeChangeHandler struct {
+	codeChangeService *services.CodeChangeService
+}
+
+func NewCodeChangeHandler(codeChangeService *services.CodeChangeService) *CodeChangeHandler {
+	return &CodeChangeHandler{codeChangeService: codeChangeService}
+}
+
+// ReportCodeChange handles POST /api/v1/code-changes, which CI calls with a
+// repository and commit range to flag the documents linked to changed code
+func (h *CodeChangeHandler) ReportCodeChange(c echo.Context) error {
+	user, err := currentUser(c)
+	if err != nil {
+		return err
+	}
+
+	var req services.CodeChangeRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request format")
+	}
+
+	result, err := h.codeChangeService.Report(c.Request().Context(), user, req)
+	if err != nil {
+		return serviceError(err)
+	}
+
+	return c.JSON(http.StatusOK, result)
+}
+
+// CheckImpact handles POST /api/v1/code-changes/impact, which CI calls with a
+// pull request's repository and changed files to list the documents they
+// may affect
+func (h *CodeChangeHandler) CheckImpact(c echo.Context) error {
+	user, err := currentUser(c)
+	if err != nil {
+		return err
+	}
+
+	var req services.ImpactRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request format")
+	}
+
+	result, err := h.codeChangeService.Impact(c.Request().Context(), user, req)
+	if err != nil {
+		return serviceError(err)
+	}
+
+	return c.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,74 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/shaunpua/updoc/internal/services"
+)
+
+type DocumentHandler struct {
+	documentService *services.DocumentService
+}
+
+func NewDocumentHandler(documentService *services.DocumentService) *DocumentHandler {
+	return &DocumentHandler{documentService: documentService}
+}
+
+// GetDocumentContent handles GET /api/v1/documents/:id/content?format=storage|view,
+// the document's current page body as sanitized HTML and Markdown
+func (h *DocumentHandler) GetDocumentContent(c echo.Context) error {
+	user, err := currentUser(c)
+	if err != nil {
+		return err
+	}
+
+	content, err := h.documentService.Content(c.Request().Context(), user, c.Param("id"), c.QueryParam("format"))
+	if err != nil {
+		return serviceError(err)
+	}
+
+	return c.JSON(http.StatusOK, content)
+}
+
+// GetDocumentTree handles GET /api/v1/workspaces/:id/documents/tree, the
+// workspace's documents in their page hierarchy with open flags rolled up
+func (h *DocumentHandler) GetDocumentTree(c echo.Context) error {
+	user, err := currentUser(c)
+	if err != nil {
+		return err
+	}
+
+	tree, err := h.documentService.Tree(c.Request().Context(), user, c.Param("id"))
+	if err != nil {
+		return serviceError(err)
+	}
+
+	return c.JSON(http.StatusOK, tree)
+}
+
+// SetSourceLinks handles PUT /api/v1/documents/:id/source-links, replacing
+// the repository and the paths and symbols in it whose changes can leave
+// the document out of date
+func (h *DocumentHandler) SetSourceLinks(c echo.Context) error {
+	user, err := currentUser(c)
+	if err != nil {
+		return err
+	}
+
+	var req struct {
+		Repository string   `json:"repository"`
+		Paths      []string `json:"paths"`
+		Symbols    []string `json:"symbols"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request format")
+	}
+
+	document, err := h.documentService.SetSourceLinks(c.Request().Context(), user, c.Param("id"), req.Repository, req.Paths, req.Symbols)
+	if err != nil {
+		return serviceError(err)
+	}
+
+	return c.JSON(http.StatusOK, document)
+}
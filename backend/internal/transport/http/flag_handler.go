@@ -0,0 +1,197 @@
+package http
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/shaunpua/updoc/internal/doc"
+	"github.com/shaunpua/updoc/internal/services"
+)
+
+type FlagHandler struct {
+	flagService *services.FlagService
+}
+
+func NewFlagHandler(flagService *services.FlagService) *FlagHandler {
+	return &FlagHandler{flagService: flagService}
+}
+
+// CreateFlag handles POST /api/v1/flags
+func (h *FlagHandler) CreateFlag(c echo.Context) error {
+	user, err := currentUser(c)
+	if err != nil {
+		return err
+	}
+
+	var req doc.CreateFlagRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request format")
+	}
+
+	flag, err := h.flagService.Create(c.Request().Context(), user, req)
+	if err != nil {
+		return serviceError(err)
+	}
+
+	return c.JSON(http.StatusCreated, flag)
+}
+
+// ListFlags handles GET /api/v1/flags?status=&priority=&assigned_to=&created_by=&workspace_id=&search=
+// The value "me" for assigned_to or created_by means the authenticated user.
+func (h *FlagHandler) ListFlags(c echo.Context) error {
+	user, err := currentUser(c)
+	if err != nil {
+		return err
+	}
+
+	filters := doc.FlagFilters{
+		WorkspaceID: c.QueryParam("workspace_id"),
+		Status:      c.QueryParam("status"),
+		Priority:    c.QueryParam("priority"),
+		AssignedTo:  c.QueryParam("assigned_to"),
+		CreatedBy:   c.QueryParam("created_by"),
+		Search:      c.QueryParam("search"),
+	}
+	if filters.AssignedTo == "me" {
+		filters.AssignedTo = user.ID
+	}
+	if filters.CreatedBy == "me" {
+		filters.CreatedBy = user.ID
+	}
+
+	flags, err := h.flagService.List(c.Request().Context(), user, filters)
+	if err != nil {
+		return serviceError(err)
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"flags": flags,
+		"count": len(flags),
+	})
+}
+
+// GetFlag handles GET /api/v1/flags/:id
+func (h *FlagHandler) GetFlag(c echo.Context) error {
+	user, err := currentUser(c)
+	if err != nil {
+		return err
+	}
+
+	flag, err := h.flagService.Get(c.Request().Context(), user, c.Param("id"))
+	if err != nil {
+		return serviceError(err)
+	}
+
+	return c.JSON(http.StatusOK, flag)
+}
+
+// UpdateFlag handles PATCH /api/v1/flags/:id
+func (h *FlagHandler) UpdateFlag(c echo.Context) error {
+	user, err := currentUser(c)
+	if err != nil {
+		return err
+	}
+
+	var req doc.UpdateFlagRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request format")
+	}
+
+	flag, err := h.flagService.Update(c.Request().Context(), user, c.Param("id"), req)
+	if err != nil {
+		return serviceError(err)
+	}
+
+	return c.JSON(http.StatusOK, flag)
+}
+
+// ResolveFlag handles POST /api/v1/flags/:id/resolve with {"note": "..."}
+func (h *FlagHandler) ResolveFlag(c echo.Context) error {
+	user, err := currentUser(c)
+	if err != nil {
+		return err
+	}
+
+	var req struct {
+		Note string `json:"note"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request format")
+	}
+
+	flag, err := h.flagService.Resolve(c.Request().Context(), user, c.Param("id"), req.Note)
+	if err != nil {
+		return serviceError(err)
+	}
+
+	return c.JSON(http.StatusOK, flag)
+}
+
+// ConfirmFlag handles POST /api/v1/flags/:id/confirm with an optional {"note": "..."},
+// accepting the page edit a flag awaits verification of as its fix
+func (h *FlagHandler) ConfirmFlag(c echo.Context) error {
+	user, err := currentUser(c)
+	if err != nil {
+		return err
+	}
+
+	var req struct {
+		Note string `json:"note"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request format")
+	}
+
+	flag, err := h.flagService.Confirm(c.Request().Context(), user, c.Param("id"), req.Note)
+	if err != nil {
+		return serviceError(err)
+	}
+
+	return c.JSON(http.StatusOK, flag)
+}
+
+// ReopenFlag handles POST /api/v1/flags/:id/reopen with an optional {"note": "..."}
+func (h *FlagHandler) ReopenFlag(c echo.Context) error {
+	user, err := currentUser(c)
+	if err != nil {
+		return err
+	}
+
+	var req struct {
+		Note string `json:"note"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request format")
+	}
+
+	flag, err := h.flagService.Reopen(c.Request().Context(), user, c.Param("id"), req.Note)
+	if err != nil {
+		return serviceError(err)
+	}
+
+	return c.JSON(http.StatusOK, flag)
+}
+
+// GetFlagDiff handles GET /api/v1/flags/:id/diff?format=unified|side_by_side&context=3,
+// what changed in the flagged page since the flag was raised
+func (h *FlagHandler) GetFlagDiff(c echo.Context) error {
+	user, err := currentUser(c)
+	if err != nil {
+		return err
+	}
+
+	contextLines := services.DefaultDiffContext
+	if contextParam := c.QueryParam("context"); contextParam != "" {
+		if parsed, err := strconv.Atoi(contextParam); err == nil && parsed >= 0 {
+			contextLines = parsed
+		}
+	}
+
+	diff, err := h.flagService.Diff(c.Request().Context(), user, c.Param("id"), c.QueryParam("format"), contextLines)
+	if err != nil {
+		return serviceError(err)
+	}
+
+	return c.JSON(http.StatusOK, diff)
+}
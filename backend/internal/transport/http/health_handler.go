@@ -0,0 +1,34 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/shaunpua/updoc/internal/health"
+)
+
+type HealthHandler struct {
+	checker *health.Checker
+}
+
+func NewHealthHandler(checker *health.Checker) *HealthHandler {
+	return &HealthHandler{checker: checker}
+}
+
+// Livez handles GET /livez. It only shows the process can serve requests;
+// dependencies are left to Readyz so a database outage doesn't trigger restarts.
+func (h *HealthHandler) Livez(c echo.Context) error {
+	return c.JSON(http.StatusOK, map[string]string{"status": health.StatusOK})
+}
+
+// Readyz handles GET /readyz, answering 503 when a critical check fails or
+// the server is draining
+func (h *HealthHandler) Readyz(c echo.Context) error {
+	report := h.checker.Ready(c.Request().Context())
+
+	status := http.StatusOK
+	if report.Status != health.StatusOK {
+		status = http.StatusServiceUnavailable
+	}
+	return c.JSON(status, report)
+}
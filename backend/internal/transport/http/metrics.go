@@ -0,0 +1,30 @@
+package http
+
+import (
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/shaunpua/updoc/internal/metrics"
+)
+
+// Metrics records request counts and latency per route. Requests that match
+// no route are grouped under "unmatched" to keep label cardinality bounded.
+func Metrics() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+
+			err := next(c)
+			if err != nil {
+				c.Error(err)
+			}
+
+			route := c.Path()
+			if route == "" {
+				route = "unmatched"
+			}
+			metrics.ObserveHTTPRequest(c.Request().Method, route, c.Response().Status, time.Since(start))
+			return nil
+		}
+	}
+}
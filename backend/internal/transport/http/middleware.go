@@ -0,0 +1,92 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/shaunpua/updoc/internal/doc"
+	"github.com/shaunpua/updoc/internal/services"
+)
+
+const userContextKey = "user"
+
+// statusClientClosedRequest is nginx's code for a client that hung up before
+// the response; it keeps disconnects out of the 5xx error counts
+const statusClientClosedRequest = 499
+
+// Deadline gives each request's context a deadline, so database queries and
+// Confluence calls made on its behalf stop once a response could no longer be sent
+func Deadline(timeout time.Duration) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			ctx, cancel := context.WithTimeout(c.Request().Context(), timeout)
+			defer cancel()
+
+			c.SetRequest(c.Request().WithContext(ctx))
+			return next(c)
+		}
+	}
+}
+
+// Authenticate resolves a bearer API token to its user. Requests without a token
+// pass through anonymously; handlers that need a user call currentUser.
+func Authenticate(auth *services.AuthService) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			header := c.Request().Header.Get(echo.HeaderAuthorization)
+			if header == "" {
+				return next(c)
+			}
+
+			token, ok := strings.CutPrefix(header, "Bearer ")
+			if !ok {
+				return echo.NewHTTPError(http.StatusUnauthorized, "Authorization header must be a Bearer token")
+			}
+
+			user, err := auth.Authenticate(c.Request().Context(), token)
+			if err != nil {
+				return echo.NewHTTPError(http.StatusUnauthorized, "Invalid API token")
+			}
+
+			c.Set(userContextKey, user)
+			return next(c)
+		}
+	}
+}
+
+// currentUser returns the authenticated user or a 401
+func currentUser(c echo.Context) (*doc.User, error) {
+	user, ok := c.Get(userContextKey).(*doc.User)
+	if !ok || user == nil {
+		return nil, echo.NewHTTPError(http.StatusUnauthorized, "API token required")
+	}
+	return user, nil
+}
+
+// serviceError maps service sentinel errors onto HTTP status codes
+func serviceError(err error) error {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return echo.NewHTTPError(http.StatusGatewayTimeout, "request timed out: "+err.Error())
+	case errors.Is(err, context.Canceled):
+		return echo.NewHTTPError(statusClientClosedRequest, "request cancelled")
+	case errors.Is(err, services.ErrNotFound):
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	case errors.Is(err, services.ErrUnauthorized):
+		return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
+	case errors.Is(err, services.ErrForbidden):
+		return echo.NewHTTPError(http.StatusForbidden, err.Error())
+	case errors.Is(err, services.ErrInvalidInput):
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	case errors.Is(err, services.ErrUnavailable):
+		return echo.NewHTTPError(http.StatusServiceUnavailable, err.Error())
+	case errors.Is(err, services.ErrUpstream):
+		return echo.NewHTTPError(http.StatusBadGateway, err.Error())
+	default:
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+}
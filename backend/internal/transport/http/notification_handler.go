@@ -0,0 +1,72 @@
+package http
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/shaunpua/updoc/internal/services"
+)
+
+type NotificationHandler struct {
+	notificationService *services.NotificationService
+}
+
+func NewNotificationHandler(notificationService *services.NotificationService) *NotificationHandler {
+	return &NotificationHandler{notificationService: notificationService}
+}
+
+// ListNotifications handles GET /api/v1/notifications?unread=true&limit=50,
+// the authenticated user's newest notifications first
+func (h *NotificationHandler) ListNotifications(c echo.Context) error {
+	user, err := currentUser(c)
+	if err != nil {
+		return err
+	}
+
+	unread, _ := strconv.ParseBool(c.QueryParam("unread"))
+	limit := 0
+	if limitParam := c.QueryParam("limit"); limitParam != "" {
+		if parsedLimit, err := strconv.Atoi(limitParam); err == nil && parsedLimit > 0 {
+			limit = parsedLimit
+		}
+	}
+
+	notifications, err := h.notificationService.List(c.Request().Context(), user, unread, limit)
+	if err != nil {
+		return serviceError(err)
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"notifications": notifications,
+		"count":         len(notifications),
+	})
+}
+
+// MarkRead handles POST /api/v1/notifications/:id/read
+func (h *NotificationHandler) MarkRead(c echo.Context) error {
+	user, err := currentUser(c)
+	if err != nil {
+		return err
+	}
+
+	if err := h.notificationService.MarkRead(c.Request().Context(), user, c.Param("id")); err != nil {
+		return serviceError(err)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// MarkAllRead handles POST /api/v1/notifications/read
+func (h *NotificationHandler) MarkAllRead(c echo.Context) error {
+	user, err := currentUser(c)
+	if err != nil {
+		return err
+	}
+
+	if err := h.notificationService.MarkAllRead(c.Request().Context(), user); err != nil {
+		return serviceError(err)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
@@ -1,6 +1,8 @@
 package http
 
 import (
+	"context"
+	"errors"
 	"net/http"
 	"strconv"
 
@@ -11,12 +13,14 @@ import (
 type OrganizationHandler struct {
 	orgService        *services.OrganizationService
 	confluenceService *services.ConfluenceService
+	workspaceService  *services.WorkspaceService
 }
 
-func NewOrganizationHandler(orgService *services.OrganizationService, confluenceService *services.ConfluenceService) *OrganizationHandler {
+func NewOrganizationHandler(orgService *services.OrganizationService, confluenceService *services.ConfluenceService, workspaceService *services.WorkspaceService) *OrganizationHandler {
 	return &OrganizationHandler{
 		orgService:        orgService,
 		confluenceService: confluenceService,
+		workspaceService:  workspaceService,
 	}
 }
 
@@ -55,23 +59,33 @@ func (h *OrganizationHandler) GetOrganization(c echo.Context) error {
 	return c.JSON(http.StatusOK, org)
 }
 
-// TestConfluence handles POST /api/v1/orgs/:id/test-confluence
+// TestConfluence handles POST /api/v1/orgs/:id/test-confluence for members
+// of the organization
 func (h *OrganizationHandler) TestConfluence(c echo.Context) error {
+	user, err := currentUser(c)
+	if err != nil {
+		return err
+	}
 	orgID := c.Param("id")
 	if orgID == "" {
 		return echo.NewHTTPError(http.StatusBadRequest, "organization ID is required")
 	}
 
-	result, err := h.confluenceService.TestConnection(c.Request().Context(), orgID)
+	result, err := h.confluenceService.TestOrgConnection(c.Request().Context(), user, orgID)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		return serviceError(err)
 	}
 
 	return c.JSON(http.StatusOK, result)
 }
 
-// ListConfluencePages handles GET /api/v1/orgs/:id/confluence/pages
+// ListConfluencePages handles GET /api/v1/orgs/:id/confluence/pages?start=0&limit=10
+// for members of the organization
 func (h *OrganizationHandler) ListConfluencePages(c echo.Context) error {
+	user, err := currentUser(c)
+	if err != nil {
+		return err
+	}
 	orgID := c.Param("id")
 	if orgID == "" {
 		return echo.NewHTTPError(http.StatusBadRequest, "organization ID is required")
@@ -84,13 +98,138 @@ func (h *OrganizationHandler) ListConfluencePages(c echo.Context) error {
 		}
 	}
 
-	pages, err := h.confluenceService.ListPages(c.Request().Context(), orgID, limit)
+	start := 0
+	if startParam := c.QueryParam("start"); startParam != "" {
+		if parsedStart, err := strconv.Atoi(startParam); err == nil && parsedStart >= 0 {
+			start = parsedStart
+		}
+	}
+
+	list, err := h.confluenceService.ListPages(c.Request().Context(), user, orgID, start, limit)
 	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) || errors.Is(err, services.ErrUnavailable) || errors.Is(err, services.ErrNotFound) {
+			return serviceError(err)
+		}
 		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 	}
 
 	return c.JSON(http.StatusOK, map[string]interface{}{
-		"pages": pages,
-		"count": len(pages),
+		"pages":    list.Pages,
+		"count":    len(list.Pages),
+		"start":    list.Start,
+		"limit":    list.Limit,
+		"has_more": list.HasMore,
 	})
 }
+
+// SearchConfluence handles GET /api/v1/orgs/:id/confluence/search?q=deploy&label=runbook&space=ENG
+// &modified_after=2025-01-01&modified_before=2025-07-01&contributor=ID&start=0&limit=25&cursor=.
+// label may be repeated; cursor continues from a previous next_cursor.
+func (h *OrganizationHandler) SearchConfluence(c echo.Context) error {
+	user, err := currentUser(c)
+	if err != nil {
+		return err
+	}
+
+	params := c.QueryParams()
+	req := services.ConfluenceSearchRequest{
+		Query:          c.QueryParam("q"),
+		Space:          c.QueryParam("space"),
+		Labels:         params["label"],
+		ModifiedAfter:  c.QueryParam("modified_after"),
+		ModifiedBefore: c.QueryParam("modified_before"),
+		Contributor:    c.QueryParam("contributor"),
+		Cursor:         c.QueryParam("cursor"),
+	}
+	if limitParam := c.QueryParam("limit"); limitParam != "" {
+		if parsedLimit, err := strconv.Atoi(limitParam); err == nil && parsedLimit > 0 {
+			req.Limit = parsedLimit
+		}
+	}
+	if startParam := c.QueryParam("start"); startParam != "" {
+		if parsedStart, err := strconv.Atoi(startParam); err == nil && parsedStart >= 0 {
+			req.Start = parsedStart
+		}
+	}
+
+	result, err := h.workspaceService.SearchConfluence(c.Request().Context(), user, c.Param("id"), req)
+	if err != nil {
+		return serviceError(err)
+	}
+
+	return c.JSON(http.StatusOK, result)
+}
+
+// StartConfluenceOAuth handles POST /api/v1/orgs/:id/confluence/oauth/start
+// (admins only). The admin opens the returned URL in a browser to approve
+// access; Atlassian then redirects to ConfluenceOAuthCallback.
+func (h *OrganizationHandler) StartConfluenceOAuth(c echo.Context) error {
+	admin, err := currentUser(c)
+	if err != nil {
+		return err
+	}
+
+	resp, err := h.confluenceService.StartOAuth(c.Request().Context(), admin, c.Param("id"))
+	if err != nil {
+		return serviceError(err)
+	}
+
+	return c.JSON(http.StatusOK, resp)
+}
+
+// ConfluenceOAuthCallback handles GET /api/v1/confluence/oauth/callback,
+// where Atlassian redirects the admin's browser. It needs no API token; the
+// sealed state identifies the organization.
+func (h *OrganizationHandler) ConfluenceOAuthCallback(c echo.Context) error {
+	if denied := c.QueryParam("error"); denied != "" {
+		msg := "Atlassian authorization failed: " + denied
+		if desc := c.QueryParam("error_description"); desc != "" {
+			msg += ": " + desc
+		}
+		return echo.NewHTTPError(http.StatusBadRequest, msg)
+	}
+
+	resp, err := h.confluenceService.CompleteOAuth(c.Request().Context(), c.QueryParam("code"), c.QueryParam("state"))
+	if err != nil {
+		return serviceError(err)
+	}
+
+	return c.JSON(http.StatusOK, resp)
+}
+
+// GetCurrentUser handles GET /api/v1/me
+func (h *OrganizationHandler) GetCurrentUser(c echo.Context) error {
+	user, err := currentUser(c)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, user)
+}
+
+// AddUser handles POST /api/v1/orgs/:id/users (admins only)
+func (h *OrganizationHandler) AddUser(c echo.Context) error {
+	admin, err := currentUser(c)
+	if err != nil {
+		return err
+	}
+
+	var req struct {
+		Email string `json:"email"`
+		Name  string `json:"name"`
+		Role  string `json:"role"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request format")
+	}
+	if req.Email == "" || req.Name == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "email and name are required")
+	}
+
+	resp, err := h.orgService.AddUserWithToken(c.Request().Context(), admin, c.Param("id"), req.Email, req.Name, req.Role)
+	if err != nil {
+		return serviceError(err)
+	}
+
+	return c.JSON(http.StatusCreated, resp)
+}
@@ -1,14 +1,134 @@
 package http
 
 import (
+	"log/slog"
+	"time"
+
 	"github.com/labstack/echo/v4"
+	"github.com/shaunpua/updoc/internal/metrics"
+	"github.com/shaunpua/updoc/internal/services"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/labstack/echo/otelecho"
 )
 
-func NewRouter() *echo.Echo {
+// Handlers groups the endpoint handlers mounted under /api/v1
+type Handlers struct {
+	Logger *slog.Logger
+	// ServiceName, when set, starts a server span for each request
+	ServiceName string
+	// RequestTimeout, when set, is the deadline given to each request's context
+	RequestTimeout time.Duration
+
+	Health        *HealthHandler
+	Auth          *services.AuthService
+	Organizations *OrganizationHandler
+	Workspaces    *WorkspaceHandler
+	Documents     *DocumentHandler
+	Flags         *FlagHandler
+	CodeChanges   *CodeChangeHandler
+	Notifications *NotificationHandler
+	Webhooks      *WebhookHandler
+}
+
+func NewRouter(h Handlers) *echo.Echo {
 	e := echo.New()
+	e.HideBanner = true
+	e.HidePort = true
+
+	if h.ServiceName != "" {
+		e.Use(otelecho.Middleware(h.ServiceName, otelecho.WithSkipper(func(c echo.Context) bool {
+			return isProbe(c.Path())
+		})))
+	}
+	e.Use(RequestID())
+	e.Use(Metrics())
+	if h.Logger != nil {
+		e.Use(AccessLog(h.Logger))
+	}
+	if h.RequestTimeout > 0 {
+		e.Use(Deadline(h.RequestTimeout))
+	}
 
 	// Simple JSON health ping
 	e.GET("/health", func(c echo.Context) error { return c.String(200, "ok") })
 
+	if h.Health != nil {
+		e.GET("/livez", h.Health.Livez)
+		e.GET("/readyz", h.Health.Readyz)
+	}
+
+	// Prometheus scrape endpoint
+	e.GET("/metrics", echo.WrapHandler(metrics.Handler()))
+
+	// Webhooks authenticate with a signature or JWT, not an API token
+	if h.Webhooks != nil {
+		e.POST("/webhooks/confluence/:workspace_id", h.Webhooks.ConfluenceWebhook)
+	}
+
+	api := e.Group("/api/v1")
+	if h.Auth != nil {
+		api.Use(Authenticate(h.Auth))
+	}
+
+	if h.Organizations != nil {
+		api.POST("/orgs", h.Organizations.CreateOrganization)
+		api.GET("/orgs/:slug", h.Organizations.GetOrganization)
+		api.POST("/orgs/:id/users", h.Organizations.AddUser)
+		api.POST("/orgs/:id/test-confluence", h.Organizations.TestConfluence)
+		api.GET("/orgs/:id/confluence/pages", h.Organizations.ListConfluencePages)
+		api.GET("/orgs/:id/confluence/search", h.Organizations.SearchConfluence)
+		api.POST("/orgs/:id/confluence/oauth/start", h.Organizations.StartConfluenceOAuth)
+		api.GET("/confluence/oauth/callback", h.Organizations.ConfluenceOAuthCallback)
+		api.GET("/me", h.Organizations.GetCurrentUser)
+	}
+
+	if h.Workspaces != nil {
+		api.GET("/workspaces", h.Workspaces.ListWorkspaces)
+		api.POST("/workspaces", h.Workspaces.CreateWorkspace)
+		api.POST("/workspaces/:id/sync", h.Workspaces.SyncWorkspace)
+		api.POST("/workspaces/:id/test-connection", h.Workspaces.TestConnection)
+		api.GET("/workspaces/:id/search", h.Workspaces.SearchDocuments)
+		api.POST("/workspaces/:id/webhook", h.Workspaces.EnableWebhook)
+		api.PUT("/workspaces/:id/write-back", h.Workspaces.SetWriteBack)
+		api.PUT("/workspaces/:id/label-rules", h.Workspaces.SetLabelRules)
+	}
+
+	if h.Documents != nil {
+		api.GET("/documents/:id/content", h.Documents.GetDocumentContent)
+		api.GET("/workspaces/:id/documents/tree", h.Documents.GetDocumentTree)
+		api.PUT("/documents/:id/source-links", h.Documents.SetSourceLinks)
+	}
+
+	if h.Flags != nil {
+		api.GET("/flags", h.Flags.ListFlags)
+		api.POST("/flags", h.Flags.CreateFlag)
+		api.GET("/flags/:id", h.Flags.GetFlag)
+		api.PATCH("/flags/:id", h.Flags.UpdateFlag)
+		api.POST("/flags/:id/resolve", h.Flags.ResolveFlag)
+		api.GET("/flags/:id/diff", h.Flags.GetFlagDiff)
+		api.POST("/flags/:id/confirm", h.Flags.ConfirmFlag)
+		api.POST("/flags/:id/reopen", h.Flags.ReopenFlag)
+	}
+
+	if h.CodeChanges != nil {
+		api.POST("/code-changes", h.CodeChanges.ReportCodeChange)
+		api.POST("/code-changes/impact", h.CodeChanges.CheckImpact)
+	}
+
+	if h.Notifications != nil {
+		api.GET("/notifications", h.Notifications.ListNotifications)
+		api.POST("/notifications/read", h.Notifications.MarkAllRead)
+		api.POST("/notifications/:id/read", h.Notifications.MarkRead)
+	}
+
 	return e
 }
+
+// isProbe reports whether route is polled by orchestrators or scrapers, so
+// it can be kept out of traces and logged quietly
+func isProbe(route string) bool {
+	switch route {
+	case "/health", "/livez", "/readyz", "/metrics":
+		return true
+	}
+	return false
+}
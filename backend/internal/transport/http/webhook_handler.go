@@ -0,0 +1,48 @@
+package http
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/shaunpua/updoc/internal/services"
+)
+
+// maxWebhookBody bounds a webhook payload; page events are a few hundred bytes
+const maxWebhookBody = 1 << 20
+
+type WebhookHandler struct {
+	webhookService *services.ConfluenceWebhookService
+}
+
+func NewWebhookHandler(webhookService *services.ConfluenceWebhookService) *WebhookHandler {
+	return &WebhookHandler{webhookService: webhookService}
+}
+
+// ConfluenceWebhook handles POST /webhooks/confluence/:workspace_id, page
+// events from Confluence signed with the workspace's webhook secret.
+// Deliveries that change nothing, such as redeliveries and events for other
+// spaces, still succeed so Confluence stops retrying them.
+func (h *WebhookHandler) ConfluenceWebhook(c echo.Context) error {
+	body, err := io.ReadAll(io.LimitReader(c.Request().Body, maxWebhookBody+1))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "failed to read webhook body")
+	}
+	if len(body) > maxWebhookBody {
+		return echo.NewHTTPError(http.StatusRequestEntityTooLarge, "webhook body too large")
+	}
+
+	req := c.Request()
+	result, err := h.webhookService.Handle(req.Context(), c.Param("workspace_id"), services.ConfluenceWebhookDelivery{
+		Event:         req.Header.Get("X-Event-Key"),
+		Signature:     req.Header.Get("X-Hub-Signature"),
+		Authorization: req.Header.Get(echo.HeaderAuthorization),
+		ID:            req.Header.Get("X-Atlassian-Webhook-Identifier"),
+		Body:          body,
+	})
+	if err != nil {
+		return serviceError(err)
+	}
+
+	return c.JSON(http.StatusOK, result)
+}
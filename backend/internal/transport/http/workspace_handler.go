@@ -0,0 +1,172 @@
+package http
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/shaunpua/updoc/internal/doc"
+	"github.com/shaunpua/updoc/internal/services"
+)
+
+type WorkspaceHandler struct {
+	workspaceService *services.WorkspaceService
+}
+
+func NewWorkspaceHandler(workspaceService *services.WorkspaceService) *WorkspaceHandler {
+	return &WorkspaceHandler{workspaceService: workspaceService}
+}
+
+// ListWorkspaces handles GET /api/v1/workspaces
+func (h *WorkspaceHandler) ListWorkspaces(c echo.Context) error {
+	user, err := currentUser(c)
+	if err != nil {
+		return err
+	}
+
+	workspaces, err := h.workspaceService.List(c.Request().Context(), user)
+	if err != nil {
+		return serviceError(err)
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"workspaces": workspaces,
+		"count":      len(workspaces),
+	})
+}
+
+// CreateWorkspace handles POST /api/v1/workspaces
+func (h *WorkspaceHandler) CreateWorkspace(c echo.Context) error {
+	user, err := currentUser(c)
+	if err != nil {
+		return err
+	}
+
+	var req doc.CreateWorkspaceRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request format")
+	}
+
+	ws, err := h.workspaceService.Create(c.Request().Context(), user, req)
+	if err != nil {
+		return serviceError(err)
+	}
+
+	return c.JSON(http.StatusCreated, ws)
+}
+
+// SyncWorkspace handles POST /api/v1/workspaces/:id/sync
+func (h *WorkspaceHandler) SyncWorkspace(c echo.Context) error {
+	user, err := currentUser(c)
+	if err != nil {
+		return err
+	}
+
+	result, err := h.workspaceService.Sync(c.Request().Context(), user, c.Param("id"))
+	if err != nil {
+		return serviceError(err)
+	}
+
+	return c.JSON(http.StatusOK, result)
+}
+
+// TestConnection handles POST /api/v1/workspaces/:id/test-connection,
+// checking the workspace's provider with its settings
+func (h *WorkspaceHandler) TestConnection(c echo.Context) error {
+	user, err := currentUser(c)
+	if err != nil {
+		return err
+	}
+
+	result, err := h.workspaceService.TestConnection(c.Request().Context(), user, c.Param("id"))
+	if err != nil {
+		return serviceError(err)
+	}
+
+	return c.JSON(http.StatusOK, result)
+}
+
+// SearchDocuments handles GET /api/v1/workspaces/:id/search?q=...&cursor=...&limit=...,
+// searching the workspace's provider
+func (h *WorkspaceHandler) SearchDocuments(c echo.Context) error {
+	user, err := currentUser(c)
+	if err != nil {
+		return err
+	}
+
+	limit := 0
+	if limitParam := c.QueryParam("limit"); limitParam != "" {
+		if limit, err = strconv.Atoi(limitParam); err != nil || limit < 1 {
+			return echo.NewHTTPError(http.StatusBadRequest, "limit must be a positive number")
+		}
+	}
+
+	result, err := h.workspaceService.SearchDocuments(c.Request().Context(), user, c.Param("id"),
+		c.QueryParam("q"), c.QueryParam("cursor"), limit)
+	if err != nil {
+		return serviceError(err)
+	}
+
+	return c.JSON(http.StatusOK, result)
+}
+
+// EnableWebhook handles POST /api/v1/workspaces/:id/webhook, generating the
+// secret for the workspace's Confluence webhook. The secret is only returned
+// here.
+func (h *WorkspaceHandler) EnableWebhook(c echo.Context) error {
+	user, err := currentUser(c)
+	if err != nil {
+		return err
+	}
+
+	setup, err := h.workspaceService.EnableWebhook(c.Request().Context(), user, c.Param("id"))
+	if err != nil {
+		return serviceError(err)
+	}
+
+	return c.JSON(http.StatusOK, setup)
+}
+
+// SetWriteBack handles PUT /api/v1/workspaces/:id/write-back, choosing whether
+// flags are shown on the workspace's Confluence pages as comments or a label
+func (h *WorkspaceHandler) SetWriteBack(c echo.Context) error {
+	user, err := currentUser(c)
+	if err != nil {
+		return err
+	}
+
+	var req services.WriteBackSettings
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request format")
+	}
+
+	ws, err := h.workspaceService.SetWriteBack(c.Request().Context(), user, c.Param("id"), req)
+	if err != nil {
+		return serviceError(err)
+	}
+
+	return c.JSON(http.StatusOK, ws)
+}
+
+// SetLabelRules handles PUT /api/v1/workspaces/:id/label-rules, replacing the
+// rules that track and flag pages by their Confluence labels
+func (h *WorkspaceHandler) SetLabelRules(c echo.Context) error {
+	user, err := currentUser(c)
+	if err != nil {
+		return err
+	}
+
+	var req struct {
+		Rules []services.LabelRule `json:"rules"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request format")
+	}
+
+	ws, err := h.workspaceService.SetLabelRules(c.Request().Context(), user, c.Param("id"), req.Rules)
+	if err != nil {
+		return serviceError(err)
+	}
+
+	return c.JSON(http.StatusOK, ws)
+}
@@ -0,0 +1,199 @@
+// Package api defines the JSON bodies of the UpDoc HTTP API (/api/v1). The
+// server encodes and decodes these types, and pkg/client sends and receives
+// them, so the two can't drift apart.
+package api
+
+import "time"
+
+type Organization struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Slug      string    `json:"slug"`
+	CreatedAt time.Time `json:"created_at"`
+
+	// Confluence Integration
+	ConfluenceBaseURL string `json:"confluence_base_url,omitempty"`
+	// ConfluenceAuthMode is cloud_basic, dc_bearer or dc_basic; empty picks
+	// one from the base URL and credentials
+	ConfluenceAuthMode string `json:"confluence_auth_mode,omitempty"`
+	// ConfluenceEmail is the account email on Cloud, or the username on Data Center
+	ConfluenceEmail    string `json:"confluence_email,omitempty"`
+	ConfluenceSpaceKey string `json:"confluence_space_key,omitempty"`
+	// ConfluenceCloudID is the site OAuth connections call through the API
+	// gateway
+	ConfluenceCloudID string `json:"confluence_cloud_id,omitempty"`
+}
+
+type User struct {
+	ID        string    `json:"id"`
+	Email     string    `json:"email"`
+	Name      string    `json:"name"`
+	OrgID     string    `json:"org_id"`
+	Role      string    `json:"role"`
+	IsActive  bool      `json:"is_active"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type Workspace struct {
+	ID                string                 `json:"id"`
+	OrgID             string                 `json:"org_id"`
+	Name              string                 `json:"name"`
+	IntegrationType   string                 `json:"integration_type"`
+	IntegrationConfig map[string]interface{} `json:"integration_config"`
+	IsDefault         bool                   `json:"is_default"`
+	CreatedAt         time.Time              `json:"created_at"`
+}
+
+type Document struct {
+	ID          string    `json:"id"`
+	WorkspaceID string    `json:"workspace_id"`
+	Title       string    `json:"title"`
+	URL         string    `json:"url"`
+	ExternalID  string    `json:"external_id"`
+	OwnerID     string    `json:"owner_id"`
+	LastChecked time.Time `json:"last_checked"`
+	CreatedAt   time.Time `json:"created_at"`
+
+	// RemovedAt is when the page was deleted from, or moved out of, the
+	// workspace's space, as reported by a webhook; nil while it exists
+	RemovedAt *time.Time `json:"removed_at,omitempty"`
+	// LastEventAt is the timestamp of the latest webhook event applied to
+	// the document, so stale events can be skipped, and LastEventIDs the
+	// delivery IDs of the events applied at that time, so redeliveries can;
+	// the IDs are the server's bookkeeping and aren't sent
+	LastEventAt  *time.Time `json:"last_event_at,omitempty"`
+	LastEventIDs []string   `json:"-"`
+	// Labels are the page's Confluence labels as last seen by a sync or
+	// webhook, so label rules can tell when one appears or is removed
+	Labels []string `json:"labels,omitempty"`
+	// ParentPageID is the Confluence page ID of the page's parent, and
+	// AncestorPageIDs those of all its parents, root first, as last seen by
+	// a sync; both are empty for a page at the top of its space
+	ParentPageID    string   `json:"parent_page_id,omitempty"`
+	AncestorPageIDs []string `json:"ancestor_page_ids,omitempty"`
+	// SourceRepository is the repository the document's source links are
+	// in: the ID of a git workspace, or a repository's path or URL.
+	// SourcePaths are globs of the paths there the document describes, such
+	// as services/billing/**, and SourceSymbols identifiers in that code; a
+	// commit touching either can leave the document out of date.
+	SourceRepository string   `json:"source_repository,omitempty"`
+	SourcePaths      []string `json:"source_paths,omitempty"`
+	SourceSymbols    []string `json:"source_symbols,omitempty"`
+}
+
+type Flag struct {
+	ID          string     `json:"id"`
+	DocumentID  string     `json:"document_id"`
+	CreatedBy   string     `json:"created_by"`
+	AssignedTo  *string    `json:"assigned_to"`
+	Title       string     `json:"title"`
+	Description string     `json:"description"`
+	Priority    string     `json:"priority"`
+	Status      string     `json:"status"`
+	Resolution  string     `json:"resolution"`
+	ResolvedAt  *time.Time `json:"resolved_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+
+	// PageVersion is the Confluence page's version when the flag was
+	// raised, or 0 if it is unknown
+	PageVersion int `json:"page_version,omitempty"`
+	// ResolutionWarning is set when the flag was resolved without the page
+	// having changed since it was raised
+	ResolutionWarning string `json:"resolution_warning,omitempty"`
+	// CheckedVersion is the latest page version put to the creator and
+	// assignee for verification
+	CheckedVersion int `json:"checked_version,omitempty"`
+	// ConfluenceCommentID is the page comment that shows the flag to readers
+	// on Confluence, when its workspace writes flags back as comments
+	ConfluenceCommentID string `json:"confluence_comment_id,omitempty"`
+	// SourceLabel is the Confluence label whose workspace rule opened the
+	// flag; removing the label from the page resolves it
+	SourceLabel string `json:"source_label,omitempty"`
+	// SourceCommits are the commits to the document's linked code that
+	// opened the flag, oldest first
+	SourceCommits []string `json:"source_commits,omitempty"`
+	// PullRequest is the pull or merge request, as CI named it, whose
+	// changed files opened the flag
+	PullRequest string `json:"pull_request,omitempty"`
+
+	// Related entities (populated by repository)
+	Document *Document `json:"document,omitempty"`
+	Creator  *User     `json:"creator,omitempty"`
+	Assignee *User     `json:"assignee,omitempty"`
+}
+
+type Notification struct {
+	ID        string     `json:"id"`
+	UserID    string     `json:"user_id"`
+	FlagID    string     `json:"flag_id"`
+	Type      string     `json:"type"`
+	Message   string     `json:"message"`
+	ReadAt    *time.Time `json:"read_at"`
+	CreatedAt time.Time  `json:"created_at"`
+
+	// Actions are the API calls that answer the notification, filled in
+	// when it is listed; they are not stored
+	Actions []NotificationAction `json:"actions,omitempty"`
+}
+
+// NotificationAction is a one-click response to a notification
+type NotificationAction struct {
+	Label  string `json:"label"`
+	Method string `json:"method"`
+	// Path is relative to the API base, e.g. /flags/{id}/confirm
+	Path string `json:"path"`
+}
+
+// Request/Response types
+type FlagFilters struct {
+	OrgID       string `json:"org_id"`
+	WorkspaceID string `json:"workspace_id"`
+	Status      string `json:"status"`
+	Priority    string `json:"priority"`
+	AssignedTo  string `json:"assigned_to"`
+	CreatedBy   string `json:"created_by"`
+	Search      string `json:"search"`
+}
+
+type CreateFlagRequest struct {
+	DocumentID  string  `json:"document_id"`
+	DocumentURL string  `json:"document_url"` // used when DocumentID is empty; untracked URLs are added to the default workspace
+	Title       string  `json:"title" validate:"required,min=3,max=200"`
+	Description string  `json:"description" validate:"required,min=10,max=1000"`
+	Priority    string  `json:"priority" validate:"required,oneof=urgent high medium low"`
+	AssignedTo  *string `json:"assigned_to"`
+	AssignTo    string  `json:"assign_to,omitempty"` // assignee email, alternative to AssignedTo
+}
+
+type UpdateFlagRequest struct {
+	Title       *string `json:"title"`
+	Description *string `json:"description"`
+	Priority    *string `json:"priority"`
+	Status      *string `json:"status"`
+	AssignedTo  *string `json:"assigned_to"`
+	Resolution  *string `json:"resolution"`
+}
+
+type CreateWorkspaceRequest struct {
+	Name              string                 `json:"name" validate:"required"`
+	IntegrationType   string                 `json:"integration_type"`
+	IntegrationConfig map[string]interface{} `json:"integration_config"`
+	IsDefault         bool                   `json:"is_default"`
+}
+
+type SyncResult struct {
+	WorkspaceID string    `json:"workspace_id"`
+	Total       int       `json:"total"`
+	Created     int       `json:"created"`
+	Updated     int       `json:"updated"`
+	SyncedAt    time.Time `json:"synced_at"`
+
+	// Untracked counts pages skipped because no tracking label rule
+	// matched them
+	Untracked int `json:"untracked,omitempty"`
+	// FlagsOpened and FlagsResolved count flags opened and resolved by
+	// label rules
+	FlagsOpened   int `json:"flags_opened,omitempty"`
+	FlagsResolved int `json:"flags_resolved,omitempty"`
+}
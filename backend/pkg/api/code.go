@@ -0,0 +1,97 @@
+package api
+
+import "time"
+
+// CodeChangeRequest reports the commits pushed to a repository, as a CI job
+// would after a push
+type CodeChangeRequest struct {
+	// Repository is the ID of a git workspace, whose repository is read, or
+	// a local path under one of the configured local roots or an https or
+	// ssh URL. Only documents linked to that repository are checked, and
+	// only admins may name a repository no git workspace or document uses.
+	Repository string `json:"repository"`
+	// From and To are the commit range: the commits reachable from To but
+	// not From. With From empty only To itself is considered.
+	From string `json:"from"`
+	To   string `json:"to"`
+	// Priority is the priority of flags opened, medium if empty
+	Priority string `json:"priority,omitempty"`
+}
+
+// CodeChangeResult is what a code change report did
+type CodeChangeResult struct {
+	Repository string `json:"repository"`
+	// From and To are the commits the range resolved to
+	From    string `json:"from,omitempty"`
+	To      string `json:"to"`
+	Commits int    `json:"commits"`
+	// Documents are the linked documents flagged by the report
+	Documents    []*CodeChangeDocument `json:"documents"`
+	FlagsOpened  int                   `json:"flags_opened"`
+	FlagsUpdated int                   `json:"flags_updated"`
+}
+
+// CodeChangeDocument is a document whose linked code changed, with the flag
+// citing the commits
+type CodeChangeDocument struct {
+	Document *Document `json:"document"`
+	Flag     *Flag     `json:"flag"`
+	// Opened is whether the flag was opened by this report, rather than
+	// already open
+	Opened bool `json:"opened"`
+	// Commits are the commits newly cited on the flag, newest first
+	Commits []Commit `json:"commits"`
+}
+
+// Commit is a commit and the files it changed
+type Commit struct {
+	Hash        string    `json:"hash"`
+	Author      string    `json:"author"`
+	AuthorEmail string    `json:"author_email"`
+	Time        time.Time `json:"time"`
+	Subject     string    `json:"subject"`
+	// Files are the paths the commit added, changed or deleted; a rename
+	// lists both the old and the new path
+	Files []string `json:"files"`
+}
+
+// ImpactRequest lists the files a pull request changes, as CI would post
+// them before commenting on it
+type ImpactRequest struct {
+	// Repository is the repository the pull request is against, named as
+	// in CodeChangeRequest. Only documents linked to it are checked.
+	Repository string `json:"repository"`
+	// Files are the changed paths, relative to the repository root
+	Files []string `json:"files"`
+	// PullRequest names the pull or merge request, such as acme/app#42 or
+	// its URL
+	PullRequest string `json:"pull_request,omitempty"`
+	// CreateFlags opens a pending flag tagged with PullRequest on each
+	// affected document that hasn't had one for it
+	CreateFlags bool `json:"create_flags,omitempty"`
+	// Priority is the priority of flags opened, medium if empty
+	Priority string `json:"priority,omitempty"`
+}
+
+// ImpactResult lists the documents a pull request may leave out of date
+type ImpactResult struct {
+	Repository  string              `json:"repository"`
+	PullRequest string              `json:"pull_request,omitempty"`
+	Files       int                 `json:"files"`
+	Documents   []*ImpactedDocument `json:"documents"`
+	FlagsOpened int                 `json:"flags_opened"`
+}
+
+// ImpactedDocument is a document linked to files a pull request changes
+type ImpactedDocument struct {
+	Document *Document `json:"document"`
+	// Owner is the document's owner, if it has one
+	Owner *User `json:"owner,omitempty"`
+	// Files are the changed files under the document's source paths
+	Files     []string `json:"files"`
+	OpenFlags []*Flag  `json:"open_flags"`
+	// Flag is the document's flag for the pull request, opened by this
+	// check when Opened is set or by an earlier one
+	Flag   *Flag `json:"flag,omitempty"`
+	Opened bool  `json:"opened"`
+}
@@ -0,0 +1,92 @@
+package api
+
+import "time"
+
+// DocumentContent is a tracked document with its page body
+type DocumentContent struct {
+	Document *Document              `json:"document"`
+	Content  *ConfluencePageContent `json:"content"`
+}
+
+// ConfluencePageContent is a page body at one version, rendered for display
+type ConfluencePageContent struct {
+	PageID  string `json:"page_id"`
+	Title   string `json:"title"`
+	URL     string `json:"url"`
+	Version int    `json:"version"`
+	// Representation is the body rendered: storage or view
+	Representation string     `json:"representation"`
+	ModifiedAt     *time.Time `json:"modified_at,omitempty"`
+	ModifiedBy     string     `json:"modified_by,omitempty"`
+	// HTML is sanitized and safe to embed
+	HTML      string    `json:"html"`
+	Markdown  string    `json:"markdown"`
+	FetchedAt time.Time `json:"fetched_at"`
+	// Cached is whether the body was served without fetching it again
+	Cached bool `json:"cached"`
+}
+
+// DocumentTree is a workspace's documents arranged as their pages are in the
+// provider, such as a Confluence space or a Notion workspace
+type DocumentTree struct {
+	WorkspaceID string              `json:"workspace_id"`
+	Roots       []*DocumentTreeNode `json:"roots"`
+	// Documents and OpenFlags total the whole tree
+	Documents int `json:"documents"`
+	OpenFlags int `json:"open_flags"`
+}
+
+// DocumentTreeNode is one document in a DocumentTree
+type DocumentTreeNode struct {
+	Document *Document `json:"document"`
+	// OpenFlags counts the document's own open flags, and SubtreeOpenFlags
+	// those of the document and every document below it
+	OpenFlags        int `json:"open_flags"`
+	SubtreeOpenFlags int `json:"subtree_open_flags"`
+	// SubtreeDocuments counts the document and every document below it
+	SubtreeDocuments int                 `json:"subtree_documents"`
+	Children         []*DocumentTreeNode `json:"children"`
+}
+
+// FlagDiff is what changed in a flagged page between the version flagged and
+// the current one, compared as Markdown rendered from the storage format
+type FlagDiff struct {
+	FlagID      string `json:"flag_id"`
+	DocumentID  string `json:"document_id"`
+	PageID      string `json:"page_id"`
+	Title       string `json:"title"`
+	URL         string `json:"url"`
+	FromVersion int    `json:"from_version"`
+	ToVersion   int    `json:"to_version"`
+	// ModifiedAt and ModifiedBy describe the current version
+	ModifiedAt *time.Time `json:"modified_at,omitempty"`
+	ModifiedBy string     `json:"modified_by,omitempty"`
+	// Changed is whether the text differs; a new version can leave it alone
+	Changed bool   `json:"changed"`
+	Added   int    `json:"added"`
+	Removed int    `json:"removed"`
+	Format  string `json:"format"`
+	// Unified is the diff in the unified format
+	Unified string `json:"unified,omitempty"`
+	// Hunks is the diff in the side_by_side format
+	Hunks []FlagDiffHunk `json:"hunks,omitempty"`
+	// Warning is set when the flag is resolved but the page hasn't changed
+	Warning string `json:"warning,omitempty"`
+}
+
+// FlagDiffHunk is a run of changes laid out side by side
+type FlagDiffHunk struct {
+	Header string    `json:"header"`
+	Rows   []DiffRow `json:"rows"`
+}
+
+// DiffRow is one line of a side-by-side diff. Op is equal, delete, insert or
+// change, a deleted line paired with the line inserted in its place. A side
+// a row has no line on has a line number of 0.
+type DiffRow struct {
+	Op        string `json:"op"`
+	LeftLine  int    `json:"left_line,omitempty"`
+	Left      string `json:"left"`
+	RightLine int    `json:"right_line,omitempty"`
+	Right     string `json:"right"`
+}
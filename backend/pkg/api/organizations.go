@@ -0,0 +1,104 @@
+package api
+
+import "time"
+
+type CreateOrgRequest struct {
+	Name      string `json:"name" validate:"required,min=2,max=100"`
+	UserName  string `json:"user_name" validate:"required,min=2,max=100"`
+	UserEmail string `json:"user_email" validate:"required,email"`
+
+	// Optional Confluence Integration
+	ConfluenceBaseURL  string `json:"confluence_base_url,omitempty"`
+	ConfluenceAuthMode string `json:"confluence_auth_mode,omitempty"`
+	ConfluenceEmail    string `json:"confluence_email,omitempty"`
+	ConfluenceToken    string `json:"confluence_token,omitempty"`
+	ConfluenceSpaceKey string `json:"confluence_space_key,omitempty"`
+}
+
+type CreateOrgResponse struct {
+	Organization *Organization `json:"organization"`
+	User         *User         `json:"user"`
+	Workspace    *Workspace    `json:"workspace,omitempty"`
+	APIToken     string        `json:"api_token"` // shown once; only its hash is stored
+}
+
+type AddUserResponse struct {
+	User     *User  `json:"user"`
+	APIToken string `json:"api_token"`
+}
+
+type ConfluenceTestResponse struct {
+	Success bool   `json:"success"`
+	Message string `json:"message"`
+	Details string `json:"details,omitempty"`
+	// Deployment is the detected flavour, cloud or data_center, when known
+	Deployment string `json:"deployment,omitempty"`
+	// AuthMode is the mode the test authenticated with
+	AuthMode string `json:"auth_mode,omitempty"`
+	// Warning explains a mismatch between the auth mode and the deployment
+	Warning string `json:"warning,omitempty"`
+}
+
+type ConfluencePageInfo struct {
+	ID    string `json:"id"`
+	Title string `json:"title"`
+	URL   string `json:"url"`
+	Space string `json:"space"`
+	// Labels are the page's labels, when listed with them
+	Labels []string `json:"labels,omitempty"`
+	// Ancestors are the IDs of the page's parents, root first, and ParentID
+	// the last of them, when listed with them
+	Ancestors []string `json:"ancestors,omitempty"`
+	ParentID  string   `json:"parent_id,omitempty"`
+}
+
+type ConfluenceOAuthStart struct {
+	// AuthorizationURL is where the admin approves access in a browser
+	AuthorizationURL string    `json:"authorization_url"`
+	ExpiresAt        time.Time `json:"expires_at"`
+}
+
+// ConfluenceSearchRequest is a page search; every filter is optional but at
+// least one, or Query, must be set. It is sent as query parameters.
+type ConfluenceSearchRequest struct {
+	// Query is matched against page titles and text
+	Query string
+	// Space limits the search to one space; otherwise every connected space is searched
+	Space  string
+	Labels []string
+	// ModifiedAfter and ModifiedBefore are yyyy-mm-dd dates; After is inclusive
+	ModifiedAfter  string
+	ModifiedBefore string
+	// Contributor is an account ID on Cloud or a username on Data Center
+	Contributor string
+	// Cursor continues from a previous result's NextCursor and takes precedence over Start
+	Cursor string
+	Start  int
+	Limit  int
+}
+
+// ConfluenceSearchHit is a matching page and what UpDoc knows about it
+type ConfluenceSearchHit struct {
+	ConfluencePageInfo
+	Version      int        `json:"version,omitempty"`
+	LastModified *time.Time `json:"last_modified,omitempty"`
+	ModifiedBy   string     `json:"modified_by,omitempty"`
+	// Tracked is whether the page is a Document in one of the org's workspaces
+	Tracked    bool   `json:"tracked"`
+	DocumentID string `json:"document_id,omitempty"`
+	OpenFlags  int    `json:"open_flags"`
+}
+
+// ConfluenceSearchResult is one page of search hits
+type ConfluenceSearchResult struct {
+	Results []ConfluenceSearchHit `json:"results"`
+	// CQL is the query sent to Confluence
+	CQL     string `json:"cql"`
+	Start   int    `json:"start"`
+	Limit   int    `json:"limit"`
+	HasMore bool   `json:"has_more"`
+	// NextCursor is set when Confluence pages search results by cursor
+	// rather than start, as Cloud does
+	NextCursor string `json:"next_cursor,omitempty"`
+	TotalSize  int    `json:"total_size,omitempty"`
+}
@@ -0,0 +1,69 @@
+package api
+
+import "time"
+
+// ConfluenceWebhookSetup is what to register with Confluence to send a
+// workspace's page events to UpDoc
+type ConfluenceWebhookSetup struct {
+	WorkspaceID string `json:"workspace_id"`
+	// Path is the receiver's path on UpDoc's public URL
+	Path   string   `json:"path"`
+	Secret string   `json:"secret"`
+	Events []string `json:"events"`
+}
+
+// WriteBackSettings control whether flags on a workspace's pages are shown
+// to readers on Confluence
+type WriteBackSettings struct {
+	Mode string `json:"mode"`
+	// Label is used in label mode, the default write-back label if empty
+	Label string `json:"label,omitempty"`
+}
+
+// LabelRule maps a Confluence label to what UpDoc does with pages carrying it
+type LabelRule struct {
+	Label  string `json:"label"`
+	Action string `json:"action"`
+	// Priority is the priority of flags a flag rule opens, medium if empty
+	Priority string `json:"priority,omitempty"`
+}
+
+// ConnectionTest is the outcome of testing a workspace's provider
+type ConnectionTest struct {
+	Provider string `json:"provider"`
+	Success  bool   `json:"success"`
+	Message  string `json:"message"`
+	Details  string `json:"details,omitempty"`
+	Warning  string `json:"warning,omitempty"`
+}
+
+// ProviderDocument is a document as its provider describes it
+type ProviderDocument struct {
+	ID    string `json:"id"`
+	Title string `json:"title"`
+	URL   string `json:"url"`
+	// ParentID is the document's parent in the provider's hierarchy, and
+	// Ancestors its parents root first, when the provider knows them
+	ParentID  string   `json:"parent_id,omitempty"`
+	Ancestors []string `json:"ancestors,omitempty"`
+	Labels    []string `json:"labels,omitempty"`
+	// Owners name who owns the document, as emails or handles such as
+	// @alice, for providers that know; nil when the provider doesn't, and
+	// empty when it does and the document has none
+	Owners []string `json:"owners,omitempty"`
+	// Version grows with every edit: Confluence's version number, the
+	// number of commits to a file in git, or for providers with neither, the
+	// last edit time in Unix seconds
+	Version  int        `json:"version,omitempty"`
+	EditedAt *time.Time `json:"edited_at,omitempty"`
+	EditedBy string     `json:"edited_by,omitempty"`
+	// Removed is set on documents deleted or trashed in the provider
+	Removed bool `json:"removed,omitempty"`
+}
+
+// ProviderDocumentList is one page of documents. NextCursor continues the
+// listing, and is empty on the last page.
+type ProviderDocumentList struct {
+	Documents  []ProviderDocument `json:"documents"`
+	NextCursor string             `json:"next_cursor,omitempty"`
+}
@@ -0,0 +1,323 @@
+package client_test
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/shaunpua/updoc/internal/config"
+	"github.com/shaunpua/updoc/internal/confluence"
+	"github.com/shaunpua/updoc/internal/confluence/confluencetest"
+	"github.com/shaunpua/updoc/internal/gitrepo"
+	"github.com/shaunpua/updoc/internal/notion"
+	"github.com/shaunpua/updoc/internal/secret"
+	"github.com/shaunpua/updoc/internal/services"
+	"github.com/shaunpua/updoc/internal/storage/memstore"
+	transport "github.com/shaunpua/updoc/internal/transport/http"
+	"github.com/shaunpua/updoc/pkg/client"
+)
+
+// newServer starts the real router over an in-memory store, with orgs
+// connected to a fake Confluence site, and returns the UpDoc URL and the
+// site
+func newServer(t *testing.T) (string, *confluencetest.Server) {
+	t.Helper()
+
+	site, err := confluencetest.NewServer(confluencetest.Options{Email: "bot@example.com", Token: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(site.Close)
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+	cipher, err := secret.NewCipher(base64.StdEncoding.EncodeToString(key))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := config.Default()
+	cfg.Confluence.MaxRetries = 0
+	cfg.Git.CacheDir = t.TempDir()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	store := memstore.New()
+	orgs, users, workspaces := store.Organizations(), store.Users(), store.Workspaces()
+	documents, flags, notifications := store.Documents(), store.Flags(), store.Notifications()
+
+	conf := services.NewConfluenceService(orgs, confluence.New(cfg.Confluence, logger), cipher, logger)
+	git := gitrepo.New(cfg.Git, logger)
+	providers := services.NewProviders(
+		services.NewConfluenceProvider(conf),
+		services.NewNotionProvider(notion.New(cfg.Notion, logger)),
+		services.NewGitProvider(git),
+	)
+	wsSvc := services.NewWorkspaceService(workspaces, documents, flags, users, conf, providers, logger)
+	flagSvc := services.NewFlagService(flags, documents, users, notifications, wsSvc, conf, logger)
+
+	e := transport.NewRouter(transport.Handlers{
+		Auth:          services.NewAuthService(users),
+		Organizations: transport.NewOrganizationHandler(services.NewOrganizationService(orgs, users, workspaces, logger), conf, wsSvc),
+		Workspaces:    transport.NewWorkspaceHandler(wsSvc),
+		Documents:     transport.NewDocumentHandler(services.NewDocumentService(documents, flags, wsSvc, logger)),
+		Flags:         transport.NewFlagHandler(flagSvc),
+		CodeChanges:   transport.NewCodeChangeHandler(services.NewCodeChangeService(git, documents, flags, users, wsSvc, flagSvc, logger)),
+		Notifications: transport.NewNotificationHandler(services.NewNotificationService(notifications, logger)),
+		Webhooks:      transport.NewWebhookHandler(services.NewConfluenceWebhookService(orgs, workspaces, documents, flagSvc, logger)),
+	})
+	srv := httptest.NewServer(e)
+	t.Cleanup(srv.Close)
+	return srv.URL, site
+}
+
+// newOrg creates an org on the ENG space and returns a client for its admin
+func newOrg(t *testing.T, baseURL string, site *confluencetest.Server, name string) (*client.Client, *client.CreateOrgResponse) {
+	t.Helper()
+
+	resp, err := client.New(baseURL).CreateOrganization(context.Background(), client.CreateOrgRequest{
+		Name:               name,
+		UserName:           "Alice Park",
+		UserEmail:          "alice@" + name + ".example.com",
+		ConfluenceBaseURL:  site.URL(),
+		ConfluenceEmail:    "bot@example.com",
+		ConfluenceToken:    "secret",
+		ConfluenceSpaceKey: "ENG",
+	})
+	if err != nil {
+		t.Fatalf("CreateOrganization: %v", err)
+	}
+	if resp.APIToken == "" || resp.Workspace == nil {
+		t.Fatalf("CreateOrganization = %+v, want an API token and a default workspace", resp)
+	}
+	return client.New(baseURL, client.WithToken(resp.APIToken)), resp
+}
+
+func TestClient(t *testing.T) {
+	ctx := context.Background()
+	baseURL, site := newServer(t)
+	admin, created := newOrg(t, baseURL, site, "acme")
+
+	me, err := admin.Me(ctx)
+	if err != nil {
+		t.Fatalf("Me: %v", err)
+	}
+	if me.ID != created.User.ID || me.Role != "admin" {
+		t.Errorf("Me = %+v, want the admin %s", me, created.User.ID)
+	}
+
+	org, err := admin.GetOrganization(ctx, created.Organization.Slug)
+	if err != nil {
+		t.Fatalf("GetOrganization: %v", err)
+	}
+	if org.ID != created.Organization.ID || org.ConfluenceSpaceKey != "ENG" {
+		t.Errorf("GetOrganization = %+v", org)
+	}
+
+	test, err := admin.TestConfluence(ctx, org.ID)
+	if err != nil {
+		t.Fatalf("TestConfluence: %v", err)
+	}
+	if !test.Success {
+		t.Errorf("TestConfluence = %+v, want success", test)
+	}
+
+	var pages []string
+	for page, err := range admin.AllConfluencePages(ctx, org.ID, 2) {
+		if err != nil {
+			t.Fatalf("AllConfluencePages: %v", err)
+		}
+		pages = append(pages, page.ID)
+	}
+	if len(pages) != 5 {
+		t.Errorf("AllConfluencePages = %v, want the 5 ENG pages", pages)
+	}
+
+	workspaces, err := admin.ListWorkspaces(ctx)
+	if err != nil {
+		t.Fatalf("ListWorkspaces: %v", err)
+	}
+	if len(workspaces) != 1 || workspaces[0].ID != created.Workspace.ID {
+		t.Fatalf("ListWorkspaces = %+v, want the default workspace", workspaces)
+	}
+	sync, err := admin.SyncWorkspace(ctx, created.Workspace.ID)
+	if err != nil {
+		t.Fatalf("SyncWorkspace: %v", err)
+	}
+	if sync.Total != 5 || sync.Created != 5 {
+		t.Errorf("SyncWorkspace = %+v, want 5 pages created", sync)
+	}
+
+	tree, err := admin.GetDocumentTree(ctx, created.Workspace.ID)
+	if err != nil {
+		t.Fatalf("GetDocumentTree: %v", err)
+	}
+	if tree.Documents != 5 || len(tree.Roots) != 1 {
+		t.Fatalf("GetDocumentTree = %d documents under %d roots, want 5 under 1", tree.Documents, len(tree.Roots))
+	}
+	var guide *client.Document
+	for _, node := range tree.Roots[0].Children {
+		if node.Document.ExternalID == "102" {
+			guide = node.Document
+		}
+	}
+	if guide == nil {
+		t.Fatal("GetDocumentTree: API Guide is not under Engineering Home")
+	}
+
+	added, err := admin.AddUser(ctx, org.ID, "ben@acme.example.com", "Ben Ortiz", "member")
+	if err != nil {
+		t.Fatalf("AddUser: %v", err)
+	}
+	member := client.New(baseURL, client.WithToken(added.APIToken))
+
+	flag, err := admin.CreateFlag(ctx, client.CreateFlagRequest{
+		DocumentID:  guide.ID,
+		Title:       "Token lifetime is wrong",
+		Description: "Tokens now expire after 30 days, not 90.",
+		Priority:    "high",
+		AssignTo:    "ben@acme.example.com",
+	})
+	if err != nil {
+		t.Fatalf("CreateFlag: %v", err)
+	}
+	if flag.AssignedTo == nil || *flag.AssignedTo != added.User.ID || flag.PageVersion != 2 {
+		t.Errorf("CreateFlag = %+v, want it assigned to %s at page version 2", flag, added.User.ID)
+	}
+
+	got, err := member.GetFlag(ctx, flag.ID)
+	if err != nil {
+		t.Fatalf("GetFlag: %v", err)
+	}
+	if got.Title != flag.Title || got.Document == nil || got.Document.ID != guide.ID {
+		t.Errorf("GetFlag = %+v, want the flag on %s", got, guide.ID)
+	}
+	listed, err := member.ListFlags(ctx, client.FlagFilters{Priority: "high"})
+	if err != nil {
+		t.Fatalf("ListFlags: %v", err)
+	}
+	if len(listed) != 1 || listed[0].ID != flag.ID {
+		t.Errorf("ListFlags = %+v, want only %s", listed, flag.ID)
+	}
+
+	resolved, err := admin.ResolveFlag(ctx, flag.ID, "Fixed in the guide")
+	if err != nil {
+		t.Fatalf("ResolveFlag: %v", err)
+	}
+	if resolved.Status != "resolved" || resolved.ResolutionWarning == "" {
+		t.Errorf("ResolveFlag = %+v, want it resolved with a warning that the page hasn't changed", resolved)
+	}
+	if _, err := admin.ReopenFlag(ctx, flag.ID, "The page still says 90 days"); err != nil {
+		t.Fatalf("ReopenFlag: %v", err)
+	}
+
+	notes, err := member.ListNotifications(ctx, true, 0)
+	if err != nil {
+		t.Fatalf("ListNotifications: %v", err)
+	}
+	if len(notes) != 1 || notes[0].FlagID != flag.ID || notes[0].Type != "flag_reopened" {
+		t.Fatalf("ListNotifications = %+v, want the reopened flag", notes)
+	}
+	if err := member.MarkNotificationRead(ctx, notes[0].ID); err != nil {
+		t.Fatalf("MarkNotificationRead: %v", err)
+	}
+	if notes, err := member.ListNotifications(ctx, true, 0); err != nil || len(notes) != 0 {
+		t.Errorf("ListNotifications after reading = %+v, %v, want none", notes, err)
+	}
+}
+
+func TestClientErrors(t *testing.T) {
+	ctx := context.Background()
+	baseURL, site := newServer(t)
+	admin, created := newOrg(t, baseURL, site, "acme")
+	other, _ := newOrg(t, baseURL, site, "globex")
+
+	tests := []struct {
+		name  string
+		call  func() error
+		check func(error) bool
+	}{
+		{"no token", func() error {
+			_, err := client.New(baseURL).Me(ctx)
+			return err
+		}, client.IsUnauthorized},
+		{"bad token", func() error {
+			_, err := client.New(baseURL, client.WithToken("not-a-token")).ListWorkspaces(ctx)
+			return err
+		}, client.IsUnauthorized},
+		{"unknown flag", func() error {
+			_, err := admin.GetFlag(ctx, "00000000-0000-4000-8000-999999999999")
+			return err
+		}, client.IsNotFound},
+		{"invalid flag", func() error {
+			_, err := admin.CreateFlag(ctx, client.CreateFlagRequest{Title: "x", Priority: "someday"})
+			return err
+		}, client.IsBadRequest},
+		{"another org's Confluence", func() error {
+			_, err := other.TestConfluence(ctx, created.Organization.ID)
+			return err
+		}, client.IsNotFound},
+		{"another org's workspace", func() error {
+			_, err := other.SyncWorkspace(ctx, created.Workspace.ID)
+			return err
+		}, client.IsNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.call()
+			if !tt.check(err) {
+				t.Errorf("got %v (HTTP %d)", err, client.StatusCode(err))
+			}
+		})
+	}
+}
+
+func TestClientConfluenceErrors(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name   string
+		faults confluencetest.Faults
+		status int
+	}{
+		{"rejected credentials", confluencetest.Faults{RejectAuth: true}, http.StatusBadRequest},
+		{"outage", confluencetest.Faults{ServerErrors: 1}, http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			baseURL, site := newServer(t)
+			admin, created := newOrg(t, baseURL, site, "acme")
+			site.SetFaults(tt.faults)
+			if _, err := admin.TestConfluence(ctx, created.Organization.ID); client.StatusCode(err) != tt.status {
+				t.Errorf("TestConfluence = %v (HTTP %d), want HTTP %d", err, client.StatusCode(err), tt.status)
+			}
+		})
+	}
+
+	t.Run("not a Confluence site", func(t *testing.T) {
+		// The updoc server answers Confluence's API paths with 404s
+		baseURL, _ := newServer(t)
+		resp, err := client.New(baseURL).CreateOrganization(ctx, client.CreateOrgRequest{
+			Name:               "acme",
+			UserName:           "Alice Park",
+			UserEmail:          "alice@acme.example.com",
+			ConfluenceBaseURL:  baseURL,
+			ConfluenceEmail:    "bot@example.com",
+			ConfluenceToken:    "secret",
+			ConfluenceSpaceKey: "ENG",
+		})
+		if err != nil {
+			t.Fatalf("CreateOrganization: %v", err)
+		}
+		admin := client.New(baseURL, client.WithToken(resp.APIToken))
+		if _, err := admin.TestConfluence(ctx, resp.Organization.ID); client.StatusCode(err) != http.StatusBadGateway {
+			t.Errorf("TestConfluence = %v (HTTP %d), want HTTP 502", err, client.StatusCode(err))
+		}
+	})
+}
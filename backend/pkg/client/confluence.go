@@ -0,0 +1,139 @@
+package client
+
+import (
+	"context"
+	"iter"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// ConfluencePage is one page of GET /orgs/:id/confluence/pages
+type ConfluencePage struct {
+	Pages   []ConfluencePageInfo `json:"pages"`
+	Count   int                  `json:"count"`
+	Start   int                  `json:"start"`
+	Limit   int                  `json:"limit"`
+	HasMore bool                 `json:"has_more"`
+}
+
+// TestConfluence calls POST /orgs/:id/test-confluence
+func (c *Client) TestConfluence(ctx context.Context, orgID string) (*ConfluenceTestResponse, error) {
+	var resp ConfluenceTestResponse
+	path := "/orgs/" + url.PathEscape(orgID) + "/test-confluence"
+	if err := c.do(ctx, http.MethodPost, path, nil, nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// StartConfluenceOAuth calls POST /orgs/:id/confluence/oauth/start. Open the
+// returned AuthorizationURL in a browser to approve access.
+func (c *Client) StartConfluenceOAuth(ctx context.Context, orgID string) (*ConfluenceOAuthStart, error) {
+	var resp ConfluenceOAuthStart
+	path := "/orgs/" + url.PathEscape(orgID) + "/confluence/oauth/start"
+	if err := c.do(ctx, http.MethodPost, path, nil, nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// ListConfluencePages calls GET /orgs/:id/confluence/pages for a single page of results
+func (c *Client) ListConfluencePages(ctx context.Context, orgID string, start, limit int) (*ConfluencePage, error) {
+	query := url.Values{}
+	query.Set("start", strconv.Itoa(start))
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+
+	var resp ConfluencePage
+	path := "/orgs/" + url.PathEscape(orgID) + "/confluence/pages"
+	if err := c.do(ctx, http.MethodGet, path, query, nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// AllConfluencePages iterates over every page in the org's space, fetching
+// pageSize results per request. Iteration stops at the first error.
+//
+//	for page, err := range c.AllConfluencePages(ctx, orgID, 50) {
+//		if err != nil { ... }
+//	}
+func (c *Client) AllConfluencePages(ctx context.Context, orgID string, pageSize int) iter.Seq2[ConfluencePageInfo, error] {
+	return func(yield func(ConfluencePageInfo, error) bool) {
+		start := 0
+		for {
+			resp, err := c.ListConfluencePages(ctx, orgID, start, pageSize)
+			if err != nil {
+				yield(ConfluencePageInfo{}, err)
+				return
+			}
+			for _, page := range resp.Pages {
+				if !yield(page, nil) {
+					return
+				}
+			}
+			if !resp.HasMore || len(resp.Pages) == 0 {
+				return
+			}
+			start += len(resp.Pages)
+		}
+	}
+}
+
+// SearchConfluence calls GET /orgs/:id/confluence/search for a single page of results
+func (c *Client) SearchConfluence(ctx context.Context, orgID string, req ConfluenceSearchRequest) (*ConfluenceSearchResult, error) {
+	query := url.Values{}
+	set := func(key, value string) {
+		if value != "" {
+			query.Set(key, value)
+		}
+	}
+	set("q", req.Query)
+	set("space", req.Space)
+	set("modified_after", req.ModifiedAfter)
+	set("modified_before", req.ModifiedBefore)
+	set("contributor", req.Contributor)
+	set("cursor", req.Cursor)
+	for _, label := range req.Labels {
+		query.Add("label", label)
+	}
+	if req.Start > 0 {
+		query.Set("start", strconv.Itoa(req.Start))
+	}
+	if req.Limit > 0 {
+		query.Set("limit", strconv.Itoa(req.Limit))
+	}
+
+	var resp ConfluenceSearchResult
+	path := "/orgs/" + url.PathEscape(orgID) + "/confluence/search"
+	if err := c.do(ctx, http.MethodGet, path, query, nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// AllConfluenceSearchResults iterates over every hit of a search, following
+// next_cursor or start from page to page. Iteration stops at the first error.
+func (c *Client) AllConfluenceSearchResults(ctx context.Context, orgID string, req ConfluenceSearchRequest) iter.Seq2[ConfluenceSearchHit, error] {
+	return func(yield func(ConfluenceSearchHit, error) bool) {
+		for {
+			resp, err := c.SearchConfluence(ctx, orgID, req)
+			if err != nil {
+				yield(ConfluenceSearchHit{}, err)
+				return
+			}
+			for _, hit := range resp.Results {
+				if !yield(hit, nil) {
+					return
+				}
+			}
+			if !resp.HasMore || len(resp.Results) == 0 {
+				return
+			}
+			req.Cursor = resp.NextCursor
+			req.Start = resp.Start + len(resp.Results)
+		}
+	}
+}
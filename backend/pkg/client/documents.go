@@ -0,0 +1,59 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+// GetDocumentContent calls GET /documents/:id/content. format is storage,
+// the default when "", or view.
+func (c *Client) GetDocumentContent(ctx context.Context, documentID, format string) (*DocumentContent, error) {
+	query := url.Values{}
+	if format != "" {
+		query.Set("format", format)
+	}
+
+	var content DocumentContent
+	if err := c.do(ctx, http.MethodGet, "/documents/"+url.PathEscape(documentID)+"/content", query, nil, &content); err != nil {
+		return nil, err
+	}
+	return &content, nil
+}
+
+// GetDocumentTree calls GET /workspaces/:id/documents/tree
+func (c *Client) GetDocumentTree(ctx context.Context, workspaceID string) (*DocumentTree, error) {
+	var tree DocumentTree
+	if err := c.do(ctx, http.MethodGet, "/workspaces/"+url.PathEscape(workspaceID)+"/documents/tree", nil, nil, &tree); err != nil {
+		return nil, err
+	}
+	return &tree, nil
+}
+
+// SetSourceLinks calls PUT /documents/:id/source-links
+func (c *Client) SetSourceLinks(ctx context.Context, documentID, repository string, paths, symbols []string) (*Document, error) {
+	body := map[string]interface{}{"repository": repository, "paths": paths, "symbols": symbols}
+	var document Document
+	if err := c.do(ctx, http.MethodPut, "/documents/"+url.PathEscape(documentID)+"/source-links", nil, body, &document); err != nil {
+		return nil, err
+	}
+	return &document, nil
+}
+
+// ReportCodeChange calls POST /code-changes
+func (c *Client) ReportCodeChange(ctx context.Context, req CodeChangeRequest) (*CodeChangeResult, error) {
+	var result CodeChangeResult
+	if err := c.do(ctx, http.MethodPost, "/code-changes", nil, req, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// CheckImpact calls POST /code-changes/impact
+func (c *Client) CheckImpact(ctx context.Context, req ImpactRequest) (*ImpactResult, error) {
+	var result ImpactResult
+	if err := c.do(ctx, http.MethodPost, "/code-changes/impact", nil, req, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
@@ -0,0 +1,52 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Error is returned for non-2xx responses. Message comes from the server's
+// {"message": "..."} error envelope when present.
+type Error struct {
+	StatusCode int    `json:"-"`
+	Message    string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("updoc: HTTP %d: %s", e.StatusCode, e.Message)
+}
+
+func newError(status int, body []byte) *Error {
+	apiErr := &Error{StatusCode: status}
+	if err := json.Unmarshal(body, apiErr); err != nil || apiErr.Message == "" {
+		apiErr.Message = strings.TrimSpace(string(body))
+	}
+	if apiErr.Message == "" {
+		apiErr.Message = http.StatusText(status)
+	}
+	return apiErr
+}
+
+// StatusCode returns the HTTP status of an *Error, or 0 for any other error
+func StatusCode(err error) int {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode
+	}
+	return 0
+}
+
+// IsNotFound reports whether err is a 404 from the server
+func IsNotFound(err error) bool { return StatusCode(err) == http.StatusNotFound }
+
+// IsBadRequest reports whether err is a 400 from the server
+func IsBadRequest(err error) bool { return StatusCode(err) == http.StatusBadRequest }
+
+// IsUnauthorized reports whether err is a 401 or 403 from the server
+func IsUnauthorized(err error) bool {
+	code := StatusCode(err)
+	return code == http.StatusUnauthorized || code == http.StatusForbidden
+}
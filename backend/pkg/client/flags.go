@@ -0,0 +1,113 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// Me can be passed as FlagFilters.AssignedTo or CreatedBy to mean the token's user
+const Me = "me"
+
+// CreateFlag calls POST /flags
+func (c *Client) CreateFlag(ctx context.Context, req CreateFlagRequest) (*Flag, error) {
+	var flag Flag
+	if err := c.do(ctx, http.MethodPost, "/flags", nil, req, &flag); err != nil {
+		return nil, err
+	}
+	return &flag, nil
+}
+
+// ListFlags calls GET /flags with the non-empty filters as query parameters
+func (c *Client) ListFlags(ctx context.Context, filters FlagFilters) ([]*Flag, error) {
+	query := url.Values{}
+	for key, value := range map[string]string{
+		"workspace_id": filters.WorkspaceID,
+		"status":       filters.Status,
+		"priority":     filters.Priority,
+		"assigned_to":  filters.AssignedTo,
+		"created_by":   filters.CreatedBy,
+		"search":       filters.Search,
+	} {
+		if value != "" {
+			query.Set(key, value)
+		}
+	}
+
+	var resp struct {
+		Flags []*Flag `json:"flags"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/flags", query, nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Flags, nil
+}
+
+// GetFlag calls GET /flags/:id
+func (c *Client) GetFlag(ctx context.Context, id string) (*Flag, error) {
+	var flag Flag
+	if err := c.do(ctx, http.MethodGet, "/flags/"+url.PathEscape(id), nil, nil, &flag); err != nil {
+		return nil, err
+	}
+	return &flag, nil
+}
+
+// UpdateFlag calls PATCH /flags/:id; nil fields are left unchanged
+func (c *Client) UpdateFlag(ctx context.Context, id string, req UpdateFlagRequest) (*Flag, error) {
+	var flag Flag
+	if err := c.do(ctx, http.MethodPatch, "/flags/"+url.PathEscape(id), nil, req, &flag); err != nil {
+		return nil, err
+	}
+	return &flag, nil
+}
+
+// ResolveFlag calls POST /flags/:id/resolve
+func (c *Client) ResolveFlag(ctx context.Context, id, note string) (*Flag, error) {
+	var flag Flag
+	body := map[string]string{"note": note}
+	if err := c.do(ctx, http.MethodPost, "/flags/"+url.PathEscape(id)+"/resolve", nil, body, &flag); err != nil {
+		return nil, err
+	}
+	return &flag, nil
+}
+
+// ConfirmFlag calls POST /flags/:id/confirm, resolving a flag awaiting
+// verification; an empty note names the page version confirmed
+func (c *Client) ConfirmFlag(ctx context.Context, id, note string) (*Flag, error) {
+	var flag Flag
+	body := map[string]string{"note": note}
+	if err := c.do(ctx, http.MethodPost, "/flags/"+url.PathEscape(id)+"/confirm", nil, body, &flag); err != nil {
+		return nil, err
+	}
+	return &flag, nil
+}
+
+// ReopenFlag calls POST /flags/:id/reopen
+func (c *Client) ReopenFlag(ctx context.Context, id, note string) (*Flag, error) {
+	var flag Flag
+	body := map[string]string{"note": note}
+	if err := c.do(ctx, http.MethodPost, "/flags/"+url.PathEscape(id)+"/reopen", nil, body, &flag); err != nil {
+		return nil, err
+	}
+	return &flag, nil
+}
+
+// GetFlagDiff calls GET /flags/:id/diff. format is unified, the default when
+// "", or side_by_side; contextLines, the unchanged lines around each change,
+// is the server's default of 3 when negative.
+func (c *Client) GetFlagDiff(ctx context.Context, id, format string, contextLines int) (*FlagDiff, error) {
+	query := url.Values{}
+	if format != "" {
+		query.Set("format", format)
+	}
+	if contextLines >= 0 {
+		query.Set("context", strconv.Itoa(contextLines))
+	}
+
+	var diff FlagDiff
+	if err := c.do(ctx, http.MethodGet, "/flags/"+url.PathEscape(id)+"/diff", query, nil, &diff); err != nil {
+		return nil, err
+	}
+	return &diff, nil
+}
@@ -0,0 +1,38 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// ListNotifications calls GET /notifications, newest first. limit <= 0 uses
+// the server's default.
+func (c *Client) ListNotifications(ctx context.Context, unreadOnly bool, limit int) ([]*Notification, error) {
+	query := url.Values{}
+	if unreadOnly {
+		query.Set("unread", "true")
+	}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+
+	var resp struct {
+		Notifications []*Notification `json:"notifications"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/notifications", query, nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Notifications, nil
+}
+
+// MarkNotificationRead calls POST /notifications/:id/read
+func (c *Client) MarkNotificationRead(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodPost, "/notifications/"+url.PathEscape(id)+"/read", nil, nil, nil)
+}
+
+// MarkAllNotificationsRead calls POST /notifications/read
+func (c *Client) MarkAllNotificationsRead(ctx context.Context) error {
+	return c.do(ctx, http.MethodPost, "/notifications/read", nil, nil, nil)
+}
@@ -0,0 +1,45 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+// CreateOrganization calls POST /orgs, creating an organization and its admin user
+func (c *Client) CreateOrganization(ctx context.Context, req CreateOrgRequest) (*CreateOrgResponse, error) {
+	var resp CreateOrgResponse
+	if err := c.do(ctx, http.MethodPost, "/orgs", nil, req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// GetOrganization calls GET /orgs/:slug
+func (c *Client) GetOrganization(ctx context.Context, slug string) (*Organization, error) {
+	var org Organization
+	if err := c.do(ctx, http.MethodGet, "/orgs/"+url.PathEscape(slug), nil, nil, &org); err != nil {
+		return nil, err
+	}
+	return &org, nil
+}
+
+// AddUser calls POST /orgs/:id/users (admin token required) and returns the new user's API token
+func (c *Client) AddUser(ctx context.Context, orgID, email, name, role string) (*AddUserResponse, error) {
+	body := map[string]string{"email": email, "name": name, "role": role}
+
+	var resp AddUserResponse
+	if err := c.do(ctx, http.MethodPost, "/orgs/"+url.PathEscape(orgID)+"/users", nil, body, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Me calls GET /me, returning the user the client's token belongs to
+func (c *Client) Me(ctx context.Context) (*User, error) {
+	var user User
+	if err := c.do(ctx, http.MethodGet, "/me", nil, nil, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
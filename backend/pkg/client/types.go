@@ -0,0 +1,57 @@
+package client
+
+import "github.com/shaunpua/updoc/pkg/api"
+
+// API types are aliases of the types in pkg/api, which the server's handlers
+// encode and decode, so the client can never drift from them.
+type (
+	Organization      = api.Organization
+	User              = api.User
+	Workspace         = api.Workspace
+	Document          = api.Document
+	Flag              = api.Flag
+	Notification      = api.Notification
+	FlagFilters       = api.FlagFilters
+	CreateFlagRequest = api.CreateFlagRequest
+	UpdateFlagRequest = api.UpdateFlagRequest
+
+	CreateWorkspaceRequest = api.CreateWorkspaceRequest
+	SyncResult             = api.SyncResult
+	NotificationAction     = api.NotificationAction
+
+	CreateOrgRequest       = api.CreateOrgRequest
+	CreateOrgResponse      = api.CreateOrgResponse
+	AddUserResponse        = api.AddUserResponse
+	ConfluenceTestResponse = api.ConfluenceTestResponse
+	ConfluencePageInfo     = api.ConfluencePageInfo
+	ConfluenceOAuthStart   = api.ConfluenceOAuthStart
+
+	ConfluenceSearchRequest = api.ConfluenceSearchRequest
+	ConfluenceSearchHit     = api.ConfluenceSearchHit
+	ConfluenceSearchResult  = api.ConfluenceSearchResult
+
+	DocumentContent       = api.DocumentContent
+	DocumentTree          = api.DocumentTree
+	DocumentTreeNode      = api.DocumentTreeNode
+	ConfluencePageContent = api.ConfluencePageContent
+
+	CodeChangeRequest  = api.CodeChangeRequest
+	CodeChangeResult   = api.CodeChangeResult
+	CodeChangeDocument = api.CodeChangeDocument
+	ImpactRequest      = api.ImpactRequest
+	ImpactResult       = api.ImpactResult
+	ImpactedDocument   = api.ImpactedDocument
+	Commit             = api.Commit
+
+	FlagDiff     = api.FlagDiff
+	FlagDiffHunk = api.FlagDiffHunk
+	DiffRow      = api.DiffRow
+
+	ConfluenceWebhookSetup = api.ConfluenceWebhookSetup
+	WriteBackSettings      = api.WriteBackSettings
+	LabelRule              = api.LabelRule
+
+	ConnectionTest       = api.ConnectionTest
+	ProviderDocument     = api.ProviderDocument
+	ProviderDocumentList = api.ProviderDocumentList
+)
@@ -0,0 +1,93 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// ListWorkspaces calls GET /workspaces
+func (c *Client) ListWorkspaces(ctx context.Context) ([]*Workspace, error) {
+	var resp struct {
+		Workspaces []*Workspace `json:"workspaces"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/workspaces", nil, nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Workspaces, nil
+}
+
+// CreateWorkspace calls POST /workspaces
+func (c *Client) CreateWorkspace(ctx context.Context, req CreateWorkspaceRequest) (*Workspace, error) {
+	var ws Workspace
+	if err := c.do(ctx, http.MethodPost, "/workspaces", nil, req, &ws); err != nil {
+		return nil, err
+	}
+	return &ws, nil
+}
+
+// SyncWorkspace calls POST /workspaces/:id/sync
+func (c *Client) SyncWorkspace(ctx context.Context, workspaceID string) (*SyncResult, error) {
+	var result SyncResult
+	if err := c.do(ctx, http.MethodPost, "/workspaces/"+url.PathEscape(workspaceID)+"/sync", nil, nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// TestWorkspaceConnection calls POST /workspaces/:id/test-connection
+func (c *Client) TestWorkspaceConnection(ctx context.Context, workspaceID string) (*ConnectionTest, error) {
+	var result ConnectionTest
+	if err := c.do(ctx, http.MethodPost, "/workspaces/"+url.PathEscape(workspaceID)+"/test-connection", nil, nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// SearchWorkspace calls GET /workspaces/:id/search. cursor continues from a
+// previous result's NextCursor; limit 0 uses the server's default.
+func (c *Client) SearchWorkspace(ctx context.Context, workspaceID, q, cursor string, limit int) (*ProviderDocumentList, error) {
+	query := url.Values{}
+	query.Set("q", q)
+	if cursor != "" {
+		query.Set("cursor", cursor)
+	}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+	var result ProviderDocumentList
+	if err := c.do(ctx, http.MethodGet, "/workspaces/"+url.PathEscape(workspaceID)+"/search", query, nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// EnableWebhook calls POST /workspaces/:id/webhook. The returned secret
+// replaces any earlier one and is not shown again.
+func (c *Client) EnableWebhook(ctx context.Context, workspaceID string) (*ConfluenceWebhookSetup, error) {
+	var setup ConfluenceWebhookSetup
+	if err := c.do(ctx, http.MethodPost, "/workspaces/"+url.PathEscape(workspaceID)+"/webhook", nil, nil, &setup); err != nil {
+		return nil, err
+	}
+	return &setup, nil
+}
+
+// SetWriteBack calls PUT /workspaces/:id/write-back
+func (c *Client) SetWriteBack(ctx context.Context, workspaceID string, settings WriteBackSettings) (*Workspace, error) {
+	var ws Workspace
+	if err := c.do(ctx, http.MethodPut, "/workspaces/"+url.PathEscape(workspaceID)+"/write-back", nil, settings, &ws); err != nil {
+		return nil, err
+	}
+	return &ws, nil
+}
+
+// SetLabelRules calls PUT /workspaces/:id/label-rules
+func (c *Client) SetLabelRules(ctx context.Context, workspaceID string, rules []LabelRule) (*Workspace, error) {
+	body := map[string]interface{}{"rules": rules}
+	var ws Workspace
+	if err := c.do(ctx, http.MethodPut, "/workspaces/"+url.PathEscape(workspaceID)+"/label-rules", nil, body, &ws); err != nil {
+		return nil, err
+	}
+	return &ws, nil
+}